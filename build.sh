@@ -3,10 +3,24 @@
 
 set -e
 
+# Usage:
+#   ./build.sh [BJJ|ED25519]            # Device build, confirmation screens on
+#   ./build.sh [BJJ|ED25519] speculos   # Auto-approving build for Speculos and tests
+
 CURVE="${1:-BJJ}"
+TARGET="${2:-device}"
 IMAGE="ghcr.io/ledgerhq/ledger-app-builder/ledger-app-builder:latest"
 
-echo "Building FROST app for curve: ${CURVE}"
+case "${TARGET}" in
+    device)   AUTO_APPROVE=0 ;;
+    speculos) AUTO_APPROVE=1 ;;
+    *)
+        echo "Error: unknown target: ${TARGET} (use device or speculos)"
+        exit 1
+        ;;
+esac
+
+echo "Building FROST app for curve: ${CURVE} (${TARGET}, AUTO_APPROVE=${AUTO_APPROVE})"
 echo "Using image: ${IMAGE}"
 echo ""
 
@@ -14,7 +28,7 @@ docker run --rm \
     -v "$(pwd):/app" \
     -w /app \
     "${IMAGE}" \
-    make CURVE="${CURVE}"
+    make CURVE="${CURVE}" AUTO_APPROVE="${AUTO_APPROVE}"
 
 echo ""
 echo "Build complete!"
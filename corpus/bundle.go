@@ -0,0 +1,52 @@
+package corpus
+
+import (
+	"fmt"
+	"path"
+)
+
+// Bundle is a reproducer bundle: everything needed to replay a signing
+// session on simulated devices byte for byte. Each device is fed exactly the
+// randomness it drew and runs its script, whose responses then only depend
+// on the implementation under test.
+type Bundle struct {
+	Name        string         `json:"-"` // Directory under repro/
+	Description string         `json:"description"`
+	Vector      string         `json:"vector"` // Name of the SigningVector the session computes
+	Devices     []BundleDevice `json:"devices"`
+}
+
+// BundleDevice is one participant's device in a Bundle.
+type BundleDevice struct {
+	ID         int     `json:"identifier"`
+	Random     string  `json:"random"` // Hex: every byte the device's RNG returns, in order
+	ScriptFile string  `json:"script"` // In the bundle's directory
+	Script     *Script `json:"-"`
+}
+
+// Bundles returns the reproducer bundles in name order, with their scripts.
+func Bundles() ([]*Bundle, error) {
+	names, err := glob("repro/*/bundle.json")
+	if err != nil {
+		return nil, err
+	}
+	bundles := make([]*Bundle, len(names))
+	for i, name := range names {
+		dir := path.Dir(name)
+		b := &Bundle{Name: path.Base(dir)}
+		if err := readJSON(name, b); err != nil {
+			return nil, err
+		}
+		for j := range b.Devices {
+			d := &b.Devices[j]
+			if d.ScriptFile == "" || path.Base(d.ScriptFile) != d.ScriptFile {
+				return nil, fmt.Errorf("corpus: %s: device %d: script must be a file in the bundle", name, d.ID)
+			}
+			if d.Script, err = readScript(path.Join(dir, d.ScriptFile), b.Name+"/"+baseName(d.ScriptFile)); err != nil {
+				return nil, err
+			}
+		}
+		bundles[i] = b
+	}
+	return bundles, nil
+}
@@ -0,0 +1,60 @@
+// Package corpus is the canonical test corpus of the FY Ledger app: golden
+// vectors, APDU scripts and reproducer bundles, embedded so the app's tests,
+// the keygen tooling and other implementations check against the same files.
+//
+// The files live under data/ and are plain JSON and text, so tests that are
+// not written in Go can read them from a checkout of this module:
+//
+//	data/h2c/vectors.json         hash-to-curve and hash-to-scalar known answers
+//	data/frost/<name>.json        FROST signing vectors, one per file
+//	data/apdu/<name>.apdu         APDU scripts for a fresh device
+//	data/repro/<name>/bundle.json reproducer bundles and their scripts
+//
+// Signing vectors and bundles are generated by keygen corpus write from a
+// fixed seed; APDU scripts are written by hand. keygen corpus check replays
+// all of them against the Go implementation.
+package corpus
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"path"
+)
+
+//go:embed data
+var data embed.FS
+
+// FS returns the corpus files, rooted at data/.
+func FS() fs.FS {
+	sub, err := fs.Sub(data, "data")
+	if err != nil {
+		panic(err)
+	}
+	return sub
+}
+
+// readJSON decodes the corpus file name into v.
+func readJSON(name string, v any) error {
+	b, err := fs.ReadFile(FS(), name)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(b, v); err != nil {
+		return fmt.Errorf("corpus: %s: %w", name, err)
+	}
+	return nil
+}
+
+// glob returns the corpus files matching pattern, in name order. A missing
+// directory matches nothing.
+func glob(pattern string) ([]string, error) {
+	return fs.Glob(FS(), pattern)
+}
+
+// baseName returns the file name of p without its extension.
+func baseName(p string) string {
+	base := path.Base(p)
+	return base[:len(base)-len(path.Ext(base))]
+}
@@ -0,0 +1,3 @@
+module github.com/f3rmion/fy-ledger/corpus
+
+go 1.25.4
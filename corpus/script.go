@@ -0,0 +1,118 @@
+package corpus
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Script is an APDU script: commands to send in order, each with the
+// response it must get. It is the format keygen apdu send reads.
+type Script struct {
+	Name  string
+	Steps []Step
+}
+
+// Step is one command of a Script.
+type Step struct {
+	Line     int    // In the script file
+	Comment  string // The # lines just before the command, without the #
+	Command  []byte
+	Expected []byte // Response data and status word; nil requires 9000 with any data
+}
+
+// ParseScript reads a script: one command per line as hex, optionally
+// followed by "=> expected response" (data and status word, also hex).
+// Blank lines and lines starting with # are skipped; whitespace inside hex
+// is ignored.
+func ParseScript(name string, r io.Reader) (*Script, error) {
+	s := &Script{Name: name}
+	var comment []string
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "":
+			comment = nil
+			continue
+		case strings.HasPrefix(line, "#"):
+			comment = append(comment, strings.TrimSpace(line[1:]))
+			continue
+		}
+
+		step := Step{Line: n, Comment: strings.Join(comment, " ")}
+		comment = nil
+		cmdHex, expHex, hasExpected := strings.Cut(line, "=>")
+		var err error
+		if step.Command, err = decodeHex(cmdHex); err != nil {
+			return nil, fmt.Errorf("%s:%d: command: %w", name, n, err)
+		}
+		if len(step.Command) < 2 {
+			return nil, fmt.Errorf("%s:%d: command too short", name, n)
+		}
+		if hasExpected {
+			if step.Expected, err = decodeHex(expHex); err != nil {
+				return nil, fmt.Errorf("%s:%d: expected response: %w", name, n, err)
+			}
+			if len(step.Expected) < 2 {
+				return nil, fmt.Errorf("%s:%d: expected response has no status word", name, n)
+			}
+		}
+		s.Steps = append(s.Steps, step)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return s, nil
+}
+
+// Format writes the script in the form ParseScript reads.
+func (s *Script) Format() []byte {
+	var b bytes.Buffer
+	for i, step := range s.Steps {
+		if step.Comment != "" {
+			if i > 0 {
+				b.WriteByte('\n')
+			}
+			fmt.Fprintf(&b, "# %s\n", step.Comment)
+		}
+		b.WriteString(hex.EncodeToString(step.Command))
+		if step.Expected != nil {
+			fmt.Fprintf(&b, " => %x", step.Expected)
+		}
+		b.WriteByte('\n')
+	}
+	return b.Bytes()
+}
+
+// Scripts returns the APDU scripts for a fresh device, in name order.
+func Scripts() ([]*Script, error) {
+	names, err := glob("apdu/*.apdu")
+	if err != nil {
+		return nil, err
+	}
+	scripts := make([]*Script, len(names))
+	for i, name := range names {
+		if scripts[i], err = readScript(name, baseName(name)); err != nil {
+			return nil, err
+		}
+	}
+	return scripts, nil
+}
+
+func readScript(file, name string) (*Script, error) {
+	f, err := FS().Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ParseScript(name, f)
+}
+
+func decodeHex(s string) ([]byte, error) {
+	return hex.DecodeString(strings.Join(strings.Fields(s), ""))
+}
@@ -0,0 +1,86 @@
+package corpus
+
+// H2CVector is a known answer for hash-to-curve (U set) or hash-to-scalar,
+// in the layout of RFC 9380 appendix J: field elements and scalars as
+// 32-byte big-endian hex, points compressed.
+type H2CVector struct {
+	DST    string   `json:"dst"`
+	Msg    string   `json:"msg"`         // Text
+	U      []string `json:"u,omitempty"` // hash_to_field output, for hash-to-curve
+	Output string   `json:"output"`      // Point or scalar
+}
+
+// H2CVectors returns the hash-to-curve and hash-to-scalar vectors.
+func H2CVectors() ([]H2CVector, error) {
+	var vs []H2CVector
+	if err := readJSON("h2c/vectors.json", &vs); err != nil {
+		return nil, err
+	}
+	return vs, nil
+}
+
+// SigningVector is one FROST signing session over Baby Jubjub with every
+// intermediate value, in the spirit of RFC 9591 appendix E. Scalars are
+// 32-byte big-endian hex and points compressed hex, as the app's APDUs carry
+// them.
+type SigningVector struct {
+	Name            string             `json:"name"`
+	Threshold       int                `json:"threshold"`
+	Total           int                `json:"total"`
+	GroupSecretKey  string             `json:"group_secret_key"`
+	GroupPublicKey  string             `json:"group_public_key"`
+	Message         string             `json:"message"` // 32-byte message hash, as INJECT_MESSAGE takes it
+	Shares          []ParticipantShare `json:"participant_shares"`
+	Signers         []SignerVector     `json:"signers"`         // In commitment list order
+	CommitmentList  string             `json:"commitment_list"` // Encoded as INJECT_COMMITMENTS takes it
+	GroupCommitment string             `json:"group_commitment"`
+	Challenge       string             `json:"challenge"`
+	Signature       string             `json:"sig"` // R || z
+}
+
+// ParticipantShare is one participant's key share.
+type ParticipantShare struct {
+	ID          int    `json:"identifier"`
+	Share       string `json:"participant_share"`
+	PublicShare string `json:"public_share"`
+}
+
+// SignerVector is one signer's part of a SigningVector. The nonces are
+// nonce_generate(randomness, share) with no context, as COMMIT draws them;
+// the randomness is what the device's RNG returns.
+type SignerVector struct {
+	ID                     int    `json:"identifier"`
+	HidingNonceRandomness  string `json:"hiding_nonce_randomness"`
+	BindingNonceRandomness string `json:"binding_nonce_randomness"`
+	HidingNonce            string `json:"hiding_nonce"`
+	BindingNonce           string `json:"binding_nonce"`
+	HidingNonceCommitment  string `json:"hiding_nonce_commitment"`
+	BindingNonceCommitment string `json:"binding_nonce_commitment"`
+	BindingFactor          string `json:"binding_factor"`
+	Lambda                 string `json:"lambda"`
+	SigShare               string `json:"sig_share"`
+}
+
+// SigningVectors returns the signing vectors in name order.
+func SigningVectors() ([]SigningVector, error) {
+	names, err := glob("frost/*.json")
+	if err != nil {
+		return nil, err
+	}
+	vs := make([]SigningVector, len(names))
+	for i, name := range names {
+		if err := readJSON(name, &vs[i]); err != nil {
+			return nil, err
+		}
+	}
+	return vs, nil
+}
+
+// Signing returns the signing vector called name.
+func Signing(name string) (*SigningVector, error) {
+	var v SigningVector
+	if err := readJSON("frost/"+name+".json", &v); err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
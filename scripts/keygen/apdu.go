@@ -0,0 +1,452 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"keygen/apdu"
+	"keygen/simdevice"
+	"keygen/workspace"
+)
+
+// runAPDU implements the apdu subcommands:
+//
+//	apdu decode [-json] [-profile file] [hex ...]   (reads one APDU per line from stdin if none given)
+//	apdu send [-addr host:port | -sim] [-json] [-profile file] [-require-approval] [-approval-log file] [-prompt-timeout d] [hex ...]
+//	apdu chunk [-ins 0x1C] [-max 255] [-profile file] <payload hex>
+//	apdu diff [-ins 0x1E] [-json] <expected hex> <actual hex>
+//	apdu counter [-addr host:port] [-profile file] [-slot 0] [-last n] [-json]
+//	apdu pool [-addr host:port] [-profile file] [-state pool.json] [-target 6] [-commit] [-reset] [-json]
+//
+// send also accepts "command => expected" lines and prints a field-level
+// diff when the response differs.
+//
+// -profile targets a fork of the app with a different CLA or instruction
+// bytes. send and chunk take upstream APDUs and emit the fork's; decode takes
+// the fork's APDUs as captured.
+//
+// -require-approval refuses to send INJECT_KEYS or PARTIAL_SIGN unless the app
+// reports that it asks a human to confirm; -approval-log appends one JSON
+// line per such command with the approval mode.
+//
+// -addr, -sim and -profile default to the current context's transport and
+// profile (see ctx).
+func runAPDU(args []string, ws *workspace.Context) {
+	if len(args) < 1 {
+		fail(KindUsage, "Usage: keygen apdu <decode|send|chunk|diff|counter|pool> [options]")
+	}
+
+	switch args[0] {
+	case "decode":
+		cmd := flag.NewFlagSet("apdu decode", flag.ExitOnError)
+		asJSON := cmd.Bool("json", false, "Print JSON instead of text")
+		profilePath := cmd.String("profile", ws.Profile, "CLA/INS profile of a forked app (JSON)")
+		stdioFlags(cmd)
+		cmd.Parse(args[1:])
+		runAPDUDecode(readAPDUInputs(cmd.Args()), loadAPDUProfile(*profilePath), *asJSON)
+	case "send":
+		cmd := flag.NewFlagSet("apdu send", flag.ExitOnError)
+		addr, simDefault := "127.0.0.1:9999", ws.Transport == "sim"
+		if ws.Transport != "" && !simDefault {
+			addr = ws.Transport
+		}
+		addrFlag := cmd.String("addr", addr, "Speculos APDU port")
+		sim := cmd.Bool("sim", simDefault, "Send to an in-process simulated device instead")
+		asJSON := cmd.Bool("json", false, "Print JSON instead of text")
+		profilePath := cmd.String("profile", ws.Profile, "CLA/INS profile of a forked app (JSON)")
+		requireApproval := cmd.Bool("require-approval", false, "Refuse key injection and signing on auto-approving apps")
+		approvalLog := cmd.String("approval-log", "", "Append approval records (JSONL) to this file")
+		promptTimeout := cmd.Duration("prompt-timeout", 0, "Cancel key injection and signing not confirmed within this time, and reset the device (0 = wait)")
+		stdioFlags(cmd)
+		cmd.Parse(args[1:])
+		if *sim && *profilePath != "" {
+			fail(KindUsage, "Error: -profile cannot be used with -sim (the simulated device speaks the upstream protocol)")
+		}
+		runAPDUSend(readAPDUInputs(cmd.Args()), *addrFlag, *sim, loadAPDUProfile(*profilePath), *requireApproval, *approvalLog, *promptTimeout, *asJSON)
+	case "chunk":
+		cmd := flag.NewFlagSet("apdu chunk", flag.ExitOnError)
+		ins := cmd.Uint("ins", apdu.InsInjectCommitmentsP1, "Instruction; only 0x1C, INJECT_COMMITMENTS, is chunked by the app")
+		chunkSize := cmd.Int("max", apdu.MaxChunk, "Maximum data bytes per APDU")
+		profilePath := cmd.String("profile", ws.Profile, "CLA/INS profile of a forked app (JSON)")
+		stdioFlags(cmd)
+		cmd.Parse(args[1:])
+		if cmd.NArg() != 1 {
+			fail(KindUsage, "Usage: keygen apdu chunk [-ins 0x1C] [-max 255] [-profile file] <payload hex>")
+		}
+		runAPDUChunk(byte(*ins), cmd.Arg(0), *chunkSize, loadAPDUProfile(*profilePath))
+	case "diff":
+		cmd := flag.NewFlagSet("apdu diff", flag.ExitOnError)
+		ins := cmd.Uint("ins", apdu.InsPartialSign, "Instruction that produced the responses")
+		asJSON := cmd.Bool("json", false, "Print JSON instead of text")
+		stdioFlags(cmd)
+		cmd.Parse(args[1:])
+		if cmd.NArg() != 2 {
+			fail(KindUsage, "Usage: keygen apdu diff [-ins 0x1E] <expected hex> <actual hex>")
+		}
+		runAPDUDiff(byte(*ins), cmd.Arg(0), cmd.Arg(1), *asJSON)
+	case "counter":
+		cmd := flag.NewFlagSet("apdu counter", flag.ExitOnError)
+		addr := "127.0.0.1:9999"
+		if ws.Transport != "" && ws.Transport != "sim" {
+			addr = ws.Transport
+		}
+		addrFlag := cmd.String("addr", addr, "Speculos APDU port")
+		profilePath := cmd.String("profile", ws.Profile, "CLA/INS profile of a forked app (JSON)")
+		slot := cmd.Uint("slot", 0, "Key slot")
+		last := cmd.Uint64("last", 0, "Counter recorded earlier; fail if the device reports less")
+		asJSON := cmd.Bool("json", false, "Print JSON instead of text")
+		stdioFlags(cmd)
+		cmd.Parse(args[1:])
+		runAPDUCounter(*addrFlag, loadAPDUProfile(*profilePath), byte(*slot), *last, *asJSON)
+	case "pool":
+		cmd := flag.NewFlagSet("apdu pool", flag.ExitOnError)
+		addr := "127.0.0.1:9999"
+		if ws.Transport != "" && ws.Transport != "sim" {
+			addr = ws.Transport
+		}
+		addrFlag := cmd.String("addr", addr, "Speculos APDU port")
+		profilePath := cmd.String("profile", ws.Profile, "CLA/INS profile of a forked app (JSON)")
+		statePath := cmd.String("state", "pool.json", "Host record of the device's pooled commitments")
+		target := cmd.Int("target", apdu.NoncePoolSize, "Top the pool up to this many pairs")
+		commit := cmd.Bool("commit", false, "Then send COMMIT and check it used the next pooled pair")
+		reset := cmd.Bool("reset", false, "Forget the recorded pairs first (after INJECT_KEYS)")
+		asJSON := cmd.Bool("json", false, "Print JSON instead of text")
+		stdioFlags(cmd)
+		cmd.Parse(args[1:])
+		runAPDUPool(*addrFlag, loadAPDUProfile(*profilePath), *statePath, *target, *commit, *reset, *asJSON)
+	default:
+		fail(KindUsage, "Unknown apdu command: %s", args[0])
+	}
+}
+
+// readAPDUInputs returns the APDUs given as arguments, or one per line from
+// stdin (blank lines and # comments skipped) if there are none.
+func readAPDUInputs(args []string) []string {
+	if len(args) > 0 {
+		return args
+	}
+	var inputs []string
+	scanner := bufio.NewScanner(os.Stdin)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" && !strings.HasPrefix(line, "#") {
+			inputs = append(inputs, line)
+		}
+	}
+	return inputs
+}
+
+// loadAPDUProfile loads the profile at path, or the upstream profile if path
+// is empty.
+func loadAPDUProfile(path string) *apdu.Profile {
+	if path == "" {
+		if p := ceremony.Profile(); p != nil {
+			return p
+		}
+		return apdu.DefaultProfile()
+	}
+	p, err := apdu.LoadProfile(path)
+	if err != nil {
+		fail(KindInput, "Error loading profile: %v", err)
+	}
+	return p
+}
+
+func runAPDUDecode(inputs []string, profile *apdu.Profile, asJSON bool) {
+	for i, in := range inputs {
+		command, err := decodeHexAPDU(in)
+		if err != nil {
+			fail(KindInput, "Error: %v", err)
+		}
+		decoded, err := apdu.Decode(profile.FromWire(command))
+		if err != nil {
+			fail(KindInput, "Error: %v", err)
+		}
+		if asJSON {
+			writeJSON(decoded)
+			continue
+		}
+		if i > 0 {
+			fmt.Println()
+		}
+		fmt.Print(decoded)
+	}
+}
+
+// ExchangeOutput is one command/response pair printed by apdu send.
+type ExchangeOutput struct {
+	Command  string             `json:"command"`
+	Response string             `json:"response"` // Data without the status word
+	SW       string             `json:"sw"`
+	Status   apdu.StatusInfo    `json:"status"`
+	Diff     *apdu.ResponseDiff `json:"diff,omitempty"` // Set when an expected response was given
+}
+
+// runAPDUSend sends each APDU in turn and explains the status word. It stops
+// at the first non-9000 response, or the first response that differs from
+// the expected one given after "=>", and exits non-zero.
+func runAPDUSend(inputs []string, addr string, sim bool, profile *apdu.Profile, requireApproval bool, approvalLog string, promptTimeout time.Duration, asJSON bool) {
+	var t apdu.Transport
+	if sim {
+		t = logTransport(simdevice.New().Transport())
+	} else {
+		s, err := apdu.DialSpeculos(addr, 5*time.Second)
+		if err != nil {
+			fail(KindTransport, "Error connecting to %s: %v", addr, err)
+		}
+		t = logTransport(profile.Wrap(s))
+	}
+	defer t.Close()
+
+	if requireApproval || approvalLog != "" {
+		var log io.Writer
+		if approvalLog != "" {
+			f, err := os.OpenFile(approvalLog, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+			if err != nil {
+				fail(KindInput, "Error: %v", err)
+			}
+			defer f.Close()
+			log = f
+		}
+		guard, err := newApprovalGuard(t, requireApproval, log)
+		if err != nil {
+			fail(KindTransport, "Error: %v", err)
+		}
+		fmt.Fprintf(os.Stderr, "App version %s\n", guard.Version())
+		t = guard
+	}
+	cancellable := &apdu.Cancellable{Transport: t, Notify: func(ins byte) {
+		fmt.Fprintf(os.Stderr, "No answer within %s: reject the %s prompt on the device\n", promptTimeout, apdu.InsName(ins))
+	}}
+
+	for _, in := range inputs {
+		// "command => expected" lines also check the response
+		var expected []byte
+		if cmdHex, expHex, ok := strings.Cut(in, "=>"); ok {
+			var err error
+			if expected, err = decodeHexAPDU(expHex); err != nil {
+				fail(KindInput, "Error: expected response: %v", err)
+			}
+			in = cmdHex
+		}
+
+		command, err := decodeHexAPDU(in)
+		if err != nil {
+			fail(KindInput, "Error: %v", err)
+		}
+		if len(command) < 2 {
+			fail(KindInput, "Error: APDU too short: %s", in)
+		}
+		var resp []byte
+		if promptTimeout > 0 && apdu.NeedsApproval(command[1]) {
+			ctx, cancel := context.WithTimeout(context.Background(), promptTimeout)
+			resp, err = cancellable.ExchangeContext(ctx, command)
+			cancel()
+		} else {
+			resp, err = t.Exchange(command)
+		}
+		var cancelled *apdu.CancelledError
+		if errors.As(err, &cancelled) {
+			if asJSON {
+				writeJSON(cancelled.Cancellation)
+			}
+			fail(KindFailure, "Error: %v", err)
+		}
+		if err != nil {
+			fail(KindTransport, "Error: %v", err)
+		}
+		data, sw := apdu.SplitResponse(resp)
+		out := ExchangeOutput{
+			Command:  hex.EncodeToString(command),
+			Response: hex.EncodeToString(data),
+			SW:       fmt.Sprintf("%04X", sw),
+			Status:   apdu.ExplainStatus(sw, command[1]),
+		}
+		if expected != nil {
+			out.Diff = apdu.CompareResponse(command[1], expected, resp)
+		}
+
+		if asJSON {
+			writeJSON(out)
+		} else {
+			fmt.Printf("=> %s  (%s)\n", out.Command, apdu.InsName(command[1]))
+			if out.Response != "" {
+				fmt.Printf("<= %s\n", out.Response)
+			}
+			fmt.Printf("   %s\n", out.Status)
+			if out.Diff != nil && !out.Diff.Equal() {
+				fmt.Print(out.Diff)
+			}
+		}
+
+		// An expected response replaces the 9000 requirement
+		if out.Diff != nil {
+			if !out.Diff.Equal() {
+				fail(KindFailure, "Error: the response to %s differs from the expected one", apdu.InsName(command[1]))
+			}
+		} else if sw != apdu.SwOK {
+			fail(statusKind(sw, command[1]), "Error: %s returned %04X %s", apdu.InsName(command[1]), sw, out.Status.Name)
+		}
+	}
+}
+
+// newApprovalGuard wraps t in an approval guard that appends its records to
+// log, if given.
+func newApprovalGuard(t apdu.Transport, require bool, log io.Writer) (*apdu.ApprovalGuard, error) {
+	var record func(apdu.ApprovalRecord) error
+	if log != nil {
+		// Each record is a single write
+		record = func(r apdu.ApprovalRecord) error {
+			b, err := json.Marshal(r)
+			if err != nil {
+				return err
+			}
+			_, err = log.Write(append(b, '\n'))
+			return err
+		}
+	}
+	return apdu.NewApprovalGuard(t, require, record)
+}
+
+// runAPDUCounter reads a key slot's signing counter. A value below last, a
+// counter recorded earlier for this device, means the device was cloned,
+// restored or reinstalled since.
+func runAPDUCounter(addr string, profile *apdu.Profile, slot byte, last uint64, asJSON bool) {
+	s, err := apdu.DialSpeculos(addr, 5*time.Second)
+	if err != nil {
+		fail(KindTransport, "Error connecting to %s: %v", addr, err)
+	}
+	t := logTransport(profile.Wrap(s))
+	defer t.Close()
+
+	c, err := apdu.ReadCounter(t, slot)
+	if err != nil {
+		fail(KindTransport, "Error: %v", err)
+	}
+	if asJSON {
+		writeJSON(c)
+	} else {
+		fmt.Printf("Slot %d: counter %d (group %s)\n", c.Slot, c.Value, c.GroupKey)
+	}
+	if c.Value < last {
+		fail(KindCrypto, "Counter went back from %d to %d: device cloned, restored or reinstalled?", last, c.Value)
+	}
+}
+
+// runAPDUPool replenishes the device's nonce pool with COMMIT_BATCH, a few
+// pairs per exchange, and keeps the host's record of it in statePath.
+func runAPDUPool(addr string, profile *apdu.Profile, statePath string, target int, commit, reset, asJSON bool) {
+	if target < 0 || target > apdu.NoncePoolSize {
+		fail(KindInput, "Error: -target must be 0..%d", apdu.NoncePoolSize)
+	}
+	var pool apdu.CommitmentPool
+	if _, err := os.Stat(statePath); err == nil && !reset {
+		readJSONFile(statePath, &pool)
+	}
+
+	s, err := apdu.DialSpeculos(addr, 5*time.Second)
+	if err != nil {
+		fail(KindTransport, "Error connecting to %s: %v", addr, err)
+	}
+	t := logTransport(profile.Wrap(s))
+	defer t.Close()
+
+	save := func() {
+		data, _ := json.MarshalIndent(&pool, "", "  ")
+		if err := os.WriteFile(statePath, append(data, '\n'), 0644); err != nil {
+			fail(KindFailure, "Error writing %s: %v", statePath, err)
+		}
+	}
+
+	exchanges := pool.Exchanges
+	err = pool.Replenish(t, target)
+	save()
+	if err != nil {
+		fail(KindTransport, "Error: %v", err)
+	}
+	fmt.Fprintf(os.Stderr, "Pool holds %d pairs (%d COMMIT_BATCH exchanges this run)\n", pool.Len(), pool.Exchanges-exchanges)
+
+	var used *apdu.PooledCommitment
+	if commit {
+		c, err := pool.Commit(t)
+		save()
+		if err != nil {
+			fail(KindTransport, "Error: %v", err)
+		}
+		used = &c
+	}
+
+	if asJSON {
+		writeJSON(struct {
+			*apdu.CommitmentPool
+			Committed *apdu.PooledCommitment `json:"committed,omitempty"`
+		}{&pool, used})
+		return
+	}
+	fmt.Printf("Pooled: %d (fetched %d, consumed %d, %d exchanges)\n", pool.Len(), pool.Fetched, pool.Consumed, pool.Exchanges)
+	if used != nil {
+		fmt.Printf("COMMIT used pair %d: hiding %s binding %s\n", used.Seq, used.Hiding, used.Binding)
+	}
+}
+
+// runAPDUDiff compares an expected and an actual response for ins.
+func runAPDUDiff(ins byte, expectedHex, actualHex string, asJSON bool) {
+	expected, err := decodeHexAPDU(expectedHex)
+	if err != nil {
+		fail(KindInput, "Error: expected: %v", err)
+	}
+	actual, err := decodeHexAPDU(actualHex)
+	if err != nil {
+		fail(KindInput, "Error: actual: %v", err)
+	}
+
+	diff := apdu.CompareResponse(ins, expected, actual)
+	if asJSON {
+		writeJSON(diff)
+	} else {
+		fmt.Print(diff)
+	}
+	if !diff.Equal() {
+		fail(KindFailure, "Error: the responses differ")
+	}
+}
+
+// runAPDUChunk prints the APDU frames that carry payload, one per line.
+func runAPDUChunk(ins byte, payloadHex string, chunkSize int, profile *apdu.Profile) {
+	payload, err := decodeHexAPDU(payloadHex)
+	if err != nil {
+		fail(KindInput, "Error: %v", err)
+	}
+
+	if ins != apdu.InsInjectCommitmentsP1 {
+		fail(KindUsage, "Error: the app chunks only INJECT_COMMITMENTS (0x%02X), not INS 0x%02X", apdu.InsInjectCommitmentsP1, ins)
+	}
+	frames, err := apdu.CommitmentFrames(payload, chunkSize)
+	if err != nil {
+		fail(KindInput, "Error: %v", err)
+	}
+	for _, f := range frames {
+		fmt.Println(strings.ToUpper(hex.EncodeToString(profile.ToWire(f))))
+	}
+}
+
+// decodeHexAPDU accepts hex with optional spaces, colons or a 0x prefix, as
+// APDUs tend to appear in logs.
+func decodeHexAPDU(s string) ([]byte, error) {
+	s = strings.TrimPrefix(strings.TrimSpace(s), "0x")
+	s = strings.NewReplacer(" ", "", ":", "", "\t", "").Replace(s)
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid APDU hex: %w", err)
+	}
+	return b, nil
+}
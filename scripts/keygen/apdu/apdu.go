@@ -0,0 +1,84 @@
+// Package apdu holds the FROST Ledger app's APDU constants and helpers for
+// building and interpreting command/response APDUs on the host side.
+//
+// Values mirror src/handler.h in the embedded app.
+package apdu
+
+// Class byte
+const CLA = 0xE0
+
+// Instruction bytes
+const (
+	InsGetVersion          = 0x00
+	InsGetPublicKey        = 0x01
+	InsInjectKeys          = 0x19
+	InsCommit              = 0x1A
+	InsInjectMessage       = 0x1B
+	InsInjectCommitmentsP1 = 0x1C
+	InsInjectCommitmentsP2 = 0x1D
+	InsPartialSign         = 0x1E
+	InsReset               = 0x1F
+	InsInjectChallenge     = 0x20 // Pre-computed Poseidon challenge for Railgun
+	InsGetCounter          = 0x21 // Monotonic signing counter of a key slot (planned)
+	InsCommitBatch         = 0x22 // Several commitment pairs for the device's nonce pool (planned)
+	InsGetDebugTrace       = 0x23 // Intermediates of the last PARTIAL_SIGN, debug builds only (planned)
+	InsWipeKeys            = 0x24 // Erase the key slot and the signing context, to decommission a participant
+)
+
+// Status words
+const (
+	SwOK               = 0x9000
+	SwWrongLength      = 0x6700
+	SwWrongP1P2        = 0x6A86
+	SwConditionsNotSat = 0x6985
+	SwInvalidData      = 0x6A80
+	SwInsNotSupported  = 0x6D00
+	SwClaNotSupported  = 0x6E00
+	SwUserRejected     = 0x6985 // Same value as SwConditionsNotSat on-device
+	SwInternalError    = 0x6F00
+)
+
+// App flags (GET_VERSION byte 3)
+const (
+	AppFlagAutoApprove = 0x01 // Confirmation screens are skipped
+	AppFlagCounter     = 0x02 // GET_COUNTER is supported
+	AppFlagCommitBatch = 0x04 // COMMIT_BATCH is supported
+	AppFlagDebugTrace  = 0x08 // Debug build: GET_DEBUG_TRACE is supported
+	AppFlagPurpose     = 0x10 // INJECT_KEYS takes a purpose tag
+)
+
+// Curve identifiers (INJECT_KEYS P1)
+const (
+	CurveBJJ     = 0x00
+	CurveEd25519 = 0x01
+)
+
+// Payload sizes
+const (
+	PointSize           = 32
+	ScalarSize          = 32
+	IdentifierSize      = 32
+	CommitmentEntrySize = IdentifierSize + 2*PointSize // id || hiding || binding
+	MaxParticipants     = 15
+	CounterSize         = 4             // GET_COUNTER value, big-endian
+	CommitPairSize      = 2 * PointSize // hiding || binding
+	MaxCommitBatch      = 3             // Pairs per COMMIT_BATCH response (256-byte limit)
+	NoncePoolSize       = 8             // Pairs a device's nonce pool holds
+	MaxPurposeLen       = 16            // INJECT_KEYS purpose tag, after the share
+)
+
+// Command builds a short command APDU: CLA || INS || P1 || P2 || Lc || data.
+func Command(ins, p1, p2 byte, data []byte) []byte {
+	out := make([]byte, 0, 5+len(data))
+	out = append(out, CLA, ins, p1, p2, byte(len(data)))
+	return append(out, data...)
+}
+
+// SplitResponse splits a response APDU into its data and status word.
+func SplitResponse(resp []byte) (data []byte, sw uint16) {
+	if len(resp) < 2 {
+		return nil, 0
+	}
+	n := len(resp) - 2
+	return resp[:n], uint16(resp[n])<<8 | uint16(resp[n+1])
+}
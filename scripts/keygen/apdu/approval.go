@@ -0,0 +1,168 @@
+package apdu
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Approval modes, as reported by the app's GET_VERSION flags
+const (
+	ApprovalDevice  = "device"  // A human confirmed on the device
+	ApprovalAuto    = "auto"    // Auto-approving build (Speculos testing)
+	ApprovalUnknown = "unknown" // App predates the flags byte
+)
+
+// Version is the GET_VERSION response.
+type Version struct {
+	Major    byte `json:"major"`
+	Minor    byte `json:"minor"`
+	Patch    byte `json:"patch"`
+	Flags    byte `json:"flags"`
+	HasFlags bool `json:"has_flags"`
+}
+
+// ParseVersion parses GET_VERSION response data. Apps older than the flags
+// byte return three bytes.
+func ParseVersion(data []byte) (Version, error) {
+	switch len(data) {
+	case 3:
+		return Version{Major: data[0], Minor: data[1], Patch: data[2]}, nil
+	case 4:
+		return Version{Major: data[0], Minor: data[1], Patch: data[2], Flags: data[3], HasFlags: true}, nil
+	}
+	return Version{}, fmt.Errorf("GET_VERSION: expected 3 or 4 bytes, got %d", len(data))
+}
+
+// ApprovalMode reports how the app confirms key injection and signing.
+func (v Version) ApprovalMode() string {
+	switch {
+	case !v.HasFlags:
+		return ApprovalUnknown
+	case v.Flags&AppFlagAutoApprove != 0:
+		return ApprovalAuto
+	}
+	return ApprovalDevice
+}
+
+func (v Version) String() string {
+	s := fmt.Sprintf("%d.%d.%d (approval: %s", v.Major, v.Minor, v.Patch, v.ApprovalMode())
+	if v.HasCounter() {
+		s += ", signing counter"
+	}
+	if v.HasCommitBatch() {
+		s += ", nonce pool"
+	}
+	return s + ")"
+}
+
+// GetVersion queries the app version over t.
+func GetVersion(t Transport) (Version, error) {
+	resp, err := t.Exchange(Command(InsGetVersion, 0, 0, nil))
+	if err != nil {
+		return Version{}, err
+	}
+	data, sw := SplitResponse(resp)
+	if sw != SwOK {
+		return Version{}, fmt.Errorf("GET_VERSION: %s", ExplainStatus(sw, InsGetVersion))
+	}
+	return ParseVersion(data)
+}
+
+// NeedsApproval reports whether the app shows a confirmation screen for ins.
+func NeedsApproval(ins byte) bool {
+	return ins == InsInjectKeys || ins == InsPartialSign || ins == InsWipeKeys
+}
+
+// ApprovalRecord is the audit entry for one approval-gated command.
+type ApprovalRecord struct {
+	Time        time.Time `json:"time"`
+	INS         string    `json:"ins"`
+	Mode        string    `json:"approval"`
+	SW          string    `json:"sw"`
+	Approved    bool      `json:"approved"`
+	CommandHash string    `json:"command_sha256"` // The command carries key material, so only its hash is kept
+
+	// Counter is the slot's signing counter after a successful PARTIAL_SIGN,
+	// on apps that keep one.
+	Counter *uint64 `json:"counter,omitempty"`
+}
+
+// ErrNoDeviceApproval is returned when human approval is required but the app
+// does not ask for it.
+var ErrNoDeviceApproval = errors.New("device does not require human approval")
+
+// ApprovalGuard wraps a Transport and tracks the approval mode of every
+// INJECT_KEYS and PARTIAL_SIGN exchange, and the signing counter after each
+// signature if the app keeps one.
+type ApprovalGuard struct {
+	Transport
+
+	// Require refuses approval-gated commands, without sending them, unless
+	// the app confirms on-device.
+	Require bool
+
+	// Record, if set, receives one record per approval-gated command. A
+	// failure to record fails the exchange.
+	Record func(ApprovalRecord) error
+
+	version Version
+}
+
+// NewApprovalGuard queries the app's approval mode over t.
+func NewApprovalGuard(t Transport, require bool, record func(ApprovalRecord) error) (*ApprovalGuard, error) {
+	v, err := GetVersion(t)
+	if err != nil {
+		return nil, err
+	}
+	return &ApprovalGuard{Transport: t, Require: require, Record: record, version: v}, nil
+}
+
+// Mode returns the app's approval mode.
+func (g *ApprovalGuard) Mode() string {
+	return g.version.ApprovalMode()
+}
+
+// Version returns the app version read when the guard was created.
+func (g *ApprovalGuard) Version() Version {
+	return g.version
+}
+
+func (g *ApprovalGuard) Exchange(command []byte) ([]byte, error) {
+	if len(command) < 2 || !NeedsApproval(command[1]) {
+		return g.Transport.Exchange(command)
+	}
+	if g.Require && g.Mode() != ApprovalDevice {
+		return nil, fmt.Errorf("%s: %w (approval mode %s)", InsName(command[1]), ErrNoDeviceApproval, g.Mode())
+	}
+
+	resp, err := g.Transport.Exchange(command)
+	if err != nil {
+		return nil, err
+	}
+	if g.Record != nil {
+		_, sw := SplitResponse(resp)
+		sum := sha256.Sum256(command)
+		rec := ApprovalRecord{
+			Time:        time.Now().UTC(),
+			INS:         InsName(command[1]),
+			Mode:        g.Mode(),
+			SW:          fmt.Sprintf("%04X", sw),
+			Approved:    sw == SwOK,
+			CommandHash: hex.EncodeToString(sum[:]),
+		}
+		if command[1] == InsPartialSign && sw == SwOK && g.version.HasCounter() {
+			c, err := ReadCounter(g.Transport, 0)
+			if err != nil {
+				return nil, fmt.Errorf("approval audit: %w", err)
+			}
+			rec.Counter = &c.Value
+		}
+		if err := g.Record(rec); err != nil {
+			return nil, fmt.Errorf("approval audit: %w", err)
+		}
+	}
+	return resp, nil
+}
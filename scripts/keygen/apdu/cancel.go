@@ -0,0 +1,159 @@
+package apdu
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// DefaultCancelGrace is how long a cancelled exchange waits for the device
+// to answer, e.g. for the operator to reject its prompt.
+const DefaultCancelGrace = 30 * time.Second
+
+// Device states after a cancelled exchange
+const (
+	DeviceIdle    = "idle"    // RESET cleared the signing context and its nonces
+	DeviceUnknown = "unknown" // The device did not answer; it may still show the prompt
+	DeviceApplied = "applied" // The device approved a command RESET does not undo (INJECT_KEYS, WIPE_KEYS)
+)
+
+// applied describes what an approved INJECT_KEYS or WIPE_KEYS left on the
+// device, which RESET does not undo, or is empty for other instructions.
+func applied(ins byte) string {
+	switch ins {
+	case InsInjectKeys:
+		return "the device stored the keys, replacing any it held"
+	case InsWipeKeys:
+		return "the device wiped its key slot"
+	}
+	return ""
+}
+
+// Cancellation describes how a cancelled exchange was wound up.
+type Cancellation struct {
+	INS      string `json:"ins"`
+	Prompt   bool   `json:"prompt"`            // The command shows a confirmation screen
+	Answered bool   `json:"answered"`          // The device answered within the grace period
+	SW       string `json:"sw,omitempty"`      // Its answer, which was discarded
+	State    string `json:"state"`             // DeviceIdle, DeviceUnknown or DeviceApplied
+	Applied  string `json:"applied,omitempty"` // With DeviceApplied, what the device did
+
+	// Response is the discarded answer (data || SW), for callers that must
+	// account for what the device did anyway, such as a COMMIT that popped
+	// a pooled pair.
+	Response []byte `json:"-"`
+}
+
+// CancelledError is returned by ExchangeContext when its context ends
+// before the device answers. It unwraps to the context's error.
+type CancelledError struct {
+	Cancellation
+	Cause error
+}
+
+func (e *CancelledError) Error() string {
+	switch {
+	case e.State == DeviceApplied:
+		return fmt.Sprintf("%s cancelled (%v), but the operator had approved it: %s", e.INS, e.Cause, e.Applied)
+	case e.State == DeviceIdle:
+		return fmt.Sprintf("%s cancelled (%v): device reset, nonces cleared", e.INS, e.Cause)
+	case e.Prompt:
+		return fmt.Sprintf("%s cancelled (%v): device did not answer, connection closed; reject the prompt on the device and send RESET before reusing it", e.INS, e.Cause)
+	}
+	return fmt.Sprintf("%s cancelled (%v): device did not answer, connection closed; send RESET before reusing it", e.INS, e.Cause)
+}
+
+func (e *CancelledError) Unwrap() error {
+	return e.Cause
+}
+
+// Cancellable wraps a Transport so an exchange can be abandoned, e.g. when
+// its signing session is aborted while the device waits for the operator.
+// No APDU can interrupt a pending command, so cancelling one:
+//
+//  1. calls Notify if the device shows a prompt, to have the operator
+//     reject it;
+//  2. waits up to Grace for the device to answer, and discards the answer,
+//     even an approval;
+//  3. sends RESET, which clears the signing context and its nonces, so a
+//     PARTIAL_SIGN cannot be completed with them later.
+//
+// RESET does not undo an approved INJECT_KEYS or WIPE_KEYS: the device
+// then stored or wiped the keys all the same, and its state is
+// DeviceApplied.
+//
+// If the device does not answer in time the transport is closed, since it
+// would deliver the late answer to the next command, and the device's
+// state is DeviceUnknown.
+type Cancellable struct {
+	Transport
+
+	// Grace is how long to wait for the device once cancelled. Zero means
+	// DefaultCancelGrace.
+	Grace time.Duration
+
+	// Notify, if set, is called when an exchange whose command shows a
+	// prompt is cancelled, before waiting.
+	Notify func(ins byte)
+}
+
+// ExchangeContext is Exchange, cancelled when ctx ends (see Cancellable).
+func (c *Cancellable) ExchangeContext(ctx context.Context, command []byte) ([]byte, error) {
+	if len(command) < 2 {
+		return c.Transport.Exchange(command)
+	}
+
+	type result struct {
+		resp []byte
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		resp, err := c.Transport.Exchange(command)
+		done <- result{resp, err}
+	}()
+
+	select {
+	case r := <-done:
+		return r.resp, r.err
+	case <-ctx.Done():
+	}
+
+	ins := command[1]
+	e := &CancelledError{
+		Cancellation: Cancellation{INS: InsName(ins), Prompt: NeedsApproval(ins), State: DeviceUnknown},
+		Cause:        ctx.Err(),
+	}
+	if e.Prompt && c.Notify != nil {
+		c.Notify(ins)
+	}
+	grace := c.Grace
+	if grace == 0 {
+		grace = DefaultCancelGrace
+	}
+	timer := time.NewTimer(grace)
+	defer timer.Stop()
+	select {
+	case r := <-done:
+		if r.err != nil {
+			return nil, e
+		}
+		e.Answered, e.Response = true, r.resp
+		_, sw := SplitResponse(r.resp)
+		e.SW = fmt.Sprintf("%04X", sw)
+	case <-timer.C:
+		c.Transport.Close()
+		return nil, e
+	}
+
+	resp, err := c.Transport.Exchange(Command(InsReset, 0, 0, nil))
+	if err == nil {
+		if _, sw := SplitResponse(resp); sw == SwOK {
+			e.State = DeviceIdle
+		}
+	}
+	if _, sw := SplitResponse(e.Response); sw == SwOK && applied(ins) != "" {
+		e.State, e.Applied = DeviceApplied, applied(ins)
+	}
+	return nil, e
+}
@@ -0,0 +1,59 @@
+package apdu
+
+import "fmt"
+
+// MaxChunk is the largest payload a short APDU can carry.
+const MaxChunk = 255
+
+// CommitmentFrames splits an encoded commitment list into the app's
+// INJECT_COMMITMENTS_P1 frame (P1 = participant count) followed by as many
+// INJECT_COMMITMENTS_P2 frames as needed. The device appends each P2 chunk
+// and answers every frame with the running byte count.
+func CommitmentFrames(list []byte, chunkSize int) ([][]byte, error) {
+	if len(list)%CommitmentEntrySize != 0 {
+		return nil, fmt.Errorf("commitment list length %d is not a multiple of %d", len(list), CommitmentEntrySize)
+	}
+	n := len(list) / CommitmentEntrySize
+	if n < 2 || n > MaxParticipants {
+		return nil, fmt.Errorf("%d participants, the app accepts 2..%d", n, MaxParticipants)
+	}
+	if chunkSize <= 0 || chunkSize > MaxChunk {
+		chunkSize = MaxChunk
+	}
+
+	first := min(chunkSize, len(list))
+	frames := [][]byte{Command(InsInjectCommitmentsP1, byte(n), 0, list[:first])}
+	for off := first; off < len(list); off += chunkSize {
+		end := min(off+chunkSize, len(list))
+		frames = append(frames, Command(InsInjectCommitmentsP2, 0, 0, list[off:end]))
+	}
+	return frames, nil
+}
+
+// SendCommitments streams an encoded commitment list and checks the device's
+// running byte count after each frame.
+func SendCommitments(t Transport, list []byte, chunkSize int) error {
+	frames, err := CommitmentFrames(list, chunkSize)
+	if err != nil {
+		return err
+	}
+	sent := 0
+	for i, frame := range frames {
+		resp, err := t.Exchange(frame)
+		if err != nil {
+			return err
+		}
+		data, sw := SplitResponse(resp)
+		if sw != SwOK {
+			return fmt.Errorf("commitment frame %d: %s", i, ExplainStatus(sw, frame[1]))
+		}
+		sent += len(frame) - 5
+		if len(data) != 2 {
+			return fmt.Errorf("commitment frame %d: expected 2-byte count, got %d bytes", i, len(data))
+		}
+		if got := int(data[0])<<8 | int(data[1]); got != sent {
+			return fmt.Errorf("commitment frame %d: device has %d bytes, sent %d", i, got, sent)
+		}
+	}
+	return nil
+}
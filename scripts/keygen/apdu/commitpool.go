@@ -0,0 +1,189 @@
+package apdu
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// PooledCommitment is one commitment pair the device generated ahead of time
+// with COMMIT_BATCH and holds the nonces for.
+type PooledCommitment struct {
+	Seq     uint16 `json:"seq"`     // Device's sequence number for the pair
+	Hiding  string `json:"hiding"`  // 32 bytes
+	Binding string `json:"binding"` // 32 bytes
+}
+
+// Errors
+var (
+	ErrNoCommitBatch = errors.New("app does not support batched commitments")
+	ErrPoolDesync    = errors.New("commitment pool out of sync with the device")
+)
+
+// HasCommitBatch reports whether the app supports COMMIT_BATCH.
+func (v Version) HasCommitBatch() bool {
+	return v.HasFlags && v.Flags&AppFlagCommitBatch != 0
+}
+
+// ParseCommitBatch parses COMMIT_BATCH response data:
+// count || first_seq (2 bytes, big-endian) || count * (hiding || binding).
+// Pairs are numbered consecutively from first_seq.
+func ParseCommitBatch(data []byte) ([]PooledCommitment, error) {
+	if len(data) < 3 {
+		return nil, fmt.Errorf("COMMIT_BATCH: expected at least 3 bytes, got %d", len(data))
+	}
+	n := int(data[0])
+	if n > MaxCommitBatch {
+		return nil, fmt.Errorf("COMMIT_BATCH: count %d exceeds %d", n, MaxCommitBatch)
+	}
+	if len(data) != 3+n*CommitPairSize {
+		return nil, fmt.Errorf("COMMIT_BATCH: count %d needs %d bytes, got %d", n, 3+n*CommitPairSize, len(data))
+	}
+	seq := binary.BigEndian.Uint16(data[1:3])
+	out := make([]PooledCommitment, n)
+	for i := range out {
+		pair := data[3+i*CommitPairSize : 3+(i+1)*CommitPairSize]
+		out[i] = PooledCommitment{
+			Seq:     seq + uint16(i),
+			Hiding:  hex.EncodeToString(pair[:PointSize]),
+			Binding: hex.EncodeToString(pair[PointSize:]),
+		}
+	}
+	return out, nil
+}
+
+// CommitmentPool tracks the commitments a device holds nonces for, in the
+// order it hands them out. The device pops its oldest pooled pair on each
+// COMMIT, so the host can publish commitments before a session starts and
+// check that COMMIT returns the one it expects. It is JSON-encodable, to
+// keep across runs.
+type CommitmentPool struct {
+	Pending   []PooledCommitment `json:"pending"`
+	NextSeq   uint16             `json:"next_seq"`  // Sequence number of the next pair the device pools
+	Fetched   uint64             `json:"fetched"`   // Pairs received with COMMIT_BATCH
+	Consumed  uint64             `json:"consumed"`  // Pairs used by COMMIT, or skipped
+	Exchanges uint64             `json:"exchanges"` // COMMIT_BATCH round trips
+}
+
+// Len returns the number of pairs left in the pool.
+func (p *CommitmentPool) Len() int {
+	return len(p.Pending)
+}
+
+// Reset empties the pool, e.g. after INJECT_KEYS, which clears the device's.
+func (p *CommitmentPool) Reset() {
+	*p = CommitmentPool{}
+}
+
+// Insert adds a batch to the pool. Its sequence numbers must follow on from
+// the pairs already fetched; a gap means a response was lost and the device
+// holds pairs the host does not know about.
+func (p *CommitmentPool) Insert(batch []PooledCommitment) error {
+	if len(batch) == 0 {
+		return nil
+	}
+	if p.Fetched > 0 && batch[0].Seq != p.NextSeq {
+		return fmt.Errorf("%w: expected pair %d, device sent %d", ErrPoolDesync, p.NextSeq, batch[0].Seq)
+	}
+	p.Pending = append(p.Pending, batch...)
+	p.NextSeq = batch[len(batch)-1].Seq + 1
+	p.Fetched += uint64(len(batch))
+	return nil
+}
+
+// Consume accounts for a COMMIT response (hiding || binding) and returns the
+// pooled pair it used. When the device skipped pairs (another host committed
+// in between) or did not use the pool at all, the stale pairs are dropped and
+// an error wrapping ErrPoolDesync is returned.
+func (p *CommitmentPool) Consume(resp []byte) (PooledCommitment, error) {
+	if len(resp) != CommitPairSize {
+		return PooledCommitment{}, fmt.Errorf("COMMIT: expected %d bytes, got %d", CommitPairSize, len(resp))
+	}
+	hiding, binding := hex.EncodeToString(resp[:PointSize]), hex.EncodeToString(resp[PointSize:])
+	for i, c := range p.Pending {
+		if !strings.EqualFold(c.Hiding, hiding) || !strings.EqualFold(c.Binding, binding) {
+			continue
+		}
+		p.Pending = p.Pending[i+1:]
+		p.Consumed += uint64(i + 1)
+		if i > 0 {
+			return c, fmt.Errorf("%w: device skipped %d pooled pairs", ErrPoolDesync, i)
+		}
+		return c, nil
+	}
+	stale := len(p.Pending)
+	p.Consumed += uint64(stale)
+	p.Pending = nil
+	return PooledCommitment{}, fmt.Errorf("%w: COMMIT did not use a pooled pair; dropped %d (device pool cleared?)", ErrPoolDesync, stale)
+}
+
+// Replenish tops the pool up to target pairs with COMMIT_BATCH, up to
+// MaxCommitBatch per exchange. It stops early when the device pool is full.
+func (p *CommitmentPool) Replenish(t Transport, target int) error {
+	for p.Len() < target {
+		n := min(target-p.Len(), MaxCommitBatch)
+		resp, err := t.Exchange(Command(InsCommitBatch, byte(n), 0, nil))
+		if err != nil {
+			return err
+		}
+		data, sw := SplitResponse(resp)
+		if sw == SwInsNotSupported {
+			return ErrNoCommitBatch
+		}
+		if sw != SwOK {
+			return fmt.Errorf("COMMIT_BATCH: %s", ExplainStatus(sw, InsCommitBatch))
+		}
+		p.Exchanges++
+		batch, err := ParseCommitBatch(data)
+		if err != nil {
+			return err
+		}
+		if len(batch) > n {
+			return fmt.Errorf("COMMIT_BATCH: asked for %d pairs, got %d", n, len(batch))
+		}
+		if err := p.Insert(batch); err != nil {
+			return err
+		}
+		if len(batch) < n {
+			break
+		}
+	}
+	return nil
+}
+
+// Commit sends COMMIT and accounts for the pooled pair it used.
+func (p *CommitmentPool) Commit(t Transport) (PooledCommitment, error) {
+	resp, err := t.Exchange(Command(InsCommit, 0, 0, nil))
+	if err != nil {
+		return PooledCommitment{}, err
+	}
+	data, sw := SplitResponse(resp)
+	if sw != SwOK {
+		return PooledCommitment{}, fmt.Errorf("COMMIT: %s", ExplainStatus(sw, InsCommit))
+	}
+	return p.Consume(data)
+}
+
+// CommitContext is Commit, cancelled when ctx ends (see Cancellable). If
+// the device answered the cancelled COMMIT, the pair it popped is consumed
+// all the same, so it is never published; RESET cleared its nonces.
+func (p *CommitmentPool) CommitContext(ctx context.Context, c *Cancellable) (PooledCommitment, error) {
+	resp, err := c.ExchangeContext(ctx, Command(InsCommit, 0, 0, nil))
+	if err != nil {
+		var ce *CancelledError
+		if errors.As(err, &ce) && ce.Response != nil {
+			if data, sw := SplitResponse(ce.Response); sw == SwOK {
+				p.Consume(data)
+			}
+		}
+		return PooledCommitment{}, err
+	}
+	data, sw := SplitResponse(resp)
+	if sw != SwOK {
+		return PooledCommitment{}, fmt.Errorf("COMMIT: %s", ExplainStatus(sw, InsCommit))
+	}
+	return p.Consume(data)
+}
@@ -0,0 +1,55 @@
+package apdu
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+)
+
+// Counter is the GET_COUNTER response: the number of partial signatures a
+// key slot has produced. The app increments it in NVRAM before releasing each
+// signature and never decreases it, so a value at or below one seen before
+// means the device was cloned, restored or reinstalled.
+type Counter struct {
+	Slot     byte   `json:"slot"`
+	Value    uint64 `json:"counter"`
+	GroupKey string `json:"group_key"` // Group of the keys in the slot
+}
+
+// ErrNoCounter is returned by ReadCounter for apps without signing counters.
+var ErrNoCounter = errors.New("app does not support signing counters")
+
+// HasCounter reports whether the app supports GET_COUNTER.
+func (v Version) HasCounter() bool {
+	return v.HasFlags && v.Flags&AppFlagCounter != 0
+}
+
+// ParseCounter parses GET_COUNTER response data: counter || group key.
+func ParseCounter(slot byte, data []byte) (Counter, error) {
+	if len(data) != CounterSize+PointSize {
+		return Counter{}, fmt.Errorf("GET_COUNTER: expected %d bytes, got %d", CounterSize+PointSize, len(data))
+	}
+	return Counter{
+		Slot:     slot,
+		Value:    uint64(binary.BigEndian.Uint32(data[:CounterSize])),
+		GroupKey: hex.EncodeToString(data[CounterSize:]),
+	}, nil
+}
+
+// ReadCounter reads the signing counter of a key slot over t. The app has a
+// single slot, 0.
+func ReadCounter(t Transport, slot byte) (Counter, error) {
+	resp, err := t.Exchange(Command(InsGetCounter, slot, 0, nil))
+	if err != nil {
+		return Counter{}, err
+	}
+	data, sw := SplitResponse(resp)
+	if sw == SwInsNotSupported {
+		return Counter{}, ErrNoCounter
+	}
+	if sw != SwOK {
+		return Counter{}, fmt.Errorf("GET_COUNTER: %s", ExplainStatus(sw, InsGetCounter))
+	}
+	return ParseCounter(slot, data)
+}
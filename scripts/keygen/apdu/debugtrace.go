@@ -0,0 +1,111 @@
+package apdu
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// GET_DEBUG_TRACE response sizes
+const (
+	DebugSummarySize = 5*ScalarSize + 4                   // P1=0
+	DebugEntrySize   = CommitmentEntrySize + 2*ScalarSize // P1=i
+)
+
+// DebugTrace is what a debug build of the app reports about its last
+// PARTIAL_SIGN with GET_DEBUG_TRACE: the inputs as it received them and
+// every public intermediate, so the host can recompute them one by one. It
+// holds no nonces or shares.
+//
+// P1=0 answers with the summary:
+//
+//	message_hash || R || c || lambda || z || id (2 bytes) || n || flags
+//
+// where flags bit 0 means the challenge was injected, and P1=i (1..n) with
+// commitment list entry i-1 followed by rho_i and D_i + rho_i*E_i.
+type DebugTrace struct {
+	MessageHash       []byte
+	GroupCommitment   []byte // R
+	Challenge         []byte // c
+	Lambda            []byte // lambda of the device's own ID
+	PartialSig        []byte // z
+	ID                uint16 // The device's participant ID
+	ExternalChallenge bool   // c came from INJECT_CHALLENGE
+	Entries           []DebugEntry
+}
+
+// DebugEntry is one commitment list entry of a DebugTrace.
+type DebugEntry struct {
+	ID            []byte // 32-byte identifier
+	Hiding        []byte // D_i
+	Binding       []byte // E_i
+	BindingFactor []byte // rho_i
+	Commitment    []byte // D_i + rho_i*E_i
+}
+
+// ErrNoDebugTrace is returned by ReadDebugTrace for release builds.
+var ErrNoDebugTrace = errors.New("app is not a debug build (no GET_DEBUG_TRACE)")
+
+// HasDebugTrace reports whether the app supports GET_DEBUG_TRACE.
+func (v Version) HasDebugTrace() bool {
+	return v.HasFlags && v.Flags&AppFlagDebugTrace != 0
+}
+
+// ReadDebugTrace reads the trace of the device's last PARTIAL_SIGN over t.
+func ReadDebugTrace(t Transport) (*DebugTrace, error) {
+	data, err := debugTraceExchange(t, 0)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) != DebugSummarySize {
+		return nil, fmt.Errorf("GET_DEBUG_TRACE: expected %d bytes, got %d", DebugSummarySize, len(data))
+	}
+	scalar := func(i int) []byte { return data[i*ScalarSize : (i+1)*ScalarSize] }
+	tail := data[5*ScalarSize:]
+	tr := &DebugTrace{
+		MessageHash:       scalar(0),
+		GroupCommitment:   scalar(1),
+		Challenge:         scalar(2),
+		Lambda:            scalar(3),
+		PartialSig:        scalar(4),
+		ID:                binary.BigEndian.Uint16(tail[0:2]),
+		ExternalChallenge: tail[3]&0x01 != 0,
+	}
+	n := int(tail[2])
+	if n < 1 || n > MaxParticipants {
+		return nil, fmt.Errorf("GET_DEBUG_TRACE: %d participants", n)
+	}
+
+	for i := 1; i <= n; i++ {
+		data, err := debugTraceExchange(t, byte(i))
+		if err != nil {
+			return nil, err
+		}
+		if len(data) != DebugEntrySize {
+			return nil, fmt.Errorf("GET_DEBUG_TRACE %d: expected %d bytes, got %d", i, DebugEntrySize, len(data))
+		}
+		tr.Entries = append(tr.Entries, DebugEntry{
+			ID:            data[0:IdentifierSize],
+			Hiding:        data[IdentifierSize : IdentifierSize+PointSize],
+			Binding:       data[IdentifierSize+PointSize : CommitmentEntrySize],
+			BindingFactor: data[CommitmentEntrySize : CommitmentEntrySize+ScalarSize],
+			Commitment:    data[CommitmentEntrySize+ScalarSize:],
+		})
+	}
+	return tr, nil
+}
+
+func debugTraceExchange(t Transport, p1 byte) ([]byte, error) {
+	resp, err := t.Exchange(Command(InsGetDebugTrace, p1, 0, nil))
+	if err != nil {
+		return nil, err
+	}
+	data, sw := SplitResponse(resp)
+	if sw == SwInsNotSupported {
+		return nil, ErrNoDebugTrace
+	}
+	if sw != SwOK {
+		return nil, fmt.Errorf("GET_DEBUG_TRACE %d: %s", p1, ExplainStatus(sw, InsGetDebugTrace))
+	}
+	return data, nil
+}
@@ -0,0 +1,264 @@
+package apdu
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// insNames maps instruction bytes to the names used in src/handler.h.
+var insNames = map[byte]string{
+	InsGetVersion:          "GET_VERSION",
+	InsGetPublicKey:        "GET_PUBLIC_KEY",
+	InsInjectKeys:          "INJECT_KEYS",
+	InsCommit:              "COMMIT",
+	InsInjectMessage:       "INJECT_MESSAGE",
+	InsInjectCommitmentsP1: "INJECT_COMMITMENTS_P1",
+	InsInjectCommitmentsP2: "INJECT_COMMITMENTS_P2",
+	InsPartialSign:         "PARTIAL_SIGN",
+	InsReset:               "RESET",
+	InsInjectChallenge:     "INJECT_CHALLENGE",
+	InsGetCounter:          "GET_COUNTER",
+	InsCommitBatch:         "COMMIT_BATCH",
+	InsGetDebugTrace:       "GET_DEBUG_TRACE",
+	InsWipeKeys:            "WIPE_KEYS",
+}
+
+// InsName returns the instruction name, or "UNKNOWN".
+func InsName(ins byte) string {
+	if name, ok := insNames[ins]; ok {
+		return name
+	}
+	return "UNKNOWN"
+}
+
+// Field is one interpreted element of an APDU.
+type Field struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`          // Hex, or a decimal number for counts/IDs
+	Note  string `json:"note,omitempty"` // Interpretation or warning
+}
+
+// Decoded is a command APDU broken into header and payload fields.
+type Decoded struct {
+	CLA    byte     `json:"cla"`
+	INS    byte     `json:"ins"`
+	Name   string   `json:"name"`
+	P1     byte     `json:"p1"`
+	P2     byte     `json:"p2"`
+	Lc     int      `json:"lc"`
+	Data   string   `json:"data,omitempty"`
+	Fields []Field  `json:"fields,omitempty"`
+	Issues []string `json:"issues,omitempty"` // Problems the device would reject
+}
+
+// Decode parses a command APDU and interprets its payload per the app's
+// INS table. Malformed input is reported in Issues rather than as an error
+// whenever the header can be read.
+func Decode(command []byte) (*Decoded, error) {
+	if len(command) < 4 {
+		return nil, fmt.Errorf("APDU too short: %d bytes", len(command))
+	}
+
+	d := &Decoded{
+		CLA:  command[0],
+		INS:  command[1],
+		Name: InsName(command[1]),
+		P1:   command[2],
+		P2:   command[3],
+	}
+	if d.CLA != CLA {
+		d.Issues = append(d.Issues, fmt.Sprintf("CLA 0x%02X is not 0x%02X (device returns 6E00)", d.CLA, CLA))
+	}
+
+	var data []byte
+	if len(command) >= 5 {
+		d.Lc = int(command[4])
+		data = command[5:]
+		if len(data) != d.Lc {
+			d.Issues = append(d.Issues, fmt.Sprintf("Lc is %d but %d data bytes follow", d.Lc, len(data)))
+			if len(data) > d.Lc {
+				data = data[:d.Lc]
+			}
+		}
+	}
+	d.Data = hex.EncodeToString(data)
+
+	switch d.INS {
+	case InsInjectKeys:
+		d.Fields = append(d.Fields, Field{Name: "curve_id", Value: fmt.Sprintf("%d", d.P1), Note: curveName(d.P1)})
+		if len(data) < 96 || len(data) > 96+MaxPurposeLen {
+			d.Issues = append(d.Issues, fmt.Sprintf("%s expects 96 data bytes and a purpose tag of up to %d, got %d (device returns 6700)", d.Name, MaxPurposeLen, len(data)))
+			break
+		}
+		d.Fields = append(d.Fields,
+			Field{Name: "group_pubkey", Value: hex.EncodeToString(data[0:32])},
+			idField("participant_id", data[32:64]),
+			Field{Name: "secret_share", Value: hex.EncodeToString(data[64:96]), Note: "SECRET"},
+		)
+		if len(data) > 96 {
+			d.Fields = append(d.Fields, Field{Name: "purpose", Value: string(data[96:]), Note: "bound into every challenge"})
+		}
+
+	case InsInjectMessage:
+		if d.expectLen(data, 32) {
+			d.Fields = append(d.Fields, Field{Name: "message_hash", Value: hex.EncodeToString(data)})
+		}
+
+	case InsInjectChallenge:
+		if d.expectLen(data, 32) {
+			d.Fields = append(d.Fields, Field{Name: "challenge", Value: hex.EncodeToString(data)})
+		}
+
+	case InsInjectCommitmentsP1:
+		n := int(d.P1)
+		d.Fields = append(d.Fields, Field{Name: "num_participants", Value: fmt.Sprintf("%d", n)})
+		if n < 2 || n > MaxParticipants {
+			d.Issues = append(d.Issues, fmt.Sprintf("num_participants %d outside 2..%d (device returns 6A80)", n, MaxParticipants))
+		}
+		total := n * CommitmentEntrySize
+		if len(data) < total {
+			d.Fields = append(d.Fields, Field{
+				Name:  "bytes_in_chunk",
+				Value: fmt.Sprintf("%d", len(data)),
+				Note:  fmt.Sprintf("%d more bytes expected in INJECT_COMMITMENTS_P2", total-len(data)),
+			})
+		}
+		d.Fields = append(d.Fields, commitmentFields(data, 0)...)
+
+	case InsInjectCommitmentsP2:
+		d.Fields = append(d.Fields, Field{
+			Name:  "continuation",
+			Value: fmt.Sprintf("%d", len(data)),
+			Note:  "appended to the list started by INJECT_COMMITMENTS_P1; entry boundaries depend on that chunk",
+		})
+
+	case InsGetCounter:
+		d.Fields = append(d.Fields, Field{Name: "slot", Value: fmt.Sprintf("%d", d.P1)})
+		if len(data) != 0 {
+			d.Issues = append(d.Issues, fmt.Sprintf("%s takes no data, got %d bytes", d.Name, len(data)))
+		}
+
+	case InsCommitBatch:
+		d.Fields = append(d.Fields, Field{Name: "count", Value: fmt.Sprintf("%d", d.P1)})
+		if d.P1 < 1 || int(d.P1) > MaxCommitBatch {
+			d.Issues = append(d.Issues, fmt.Sprintf("count %d outside 1..%d (device returns 6A86)", d.P1, MaxCommitBatch))
+		}
+		if len(data) != 0 {
+			d.Issues = append(d.Issues, fmt.Sprintf("%s takes no data, got %d bytes", d.Name, len(data)))
+		}
+
+	case InsGetDebugTrace:
+		part := "summary"
+		if d.P1 > 0 {
+			part = fmt.Sprintf("commitment list entry %d", d.P1-1)
+		}
+		d.Fields = append(d.Fields, Field{Name: "part", Value: fmt.Sprintf("%d", d.P1), Note: part})
+		if len(data) != 0 {
+			d.Issues = append(d.Issues, fmt.Sprintf("%s takes no data, got %d bytes", d.Name, len(data)))
+		}
+
+	case InsWipeKeys:
+		if d.expectLen(data, PointSize+IdentifierSize) {
+			d.Fields = append(d.Fields,
+				Field{Name: "group_key", Value: hex.EncodeToString(data[:PointSize])},
+				Field{Name: "participant", Value: fmt.Sprintf("%d", uint16(data[PointSize+IdentifierSize-2])<<8|uint16(data[PointSize+IdentifierSize-1])),
+					Note: "the keys the slot must hold; the device refuses to wipe others"})
+		}
+
+	case InsGetVersion, InsGetPublicKey, InsCommit, InsPartialSign, InsReset:
+		if len(data) != 0 {
+			d.Issues = append(d.Issues, fmt.Sprintf("%s takes no data, got %d bytes", d.Name, len(data)))
+		}
+
+	default:
+		d.Issues = append(d.Issues, fmt.Sprintf("INS 0x%02X is not supported (device returns 6D00)", d.INS))
+	}
+
+	return d, nil
+}
+
+func (d *Decoded) expectLen(data []byte, n int) bool {
+	if len(data) != n {
+		d.Issues = append(d.Issues, fmt.Sprintf("%s expects %d data bytes, got %d (device returns 6700)", d.Name, n, len(data)))
+		return false
+	}
+	return true
+}
+
+// commitmentFields decodes whole id || hiding || binding entries in data,
+// numbering them from first.
+func commitmentFields(data []byte, first int) []Field {
+	var fields []Field
+	for i := 0; (i+1)*CommitmentEntrySize <= len(data); i++ {
+		entry := data[i*CommitmentEntrySize : (i+1)*CommitmentEntrySize]
+		prefix := fmt.Sprintf("commitments[%d].", first+i)
+		fields = append(fields,
+			idField(prefix+"id", entry[0:32]),
+			Field{Name: prefix + "hiding", Value: hex.EncodeToString(entry[32:64])},
+			Field{Name: prefix + "binding", Value: hex.EncodeToString(entry[64:96])},
+		)
+	}
+	if rem := len(data) % CommitmentEntrySize; rem != 0 {
+		fields = append(fields, Field{
+			Name:  fmt.Sprintf("commitments[%d].partial", first+len(data)/CommitmentEntrySize),
+			Value: hex.EncodeToString(data[len(data)-rem:]),
+			Note:  fmt.Sprintf("%d of %d bytes", rem, CommitmentEntrySize),
+		})
+	}
+	return fields
+}
+
+// idField shows a 32-byte identifier with the participant number the device
+// reads from its last two bytes.
+func idField(name string, id []byte) Field {
+	f := Field{Name: name, Value: hex.EncodeToString(id)}
+	num := uint16(id[30])<<8 | uint16(id[31])
+	f.Note = fmt.Sprintf("participant %d", num)
+	for _, b := range id[:30] {
+		if b != 0 {
+			f.Note += "; upper bytes non-zero, ignored by the device"
+			break
+		}
+	}
+	if num == 0 {
+		f.Note += "; zero identifier (device returns 6A80)"
+	}
+	return f
+}
+
+func curveName(id byte) string {
+	switch id {
+	case CurveBJJ:
+		return "Baby Jubjub"
+	case CurveEd25519:
+		return "Ed25519"
+	}
+	return "unknown curve"
+}
+
+// String renders the decoded APDU as aligned text.
+func (d *Decoded) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "CLA  %02X\n", d.CLA)
+	fmt.Fprintf(&b, "INS  %02X  %s\n", d.INS, d.Name)
+	fmt.Fprintf(&b, "P1   %02X\n", d.P1)
+	fmt.Fprintf(&b, "P2   %02X\n", d.P2)
+	fmt.Fprintf(&b, "Lc   %02X  (%d bytes)\n", d.Lc, d.Lc)
+
+	width := 0
+	for _, f := range d.Fields {
+		width = max(width, len(f.Name))
+	}
+	for _, f := range d.Fields {
+		fmt.Fprintf(&b, "  %-*s  %s", width, f.Name, f.Value)
+		if f.Note != "" {
+			fmt.Fprintf(&b, "  (%s)", f.Note)
+		}
+		b.WriteByte('\n')
+	}
+	for _, issue := range d.Issues {
+		fmt.Fprintf(&b, "! %s\n", issue)
+	}
+	return b.String()
+}
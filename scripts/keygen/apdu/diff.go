@@ -0,0 +1,179 @@
+package apdu
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"keygen/frostcore"
+)
+
+// Field kinds in a response layout
+const (
+	KindPoint  = "point"
+	KindScalar = "scalar"
+	KindUint16 = "uint16"
+	KindBytes  = "bytes"
+)
+
+type responseField struct {
+	name string
+	kind string
+	size int
+}
+
+// responseLayouts describes the response data of each instruction.
+var responseLayouts = map[byte][]responseField{
+	InsGetVersion:          {{"major", KindBytes, 1}, {"minor", KindBytes, 1}, {"patch", KindBytes, 1}, {"flags", KindBytes, 1}},
+	InsGetPublicKey:        {{"group_pubkey", KindPoint, PointSize}},
+	InsCommit:              {{"hiding_commit", KindPoint, PointSize}, {"binding_commit", KindPoint, PointSize}},
+	InsInjectCommitmentsP1: {{"bytes_received", KindUint16, 2}},
+	InsInjectCommitmentsP2: {{"bytes_received", KindUint16, 2}},
+	InsPartialSign:         {{"partial_sig", KindScalar, ScalarSize}},
+	InsGetCounter:          {{"counter", KindBytes, CounterSize}, {"group_pubkey", KindPoint, PointSize}},
+}
+
+// FieldDiff is one differing response component.
+type FieldDiff struct {
+	Field    string `json:"field"`
+	Kind     string `json:"kind"`
+	Expected string `json:"expected"`
+	Actual   string `json:"actual"`
+	Detail   string `json:"detail,omitempty"` // Interpreted values
+}
+
+// ResponseDiff compares an expected and actual response (data || SW).
+type ResponseDiff struct {
+	INS        byte        `json:"ins"`
+	ExpectedSW uint16      `json:"expected_sw"`
+	ActualSW   uint16      `json:"actual_sw"`
+	Fields     []FieldDiff `json:"fields,omitempty"`
+}
+
+// Equal reports whether the responses matched.
+func (d *ResponseDiff) Equal() bool {
+	return d.ExpectedSW == d.ActualSW && len(d.Fields) == 0
+}
+
+// CompareResponse compares two full responses field by field according to
+// the instruction's response layout.
+func CompareResponse(ins byte, expected, actual []byte) *ResponseDiff {
+	expData, expSW := SplitResponse(expected)
+	actData, actSW := SplitResponse(actual)
+	d := &ResponseDiff{INS: ins, ExpectedSW: expSW, ActualSW: actSW}
+
+	layout := responseLayouts[ins]
+	if len(expData) != layoutSize(layout) || len(actData) != len(expData) {
+		// Unknown or mismatched layout: compare as a whole
+		if !bytes.Equal(expData, actData) {
+			d.Fields = append(d.Fields, FieldDiff{
+				Field:    "data",
+				Kind:     KindBytes,
+				Expected: hex.EncodeToString(expData),
+				Actual:   hex.EncodeToString(actData),
+				Detail:   fmt.Sprintf("length %d vs %d", len(expData), len(actData)),
+			})
+		}
+		return d
+	}
+
+	off := 0
+	for _, f := range layout {
+		exp, act := expData[off:off+f.size], actData[off:off+f.size]
+		off += f.size
+		if bytes.Equal(exp, act) {
+			continue
+		}
+		d.Fields = append(d.Fields, FieldDiff{
+			Field:    f.name,
+			Kind:     f.kind,
+			Expected: hex.EncodeToString(exp),
+			Actual:   hex.EncodeToString(act),
+			Detail:   describeDiff(f.kind, exp, act),
+		})
+	}
+	return d
+}
+
+func layoutSize(layout []responseField) int {
+	n := 0
+	for _, f := range layout {
+		n += f.size
+	}
+	return n
+}
+
+func describeDiff(kind string, exp, act []byte) string {
+	switch kind {
+	case KindScalar:
+		e, a := new(big.Int).SetBytes(exp), new(big.Int).SetBytes(act)
+		delta := new(big.Int).Sub(a, e)
+		delta.Mod(delta, frostcore.Order)
+		s := fmt.Sprintf("expected %s\nactual   %s\nactual - expected (mod r) = %s", e, a, delta)
+		if new(big.Int).SetBytes(act).Cmp(frostcore.Order) >= 0 {
+			s += "\nactual is not reduced mod r"
+		}
+		if rev := reverseBytes(act); bytes.Equal(rev, exp) {
+			s += "\nactual is expected with reversed byte order (endianness mismatch)"
+		}
+		return s
+	case KindPoint:
+		ey, ex := compressedY(exp)
+		ay, ax := compressedY(act)
+		s := fmt.Sprintf("expected y=%s x-sign=%d\nactual   y=%s x-sign=%d", ey, ex, ay, ax)
+		switch {
+		case ey.Cmp(ay) == 0:
+			s += "\nsame y, opposite x: actual is the negation of expected"
+		case bytes.Equal(reverseBytes(act), exp):
+			s += "\nactual is expected with reversed byte order (endianness mismatch)"
+		}
+		return s
+	case KindUint16:
+		return fmt.Sprintf("expected %d, actual %d", int(exp[0])<<8|int(exp[1]), int(act[0])<<8|int(act[1]))
+	}
+	return ""
+}
+
+// compressedY splits a gnark-crypto compressed point into its little-endian
+// y coordinate and the x sign bit (MSB of the last byte).
+func compressedY(p []byte) (*big.Int, int) {
+	le := append([]byte(nil), p...)
+	sign := int(le[len(le)-1] >> 7)
+	le[len(le)-1] &= 0x7F
+	return new(big.Int).SetBytes(reverseBytes(le)), sign
+}
+
+func reverseBytes(b []byte) []byte {
+	out := make([]byte, len(b))
+	for i := range b {
+		out[i] = b[len(b)-1-i]
+	}
+	return out
+}
+
+// String renders the diff for a terminal.
+func (d *ResponseDiff) String() string {
+	if d.Equal() {
+		return fmt.Sprintf("%s: responses match\n", InsName(d.INS))
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s: responses differ\n", InsName(d.INS))
+	if d.ExpectedSW != d.ActualSW {
+		fmt.Fprintf(&b, "  sw: expected %04X (%s), actual %04X (%s)\n",
+			d.ExpectedSW, ExplainStatus(d.ExpectedSW, d.INS).Name,
+			d.ActualSW, ExplainStatus(d.ActualSW, d.INS).Name)
+	}
+	for _, f := range d.Fields {
+		fmt.Fprintf(&b, "  %s (%s)\n", f.Field, f.Kind)
+		fmt.Fprintf(&b, "    - %s\n", f.Expected)
+		fmt.Fprintf(&b, "    + %s\n", f.Actual)
+		for _, line := range strings.Split(f.Detail, "\n") {
+			if line != "" {
+				fmt.Fprintf(&b, "      %s\n", line)
+			}
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,91 @@
+package apdu
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// Logged returns a Transport that logs every exchange through t:
+//
+//   - debug: the command with its decoded fields, and the response data
+//   - info: the instruction, status word and round-trip time
+//   - warn: exchanges that fail in transport
+//
+// Fields Decode marks SECRET (the share in INJECT_KEYS) are logged as
+// "redacted", and the raw command is never logged for INJECT_KEYS, even when
+// it is too malformed to decode.
+func Logged(t Transport, logger *slog.Logger) Transport {
+	return &loggedTransport{Transport: t, log: logger}
+}
+
+type loggedTransport struct {
+	Transport
+	log *slog.Logger
+	seq int
+}
+
+func (t *loggedTransport) Exchange(command []byte) ([]byte, error) {
+	t.seq++
+	ctx := context.Background()
+	attrs := []slog.Attr{slog.Int("seq", t.seq)}
+	if len(command) >= 2 {
+		attrs = append(attrs, slog.String("ins", InsName(command[1])))
+	}
+	if t.log.Enabled(ctx, slog.LevelDebug) {
+		attrs = append(attrs, commandAttrs(command)...)
+	}
+
+	start := time.Now()
+	resp, err := t.Transport.Exchange(command)
+	attrs = append(attrs, slog.Duration("elapsed", time.Since(start)))
+	if err != nil {
+		t.log.LogAttrs(ctx, slog.LevelWarn, "apdu exchange failed", append(attrs, slog.Any("error", err))...)
+		return resp, err
+	}
+
+	data, sw := SplitResponse(resp)
+	attrs = append(attrs, slog.String("sw", fmt.Sprintf("%04X", sw)))
+	if len(command) >= 2 {
+		attrs = append(attrs, slog.String("status", ExplainStatus(sw, command[1]).Name))
+	}
+	if len(data) > 0 {
+		attrs = append(attrs, slog.Int("response_len", len(data)))
+		if t.log.Enabled(ctx, slog.LevelDebug) {
+			attrs = append(attrs, slog.String("response", hex.EncodeToString(data)))
+		}
+	}
+	t.log.LogAttrs(ctx, slog.LevelInfo, "apdu exchange", attrs...)
+	return resp, nil
+}
+
+// commandAttrs describes a command for a debug record.
+func commandAttrs(command []byte) []slog.Attr {
+	d, err := Decode(command)
+	if err != nil {
+		return []slog.Attr{slog.String("apdu", hex.EncodeToString(command))}
+	}
+	secret := d.INS == InsInjectKeys
+	var fields []any
+	for _, f := range d.Fields {
+		if f.Note == "SECRET" {
+			secret = true
+			fields = append(fields, slog.String(f.Name, "redacted"))
+			continue
+		}
+		fields = append(fields, slog.String(f.Name, f.Value))
+	}
+	var attrs []slog.Attr
+	if !secret {
+		attrs = append(attrs, slog.String("apdu", hex.EncodeToString(command)))
+	}
+	if len(fields) > 0 {
+		attrs = append(attrs, slog.Group("fields", fields...))
+	}
+	if len(d.Issues) > 0 {
+		attrs = append(attrs, slog.Any("issues", d.Issues))
+	}
+	return attrs
+}
@@ -0,0 +1,170 @@
+package apdu
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"keygen/schema"
+)
+
+// Profile maps the upstream CLA and instruction bytes to those of a fork of
+// the app. The Go tooling always builds upstream APDUs; a profile rewrites
+// them on the way out (ToWire) and back when reading captured traffic
+// (FromWire).
+//
+// A profile file is JSON. Instructions are keyed by name and may be partial;
+// missing entries keep their upstream value:
+//
+//	{"name": "myfork", "cla": "0xE1", "ins": {"PARTIAL_SIGN": "0x30"}}
+type Profile struct {
+	Name string          `json:"name"`
+	CLA  Byte            `json:"cla"`
+	Ins  map[string]Byte `json:"ins"`
+
+	toWire   map[byte]byte
+	fromWire map[byte]byte
+}
+
+// Byte is a byte that unmarshals from a JSON number or a "0x"-prefixed hex
+// string.
+type Byte byte
+
+func (b *Byte) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		s = string(data)
+	}
+	v, err := strconv.ParseUint(s, 0, 8)
+	if err != nil {
+		return fmt.Errorf("invalid byte %s", data)
+	}
+	*b = Byte(v)
+	return nil
+}
+
+func (b Byte) MarshalJSON() ([]byte, error) {
+	return json.Marshal(fmt.Sprintf("0x%02X", byte(b)))
+}
+
+// DefaultProfile returns the upstream app's CLA and instruction map.
+func DefaultProfile() *Profile {
+	p := &Profile{Name: "default", CLA: CLA, Ins: make(map[string]Byte, len(insNames))}
+	for ins, name := range insNames {
+		p.Ins[name] = Byte(ins)
+	}
+	p.index()
+	return p
+}
+
+// LoadProfile reads a profile file and fills in missing instructions from
+// the default profile.
+func LoadProfile(path string) (*Profile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseProfile(data, path)
+}
+
+// ParseProfile is LoadProfile for a profile already read from name.
+func ParseProfile(data []byte, name string) (*Profile, error) {
+	p := DefaultProfile()
+	override := Profile{CLA: CLA}
+	if err := schema.Unmarshal(data, &override, name); err != nil {
+		return nil, fmt.Errorf("profile %s: %w", name, err)
+	}
+	p.Name, p.CLA = override.Name, override.CLA
+	if p.Name == "" {
+		p.Name = name
+	}
+	for name, ins := range override.Ins {
+		p.Ins[strings.ToUpper(name)] = ins
+	}
+	if err := p.Validate(); err != nil {
+		return nil, fmt.Errorf("profile %s: %w", p.Name, err)
+	}
+	p.index()
+	return p, nil
+}
+
+// Validate checks that every instruction name is known, that no two
+// instructions share a byte, and that no byte is one ISO 7816 reserves.
+func (p *Profile) Validate() error {
+	if p.CLA == 0xFF {
+		return fmt.Errorf("CLA 0xFF is reserved")
+	}
+	names := make(map[string]bool, len(insNames))
+	for _, name := range insNames {
+		names[name] = true
+	}
+	seen := make(map[Byte]string)
+	for name, ins := range p.Ins {
+		if !names[name] {
+			return fmt.Errorf("unknown instruction %q", name)
+		}
+		if hi := ins & 0xF0; hi == 0x60 || hi == 0x90 {
+			return fmt.Errorf("%s: INS 0x%02X is reserved by ISO 7816", name, byte(ins))
+		}
+		if other, ok := seen[ins]; ok {
+			return fmt.Errorf("%s and %s both use INS 0x%02X", other, name, byte(ins))
+		}
+		seen[ins] = name
+	}
+	return nil
+}
+
+func (p *Profile) index() {
+	p.toWire = make(map[byte]byte, len(p.Ins))
+	p.fromWire = make(map[byte]byte, len(p.Ins))
+	for ins, name := range insNames {
+		wire := byte(p.Ins[name])
+		p.toWire[ins] = wire
+		p.fromWire[wire] = ins
+	}
+}
+
+// ToWire rewrites an upstream command APDU for the profile's app. Unknown
+// instructions pass through unchanged.
+func (p *Profile) ToWire(command []byte) []byte {
+	return p.rewrite(command, byte(p.CLA), p.toWire)
+}
+
+// FromWire rewrites a command APDU captured from the profile's app back to
+// upstream values, so Decode and the response helpers can interpret it.
+func (p *Profile) FromWire(command []byte) []byte {
+	if len(command) > 0 && command[0] != byte(p.CLA) {
+		// Leave foreign CLAs for Decode to report
+		return command
+	}
+	return p.rewrite(command, CLA, p.fromWire)
+}
+
+func (p *Profile) rewrite(command []byte, cla byte, ins map[byte]byte) []byte {
+	if len(command) < 2 {
+		return command
+	}
+	out := append([]byte(nil), command...)
+	out[0] = cla
+	if v, ok := ins[out[1]]; ok {
+		out[1] = v
+	}
+	return out
+}
+
+// Wrap returns a Transport that sends upstream commands through t using the
+// profile's CLA and instruction bytes.
+func (p *Profile) Wrap(t Transport) Transport {
+	return &profileTransport{Transport: t, p: p}
+}
+
+type profileTransport struct {
+	Transport
+	p *Profile
+}
+
+func (t *profileTransport) Exchange(command []byte) ([]byte, error) {
+	return t.Transport.Exchange(t.p.ToWire(command))
+}
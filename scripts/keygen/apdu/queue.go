@@ -0,0 +1,210 @@
+package apdu
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// A device runs one signing context at a time: a second session's COMMIT
+// between another's COMMIT and PARTIAL_SIGN replaces the nonces the first
+// is about to sign with. A Queue keeps bursts of sessions from interleaving
+// their APDUs by leasing out a fixed number of slots, 1 for a physical
+// device, one per instance for a farm of softdevices holding the same share.
+// A session holds its lease from its first APDU to its last.
+//
+// Waiting jobs are served round-robin across sessions, so one session
+// queuing many jobs does not starve the others; within a session they are
+// served in order.
+
+// ErrQueueClosed is returned by Acquire once the Queue is closed.
+var ErrQueueClosed = errors.New("device queue closed")
+
+// Queue leases a device's slots to jobs.
+type Queue struct {
+	mu      sync.Mutex
+	free    []int                // Free slots, the next to lease last
+	waiting map[string][]*waiter // By session, oldest first
+	turn    []string             // Sessions with waiters, in round-robin order
+	stats   QueueStats
+	closed  bool
+}
+
+type waiter struct {
+	ready  chan int // Receives the slot granted
+	queued time.Time
+}
+
+// QueueStats are a Queue's queue-depth metrics.
+type QueueStats struct {
+	Slots    int           `json:"slots"`
+	Busy     int           `json:"busy"`      // Slots leased out
+	Waiting  int           `json:"waiting"`   // Jobs waiting for a slot
+	Sessions int           `json:"sessions"`  // Sessions with jobs waiting
+	MaxDepth int           `json:"max_depth"` // Most jobs waiting at once
+	Granted  uint64        `json:"granted"`   // Leases granted
+	Waited   time.Duration `json:"waited"`    // Total time granted jobs waited
+	MaxWait  time.Duration `json:"max_wait"`
+}
+
+// NewQueue returns a Queue with the given number of slots, at least 1.
+func NewQueue(slots int) *Queue {
+	if slots < 1 {
+		slots = 1
+	}
+	q := &Queue{waiting: make(map[string][]*waiter)}
+	for i := slots - 1; i >= 0; i-- {
+		q.free = append(q.free, i)
+	}
+	q.stats.Slots = slots
+	return q
+}
+
+// Lease is a slot held by a job until Release.
+type Lease struct {
+	Slot int // From 0
+	q    *Queue
+	once sync.Once
+}
+
+// Release returns the slot to the queue. It may be called more than once.
+func (l *Lease) Release() {
+	l.once.Do(func() { l.q.release(l.Slot) })
+}
+
+// Acquire waits for a free slot for a job of the given session, or until
+// ctx ends.
+func (q *Queue) Acquire(ctx context.Context, session string) (*Lease, error) {
+	q.mu.Lock()
+	if q.closed {
+		q.mu.Unlock()
+		return nil, ErrQueueClosed
+	}
+	if len(q.free) > 0 && len(q.turn) == 0 {
+		slot := q.take()
+		q.granted(0)
+		q.mu.Unlock()
+		return &Lease{Slot: slot, q: q}, nil
+	}
+	w := &waiter{ready: make(chan int, 1), queued: time.Now()}
+	if len(q.waiting[session]) == 0 {
+		q.turn = append(q.turn, session)
+	}
+	q.waiting[session] = append(q.waiting[session], w)
+	q.stats.Waiting++
+	q.stats.MaxDepth = max(q.stats.MaxDepth, q.stats.Waiting)
+	q.mu.Unlock()
+
+	select {
+	case slot, ok := <-w.ready:
+		if !ok {
+			return nil, ErrQueueClosed
+		}
+		return &Lease{Slot: slot, q: q}, nil
+	case <-ctx.Done():
+		q.mu.Lock()
+		defer q.mu.Unlock()
+		if q.remove(session, w) {
+			return nil, ctx.Err()
+		}
+		// Granted or closed meanwhile
+		if slot, ok := <-w.ready; ok {
+			q.free = append(q.free, slot)
+			q.stats.Busy--
+			q.dispatch()
+		}
+		return nil, ctx.Err()
+	}
+}
+
+// Stats returns the queue's metrics.
+func (q *Queue) Stats() QueueStats {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	s := q.stats
+	s.Sessions = len(q.turn)
+	return s
+}
+
+// Close fails every waiting job and any later Acquire. Leases held are
+// unaffected.
+func (q *Queue) Close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.closed = true
+	for _, ws := range q.waiting {
+		for _, w := range ws {
+			close(w.ready)
+		}
+	}
+	q.waiting, q.turn = make(map[string][]*waiter), nil
+	q.stats.Waiting = 0
+}
+
+func (q *Queue) release(slot int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.free = append(q.free, slot)
+	q.stats.Busy--
+	q.dispatch()
+}
+
+// dispatch grants free slots to waiters, the next session in turn first.
+func (q *Queue) dispatch() {
+	for len(q.free) > 0 && len(q.turn) > 0 {
+		session := q.turn[0]
+		ws := q.waiting[session]
+		w := ws[0]
+		q.turn = q.turn[1:]
+		if len(ws) > 1 {
+			q.waiting[session] = ws[1:]
+			q.turn = append(q.turn, session)
+		} else {
+			delete(q.waiting, session)
+		}
+		q.stats.Waiting--
+		q.granted(time.Since(w.queued))
+		w.ready <- q.take()
+	}
+}
+
+// take leases out a free slot.
+func (q *Queue) take() int {
+	slot := q.free[len(q.free)-1]
+	q.free = q.free[:len(q.free)-1]
+	q.stats.Busy++
+	return slot
+}
+
+func (q *Queue) granted(waited time.Duration) {
+	q.stats.Granted++
+	q.stats.Waited += waited
+	q.stats.MaxWait = max(q.stats.MaxWait, waited)
+}
+
+// remove drops a waiter that gave up, reporting whether it was still
+// waiting.
+func (q *Queue) remove(session string, w *waiter) bool {
+	ws := q.waiting[session]
+	for i, x := range ws {
+		if x != w {
+			continue
+		}
+		ws = append(ws[:i:i], ws[i+1:]...)
+		q.stats.Waiting--
+		if len(ws) > 0 {
+			q.waiting[session] = ws
+			return true
+		}
+		delete(q.waiting, session)
+		for j, s := range q.turn {
+			if s == session {
+				q.turn = append(q.turn[:j:j], q.turn[j+1:]...)
+				break
+			}
+		}
+		return true
+	}
+	return false
+}
@@ -0,0 +1,144 @@
+package apdu
+
+import "fmt"
+
+// StatusInfo explains a status word returned by the device.
+type StatusInfo struct {
+	SW       uint16 `json:"sw"`
+	Name     string `json:"name"`
+	Meaning  string `json:"meaning"`
+	NextStep string `json:"next_step,omitempty"`
+}
+
+func (s StatusInfo) String() string {
+	out := fmt.Sprintf("%04X %s: %s", s.SW, s.Name, s.Meaning)
+	if s.NextStep != "" {
+		out += "\n  -> " + s.NextStep
+	}
+	return out
+}
+
+// statusWords covers the app's status words (src/handler.h) and the common
+// ones raised by the Ledger OS before the app sees the APDU.
+var statusWords = map[uint16]StatusInfo{
+	SwOK: {
+		Name:    "OK",
+		Meaning: "command succeeded",
+	},
+	SwWrongLength: {
+		Name:     "WRONG_LENGTH",
+		Meaning:  "the data length does not match what the instruction expects",
+		NextStep: "check Lc against the payload; INJECT_KEYS takes 96 bytes, INJECT_MESSAGE and INJECT_CHALLENGE take 32",
+	},
+	SwWrongP1P2: {
+		Name:     "WRONG_P1P2",
+		Meaning:  "P1 or P2 is invalid for this instruction",
+		NextStep: "for INJECT_KEYS, P1 must be the curve ID the app was built for (0x00 = BJJ)",
+	},
+	SwConditionsNotSat: {
+		Name:     "CONDITIONS_NOT_SATISFIED",
+		Meaning:  "the app is not in the state this command requires, or the user rejected the prompt",
+		NextStep: "check keys are injected and the sequence is COMMIT -> INJECT_MESSAGE -> INJECT_COMMITMENTS -> PARTIAL_SIGN; send RESET (E01F000000) to start over",
+	},
+	SwInvalidData: {
+		Name:     "INVALID_DATA",
+		Meaning:  "the payload was rejected",
+		NextStep: "participant IDs must be non-zero, the commitment count must be 2..15, and the device's own ID must be in the commitment list",
+	},
+	SwInsNotSupported: {
+		Name:     "INS_NOT_SUPPORTED",
+		Meaning:  "the app does not implement this instruction",
+		NextStep: "check the INS byte and that the right app (and version) is open",
+	},
+	SwClaNotSupported: {
+		Name:     "CLA_NOT_SUPPORTED",
+		Meaning:  "the class byte is not 0xE0",
+		NextStep: "check the CLA byte; if it is correct, the FY app may not be open",
+	},
+	SwInternalError: {
+		Name:     "INTERNAL_ERROR",
+		Meaning:  "the app failed internally (e.g. invalid point in the commitment list)",
+		NextStep: "verify every commitment decodes to a valid curve point; signing state has been reset",
+	},
+	0x5515: {
+		Name:     "DEVICE_LOCKED",
+		Meaning:  "the device is locked",
+		NextStep: "unlock the device with its PIN and open the FY app",
+	},
+	0x6982: {
+		Name:     "SECURITY_STATUS_NOT_SATISFIED",
+		Meaning:  "the OS refused the command",
+		NextStep: "unlock the device and make sure the FY app is open",
+	},
+}
+
+// ExplainStatus interprets a status word. ins is the instruction that
+// produced it and disambiguates 0x6985, which the app uses both for state
+// errors and for user rejection.
+func ExplainStatus(sw uint16, ins byte) StatusInfo {
+	info, ok := statusWords[sw]
+	if !ok {
+		info = StatusInfo{Name: "UNKNOWN", Meaning: "status word not known to this tool"}
+		if sw&0xFF00 == 0x6C00 || sw&0xFF00 == 0x6100 {
+			info.Meaning = "ISO 7816 length/response-available hint, not produced by the FY app"
+		}
+	}
+	info.SW = sw
+
+	if sw == SwConditionsNotSat {
+		switch ins {
+		case InsInjectKeys:
+			info.Name = "USER_REJECTED"
+			info.Meaning = "the user rejected the key injection prompt"
+			info.NextStep = "confirm the group key fingerprint and participant ID with the operator, then retry"
+		case InsPartialSign:
+			info.Meaning = "the user rejected the signing prompt, or commitments were not fully injected"
+			info.NextStep = "a rejection clears the nonces: restart the session from COMMIT"
+		case InsWipeKeys:
+			info.Name = "USER_REJECTED"
+			info.Meaning = "the user rejected the wipe prompt"
+			info.NextStep = "confirm the group key fingerprint and participant ID with the operator, then retry"
+		case InsGetCounter:
+			info.Meaning = "no keys are injected in this slot"
+			info.NextStep = "inject keys with INJECT_KEYS; the counter starts with the first signature"
+		case InsCommitBatch:
+			info.Meaning = "no keys are injected"
+			info.NextStep = "inject keys with INJECT_KEYS; it also empties the nonce pool"
+		case InsGetDebugTrace:
+			info.Meaning = "no PARTIAL_SIGN since the keys were injected"
+			info.NextStep = "run the failing session up to PARTIAL_SIGN, then read the trace"
+		case InsInjectChallenge:
+			info.Meaning = "INJECT_CHALLENGE is not allowed in the current state, no keys are injected, or the keys carry a purpose tag"
+			info.NextStep = "a purpose-tagged share computes every challenge itself; sign without an injected challenge"
+		case InsGetPublicKey, InsCommit, InsInjectMessage, InsInjectCommitmentsP1, InsInjectCommitmentsP2:
+			info.Meaning = fmt.Sprintf("%s is not allowed in the current state (or no keys are injected)", InsName(ins))
+		}
+	}
+	if sw == SwInsNotSupported && ins == InsGetCounter {
+		info.Meaning = "the app predates signing counters"
+		info.NextStep = "check GET_VERSION flags for 0x02 before reading the counter"
+	}
+	if sw == SwInsNotSupported && ins == InsCommitBatch {
+		info.Meaning = "the app predates nonce pools"
+		info.NextStep = "check GET_VERSION flags for 0x04, or fall back to one COMMIT per session"
+	}
+	if sw == SwInsNotSupported && ins == InsGetDebugTrace {
+		info.Meaning = "the app is a release build, without debug traces"
+		info.NextStep = "check GET_VERSION flags for 0x08; build the app in debug mode to diagnose"
+	}
+	if sw == SwInsNotSupported && ins == InsWipeKeys {
+		info.Meaning = "the app predates WIPE_KEYS"
+		info.NextStep = "uninstall the app from the device (or reinstall it) to erase its storage"
+	}
+	if sw == SwInvalidData && ins == InsWipeKeys {
+		info.Meaning = "the slot holds another group's or participant's keys"
+		info.NextStep = "check the device is the participant's; read its group key with GET_PUBLIC_KEY"
+	}
+	if sw == SwWrongP1P2 && ins == InsGetDebugTrace {
+		info.NextStep = "P1 is 0 for the summary, or 1..n for a commitment list entry"
+	}
+	if sw == SwWrongP1P2 && ins == InsCommitBatch {
+		info.NextStep = fmt.Sprintf("P1 is the number of pairs, 1..%d", MaxCommitBatch)
+	}
+	return info
+}
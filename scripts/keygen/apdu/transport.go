@@ -0,0 +1,58 @@
+package apdu
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"time"
+)
+
+// Transport exchanges APDUs with a device. Exchange returns the full
+// response: data || SW.
+type Transport interface {
+	Exchange(command []byte) ([]byte, error)
+	Close() error
+}
+
+// Speculos speaks Speculos' raw APDU TCP protocol (the --apdu-port), which
+// simdevice also serves.
+type Speculos struct {
+	conn net.Conn
+}
+
+// DialSpeculos connects to a Speculos APDU port such as 127.0.0.1:9999.
+func DialSpeculos(addr string, timeout time.Duration) (*Speculos, error) {
+	conn, err := net.DialTimeout("tcp", addr, timeout)
+	if err != nil {
+		return nil, err
+	}
+	return &Speculos{conn: conn}, nil
+}
+
+func (s *Speculos) Exchange(command []byte) ([]byte, error) {
+	msg := binary.BigEndian.AppendUint32(nil, uint32(len(command)))
+	if _, err := s.conn.Write(append(msg, command...)); err != nil {
+		return nil, fmt.Errorf("speculos: send: %w", err)
+	}
+
+	var hdr [4]byte
+	if _, err := io.ReadFull(s.conn, hdr[:]); err != nil {
+		return nil, fmt.Errorf("speculos: receive: %w", err)
+	}
+	// The length excludes the two status word bytes
+	resp := make([]byte, binary.BigEndian.Uint32(hdr[:])+2)
+	if _, err := io.ReadFull(s.conn, resp); err != nil {
+		return nil, fmt.Errorf("speculos: receive: %w", err)
+	}
+	return resp, nil
+}
+
+// SetDeadline bounds all further exchanges, like net.Conn.SetDeadline.
+func (s *Speculos) SetDeadline(t time.Time) error {
+	return s.conn.SetDeadline(t)
+}
+
+func (s *Speculos) Close() error {
+	return s.conn.Close()
+}
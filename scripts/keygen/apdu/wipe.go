@@ -0,0 +1,44 @@
+package apdu
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrNoWipe is returned by WipeKeys for apps without WIPE_KEYS.
+var ErrNoWipe = errors.New("app does not support WIPE_KEYS")
+
+// ErrWipeRejected is returned by WipeKeys when the operator rejects the wipe
+// on the device.
+var ErrWipeRejected = errors.New("WIPE_KEYS rejected on the device")
+
+// WipeKeys erases the key slot of a decommissioned participant over t,
+// after the operator approves it on the device. The command names the keys
+// the slot must hold, group key and participant, and the app refuses to wipe
+// any others. It reports whether there was anything to wipe: an empty slot
+// answers at once, without a prompt.
+func WipeKeys(t Transport, groupKey []byte, participant uint16) (bool, error) {
+	if len(groupKey) != PointSize {
+		return false, fmt.Errorf("WIPE_KEYS: group key of %d bytes", len(groupKey))
+	}
+	id := make([]byte, IdentifierSize)
+	id[IdentifierSize-2], id[IdentifierSize-1] = byte(participant>>8), byte(participant)
+	resp, err := t.Exchange(Command(InsWipeKeys, 0, 0, append(append([]byte(nil), groupKey...), id...)))
+	if err != nil {
+		return false, err
+	}
+	data, sw := SplitResponse(resp)
+	if sw == SwInsNotSupported {
+		return false, ErrNoWipe
+	}
+	if sw == SwUserRejected {
+		return false, ErrWipeRejected
+	}
+	if sw != SwOK {
+		return false, fmt.Errorf("WIPE_KEYS: %s", ExplainStatus(sw, InsWipeKeys))
+	}
+	if len(data) != 1 {
+		return false, fmt.Errorf("WIPE_KEYS: expected 1 byte, got %d", len(data))
+	}
+	return data[0] == 1, nil
+}
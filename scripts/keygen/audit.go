@@ -0,0 +1,259 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"keygen/apdu"
+	"keygen/coordinator"
+	"keygen/transcript"
+	"keygen/workspace"
+)
+
+// ceremonyLog is the transcript of --transcript, or nil.
+var ceremonyLog *transcript.Log
+
+// transcriptPath is set by --transcript and $FY_LEDGER_TRANSCRIPT.
+var transcriptPath string
+
+// Transcript entry kinds
+const (
+	entryCommand     = "command"             // The command line, first for every command
+	entryInput       = "input"               // A command's JSON input
+	entryOutput      = "output"              // A command's JSON output
+	entryAPDU        = "apdu"                // An exchange with a device
+	entryDKGMessage  = "dkg_message"         // A message of a dkg run, as Config.Record has it
+	entryCoordinator = "coordinator_request" // A request to serve's coordinator (coordinator.AuditEvent)
+	entryFailure     = "failure"             // The command failed
+	entryDone        = "done"                // The command finished
+)
+
+// secretKeys are the JSON keys of secret values (secret.Scalar fields),
+// which are recorded as "redacted".
+var secretKeys = map[string]bool{"secret_share": true, "hiding_nonce": true, "binding_nonce": true}
+
+// setupTranscript opens the transcript of --transcript, if any, and records
+// the command line.
+func setupTranscript() {
+	if transcriptPath == "" {
+		return
+	}
+	var err error
+	if ceremonyLog, err = transcript.Open(transcriptPath); err != nil {
+		fail(KindInput, "Error: %v", err)
+	}
+	record(entryCommand, map[string]any{"args": os.Args[1:]})
+}
+
+// record appends an entry to the transcript, with secret values redacted.
+// A ceremony that cannot be recorded does not go on.
+func record(kind string, data any) {
+	if ceremonyLog == nil {
+		return
+	}
+	if _, err := ceremonyLog.Append(kind, redactSecrets(data)); err != nil {
+		log := ceremonyLog
+		ceremonyLog = nil // fail would record again
+		log.Close()
+		fail(KindFailure, "Error recording the transcript: %v", err)
+	}
+}
+
+// redactSecrets returns data as generic JSON with the values of secretKeys
+// replaced, at any depth.
+func redactSecrets(data any) any {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return map[string]string{"error": err.Error()}
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return map[string]string{"error": err.Error()}
+	}
+	return redactValue(v)
+}
+
+func redactValue(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, x := range v {
+			if secretKeys[k] && x != nil {
+				v[k] = "redacted"
+			} else {
+				v[k] = redactValue(x)
+			}
+		}
+	case []any:
+		for i, x := range v {
+			v[i] = redactValue(x)
+		}
+	}
+	return v
+}
+
+// transcriptTransport records every exchange through a device transport.
+// Commands with a field Decode marks SECRET are recorded by their decoded
+// fields only, with the secret redacted.
+type transcriptTransport struct {
+	apdu.Transport
+}
+
+// APDUEntry is the data of an apdu entry.
+type APDUEntry struct {
+	Ins      string            `json:"ins"`
+	Command  string            `json:"command,omitempty"` // Omitted for commands carrying a secret
+	Fields   map[string]string `json:"fields,omitempty"`
+	Response string            `json:"response,omitempty"`
+	SW       string            `json:"sw,omitempty"`
+	Error    string            `json:"error,omitempty"`
+}
+
+func (t transcriptTransport) Exchange(command []byte) ([]byte, error) {
+	e := APDUEntry{}
+	secret := len(command) >= 2 && command[1] == apdu.InsInjectKeys
+	if len(command) >= 2 {
+		e.Ins = apdu.InsName(command[1])
+	}
+	if d, err := apdu.Decode(command); err == nil {
+		e.Fields = map[string]string{}
+		for _, f := range d.Fields {
+			if f.Note == "SECRET" {
+				secret = true
+				e.Fields[f.Name] = "redacted"
+				continue
+			}
+			e.Fields[f.Name] = f.Value
+		}
+	}
+	if !secret {
+		e.Command = hex.EncodeToString(command)
+	}
+	resp, err := t.Transport.Exchange(command)
+	if err != nil {
+		e.Error = err.Error()
+	} else {
+		data, sw := apdu.SplitResponse(resp)
+		e.Response, e.SW = hex.EncodeToString(data), fmt.Sprintf("%04X", sw)
+	}
+	record(entryAPDU, e)
+	return resp, err
+}
+
+// transcriptLines records each JSON line written to it as an entry of a
+// kind, for writers such as dkg.Config.Record.
+type transcriptLines struct {
+	kind string
+	buf  []byte
+}
+
+func (w *transcriptLines) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			return len(p), nil
+		}
+		record(w.kind, json.RawMessage(bytes.Clone(w.buf[:i])))
+		w.buf = w.buf[i+1:]
+	}
+}
+
+// transcriptAudit records coordinator requests (coordinator.Audit).
+type transcriptAudit struct{}
+
+func (transcriptAudit) Record(e coordinator.AuditEvent) error {
+	record(entryCoordinator, e)
+	return nil
+}
+
+// AuditOutput describes a verified transcript.
+type AuditOutput struct {
+	File string `json:"file"`
+	*transcript.Summary
+	Commands []string `json:"commands"` // Each command line, in order
+	Failures int      `json:"failures"` // Commands that failed
+	Valid    bool     `json:"valid"`
+	Error    string   `json:"error,omitempty"`
+}
+
+// runAudit re-verifies a transcript end to end:
+//
+//	audit [-head hash] [-json] [-entries] transcript.jsonl
+//	audit reverify ...    Re-verify every recorded signature (runAuditReverify)
+//
+// It checks every entry's hash and its link to the entry before, and with
+// -head that the last entry is the one recorded at the end of the ceremony,
+// so a truncated transcript is caught too.
+func runAudit(args []string, ws *workspace.Context) {
+	if len(args) > 0 && args[0] == "reverify" {
+		runAuditReverify(args[1:], ws)
+		return
+	}
+	cmd := flag.NewFlagSet("audit", flag.ExitOnError)
+	head := cmd.String("head", "", "Expected hash of the last entry")
+	asJSON := cmd.Bool("json", false, "Print an AuditOutput instead of text")
+	entries := cmd.Bool("entries", false, "List every entry")
+	stdioFlags(cmd)
+	cmd.Parse(args)
+	if cmd.NArg() != 1 {
+		fail(KindUsage, "Usage: keygen audit [-head hash] [-json] [-entries] transcript.jsonl")
+	}
+	path := cmd.Arg(0)
+	f, err := os.Open(path)
+	if err != nil {
+		fail(KindInput, "Error: %v", err)
+	}
+	defer f.Close()
+
+	out := AuditOutput{File: path}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	if *entries && !*asJSON {
+		fmt.Fprintln(w, "SEQ\tTIME\tKIND\tHASH")
+	}
+	out.Summary, err = transcript.Verify(f, func(e *transcript.Entry) {
+		switch e.Kind {
+		case entryCommand:
+			var c struct {
+				Args []string `json:"args"`
+			}
+			json.Unmarshal(e.Data, &c)
+			out.Commands = append(out.Commands, strings.Join(c.Args, " "))
+		case entryFailure:
+			out.Failures++
+		}
+		if *entries && !*asJSON {
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", e.Seq, e.Time.Format(time.RFC3339), e.Kind, e.Hash[:16])
+		}
+	})
+	w.Flush()
+	if err == nil && *head != "" && !strings.EqualFold(*head, out.Head) {
+		err = fmt.Errorf("%w: the last entry is %s, not %s: entries are missing at the end", transcript.ErrBroken, out.Head, *head)
+	}
+	out.Valid = err == nil
+	if err != nil {
+		out.Error = err.Error()
+	}
+
+	if *asJSON {
+		writeJSON(out)
+	} else if out.Summary != nil {
+		fmt.Printf("Entries:  %d, %s to %s\n", out.Entries, out.First.Format(time.RFC3339), out.Last.Format(time.RFC3339))
+		fmt.Printf("Commands: %d, %d failed\n", len(out.Commands), out.Failures)
+		for _, c := range out.Commands {
+			fmt.Printf("  %s\n", c)
+		}
+		fmt.Printf("Head:     %s\n", out.Head)
+	}
+	if err != nil {
+		fail(KindCrypto, "Error: %s: %v", path, err)
+	}
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"math/big"
+	"os"
+	"slices"
+	"strings"
+
+	"keygen/frostcore"
+	"keygen/groupstate"
+	"keygen/transcript"
+	"keygen/workspace"
+)
+
+// reasonUnknownKey is the reason of a signature under a key that is none of
+// the group's known keys.
+const reasonUnknownKey frostcore.Reason = "unknown_group_key"
+
+// ReverifyEntry is one recorded signature, as audit reverify checked it.
+type ReverifyEntry struct {
+	Source      string           `json:"source"`            // Transcript or group-state document
+	Seq         uint64           `json:"seq,omitempty"`     // Transcript entry of the signature
+	Command     string           `json:"command,omitempty"` // Command line that made it
+	Action      string           `json:"action,omitempty"`  // Group-state action it signs, as op#sequence
+	GroupKey    string           `json:"group_key"`
+	MessageHash string           `json:"message_hash"`
+	Purpose     string           `json:"purpose,omitempty"`
+	Valid       bool             `json:"valid"`
+	Reason      frostcore.Reason `json:"reason,omitempty"`
+	Detail      string           `json:"detail,omitempty"`
+}
+
+// ReverifyOutput is the result of audit reverify.
+type ReverifyOutput struct {
+	Keys       []string        `json:"keys"`       // Known group keys
+	Signatures int             `json:"signatures"` // Signatures checked
+	Failed     int             `json:"failed"`     // Of which no longer verify
+	Entries    []ReverifyEntry `json:"entries"`
+	Errors     []string        `json:"errors,omitempty"` // Transcripts whose chain is broken
+	Valid      bool            `json:"valid"`
+}
+
+const reverifyUsage = "Usage: keygen audit reverify [-group-state f]... [-key hex]... [-json] [transcript.jsonl...]"
+
+// runAuditReverify re-runs the verification of every signature recorded in
+// transcripts and in the history of group-state documents:
+//
+//	audit reverify [-group-state f]... [-key hex]... [-json] [transcript.jsonl...]
+//
+// The group's known keys are those of the -group-state documents, the -key
+// flags (e.g. of a group the current one replaced) and the context's. A
+// signature is reported if it no longer verifies under the ciphersuite in
+// use, or if it is under none of the known keys. It is meant to run
+// periodically on long-lived deployments, so that a transcript altered
+// along with its hashes, or a key the group no longer knows, is noticed.
+func runAuditReverify(args []string, ws *workspace.Context) {
+	cmd := flag.NewFlagSet("audit reverify", flag.ExitOnError)
+	var statePaths, keys []string
+	cmd.Func("group-state", "Group-state document of the group, present or past (repeatable; default: the context's)", func(s string) error {
+		statePaths = append(statePaths, s)
+		return nil
+	})
+	cmd.Func("key", "Another known group key, e.g. of a group this one replaced (repeatable)", func(s string) error {
+		if b, err := hex.DecodeString(s); err != nil || len(b) != 32 {
+			return fmt.Errorf("expected 32 bytes of hex")
+		}
+		keys = append(keys, strings.ToLower(s))
+		return nil
+	})
+	asJSON := cmd.Bool("json", false, "Print a ReverifyOutput instead of text")
+	stdioFlags(cmd)
+	cmd.Parse(args)
+	if len(statePaths) == 0 && ws.GroupState != "" {
+		statePaths = []string{ws.GroupState}
+	}
+	if cmd.NArg() == 0 && len(statePaths) == 0 {
+		fail(KindUsage, reverifyUsage)
+	}
+
+	var docs []*groupstate.Document
+	for _, path := range statePaths {
+		doc, err := groupstate.Load(path)
+		if err != nil {
+			fail(KindInput, "Error: %v", err)
+		}
+		docs = append(docs, doc)
+		keys = append(keys, strings.ToLower(doc.GroupKey))
+	}
+	if ws.GroupKey != "" {
+		keys = append(keys, strings.ToLower(ws.GroupKey))
+	}
+	out := ReverifyOutput{}
+	for _, k := range keys {
+		if !slices.Contains(out.Keys, k) {
+			out.Keys = append(out.Keys, k)
+		}
+	}
+	if len(out.Keys) == 0 {
+		fail(KindUsage, "Error: no known group keys; give -group-state or -key")
+	}
+
+	for i, doc := range docs {
+		for _, a := range doc.History {
+			e := ReverifyEntry{
+				Source:      statePaths[i],
+				Action:      fmt.Sprintf("%s#%d", a.Op, a.Sequence),
+				GroupKey:    strings.ToLower(doc.GroupKey),
+				MessageHash: a.MessageHash,
+				Purpose:     doc.Purpose,
+			}
+			if err := doc.VerifyAction(&a); err != nil {
+				e.Reason, e.Detail = frostcore.ChallengeMismatch, err.Error()
+			} else {
+				e.Valid = true
+			}
+			out.add(e)
+		}
+	}
+	for _, path := range cmd.Args() {
+		if err := out.reverifyTranscript(path); err != nil {
+			out.Errors = append(out.Errors, fmt.Sprintf("%s: %v", path, err))
+		}
+	}
+	out.Valid = out.Failed == 0 && len(out.Errors) == 0
+
+	if *asJSON {
+		writeJSON(out)
+	} else {
+		fmt.Printf("Keys:       %d\n", len(out.Keys))
+		fmt.Printf("Signatures: %d, %d no longer verify\n", out.Signatures, out.Failed)
+		for _, e := range out.Entries {
+			if e.Valid {
+				continue
+			}
+			where := e.Action
+			if e.Seq != 0 {
+				where = fmt.Sprintf("entry %d (%s)", e.Seq, e.Command)
+			}
+			fmt.Printf("  %s: %s: %s: %s\n", e.Source, where, e.Reason, e.Detail)
+		}
+		for _, err := range out.Errors {
+			fmt.Printf("  %s\n", err)
+		}
+	}
+	if !out.Valid {
+		fail(KindCrypto, "Error: %d of %d recorded signatures no longer verify, %d transcripts are broken", out.Failed, out.Signatures, len(out.Errors))
+	}
+}
+
+func (out *ReverifyOutput) add(e ReverifyEntry) {
+	if e.Valid && !slices.Contains(out.Keys, e.GroupKey) {
+		e.Valid, e.Reason, e.Detail = false, reasonUnknownKey, "the signature verifies under a key that is none of the group's"
+	}
+	out.Signatures++
+	if !e.Valid {
+		out.Failed++
+	}
+	out.Entries = append(out.Entries, e)
+}
+
+// reverifyTranscript checks the chain of a transcript and verifies the
+// signatures its commands output: each output with R and z that the
+// command reported valid, with the group key, message hash and purpose of
+// the output or, failing that, of the command's input.
+func (out *ReverifyOutput) reverifyTranscript(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	type statement struct {
+		GroupKey      string   `json:"group_key"`
+		MessageHash   string   `json:"message_hash"`
+		MessageFields []string `json:"message_fields"`
+		Purpose       string   `json:"purpose"`
+	}
+	var command string
+	var input statement
+	_, err = transcript.Verify(f, func(e *transcript.Entry) {
+		switch e.Kind {
+		case entryCommand:
+			var c struct {
+				Args []string `json:"args"`
+			}
+			json.Unmarshal(e.Data, &c)
+			command, input = strings.Join(c.Args, " "), statement{}
+		case entryInput:
+			input = statement{}
+			json.Unmarshal(e.Data, &input)
+		case entryOutput:
+			var sig struct {
+				statement
+				R     string `json:"R"`
+				Z     string `json:"z"`
+				Valid *bool  `json:"valid"`
+			}
+			if json.Unmarshal(e.Data, &sig) != nil || sig.R == "" || sig.Z == "" || sig.Valid == nil || !*sig.Valid {
+				return
+			}
+			st := sig.statement
+			if st.GroupKey == "" {
+				st.GroupKey = input.GroupKey
+			}
+			if st.MessageHash == "" {
+				st.MessageHash, st.MessageFields = input.MessageHash, input.MessageFields
+			}
+			if st.Purpose == "" {
+				st.Purpose = input.Purpose
+			}
+			out.add(out.reverify(ReverifyEntry{
+				Source:      path,
+				Seq:         e.Seq,
+				Command:     command,
+				GroupKey:    strings.ToLower(st.GroupKey),
+				MessageHash: strings.ToLower(st.MessageHash),
+				Purpose:     st.Purpose,
+			}, st.MessageFields, sig.R, sig.Z))
+		}
+	})
+	return err
+}
+
+// reverify verifies a signature, trying the other known keys to tell one
+// made for another of the group's keys. A message given by its fields
+// (sign or aggregate -hash poseidon) is hashed first.
+func (out *ReverifyOutput) reverify(e ReverifyEntry, fields []string, r, z string) ReverifyEntry {
+	bad := func(reason frostcore.Reason, format string, args ...any) ReverifyEntry {
+		e.Reason, e.Detail = reason, fmt.Sprintf(format, args...)
+		return e
+	}
+	if e.MessageHash == "" && len(fields) > 0 {
+		elems := make([]*big.Int, len(fields))
+		for i, f := range fields {
+			x, err := parseFieldElement(f)
+			if err != nil {
+				return bad(frostcore.BadMessage, "message_fields[%d]: %v", i, err)
+			}
+			elems[i] = x
+		}
+		digest, err := frostcore.PoseidonMessageHash(elems)
+		if err != nil {
+			return bad(frostcore.BadMessage, "message_fields: %v", err)
+		}
+		e.MessageHash = hex.EncodeToString(digest)
+	}
+	groupKey, err := hex.DecodeString(e.GroupKey)
+	if err != nil {
+		return bad(frostcore.BadGroupKey, "group key: %v", err)
+	}
+	msg, err := hex.DecodeString(e.MessageHash)
+	if err != nil || len(msg) != 32 {
+		return bad(frostcore.BadMessage, "message_hash: expected 32 bytes of hex")
+	}
+	rb, err := hex.DecodeString(r)
+	if err != nil {
+		return bad(frostcore.BadREncoding, "R: %v", err)
+	}
+	zb, err := hex.DecodeString(z)
+	if err != nil {
+		return bad(frostcore.BadZEncoding, "z: %v", err)
+	}
+	var others [][]byte
+	for _, k := range out.Keys {
+		others = append(others, hexBytes(k))
+	}
+	var v *frostcore.Verification
+	if e.Purpose != "" {
+		v = frostcore.ExplainPurpose(e.Purpose, groupKey, msg, rb, zb, others...)
+	} else if v = frostcore.Explain(groupKey, msg, rb, zb, others...); v.Reason == frostcore.WrongChallengeScheme {
+		v = frostcore.ExplainPoseidon(groupKey, msg, rb, zb, others...) // Made with INJECT_CHALLENGE
+	}
+	e.Valid, e.Reason, e.Detail = v.Valid, v.Reason, v.Detail
+	return e
+}
@@ -0,0 +1,62 @@
+// Package beacon provides public randomness sources used to pick which t of
+// n participants take part in a signing session.
+//
+// Seeding the selection from a verifiable beacon (drand) means no single
+// coordinator can bias which members are repeatedly burdened or excluded:
+// the round and label are committed to before the round is published (see
+// Commitment), the round's BLS signature is checked against the chain's
+// public key, and anyone holding the commitment and the round can re-run
+// the selection and check it.
+package beacon
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+)
+
+// Round is a single beacon output as recorded in the selection transcript.
+type Round struct {
+	Source            string `json:"source"`                       // "drand" or "local"
+	URL               string `json:"url,omitempty"`                // Endpoint the round was fetched from
+	ChainHash         string `json:"chain_hash,omitempty"`         // drand chain identifier
+	Round             uint64 `json:"round,omitempty"`              // drand round number
+	Randomness        string `json:"randomness"`                   // 32 bytes, hex
+	Signature         string `json:"signature,omitempty"`          // Beacon signature over the round, hex
+	PreviousSignature string `json:"previous_signature,omitempty"` // Chained schemes sign it with the round, hex
+}
+
+// Bytes returns the decoded randomness.
+func (r *Round) Bytes() ([]byte, error) {
+	b, err := hex.DecodeString(r.Randomness)
+	if err != nil {
+		return nil, fmt.Errorf("beacon randomness: %w", err)
+	}
+	if len(b) != 32 {
+		return nil, fmt.Errorf("beacon randomness: expected 32 bytes, got %d", len(b))
+	}
+	return b, nil
+}
+
+// Beacon is a source of public randomness.
+type Beacon interface {
+	// Name identifies the beacon in transcripts.
+	Name() string
+	// Fetch returns the given round, checked against its chain.
+	Fetch(ctx context.Context, round uint64) (*Round, error)
+}
+
+// Local draws randomness from the host RNG. It is not publicly verifiable and
+// exists for tests and air-gapped setups where no beacon is reachable.
+type Local struct{}
+
+func (Local) Name() string { return "local" }
+
+func (Local) Fetch(ctx context.Context, round uint64) (*Round, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	return &Round{Source: "local", Randomness: hex.EncodeToString(b)}, nil
+}
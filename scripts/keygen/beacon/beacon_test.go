@@ -0,0 +1,161 @@
+package beacon
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// The League of Entropy mainnet and quicknet chains, as their /info serves
+// them.
+var (
+	mainnet = &ChainInfo{
+		PublicKey:   "868f005eb8e6e4ca0a47c8a77ceaa5309a47978a7c71bc5cce96366b5d7a569937c529eeda66c7293784a9402801af31",
+		Period:      30,
+		GenesisTime: 1595431050,
+		GroupHash:   "176f93498eac9ca337150b46d21dd58673ea4e3581185f869672e59fa4cb390a",
+		SchemeID:    SchemeChained,
+		Metadata:    chainMetadata{BeaconID: "default"},
+	}
+	quicknet = &ChainInfo{
+		PublicKey:   "83cf0f2896adee7eb8b5f01fcad3912212c437e0073e911fb90022d3e760183c8c4b450b6a0a6c3ac6a5776a2d1064510d1fec758c921cc22b0e17e63aaf4bcb5ed66304de9cf809bd274ca73bab4af5a6e9c76a4bc09e76eae8991ef5ece45a",
+		Period:      3,
+		GenesisTime: 1692803367,
+		GroupHash:   "f477d5c89f21a17c863a7f937c6a6d15859414d2be09cd448d4279af331c5d3e",
+		SchemeID:    SchemeG1RFC9380,
+		Metadata:    chainMetadata{BeaconID: "quicknet"},
+	}
+)
+
+func TestChainInfoCheck(t *testing.T) {
+	if err := mainnet.Check(DefaultChainHash); err != nil {
+		t.Fatal(err)
+	}
+	if err := quicknet.Check("52db9ba70e0cc0f6eaf7803dd07447a1f5477735fd3f661792ba94600c84e971"); err != nil {
+		t.Fatal(err)
+	}
+	forged := *mainnet
+	forged.PublicKey = quicknet.PublicKey
+	if err := forged.Check(DefaultChainHash); err == nil {
+		t.Fatal("Check accepted another public key")
+	}
+}
+
+// drandRound returns a round of a chain with info's key and scheme, with
+// its randomness derived from the signature.
+func drandRound(t *testing.T, info *ChainInfo, round uint64, sig, prev string) *Round {
+	t.Helper()
+	sum, err := info.Sum()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := hex.DecodeString(sig)
+	rnd := sha256.Sum256(b)
+	return &Round{Source: "drand", ChainHash: hex.EncodeToString(sum), Round: round,
+		Randomness: hex.EncodeToString(rnd[:]), Signature: sig, PreviousSignature: prev}
+}
+
+// Beacons from drand's own scheme tests.
+func TestVerifyDrand(t *testing.T) {
+	mainnetSig := "814778ed1e480406beb43b74af71ce2f0373e0ea1bfdfea8f9ed62c876c20fcbc7f0163860e3da42ed2148756015f4551451898ffe06d384b4d002245025571b6b7a752f7158b40ad92b13b6d703ad31922a617f2c7f6d960b84d56cf1d79eef"
+	mainnetPrev := "8bd96294383b4d1e04e736360bd7a487f9f409f1e7bd800b720656a310d577b3bdb1e1631af6c5782a1d8979c502f395036181eff4058960fc40bb7034cdae1991d3eda518ab204a077d2f7e724974cf87b407e549bd815cf0b8e5a3832f675d"
+	unchained := &ChainInfo{PublicKey: "8200fc249deb0148eb918d6e213980c5d01acd7fc251900d9260136da3b54836ce125172399ddc69c4e3e11429b62c11", Period: 3, SchemeID: SchemeUnchained}
+	onG1 := &ChainInfo{PublicKey: "876f6fa8073736e22f6ff4badaab35c637503718f7a452d178ce69c45d2d8129a54ad2f988ab10c9666f87ab603c59bf013409a5b500555da31720f8eec294d9809b8796f40d5372c71a44ca61226f1eb978310392f98074a608747f77e66c5a", Period: 3, SchemeID: SchemeOnG1}
+	onG1RFC := &ChainInfo{PublicKey: onG1.PublicKey, Period: 3, SchemeID: SchemeG1RFC9380}
+	onG1Sig := "ac7c3ca14bc88bd014260f22dc016b4fe586f9313c3a549c83d195811a99a5d2d4999d4df6daec73ff51fafadd6d5bb5"
+
+	tests := []struct {
+		name  string
+		info  *ChainInfo
+		round func(t *testing.T) *Round
+		ok    bool
+	}{
+		{"mainnet chained", mainnet, func(t *testing.T) *Round { return drandRound(t, mainnet, 2634945, mainnetSig, mainnetPrev) }, true},
+		{"unchained", unchained, func(t *testing.T) *Round {
+			return drandRound(t, unchained, 7601003, "af7eac5897b72401c0f248a26b612c5ef68e0ff830b4d78927988c89b5db3e997bfcdb7c24cb19f549830cd02cb854a1143fd53a1d4e0713ded471260869439060d170a77187eb6371742840e43eccfa225657c4cc2d9619f7c3d680470c9743", "")
+		}, true},
+		{"on G1", onG1, func(t *testing.T) *Round { return drandRound(t, onG1, 3, onG1Sig, "") }, true},
+		{"other round", mainnet, func(t *testing.T) *Round { return drandRound(t, mainnet, 2634946, mainnetSig, mainnetPrev) }, false},
+		{"other previous signature", mainnet, func(t *testing.T) *Round {
+			return drandRound(t, mainnet, 2634945, mainnetSig, mainnetSig)
+		}, false},
+		{"on G1, other round", onG1, func(t *testing.T) *Round { return drandRound(t, onG1, 2, onG1Sig, "") }, false},
+		{"on G1 with the RFC 9380 DST", onG1RFC, func(t *testing.T) *Round { return drandRound(t, onG1RFC, 3, onG1Sig, "") }, false},
+		{"other key", quicknet, func(t *testing.T) *Round { return drandRound(t, quicknet, 3, onG1Sig, "") }, false},
+		{"randomness not from the signature", mainnet, func(t *testing.T) *Round {
+			r := drandRound(t, mainnet, 2634945, mainnetSig, mainnetPrev)
+			r.Randomness = strings.Repeat("00", 32)
+			return r
+		}, false},
+		{"identity signature", unchained, func(t *testing.T) *Round {
+			return drandRound(t, unchained, 7601003, "c0"+strings.Repeat("00", 95), "")
+		}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := VerifyDrand(tt.info, tt.round(t))
+			if tt.ok && err != nil {
+				t.Fatalf("VerifyDrand: %v", err)
+			}
+			if !tt.ok && err == nil {
+				t.Fatal("VerifyDrand accepted the round")
+			}
+		})
+	}
+}
+
+func TestCommitment(t *testing.T) {
+	// Round 2634945 was out at genesis + 2634944 periods
+	out := mainnet.RoundTime(2634945)
+	if got := mainnet.RoundAt(out); got != 2634945 {
+		t.Fatalf("RoundAt(RoundTime(2634945)) = %d", got)
+	}
+	sig := "814778ed1e480406beb43b74af71ce2f0373e0ea1bfdfea8f9ed62c876c20fcbc7f0163860e3da42ed2148756015f4551451898ffe06d384b4d002245025571b6b7a752f7158b40ad92b13b6d703ad31922a617f2c7f6d960b84d56cf1d79eef"
+	prev := "8bd96294383b4d1e04e736360bd7a487f9f409f1e7bd800b720656a310d577b3bdb1e1631af6c5782a1d8979c502f395036181eff4058960fc40bb7034cdae1991d3eda518ab204a077d2f7e724974cf87b407e549bd815cf0b8e5a3832f675d"
+	round := drandRound(t, mainnet, 2634945, sig, prev)
+
+	tests := []struct {
+		name   string
+		now    time.Time // Time of the commitment
+		ahead  uint64
+		edit   func(c *Commitment)
+		want   error // nil: selects
+		commit bool  // Commit itself fails
+	}{
+		{"two rounds ahead", out.Add(-45 * time.Second), 2, nil, nil, false},
+		{"one round ahead", out.Add(-time.Second), 1, nil, nil, false},
+		{"committed as the round came out", out, 1, func(c *Commitment) { c.Round-- }, ErrPublished, false},
+		{"committed after the round", out.Add(time.Minute), 1, func(c *Commitment) { c.Round = 2634945 }, ErrPublished, false},
+		{"zero rounds ahead", out, 0, nil, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := Commit(mainnet, DefaultDrandURL, tt.now, tt.ahead, "session-7", 2, 5)
+			if tt.commit {
+				if err == nil {
+					t.Fatal("Commit accepted the commitment")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.edit != nil {
+				tt.edit(c)
+			}
+			if tt.want == nil && c.Round != 2634945 {
+				t.Fatalf("committed to round %d, want 2634945", c.Round)
+			}
+			signers, err := c.Select(mainnet, round)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("Select: got error %v, want %v", err, tt.want)
+			}
+			if err == nil && len(signers) != 2 {
+				t.Fatalf("Select: got %v, want 2 signers", signers)
+			}
+		})
+	}
+}
@@ -0,0 +1,136 @@
+package beacon
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	bls "github.com/consensys/gnark-crypto/ecc/bls12-381"
+)
+
+// drand schemes. The chained and unchained ones have the public key on G1
+// and sign on G2; the "on-g1" ones swap the groups for shorter signatures.
+const (
+	SchemeChained   = "pedersen-bls-chained"
+	SchemeUnchained = "pedersen-bls-unchained"
+	SchemeOnG1      = "bls-unchained-on-g1"      // Hashes to G1 with the G2 DST, as deployed
+	SchemeG1RFC9380 = "bls-unchained-g1-rfc9380" // quicknet
+)
+
+const (
+	dstG1 = "BLS_SIG_BLS12381G1_XMD:SHA-256_SSWU_RO_NUL_"
+	dstG2 = "BLS_SIG_BLS12381G2_XMD:SHA-256_SSWU_RO_NUL_"
+)
+
+// VerifyDrand checks a drand round against its chain: the BLS signature
+// over the round (and, for chained schemes, the previous signature) under
+// the chain's public key, and that the randomness is sha256(signature).
+func VerifyDrand(info *ChainInfo, r *Round) error {
+	sum, err := info.Sum()
+	if err != nil {
+		return fmt.Errorf("drand chain info: %w", err)
+	}
+	if r.ChainHash != hex.EncodeToString(sum) {
+		return fmt.Errorf("drand round %d is of chain %s, not %x", r.Round, r.ChainHash, sum)
+	}
+	pk, err := hex.DecodeString(info.PublicKey)
+	if err != nil {
+		return fmt.Errorf("drand public key: %w", err)
+	}
+	sig, err := hex.DecodeString(r.Signature)
+	if err != nil {
+		return fmt.Errorf("drand signature: %w", err)
+	}
+
+	h := sha256.New()
+	if info.SchemeID == SchemeChained || info.SchemeID == "" {
+		prev, err := hex.DecodeString(r.PreviousSignature)
+		if err != nil {
+			return fmt.Errorf("drand previous signature: %w", err)
+		}
+		h.Write(prev)
+	}
+	h.Write(binary.BigEndian.AppendUint64(nil, r.Round))
+	msg := h.Sum(nil)
+
+	var ok bool
+	switch info.SchemeID {
+	case SchemeChained, SchemeUnchained, "":
+		ok, err = verifyOnG2(pk, sig, msg)
+	case SchemeOnG1:
+		ok, err = verifyOnG1(pk, sig, msg, dstG2)
+	case SchemeG1RFC9380:
+		ok, err = verifyOnG1(pk, sig, msg, dstG1)
+	default:
+		return fmt.Errorf("drand scheme %q is not supported", info.SchemeID)
+	}
+	if err != nil {
+		return fmt.Errorf("drand round %d: %w", r.Round, err)
+	}
+	if !ok {
+		return fmt.Errorf("drand round %d: signature does not verify under the chain's public key", r.Round)
+	}
+
+	rnd, err := r.Bytes()
+	if err != nil {
+		return err
+	}
+	digest := sha256.Sum256(sig)
+	if !bytes.Equal(digest[:], rnd) {
+		return fmt.Errorf("drand round %d: randomness is not sha256(signature)", r.Round)
+	}
+	return nil
+}
+
+// verifyOnG2 checks e(pk, H(msg)) == e(g1, sig) for a key on G1.
+func verifyOnG2(pkBytes, sigBytes, msg []byte) (bool, error) {
+	var pk bls.G1Affine
+	if _, err := pk.SetBytes(pkBytes); err != nil {
+		return false, fmt.Errorf("public key: %w", err)
+	}
+	if pk.IsInfinity() {
+		return false, errors.New("public key is the identity")
+	}
+	var sig bls.G2Affine
+	if _, err := sig.SetBytes(sigBytes); err != nil {
+		return false, fmt.Errorf("signature: %w", err)
+	}
+	if sig.IsInfinity() {
+		return false, errors.New("signature is the identity")
+	}
+	hm, err := bls.HashToG2(msg, []byte(dstG2))
+	if err != nil {
+		return false, err
+	}
+	_, _, g1, _ := bls.Generators()
+	g1.Neg(&g1)
+	return bls.PairingCheck([]bls.G1Affine{pk, g1}, []bls.G2Affine{hm, sig})
+}
+
+// verifyOnG1 checks e(H(msg), pk) == e(sig, g2) for a key on G2.
+func verifyOnG1(pkBytes, sigBytes, msg []byte, dst string) (bool, error) {
+	var pk bls.G2Affine
+	if _, err := pk.SetBytes(pkBytes); err != nil {
+		return false, fmt.Errorf("public key: %w", err)
+	}
+	if pk.IsInfinity() {
+		return false, errors.New("public key is the identity")
+	}
+	var sig bls.G1Affine
+	if _, err := sig.SetBytes(sigBytes); err != nil {
+		return false, fmt.Errorf("signature: %w", err)
+	}
+	if sig.IsInfinity() {
+		return false, errors.New("signature is the identity")
+	}
+	hm, err := bls.HashToG1(msg, []byte(dst))
+	if err != nil {
+		return false, err
+	}
+	_, _, _, g2 := bls.Generators()
+	g2.Neg(&g2)
+	return bls.PairingCheck([]bls.G1Affine{hm, sig}, []bls.G2Affine{pk, g2})
+}
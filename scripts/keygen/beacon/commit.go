@@ -0,0 +1,99 @@
+package beacon
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ErrPublished is returned for a commitment to a round that was already
+// out when it was made: whoever made it could have seen the randomness.
+var ErrPublished = errors.New("beacon: the committed round was published before the commitment")
+
+// Commitment fixes a selection before its randomness exists: the threshold,
+// the roster, the label and a drand round still in the future. It must be
+// published (recorded in the transcript, anchored with translog or handed
+// to the participants) before the round is due; a coordinator who commits
+// again for the same label is trying for another set, and it shows.
+type Commitment struct {
+	Threshold   int       `json:"threshold"`
+	Total       int       `json:"total"`
+	Label       string    `json:"label"`        // Session label bound into the selection
+	URL         string    `json:"url"`          // drand relay
+	ChainHash   string    `json:"chain_hash"`   // drand chain
+	Round       uint64    `json:"round"`        // Round whose randomness seeds the selection
+	CommittedAt time.Time `json:"committed_at"` // When the commitment was made
+	DueAt       time.Time `json:"due_at"`       // When the round is published
+}
+
+// Commit commits to the round ahead rounds after the latest one at now.
+func Commit(info *ChainInfo, url string, now time.Time, ahead uint64, label string, t, n int) (*Commitment, error) {
+	if label == "" {
+		return nil, errors.New("beacon: a commitment needs a label")
+	}
+	if t < 1 || t > n {
+		return nil, fmt.Errorf("invalid threshold %d of %d", t, n)
+	}
+	if ahead < 1 {
+		return nil, errors.New("beacon: the committed round must be at least 1 round ahead")
+	}
+	sum, err := info.Sum()
+	if err != nil {
+		return nil, fmt.Errorf("drand chain info: %w", err)
+	}
+	round := info.RoundAt(now) + ahead
+	c := &Commitment{
+		Threshold:   t,
+		Total:       n,
+		Label:       label,
+		URL:         url,
+		ChainHash:   fmt.Sprintf("%x", sum),
+		Round:       round,
+		CommittedAt: now.UTC().Truncate(time.Second),
+		DueAt:       info.RoundTime(round),
+	}
+	if err := c.Check(info); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Check checks the commitment against its chain: the round must have been
+// due after the commitment was made.
+func (c *Commitment) Check(info *ChainInfo) error {
+	if c.Label == "" {
+		return errors.New("beacon: the commitment has no label")
+	}
+	if err := info.Check(c.ChainHash); err != nil {
+		return err
+	}
+	if c.Round == 0 {
+		return errors.New("beacon: the commitment has no round")
+	}
+	if due := info.RoundTime(c.Round); !due.After(c.CommittedAt) {
+		return fmt.Errorf("%w: round %d was out at %s, the commitment is of %s", ErrPublished, c.Round,
+			due.Format(time.RFC3339), c.CommittedAt.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// Select checks r against the commitment and the chain and picks the
+// committed number of signers from it.
+func (c *Commitment) Select(info *ChainInfo, r *Round) ([]int, error) {
+	if err := c.Check(info); err != nil {
+		return nil, err
+	}
+	if r.Round != c.Round || !strings.EqualFold(r.ChainHash, c.ChainHash) {
+		return nil, fmt.Errorf("beacon: round %d of chain %s is not the committed round %d of chain %s",
+			r.Round, r.ChainHash, c.Round, c.ChainHash)
+	}
+	if err := VerifyDrand(info, r); err != nil {
+		return nil, err
+	}
+	randomness, err := r.Bytes()
+	if err != nil {
+		return nil, err
+	}
+	return SelectSigners(randomness, c.Label, c.Threshold, c.Total)
+}
@@ -0,0 +1,203 @@
+package beacon
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"keygen/clock"
+)
+
+// DefaultDrandURL is the League of Entropy HTTP relay.
+const DefaultDrandURL = "https://api.drand.sh"
+
+// DefaultChainHash is the League of Entropy mainnet chain
+// (pedersen-bls-chained, a round every 30 seconds).
+const DefaultChainHash = "8990e7a9aaed2ffed73dbd7092123d6f289930540d7651336225dc172e51b2ce"
+
+// Drand fetches rounds from a drand HTTP relay. The relay is not trusted:
+// the chain info must hash to ChainHash, and every round must carry a valid
+// signature under the chain's public key.
+type Drand struct {
+	URL       string // Relay base URL (DefaultDrandURL if empty)
+	ChainHash string // Chain to use (DefaultChainHash if empty)
+	Client    *http.Client
+	Clock     clock.Clock // Tells whether a round is out; nil is clock.Real
+
+	info *ChainInfo
+}
+
+// ChainInfo is a drand chain's public key, scheme and round schedule, as
+// the relay's /info serves it.
+type ChainInfo struct {
+	PublicKey   string        `json:"public_key"`   // hex
+	Period      int64         `json:"period"`       // Seconds between rounds
+	GenesisTime int64         `json:"genesis_time"` // Unix time of round 1
+	Hash        string        `json:"hash"`         // Chain hash, see Sum
+	GroupHash   string        `json:"groupHash"`    // Genesis seed, hex
+	SchemeID    string        `json:"schemeID"`
+	Metadata    chainMetadata `json:"metadata"`
+}
+
+type chainMetadata struct {
+	BeaconID string `json:"beaconID"`
+}
+
+// Sum computes the chain hash from the info, as drand does:
+// SHA-256(period || genesis_time || public_key || genesis_seed [|| beacon_id]),
+// the beacon ID only when it is not the default one.
+func (c *ChainInfo) Sum() ([]byte, error) {
+	pk, err := hex.DecodeString(c.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("public key: %w", err)
+	}
+	seed, err := hex.DecodeString(c.GroupHash)
+	if err != nil {
+		return nil, fmt.Errorf("genesis seed: %w", err)
+	}
+	h := sha256.New()
+	h.Write(binary.BigEndian.AppendUint32(nil, uint32(c.Period)))
+	h.Write(binary.BigEndian.AppendUint64(nil, uint64(c.GenesisTime)))
+	h.Write(pk)
+	h.Write(seed)
+	if id := c.Metadata.BeaconID; id != "" && id != "default" {
+		h.Write([]byte(id))
+	}
+	return h.Sum(nil), nil
+}
+
+// Check checks that the info hashes to chainHash, so its public key is the
+// chain's.
+func (c *ChainInfo) Check(chainHash string) error {
+	sum, err := c.Sum()
+	if err != nil {
+		return fmt.Errorf("drand chain info: %w", err)
+	}
+	if hex.EncodeToString(sum) != strings.ToLower(chainHash) {
+		return fmt.Errorf("drand chain info hashes to %x, not chain %s", sum, chainHash)
+	}
+	if c.Period <= 0 {
+		return fmt.Errorf("drand chain info: period %d", c.Period)
+	}
+	return nil
+}
+
+// RoundAt returns the latest round published at t, 0 before genesis.
+func (c *ChainInfo) RoundAt(t time.Time) uint64 {
+	if t.Unix() < c.GenesisTime {
+		return 0
+	}
+	return uint64((t.Unix()-c.GenesisTime)/c.Period) + 1
+}
+
+// RoundTime returns the time round is published.
+func (c *ChainInfo) RoundTime(round uint64) time.Time {
+	return time.Unix(c.GenesisTime+int64(round-1)*c.Period, 0).UTC()
+}
+
+func (d *Drand) Name() string { return "drand" }
+
+func (d *Drand) chainHash() string {
+	if d.ChainHash == "" {
+		return DefaultChainHash
+	}
+	return strings.ToLower(d.ChainHash)
+}
+
+// Info fetches the chain info and checks it against the chain hash.
+func (d *Drand) Info(ctx context.Context) (*ChainInfo, error) {
+	if d.info != nil {
+		return d.info, nil
+	}
+	var info ChainInfo
+	if err := d.get(ctx, "/info", &info); err != nil {
+		return nil, err
+	}
+	if err := info.Check(d.chainHash()); err != nil {
+		return nil, err
+	}
+	d.info = &info
+	return d.info, nil
+}
+
+type drandResponse struct {
+	Round             uint64 `json:"round"`
+	Randomness        string `json:"randomness"`
+	Signature         string `json:"signature"`
+	PreviousSignature string `json:"previous_signature"`
+}
+
+// ErrNotPublished is returned by Fetch for a round that is not out yet.
+var ErrNotPublished = errors.New("drand: round not published yet")
+
+// Fetch returns the given round after verifying it against the chain.
+func (d *Drand) Fetch(ctx context.Context, round uint64) (*Round, error) {
+	if round == 0 {
+		return nil, errors.New("drand: no round given")
+	}
+	info, err := d.Info(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if clock.Or(d.Clock).Now().Before(info.RoundTime(round)) {
+		return nil, fmt.Errorf("%w: round %d is due at %s", ErrNotPublished, round, info.RoundTime(round).Format(time.RFC3339))
+	}
+
+	var dr drandResponse
+	if err := d.get(ctx, fmt.Sprintf("/public/%d", round), &dr); err != nil {
+		return nil, err
+	}
+	if dr.Round != round {
+		return nil, fmt.Errorf("drand: asked for round %d, got %d", round, dr.Round)
+	}
+	r := &Round{
+		Source:            "drand",
+		URL:               d.URL,
+		ChainHash:         d.chainHash(),
+		Round:             dr.Round,
+		Randomness:        dr.Randomness,
+		Signature:         dr.Signature,
+		PreviousSignature: dr.PreviousSignature,
+	}
+	if err := VerifyDrand(info, r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// get decodes the JSON at path on the chain's endpoint into v.
+func (d *Drand) get(ctx context.Context, path string, v any) error {
+	base := d.URL
+	if base == "" {
+		base = DefaultDrandURL
+	}
+	url := strings.TrimRight(base, "/") + "/" + d.chainHash() + path
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	client := d.Client
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("drand: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("drand: %s returned %s", url, resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("drand: decoding %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package beacon
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"sort"
+)
+
+// selectDomain separates signer selection from any other use of the beacon.
+const selectDomain = "fy-ledger/signer-select/v1"
+
+// SelectSigners deterministically picks t of the participant IDs 1..n from
+// the beacon randomness. label binds the selection to a session so the same
+// round cannot be replayed to pick the same set for an unrelated request.
+// The returned IDs are sorted ascending.
+func SelectSigners(randomness []byte, label string, t, n int) ([]int, error) {
+	if t < 1 || t > n {
+		return nil, fmt.Errorf("invalid threshold %d of %d", t, n)
+	}
+
+	ids := make([]int, n)
+	for i := range ids {
+		ids[i] = i + 1
+	}
+
+	// Partial Fisher-Yates shuffle driven by a SHA-256 counter stream
+	s := newStream(randomness, label)
+	for i := 0; i < t; i++ {
+		j := i + s.uniform(n-i)
+		ids[i], ids[j] = ids[j], ids[i]
+	}
+
+	selected := ids[:t]
+	sort.Ints(selected)
+	return selected, nil
+}
+
+// stream expands the seed as SHA-256(domain || seed || label || counter).
+type stream struct {
+	seed    []byte
+	counter uint64
+	buf     []byte
+}
+
+func newStream(randomness []byte, label string) *stream {
+	seed := make([]byte, 0, len(selectDomain)+len(randomness)+len(label)+8)
+	seed = append(seed, selectDomain...)
+	seed = append(seed, randomness...)
+	seed = binary.BigEndian.AppendUint64(seed, uint64(len(label)))
+	seed = append(seed, label...)
+	return &stream{seed: seed}
+}
+
+func (s *stream) uint32() uint32 {
+	if len(s.buf) < 4 {
+		block := binary.BigEndian.AppendUint64(append([]byte{}, s.seed...), s.counter)
+		s.counter++
+		sum := sha256.Sum256(block)
+		s.buf = sum[:]
+	}
+	v := binary.BigEndian.Uint32(s.buf)
+	s.buf = s.buf[4:]
+	return v
+}
+
+// uniform returns a value in [0, bound) without modulo bias.
+func (s *stream) uniform(bound int) int {
+	b := uint32(bound)
+	limit := ^uint32(0) - ^uint32(0)%b
+	for {
+		v := s.uint32()
+		if v < limit {
+			return int(v % b)
+		}
+	}
+}
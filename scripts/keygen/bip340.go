@@ -0,0 +1,376 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"keygen/bip340"
+	"keygen/schema"
+	"keygen/secret"
+)
+
+// BIP340Share is one participant's share of a secp256k1 group, as
+// participant-<id>.bip340.json.
+type BIP340Share struct {
+	Ciphersuite string         `json:"ciphersuite"`
+	Participant int            `json:"participant"`
+	Threshold   int            `json:"threshold"`
+	Total       int            `json:"total"`
+	GroupKey    string         `json:"group_key"`  // Compressed, 33 bytes
+	XOnlyKey    string         `json:"x_only_key"` // BIP-340 / Taproot output key
+	SecretShare *secret.Scalar `json:"secret_share"`
+	PublicShare string         `json:"public_share"` // Compressed
+}
+
+// BIP340Group is the public output of bip340 keygen.
+type BIP340Group struct {
+	Ciphersuite  string         `json:"ciphersuite"`
+	Threshold    int            `json:"threshold"`
+	Total        int            `json:"total"`
+	GroupKey     string         `json:"group_key"`
+	XOnlyKey     string         `json:"x_only_key"`
+	PublicShares map[int]string `json:"public_shares"`
+	Files        []string       `json:"files"`
+}
+
+// BIP340Commitment is a signer's round-one commitment. The copy bip340
+// commit writes to -nonces also holds the nonces behind it.
+type BIP340Commitment struct {
+	Ciphersuite  string         `json:"ciphersuite"`
+	Participant  int            `json:"participant"`
+	Hiding       string         `json:"hiding"`
+	Binding      string         `json:"binding"`
+	HidingNonce  *secret.Scalar `json:"hiding_nonce,omitempty"`
+	BindingNonce *secret.Scalar `json:"binding_nonce,omitempty"`
+}
+
+// BIP340SignInput is the input of bip340 sign.
+type BIP340SignInput struct {
+	Message     string             `json:"message"` // Hex; BIP-340 signs the message itself, e.g. a sighash
+	GroupKey    string             `json:"group_key"`
+	Commitments []BIP340Commitment `json:"commitments"`
+}
+
+// BIP340Partial is a signer's signature share.
+type BIP340Partial struct {
+	Ciphersuite string `json:"ciphersuite"`
+	Participant int    `json:"participant"`
+	PartialSig  string `json:"partial_sig"`
+}
+
+// BIP340AggregateInput is the input of bip340 aggregate. With public_shares
+// every signature share is checked before summing, so a bad one is named.
+type BIP340AggregateInput struct {
+	Message      string             `json:"message"`
+	GroupKey     string             `json:"group_key"`
+	Commitments  []BIP340Commitment `json:"commitments"`
+	PartialSigs  []BIP340Partial    `json:"partial_sigs"`
+	PublicShares map[int]string     `json:"public_shares,omitempty"`
+}
+
+// BIP340Signature is the output of bip340 aggregate.
+type BIP340Signature struct {
+	Ciphersuite string `json:"ciphersuite"`
+	XOnlyKey    string `json:"x_only_key"`
+	Message     string `json:"message"`
+	Signature   string `json:"signature"` // R.x || z, 64 bytes
+	Valid       bool   `json:"valid"`
+}
+
+// runBIP340 implements the bip340 subcommands: FROST over secp256k1 with
+// BIP-340 signatures, run on the host (see package bip340).
+func runBIP340(args []string) {
+	if len(args) < 1 {
+		fail(KindUsage, "Usage: keygen bip340 <keygen|commit|sign|aggregate|verify> [options]")
+	}
+	schema.Ciphersuite = bip340.SuiteID
+	schema.Adopt = nil
+	cmd := flag.NewFlagSet("bip340 "+args[0], flag.ExitOnError)
+	stdioFlags(cmd)
+	switch args[0] {
+	case "keygen":
+		threshold := cmd.Int("t", 2, "Threshold")
+		total := cmd.Int("n", 3, "Total participants")
+		seed := cmd.String("seed", "", "Hex seed for deterministic keys (test fixtures only)")
+		outDir := cmd.String("out-dir", ".", "Write participant-<id>.bip340.json here")
+		cmd.Parse(args[1:])
+		if cmd.NArg() != 0 {
+			fail(KindUsage, "Usage: keygen bip340 keygen [-t 2] [-n 3] [-seed hex] [-out-dir d]")
+		}
+		bip340Keygen(*threshold, *total, *seed, *outDir)
+	case "commit":
+		sharePath := cmd.String("share", "", "Share file of the signer (required)")
+		noncesPath := cmd.String("nonces", "", "Write the nonces to this new file (required)")
+		cmd.Parse(args[1:])
+		if *sharePath == "" || *noncesPath == "" || cmd.NArg() != 0 {
+			fail(KindUsage, "Usage: keygen bip340 commit -share f -nonces f")
+		}
+		bip340Commit(*sharePath, *noncesPath)
+	case "sign":
+		sharePath := cmd.String("share", "", "Share file of the signer (required)")
+		noncesPath := cmd.String("nonces", "", "Nonces file from bip340 commit, deleted once used (required)")
+		cmd.Parse(args[1:])
+		if *sharePath == "" || *noncesPath == "" || cmd.NArg() != 0 {
+			fail(KindUsage, "Usage: keygen bip340 sign -share f -nonces f < sign-input.json")
+		}
+		bip340Sign(*sharePath, *noncesPath)
+	case "aggregate":
+		cmd.Parse(args[1:])
+		if cmd.NArg() != 0 {
+			fail(KindUsage, "Usage: keygen bip340 aggregate < aggregate-input.json")
+		}
+		bip340Aggregate()
+	case "verify":
+		key := cmd.String("key", "", "x-only public key, hex (required)")
+		message := cmd.String("message", "", "Message, hex")
+		signature := cmd.String("signature", "", "Signature, hex (required)")
+		cmd.Parse(args[1:])
+		if *key == "" || *signature == "" || cmd.NArg() != 0 {
+			fail(KindUsage, "Usage: keygen bip340 verify -key hex -message hex -signature hex")
+		}
+		if !bip340.Verify(decodeHex("-key", *key), decodeHex("-message", *message), decodeHex("-signature", *signature)) {
+			fail(KindCrypto, "Error: the signature does not verify")
+		}
+		fmt.Println("Valid BIP-340 signature")
+	default:
+		fail(KindUsage, "Unknown bip340 command: %s", args[0])
+	}
+}
+
+func bip340Keygen(threshold, total int, seedHex, outDir string) {
+	key, shares, err := bip340.Deal(threshold, total, randomSource(seedHex, "bip340"))
+	if err != nil {
+		fail(KindInput, "Error: %v", err)
+	}
+	group := BIP340Group{
+		Ciphersuite:  bip340.SuiteID,
+		Threshold:    threshold,
+		Total:        total,
+		GroupKey:     hex.EncodeToString(key.Compressed()),
+		XOnlyKey:     hex.EncodeToString(key.XOnly()),
+		PublicShares: make(map[int]string, total),
+	}
+	paths := make([]string, total)
+	for i := range shares {
+		paths[i] = filepath.Join(outDir, fmt.Sprintf("participant-%d.bip340.json", i+1))
+		if _, err := os.Lstat(paths[i]); err == nil {
+			fail(KindInput, "Error: %s already exists", paths[i])
+		}
+	}
+	for i, x := range shares {
+		public := hex.EncodeToString(bip340.BaseMul(x).Compressed())
+		s, err := secret.FromBytes(bip340.ScalarBytes(x))
+		bip340.WipeScalar(x)
+		if err != nil {
+			fail(KindFailure, "Error: %v", err)
+		}
+		share := BIP340Share{
+			Ciphersuite: bip340.SuiteID,
+			Participant: i + 1,
+			Threshold:   threshold,
+			Total:       total,
+			GroupKey:    group.GroupKey,
+			XOnlyKey:    group.XOnlyKey,
+			SecretShare: s,
+			PublicShare: public,
+		}
+		data, err := jsonOutput(share)
+		s.Destroy()
+		if err != nil {
+			fail(KindFailure, "Error encoding share %d: %v", i+1, err)
+		}
+		writeNewFile(paths[i], data, 0600)
+		secret.Wipe(data)
+		group.PublicShares[i+1] = public
+		group.Files = append(group.Files, paths[i])
+	}
+	writeJSON(group)
+}
+
+// loadBIP340Share reads a share file and checks its secret against its
+// public share.
+func loadBIP340Share(path string) (BIP340Share, bip340.Point) {
+	var share BIP340Share
+	readJSONFile(path, &share)
+	if share.SecretShare == nil {
+		fail(KindInput, "Error: %s holds no secret_share", path)
+	}
+	key := parseBIP340Point("group_key", share.GroupKey)
+	x := bip340Scalar(path+": secret_share", share.SecretShare)
+	defer bip340.WipeScalar(x)
+	if x.IsZero() || hex.EncodeToString(bip340.BaseMul(x).Compressed()) != share.PublicShare {
+		fail(KindCrypto, "Error: %s: the secret share does not match its public share", path)
+	}
+	return share, key
+}
+
+// bip340Scalar decodes a secret scalar. The caller wipes it.
+func bip340Scalar(field string, sc *secret.Scalar) *bip340.Scalar {
+	x, err := bip340.ParseScalar(sc.Bytes())
+	if err != nil {
+		fail(KindInput, "Error: %s: %v", field, err)
+	}
+	return x
+}
+
+func parseBIP340Point(field, s string) bip340.Point {
+	p, err := bip340.ParsePoint(decodeHex(field, s))
+	if err != nil {
+		fail(KindInput, "Error: %s: %v", field, err)
+	}
+	return p
+}
+
+func bip340Commit(sharePath, noncesPath string) {
+	share, _ := loadBIP340Share(sharePath)
+	defer share.SecretShare.Destroy()
+	x := bip340Scalar("secret_share", share.SecretShare)
+	defer bip340.WipeScalar(x)
+
+	d, err := bip340.NonceGenerate(rand.Reader, x)
+	if err != nil {
+		fail(KindFailure, "Error generating nonces: %v", err)
+	}
+	e, err := bip340.NonceGenerate(rand.Reader, x)
+	if err != nil {
+		fail(KindFailure, "Error generating nonces: %v", err)
+	}
+	c := BIP340Commitment{
+		Ciphersuite: bip340.SuiteID,
+		Participant: share.Participant,
+		Hiding:      hex.EncodeToString(bip340.BaseMul(d).Compressed()),
+		Binding:     hex.EncodeToString(bip340.BaseMul(e).Compressed()),
+	}
+	withNonces := c
+	if withNonces.HidingNonce, err = secret.FromBytes(bip340.ScalarBytes(d)); err == nil {
+		withNonces.BindingNonce, err = secret.FromBytes(bip340.ScalarBytes(e))
+	}
+	bip340.WipeScalar(d)
+	bip340.WipeScalar(e)
+	defer withNonces.HidingNonce.Destroy()
+	defer withNonces.BindingNonce.Destroy()
+	if err != nil {
+		fail(KindFailure, "Error: %v", err)
+	}
+	data, err := jsonOutput(withNonces)
+	if err != nil {
+		fail(KindFailure, "Error encoding the nonces: %v", err)
+	}
+	writeNewFile(noncesPath, data, 0600)
+	secret.Wipe(data)
+	writeJSON(c)
+}
+
+// bip340Session builds the signing session of an input.
+func bip340Session(input BIP340SignInput) *bip340.Session {
+	key := parseBIP340Point("group_key", input.GroupKey)
+	list := make([]bip340.Commitment, len(input.Commitments))
+	for i, c := range input.Commitments {
+		list[i] = bip340.Commitment{
+			ID:      c.Participant,
+			Hiding:  parseBIP340Point(fmt.Sprintf("commitments[%d].hiding", i), c.Hiding),
+			Binding: parseBIP340Point(fmt.Sprintf("commitments[%d].binding", i), c.Binding),
+		}
+	}
+	s, err := bip340.NewSession(key, decodeHex("message", input.Message), list)
+	if err != nil {
+		fail(KindInput, "Error: %v", err)
+	}
+	return s
+}
+
+func bip340Sign(sharePath, noncesPath string) {
+	var input BIP340SignInput
+	if err := schema.Decode(os.Stdin, &input, stdinName); err != nil {
+		fail(KindInput, "Error reading input: %v", err)
+	}
+	share, key := loadBIP340Share(sharePath)
+	defer share.SecretShare.Destroy()
+	if !key.Equal(parseBIP340Point("group_key", input.GroupKey)) {
+		fail(KindInput, "Error: the input is for another group key than %s", sharePath)
+	}
+	var nonces BIP340Commitment
+	readJSONFile(noncesPath, &nonces)
+	defer nonces.HidingNonce.Destroy()
+	defer nonces.BindingNonce.Destroy()
+	if nonces.HidingNonce == nil || nonces.BindingNonce == nil {
+		fail(KindInput, "Error: %s holds no nonces", noncesPath)
+	}
+	if nonces.Participant != share.Participant {
+		fail(KindInput, "Error: %s holds participant %d's nonces, not participant %d's", noncesPath, nonces.Participant, share.Participant)
+	}
+
+	session := bip340Session(input)
+	x := bip340Scalar("secret_share", share.SecretShare)
+	d := bip340Scalar("hiding_nonce", nonces.HidingNonce)
+	e := bip340Scalar("binding_nonce", nonces.BindingNonce)
+	z, err := session.Sign(share.Participant, x, d, e)
+	bip340.WipeScalar(x)
+	bip340.WipeScalar(d)
+	bip340.WipeScalar(e)
+	if err == nil {
+		// Nonces are single use
+		if rerr := os.Remove(noncesPath); rerr != nil {
+			fmt.Fprintf(os.Stderr, "Warning: could not delete used nonces: %v\n", rerr)
+		}
+	}
+	if err != nil {
+		fail(KindCrypto, "Error computing partial sig: %v", err)
+	}
+	writeJSON(BIP340Partial{
+		Ciphersuite: bip340.SuiteID,
+		Participant: share.Participant,
+		PartialSig:  hex.EncodeToString(bip340.ScalarBytes(z)),
+	})
+}
+
+func bip340Aggregate() {
+	var input BIP340AggregateInput
+	if err := schema.Decode(os.Stdin, &input, stdinName); err != nil {
+		fail(KindInput, "Error reading input: %v", err)
+	}
+	session := bip340Session(BIP340SignInput{input.Message, input.GroupKey, input.Commitments})
+	shares := make(map[int]*bip340.Scalar, len(input.PartialSigs))
+	for i, p := range input.PartialSigs {
+		z, err := bip340.ParseScalar(decodeHex(fmt.Sprintf("partial_sigs[%d]", i), p.PartialSig))
+		if err != nil {
+			fail(KindInput, "Error: partial_sigs[%d]: %v", i, err)
+		}
+		if _, dup := shares[p.Participant]; dup {
+			fail(KindInput, "Error: partial_sigs[%d]: second share from participant %d", i, p.Participant)
+		}
+		shares[p.Participant] = z
+	}
+	if len(input.PublicShares) > 0 {
+		ids := make([]int, 0, len(shares))
+		for id := range shares {
+			ids = append(ids, id)
+		}
+		slices.Sort(ids)
+		for _, id := range ids {
+			public, ok := input.PublicShares[id]
+			if !ok {
+				fail(KindInput, "Error: public_shares: none for participant %d", id)
+			}
+			if !session.VerifyShare(id, parseBIP340Point(fmt.Sprintf("public_shares[%d]", id), public), shares[id]) {
+				fail(KindCrypto, "Error: participant %d's partial sig does not verify", id)
+			}
+		}
+	}
+	sig, err := session.Aggregate(shares)
+	if err != nil {
+		fail(KindCrypto, "Error: %v", err)
+	}
+	writeJSON(BIP340Signature{
+		Ciphersuite: bip340.SuiteID,
+		XOnlyKey:    hex.EncodeToString(session.GroupKey.XOnly()),
+		Message:     input.Message,
+		Signature:   hex.EncodeToString(sig),
+		Valid:       true,
+	})
+}
@@ -0,0 +1,355 @@
+package bip340
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+)
+
+// Scalar is an integer mod N, the order of secp256k1's group. Its
+// arithmetic is constant time, except for inversion, which is only done on
+// public values.
+type Scalar = secp256k1.ModNScalar
+
+// fieldVal is an element of GF(P), in constant time.
+type fieldVal = secp256k1.FieldVal
+
+// Encoded sizes
+const (
+	ScalarSize = 32
+	XOnlySize  = 32 // BIP-340 public keys and R
+	PointSize  = 33 // SEC1 compressed: 02 or 03 || x
+)
+
+// G is the generator.
+var G = Point{x: fieldHex("79BE667EF9DCBBAC55A06295CE870B07029BFCDB2DCE28D959F2815B16F81798"),
+	y: fieldHex("483ADA7726A3C4655DA4FBFC0E1108A8FD17B448A68554199C47D08FFB10D4B8"), ok: true}
+
+var (
+	// b3 is 3*b of y^2 = x^3 + b, b = 7, for the addition formulas.
+	b3 = new(fieldVal).SetInt(21)
+
+	// wideReduce is 2^256 mod N.
+	wideReduce = scalarHex("000000000000000000000000000000014551231950B75FC4402DA1732FC9BEBF")
+)
+
+func fieldHex(h string) fieldVal {
+	b, _ := hex.DecodeString(h)
+	var f fieldVal
+	f.SetByteSlice(b)
+	return f
+}
+
+func scalarHex(h string) *Scalar {
+	b, _ := hex.DecodeString(h)
+	var s Scalar
+	s.SetByteSlice(b)
+	return &s
+}
+
+// Point is an affine point of secp256k1; the zero Point is the point at
+// infinity.
+type Point struct {
+	x, y fieldVal // Normalized
+	ok   bool     // false for the point at infinity
+}
+
+// IsInfinity reports whether p is the point at infinity.
+func (p Point) IsInfinity() bool {
+	return !p.ok
+}
+
+// HasEvenY reports whether p's y coordinate is even, as BIP-340 requires
+// of public keys and R.
+func (p Point) HasEvenY() bool {
+	return p.ok && !p.y.IsOdd()
+}
+
+// Equal reports whether p and q are the same point.
+func (p Point) Equal(q Point) bool {
+	if !p.ok || !q.ok {
+		return p.ok == q.ok
+	}
+	return p.x.Equals(&q.x) && p.y.Equals(&q.y)
+}
+
+// Neg returns -p.
+func (p Point) Neg() Point {
+	if !p.ok {
+		return p
+	}
+	p.y.Negate(1).Normalize()
+	return p
+}
+
+// Add returns p + q.
+func (p Point) Add(q Point) Point {
+	return p.projective().add(q.projective()).affine()
+}
+
+// Mul returns k*p. The sequence of operations does not depend on k, so k
+// may be a secret: a share or a nonce.
+func (p Point) Mul(k *Scalar) Point {
+	base := p.projective()
+	r := identity()
+	kb := k.Bytes()
+	for i := range 256 {
+		bit := int(kb[i/8]>>(7-i%8)) & 1
+		r = r.add(r)
+		r.choose(bit, r.add(base))
+	}
+	clear(kb[:])
+	return r.affine()
+}
+
+// BaseMul returns k*G.
+func BaseMul(k *Scalar) Point {
+	return G.Mul(k)
+}
+
+// projective is a point in projective coordinates (X:Y:Z), x = X/Z and
+// y = Y/Z; the point at infinity is (0:1:0). Every coordinate is kept
+// normalized.
+type projective struct {
+	x, y, z fieldVal
+}
+
+func identity() projective {
+	var r projective
+	r.y.SetInt(1)
+	return r
+}
+
+func (p Point) projective() projective {
+	if !p.ok {
+		return identity()
+	}
+	r := projective{x: p.x, y: p.y}
+	r.z.SetInt(1)
+	return r
+}
+
+func (p projective) affine() Point {
+	if p.z.IsZero() {
+		return Point{}
+	}
+	var zinv fieldVal
+	zinv.Set(&p.z).Inverse()
+	return Point{x: fmul(&p.x, &zinv), y: fmul(&p.y, &zinv), ok: true}
+}
+
+// add is algorithm 7 of Renes, Costello and Batina, "Complete addition
+// formulas for prime order elliptic curves" (2016), for a = 0. It has no
+// exceptional cases, doubling and the point at infinity included, so it
+// does not branch on its inputs.
+func (p projective) add(q projective) projective {
+	t0 := fmul(&p.x, &q.x)
+	t1 := fmul(&p.y, &q.y)
+	t2 := fmul(&p.z, &q.z)
+	t3 := fadd(&p.x, &p.y)
+	t4 := fadd(&q.x, &q.y)
+	t3 = fmul(&t3, &t4)
+	t4 = fadd(&t0, &t1)
+	t3 = fsub(&t3, &t4)
+	t4 = fadd(&p.y, &p.z)
+	x3 := fadd(&q.y, &q.z)
+	t4 = fmul(&t4, &x3)
+	x3 = fadd(&t1, &t2)
+	t4 = fsub(&t4, &x3)
+	x3 = fadd(&p.x, &p.z)
+	y3 := fadd(&q.x, &q.z)
+	x3 = fmul(&x3, &y3)
+	y3 = fadd(&t0, &t2)
+	y3 = fsub(&x3, &y3)
+	x3 = fadd(&t0, &t0)
+	t0 = fadd(&x3, &t0)
+	t2 = fmul(b3, &t2)
+	z3 := fadd(&t1, &t2)
+	t1 = fsub(&t1, &t2)
+	y3 = fmul(b3, &y3)
+	x3 = fmul(&t4, &y3)
+	t2 = fmul(&t3, &t1)
+	x3 = fsub(&t2, &x3)
+	y3 = fmul(&y3, &t0)
+	t1 = fmul(&t1, &z3)
+	y3 = fadd(&t1, &y3)
+	t0 = fmul(&t0, &t3)
+	z3 = fmul(&z3, &t4)
+	z3 = fadd(&z3, &t0)
+	return projective{x3, y3, z3}
+}
+
+// choose sets p to q if bit is 1 and leaves it otherwise, in constant time.
+func (p *projective) choose(bit int, q projective) {
+	for _, c := range [...]struct{ dst, src *fieldVal }{{&p.x, &q.x}, {&p.y, &q.y}, {&p.z, &q.z}} {
+		a, b := c.dst.Bytes(), c.src.Bytes()
+		subtle.ConstantTimeCopy(bit, a[:], b[:])
+		c.dst.SetBytes(a)
+		clear(a[:])
+		clear(b[:])
+	}
+}
+
+func fmul(a, b *fieldVal) fieldVal {
+	var r fieldVal
+	r.Mul2(a, b).Normalize()
+	return r
+}
+
+func fadd(a, b *fieldVal) fieldVal {
+	var r fieldVal
+	r.Add2(a, b).Normalize()
+	return r
+}
+
+func fsub(a, b *fieldVal) fieldVal {
+	var r fieldVal
+	r.NegateVal(b, 1).Add(a).Normalize()
+	return r
+}
+
+// Compressed encodes p as 33 bytes, 02 or 03 by the parity of y followed by
+// x. The point at infinity has no encoding and gives 33 zero bytes.
+func (p Point) Compressed() []byte {
+	out := make([]byte, PointSize)
+	if !p.ok {
+		return out
+	}
+	out[0] = 2
+	if p.y.IsOdd() {
+		out[0] = 3
+	}
+	p.x.PutBytesUnchecked(out[1:])
+	return out
+}
+
+// XOnly encodes p's x coordinate, the BIP-340 form of a public key.
+func (p Point) XOnly() []byte {
+	out := make([]byte, XOnlySize)
+	if p.ok {
+		p.x.PutBytesUnchecked(out)
+	}
+	return out
+}
+
+// ParsePoint decodes a compressed point.
+func ParsePoint(b []byte) (Point, error) {
+	if len(b) != PointSize || (b[0] != 2 && b[0] != 3) {
+		return Point{}, errors.New("secp256k1: expected a 33-byte compressed point")
+	}
+	p, err := LiftX(b[1:])
+	if err != nil {
+		return Point{}, err
+	}
+	if b[0] == 3 {
+		p = p.Neg()
+	}
+	return p, nil
+}
+
+// LiftX returns the point with x coordinate x and an even y, as BIP-340
+// reads public keys.
+func LiftX(x []byte) (Point, error) {
+	if len(x) != XOnlySize {
+		return Point{}, errors.New("secp256k1: expected a 32-byte x coordinate")
+	}
+	var p Point
+	if p.x.SetByteSlice(x) {
+		return Point{}, errors.New("secp256k1: x is not a field element")
+	}
+	if !secp256k1.DecompressY(&p.x, false, &p.y) {
+		return Point{}, errors.New("secp256k1: x is not on the curve")
+	}
+	p.ok = true
+	return p, nil
+}
+
+// ScalarBytes encodes x as 32 big-endian bytes.
+func ScalarBytes(x *Scalar) []byte {
+	out := make([]byte, ScalarSize)
+	x.PutBytesUnchecked(out)
+	return out
+}
+
+// ParseScalar decodes a 32-byte scalar, which must be below N.
+func ParseScalar(b []byte) (*Scalar, error) {
+	if len(b) != ScalarSize {
+		return nil, errors.New("secp256k1: expected a 32-byte scalar")
+	}
+	x := new(Scalar)
+	if x.SetByteSlice(b) {
+		x.Zero()
+		return nil, errors.New("secp256k1: scalar is not reduced mod the group order")
+	}
+	return x, nil
+}
+
+// reduce returns b, big-endian and up to 64 bytes long, mod N.
+func reduce(b []byte) *Scalar {
+	if len(b) > 64 {
+		panic("bip340: reducing more than 512 bits")
+	}
+	split := max(len(b)-ScalarSize, 0)
+	var hi, lo Scalar
+	hi.SetByteSlice(b[:split])
+	lo.SetByteSlice(b[split:])
+	x := new(Scalar).Mul2(&hi, wideReduce).Add(&lo)
+	hi.Zero()
+	lo.Zero()
+	return x
+}
+
+// WipeScalar zeroes x.
+func WipeScalar(x *Scalar) {
+	if x != nil {
+		x.Zero()
+	}
+}
+
+// scalarOf returns the scalar of a participant identifier.
+func scalarOf(id int) *Scalar {
+	return new(Scalar).SetInt(uint32(id))
+}
+
+// TaggedHash is BIP-340's hash_tag(x): SHA256(SHA256(tag) || SHA256(tag) || x).
+func TaggedHash(tag string, parts ...[]byte) []byte {
+	t := sha256.Sum256([]byte(tag))
+	h := sha256.New()
+	h.Write(t[:])
+	h.Write(t[:])
+	for _, p := range parts {
+		h.Write(p)
+	}
+	return h.Sum(nil)
+}
+
+// Verify checks a 64-byte BIP-340 signature R.x || s over msg under the
+// x-only public key, as Bitcoin checks a Taproot key-path spend.
+func Verify(publicKey, msg, sig []byte) bool {
+	if len(sig) != 64 {
+		return false
+	}
+	pk, err := LiftX(publicKey)
+	if err != nil {
+		return false
+	}
+	var r fieldVal
+	if r.SetByteSlice(sig[:32]) {
+		return false
+	}
+	s, err := ParseScalar(sig[32:])
+	if err != nil {
+		return false
+	}
+	e := challenge(sig[:32], publicKey, msg)
+	R := BaseMul(s).Add(pk.Mul(e).Neg())
+	return R.HasEvenY() && R.x.Equals(&r)
+}
+
+// challenge is BIP-340's e = int(hash_BIP0340/challenge(r || P || m)) mod N.
+func challenge(r, publicKey, msg []byte) *Scalar {
+	return reduce(TaggedHash("BIP0340/challenge", r, publicKey, msg))
+}
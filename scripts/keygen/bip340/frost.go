@@ -0,0 +1,279 @@
+// Package bip340 is FROST over secp256k1 with signatures that verify as
+// BIP-340 Schnorr signatures, the form a Bitcoin Taproot key-path spend
+// takes: the group key is x-only, and the signature is R.x || z.
+//
+// It follows FROST(secp256k1, SHA-256) of RFC 9591 with the changes the
+// Taproot ciphersuite draft makes: the challenge is BIP-340's tagged hash
+// of R.x, the x-only group key and the message, and since BIP-340 takes
+// keys and R with an even y, a signer negates its share when the group key
+// has an odd y, and its nonces when R has one. Deal draws keys with an even
+// y to begin with.
+//
+// Field and scalar arithmetic is github.com/decred/dcrd/dcrec/secp256k1's,
+// which is constant time. Its point multiplication is not, so Point.Mul is
+// a fixed double-and-add ladder over complete addition formulas, the same
+// for every scalar: shares and nonces never go through math/big or through
+// a branch on their bits.
+//
+// The package is host-only. Its commitments are 33-byte points, which the
+// app's APDUs (32-byte points, Baby Jubjub) do not carry, so it is not a
+// frostcore ciphersuite; the keygen bip340 commands use it directly.
+package bip340
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+)
+
+// SuiteID is the context string of the ciphersuite, and the "ciphersuite"
+// of every JSON output made with it.
+const SuiteID = "FROST-secp256k1-SHA256-TR-v1"
+
+// expandLen is L of hash_to_field for the 256-bit group order.
+const expandLen = 48
+
+// expandMessageXMD is expand_message_xmd of RFC 9380 with SHA-256.
+func expandMessageXMD(msg, dst []byte, n int) []byte {
+	const blockSize = 64
+	dstPrime := append(bytes.Clone(dst), byte(len(dst)))
+	h := sha256.New()
+	h.Write(make([]byte, blockSize))
+	h.Write(msg)
+	h.Write([]byte{byte(n >> 8), byte(n), 0})
+	h.Write(dstPrime)
+	b0 := h.Sum(nil)
+
+	var out []byte
+	prev := make([]byte, sha256.Size)
+	for i := 1; len(out) < n; i++ {
+		h.Reset()
+		for j := range prev {
+			prev[j] ^= b0[j]
+		}
+		h.Write(prev)
+		h.Write([]byte{byte(i)})
+		h.Write(dstPrime)
+		prev = h.Sum(nil)
+		out = append(out, prev...)
+	}
+	return out[:n]
+}
+
+// hashToScalar is hash_to_field(parts, 1) mod N with DST SuiteID || tag:
+// H1 ("rho") and H3 ("nonce").
+func hashToScalar(tag string, parts ...[]byte) *Scalar {
+	u := expandMessageXMD(bytes.Join(parts, nil), []byte(SuiteID+tag), expandLen)
+	defer clear(u)
+	return reduce(u)
+}
+
+// hash is H4 ("msg") and H5 ("com"): SHA-256(SuiteID || tag || m).
+func hash(tag string, m []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte(SuiteID + tag))
+	h.Write(m)
+	return h.Sum(nil)
+}
+
+// Deal splits a fresh random key t-of-n among participants 1 to n, drawing
+// a key with an even y. It returns the group key and the shares, participant
+// i+1's at i.
+func Deal(t, n int, random io.Reader) (Point, []*Scalar, error) {
+	if t < 1 || t > n || n > 0xFFFF {
+		return Point{}, nil, fmt.Errorf("need 1 <= t <= n, got %d-of-%d", t, n)
+	}
+	coeffs := make([]*Scalar, t)
+	for i := range coeffs {
+		var err error
+		if coeffs[i], err = randomScalar(random); err != nil {
+			return Point{}, nil, err
+		}
+	}
+	key := BaseMul(coeffs[0])
+	if !key.HasEvenY() {
+		coeffs[0].Negate()
+		key = key.Neg()
+	}
+	shares := make([]*Scalar, n)
+	for i := range shares {
+		x := scalarOf(i + 1)
+		y := new(Scalar)
+		for j := t - 1; j >= 0; j-- {
+			y.Mul(x).Add(coeffs[j])
+		}
+		shares[i] = y
+	}
+	for _, c := range coeffs {
+		c.Zero()
+	}
+	return key, shares, nil
+}
+
+// randomScalar draws a non-zero scalar.
+func randomScalar(random io.Reader) (*Scalar, error) {
+	b := make([]byte, expandLen)
+	defer clear(b)
+	for {
+		if _, err := io.ReadFull(random, b); err != nil {
+			return nil, err
+		}
+		if x := reduce(b); !x.IsZero() {
+			return x, nil
+		}
+	}
+}
+
+// NonceGenerate is nonce_generate of RFC 9591: H3(random || secret) with 32
+// fresh random bytes.
+func NonceGenerate(random io.Reader, secret *Scalar) (*Scalar, error) {
+	r := make([]byte, 32)
+	if _, err := io.ReadFull(random, r); err != nil {
+		return nil, err
+	}
+	return hashToScalar("nonce", r, ScalarBytes(secret)), nil
+}
+
+// Commitment is one signer's entry of the commitment list.
+type Commitment struct {
+	ID      int
+	Hiding  Point
+	Binding Point
+}
+
+// Session is the state every party of a signing session computes alike
+// from the group key, the message and the commitment list.
+type Session struct {
+	GroupKey    Point
+	Message     []byte
+	Commitments []Commitment // By ascending ID
+	rhos        map[int]*Scalar
+	r           Point // Before any negation
+	c           *Scalar
+}
+
+// NewSession sorts the commitments, and computes the binding factors, the
+// group commitment R and the challenge.
+func NewSession(groupKey Point, msg []byte, list []Commitment) (*Session, error) {
+	if groupKey.IsInfinity() {
+		return nil, errors.New("group key is the point at infinity")
+	}
+	list = slices.Clone(list)
+	slices.SortFunc(list, func(a, b Commitment) int { return a.ID - b.ID })
+	var enc []byte
+	for i, c := range list {
+		if c.ID < 1 || c.ID > 0xFFFF || (i > 0 && c.ID == list[i-1].ID) {
+			return nil, fmt.Errorf("commitment list: bad or duplicate identifier %d", c.ID)
+		}
+		if c.Hiding.IsInfinity() || c.Binding.IsInfinity() {
+			return nil, fmt.Errorf("participant %d: commitment is the point at infinity", c.ID)
+		}
+		enc = append(enc, ScalarBytes(scalarOf(c.ID))...)
+		enc = append(enc, c.Hiding.Compressed()...)
+		enc = append(enc, c.Binding.Compressed()...)
+	}
+	if len(list) == 0 {
+		return nil, errors.New("commitment list is empty")
+	}
+
+	s := &Session{GroupKey: groupKey, Message: bytes.Clone(msg), Commitments: list, rhos: make(map[int]*Scalar)}
+	prefix := slices.Concat(groupKey.Compressed(), hash("msg", msg), hash("com", enc))
+	for _, c := range list {
+		rho := hashToScalar("rho", prefix, ScalarBytes(scalarOf(c.ID)))
+		s.rhos[c.ID] = rho
+		s.r = s.r.Add(c.Hiding.Add(c.Binding.Mul(rho)))
+	}
+	if s.r.IsInfinity() {
+		return nil, errors.New("group commitment is the point at infinity")
+	}
+	s.c = challenge(s.r.XOnly(), groupKey.XOnly(), msg)
+	return s, nil
+}
+
+// lagrange is participant id's coefficient for interpolating at 0 over the
+// session's signers. The identifiers are public, so the variable-time
+// inversion is fine.
+func (s *Session) lagrange(id int) *Scalar {
+	num, den := scalarOf(1), scalarOf(1)
+	for _, c := range s.Commitments {
+		if c.ID == id {
+			continue
+		}
+		num.Mul(scalarOf(c.ID))
+		den.Mul(new(Scalar).NegateVal(scalarOf(id)).Add(scalarOf(c.ID)))
+	}
+	return num.Mul(den.InverseNonConst())
+}
+
+func (s *Session) commitment(id int) (Commitment, bool) {
+	i := slices.IndexFunc(s.Commitments, func(c Commitment) bool { return c.ID == id })
+	if i < 0 {
+		return Commitment{}, false
+	}
+	return s.Commitments[i], true
+}
+
+// Sign computes participant id's signature share from its share and the
+// nonces behind its commitment.
+func (s *Session) Sign(id int, share, hiding, binding *Scalar) (*Scalar, error) {
+	c, ok := s.commitment(id)
+	if !ok {
+		return nil, fmt.Errorf("participant %d is not in the commitment list", id)
+	}
+	if !BaseMul(hiding).Equal(c.Hiding) || !BaseMul(binding).Equal(c.Binding) {
+		return nil, fmt.Errorf("the commitment list carries a different commitment for participant %d", id)
+	}
+	d, e, x := new(Scalar).Set(hiding), new(Scalar).Set(binding), new(Scalar).Set(share)
+	if !s.r.HasEvenY() {
+		d.Negate()
+		e.Negate()
+	}
+	if !s.GroupKey.HasEvenY() {
+		x.Negate()
+	}
+	// z = d + e*rho + lambda*x*c
+	z := e.Mul(s.rhos[id]).Add(d)
+	z.Add(x.Mul(s.lagrange(id)).Mul(s.c))
+	d.Zero()
+	x.Zero()
+	return z, nil
+}
+
+// VerifyShare checks participant id's signature share against its public
+// share: z*G == ±(D + rho*E) + c*lambda*(±Y_i), the signs as Sign took them.
+func (s *Session) VerifyShare(id int, publicShare Point, z *Scalar) bool {
+	c, ok := s.commitment(id)
+	if !ok {
+		return false
+	}
+	r := c.Hiding.Add(c.Binding.Mul(s.rhos[id]))
+	if !s.r.HasEvenY() {
+		r = r.Neg()
+	}
+	if !s.GroupKey.HasEvenY() {
+		publicShare = publicShare.Neg()
+	}
+	lc := s.lagrange(id).Mul(s.c)
+	return BaseMul(z).Equal(r.Add(publicShare.Mul(lc)))
+}
+
+// Aggregate sums the signature shares, one per signer, into the BIP-340
+// signature R.x || z, and checks it with Verify.
+func (s *Session) Aggregate(shares map[int]*Scalar) ([]byte, error) {
+	z := new(Scalar)
+	for _, c := range s.Commitments {
+		zi, ok := shares[c.ID]
+		if !ok {
+			return nil, fmt.Errorf("no signature share from participant %d", c.ID)
+		}
+		z.Add(zi)
+	}
+	sig := slices.Concat(s.r.XOnly(), ScalarBytes(z))
+	if !Verify(s.GroupKey.XOnly(), s.Message, sig) {
+		return nil, errors.New("the aggregate signature does not verify")
+	}
+	return sig, nil
+}
@@ -0,0 +1,369 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"keygen/evm"
+	"keygen/frostcore"
+	"keygen/schema"
+)
+
+// Calldata encodings of a signature for an on-chain verifier
+const (
+	EncodingAffine     = "affine"     // verify(Ax, Ay, R8x, R8y, S, M): circomlib's A = Y/8 and R in affine form
+	EncodingCompressed = "compressed" // verify(Y, R, S, M): 32-byte compressed points, decompressed on chain
+	EncodingGroth16    = "groth16"    // verifyProof(a, b, c, input): a snarkjs proof of the Circom harness
+)
+
+var calldataEncodings = []string{EncodingAffine, EncodingCompressed, EncodingGroth16}
+
+// Groth16Proof is a snarkjs proof.json.
+type Groth16Proof struct {
+	A        []string   `json:"pi_a"`
+	B        [][]string `json:"pi_b"`
+	C        []string   `json:"pi_c"`
+	Protocol string     `json:"protocol"`
+	Curve    string     `json:"curve"`
+}
+
+// CalldataOption is one encoding of the call and what it costs.
+type CalldataOption struct {
+	Encoding     string `json:"encoding"`
+	Function     string `json:"function"`
+	Selector     string `json:"selector"`
+	Calldata     string `json:"calldata"`
+	Size         int    `json:"size"`
+	ZeroBytes    int    `json:"zero_bytes"`
+	CalldataGas  uint64 `json:"calldata_gas"`
+	IntrinsicGas uint64 `json:"intrinsic_gas"`            // 21000 + calldata
+	MinVerifyGas uint64 `json:"min_verify_gas,omitempty"` // Precompile gas the verifier cannot avoid (groth16)
+	EstimatedGas uint64 `json:"estimated_gas,omitempty"`  // eth_estimateGas against the verifier
+	Accepted     *bool  `json:"accepted,omitempty"`       // What the verifier returned to eth_call
+	CostWei      string `json:"cost_wei,omitempty"`
+	Error        string `json:"error,omitempty"`
+}
+
+// expectedGas is the estimate if there is one, otherwise the lower bound
+// known offline.
+func (o *CalldataOption) expectedGas() uint64 {
+	if o.EstimatedGas > 0 {
+		return o.EstimatedGas
+	}
+	return o.IntrinsicGas + o.MinVerifyGas
+}
+
+// CalldataReport is the output of export calldata.
+type CalldataReport struct {
+	ChainID    uint64           `json:"chain_id,omitempty"`
+	Verifier   string           `json:"verifier,omitempty"`
+	GasPrice   string           `json:"gas_price_wei,omitempty"`
+	Options    []CalldataOption `json:"options"`
+	Cheapest   string           `json:"cheapest,omitempty"`
+	CheapestBy string           `json:"cheapest_by,omitempty"` // "estimate", or "lower_bound" without an RPC endpoint
+}
+
+// calldataConfig holds the export calldata flags.
+type calldataConfig struct {
+	encodings  []string
+	function   string
+	proofPath  string
+	publicPath string
+	rpc        string
+	to         string
+	from       string
+	gasPrice   string
+	timeout    time.Duration
+	asJSON     bool
+}
+
+// runExportCalldata encodes the signature on stdin for each requested
+// verifier encoding and reports its size and gas, estimated against the
+// verifier contract when an RPC endpoint is given.
+func runExportCalldata(cfg calldataConfig) {
+	// The signature is only needed for the direct encodings
+	var input CircomHarnessInput
+	if len(cfg.encodings) > 1 || cfg.encodings[0] != EncodingGroth16 {
+		if err := schema.Decode(os.Stdin, &input, stdinName); err != nil {
+			fail(KindInput, "Error reading input: %v", err)
+		}
+	}
+
+	report := &CalldataReport{Verifier: cfg.to}
+	for _, enc := range cfg.encodings {
+		sig, args, err := calldataArgs(enc, cfg, &input)
+		if err != nil {
+			fail(KindInput, "Error: %s: %v", enc, err)
+		}
+		data, err := evm.EncodeCall(sig, args...)
+		if err != nil {
+			fail(KindInput, "Error: %s: %v", enc, err)
+		}
+		gas, zeros := evm.CalldataGas(data)
+		o := CalldataOption{
+			Encoding:     enc,
+			Function:     sig,
+			Selector:     evm.Hex(data[:4]),
+			Calldata:     evm.Hex(data),
+			Size:         len(data),
+			ZeroBytes:    zeros,
+			CalldataGas:  gas,
+			IntrinsicGas: evm.TxGas + gas,
+		}
+		if enc == EncodingGroth16 {
+			o.MinVerifyGas = evm.Groth16VerifyGas(len(args) - 8)
+		}
+		report.Options = append(report.Options, o)
+	}
+
+	var price *big.Int
+	if cfg.gasPrice != "" {
+		p, err := evm.ParseGwei(cfg.gasPrice)
+		if err != nil {
+			fail(KindInput, "Error: -gas-price: %v", err)
+		}
+		price = p
+	}
+	if cfg.rpc != "" {
+		price = estimateCalldata(cfg, report, price)
+	}
+	if price != nil {
+		report.GasPrice = price.String()
+		for i := range report.Options {
+			o := &report.Options[i]
+			o.CostWei = new(big.Int).Mul(price, new(big.Int).SetUint64(o.expectedGas())).String()
+		}
+	}
+	pickCheapest(report)
+
+	if cfg.asJSON {
+		writeJSON(report)
+		return
+	}
+	printCalldataReport(report)
+}
+
+// calldataArgs returns the function signature and arguments of an encoding.
+func calldataArgs(enc string, cfg calldataConfig, input *CircomHarnessInput) (string, []*big.Int, error) {
+	if enc == EncodingGroth16 {
+		return groth16Args(cfg.proofPath, cfg.publicPath)
+	}
+	groupKey, err := hex.DecodeString(input.GroupKey)
+	if err != nil || len(groupKey) != frostcore.PointSize {
+		return "", nil, fmt.Errorf("group_key: expected %d bytes of hex", frostcore.PointSize)
+	}
+	msg, err := hex.DecodeString(input.MessageHash)
+	if err != nil || len(msg) != 32 {
+		return "", nil, fmt.Errorf("message_hash: expected 32 bytes of hex")
+	}
+	r, err := hex.DecodeString(input.R)
+	if err != nil || len(r) != frostcore.PointSize {
+		return "", nil, fmt.Errorf("R: expected %d bytes of hex", frostcore.PointSize)
+	}
+	z, err := hex.DecodeString(input.Z)
+	if err != nil || len(z) != frostcore.ScalarSize {
+		return "", nil, fmt.Errorf("z: expected %d bytes of hex", frostcore.ScalarSize)
+	}
+	m, s := frostcore.ScalarFromBytes(msg), frostcore.ScalarFromBytes(z)
+
+	if enc == EncodingCompressed {
+		y, rr := new(big.Int).SetBytes(groupKey), new(big.Int).SetBytes(r)
+		return cfg.function + "(bytes32,bytes32,uint256,uint256)", []*big.Int{y, rr, s, m}, nil
+	}
+	ax, ay, err := frostcore.CircomPublicKey(groupKey)
+	if err != nil {
+		return "", nil, err
+	}
+	rx, ry, err := frostcore.Affine(r)
+	if err != nil {
+		return "", nil, fmt.Errorf("R: %w", err)
+	}
+	return cfg.function + "(uint256,uint256,uint256,uint256,uint256,uint256)", []*big.Int{ax, ay, rx, ry, s, m}, nil
+}
+
+// groth16Args reads a snarkjs proof and its public signals as arguments for
+// the verifier snarkjs generates. G2 coordinates are swapped, since the
+// pairing precompile takes the imaginary part first.
+func groth16Args(proofPath, publicPath string) (string, []*big.Int, error) {
+	if proofPath == "" || publicPath == "" {
+		return "", nil, fmt.Errorf("needs -proof and -public")
+	}
+	var proof Groth16Proof
+	readJSONFile(proofPath, &proof)
+	var public []string
+	readJSONFile(publicPath, &public)
+	if proof.Protocol != "" && proof.Protocol != "groth16" {
+		return "", nil, fmt.Errorf("%s: protocol is %s, not groth16", proofPath, proof.Protocol)
+	}
+	if len(proof.A) < 2 || len(proof.C) < 2 || len(proof.B) < 2 || len(proof.B[0]) < 2 || len(proof.B[1]) < 2 {
+		return "", nil, fmt.Errorf("%s: pi_a, pi_b or pi_c is incomplete", proofPath)
+	}
+	if len(public) == 0 {
+		return "", nil, fmt.Errorf("%s: no public signals", publicPath)
+	}
+	fields := []string{
+		proof.A[0], proof.A[1],
+		proof.B[0][1], proof.B[0][0], proof.B[1][1], proof.B[1][0],
+		proof.C[0], proof.C[1],
+	}
+	fields = append(fields, public...)
+	args := make([]*big.Int, len(fields))
+	for i, f := range fields {
+		x, ok := new(big.Int).SetString(f, 10)
+		if !ok {
+			return "", nil, fmt.Errorf("%q is not a decimal field element", f)
+		}
+		args[i] = x
+	}
+	return fmt.Sprintf("verifyProof(uint256[2],uint256[2][2],uint256[2],uint256[%d])", len(public)), args, nil
+}
+
+// estimateCalldata fills in the chain ID, and for each option the gas
+// estimate and the verifier's answer, from the RPC endpoint. It returns the
+// gas price to use: the one given, or the endpoint's.
+func estimateCalldata(cfg calldataConfig, report *CalldataReport, price *big.Int) *big.Int {
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.timeout)
+	defer cancel()
+	client := &evm.Client{URL: cfg.rpc}
+
+	chainID, err := client.ChainID(ctx)
+	if err != nil {
+		fail(KindTransport, "Error: %v", err)
+	}
+	report.ChainID = chainID
+	if price == nil {
+		if price, err = client.GasPrice(ctx); err != nil {
+			fail(KindTransport, "Error: %v", err)
+		}
+	}
+	if cfg.to == "" {
+		fmt.Fprintln(os.Stderr, "Warning: no -to verifier address; only calldata costs are estimated")
+		return price
+	}
+	for i := range report.Options {
+		o := &report.Options[i]
+		msg := evm.CallMsg{From: cfg.from, To: cfg.to, Data: o.Calldata}
+		if o.EstimatedGas, err = client.EstimateGas(ctx, msg); err != nil {
+			o.Error = err.Error()
+			continue
+		}
+		ret, err := client.Call(ctx, msg)
+		if err != nil {
+			o.Error = err.Error()
+			continue
+		}
+		if v, ok := evm.Bool(ret); ok {
+			o.Accepted = &v
+		}
+	}
+	return price
+}
+
+// pickCheapest names the option expected to cost least, among those the
+// verifier did not reject.
+func pickCheapest(report *CalldataReport) {
+	var ok []CalldataOption
+	estimated := true
+	for _, o := range report.Options {
+		if o.Error != "" || o.Accepted != nil && !*o.Accepted {
+			continue
+		}
+		ok = append(ok, o)
+		estimated = estimated && o.EstimatedGas > 0
+	}
+	if len(ok) == 0 {
+		return
+	}
+	sort.SliceStable(ok, func(i, j int) bool { return ok[i].expectedGas() < ok[j].expectedGas() })
+	report.Cheapest = ok[0].Encoding
+	report.CheapestBy = "lower_bound"
+	if estimated {
+		report.CheapestBy = "estimate"
+	}
+}
+
+func printCalldataReport(report *CalldataReport) {
+	if report.ChainID != 0 {
+		fmt.Printf("Chain %d, verifier %s\n", report.ChainID, orNone(report.Verifier))
+	}
+	if report.GasPrice != "" {
+		price, _ := new(big.Int).SetString(report.GasPrice, 10)
+		fmt.Printf("Gas price: %s gwei\n", evm.FormatGwei(price))
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ENCODING\tBYTES\tZEROS\tCALLDATA GAS\tINTRINSIC\tMIN VERIFY\tESTIMATE\tCOST (gwei)\tRESULT")
+	for _, o := range report.Options {
+		result := "-"
+		switch {
+		case o.Error != "":
+			result = "error: " + o.Error
+		case o.Accepted != nil && *o.Accepted:
+			result = "accepted"
+		case o.Accepted != nil:
+			result = "rejected"
+		}
+		cost := "-"
+		if o.CostWei != "" {
+			wei, _ := new(big.Int).SetString(o.CostWei, 10)
+			cost = evm.FormatGwei(wei)
+		}
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%d\t%s\t%s\t%s\t%s\n", o.Encoding, o.Size, o.ZeroBytes, o.CalldataGas, o.IntrinsicGas,
+			gasOrDash(o.MinVerifyGas), gasOrDash(o.EstimatedGas), cost, result)
+	}
+	w.Flush()
+	if report.Cheapest != "" {
+		basis := "by gas estimate"
+		if report.CheapestBy != "estimate" {
+			basis = "by calldata and precompile lower bounds; give -rpc and -to for estimates"
+		}
+		fmt.Printf("Cheapest: %s (%s)\n", report.Cheapest, basis)
+	}
+	for _, o := range report.Options {
+		fmt.Printf("\n%s %s\n%s\n", o.Encoding, o.Function, o.Calldata)
+	}
+}
+
+func gasOrDash(gas uint64) string {
+	if gas == 0 {
+		return "-"
+	}
+	return fmt.Sprint(gas)
+}
+
+func orNone(s string) string {
+	if s == "" {
+		return "(none)"
+	}
+	return s
+}
+
+// parseEncodings parses the -encoding flag: a comma-separated list, or all.
+// groth16 is only included in all when a proof is given.
+func parseEncodings(s string, haveProof bool) ([]string, error) {
+	if s == "all" {
+		if haveProof {
+			return calldataEncodings, nil
+		}
+		return calldataEncodings[:2], nil
+	}
+	var out []string
+	for _, e := range strings.Split(s, ",") {
+		e = strings.TrimSpace(e)
+		found := false
+		for _, known := range calldataEncodings {
+			found = found || e == known
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown encoding %q (want %s or all)", e, strings.Join(calldataEncodings, ", "))
+		}
+		out = append(out, e)
+	}
+	return out, nil
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+
+	"keygen/apdu"
+	"keygen/ciphersuite"
+	"keygen/frostcore"
+	"keygen/schema"
+	"keygen/secret"
+)
+
+// ciphersuiteName is set by --ciphersuite and $FY_LEDGER_CIPHERSUITE,
+// hasherName by --hasher and $FY_LEDGER_HASHER.
+var ciphersuiteName, hasherName string
+
+// setupCiphersuite switches frostcore to the suite of --ciphersuite, or
+// the Baby Jubjub suite of --hasher, and makes inputs made with another
+// suite errors. With neither, the default suite is used until an input
+// names another, which is then adopted: sign and aggregate go on with the
+// hasher their inputs were made with.
+func setupCiphersuite() {
+	cs := ciphersuite.Default
+	if ciphersuiteName != "" {
+		var err error
+		if cs, err = ciphersuite.Lookup(ciphersuiteName); err != nil {
+			fail(KindUsage, "Error: --ciphersuite: %v", err)
+		}
+	}
+	if hasherName != "" {
+		hs, err := ciphersuite.WithHasher(hasherName)
+		if err != nil {
+			fail(KindUsage, "Error: --hasher: %v", err)
+		}
+		if ciphersuiteName != "" && hs.ID() != cs.ID() {
+			fail(KindUsage, "Error: --hasher %s does not match --ciphersuite %s", hasherName, cs.Name())
+		}
+		cs = hs
+	}
+	if err := frostcore.Use(cs); err != nil {
+		fail(KindUsage, "Error: --ciphersuite: %v", err)
+	}
+	schema.Ciphersuite = cs.ID()
+	if ciphersuiteName == "" && hasherName == "" {
+		schema.Adopt = func(id string) error {
+			cs, err := ciphersuite.Lookup(id)
+			if err != nil {
+				return err
+			}
+			return frostcore.Use(cs)
+		}
+	}
+}
+
+// deviceCurves maps each ciphersuite the app runs to its INJECT_KEYS curve
+// identifier.
+var deviceCurves = map[string]byte{
+	ciphersuite.BJJBlake2b{}.Name(): apdu.CurveBJJ,
+}
+
+// deviceCurve returns the INJECT_KEYS curve identifier of the suite in use,
+// or exits if devices cannot run it.
+func deviceCurve() byte {
+	curve, ok := deviceCurves[frostcore.Suite.Name()]
+	if !ok {
+		fail(KindInput, "Error: devices do not run ciphersuite %s", frostcore.Suite.Name())
+	}
+	return curve
+}
+
+// jsonOutput encodes v as indented JSON, with a newline. A JSON object
+// without a "ciphersuite" key gains one first, naming the suite in use, so
+// that every output says which suite its keys and signatures belong to.
+// The intermediate encoding is wiped, as v may hold secrets.
+func jsonOutput(v any) ([]byte, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	defer secret.Wipe(b)
+	var probe struct {
+		Ciphersuite json.RawMessage `json:"ciphersuite"`
+	}
+	if len(b) >= 2 && b[0] == '{' && json.Unmarshal(b, &probe) == nil && probe.Ciphersuite == nil {
+		id, _ := json.Marshal(frostcore.Suite.ID())
+		stamped := append([]byte(`{"`+schema.CiphersuiteKey+`":`), id...)
+		if len(b) > 2 {
+			stamped = append(stamped, ',')
+		}
+		stamped = append(stamped, b[1:]...)
+		secret.Wipe(b)
+		b = stamped
+	}
+	var out bytes.Buffer
+	if err := json.Indent(&out, b, "", "  "); err != nil {
+		return nil, err
+	}
+	out.WriteByte('\n')
+	return out.Bytes(), nil
+}
+
+// writeJSON prints a command's output with jsonOutput and records it in the
+// transcript.
+func writeJSON(v any) {
+	record(entryOutput, v)
+	data, err := jsonOutput(v)
+	if err != nil {
+		fail(KindFailure, "Error encoding the output: %v", err)
+	}
+	os.Stdout.Write(data)
+	secret.Wipe(data)
+}
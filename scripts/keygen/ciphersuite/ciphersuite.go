@@ -0,0 +1,109 @@
+// Package ciphersuite names the FROST ciphersuites the tool can run with: a
+// prime-order group, the hash its FROST hashes are built on, and the encodings
+// of scalars and points. frostcore does its arithmetic and hashing through
+// the suite in use, and fy's FROST takes its group and hasher, so a new
+// curve is a new Ciphersuite registered here rather than a change to every
+// subcommand.
+//
+// The APDU payloads are fixed at 32-byte scalars and points, so only suites
+// of that size can be used.
+package ciphersuite
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/f3rmion/fy/bjj"
+	"github.com/f3rmion/fy/frost"
+	"github.com/f3rmion/fy/group"
+
+	"keygen/h2c"
+)
+
+// Ciphersuite is a FROST ciphersuite.
+type Ciphersuite interface {
+	// ID is the suite's context string, the domain separation prefix of
+	// its hashes, e.g. "FROST-EDBABYJUJUB-BLAKE512-v1". JSON outputs carry
+	// it as "ciphersuite".
+	ID() string
+
+	// Name is the short name --ciphersuite takes, e.g. "bjj-blake2b".
+	Name() string
+
+	// Group is the group all point arithmetic is done in.
+	Group() group.Group
+
+	// Order is the order of the group's prime subgroup.
+	Order() *big.Int
+
+	// ScalarSize and PointSize are the encoded sizes: scalars big-endian,
+	// points compressed as the group's Bytes.
+	ScalarSize() int
+	PointSize() int
+
+	// HashToScalar hashes ID || tag || parts to a scalar mod Order, the
+	// form of H1 ("rho"), H2 ("chal") and H3 ("nonce").
+	HashToScalar(tag string, parts ...[]byte) *big.Int
+
+	// Hasher is the same hashing for fy's FROST.
+	Hasher() frost.Hasher
+}
+
+// BJJBlake2b is Baby Jubjub with Blake2b-512, as fy's Blake2bHasher and the
+// Ledger app compute it: the suite every group so far was made with.
+type BJJBlake2b struct{}
+
+func (BJJBlake2b) ID() string           { return "FROST-EDBABYJUJUB-BLAKE512-v1" }
+func (BJJBlake2b) Name() string         { return "bjj-blake2b" }
+func (BJJBlake2b) Group() group.Group   { return &bjj.BJJ{} }
+func (BJJBlake2b) Order() *big.Int      { return h2c.Order }
+func (BJJBlake2b) ScalarSize() int      { return 32 }
+func (BJJBlake2b) PointSize() int       { return 32 }
+func (BJJBlake2b) Hasher() frost.Hasher { return frost.NewBlake2bHasher() }
+
+// HashToScalar interprets the Blake2b-512 digest as little-endian and
+// reduces it mod Order (h2c.Blake2bScalar).
+func (s BJJBlake2b) HashToScalar(tag string, parts ...[]byte) *big.Int {
+	return h2c.Blake2bScalar(s.ID(), tag, parts...)
+}
+
+// Default is the suite used unless --ciphersuite names another.
+var Default Ciphersuite = BJJBlake2b{}
+
+var suites = []Ciphersuite{BJJBlake2b{}, BJJSHA512{}, BJJKeccak256{}, BJJPoseidon{}}
+
+// Register adds a suite. A name or ID already registered, as any the
+// built-in suites have, is an error rather than a replacement, so that no
+// suite can be swapped for another under the name inputs and devices use.
+func Register(cs Ciphersuite) error {
+	if cs.Name() == "" || cs.ID() == "" {
+		return fmt.Errorf("ciphersuite %q has no name or ID", cs.Name())
+	}
+	for _, s := range suites {
+		if strings.EqualFold(s.Name(), cs.Name()) || strings.EqualFold(s.ID(), cs.ID()) {
+			return fmt.Errorf("ciphersuite %s (%s) is already registered", cs.Name(), cs.ID())
+		}
+	}
+	suites = append(suites, cs)
+	return nil
+}
+
+// Lookup returns the suite with the given name or ID, case-insensitively.
+func Lookup(name string) (Ciphersuite, error) {
+	for _, s := range suites {
+		if strings.EqualFold(name, s.Name()) || strings.EqualFold(name, s.ID()) {
+			return s, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown ciphersuite %q (have %s)", name, strings.Join(Names(), ", "))
+}
+
+// Names returns the names of the registered suites.
+func Names() []string {
+	names := make([]string, len(suites))
+	for i, s := range suites {
+		names[i] = s.Name()
+	}
+	return names
+}
@@ -0,0 +1,148 @@
+package ciphersuite
+
+import (
+	"crypto/sha512"
+	"fmt"
+	"math/big"
+	"slices"
+	"strings"
+
+	"github.com/f3rmion/fy/bjj"
+	"github.com/f3rmion/fy/frost"
+	"github.com/f3rmion/fy/group"
+	"github.com/iden3/go-iden3-crypto/poseidon"
+	"golang.org/x/crypto/sha3"
+
+	"keygen/h2c"
+)
+
+// The Baby Jubjub suites below differ from BJJBlake2b only in the hash the
+// FROST hashes are built on. The Ledger app computes Blake2b only, so they
+// are for host-side groups: Keccak-256 for challenges an EVM contract
+// recomputes cheaply, Poseidon for ones a circuit does.
+
+// BJJSHA512 is Baby Jubjub with SHA-512, the digest read as little-endian
+// and reduced mod Order, as for Blake2b.
+type BJJSHA512 struct{ bjjHost }
+
+func (BJJSHA512) ID() string             { return "FROST-EDBABYJUJUB-SHA512-v1" }
+func (BJJSHA512) Name() string           { return "bjj-sha512" }
+func (s BJJSHA512) Hasher() frost.Hasher { return suiteHasher{s} }
+
+func (s BJJSHA512) HashToScalar(tag string, parts ...[]byte) *big.Int {
+	h := sha512.New()
+	h.Write([]byte(s.ID()))
+	h.Write([]byte(tag))
+	for _, p := range parts {
+		h.Write(p)
+	}
+	digest := h.Sum(nil)
+	slices.Reverse(digest)
+	return new(big.Int).Mod(new(big.Int).SetBytes(digest), h2c.Order)
+}
+
+// BJJKeccak256 is Baby Jubjub with Keccak-256 as the EVM computes it. One
+// digest is too short to reduce mod Order without bias, so the hash is
+// Keccak-256(input || 0x00) || Keccak-256(input || 0x01), read as
+// big-endian, as a contract reads a uint256.
+type BJJKeccak256 struct{ bjjHost }
+
+func (BJJKeccak256) ID() string             { return "FROST-EDBABYJUJUB-KECCAK256-v1" }
+func (BJJKeccak256) Name() string           { return "bjj-keccak256" }
+func (s BJJKeccak256) Hasher() frost.Hasher { return suiteHasher{s} }
+
+func (s BJJKeccak256) HashToScalar(tag string, parts ...[]byte) *big.Int {
+	var wide []byte
+	for i := range 2 {
+		h := sha3.NewLegacyKeccak256()
+		h.Write([]byte(s.ID()))
+		h.Write([]byte(tag))
+		for _, p := range parts {
+			h.Write(p)
+		}
+		h.Write([]byte{byte(i)})
+		wide = h.Sum(wide)
+	}
+	return new(big.Int).Mod(new(big.Int).SetBytes(wide), h2c.Order)
+}
+
+// BJJPoseidon is Baby Jubjub with circomlib's Poseidon over the BN254
+// scalar field, which the Baby Jubjub base field is. The input is
+// h2c.Context(ID, tag, parts...), so that the sponge's zero padding cannot
+// make two inputs collide, hashed 31 bytes to a field element
+// (poseidon.HashBytes). A field element reduced mod Order is close to
+// uniform: the field is about 8 times Order.
+type BJJPoseidon struct{ bjjHost }
+
+func (BJJPoseidon) ID() string             { return "FROST-EDBABYJUJUB-POSEIDON-v1" }
+func (BJJPoseidon) Name() string           { return "bjj-poseidon" }
+func (s BJJPoseidon) Hasher() frost.Hasher { return suiteHasher{s} }
+
+func (s BJJPoseidon) HashToScalar(tag string, parts ...[]byte) *big.Int {
+	in := h2c.Context(append([][]byte{[]byte(s.ID()), []byte(tag)}, parts...)...)
+	hm, err := poseidon.HashBytes(in)
+	if err != nil {
+		panic(err) // Only for a bad frame size, and the default is good
+	}
+	return hm.Mod(hm, h2c.Order)
+}
+
+// bjjHost is the group and encodings the Baby Jubjub suites share.
+type bjjHost struct{}
+
+func (bjjHost) Group() group.Group { return &bjj.BJJ{} }
+func (bjjHost) Order() *big.Int    { return h2c.Order }
+func (bjjHost) ScalarSize() int    { return 32 }
+func (bjjHost) PointSize() int     { return 32 }
+
+// suiteHasher is fy's frost.Hasher computed with a suite's HashToScalar,
+// for suites fy has no hasher of its own for.
+type suiteHasher struct{ cs Ciphersuite }
+
+// H1 is the binding factor, as frostcore.BindingFactor.
+func (h suiteHasher) H1(msg, encCommitList, signerID []byte) group.Scalar {
+	return h.scalar(h.cs.HashToScalar("rho", msg, encCommitList, signerID))
+}
+
+// H2 is the challenge, as frostcore.Challenge.
+func (h suiteHasher) H2(R, Y, msg []byte) group.Scalar {
+	return h.scalar(h.cs.HashToScalar("chal", R, Y, msg))
+}
+
+func (h suiteHasher) scalar(x *big.Int) group.Scalar {
+	b := make([]byte, h.cs.ScalarSize())
+	x.FillBytes(b)
+	s := h.cs.Group().NewScalar()
+	s.SetBytes(b)
+	return s
+}
+
+// hashers names the Baby Jubjub suites by their hash, for --hasher, with
+// those of RegisterHasher.
+var hashers = map[string]Ciphersuite{
+	"blake2b":   BJJBlake2b{},
+	"sha512":    BJJSHA512{},
+	"keccak256": BJJKeccak256{},
+	"poseidon":  BJJPoseidon{},
+}
+
+// WithHasher returns the Baby Jubjub suite built on the named hash:
+// blake2b, sha512, keccak256, poseidon or one registered with
+// RegisterHasher.
+func WithHasher(name string) (Ciphersuite, error) {
+	cs, ok := hashers[hasherKey(name)]
+	if !ok {
+		return nil, fmt.Errorf("unknown hasher %q (have %s)", name, strings.Join(Hashers(), ", "))
+	}
+	return cs, nil
+}
+
+// Hashers returns the names WithHasher takes.
+func Hashers() []string {
+	names := make([]string, 0, len(hashers))
+	for name := range hashers {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
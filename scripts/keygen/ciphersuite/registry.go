@@ -0,0 +1,119 @@
+package ciphersuite
+
+import (
+	"errors"
+	"fmt"
+	"hash"
+	"math/big"
+	"slices"
+	"strings"
+
+	"github.com/f3rmion/fy/frost"
+
+	"keygen/h2c"
+)
+
+// Hash describes a hash function an embedding application registers with
+// RegisterHasher, to trial it as the hash of a Baby Jubjub suite without
+// changing this package.
+type Hash struct {
+	// ID is the suite's context string, e.g. "FROST-EDBABYJUJUB-BLAKE3-v1".
+	ID string
+
+	// New returns the hash. The input is ID || tag || parts, as for the
+	// built-in suites.
+	New func() hash.Hash
+
+	// Encoding is how the digest is read as an integer before it is
+	// reduced mod Order.
+	Encoding Encoding
+
+	// Hasher is fy's frost.Hasher for the suite. If nil, it is computed
+	// with the suite's HashToScalar; one given must hash the same.
+	Hasher frost.Hasher
+}
+
+// Encoding is the byte order a digest is read in.
+type Encoding int
+
+const (
+	LittleEndian Encoding = iota // As Blake2b and SHA-512
+	BigEndian                    // As Keccak-256, as a contract reads a uint256
+)
+
+// RegisterHasher registers a Baby Jubjub suite built on h under a hasher
+// name, so that --hasher name, --ciphersuite bjj-name and h.ID all resolve
+// to it, in flags, the environment and the ciphersuite key of inputs.
+// Registering a name again replaces it; the built-in hashers cannot be.
+// Digests shorter than 48 bytes reduce mod Order with a bias, so prefer a
+// wide hash, or widen it as BJJKeccak256 does.
+func RegisterHasher(name string, h Hash) error {
+	key := hasherKey(name)
+	switch {
+	case key == "":
+		return errors.New("hasher name is empty")
+	case slices.Contains(builtinHashers, key):
+		return fmt.Errorf("hasher %q is built in", name)
+	case h.ID == "":
+		return fmt.Errorf("hasher %q has no suite ID", name)
+	case h.New == nil:
+		return fmt.Errorf("hasher %q has no hash function", name)
+	case h.Encoding != LittleEndian && h.Encoding != BigEndian:
+		return fmt.Errorf("hasher %q: unknown encoding %d", name, h.Encoding)
+	}
+	cs := customSuite{name: "bjj-" + key, h: h}
+	for _, s := range suites {
+		if strings.EqualFold(s.ID(), h.ID) && s.Name() != cs.name {
+			return fmt.Errorf("hasher %q: suite ID %s is %s's", name, h.ID, s.Name())
+		}
+	}
+	// A hasher registered before is replaced, which Register refuses
+	if _, ok := hashers[key]; ok {
+		suites = slices.DeleteFunc(suites, func(s Ciphersuite) bool { return s.Name() == cs.name })
+	}
+	if err := Register(cs); err != nil {
+		return fmt.Errorf("hasher %q: %w", name, err)
+	}
+	hashers[key] = cs
+	return nil
+}
+
+// hasherKey is the form of a hasher name WithHasher looks up.
+func hasherKey(name string) string {
+	return strings.ToLower(strings.ReplaceAll(name, "-", ""))
+}
+
+// builtinHashers are the hashers of this package, which RegisterHasher
+// does not replace.
+var builtinHashers = []string{"blake2b", "sha512", "keccak256", "poseidon"}
+
+// customSuite is the suite of a registered Hash.
+type customSuite struct {
+	bjjHost
+	name string
+	h    Hash
+}
+
+func (s customSuite) ID() string   { return s.h.ID }
+func (s customSuite) Name() string { return s.name }
+
+func (s customSuite) Hasher() frost.Hasher {
+	if s.h.Hasher != nil {
+		return s.h.Hasher
+	}
+	return suiteHasher{s}
+}
+
+func (s customSuite) HashToScalar(tag string, parts ...[]byte) *big.Int {
+	h := s.h.New()
+	h.Write([]byte(s.h.ID))
+	h.Write([]byte(tag))
+	for _, p := range parts {
+		h.Write(p)
+	}
+	digest := h.Sum(nil)
+	if s.h.Encoding == LittleEndian {
+		slices.Reverse(digest)
+	}
+	return new(big.Int).Mod(new(big.Int).SetBytes(digest), h2c.Order)
+}
@@ -0,0 +1,104 @@
+// Package circom generates Circom test harnesses that check FROST group
+// signatures with circomlib's EdDSAPoseidonVerifier, the verifier Railgun
+// uses.
+package circom
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// DefaultInclude is where circomlib's circuits are found relative to the
+// harness (e.g. after `npm install circomlib`).
+const DefaultInclude = "node_modules/circomlib/circuits"
+
+// Input is the witness input for the harness circuit. Values are decimal
+// field elements, as circom expects.
+type Input struct {
+	M   string `json:"M"`
+	R8x string `json:"R8x"`
+	R8y string `json:"R8y"`
+	S   string `json:"S"`
+}
+
+// Signature is a signature with its public key in circomlib's form: the
+// inputs of EdDSAPoseidonVerifier, named as its signals. circomlibjs's
+// eddsa.verifyPoseidon(M, {R8: [R8x, R8y], S}, [Ax, Ay]) takes the same
+// values.
+type Signature struct {
+	Ax string `json:"Ax"`
+	Ay string `json:"Ay"`
+	Input
+}
+
+// Harness is a verifier circuit with the group's public key fixed.
+type Harness struct {
+	Ax, Ay *big.Int // circomlib public key A = Y/8
+	Input  Input
+}
+
+// NewHarness builds the harness for a group key (as A = Y/8) and signature.
+func NewHarness(ax, ay, m, rx, ry, s *big.Int) *Harness {
+	return &Harness{
+		Ax: ax,
+		Ay: ay,
+		Input: Input{
+			M:   m.String(),
+			R8x: rx.String(),
+			R8y: ry.String(),
+			S:   s.String(),
+		},
+	}
+}
+
+// Signature returns the harness input with the public key.
+func (h *Harness) Signature() Signature {
+	return Signature{Ax: h.Ax.String(), Ay: h.Ay.String(), Input: h.Input}
+}
+
+// Circuit returns the main circuit source. include is the directory holding
+// circomlib's eddsaposeidon.circom.
+func (h *Harness) Circuit(include string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, `pragma circom 2.0.0;
+
+include "%s/eddsaposeidon.circom";
+
+// Verifies a FROST signature of one group: EdDSAPoseidonVerifier with the
+// group's public key A = Y/8 fixed. M is public; R8 and S are the signature.
+template FrostGroupVerifier(Ax, Ay) {
+    signal input M;
+    signal input R8x;
+    signal input R8y;
+    signal input S;
+
+    component verifier = EdDSAPoseidonVerifier();
+    verifier.enabled <== 1;
+    verifier.Ax <== Ax;
+    verifier.Ay <== Ay;
+    verifier.R8x <== R8x;
+    verifier.R8y <== R8y;
+    verifier.S <== S;
+    verifier.M <== M;
+}
+
+component main {public [M]} = FrostGroupVerifier(
+    %s,
+    %s
+);
+`, strings.TrimSuffix(include, "/"), h.Ax, h.Ay)
+	return b.String()
+}
+
+// Script is a shell script that compiles the circuit and computes the
+// witness, which fails if the signature does not verify.
+const Script = `#!/bin/sh
+# Compile the harness and compute a witness from input.json. Witness
+# generation fails if the signature does not verify.
+set -e
+cd "$(dirname "$0")"
+circom frost_verify.circom --r1cs --wasm --sym
+node frost_verify_js/generate_witness.js frost_verify_js/frost_verify.wasm input.json witness.wtns
+echo "Signature verified in circuit"
+`
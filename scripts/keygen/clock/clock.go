@@ -0,0 +1,169 @@
+// Package clock puts time behind an interface, so that the logic that
+// depends on it (session deadlines and expiry, nonce TTLs, retention, retry
+// scheduling and the timestamps in audit records) can be driven by a Fake
+// in tests instead of waiting on the wall clock.
+//
+// Code that takes a Clock treats nil as Real. Waits that coordinate with
+// other processes, such as lock file polling and network deadlines, stay on
+// the wall clock.
+package clock
+
+import (
+	"slices"
+	"sync"
+	"time"
+)
+
+// Clock tells the time and makes timers.
+type Clock interface {
+	Now() time.Time
+	NewTimer(d time.Duration) Timer
+}
+
+// Timer is a single-shot timer, like time.Timer.
+type Timer interface {
+	// C delivers the time the timer fired, once.
+	C() <-chan time.Time
+	// Stop stops the timer, reporting whether it had yet to fire.
+	Stop() bool
+}
+
+// Real is the wall clock.
+var Real Clock = realClock{}
+
+// Or returns c, or Real if c is nil.
+func Or(c Clock) Clock {
+	if c == nil {
+		return Real
+	}
+	return c
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time { return time.Now() }
+
+func (realClock) NewTimer(d time.Duration) Timer { return realTimer{time.NewTimer(d)} }
+
+type realTimer struct{ t *time.Timer }
+
+func (t realTimer) C() <-chan time.Time { return t.t.C }
+func (t realTimer) Stop() bool          { return t.t.Stop() }
+
+// Fake is a clock that only moves when told to. Its timers fire, in
+// deadline order, when Advance or Set moves it past their deadlines.
+type Fake struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	now     time.Time
+	pending []*fakeTimer // By deadline
+}
+
+// NewFake returns a Fake reading start.
+func NewFake(start time.Time) *Fake {
+	f := &Fake{now: start}
+	f.cond = sync.NewCond(&f.mu)
+	return f
+}
+
+// Now returns the fake time.
+func (f *Fake) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.now
+}
+
+// Advance moves the clock forward by d and fires the timers now due.
+func (f *Fake) Advance(d time.Duration) {
+	f.mu.Lock()
+	f.set(f.now.Add(d))
+	f.mu.Unlock()
+}
+
+// Set moves the clock to t, which may not be before the current time, and
+// fires the timers now due.
+func (f *Fake) Set(t time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if t.Before(f.now) {
+		panic("clock: Fake moved backwards")
+	}
+	f.set(t)
+}
+
+// set moves the clock. Callers hold f.mu.
+func (f *Fake) set(t time.Time) {
+	f.now = t
+	for len(f.pending) > 0 && !f.pending[0].deadline.After(t) {
+		f.pending[0].fire(t)
+		f.pending = f.pending[1:]
+	}
+	f.cond.Broadcast()
+}
+
+// NewTimer returns a timer that fires once the clock reaches d from now. A
+// timer of d <= 0 fires at once.
+func (f *Fake) NewTimer(d time.Duration) Timer {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	t := &fakeTimer{f: f, deadline: f.now.Add(d), c: make(chan time.Time, 1)}
+	if d <= 0 {
+		t.fire(f.now)
+		return t
+	}
+	i, _ := slices.BinarySearchFunc(f.pending, t.deadline, func(p *fakeTimer, d time.Time) int {
+		if p.deadline.After(d) {
+			return 1
+		}
+		return -1
+	})
+	f.pending = slices.Insert(f.pending, i, t)
+	f.cond.Broadcast()
+	return t
+}
+
+// Pending returns the number of timers yet to fire.
+func (f *Fake) Pending() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.pending)
+}
+
+// BlockUntil waits until at least n timers are pending, so a test can let
+// the code under test reach its wait before advancing the clock.
+func (f *Fake) BlockUntil(n int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for len(f.pending) < n {
+		f.cond.Wait()
+	}
+}
+
+type fakeTimer struct {
+	f        *Fake
+	deadline time.Time
+	c        chan time.Time
+}
+
+func (t *fakeTimer) C() <-chan time.Time { return t.c }
+
+// fire delivers now. Callers hold t.f.mu.
+func (t *fakeTimer) fire(now time.Time) {
+	select {
+	case t.c <- now:
+	default:
+	}
+}
+
+// Stop removes the timer if it has yet to fire.
+func (t *fakeTimer) Stop() bool {
+	t.f.mu.Lock()
+	defer t.f.mu.Unlock()
+	i := slices.Index(t.f.pending, t)
+	if i < 0 {
+		return false
+	}
+	t.f.pending = slices.Delete(t.f.pending, i, i+1)
+	t.f.cond.Broadcast()
+	return true
+}
@@ -0,0 +1,131 @@
+package coordinator
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+)
+
+// Mutual TLS: a deployment that issues each participant a client
+// certificate from its own CA serves over TLS requiring them (keygen serve
+// -client-ca), and the transports put the subject common name of the
+// verified certificate in Request.Meta under MetaClientCert. ClientCerts
+// authenticates by it, and CertParticipants lets a certificate submit
+// commitments and partial signatures only as the participants it is issued
+// for, so a leaked bearer token or another participant's certificate cannot
+// submit in a participant's name.
+
+// MetaClientCert is the Meta key of the common name of the caller's
+// verified client certificate. Transports set it only for a certificate
+// that chains to the server's client CA.
+const MetaClientCert = "client_cert"
+
+// ClientCert is what one client certificate authenticates.
+type ClientCert struct {
+	Principal string `json:"principal"`
+	Tenant    string `json:"tenant,omitempty"`
+
+	// Participants maps each group key to the participant the
+	// certificate submits for in that group's sessions.
+	Participants map[string]int `json:"participants,omitempty"`
+}
+
+// ClientCerts authenticates callers by their client certificate, from a
+// fixed common name -> ClientCert map.
+type ClientCerts map[string]ClientCert
+
+func (c ClientCerts) Authenticate(ctx context.Context, req *Request) (string, error) {
+	id, err := c.AuthenticateTenant(ctx, req)
+	return id.Principal, err
+}
+
+func (c ClientCerts) AuthenticateTenant(ctx context.Context, req *Request) (Identity, error) {
+	name := req.Meta[MetaClientCert]
+	if cert, ok := c[name]; ok && name != "" {
+		return Identity{Tenant: cert.Tenant, Principal: cert.Principal}, nil
+	}
+	if name == "" {
+		return Identity{}, Errorf(CodeUnauthenticated, "no client certificate")
+	}
+	return Identity{}, Errorf(CodeUnauthenticated, "unknown client certificate %q", name)
+}
+
+// Authenticators tries each Authenticator in turn and takes the first that
+// accepts the request, e.g. client certificates for participants and bearer
+// tokens for operators.
+type Authenticators []Authenticator
+
+func (as Authenticators) Authenticate(ctx context.Context, req *Request) (string, error) {
+	id, err := as.AuthenticateTenant(ctx, req)
+	return id.Principal, err
+}
+
+func (as Authenticators) AuthenticateTenant(ctx context.Context, req *Request) (Identity, error) {
+	err := Errorf(CodeUnauthenticated, "invalid or missing credential")
+	for _, a := range as {
+		if ta, ok := a.(TenantAuthenticator); ok {
+			var id Identity
+			if id, err = ta.AuthenticateTenant(ctx, req); err == nil {
+				return id, nil
+			}
+			continue
+		}
+		var principal string
+		if principal, err = a.Authenticate(ctx, req); err == nil {
+			return Identity{Principal: principal}, nil
+		}
+	}
+	return Identity{}, err
+}
+
+// CertParticipants rejects submit_commitment and submit_partial unless the
+// caller's client certificate is in certs and issued for the submitted
+// participant in the session's group. It reads the session through next,
+// so it goes last, next to the Coordinator, after Auth.
+func CertParticipants(certs ClientCerts) Middleware {
+	return func(next Handler) Handler {
+		return HandlerFunc(func(ctx context.Context, req *Request) (*Response, error) {
+			if req.Op != OpSubmitCommitment && req.Op != OpSubmitPartial {
+				return next.Handle(ctx, req)
+			}
+			name := req.Meta[MetaClientCert]
+			cert, ok := certs[name]
+			if !ok || name == "" {
+				return nil, Errorf(CodeForbidden, "%s needs the client certificate of the participant", req.Op)
+			}
+			var p struct {
+				ID int `json:"id"`
+			}
+			if err := req.Decode(&p); err != nil {
+				return nil, err
+			}
+			resp, err := next.Handle(ctx, &Request{Op: OpGetSession, SessionID: req.SessionID, Principal: req.Principal, Tenant: req.Tenant, Meta: req.Meta})
+			if err != nil {
+				return nil, err
+			}
+			b, err := json.Marshal(resp.Body)
+			if err != nil {
+				return nil, err
+			}
+			var s struct {
+				GroupKey string `json:"group_key"`
+			}
+			if err := json.Unmarshal(b, &s); err != nil {
+				return nil, err
+			}
+			if id, ok := cert.Participants[s.GroupKey]; !ok || id != p.ID {
+				return nil, Errorf(CodeForbidden, "client certificate %q is not issued for participant %d of group %s", name, p.ID, s.GroupKey)
+			}
+			return next.Handle(ctx, req)
+		})
+	}
+}
+
+// clientCertName returns the common name of r's verified client
+// certificate, or "" if there is none.
+func clientCertName(r *http.Request) string {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return ""
+	}
+	return r.TLS.VerifiedChains[0][0].Subject.CommonName
+}
@@ -0,0 +1,1062 @@
+package coordinator
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"maps"
+	"math/big"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"keygen/apdu"
+	"keygen/clock"
+	"keygen/frostcore"
+	"keygen/groupstate"
+)
+
+// Session states
+const (
+	StateCollectingCommitments = "collecting_commitments"
+	StateCollectingPartials    = "collecting_partials"
+	StateComplete              = "complete"
+	StateFailed                = "failed"
+)
+
+// CreateSessionParams is the create_session body.
+type CreateSessionParams struct {
+	GroupKey    string `json:"group_key"`    // 32 bytes compressed
+	MessageHash string `json:"message_hash"` // 32 bytes
+	Signers     []int  `json:"signers"`      // Participant IDs taking part
+
+	// Purpose, if set, must be the purpose tag the group's shares were
+	// provisioned for (groupstate.Document.Purpose); sessions always sign
+	// for the group's. Stating it lets a PurposePolicy judge the request.
+	Purpose string `json:"purpose,omitempty"`
+
+	// RequireDeviceApproval rejects partial signatures that were not
+	// confirmed by a human on a device (see PartialParams.Approval).
+	RequireDeviceApproval bool `json:"require_device_approval,omitempty"`
+
+	// RequireCommitmentProofs rejects commitments without a proof of
+	// knowledge of their nonces (see CommitmentParams.Proof), for open
+	// committees that accept third-party signer implementations.
+	RequireCommitmentProofs bool `json:"require_commitment_proofs,omitempty"`
+
+	// Timeouts overrides the coordinator's timeouts for the phases it sets.
+	Timeouts *Timeouts `json:"timeouts,omitempty"`
+
+	// SignerTimeouts overrides Timeouts for individual signers, so an
+	// unattended signer can be held to a short deadline while a human
+	// confirms on another's device. Aggregation is timed per session.
+	SignerTimeouts map[int]*Timeouts `json:"signer_timeouts,omitempty"`
+
+	// Accounting attributes this session to a budget, over the group's
+	// (see groupstate.Accounting.Merge).
+	Accounting *groupstate.Accounting `json:"accounting,omitempty"`
+}
+
+// CommitmentParams is the submit_commitment body.
+type CommitmentParams struct {
+	ID            int    `json:"id"`
+	HidingCommit  string `json:"hiding_commit"`
+	BindingCommit string `json:"binding_commit"`
+
+	// Approval is the signing device's approval mode, as in PartialParams.
+	// A "device" signer will wait on a human before its partial signature,
+	// so the session gives partials the approval timeout.
+	Approval string `json:"approval,omitempty"`
+
+	// Proof is a frostcore.NonceProof of the commitment's nonces under
+	// NonceProofContext(session ID, message hash), in hex. It is checked
+	// whenever present, and required if the session says so.
+	Proof string `json:"proof,omitempty"`
+}
+
+// PartialParams is the submit_partial body.
+type PartialParams struct {
+	ID         int    `json:"id"`
+	PartialSig string `json:"partial_sig"`
+
+	// Approval is the signing device's approval mode ("device", "auto" or
+	// "unknown", from GET_VERSION); empty for software participants. It is
+	// self-reported and recorded in the audit log with the request body.
+	Approval string `json:"approval,omitempty"`
+
+	// Counter is the device's signing counter read after this signature
+	// (apdu.ReadCounter); nil if the device keeps none. Each signature
+	// increments it, so it must exceed every counter the participant
+	// reported before for the group.
+	Counter *uint64 `json:"device_counter,omitempty"`
+}
+
+// CounterRegression flags a device counter at or below one reported earlier
+// by the same participant for the same group: the device was cloned, rolled
+// back or reinstalled, or the partial signature is replayed.
+type CounterRegression struct {
+	ID       int    `json:"id"`
+	Previous uint64 `json:"previous"`
+	Reported uint64 `json:"reported"`
+}
+
+// CommitmentCheck is the coordinator's verdict on one submitted commitment,
+// made as it arrives, so that participants watching the session learn of a
+// bad commitment before the session reaches aggregation.
+type CommitmentCheck struct {
+	ID       int       `json:"id"`
+	Accepted bool      `json:"accepted"`
+	Code     Code      `json:"code,omitempty"`  // Why it was rejected
+	Error    string    `json:"error,omitempty"` // As returned to the submitter
+	Time     time.Time `json:"time"`
+}
+
+// maxCommitmentChecks bounds a session's commitment_checks, so that a
+// participant resubmitting bad commitments cannot grow it without end.
+const maxCommitmentChecks = 64
+
+// Result is the aggregated signature.
+type Result struct {
+	R     string `json:"R"`
+	Z     string `json:"z"`
+	Valid bool   `json:"valid"`
+}
+
+// Session is the public state of a signing session.
+type Session struct {
+	ID          string                   `json:"id"`
+	Tenant      string                   `json:"tenant,omitempty"`
+	GroupKey    string                   `json:"group_key"`
+	MessageHash string                   `json:"message_hash"`
+	Purpose     string                   `json:"purpose,omitempty"` // The group's purpose tag, bound into the challenge
+	Intent      string                   `json:"intent"`            // See IntentHash; the same across restarts
+	Signers     []int                    `json:"signers"`
+	State       string                   `json:"state"`
+	Commitments map[int]CommitmentParams `json:"commitments"`
+	Partials    map[int]string           `json:"partials"`
+	Approvals   map[int]string           `json:"approvals,omitempty"` // Approval mode per partial
+	Counters    map[int]uint64           `json:"device_counters,omitempty"`
+	Result      *Result                  `json:"result,omitempty"`
+	Error       string                   `json:"error,omitempty"`
+
+	RequireDeviceApproval   bool                `json:"require_device_approval,omitempty"`
+	RequireCommitmentProofs bool                `json:"require_commitment_proofs,omitempty"`
+	CounterRegressions      []CounterRegression `json:"counter_regressions,omitempty"`
+	CommitmentChecks        []CommitmentCheck   `json:"commitment_checks,omitempty"` // Oldest first
+
+	Timeouts        Timeouts          `json:"timeouts"`                   // In effect for this session
+	SignerTimeouts  map[int]Timeouts  `json:"signer_timeouts,omitempty"`  // In effect for signers with their own
+	Phase           Phase             `json:"phase,omitempty"`            // Phase being timed
+	PhaseStarted    time.Time         `json:"phase_started"`              // When it started
+	Deadline        *time.Time        `json:"deadline,omitempty"`         // When it times out; nil if unbounded
+	SignerDeadlines map[int]time.Time `json:"signer_deadlines,omitempty"` // Per pending signer, with signer_timeouts
+	TimedOut        Phase             `json:"timed_out,omitempty"`
+
+	// RestartOf is the session this one restarts (see restart_session),
+	// and RestartedAs the session that restarted this one. Salvaged maps
+	// each signer whose commitment was carried over to the session it was
+	// first submitted to, whose ID its proof is made under.
+	RestartOf   string         `json:"restart_of,omitempty"`
+	RestartedAs string         `json:"restarted_as,omitempty"`
+	Salvaged    map[int]string `json:"salvaged,omitempty"`
+
+	// Accounting is the group's accounting with the session's over it,
+	// carried into audit and reliability events.
+	Accounting *groupstate.Accounting `json:"accounting,omitempty"`
+
+	// Ops counts the scalar multiplications, point decompressions and
+	// hashes the coordinator performed for the session: checking
+	// commitments and proofs, aggregating and assigning blame.
+	Ops frostcore.Ops `json:"ops"`
+
+	timedOut *TimeoutError
+	ended    time.Time // When the session completed or failed
+	arrivals []int     // Signers in the order their commitments arrived
+}
+
+// Coordinator is the innermost Handler: it owns the sessions.
+type Coordinator struct {
+	mu          sync.Mutex
+	tenants     map[string]*tenantStore
+	timeouts    Timeouts
+	hooks       []ReliabilityHook
+	reliability *Reliability // Serves get_reliability; nil if not kept
+	proofs      bool         // Require commitment proofs in every session
+	retention   time.Duration
+	changed     chan struct{} // Closed and replaced whenever a session changes; see Changed
+	clock       clock.Clock
+}
+
+// tenantStore holds one tenant's groups and sessions. Every operation is
+// served from exactly one store, selected by Request.Tenant, so a tenant
+// cannot see or touch another tenant's groups or sessions, even by ID.
+type tenantStore struct {
+	groups   map[string]*groupstate.Document
+	sessions map[string]*Session
+	counters map[counterKey]uint64 // Highest device counter seen
+}
+
+type counterKey struct {
+	groupKey string
+	id       int
+}
+
+// New returns an empty coordinator with DefaultTimeouts.
+func New() *Coordinator {
+	return &Coordinator{
+		tenants:  make(map[string]*tenantStore),
+		timeouts: DefaultTimeouts,
+		changed:  make(chan struct{}),
+		clock:    clock.Real,
+	}
+}
+
+// SetClock makes the coordinator take the time from clk: phase deadlines,
+// expiry, retention and the times of reliability events. Tests drive it
+// with a clock.Fake.
+func (c *Coordinator) SetClock(clk clock.Clock) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.clock = clock.Or(clk)
+}
+
+// Clock returns the clock the coordinator takes the time from.
+func (c *Coordinator) Clock() clock.Clock {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.clock
+}
+
+// Changed returns a channel that is closed the next time a session is
+// created, changes state, receives a commitment or partial signature, or
+// times out, so a transport can push sessions to its clients as they
+// progress instead of having them poll. It says nothing of which session
+// changed.
+func (c *Coordinator) Changed() <-chan struct{} {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.changed
+}
+
+// notify wakes the callers waiting on Changed. Callers hold c.mu.
+func (c *Coordinator) notify() {
+	close(c.changed)
+	c.changed = make(chan struct{})
+}
+
+// RequireCommitmentProofs makes every session created from now on require
+// commitment proofs, whatever create_session asks for.
+func (c *Coordinator) RequireCommitmentProofs() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.proofs = true
+}
+
+// SetSessionRetention makes the coordinator forget completed and failed
+// sessions d after they end, so a long-running coordinator does not keep
+// every session it ever ran; get_session and get_result then return
+// not_found for them. Zero, the default, keeps them.
+func (c *Coordinator) SetSessionRetention(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.retention = d
+}
+
+// SessionCount returns the number of sessions held, across tenants,
+// including finished ones not yet pruned.
+func (c *Coordinator) SessionCount() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n := 0
+	for _, st := range c.tenants {
+		n += len(st.sessions)
+	}
+	return n
+}
+
+// Stats describes the session store, for diagnostics.
+type Stats struct {
+	Tenants   int                    `json:"tenants"`
+	Groups    int                    `json:"groups"`
+	Sessions  int                    `json:"sessions"`
+	States    map[string]int         `json:"states"`            // Sessions by state
+	ByTenant  map[string]TenantStats `json:"by_tenant"`         // "" is the default tenant
+	Retention string                 `json:"retention"`         // "0s" keeps ended sessions
+	Stalest   *time.Time             `json:"stalest,omitempty"` // Earliest phase start of a running session
+	Ops       frostcore.Ops          `json:"ops"`               // Counted in this process since it started
+}
+
+// TenantStats is one tenant's part of Stats.
+type TenantStats struct {
+	Groups   int `json:"groups"`
+	Sessions int `json:"sessions"`
+	Counters int `json:"counters"` // Device counters tracked
+}
+
+// Stats returns the current Stats. It reports sessions as stored, so a
+// session past its deadline counts as running until it is next accessed.
+func (c *Coordinator) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	st := Stats{
+		Tenants:   len(c.tenants),
+		States:    make(map[string]int),
+		ByTenant:  make(map[string]TenantStats, len(c.tenants)),
+		Retention: c.retention.String(),
+		Ops:       frostcore.ReadOps(),
+	}
+	for name, ts := range c.tenants {
+		st.Groups += len(ts.groups)
+		st.Sessions += len(ts.sessions)
+		st.ByTenant[name] = TenantStats{
+			Groups:   len(ts.groups),
+			Sessions: len(ts.sessions),
+			Counters: len(ts.counters),
+		}
+		for _, s := range ts.sessions {
+			st.States[s.State]++
+			if s.ended.IsZero() && (st.Stalest == nil || s.PhaseStarted.Before(*st.Stalest)) {
+				t := s.PhaseStarted
+				st.Stalest = &t
+			}
+		}
+	}
+	return st
+}
+
+// prune drops the tenant's sessions that ended more than the retention ago.
+// Sessions that time out are only noticed when accessed, so an abandoned
+// session is dropped once a later access or prune expires it. Callers hold
+// c.mu.
+func (c *Coordinator) prune(st *tenantStore, now time.Time) {
+	if c.retention == 0 {
+		return
+	}
+	for id, s := range st.sessions {
+		if s.timedOut == nil {
+			s.expire(now)
+		}
+		if !s.ended.IsZero() && now.Sub(s.ended) > c.retention {
+			delete(st.sessions, id)
+		}
+	}
+}
+
+// AddGroup registers a group-state document for single-tenant deployments
+// (the default tenant ""). Sessions can only be created for registered
+// groups, and not while the group is frozen.
+func (c *Coordinator) AddGroup(doc *groupstate.Document) {
+	c.AddTenantGroup("", doc)
+}
+
+// AddTenantGroup registers a group-state document for one tenant. The same
+// group may be registered by several tenants; their sessions stay separate.
+func (c *Coordinator) AddTenantGroup(tenant string, doc *groupstate.Document) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	st, ok := c.tenants[tenant]
+	if !ok {
+		st = &tenantStore{
+			groups:   make(map[string]*groupstate.Document),
+			sessions: make(map[string]*Session),
+			counters: make(map[counterKey]uint64),
+		}
+		c.tenants[tenant] = st
+	}
+	st.groups[doc.GroupKey] = doc
+}
+
+// ActionParams is the apply_action body.
+type ActionParams struct {
+	GroupKey string            `json:"group_key"`
+	Action   groupstate.Action `json:"action"` // Signed by the group
+}
+
+// applyAction applies a group-state action to the tenant's copy of the
+// group's document, so a freeze or a failover signed by the group reaches
+// the coordinator without a restart. The signature is the authorization:
+// any authenticated caller may deliver it.
+func (c *Coordinator) applyAction(tenant string, p *ActionParams) (*groupstate.Document, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	st, ok := c.tenants[tenant]
+	if !ok || st.groups[p.GroupKey] == nil {
+		return nil, Errorf(CodeNotFound, "unknown group %s", p.GroupKey)
+	}
+	doc := st.groups[p.GroupKey]
+	if p.Action.Sequence != doc.Sequence+1 {
+		return nil, Errorf(CodeConflict, "action sequence %d, the group is at %d", p.Action.Sequence, doc.Sequence)
+	}
+
+	// The document may be the one AddGroup was given, so apply to a copy
+	next := *doc
+	next.History = slices.Clone(doc.History)
+	next.Failovers = maps.Clone(doc.Failovers)
+	next.Retired = maps.Clone(doc.Retired)
+	if err := next.Apply(&p.Action); err != nil {
+		return nil, Errorf(CodeForbidden, "rejected %s action: %v", p.Action.Op, err)
+	}
+	st.groups[p.GroupKey] = &next
+	return &next, nil
+}
+
+// RetireParams is the retire_participant body.
+type RetireParams struct {
+	GroupKey string                 `json:"group_key"`
+	Record   groupstate.Destruction `json:"record"` // Signed with the participant's share
+}
+
+// retireParticipant records in the tenant's copy of the group's document
+// that a participant destroyed its share, so that no new session takes it
+// as a signer and no open one takes its commitment. As with applyAction, the
+// record's signature is the authorization.
+func (c *Coordinator) retireParticipant(tenant string, p *RetireParams) (*groupstate.Document, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	st, ok := c.tenants[tenant]
+	if !ok || st.groups[p.GroupKey] == nil {
+		return nil, Errorf(CodeNotFound, "unknown group %s", p.GroupKey)
+	}
+	doc := st.groups[p.GroupKey]
+	next := *doc
+	next.Retired = maps.Clone(doc.Retired)
+	if err := next.Retire(&p.Record); err != nil {
+		return nil, Errorf(CodeForbidden, "rejected destruction record of participant %d: %v", p.Record.Participant, err)
+	}
+	st.groups[p.GroupKey] = &next
+	c.notify()
+	return &next, nil
+}
+
+// session looks up a session in the tenant's store and expires it if its
+// phase is overdue, recording the signers that missed it. Callers hold c.mu.
+func (c *Coordinator) session(tenant, id string) (*Session, error) {
+	if st, ok := c.tenants[tenant]; ok {
+		if s, ok := st.sessions[id]; ok {
+			if s.timedOut == nil {
+				s.expire(c.clock.Now())
+				if s.timedOut != nil {
+					c.notify()
+					for _, missed := range s.timedOut.Missing {
+						c.record(s, missed, EventMissed, 0, s.timedOut.Unwrap().Error())
+					}
+				}
+			}
+			return s, nil
+		}
+	}
+	return nil, Errorf(CodeNotFound, "unknown session %q", id)
+}
+
+// Handle dispatches a request to the operation it names.
+func (c *Coordinator) Handle(ctx context.Context, req *Request) (*Response, error) {
+	switch req.Op {
+	case OpCreateSession:
+		var p CreateSessionParams
+		if err := req.Decode(&p); err != nil {
+			return nil, err
+		}
+		s, err := c.createSession(req.Tenant, &p)
+		if err != nil {
+			return nil, err
+		}
+		return &Response{Body: s}, nil
+
+	case OpGetSession:
+		s, err := c.snapshot(req.Tenant, req.SessionID)
+		if err != nil {
+			return nil, err
+		}
+		return &Response{Body: s}, nil
+
+	case OpSubmitCommitment:
+		var p CommitmentParams
+		if err := req.Decode(&p); err != nil {
+			return nil, err
+		}
+		s, err := c.submitCommitment(req.Tenant, req.SessionID, &p)
+		if err != nil {
+			return nil, err
+		}
+		return &Response{Body: s}, nil
+
+	case OpSubmitPartial:
+		var p PartialParams
+		if err := req.Decode(&p); err != nil {
+			return nil, err
+		}
+		s, err := c.submitPartial(req.Tenant, req.SessionID, &p)
+		if err != nil {
+			return nil, err
+		}
+		return &Response{Body: s}, nil
+
+	case OpRestartSession:
+		var p RestartParams
+		if len(req.Body) > 0 {
+			if err := req.Decode(&p); err != nil {
+				return nil, err
+			}
+		}
+		s, err := c.restartSession(req.Tenant, req.SessionID, &p)
+		if err != nil {
+			return nil, err
+		}
+		return &Response{Body: s}, nil
+
+	case OpGetResult:
+		s, err := c.snapshot(req.Tenant, req.SessionID)
+		if err != nil {
+			return nil, err
+		}
+		if s.timedOut != nil {
+			return nil, s.timedOut
+		}
+		if s.Result == nil {
+			return nil, Errorf(CodeConflict, "session %s has no result yet (state %s)", s.ID, s.State)
+		}
+		return &Response{Body: s.Result}, nil
+
+	case OpApplyAction:
+		var p ActionParams
+		if err := req.Decode(&p); err != nil {
+			return nil, err
+		}
+		doc, err := c.applyAction(req.Tenant, &p)
+		if err != nil {
+			return nil, err
+		}
+		return &Response{Body: doc}, nil
+
+	case OpRetireParticipant:
+		var p RetireParams
+		if err := req.Decode(&p); err != nil {
+			return nil, err
+		}
+		doc, err := c.retireParticipant(req.Tenant, &p)
+		if err != nil {
+			return nil, err
+		}
+		return &Response{Body: doc}, nil
+
+	case OpGetReliability:
+		var p ReliabilityParams
+		if err := req.Decode(&p); err != nil {
+			return nil, err
+		}
+		report, err := c.reliabilityReport(req.Tenant, &p)
+		if err != nil {
+			return nil, err
+		}
+		return &Response{Body: report}, nil
+
+	case OpListParticipants, OpListCommitments:
+		var p PageParams
+		if len(req.Body) > 0 {
+			if err := req.Decode(&p); err != nil {
+				return nil, err
+			}
+		}
+		if req.Op == OpListParticipants {
+			page, err := c.listParticipants(req.Tenant, &p)
+			if err != nil {
+				return nil, err
+			}
+			return &Response{Body: page}, nil
+		}
+		page, err := c.listCommitments(req.Tenant, req.SessionID, &p)
+		if err != nil {
+			return nil, err
+		}
+		return &Response{Body: page}, nil
+	}
+	return nil, Errorf(CodeBadRequest, "unknown operation %q", req.Op)
+}
+
+func (c *Coordinator) createSession(tenant string, p *CreateSessionParams) (*Session, error) {
+	if msg, err := hex.DecodeString(p.MessageHash); err != nil || len(msg) != 32 {
+		return nil, Errorf(CodeBadRequest, "message_hash: expected 32 bytes of hex")
+	}
+	if _, err := frostcore.ParsePoint("group_key", p.GroupKey); err != nil {
+		return nil, Errorf(CodeBadRequest, "%v", err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	st, ok := c.tenants[tenant]
+	if !ok {
+		return nil, Errorf(CodeNotFound, "unknown group %s", p.GroupKey)
+	}
+	doc, ok := st.groups[p.GroupKey]
+	if !ok {
+		return nil, Errorf(CodeNotFound, "unknown group %s", p.GroupKey)
+	}
+	if err := doc.CheckActive(); err != nil {
+		return nil, Errorf(CodeForbidden, "%v", err)
+	}
+	if p.Purpose != "" && p.Purpose != doc.Purpose {
+		return nil, Errorf(CodeForbidden, "purpose %q: the group's shares are provisioned for %s", p.Purpose, purposeName(doc.Purpose))
+	}
+
+	signers := append([]int(nil), p.Signers...)
+	sort.Ints(signers)
+	if len(signers) < doc.Threshold {
+		return nil, Errorf(CodeBadRequest, "%d signers, group threshold is %d", len(signers), doc.Threshold)
+	}
+	for i, id := range signers {
+		if id < 1 || id > doc.Total {
+			return nil, Errorf(CodeBadRequest, "signer %d is not a participant of this group", id)
+		}
+		if i > 0 && signers[i-1] == id {
+			return nil, Errorf(CodeBadRequest, "duplicate signer %d", id)
+		}
+	}
+	if err := doc.CheckSigners(signers); err != nil {
+		return nil, Errorf(CodeForbidden, "%v", err)
+	}
+
+	var signerTimeouts map[int]Timeouts
+	timeouts := c.timeouts.merge(p.Timeouts)
+	for id, t := range p.SignerTimeouts {
+		if i := sort.SearchInts(signers, id); i == len(signers) || signers[i] != id {
+			return nil, Errorf(CodeBadRequest, "signer_timeouts: %d is not a signer", id)
+		}
+		if t != nil && t.Aggregation != 0 {
+			return nil, Errorf(CodeBadRequest, "signer_timeouts: aggregation is timed per session")
+		}
+		if signerTimeouts == nil {
+			signerTimeouts = make(map[int]Timeouts)
+		}
+		signerTimeouts[id] = timeouts.merge(t)
+	}
+
+	s := &Session{
+		ID:          newSessionID(),
+		Tenant:      tenant,
+		GroupKey:    p.GroupKey,
+		MessageHash: p.MessageHash,
+		Purpose:     doc.Purpose,
+		Intent:      IntentHash(p.GroupKey, p.MessageHash),
+		Signers:     signers,
+		State:       StateCollectingCommitments,
+		Commitments: make(map[int]CommitmentParams),
+		Partials:    make(map[int]string),
+		Approvals:   make(map[int]string),
+		Counters:    make(map[int]uint64),
+
+		RequireDeviceApproval:   p.RequireDeviceApproval,
+		RequireCommitmentProofs: p.RequireCommitmentProofs || c.proofs,
+		Timeouts:                timeouts,
+		SignerTimeouts:          signerTimeouts,
+		Accounting:              doc.Accounting.Merge(p.Accounting),
+	}
+	now := c.clock.Now()
+	s.startPhase(PhaseCommitments, now)
+	c.prune(st, now)
+	st.sessions[s.ID] = s
+	for _, id := range signers {
+		c.record(s, id, EventSelected, 0, "")
+	}
+	c.notify()
+	return s.copy(), nil
+}
+
+func (c *Coordinator) snapshot(tenant, id string) (*Session, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s, err := c.session(tenant, id)
+	if err != nil {
+		return nil, err
+	}
+	return s.copy(), nil
+}
+
+func (c *Coordinator) submitCommitment(tenant, id string, p *CommitmentParams) (*Session, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	s, err := c.session(tenant, id)
+	if err != nil {
+		return nil, err
+	}
+	mark := frostcore.ReadOps()
+	defer s.tally(&mark)
+	if s.timedOut != nil {
+		return nil, s.timedOut
+	}
+	if s.State != StateCollectingCommitments {
+		return nil, Errorf(CodeConflict, "session %s is not collecting commitments (state %s)", id, s.State)
+	}
+	if !s.isSigner(p.ID) {
+		return nil, Errorf(CodeForbidden, "participant %d is not a signer in session %s", p.ID, id)
+	}
+	if prev, dup := s.Commitments[p.ID]; dup {
+		err := Errorf(CodeConflict, "participant %d already committed", p.ID)
+		if prev.HidingCommit != p.HidingCommit || prev.BindingCommit != p.BindingCommit {
+			c.record(s, p.ID, EventEquivocated, 0, "different commitment")
+			s.checked(p.ID, err, c.clock.Now())
+			c.notify()
+		}
+		return nil, err
+	}
+	if err := c.checkCommitment(tenant, s, p); err != nil {
+		s.checked(p.ID, err, c.clock.Now())
+		c.notify()
+		return nil, err
+	}
+
+	now := c.clock.Now()
+	s.checked(p.ID, nil, now)
+	s.Commitments[p.ID] = *p
+	s.arrivals = append(s.arrivals, p.ID)
+	s.submitted(p.ID)
+	c.record(s, p.ID, EventCommitted, now.Sub(s.PhaseStarted), "")
+	s.collectPartials(now)
+	s.tally(&mark)
+	c.notify()
+	return s.copy(), nil
+}
+
+// checkCommitment checks a signer's first commitment as it arrives: that
+// the group is still registered and active and has the signer's public
+// share, that the points decode to prime-order points and are not another
+// signer's, and that the proof verifies. Callers hold c.mu.
+func (c *Coordinator) checkCommitment(tenant string, s *Session, p *CommitmentParams) error {
+	// The group may have been frozen since the session was created
+	doc := c.tenants[tenant].groups[s.GroupKey]
+	if doc == nil {
+		return Errorf(CodeForbidden, "group %s is no longer registered", s.GroupKey)
+	}
+	if err := doc.CheckActive(); err != nil {
+		return Errorf(CodeForbidden, "%v", err)
+	}
+	if p.ID > doc.Total || p.ID > len(doc.PublicShares) || doc.PublicShares[p.ID-1] == "" {
+		return Errorf(CodeForbidden, "participant %d has no public share in group %s", p.ID, s.GroupKey)
+	}
+	// Or the participant destroyed its share since
+	if err := doc.CheckSigners([]int{p.ID}); err != nil {
+		return Errorf(CodeForbidden, "%v", err)
+	}
+
+	// Low-order and identity commitments are rejected here, before they
+	// can be folded into the group commitment
+	if _, err := frostcore.ParsePoint("hiding_commit", p.HidingCommit); err != nil {
+		c.record(s, p.ID, EventBadCommitment, 0, err.Error())
+		return Errorf(CodeBadRequest, "participant %d: %v", p.ID, err)
+	}
+	if _, err := frostcore.ParsePoint("binding_commit", p.BindingCommit); err != nil {
+		c.record(s, p.ID, EventBadCommitment, 0, err.Error())
+		return Errorf(CodeBadRequest, "participant %d: %v", p.ID, err)
+	}
+	if strings.EqualFold(p.HidingCommit, p.BindingCommit) {
+		c.record(s, p.ID, EventBadCommitment, 0, "hiding and binding commitments are equal")
+		return Errorf(CodeBadRequest, "participant %d: hiding and binding commitments are equal", p.ID)
+	}
+	// A commitment point copied from another signer cannot be opened by
+	// the submitter, and would leave the session to fail at aggregation
+	for other, q := range s.Commitments {
+		for _, point := range []string{p.HidingCommit, p.BindingCommit} {
+			if strings.EqualFold(point, q.HidingCommit) || strings.EqualFold(point, q.BindingCommit) {
+				detail := fmt.Sprintf("commitment point %s is participant %d's", point, other)
+				c.record(s, p.ID, EventBadCommitment, 0, detail)
+				return Errorf(CodeConflict, "participant %d: %s", p.ID, detail)
+			}
+		}
+	}
+
+	if p.Proof == "" && s.RequireCommitmentProofs {
+		return Errorf(CodeForbidden, "session %s requires a proof of knowledge of the commitment nonces", s.ID)
+	}
+	if p.Proof != "" {
+		if err := s.verifyCommitmentProof(p); err != nil {
+			c.record(s, p.ID, EventInvalidProof, 0, err.Error())
+			return Errorf(CodeForbidden, "participant %d: commitment proof does not verify: %v", p.ID, err)
+		}
+	}
+	return nil
+}
+
+// checked appends the verdict on a signer's commitment to the session's
+// commitment_checks, dropping the oldest past maxCommitmentChecks.
+func (s *Session) checked(id int, err error, now time.Time) {
+	check := CommitmentCheck{ID: id, Accepted: err == nil, Time: now.UTC()}
+	if err != nil {
+		check.Code, check.Error = CodeOf(err), err.Error()
+	}
+	s.CommitmentChecks = append(s.CommitmentChecks, check)
+	if n := len(s.CommitmentChecks); n > maxCommitmentChecks {
+		s.CommitmentChecks = slices.Clone(s.CommitmentChecks[n-maxCommitmentChecks:])
+	}
+}
+
+// collectPartials moves the session on to partial signatures once every
+// signer has committed.
+func (s *Session) collectPartials(now time.Time) {
+	if len(s.Commitments) < len(s.Signers) {
+		return
+	}
+	s.State = StateCollectingPartials
+	if s.needsApproval() {
+		s.startPhase(PhaseApproval, now)
+	} else {
+		s.startPhase(PhasePartials, now)
+	}
+}
+
+func (c *Coordinator) submitPartial(tenant, id string, p *PartialParams) (*Session, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	s, err := c.session(tenant, id)
+	if err != nil {
+		return nil, err
+	}
+	mark := frostcore.ReadOps()
+	defer s.tally(&mark)
+	if s.timedOut != nil {
+		return nil, s.timedOut
+	}
+	if s.State != StateCollectingPartials {
+		return nil, Errorf(CodeConflict, "session %s is not collecting partial signatures (state %s)", id, s.State)
+	}
+	if !s.isSigner(p.ID) {
+		return nil, Errorf(CodeForbidden, "participant %d is not a signer in session %s", p.ID, id)
+	}
+	if prev, dup := s.Partials[p.ID]; dup {
+		if prev != p.PartialSig {
+			c.record(s, p.ID, EventEquivocated, 0, "different partial signature")
+		}
+		return nil, Errorf(CodeConflict, "participant %d already submitted a partial signature", p.ID)
+	}
+	if b, err := hex.DecodeString(p.PartialSig); err != nil || len(b) != frostcore.ScalarSize {
+		return nil, Errorf(CodeBadRequest, "partial_sig: expected %d bytes of hex", frostcore.ScalarSize)
+	}
+	if s.RequireDeviceApproval && p.Approval != apdu.ApprovalDevice {
+		approval := p.Approval
+		if approval == "" {
+			approval = "none"
+		}
+		return nil, Errorf(CodeForbidden, "session %s requires on-device approval, participant %d reports %s", id, p.ID, approval)
+	}
+
+	s.Partials[p.ID] = p.PartialSig
+	s.submitted(p.ID)
+	c.record(s, p.ID, EventSigned, c.clock.Now().Sub(s.PhaseStarted), "")
+	if p.Approval != "" {
+		s.Approvals[p.ID] = p.Approval
+	}
+	if p.Counter != nil {
+		// Flagged rather than rejected: the signature itself is valid, and
+		// the operator decides whether the device is compromised
+		st := c.tenants[tenant]
+		key := counterKey{s.GroupKey, p.ID}
+		if prev, ok := st.counters[key]; ok && *p.Counter <= prev {
+			s.CounterRegressions = append(s.CounterRegressions, CounterRegression{ID: p.ID, Previous: prev, Reported: *p.Counter})
+			c.record(s, p.ID, EventCounterRegression, 0, fmt.Sprintf("counter %d after %d", *p.Counter, prev))
+		} else {
+			st.counters[key] = *p.Counter
+		}
+		s.Counters[p.ID] = *p.Counter
+	}
+	if len(s.Partials) == len(s.Signers) {
+		s.startPhase(PhaseAggregation, c.clock.Now())
+		result, err := s.aggregateWithin(s.Timeouts.of(PhaseAggregation), c.clock)
+		switch {
+		case errors.Is(err, ErrAggregationTimeout):
+			s.timeout(PhaseAggregation, nil, c.clock.Now())
+		case err != nil:
+			s.State = StateFailed
+			s.Error = err.Error()
+		default:
+			s.Result = result
+			s.State = StateComplete
+			if !result.Valid {
+				c.blame(s)
+			}
+		}
+		s.ended = c.clock.Now()
+		s.Deadline = nil
+	}
+	s.tally(&mark)
+	c.notify()
+	return s.copy(), nil
+}
+
+// tally adds the operations counted since *mark to the session and moves
+// *mark on. The counts are process-wide, but the coordinator does its
+// cryptography under c.mu, which callers hold, so in a process that does no
+// other they are the session's alone.
+func (s *Session) tally(mark *frostcore.Ops) {
+	now := frostcore.ReadOps()
+	s.Ops = s.Ops.Add(now.Sub(*mark))
+	*mark = now
+}
+
+// aggregateWithin aggregates, giving up after d (if non-zero) on clk. The
+// session is only read, so an abandoned aggregation cannot touch it
+// afterwards.
+func (s *Session) aggregateWithin(d time.Duration, clk clock.Clock) (*Result, error) {
+	if d == 0 {
+		return s.aggregate()
+	}
+	type outcome struct {
+		result *Result
+		err    error
+	}
+	done := make(chan outcome, 1)
+	snapshot := s.copy()
+	go func() {
+		r, err := snapshot.aggregate()
+		done <- outcome{r, err}
+	}()
+	timer := clk.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case o := <-done:
+		return o.result, o.err
+	case <-timer.C():
+		return nil, ErrAggregationTimeout
+	}
+}
+
+// CommitmentList returns the session's commitments ordered by participant ID,
+// in the form used for binding factors.
+func (s *Session) CommitmentList() []frostcore.Commitment {
+	list := make([]frostcore.Commitment, 0, len(s.Signers))
+	for _, id := range s.Signers {
+		cm, ok := s.Commitments[id]
+		if !ok {
+			continue
+		}
+		hiding, _ := hex.DecodeString(cm.HidingCommit)
+		binding, _ := hex.DecodeString(cm.BindingCommit)
+		list = append(list, frostcore.Commitment{
+			ID:      frostcore.IDBytes(uint16(id)),
+			Hiding:  hiding,
+			Binding: binding,
+		})
+	}
+	return list
+}
+
+func (s *Session) aggregate() (*Result, error) {
+	msg, _ := hex.DecodeString(s.MessageHash)
+	groupKey, err := hex.DecodeString(s.GroupKey)
+	if err != nil {
+		return nil, err
+	}
+
+	list := s.CommitmentList()
+	rhos := frostcore.BindingFactors(msg, list)
+	r, err := frostcore.GroupCommitment(list, rhos)
+	if err != nil {
+		return nil, err
+	}
+
+	z := new(big.Int)
+	for _, id := range s.Signers {
+		b, _ := hex.DecodeString(s.Partials[id])
+		z.Add(z, frostcore.ScalarFromBytes(b))
+	}
+	zBytes := frostcore.ScalarBytes(z)
+
+	valid, err := frostcore.VerifyPurpose(s.Purpose, groupKey, msg, r, zBytes)
+	if err != nil {
+		return nil, err
+	}
+	return &Result{
+		R:     hex.EncodeToString(r),
+		Z:     hex.EncodeToString(zBytes),
+		Valid: valid,
+	}, nil
+}
+
+// verifyCommitmentProof checks a commitment's proof of knowledge against
+// this session's context.
+func (s *Session) verifyCommitmentProof(p *CommitmentParams) error {
+	b, err := hex.DecodeString(p.Proof)
+	if err != nil {
+		return err
+	}
+	proof, err := frostcore.ParseNonceProof(b)
+	if err != nil {
+		return err
+	}
+	hiding, _ := hex.DecodeString(p.HidingCommit)
+	binding, _ := hex.DecodeString(p.BindingCommit)
+	msg, _ := hex.DecodeString(s.MessageHash)
+	return proof.VerifyNonces(uint16(p.ID), hiding, binding, frostcore.NonceProofContext(s.ID, msg))
+}
+
+func (s *Session) isSigner(id int) bool {
+	for _, signer := range s.Signers {
+		if signer == id {
+			return true
+		}
+	}
+	return false
+}
+
+// copy returns a snapshot safe to hand out while the lock is released.
+func (s *Session) copy() *Session {
+	out := *s
+	out.Signers = append([]int(nil), s.Signers...)
+	out.arrivals = append([]int(nil), s.arrivals...)
+	out.Commitments = make(map[int]CommitmentParams, len(s.Commitments))
+	for k, v := range s.Commitments {
+		out.Commitments[k] = v
+	}
+	out.Partials = make(map[int]string, len(s.Partials))
+	for k, v := range s.Partials {
+		out.Partials[k] = v
+	}
+	out.Approvals = make(map[int]string, len(s.Approvals))
+	for k, v := range s.Approvals {
+		out.Approvals[k] = v
+	}
+	out.Counters = make(map[int]uint64, len(s.Counters))
+	for k, v := range s.Counters {
+		out.Counters[k] = v
+	}
+	out.CounterRegressions = append([]CounterRegression(nil), s.CounterRegressions...)
+	out.CommitmentChecks = append([]CommitmentCheck(nil), s.CommitmentChecks...)
+	if s.Result != nil {
+		r := *s.Result
+		out.Result = &r
+	}
+	if s.Deadline != nil {
+		d := *s.Deadline
+		out.Deadline = &d
+	}
+	if s.SignerTimeouts != nil {
+		out.SignerTimeouts = make(map[int]Timeouts, len(s.SignerTimeouts))
+		for k, v := range s.SignerTimeouts {
+			out.SignerTimeouts[k] = v
+		}
+	}
+	if s.SignerDeadlines != nil {
+		out.SignerDeadlines = make(map[int]time.Time, len(s.SignerDeadlines))
+		for k, v := range s.SignerDeadlines {
+			out.SignerDeadlines[k] = v
+		}
+	}
+	if s.Salvaged != nil {
+		out.Salvaged = make(map[int]string, len(s.Salvaged))
+		for k, v := range s.Salvaged {
+			out.Salvaged[k] = v
+		}
+	}
+	out.Accounting = s.Accounting.Merge(nil)
+	return &out
+}
+
+func newSessionID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,298 @@
+package coordinator
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxBodySize bounds request bodies; the largest, create_session for a large
+// group, is a few kilobytes.
+const maxBodySize = 64 << 10
+
+// route maps an operation to its HTTP method and path. {id} is the session
+// ID and {group_key} the group of list_participants and get_reliability.
+type route struct {
+	op, method, pattern string
+}
+
+var routes = []route{
+	{OpCreateSession, http.MethodPost, "/v1/sessions"},
+	{OpGetSession, http.MethodGet, "/v1/sessions/{id}"},
+	{OpSubmitCommitment, http.MethodPost, "/v1/sessions/{id}/commitments"},
+	{OpListCommitments, http.MethodGet, "/v1/sessions/{id}/commitments"},
+	{OpSubmitPartial, http.MethodPost, "/v1/sessions/{id}/partials"},
+	{OpGetResult, http.MethodGet, "/v1/sessions/{id}/result"},
+	{OpRestartSession, http.MethodPost, "/v1/sessions/{id}/restart"},
+	{OpListParticipants, http.MethodGet, "/v1/groups/{group_key}/participants"},
+	{OpGetReliability, http.MethodGet, "/v1/groups/{group_key}/reliability"},
+	{OpApplyAction, http.MethodPost, "/v1/groups/{group_key}/actions"},
+	{OpRetireParticipant, http.MethodPost, "/v1/groups/{group_key}/retirements"},
+}
+
+// HTTPError is the body of an error response.
+type HTTPError struct {
+	Code    string `json:"code"` // Code.String()
+	Error   string `json:"error"`
+	Phase   Phase  `json:"phase,omitempty"`   // For timeout
+	After   string `json:"after,omitempty"`   // For timeout: the missing signers' timeout
+	Missing []int  `json:"missing,omitempty"` // For timeout
+}
+
+// HTTPHandler serves h as a REST API, so remote participants can take part
+// in sessions:
+//
+//	POST /v1/sessions                              create_session
+//	GET  /v1/sessions/{id}                         get_session
+//	POST /v1/sessions/{id}/commitments             submit_commitment
+//	GET  /v1/sessions/{id}/commitments             list_commitments (?limit=&token=)
+//	POST /v1/sessions/{id}/partials                submit_partial
+//	GET  /v1/sessions/{id}/result                  get_result
+//	POST /v1/sessions/{id}/restart                 restart_session
+//	GET  /v1/groups/{group_key}/participants       list_participants (?limit=&token=)
+//	GET  /v1/groups/{group_key}/reliability        get_reliability
+//	POST /v1/groups/{group_key}/actions            apply_action
+//	POST /v1/groups/{group_key}/retirements        retire_participant
+//
+// POST bodies are the operation's parameters. The bearer token of the
+// Authorization header is the request's Credential, and the remote address,
+// user agent and verified client certificate (MetaClientCert) go in Meta;
+// authentication is left to h's middleware.
+// Errors are an HTTPError with the status of their code.
+func HTTPHandler(h Handler) http.Handler {
+	mux := http.NewServeMux()
+	for _, rt := range routes {
+		mux.HandleFunc(rt.method+" "+rt.pattern, func(w http.ResponseWriter, r *http.Request) {
+			req := &Request{
+				Op:         rt.op,
+				SessionID:  r.PathValue("id"),
+				Credential: bearerToken(r),
+				Meta: map[string]string{
+					"remote_addr": r.RemoteAddr,
+					"user_agent":  r.UserAgent(),
+				},
+			}
+			if name := clientCertName(r); name != "" {
+				req.Meta[MetaClientCert] = name
+			}
+			body, err := requestBody(w, r, rt.op)
+			if err != nil {
+				writeHTTPError(w, err)
+				return
+			}
+			req.Body = body
+
+			resp, err := h.Handle(r.Context(), req)
+			if err != nil {
+				writeHTTPError(w, err)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(resp.Body)
+		})
+	}
+	return mux
+}
+
+// requestBody returns the operation's parameters: the POST body, or for GET
+// routes those taken from the path and query.
+func requestBody(w http.ResponseWriter, r *http.Request, op string) (json.RawMessage, error) {
+	if r.Method == http.MethodPost {
+		b, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodySize))
+		if err != nil {
+			return nil, Errorf(CodeBadRequest, "%s: %v", op, err)
+		}
+		if groupKey := r.PathValue("group_key"); groupKey != "" {
+			var p struct {
+				GroupKey string `json:"group_key"`
+			}
+			if json.Unmarshal(b, &p) != nil || p.GroupKey != groupKey {
+				return nil, Errorf(CodeBadRequest, "%s: group_key of the body does not match the path", op)
+			}
+		}
+		return b, nil
+	}
+
+	switch op {
+	case OpListParticipants, OpListCommitments:
+		p := PageParams{GroupKey: r.PathValue("group_key"), Token: r.URL.Query().Get("token")}
+		if s := r.URL.Query().Get("limit"); s != "" {
+			limit, err := strconv.Atoi(s)
+			if err != nil {
+				return nil, Errorf(CodeBadRequest, "%s: limit: %v", op, err)
+			}
+			p.Limit = limit
+		}
+		return json.Marshal(p)
+	case OpGetReliability:
+		return json.Marshal(ReliabilityParams{GroupKey: r.PathValue("group_key")})
+	}
+	return nil, nil
+}
+
+func bearerToken(r *http.Request) string {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
+
+// httpStatus maps a code to its HTTP status.
+func httpStatus(code Code) int {
+	switch code {
+	case CodeBadRequest:
+		return http.StatusBadRequest
+	case CodeUnauthenticated:
+		return http.StatusUnauthorized
+	case CodeForbidden:
+		return http.StatusForbidden
+	case CodeNotFound:
+		return http.StatusNotFound
+	case CodeConflict:
+		return http.StatusConflict
+	case CodeRateLimited:
+		return http.StatusTooManyRequests
+	case CodeTimeout:
+		return http.StatusGone // The session is over; start a new one
+	}
+	return http.StatusInternalServerError
+}
+
+func writeHTTPError(w http.ResponseWriter, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(httpStatus(CodeOf(err)))
+	json.NewEncoder(w).Encode(errorBody(err))
+}
+
+// errorBody describes err as transports send it.
+func errorBody(err error) *HTTPError {
+	body := &HTTPError{Code: CodeOf(err).String(), Error: err.Error()}
+	var t *TimeoutError
+	if errors.As(err, &t) {
+		body.Phase, body.After, body.Missing = t.Phase, t.After.String(), t.Missing
+	}
+	return body
+}
+
+// parseCode is the inverse of Code.String.
+func parseCode(s string) Code {
+	for c := CodeBadRequest; c <= CodeTimeout; c++ {
+		if c.String() == s {
+			return c
+		}
+	}
+	return CodeInternal
+}
+
+// Client is a Handler that sends requests to a coordinator served by
+// HTTPHandler, so Go clients (Registry, CommitmentSet, participants) work
+// the same against a remote coordinator as against an in-process one.
+// Response bodies are returned as json.RawMessage. Errors come back as an
+// *Error with the server's code, or a *TimeoutError.
+type Client struct {
+	URL   string       // Base URL, e.g. https://coord.example
+	Token string       // Bearer token, unless the request has a Credential
+	HTTP  *http.Client // nil uses http.DefaultClient
+}
+
+// Handle sends req to the coordinator.
+func (c *Client) Handle(ctx context.Context, req *Request) (*Response, error) {
+	var rt *route
+	for i := range routes {
+		if routes[i].op == req.Op {
+			rt = &routes[i]
+		}
+	}
+	if rt == nil {
+		return nil, Errorf(CodeBadRequest, "unknown operation %q", req.Op)
+	}
+
+	path := strings.ReplaceAll(rt.pattern, "{id}", url.PathEscape(req.SessionID))
+	var body io.Reader
+	query := url.Values{}
+	switch {
+	case rt.method == http.MethodPost:
+		body = bytes.NewReader(req.Body)
+		if strings.Contains(path, "{group_key}") {
+			var p struct {
+				GroupKey string `json:"group_key"`
+			}
+			if err := req.Decode(&p); err != nil {
+				return nil, err
+			}
+			path = strings.ReplaceAll(path, "{group_key}", url.PathEscape(p.GroupKey))
+		}
+	case req.Op == OpListParticipants || req.Op == OpListCommitments || req.Op == OpGetReliability:
+		var p PageParams
+		if len(req.Body) > 0 {
+			if err := req.Decode(&p); err != nil {
+				return nil, err
+			}
+		}
+		path = strings.ReplaceAll(path, "{group_key}", url.PathEscape(p.GroupKey))
+		if p.Limit != 0 {
+			query.Set("limit", strconv.Itoa(p.Limit))
+		}
+		if p.Token != "" {
+			query.Set("token", p.Token)
+		}
+	}
+	u := strings.TrimSuffix(c.URL, "/") + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	hr, err := http.NewRequestWithContext(ctx, rt.method, u, body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		hr.Header.Set("Content-Type", "application/json")
+	}
+	token := req.Credential
+	if token == "" {
+		token = c.Token
+	}
+	if token != "" {
+		hr.Header.Set("Authorization", "Bearer "+token)
+	}
+	client := c.HTTP
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(hr)
+	if err != nil {
+		return nil, fmt.Errorf("coordinator: %w", err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 16<<20))
+	if err != nil {
+		return nil, fmt.Errorf("coordinator: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		var e HTTPError
+		if json.Unmarshal(data, &e) != nil || e.Code == "" {
+			return nil, Errorf(CodeInternal, "coordinator: HTTP %s: %s", resp.Status, bytes.TrimSpace(data))
+		}
+		code := parseCode(e.Code)
+		if code == CodeTimeout {
+			after, _ := time.ParseDuration(e.After)
+			return nil, &TimeoutError{Session: req.SessionID, Phase: e.Phase, After: after, Missing: e.Missing}
+		}
+		return nil, &Error{Code: code, Message: e.Error}
+	}
+	if !json.Valid(data) {
+		return nil, fmt.Errorf("coordinator: malformed response")
+	}
+	return &Response{Body: json.RawMessage(data)}, nil
+}
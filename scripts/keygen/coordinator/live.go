@@ -0,0 +1,364 @@
+package coordinator
+
+import (
+	"context"
+	"encoding/json"
+	"maps"
+	"net/http"
+	"time"
+
+	"keygen/clock"
+	"keygen/schema"
+)
+
+// Live sessions: a WebSocket transport for co-signers that cannot poll
+// comfortably, browsers and mobile apps. A client sends LiveRequests, the
+// coordinator's operations plus authenticate, watch and unwatch, and
+// receives a LiveMessage answering each, tagged with its seq. A watched
+// session is pushed to the client as a "session" message right away and
+// again whenever it changes, so the client learns the message, the
+// commitment roster once complete, and the result as they happen:
+//
+//	→ {"seq": 1, "op": "authenticate", "body": {"token": "…"}}
+//	← {"type": "response", "seq": 1}
+//	→ {"seq": 2, "op": "watch", "session_id": "3f9c…"}
+//	← {"type": "response", "seq": 2}
+//	← {"type": "session", "session_id": "3f9c…", "body": {"state": "collecting_commitments", …}}
+//	→ {"seq": 3, "op": "submit_commitment", "session_id": "3f9c…", "body": {"id": 2, …}}
+//	← {"type": "response", "seq": 3, "body": {…}}
+//	← {"type": "session", "session_id": "3f9c…", "body": {"state": "collecting_partials", …}}
+//
+// Every operation goes through the Handler, so the deployment's middleware
+// authenticates, limits and audits it as for any transport; watching a
+// session is a get_session on each change.
+
+// Live protocol operations, besides the coordinator's
+const (
+	LiveAuthenticate = "authenticate" // Body {"token"}: the credential of later requests
+	LiveWatch        = "watch"        // Push session_id now and whenever it changes
+	LiveUnwatch      = "unwatch"      // Stop pushing session_id
+)
+
+// Live message types
+const (
+	LiveResponse = "response" // Answers the request with the same seq
+	LiveError    = "error"    // A request failed, or a watched session can no longer be fetched
+	LiveSession  = "session"  // A watched session, as get_session returns it
+)
+
+const (
+	// maxLiveWatches bounds the sessions one connection watches.
+	maxLiveWatches = 16
+
+	// liveKeepalive is how often the coordinator pings a client; a client
+	// silent for twice as long is disconnected.
+	liveKeepalive = 30 * time.Second
+
+	// livePoll is how often watched sessions are fetched without a
+	// Notifier, or retried after being rate limited.
+	livePoll = 2 * time.Second
+)
+
+// LiveRequest is a message from a live client: a coordinator operation, or
+// one of the Live* operations.
+type LiveRequest struct {
+	Seq       int             `json:"seq,omitempty"` // Echoed in the answer
+	Op        string          `json:"op"`
+	SessionID string          `json:"session_id,omitempty"`
+	Body      json.RawMessage `json:"body,omitempty"`
+}
+
+// LiveMessage is a message to a live client.
+type LiveMessage struct {
+	Type      string     `json:"type"` // One of the Live* message types
+	Seq       int        `json:"seq,omitempty"`
+	SessionID string     `json:"session_id,omitempty"` // For pushed sessions and their errors
+	Body      any        `json:"body,omitempty"`
+	Error     *HTTPError `json:"error,omitempty"`
+}
+
+// Notifier tells a transport when sessions change. *Coordinator is one.
+type Notifier interface {
+	Changed() <-chan struct{}
+}
+
+// LiveHandler serves h to WebSocket clients (see LiveRequest). Watched
+// sessions are fetched again whenever n reports a change, and when one of
+// their deadlines passes so timeouts are pushed too; with a nil n, as for
+// a Client, they are polled. The credential is the bearer token of the
+// Authorization header, where the client can set one, or that of an
+// authenticate request; browsers cannot set headers on a WebSocket, and
+// taking the token in a message rather than a cookie means another site's
+// page cannot borrow a browser's session. Deadlines are waited for on n's
+// Clock, if it has one, as *Coordinator does.
+func LiveHandler(h Handler, n Notifier) http.Handler {
+	clk := clock.Real
+	if c, ok := n.(interface{ Clock() clock.Clock }); ok {
+		clk = c.Clock()
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws, err := wsUpgrade(w, r)
+		if err != nil {
+			return
+		}
+		defer ws.conn.Close()
+		ws.idle = 2 * liveKeepalive
+		l := &liveConn{
+			h:          h,
+			ws:         ws,
+			credential: bearerToken(r),
+			meta: map[string]string{
+				"remote_addr": r.RemoteAddr,
+				"user_agent":  r.UserAgent(),
+				"transport":   "websocket",
+			},
+			watched: make(map[string]*liveWatch),
+			clock:   clk,
+		}
+		if name := clientCertName(r); name != "" {
+			l.meta[MetaClientCert] = name
+		}
+		l.serve(r.Context(), n)
+	})
+}
+
+// liveConn is one live client.
+type liveConn struct {
+	h          Handler
+	ws         *wsConn
+	credential string
+	meta       map[string]string
+	watched    map[string]*liveWatch // By session ID
+	clock      clock.Clock
+}
+
+// liveWatch is a watched session.
+type liveWatch struct {
+	last []byte    // Last pushed, to skip unchanged sessions
+	wake time.Time // Next deadline or retry; zero if none
+}
+
+func (l *liveConn) serve(ctx context.Context, n Notifier) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	msgs := make(chan []byte)
+	go func() {
+		defer cancel()
+		for {
+			b, err := l.ws.readMessage(maxBodySize)
+			if err != nil {
+				return
+			}
+			select {
+			case msgs <- b:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var changed <-chan struct{}
+	if n != nil {
+		changed = n.Changed()
+	}
+	ping := time.NewTicker(liveKeepalive)
+	defer ping.Stop()
+	for {
+		var wake <-chan time.Time
+		var timer clock.Timer
+		if t := l.nextWake(n == nil); !t.IsZero() {
+			timer = l.clock.NewTimer(t.Sub(l.clock.Now()))
+			wake = timer.C()
+		}
+		var err error
+		select {
+		case <-ctx.Done():
+			return
+		case b := <-msgs:
+			err = l.handle(ctx, b)
+		case <-changed:
+			// Take the next channel first, so a change during the refresh
+			// is not missed
+			changed = n.Changed()
+			err = l.refresh(ctx)
+		case <-wake:
+			err = l.refresh(ctx)
+		case <-ping.C:
+			err = l.ws.writeFrame(wsPing, nil)
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// nextWake returns when a watched session should next be fetched without a
+// change reported: its earliest deadline or retry, or, when polling, the
+// next poll.
+func (l *liveConn) nextWake(poll bool) time.Time {
+	var next time.Time
+	for _, w := range l.watched {
+		t := w.wake
+		if poll && (t.IsZero() || t.Sub(l.clock.Now()) > livePoll) {
+			t = l.clock.Now().Add(livePoll)
+		}
+		if !t.IsZero() && (next.IsZero() || t.Before(next)) {
+			next = t
+		}
+	}
+	return next
+}
+
+// handle answers one client message. It returns an error only when the
+// connection is lost.
+func (l *liveConn) handle(ctx context.Context, b []byte) error {
+	var lr LiveRequest
+	if err := schema.Unmarshal(b, &lr, "live message"); err != nil {
+		return l.fail(0, "", Errorf(CodeBadRequest, "malformed message: %v", err))
+	}
+
+	switch lr.Op {
+	case LiveAuthenticate:
+		var p struct {
+			Token string `json:"token"`
+		}
+		if err := schema.Unmarshal(lr.Body, &p, lr.Op); err != nil || p.Token == "" {
+			return l.fail(lr.Seq, "", Errorf(CodeBadRequest, "%s: body must hold a token", lr.Op))
+		}
+		l.credential = p.Token
+		return l.send(&LiveMessage{Type: LiveResponse, Seq: lr.Seq})
+
+	case LiveWatch:
+		if _, ok := l.watched[lr.SessionID]; !ok && len(l.watched) == maxLiveWatches {
+			return l.fail(lr.Seq, "", Errorf(CodeBadRequest, "%s: already watching %d sessions", lr.Op, maxLiveWatches))
+		}
+		s, err := l.fetch(ctx, lr.SessionID)
+		if err != nil {
+			return l.fail(lr.Seq, "", err)
+		}
+		if err := l.send(&LiveMessage{Type: LiveResponse, Seq: lr.Seq}); err != nil {
+			return err
+		}
+		w := &liveWatch{}
+		l.watched[lr.SessionID] = w
+		return l.push(lr.SessionID, w, s)
+
+	case LiveUnwatch:
+		delete(l.watched, lr.SessionID)
+		return l.send(&LiveMessage{Type: LiveResponse, Seq: lr.Seq})
+	}
+
+	resp, err := l.h.Handle(ctx, &Request{
+		Op:         lr.Op,
+		SessionID:  lr.SessionID,
+		Body:       lr.Body,
+		Credential: l.credential,
+		Meta:       maps.Clone(l.meta),
+	})
+	if err != nil {
+		return l.fail(lr.Seq, "", err)
+	}
+	return l.send(&LiveMessage{Type: LiveResponse, Seq: lr.Seq, Body: resp.Body})
+}
+
+// refresh fetches the watched sessions that changed or are due and pushes
+// those that differ from what the client has. A session that can no longer
+// be fetched is reported and unwatched; one that is rate limited is retried
+// later.
+func (l *liveConn) refresh(ctx context.Context) error {
+	for id, w := range l.watched {
+		s, err := l.fetch(ctx, id)
+		if CodeOf(err) == CodeRateLimited {
+			w.wake = l.clock.Now().Add(livePoll)
+			continue
+		}
+		if err != nil {
+			delete(l.watched, id)
+			if err := l.fail(0, id, err); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := l.push(id, w, s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fetch gets a session through the handler, encoded.
+func (l *liveConn) fetch(ctx context.Context, id string) ([]byte, error) {
+	if id == "" {
+		return nil, Errorf(CodeBadRequest, "session_id is empty")
+	}
+	resp, err := l.h.Handle(ctx, &Request{Op: OpGetSession, SessionID: id, Credential: l.credential, Meta: maps.Clone(l.meta)})
+	if err != nil {
+		return nil, err
+	}
+	b, ok := resp.Body.(json.RawMessage)
+	if !ok {
+		if b, err = json.Marshal(resp.Body); err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+// push sends session s unless the client already has it, and works out
+// when to fetch it next. A finished session is unwatched once sent.
+func (l *liveConn) push(id string, w *liveWatch, s []byte) error {
+	var state struct {
+		State           string            `json:"state"`
+		TimedOut        Phase             `json:"timed_out"`
+		Deadline        *time.Time        `json:"deadline"`
+		SignerDeadlines map[int]time.Time `json:"signer_deadlines"`
+	}
+	if err := json.Unmarshal(s, &state); err != nil {
+		delete(l.watched, id)
+		return l.fail(0, id, Errorf(CodeInternal, "malformed session: %v", err))
+	}
+	if state.State == StateComplete || state.State == StateFailed || state.TimedOut != "" {
+		delete(l.watched, id)
+	}
+
+	// Timeouts are noticed when the session is next read, so read it just
+	// after the earliest deadline
+	w.wake = time.Time{}
+	if state.Deadline != nil {
+		w.wake = *state.Deadline
+	}
+	for _, t := range state.SignerDeadlines {
+		if w.wake.IsZero() || t.Before(w.wake) {
+			w.wake = t
+		}
+	}
+	if !w.wake.IsZero() {
+		// A deadline already past has not expired the session, so wait
+		// rather than read it again at once
+		if w.wake = w.wake.Add(100 * time.Millisecond); !w.wake.After(l.clock.Now()) {
+			w.wake = l.clock.Now().Add(livePoll)
+		}
+	}
+
+	if string(s) == string(w.last) {
+		return nil
+	}
+	w.last = s
+	return l.send(&LiveMessage{Type: LiveSession, SessionID: id, Body: json.RawMessage(s)})
+}
+
+// fail sends err as an error message.
+func (l *liveConn) fail(seq int, sessionID string, err error) error {
+	return l.send(&LiveMessage{Type: LiveError, Seq: seq, SessionID: sessionID, Error: errorBody(err)})
+}
+
+func (l *liveConn) send(m *LiveMessage) error {
+	b, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	return l.ws.writeFrame(wsText, b)
+}
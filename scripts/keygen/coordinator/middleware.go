@@ -0,0 +1,411 @@
+package coordinator
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"keygen/clock"
+	"keygen/groupstate"
+	"keygen/sandbox"
+)
+
+// ============================================================================
+// Auth
+// ============================================================================
+
+// Authenticator resolves the caller of a request.
+type Authenticator interface {
+	Authenticate(ctx context.Context, req *Request) (principal string, err error)
+}
+
+// StaticTokens authenticates bearer tokens from a fixed token -> principal map.
+type StaticTokens map[string]string
+
+func (t StaticTokens) Authenticate(ctx context.Context, req *Request) (string, error) {
+	if p, ok := lookupToken(t, req.Credential); ok {
+		return p, nil
+	}
+	return "", Errorf(CodeUnauthenticated, "invalid or missing credential")
+}
+
+// Identity is an authenticated caller within a tenant.
+type Identity struct {
+	Tenant    string
+	Principal string
+}
+
+// TenantAuthenticator is an Authenticator that also resolves the caller's
+// tenant. Auth prefers it when available.
+type TenantAuthenticator interface {
+	Authenticator
+	AuthenticateTenant(ctx context.Context, req *Request) (Identity, error)
+}
+
+// TenantTokens authenticates bearer tokens from a fixed token -> identity
+// map, giving each tenant its own credentials.
+type TenantTokens map[string]Identity
+
+func (t TenantTokens) Authenticate(ctx context.Context, req *Request) (string, error) {
+	id, err := t.AuthenticateTenant(ctx, req)
+	return id.Principal, err
+}
+
+func (t TenantTokens) AuthenticateTenant(ctx context.Context, req *Request) (Identity, error) {
+	if id, ok := lookupToken(t, req.Credential); ok {
+		return id, nil
+	}
+	return Identity{}, Errorf(CodeUnauthenticated, "invalid or missing credential")
+}
+
+// lookupToken finds credential among the tokens of m in constant time: every
+// token is compared, as SHA-256 hashes so that their lengths do not show
+// either, rather than looked up in the map.
+func lookupToken[V any](m map[string]V, credential string) (V, bool) {
+	var found V
+	match := 0
+	got := sha256.Sum256([]byte(credential))
+	for token, v := range m {
+		want := sha256.Sum256([]byte(token))
+		if subtle.ConstantTimeCompare(got[:], want[:]) == 1 {
+			found, match = v, 1
+		}
+	}
+	return found, match == 1 && credential != ""
+}
+
+// Auth rejects unauthenticated requests and sets req.Principal, and
+// req.Tenant for a TenantAuthenticator. Any tenant the transport put on the
+// request is overwritten, so callers cannot pick their own.
+func Auth(a Authenticator) Middleware {
+	return func(next Handler) Handler {
+		return HandlerFunc(func(ctx context.Context, req *Request) (*Response, error) {
+			req.Tenant = ""
+			if ta, ok := a.(TenantAuthenticator); ok {
+				id, err := ta.AuthenticateTenant(ctx, req)
+				if err != nil {
+					return nil, err
+				}
+				req.Tenant, req.Principal = id.Tenant, id.Principal
+				return next.Handle(ctx, req)
+			}
+
+			principal, err := a.Authenticate(ctx, req)
+			if err != nil {
+				return nil, err
+			}
+			req.Principal = principal
+			return next.Handle(ctx, req)
+		})
+	}
+}
+
+// ============================================================================
+// Rate limiting
+// ============================================================================
+
+// RateLimit applies a token bucket per principal (per tenant): rate requests
+// per second with bursts of up to burst requests.
+func RateLimit(rate float64, burst int) Middleware {
+	return RateLimitClock(rate, burst, clock.Real)
+}
+
+// RateLimitClock is RateLimit refilling the buckets by clk.
+func RateLimitClock(rate float64, burst int, clk clock.Clock) Middleware {
+	clk = clock.Or(clk)
+	type bucket struct {
+		tokens float64
+		last   time.Time
+	}
+	var mu sync.Mutex
+	buckets := make(map[string]*bucket)
+
+	return func(next Handler) Handler {
+		return HandlerFunc(func(ctx context.Context, req *Request) (*Response, error) {
+			now := clk.Now()
+			key := req.Tenant + "/" + req.Principal
+			mu.Lock()
+			b, ok := buckets[key]
+			if !ok {
+				b = &bucket{tokens: float64(burst), last: now}
+				buckets[key] = b
+			}
+			b.tokens = min(float64(burst), b.tokens+now.Sub(b.last).Seconds()*rate)
+			b.last = now
+			allowed := b.tokens >= 1
+			if allowed {
+				b.tokens--
+			}
+			mu.Unlock()
+
+			if !allowed {
+				return nil, Errorf(CodeRateLimited, "rate limit exceeded for %q", req.Principal)
+			}
+			return next.Handle(ctx, req)
+		})
+	}
+}
+
+// ============================================================================
+// Policy
+// ============================================================================
+
+// PolicyFunc decides whether a request may proceed. A non-nil error rejects
+// it; plain errors are reported as CodeForbidden.
+type PolicyFunc func(ctx context.Context, req *Request) error
+
+// Policy runs the given checks in order before the request is handled.
+func Policy(checks ...PolicyFunc) Middleware {
+	return func(next Handler) Handler {
+		return HandlerFunc(func(ctx context.Context, req *Request) (*Response, error) {
+			for _, check := range checks {
+				if err := check(ctx, req); err != nil {
+					if _, ok := err.(*Error); !ok {
+						err = Errorf(CodeForbidden, "%v", err)
+					}
+					return nil, err
+				}
+			}
+			return next.Handle(ctx, req)
+		})
+	}
+}
+
+// HookEvent is the JSON an approval hook reads on stdin.
+type HookEvent struct {
+	Op        string          `json:"op"`
+	Tenant    string          `json:"tenant,omitempty"`
+	Principal string          `json:"principal,omitempty"`
+	Body      json.RawMessage `json:"body"`
+}
+
+// ApprovalHook runs an external program to approve each create_session:
+// exit status 0 approves, anything else rejects with the first line of its
+// output as the reason. The program runs in a sandbox under limits (see
+// package sandbox); list keystore and share file paths in limits.Hide. A hook
+// that breaks a limit or cannot run rejects the session.
+func ApprovalHook(limits sandbox.Limits, argv ...string) PolicyFunc {
+	return func(ctx context.Context, req *Request) error {
+		if req.Op != OpCreateSession {
+			return nil
+		}
+		event, err := json.Marshal(HookEvent{Op: req.Op, Tenant: req.Tenant, Principal: req.Principal, Body: req.Body})
+		if err != nil {
+			return Errorf(CodeBadRequest, "%v", err)
+		}
+		res, err := sandbox.Run(ctx, limits, argv, bytes.NewReader(event))
+		if err != nil {
+			return Errorf(CodeForbidden, "approval hook: %v", err)
+		}
+		if res.ExitCode != 0 {
+			reason, _, _ := strings.Cut(strings.TrimSpace(string(res.Stdout)+"\n"+string(res.Stderr)), "\n")
+			if reason == "" {
+				reason = "no reason given"
+			}
+			return Errorf(CodeForbidden, "approval hook rejected the session: %s", reason)
+		}
+		return nil
+	}
+}
+
+// PurposePolicy limits each principal to sessions for the purpose tags
+// listed for it, "" standing for untagged groups. A create_session must
+// state its purpose (CreateSessionParams.Purpose), which the coordinator
+// checks against the group's, so a principal allowed only "attestation"
+// cannot start a session on a "tx-signing" group. Principals without an
+// entry cannot create sessions.
+func PurposePolicy(allowed map[string][]string) PolicyFunc {
+	return func(ctx context.Context, req *Request) error {
+		if req.Op != OpCreateSession {
+			return nil
+		}
+		var p struct {
+			Purpose string `json:"purpose"`
+		}
+		if err := json.Unmarshal(req.Body, &p); err != nil {
+			return Errorf(CodeBadRequest, "%v", err)
+		}
+		if !slices.Contains(allowed[req.Principal], p.Purpose) {
+			return Errorf(CodeForbidden, "principal %q may not sign for %s", req.Principal, purposeName(p.Purpose))
+		}
+		return nil
+	}
+}
+
+// purposeName names a purpose tag in errors.
+func purposeName(purpose string) string {
+	if purpose == "" {
+		return "no purpose (untagged)"
+	}
+	return fmt.Sprintf("purpose %q", purpose)
+}
+
+// ByTenant applies each tenant's own middleware (policy, rate limits) to its
+// requests. Tenants without an entry are rejected, so a tenant added to the
+// authenticator but not here cannot bypass policy.
+func ByTenant(tenants map[string]Middleware) Middleware {
+	return func(next Handler) Handler {
+		wrapped := make(map[string]Handler, len(tenants))
+		for tenant, mw := range tenants {
+			wrapped[tenant] = mw(next)
+		}
+		return HandlerFunc(func(ctx context.Context, req *Request) (*Response, error) {
+			h, ok := wrapped[req.Tenant]
+			if !ok {
+				return nil, Errorf(CodeForbidden, "no policy for tenant %q", req.Tenant)
+			}
+			return h.Handle(ctx, req)
+		})
+	}
+}
+
+// ============================================================================
+// Audit
+// ============================================================================
+
+// AuditEvent records one handled request.
+type AuditEvent struct {
+	Time      time.Time       `json:"time"`
+	Op        string          `json:"op"`
+	SessionID string          `json:"session_id,omitempty"`
+	Tenant    string          `json:"tenant,omitempty"`
+	Principal string          `json:"principal,omitempty"`
+	Body      json.RawMessage `json:"body,omitempty"`
+	Outcome   string          `json:"outcome"` // "ok" or the error code
+	Error     string          `json:"error,omitempty"`
+
+	// Accounting is the session's, for requests answered with one
+	Accounting *groupstate.Accounting `json:"accounting,omitempty"`
+}
+
+// AuditSink stores audit events.
+type AuditSink interface {
+	Record(AuditEvent) error
+}
+
+// JSONLAudit appends one JSON object per event to a writer.
+type JSONLAudit struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewJSONLAudit returns a sink writing to w.
+func NewJSONLAudit(w io.Writer) *JSONLAudit {
+	return &JSONLAudit{w: w}
+}
+
+func (a *JSONLAudit) Record(e AuditEvent) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	_, err = a.w.Write(append(b, '\n'))
+	return err
+}
+
+// Audit records every request and its outcome. A failure to record fails the
+// request, so no operation goes unaudited.
+func Audit(sink AuditSink) Middleware {
+	return AuditClock(sink, clock.Real)
+}
+
+// AuditClock is Audit dating events by clk.
+func AuditClock(sink AuditSink, clk clock.Clock) Middleware {
+	clk = clock.Or(clk)
+	return func(next Handler) Handler {
+		return HandlerFunc(func(ctx context.Context, req *Request) (*Response, error) {
+			resp, err := next.Handle(ctx, req)
+
+			e := AuditEvent{
+				Time:      clk.Now().UTC(),
+				Op:        req.Op,
+				SessionID: req.SessionID,
+				Tenant:    req.Tenant,
+				Principal: req.Principal,
+				Body:      req.Body,
+				Outcome:   "ok",
+			}
+			if err != nil {
+				e.Outcome = CodeOf(err).String()
+				e.Error = err.Error()
+			} else if s, ok := resp.Body.(*Session); ok {
+				e.Accounting = s.Accounting
+				if e.SessionID == "" {
+					e.SessionID = s.ID // create_session
+				}
+			}
+			if recErr := sink.Record(e); recErr != nil {
+				return nil, Errorf(CodeInternal, "audit: %v", recErr)
+			}
+			return resp, err
+		})
+	}
+}
+
+// ============================================================================
+// Metrics
+// ============================================================================
+
+// OpStats are the counters kept for one operation.
+type OpStats struct {
+	Requests uint64        `json:"requests"`
+	Errors   uint64        `json:"errors"`
+	Latency  time.Duration `json:"latency_ns"` // Total time spent handling
+}
+
+// Metrics counts requests, errors and latency per operation.
+type Metrics struct {
+	mu  sync.Mutex
+	ops map[string]*OpStats
+}
+
+// NewMetrics returns an empty metrics collector.
+func NewMetrics() *Metrics {
+	return &Metrics{ops: make(map[string]*OpStats)}
+}
+
+// Snapshot returns a copy of the current counters.
+func (m *Metrics) Snapshot() map[string]OpStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := make(map[string]OpStats, len(m.ops))
+	for op, s := range m.ops {
+		out[op] = *s
+	}
+	return out
+}
+
+// Middleware returns the collecting middleware.
+func (m *Metrics) Middleware() Middleware {
+	return func(next Handler) Handler {
+		return HandlerFunc(func(ctx context.Context, req *Request) (*Response, error) {
+			start := time.Now()
+			resp, err := next.Handle(ctx, req)
+			elapsed := time.Since(start)
+
+			m.mu.Lock()
+			s, ok := m.ops[req.Op]
+			if !ok {
+				s = &OpStats{}
+				m.ops[req.Op] = s
+			}
+			s.Requests++
+			if err != nil {
+				s.Errors++
+			}
+			s.Latency += elapsed
+			m.mu.Unlock()
+			return resp, err
+		})
+	}
+}
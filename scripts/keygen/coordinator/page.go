@@ -0,0 +1,171 @@
+package coordinator
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Page sizes of list_participants and list_commitments
+const (
+	DefaultPageSize = 64
+	MaxPageSize     = 256
+)
+
+// PageParams is the body of list_participants and list_commitments. A
+// session's commitments are listed from Request.SessionID.
+type PageParams struct {
+	GroupKey string `json:"group_key,omitempty"` // list_participants
+	Limit    int    `json:"limit,omitempty"`     // Entries per page; 0 is DefaultPageSize, at most MaxPageSize
+	Token    string `json:"token,omitempty"`     // Next of the previous page; empty starts from the beginning
+}
+
+// Participant is one entry of a group's registry.
+type Participant struct {
+	ID          int        `json:"id"`
+	PublicShare string     `json:"public_share"`
+	Standby     string     `json:"standby,omitempty"` // Standby signer holding the share since a failover
+	Retired     *time.Time `json:"retired,omitempty"` // When the participant destroyed its share
+}
+
+// ParticipantsPage is a page of a group's registry, in participant order.
+type ParticipantsPage struct {
+	GroupKey     string        `json:"group_key"`
+	Sequence     uint64        `json:"sequence"` // Of the group-state document the page is from
+	Total        int           `json:"total"`
+	Participants []Participant `json:"participants"`
+	Next         string        `json:"next"` // Token of the following page
+	More         bool          `json:"more"` // Whether there are entries after this page
+}
+
+// CommitmentsPage is a page of a session's commitments, in the order they
+// arrived. Next resumes after the last of them, so a client that keeps it
+// later fetches only the commitments submitted since.
+type CommitmentsPage struct {
+	SessionID   string             `json:"session_id"`
+	State       string             `json:"state"`
+	Signers     int                `json:"signers"` // Commitments the session waits for in all
+	Commitments []CommitmentParams `json:"commitments"`
+	Next        string             `json:"next"`
+	More        bool               `json:"more"` // Whether more have arrived than this page holds
+}
+
+// pageToken is the decoded form of a resumption token: a position in the
+// listing of scope.
+type pageToken struct {
+	Scope string `json:"s"`
+	Pos   int    `json:"p"`
+}
+
+func encodeToken(scope string, pos int) string {
+	b, _ := json.Marshal(pageToken{scope, pos})
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// decodeToken returns the position token resumes at in the listing of scope
+// with n entries. A token from another listing is bad_request; one from an
+// earlier version of the same registry is conflict, and the client must
+// start over.
+func decodeToken(token, scope string, n int) (int, error) {
+	if token == "" {
+		return 0, nil
+	}
+	var t pageToken
+	b, err := base64.RawURLEncoding.DecodeString(token)
+	if err == nil {
+		err = json.Unmarshal(b, &t)
+	}
+	if err != nil {
+		return 0, Errorf(CodeBadRequest, "invalid page token")
+	}
+	if t.Scope != scope {
+		return 0, Errorf(CodeConflict, "page token is for %s, not %s; start over", t.Scope, scope)
+	}
+	if t.Pos < 0 || t.Pos > n {
+		return 0, Errorf(CodeBadRequest, "page token out of range")
+	}
+	return t.Pos, nil
+}
+
+func pageLimit(limit int) (int, error) {
+	switch {
+	case limit < 0:
+		return 0, Errorf(CodeBadRequest, "limit must not be negative")
+	case limit == 0:
+		return DefaultPageSize, nil
+	}
+	return min(limit, MaxPageSize), nil
+}
+
+func (c *Coordinator) listParticipants(tenant string, p *PageParams) (*ParticipantsPage, error) {
+	limit, err := pageLimit(p.Limit)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	st, ok := c.tenants[tenant]
+	if !ok || st.groups[p.GroupKey] == nil {
+		return nil, Errorf(CodeNotFound, "unknown group %s", p.GroupKey)
+	}
+	doc := st.groups[p.GroupKey]
+
+	// The registry changes with the document's sequence number, or when a
+	// participant retires, after which positions in the old one mean nothing
+	scope := fmt.Sprintf("group %s sequence %d retired %d", doc.GroupKey, doc.Sequence, len(doc.Retired))
+	start, err := decodeToken(p.Token, scope, len(doc.PublicShares))
+	if err != nil {
+		return nil, err
+	}
+	end := min(start+limit, len(doc.PublicShares))
+	page := &ParticipantsPage{
+		GroupKey:     doc.GroupKey,
+		Sequence:     doc.Sequence,
+		Total:        len(doc.PublicShares),
+		Participants: make([]Participant, 0, end-start),
+		Next:         encodeToken(scope, end),
+		More:         end < len(doc.PublicShares),
+	}
+	for i := start; i < end; i++ {
+		entry := Participant{ID: i + 1, PublicShare: doc.PublicShares[i], Standby: doc.Failovers[i+1]}
+		if t, ok := doc.Retired[i+1]; ok {
+			entry.Retired = &t
+		}
+		page.Participants = append(page.Participants, entry)
+	}
+	return page, nil
+}
+
+func (c *Coordinator) listCommitments(tenant, id string, p *PageParams) (*CommitmentsPage, error) {
+	limit, err := pageLimit(p.Limit)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s, err := c.session(tenant, id)
+	if err != nil {
+		return nil, err
+	}
+
+	// Commitments are only ever added, so a position in the arrival order
+	// stays valid for the life of the session
+	start, err := decodeToken(p.Token, "session "+s.ID, len(s.arrivals))
+	if err != nil {
+		return nil, err
+	}
+	end := min(start+limit, len(s.arrivals))
+	page := &CommitmentsPage{
+		SessionID:   s.ID,
+		State:       s.State,
+		Signers:     len(s.Signers),
+		Commitments: make([]CommitmentParams, 0, end-start),
+		Next:        encodeToken("session "+s.ID, end),
+		More:        end < len(s.arrivals),
+	}
+	for _, signer := range s.arrivals[start:end] {
+		page.Commitments = append(page.Commitments, s.Commitments[signer])
+	}
+	return page, nil
+}
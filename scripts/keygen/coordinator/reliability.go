@@ -0,0 +1,326 @@
+package coordinator
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"math/big"
+	"sort"
+	"sync"
+	"time"
+
+	"keygen/clock"
+	"keygen/frostcore"
+	"keygen/groupstate"
+)
+
+// EventKind classifies a reliability event.
+type EventKind string
+
+const (
+	EventSelected          EventKind = "selected"           // Named as a signer of a new session
+	EventCommitted         EventKind = "committed"          // Submitted its commitment; Latency is from the phase start
+	EventSigned            EventKind = "signed"             // Submitted its partial signature; Latency as above
+	EventMissed            EventKind = "missed"             // Had not submitted when the phase timed out
+	EventEquivocated       EventKind = "equivocated"        // Resubmitted a different commitment or partial signature
+	EventInvalidPartial    EventKind = "invalid_partial"    // Partial signature failed share verification
+	EventInvalidProof      EventKind = "invalid_proof"      // Commitment proof of knowledge failed to verify
+	EventBadCommitment     EventKind = "bad_commitment"     // Submitted a malformed, low-order or copied commitment
+	EventCounterRegression EventKind = "counter_regression" // Reported a device counter at or below an earlier one
+)
+
+// ReliabilityEvent is one observation of a participant's conduct in a
+// session.
+type ReliabilityEvent struct {
+	Time        time.Time `json:"time"`
+	Tenant      string    `json:"tenant,omitempty"`
+	GroupKey    string    `json:"group_key"`
+	SessionID   string    `json:"session_id"`
+	Participant int       `json:"participant"`
+	Kind        EventKind `json:"kind"`
+	Phase       Phase     `json:"phase,omitempty"`
+	Latency     Duration  `json:"latency,omitempty"`
+	Detail      string    `json:"detail,omitempty"`
+
+	Accounting *groupstate.Accounting `json:"accounting,omitempty"` // The session's
+}
+
+// ReliabilityHook receives reliability events as the coordinator observes
+// them, e.g. to feed a slashing or penalty system. Hooks are called with the
+// coordinator locked: they must return quickly and must not call back into
+// it.
+type ReliabilityHook interface {
+	RecordReliability(ReliabilityEvent)
+}
+
+// ReliabilityHookFunc adapts a function to ReliabilityHook.
+type ReliabilityHookFunc func(ReliabilityEvent)
+
+func (f ReliabilityHookFunc) RecordReliability(e ReliabilityEvent) { f(e) }
+
+// JSONLReliability appends one JSON object per event to a writer, for
+// systems that consume the events as a stream.
+type JSONLReliability struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewJSONLReliability returns a hook writing to w.
+func NewJSONLReliability(w io.Writer) *JSONLReliability {
+	return &JSONLReliability{w: w}
+}
+
+func (j *JSONLReliability) RecordReliability(e ReliabilityEvent) {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.w.Write(append(b, '\n'))
+}
+
+// AddReliabilityHook makes the coordinator report reliability events to h.
+func (c *Coordinator) AddReliabilityHook(h ReliabilityHook) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.hooks = append(c.hooks, h)
+}
+
+// SetReliability records reliability events in r, and serves
+// get_reliability from it.
+func (c *Coordinator) SetReliability(r *Reliability) {
+	c.AddReliabilityHook(r)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.reliability = r
+}
+
+// record sends an event about a session's participant to the hooks. Callers
+// hold c.mu.
+func (c *Coordinator) record(s *Session, id int, kind EventKind, latency time.Duration, detail string) {
+	if len(c.hooks) == 0 {
+		return
+	}
+	e := ReliabilityEvent{
+		Time:        c.clock.Now().UTC(),
+		Tenant:      s.Tenant,
+		GroupKey:    s.GroupKey,
+		SessionID:   s.ID,
+		Participant: id,
+		Kind:        kind,
+		Phase:       s.Phase,
+		Latency:     Duration(latency),
+		Detail:      detail,
+		Accounting:  s.Accounting,
+	}
+	for _, h := range c.hooks {
+		h.RecordReliability(e)
+	}
+}
+
+// ============================================================================
+// Reports
+// ============================================================================
+
+// reportDomain separates reliability reports from other ed25519 signatures.
+const reportDomain = "fy-ledger/coordinator/reliability/v1"
+
+// ParticipantReliability is one participant's record in a report.
+type ParticipantReliability struct {
+	ID                 int      `json:"id"`
+	Sessions           uint64   `json:"sessions"` // Sessions it was selected for
+	Commitments        uint64   `json:"commitments"`
+	Partials           uint64   `json:"partials"`
+	Missed             uint64   `json:"missed"` // Phases it let time out
+	Equivocations      uint64   `json:"equivocations"`
+	InvalidPartials    uint64   `json:"invalid_partials"`
+	InvalidProofs      uint64   `json:"invalid_proofs"`
+	BadCommitments     uint64   `json:"bad_commitments"`
+	CounterRegressions uint64   `json:"counter_regressions"`
+	MeanLatency        Duration `json:"mean_latency"`
+	MaxLatency         Duration `json:"max_latency"`
+
+	latency time.Duration // Sum over Commitments + Partials submissions
+}
+
+// ReliabilityReport is a coordinator's signed account of each participant's
+// conduct in one group's sessions between Since and Until. Penalty systems
+// should pin the coordinator's key rather than trust PublicKey.
+type ReliabilityReport struct {
+	Tenant       string                   `json:"tenant,omitempty"`
+	GroupKey     string                   `json:"group_key"`
+	Since        time.Time                `json:"since"` // First event recorded
+	Until        time.Time                `json:"until"` // When the report was made
+	Participants []ParticipantReliability `json:"participants"`
+	PublicKey    string                   `json:"public_key"` // Coordinator's ed25519 key
+	Signature    string                   `json:"signature"`
+}
+
+func (r *ReliabilityReport) signedMessage() []byte {
+	unsigned := *r
+	unsigned.Signature = ""
+	b, _ := json.Marshal(&unsigned)
+	return append([]byte(reportDomain+"\n"), b...)
+}
+
+// Verify checks the report's signature under key.
+func (r *ReliabilityReport) Verify(key ed25519.PublicKey) error {
+	sig, err := hex.DecodeString(r.Signature)
+	if err != nil || len(key) != ed25519.PublicKeySize || !ed25519.Verify(key, r.signedMessage(), sig) {
+		return errors.New("coordinator: reliability report signature does not verify")
+	}
+	return nil
+}
+
+// Reliability is a ReliabilityHook that keeps per-participant counts for
+// each group and issues reports signed with the coordinator's key.
+type Reliability struct {
+	// Clock dates reports; nil is clock.Real. Events carry the time the
+	// coordinator recorded them at.
+	Clock clock.Clock
+
+	mu     sync.Mutex
+	key    ed25519.PrivateKey
+	groups map[groupRef]*groupReliability
+}
+
+type groupRef struct {
+	tenant   string
+	groupKey string
+}
+
+type groupReliability struct {
+	since        time.Time
+	participants map[int]*ParticipantReliability
+}
+
+// NewReliability returns an empty record whose reports are signed with key.
+func NewReliability(key ed25519.PrivateKey) *Reliability {
+	return &Reliability{key: key, groups: make(map[groupRef]*groupReliability)}
+}
+
+func (r *Reliability) RecordReliability(e ReliabilityEvent) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ref := groupRef{e.Tenant, e.GroupKey}
+	g, ok := r.groups[ref]
+	if !ok {
+		g = &groupReliability{since: e.Time, participants: make(map[int]*ParticipantReliability)}
+		r.groups[ref] = g
+	}
+	p, ok := g.participants[e.Participant]
+	if !ok {
+		p = &ParticipantReliability{ID: e.Participant}
+		g.participants[e.Participant] = p
+	}
+	switch e.Kind {
+	case EventSelected:
+		p.Sessions++
+	case EventCommitted, EventSigned:
+		if e.Kind == EventCommitted {
+			p.Commitments++
+		} else {
+			p.Partials++
+		}
+		p.latency += time.Duration(e.Latency)
+		p.MeanLatency = Duration(p.latency / time.Duration(p.Commitments+p.Partials))
+		p.MaxLatency = max(p.MaxLatency, e.Latency)
+	case EventMissed:
+		p.Missed++
+	case EventEquivocated:
+		p.Equivocations++
+	case EventInvalidPartial:
+		p.InvalidPartials++
+	case EventInvalidProof:
+		p.InvalidProofs++
+	case EventBadCommitment:
+		p.BadCommitments++
+	case EventCounterRegression:
+		p.CounterRegressions++
+	}
+}
+
+// Report returns the signed report for a tenant's group.
+func (r *Reliability) Report(tenant, groupKey string) (*ReliabilityReport, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	g, ok := r.groups[groupRef{tenant, groupKey}]
+	if !ok {
+		return nil, Errorf(CodeNotFound, "no reliability record for group %s", groupKey)
+	}
+	report := &ReliabilityReport{
+		Tenant:    tenant,
+		GroupKey:  groupKey,
+		Since:     g.since,
+		Until:     clock.Or(r.Clock).Now().UTC(),
+		PublicKey: hex.EncodeToString(r.key.Public().(ed25519.PublicKey)),
+	}
+	for _, p := range g.participants {
+		report.Participants = append(report.Participants, *p)
+	}
+	sort.Slice(report.Participants, func(i, j int) bool { return report.Participants[i].ID < report.Participants[j].ID })
+	report.Signature = hex.EncodeToString(ed25519.Sign(r.key, report.signedMessage()))
+	return report, nil
+}
+
+// ReliabilityParams is the get_reliability body.
+type ReliabilityParams struct {
+	GroupKey string `json:"group_key"`
+}
+
+func (c *Coordinator) reliabilityReport(tenant string, p *ReliabilityParams) (*ReliabilityReport, error) {
+	c.mu.Lock()
+	r := c.reliability
+	_, known := c.tenants[tenant]
+	if known {
+		_, known = c.tenants[tenant].groups[p.GroupKey]
+	}
+	c.mu.Unlock()
+	if r == nil {
+		return nil, Errorf(CodeNotFound, "this coordinator keeps no reliability record")
+	}
+	if !known {
+		return nil, Errorf(CodeNotFound, "unknown group %s", p.GroupKey)
+	}
+	return r.Report(tenant, p.GroupKey)
+}
+
+// blame records an invalid_partial event for each signer whose partial
+// signature fails share verification against the group's public shares,
+// after the aggregate signature did not verify. Callers hold c.mu.
+func (c *Coordinator) blame(s *Session) {
+	st := c.tenants[s.Tenant]
+	doc, ok := st.groups[s.GroupKey]
+	if !ok || len(c.hooks) == 0 {
+		return
+	}
+	msg, _ := hex.DecodeString(s.MessageHash)
+	groupKey, _ := hex.DecodeString(s.GroupKey)
+	list := s.CommitmentList()
+	var challenge *big.Int // nil: untagged, computed from R
+	if s.Purpose != "" {
+		var err error
+		if challenge, err = frostcore.ListChallenge(s.Purpose, msg, groupKey, list); err != nil {
+			return
+		}
+	}
+	for _, id := range s.Signers {
+		if id > len(doc.PublicShares) {
+			continue
+		}
+		share, err := hex.DecodeString(doc.PublicShares[id-1])
+		if err != nil {
+			continue
+		}
+		z, _ := hex.DecodeString(s.Partials[id])
+		check, err := frostcore.VerifyShare(msg, groupKey, list, uint16(id), share, z, challenge)
+		if err != nil {
+			c.record(s, id, EventInvalidPartial, 0, err.Error())
+		} else if !check.Valid {
+			c.record(s, id, EventInvalidPartial, 0, "z_i*G != D_i + rho_i*E_i + lambda_i*c*Y_i")
+		}
+	}
+}
@@ -0,0 +1,179 @@
+// Package coordinator runs FROST signing sessions on behalf of remote
+// participants: it collects commitments, hands out the commitment list,
+// collects partial signatures and aggregates the result.
+//
+// Every request goes through a Handler. The Coordinator itself is the
+// innermost Handler; deployments wrap it in a chain of Middleware (auth, rate
+// limiting, policy, audit, metrics, or their own) without modifying this
+// package:
+//
+//	h := coordinator.Chain(c,
+//		coordinator.Auth(coordinator.StaticTokens{"s3cret": "alice"}),
+//		coordinator.RateLimit(10, 20),
+//		corporateSSO, // any func(Handler) Handler
+//		coordinator.Audit(sink),
+//	)
+//
+// One coordinator can serve several tenants. A TenantAuthenticator such as
+// TenantTokens sets Request.Tenant; groups and sessions are stored per tenant
+// and ByTenant applies per-tenant policy:
+//
+//	c.AddTenantGroup("treasury", doc)
+//	h := coordinator.Chain(c,
+//		coordinator.Auth(coordinator.TenantTokens{"t0k": {Tenant: "treasury", Principal: "alice"}}),
+//		coordinator.ByTenant(map[string]coordinator.Middleware{
+//			"treasury": coordinator.Compose(coordinator.RateLimit(5, 10), coordinator.Policy(onlyBusinessHours)),
+//		}),
+//		coordinator.Audit(sink),
+//	)
+package coordinator
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"keygen/schema"
+)
+
+// Operations
+const (
+	OpCreateSession     = "create_session"
+	OpGetSession        = "get_session"
+	OpSubmitCommitment  = "submit_commitment"
+	OpSubmitPartial     = "submit_partial"
+	OpGetResult         = "get_result"
+	OpGetReliability    = "get_reliability"    // Signed reliability report; see Reliability
+	OpListParticipants  = "list_participants"  // A page of a group's registry; see PageParams
+	OpListCommitments   = "list_commitments"   // A page of a session's commitments
+	OpRestartSession    = "restart_session"    // Replace the signers a session timed out on; see RestartParams
+	OpApplyAction       = "apply_action"       // Apply a group-state action signed by the group; see ActionParams
+	OpRetireParticipant = "retire_participant" // Record a participant's destruction of its share; see RetireParams
+)
+
+// Request is a transport-independent coordinator request.
+type Request struct {
+	Op         string            // One of the Op* constants
+	SessionID  string            // Target session, empty for create_session
+	Body       json.RawMessage   // Operation parameters
+	Credential string            // Presented credential (e.g. bearer token)
+	Principal  string            // Authenticated caller, set by Auth
+	Tenant     string            // Caller's tenant, set by Auth; "" for single-tenant deployments
+	Meta       map[string]string // Transport details (remote address, headers)
+}
+
+// Decode unmarshals the request body into v, checking it against v's
+// schema like every other JSON input.
+func (r *Request) Decode(v any) error {
+	if len(r.Body) == 0 {
+		return Errorf(CodeBadRequest, "%s: missing body", r.Op)
+	}
+	if err := schema.Unmarshal(r.Body, v, r.Op); err != nil {
+		return Errorf(CodeBadRequest, "%s: %v", r.Op, err)
+	}
+	return nil
+}
+
+// Response is the result of a request.
+type Response struct {
+	Body any
+}
+
+// Handler processes a request.
+type Handler interface {
+	Handle(ctx context.Context, req *Request) (*Response, error)
+}
+
+// HandlerFunc adapts a function to Handler.
+type HandlerFunc func(ctx context.Context, req *Request) (*Response, error)
+
+func (f HandlerFunc) Handle(ctx context.Context, req *Request) (*Response, error) {
+	return f(ctx, req)
+}
+
+// Middleware wraps a Handler.
+type Middleware func(Handler) Handler
+
+// Chain wraps h so that mw[0] runs first and h runs last.
+func Chain(h Handler, mw ...Middleware) Handler {
+	for i := len(mw) - 1; i >= 0; i-- {
+		h = mw[i](h)
+	}
+	return h
+}
+
+// Compose combines several middleware into one, e.g. for a ByTenant entry.
+func Compose(mw ...Middleware) Middleware {
+	return func(h Handler) Handler {
+		return Chain(h, mw...)
+	}
+}
+
+// ============================================================================
+// Errors
+// ============================================================================
+
+// Code classifies coordinator errors so transports can map them to their own
+// status codes.
+type Code int
+
+const (
+	CodeInternal Code = iota
+	CodeBadRequest
+	CodeUnauthenticated
+	CodeForbidden
+	CodeNotFound
+	CodeConflict
+	CodeRateLimited
+	CodeTimeout
+)
+
+func (c Code) String() string {
+	switch c {
+	case CodeBadRequest:
+		return "bad_request"
+	case CodeUnauthenticated:
+		return "unauthenticated"
+	case CodeForbidden:
+		return "forbidden"
+	case CodeNotFound:
+		return "not_found"
+	case CodeConflict:
+		return "conflict"
+	case CodeRateLimited:
+		return "rate_limited"
+	case CodeTimeout:
+		return "timeout"
+	}
+	return "internal"
+}
+
+// Error is a coordinator error with a classification code.
+type Error struct {
+	Code    Code
+	Message string
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Errorf returns an *Error with the given code.
+func Errorf(code Code, format string, args ...any) error {
+	return &Error{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// CodeOf returns the code of err: CodeTimeout for a *TimeoutError, or
+// CodeInternal if err is not an *Error.
+func CodeOf(err error) Code {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Code
+	}
+	var t *TimeoutError
+	if errors.As(err, &t) {
+		return CodeTimeout
+	}
+	return CodeInternal
+}
@@ -0,0 +1,159 @@
+package coordinator
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+
+	"keygen/h2c"
+)
+
+// RestartParams is the restart_session body.
+type RestartParams struct {
+	// Replacements maps each missing signer to the participant taking its
+	// slot. Missing signers without one are dropped, as long as the
+	// remaining signers still meet the threshold.
+	Replacements map[int]int `json:"replacements,omitempty"`
+}
+
+// IntentHash identifies what a session signs: SHA-256 over the group key and
+// message hash (both hex), joined with h2c.Context. A restarted session has
+// the same intent as the one it replaces, so a policy that approved the
+// first need not approve it again.
+func IntentHash(groupKey, messageHash string) string {
+	key, _ := hex.DecodeString(groupKey)
+	msg, _ := hex.DecodeString(messageHash)
+	sum := sha256.Sum256(h2c.Context([]byte("fy-ledger/intent/v1"), key, msg))
+	return hex.EncodeToString(sum[:])
+}
+
+// restartSession starts a new session for a session that timed out waiting
+// on some of its signers, with the same intent and the missing slots given
+// to replacements, so a round is not lost to one unresponsive participant.
+//
+// Only work that the new signer set cannot invalidate is salvaged. When the
+// session timed out collecting commitments, the other signers' commitments
+// carry over: their nonces are unspent, since nobody signs before every
+// commitment is in. Partial signatures never carry over: each is bound to
+// the signer set through the binding factors, group commitment and Lagrange
+// coefficient, so a different set needs fresh commitments and signatures
+// from everyone. Per-signer timeouts keep this cheap, failing a session on
+// an unattended signer before a human has approved on a device. A session
+// can be restarted once, so salvaged nonces are used by one session only.
+func (c *Coordinator) restartSession(tenant, id string, p *RestartParams) (*Session, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	old, err := c.session(tenant, id)
+	if err != nil {
+		return nil, err
+	}
+	if old.timedOut == nil || len(old.timedOut.Missing) == 0 {
+		return nil, Errorf(CodeConflict, "session %s did not time out waiting for a signer (state %s)", id, old.State)
+	}
+	if old.RestartedAs != "" {
+		return nil, Errorf(CodeConflict, "session %s was already restarted as %s", id, old.RestartedAs)
+	}
+	st := c.tenants[tenant]
+	doc, ok := st.groups[old.GroupKey]
+	if !ok {
+		return nil, Errorf(CodeNotFound, "unknown group %s", old.GroupKey)
+	}
+	if err := doc.CheckActive(); err != nil {
+		return nil, Errorf(CodeForbidden, "%v", err)
+	}
+
+	missing := make(map[int]bool, len(old.timedOut.Missing))
+	for _, m := range old.timedOut.Missing {
+		missing[m] = true
+	}
+	var signers []int
+	for _, signer := range old.Signers {
+		if !missing[signer] {
+			signers = append(signers, signer)
+		}
+	}
+	slots := make(map[int]int, len(p.Replacements)) // Replacement to the slot it takes
+	for slot, r := range p.Replacements {
+		if !missing[slot] {
+			return nil, Errorf(CodeBadRequest, "replacements: signer %d did not miss session %s", slot, id)
+		}
+		if r < 1 || r > doc.Total {
+			return nil, Errorf(CodeBadRequest, "replacements: %d is not a participant of this group", r)
+		}
+		if old.isSigner(r) {
+			return nil, Errorf(CodeBadRequest, "replacements: %d is already a signer in session %s", r, id)
+		}
+		if _, dup := slots[r]; dup {
+			return nil, Errorf(CodeBadRequest, "replacements: %d replaces more than one signer", r)
+		}
+		slots[r] = slot
+		signers = append(signers, r)
+	}
+	sort.Ints(signers)
+	if len(signers) < doc.Threshold {
+		return nil, Errorf(CodeBadRequest, "%d signers left, group threshold is %d", len(signers), doc.Threshold)
+	}
+
+	s := &Session{
+		ID:          newSessionID(),
+		Tenant:      tenant,
+		GroupKey:    old.GroupKey,
+		MessageHash: old.MessageHash,
+		Purpose:     old.Purpose,
+		Intent:      old.Intent,
+		Signers:     signers,
+		State:       StateCollectingCommitments,
+		Commitments: make(map[int]CommitmentParams),
+		Partials:    make(map[int]string),
+		Approvals:   make(map[int]string),
+		Counters:    make(map[int]uint64),
+
+		RequireDeviceApproval:   old.RequireDeviceApproval,
+		RequireCommitmentProofs: old.RequireCommitmentProofs,
+		Timeouts:                old.Timeouts,
+		Accounting:              old.Accounting.Merge(nil),
+		RestartOf:               old.ID,
+	}
+	// Replacements take over their slot's timeouts
+	for _, signer := range signers {
+		from := signer
+		if slot, ok := slots[signer]; ok {
+			from = slot
+		}
+		if t, ok := old.SignerTimeouts[from]; ok {
+			if s.SignerTimeouts == nil {
+				s.SignerTimeouts = make(map[int]Timeouts)
+			}
+			s.SignerTimeouts[signer] = t
+		}
+	}
+	if old.TimedOut == PhaseCommitments {
+		for _, signer := range old.arrivals {
+			if missing[signer] {
+				continue
+			}
+			if s.Salvaged == nil {
+				s.Salvaged = make(map[int]string)
+			}
+			s.Commitments[signer] = old.Commitments[signer]
+			s.arrivals = append(s.arrivals, signer)
+			s.Salvaged[signer] = old.ID
+			if from, ok := old.Salvaged[signer]; ok {
+				s.Salvaged[signer] = from
+			}
+		}
+	}
+
+	now := c.clock.Now()
+	s.startPhase(PhaseCommitments, now)
+	s.collectPartials(now)
+	old.RestartedAs = s.ID
+	c.prune(st, now)
+	st.sessions[s.ID] = s
+	for _, signer := range signers {
+		c.record(s, signer, EventSelected, 0, "")
+	}
+	c.notify()
+	return s.copy(), nil
+}
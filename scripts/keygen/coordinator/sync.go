@@ -0,0 +1,166 @@
+package coordinator
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Registry is a client's copy of a group's registry, kept up to date with
+// list_participants one page at a time. Each page is merged before the next
+// is requested, so a slow client paces the coordinator rather than the other
+// way around.
+type Registry struct {
+	GroupKey     string
+	Sequence     uint64
+	Total        int
+	Participants map[int]string    // Public share by participant ID
+	Standbys     map[int]string    // Active standby by participant ID, for those failed over
+	Retired      map[int]time.Time // When each participant that destroyed its share did
+
+	next string
+}
+
+// NewRegistry returns an empty registry of the group.
+func NewRegistry(groupKey string) *Registry {
+	return &Registry{GroupKey: groupKey, Participants: make(map[int]string), Standbys: make(map[int]string), Retired: make(map[int]time.Time)}
+}
+
+// Complete reports whether every participant has been fetched.
+func (r *Registry) Complete() bool {
+	return r.Total > 0 && len(r.Participants) == r.Total
+}
+
+// Sync fetches the pages of the registry not fetched yet through h, limit
+// entries at a time (0 for the coordinator's default), resuming where the
+// last Sync stopped. If the group's document changed in between, it drops
+// what it had and starts over from the new one. It returns the number of
+// entries merged.
+func (r *Registry) Sync(ctx context.Context, h Handler, limit int) (int, error) {
+	merged := 0
+	for restarted := false; ; {
+		if err := ctx.Err(); err != nil {
+			return merged, err
+		}
+		var page ParticipantsPage
+		err := fetchPage(ctx, h, OpListParticipants, "", PageParams{GroupKey: r.GroupKey, Limit: limit, Token: r.next}, &page)
+		if CodeOf(err) == CodeConflict && !restarted {
+			r.reset()
+			restarted = true
+			continue
+		}
+		if err != nil {
+			return merged, err
+		}
+		if page.GroupKey != r.GroupKey {
+			return merged, fmt.Errorf("%s: page is for group %s", OpListParticipants, page.GroupKey)
+		}
+		if r.next != "" && page.Sequence != r.Sequence {
+			return merged, fmt.Errorf("%s: page is from sequence %d, not %d", OpListParticipants, page.Sequence, r.Sequence)
+		}
+		r.Sequence, r.Total = page.Sequence, page.Total
+		for _, p := range page.Participants {
+			if p.ID < 1 || p.ID > page.Total {
+				return merged, fmt.Errorf("%s: participant %d out of range", OpListParticipants, p.ID)
+			}
+			r.Participants[p.ID] = p.PublicShare
+			if p.Standby != "" {
+				r.Standbys[p.ID] = p.Standby
+			}
+			if p.Retired != nil {
+				r.Retired[p.ID] = *p.Retired
+			}
+			merged++
+		}
+		r.next = page.Next
+		if !page.More {
+			return merged, nil
+		}
+	}
+}
+
+func (r *Registry) reset() {
+	r.Sequence, r.Total, r.next = 0, 0, ""
+	clear(r.Participants)
+	clear(r.Standbys)
+	clear(r.Retired)
+}
+
+// CommitmentSet is a client's copy of a session's commitments, kept up to
+// date with list_commitments. Each Sync fetches only the commitments that
+// arrived since the last.
+type CommitmentSet struct {
+	SessionID   string
+	State       string
+	Signers     int
+	Commitments map[int]CommitmentParams
+
+	next string
+}
+
+// NewCommitmentSet returns an empty commitment set of the session.
+func NewCommitmentSet(sessionID string) *CommitmentSet {
+	return &CommitmentSet{SessionID: sessionID, Commitments: make(map[int]CommitmentParams)}
+}
+
+// Complete reports whether every signer's commitment has been fetched.
+func (s *CommitmentSet) Complete() bool {
+	return s.Signers > 0 && len(s.Commitments) == s.Signers
+}
+
+// Sync fetches the commitments that arrived since the last Sync through h,
+// limit at a time (0 for the coordinator's default), and returns the number
+// merged. A commitment that differs from the one already held for its
+// signer is an error: the coordinator is equivocating.
+func (s *CommitmentSet) Sync(ctx context.Context, h Handler, limit int) (int, error) {
+	merged := 0
+	for {
+		if err := ctx.Err(); err != nil {
+			return merged, err
+		}
+		var page CommitmentsPage
+		if err := fetchPage(ctx, h, OpListCommitments, s.SessionID, PageParams{Limit: limit, Token: s.next}, &page); err != nil {
+			return merged, err
+		}
+		if page.SessionID != s.SessionID {
+			return merged, fmt.Errorf("%s: page is for session %s", OpListCommitments, page.SessionID)
+		}
+		s.State, s.Signers = page.State, page.Signers
+		for _, cm := range page.Commitments {
+			if prev, ok := s.Commitments[cm.ID]; ok {
+				if prev.HidingCommit != cm.HidingCommit || prev.BindingCommit != cm.BindingCommit {
+					return merged, fmt.Errorf("%s: participant %d's commitment changed", OpListCommitments, cm.ID)
+				}
+				continue
+			}
+			s.Commitments[cm.ID] = cm
+			merged++
+		}
+		s.next = page.Next
+		if !page.More {
+			return merged, nil
+		}
+	}
+}
+
+// fetchPage sends one list request and decodes its page into out. The
+// page goes through JSON, as it would over a network transport, so a
+// Handler that returns it already encoded works as well.
+func fetchPage(ctx context.Context, h Handler, op, sessionID string, params PageParams, out any) error {
+	body, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	resp, err := h.Handle(ctx, &Request{Op: op, SessionID: sessionID, Body: body})
+	if err != nil {
+		return err
+	}
+	b, ok := resp.Body.(json.RawMessage)
+	if !ok {
+		if b, err = json.Marshal(resp.Body); err != nil {
+			return err
+		}
+	}
+	return json.Unmarshal(b, out)
+}
@@ -0,0 +1,266 @@
+package coordinator
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"keygen/apdu"
+)
+
+// Phase names a timed part of a signing session.
+type Phase string
+
+const (
+	PhaseCommitments Phase = "commitments" // Waiting for every signer's commitment
+	PhaseApproval    Phase = "approval"    // Waiting for partials that need on-device confirmation
+	PhasePartials    Phase = "partials"    // Waiting for partials from unattended signers
+	PhaseAggregation Phase = "aggregation" // Combining and verifying the signature
+)
+
+// Timeout errors, one per phase; a *TimeoutError unwraps to one of them.
+var (
+	ErrCommitmentTimeout  = errors.New("commitment collection timed out")
+	ErrApprovalTimeout    = errors.New("approval wait timed out")
+	ErrPartialTimeout     = errors.New("partial signature collection timed out")
+	ErrAggregationTimeout = errors.New("aggregation timed out")
+)
+
+// TimeoutError reports that a session failed because a phase ran past its
+// timeout. Match the phase with errors.Is(err, ErrApprovalTimeout) etc.
+type TimeoutError struct {
+	Session string
+	Phase   Phase
+	After   time.Duration
+	Missing []int // Signers that had not submitted; empty for aggregation
+}
+
+func (e *TimeoutError) Error() string {
+	msg := fmt.Sprintf("session %s: %v after %s", e.Session, e.Unwrap(), e.After)
+	if len(e.Missing) > 0 {
+		msg += fmt.Sprintf(" (missing participants %v)", e.Missing)
+	}
+	return msg
+}
+
+func (e *TimeoutError) Unwrap() error {
+	switch e.Phase {
+	case PhaseCommitments:
+		return ErrCommitmentTimeout
+	case PhaseApproval:
+		return ErrApprovalTimeout
+	case PhasePartials:
+		return ErrPartialTimeout
+	}
+	return ErrAggregationTimeout
+}
+
+// Duration is a time.Duration written as a string ("90s", "15m") in JSON.
+type Duration time.Duration
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+func (d *Duration) UnmarshalText(b []byte) error {
+	v, err := time.ParseDuration(string(b))
+	if err != nil {
+		return err
+	}
+	if v < 0 {
+		return fmt.Errorf("negative duration %s", v)
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// Timeouts bounds each phase of a session separately, so a signer waiting on
+// a human to confirm on a device is not held to the deadline of a network
+// round trip. Each phase is timed from when it starts; zero means no limit.
+//
+// The partial signature phase uses Approval when the session requires
+// on-device approval or any signer reported a device that asks for it at
+// commitment time, and Partials otherwise.
+type Timeouts struct {
+	Commitments Duration `json:"commitments,omitempty"`
+	Approval    Duration `json:"approval,omitempty"`
+	Partials    Duration `json:"partials,omitempty"`
+	Aggregation Duration `json:"aggregation,omitempty"`
+}
+
+// DefaultTimeouts are the timeouts of a new Coordinator.
+var DefaultTimeouts = Timeouts{
+	Commitments: Duration(2 * time.Minute),
+	Approval:    Duration(15 * time.Minute),
+	Partials:    Duration(2 * time.Minute),
+	Aggregation: Duration(10 * time.Second),
+}
+
+// merge returns t with the non-zero fields of o.
+func (t Timeouts) merge(o *Timeouts) Timeouts {
+	if o == nil {
+		return t
+	}
+	for _, f := range []struct{ dst, src *Duration }{
+		{&t.Commitments, &o.Commitments},
+		{&t.Approval, &o.Approval},
+		{&t.Partials, &o.Partials},
+		{&t.Aggregation, &o.Aggregation},
+	} {
+		if *f.src != 0 {
+			*f.dst = *f.src
+		}
+	}
+	return t
+}
+
+// of returns the timeout of a phase.
+func (t Timeouts) of(p Phase) time.Duration {
+	switch p {
+	case PhaseCommitments:
+		return time.Duration(t.Commitments)
+	case PhaseApproval:
+		return time.Duration(t.Approval)
+	case PhasePartials:
+		return time.Duration(t.Partials)
+	}
+	return time.Duration(t.Aggregation)
+}
+
+// SetTimeouts sets the timeouts of sessions created from now on. Sessions
+// may override individual phases in create_session.
+func (c *Coordinator) SetTimeouts(t Timeouts) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.timeouts = t
+}
+
+// signerTimeout returns signer id's timeout for phase p: its own from
+// signer_timeouts, or the session's.
+func (s *Session) signerTimeout(id int, p Phase) time.Duration {
+	if t, ok := s.SignerTimeouts[id]; ok {
+		return t.of(p)
+	}
+	return s.Timeouts.of(p)
+}
+
+// startPhase records the start of a phase and its deadline. With per-signer
+// timeouts, each signer the phase waits on gets its own deadline and the
+// session's is the earliest of them.
+func (s *Session) startPhase(p Phase, now time.Time) {
+	s.Phase = p
+	s.PhaseStarted = now
+	s.Deadline = nil
+	s.SignerDeadlines = nil
+	if len(s.SignerTimeouts) > 0 && p != PhaseAggregation {
+		s.SignerDeadlines = make(map[int]time.Time)
+		for _, id := range s.missing() {
+			if d := s.signerTimeout(id, p); d > 0 {
+				s.SignerDeadlines[id] = now.Add(d)
+			}
+		}
+		s.updateDeadline()
+		return
+	}
+	if d := s.Timeouts.of(p); d > 0 {
+		deadline := now.Add(d)
+		s.Deadline = &deadline
+	}
+}
+
+// submitted drops signer id's deadline once it has submitted in the current
+// phase.
+func (s *Session) submitted(id int) {
+	if s.SignerDeadlines == nil {
+		return
+	}
+	delete(s.SignerDeadlines, id)
+	s.updateDeadline()
+}
+
+// updateDeadline sets the session's deadline to the earliest signer deadline.
+func (s *Session) updateDeadline() {
+	s.Deadline = nil
+	for _, d := range s.SignerDeadlines {
+		if s.Deadline == nil || d.Before(*s.Deadline) {
+			deadline := d
+			s.Deadline = &deadline
+		}
+	}
+}
+
+// expire fails the session if its current phase is past its deadline.
+// Expiry is checked on every access rather than by a timer, so an idle
+// session reports its timeout the next time anyone looks at it. Callers hold
+// c.mu.
+func (s *Session) expire(now time.Time) {
+	if s.Deadline == nil || !now.After(*s.Deadline) {
+		return
+	}
+	switch s.State {
+	case StateCollectingCommitments, StateCollectingPartials:
+		s.timeout(s.Phase, s.overdue(now), now)
+	}
+}
+
+// overdue lists the signers past their deadline in the current phase: with
+// per-signer timeouts only those whose own deadline passed, otherwise every
+// signer that has not submitted.
+func (s *Session) overdue(now time.Time) []int {
+	if s.SignerDeadlines == nil {
+		return s.missing()
+	}
+	var out []int
+	for _, id := range s.Signers {
+		if d, ok := s.SignerDeadlines[id]; ok && now.After(d) {
+			out = append(out, id)
+		}
+	}
+	return out
+}
+
+// timeout fails the session with a *TimeoutError for phase p, ending it at
+// now.
+func (s *Session) timeout(p Phase, missing []int, now time.Time) {
+	after := s.Timeouts.of(p)
+	if len(missing) > 0 && p != PhaseAggregation {
+		after = s.signerTimeout(missing[0], p)
+	}
+	s.timedOut = &TimeoutError{Session: s.ID, Phase: p, After: after, Missing: missing}
+	s.State = StateFailed
+	s.TimedOut = p
+	s.Error = s.timedOut.Error()
+	s.Deadline = nil
+	s.SignerDeadlines = nil
+	s.ended = now
+}
+
+// missing lists the signers that have not submitted in the current phase.
+func (s *Session) missing() []int {
+	var out []int
+	for _, id := range s.Signers {
+		var ok bool
+		if s.State == StateCollectingCommitments {
+			_, ok = s.Commitments[id]
+		} else {
+			_, ok = s.Partials[id]
+		}
+		if !ok {
+			out = append(out, id)
+		}
+	}
+	return out
+}
+
+// needsApproval reports whether partial signatures wait on a human.
+func (s *Session) needsApproval() bool {
+	if s.RequireDeviceApproval {
+		return true
+	}
+	for _, cm := range s.Commitments {
+		if cm.Approval == apdu.ApprovalDevice {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,254 @@
+package coordinator
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The server side of the WebSocket protocol (RFC 6455), written out by hand
+// like the participant package's protobuf: text messages and the control
+// frames are all the live protocol needs. Extensions and subprotocols are
+// not negotiated.
+
+// wsGUID is the key suffix of the opening handshake.
+const wsGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// Opcodes
+const (
+	wsContinuation = 0x0
+	wsText         = 0x1
+	wsBinary       = 0x2
+	wsClose        = 0x8
+	wsPing         = 0x9
+	wsPong         = 0xA
+)
+
+// Close status codes
+const (
+	wsNormalClosure   = 1000
+	wsProtocolError   = 1002
+	wsUnsupportedData = 1003
+	wsMessageTooBig   = 1009
+)
+
+// wsWriteTimeout bounds each frame write, so a client that stops reading
+// cannot block the connection's pushes forever.
+const wsWriteTimeout = 10 * time.Second
+
+// errWSClosed is returned by readMessage once the client has closed the
+// connection.
+var errWSClosed = errors.New("websocket: closed by peer")
+
+// errWSTooBig is returned by readMessage for a message over its limit.
+var errWSTooBig = errors.New("websocket: message too big")
+
+// wsConn is an established WebSocket connection.
+type wsConn struct {
+	conn net.Conn
+	r    *bufio.Reader
+	mu   sync.Mutex // Serializes frame writes
+
+	// idle, if set, fails a read when no frame arrives within it. Pings
+	// sent meanwhile keep a live client talking.
+	idle time.Duration
+}
+
+// wsUpgrade checks the opening handshake of r and switches the connection
+// to the WebSocket protocol. On failure it answers with an HTTP error.
+func wsUpgrade(w http.ResponseWriter, r *http.Request) (*wsConn, error) {
+	key := r.Header.Get("Sec-WebSocket-Key")
+	switch {
+	case r.Method != http.MethodGet:
+		http.Error(w, "websocket: GET required", http.StatusMethodNotAllowed)
+		return nil, errors.New("websocket: method " + r.Method)
+	case !headerHasToken(r.Header, "Connection", "upgrade") || !headerHasToken(r.Header, "Upgrade", "websocket"):
+		http.Error(w, "websocket: upgrade required", http.StatusUpgradeRequired)
+		return nil, errors.New("websocket: not an upgrade request")
+	case r.Header.Get("Sec-WebSocket-Version") != "13":
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(w, "websocket: unsupported version", http.StatusUpgradeRequired)
+		return nil, errors.New("websocket: unsupported version")
+	}
+	if nonce, err := base64.StdEncoding.DecodeString(key); err != nil || len(nonce) != 16 {
+		http.Error(w, "websocket: malformed Sec-WebSocket-Key", http.StatusBadRequest)
+		return nil, errors.New("websocket: malformed key")
+	}
+
+	conn, rw, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		http.Error(w, "websocket: connection cannot be upgraded", http.StatusInternalServerError)
+		return nil, err
+	}
+	conn.SetDeadline(time.Time{})
+	sum := sha1.Sum([]byte(key + wsGUID))
+	fmt.Fprintf(rw, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: %s\r\n\r\n",
+		base64.StdEncoding.EncodeToString(sum[:]))
+	if err := rw.Flush(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &wsConn{conn: conn, r: rw.Reader}, nil
+}
+
+// headerHasToken reports whether a comma-separated header lists token,
+// case-insensitively.
+func headerHasToken(h http.Header, name, token string) bool {
+	for _, v := range h.Values(name) {
+		for t := range strings.SplitSeq(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// readMessage returns the next text message of at most limit bytes,
+// answering pings and reassembling fragments on the way. Clients must mask
+// their frames. Protocol violations close the connection with the matching
+// status.
+func (c *wsConn) readMessage(limit int) ([]byte, error) {
+	var msg []byte
+	fragmented := false
+	for {
+		fin, op, payload, err := c.readFrame(limit)
+		if err != nil {
+			if errors.Is(err, errWSTooBig) {
+				c.close(wsMessageTooBig, "message too big")
+			} else if !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) && !errors.Is(err, os.ErrDeadlineExceeded) {
+				c.close(wsProtocolError, err.Error())
+			}
+			return nil, err
+		}
+		switch op {
+		case wsPing:
+			if err := c.writeFrame(wsPong, payload); err != nil {
+				return nil, err
+			}
+			continue
+		case wsPong:
+			continue
+		case wsClose:
+			c.close(wsNormalClosure, "")
+			return nil, errWSClosed
+		case wsBinary:
+			c.close(wsUnsupportedData, "text messages only")
+			return nil, errors.New("websocket: binary message")
+		case wsText:
+			if fragmented {
+				c.close(wsProtocolError, "new message inside a fragmented one")
+				return nil, errors.New("websocket: interleaved message")
+			}
+			msg = payload
+		case wsContinuation:
+			if !fragmented {
+				c.close(wsProtocolError, "continuation without a message")
+				return nil, errors.New("websocket: stray continuation")
+			}
+			if len(msg)+len(payload) > limit {
+				c.close(wsMessageTooBig, "message too big")
+				return nil, errWSTooBig
+			}
+			msg = append(msg, payload...)
+		default:
+			c.close(wsProtocolError, "unknown opcode")
+			return nil, fmt.Errorf("websocket: opcode %#x", op)
+		}
+		if fin {
+			return msg, nil
+		}
+		fragmented = true
+	}
+}
+
+// readFrame reads one frame and unmasks its payload.
+func (c *wsConn) readFrame(limit int) (fin bool, op byte, payload []byte, err error) {
+	if c.idle > 0 {
+		c.conn.SetReadDeadline(time.Now().Add(c.idle))
+	}
+	var hdr [2]byte
+	if _, err = io.ReadFull(c.r, hdr[:]); err != nil {
+		return
+	}
+	fin, op = hdr[0]&0x80 != 0, hdr[0]&0x0F
+	if hdr[0]&0x70 != 0 {
+		return fin, op, nil, errors.New("websocket: reserved bits set")
+	}
+	if hdr[1]&0x80 == 0 {
+		return fin, op, nil, errors.New("websocket: unmasked client frame")
+	}
+	size := uint64(hdr[1] & 0x7F)
+	switch size {
+	case 126:
+		var ext [2]byte
+		if _, err = io.ReadFull(c.r, ext[:]); err != nil {
+			return
+		}
+		size = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err = io.ReadFull(c.r, ext[:]); err != nil {
+			return
+		}
+		size = binary.BigEndian.Uint64(ext[:])
+	}
+	if op >= wsClose && (!fin || size > 125) {
+		return fin, op, nil, errors.New("websocket: malformed control frame")
+	}
+	if size > uint64(limit) {
+		return fin, op, nil, errWSTooBig
+	}
+	var mask [4]byte
+	if _, err = io.ReadFull(c.r, mask[:]); err != nil {
+		return
+	}
+	payload = make([]byte, size)
+	if _, err = io.ReadFull(c.r, payload); err != nil {
+		return
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return fin, op, payload, nil
+}
+
+// writeFrame writes one unfragmented, unmasked frame.
+func (c *wsConn) writeFrame(op byte, payload []byte) error {
+	hdr := []byte{0x80 | op, 0}
+	switch n := len(payload); {
+	case n <= 125:
+		hdr[1] = byte(n)
+	case n <= 0xFFFF:
+		hdr[1] = 126
+		hdr = binary.BigEndian.AppendUint16(hdr, uint16(n))
+	default:
+		hdr[1] = 127
+		hdr = binary.BigEndian.AppendUint64(hdr, uint64(n))
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+	_, err := (&net.Buffers{hdr, payload}).WriteTo(c.conn)
+	return err
+}
+
+// close sends a close frame with status and reason, then closes the
+// connection without waiting for the client's answer.
+func (c *wsConn) close(status uint16, reason string) {
+	if len(reason) > 123 {
+		reason = reason[:123]
+	}
+	c.writeFrame(wsClose, append(binary.BigEndian.AppendUint16(nil, status), reason...))
+	c.conn.Close()
+}
@@ -0,0 +1,478 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+
+	"github.com/f3rmion/fy-ledger/corpus"
+
+	"keygen/apdu"
+	"keygen/drbg"
+	"keygen/frostcore"
+	"keygen/h2c"
+	"keygen/simdevice"
+)
+
+// corpusSeed is the default seed of corpus write, so regenerating the corpus
+// with an unchanged implementation changes no file.
+const corpusSeed = "fy-ledger/corpus/v1"
+
+// corpusConfigs are the thresholds the corpus has signing vectors for.
+var corpusConfigs = []struct{ t, n int }{{2, 3}, {3, 5}}
+
+// CorpusCheck is one corpus file checked by corpus check.
+type CorpusCheck struct {
+	Kind   string `json:"kind"` // h2c, frost, apdu or repro
+	Name   string `json:"name"`
+	Pass   bool   `json:"pass"`
+	Detail string `json:"detail,omitempty"` // Why it failed
+}
+
+const corpusUsage = "Usage: keygen corpus <write|check|fuzz> [options]"
+
+// runCorpus implements the corpus subcommands:
+//
+//	corpus write [-dir d] [-seed hex]   regenerate the vectors and reproducer bundles
+//	corpus check [-json]                check the embedded corpus against this tooling
+//	corpus fuzz [-dir d] [-seed hex]    write a corpus for the app's fuzz harness (see runCorpusFuzz)
+//
+// write leaves the hand-written APDU scripts alone.
+func runCorpus(args []string) {
+	if len(args) < 1 {
+		fail(KindUsage, corpusUsage)
+	}
+	switch args[0] {
+	case "write":
+		cmd := flag.NewFlagSet("corpus write", flag.ExitOnError)
+		dir := cmd.String("dir", filepath.Join("..", "..", "corpus", "data"), "Corpus data directory (the default is relative to scripts/keygen)")
+		seed := cmd.String("seed", hex.EncodeToString([]byte(corpusSeed)), "Hex seed all keys, messages and device randomness derive from")
+		stdioFlags(cmd)
+		cmd.Parse(args[1:])
+		seedBytes, err := hex.DecodeString(*seed)
+		if err != nil || len(seedBytes) == 0 {
+			fail(KindInput, "Error: -seed: expected non-empty hex")
+		}
+		if err := writeCorpus(*dir, seedBytes); err != nil {
+			fail(KindFailure, "Error: %v", err)
+		}
+
+	case "check":
+		cmd := flag.NewFlagSet("corpus check", flag.ExitOnError)
+		asJSON := cmd.Bool("json", false, "Print JSON instead of text")
+		stdioFlags(cmd)
+		cmd.Parse(args[1:])
+		checks, err := checkCorpus()
+		if err != nil {
+			fail(KindInput, "Error reading corpus: %v", err)
+		}
+		pass := true
+		for _, c := range checks {
+			pass = pass && c.Pass
+		}
+		if *asJSON {
+			writeJSON(checks)
+		} else {
+			w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+			fmt.Fprintln(w, "KIND\tNAME\tRESULT")
+			for _, c := range checks {
+				result := "ok"
+				if !c.Pass {
+					result = "FAIL: " + c.Detail
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s\n", c.Kind, c.Name, result)
+			}
+			w.Flush()
+		}
+		if !pass {
+			fail(KindCrypto, "Corpus check failed")
+		}
+
+	case "fuzz":
+		runCorpusFuzz(args[1:])
+
+	default:
+		fail(KindUsage, corpusUsage)
+	}
+}
+
+// signingInputs are what a signing vector is computed from.
+type signingInputs struct {
+	name       string
+	t, n       int
+	secret     *big.Int
+	shares     []*big.Int // Participant i+1's at i
+	msg        []byte
+	randomness map[int][]byte // Hiding || binding nonce randomness by signer
+}
+
+// seededInputs derives the inputs of the t-of-n vector from seed. The first
+// t participants sign.
+func seededInputs(seed []byte, t, n int) (*signingInputs, error) {
+	in := &signingInputs{name: fmt.Sprintf("%d-of-%d", t, n), t: t, n: n, msg: make([]byte, 32), randomness: make(map[int][]byte)}
+	random := drbg.New(seed, in.name+"/keygen")
+	var err error
+	if in.secret, err = frostcore.RandomScalar(random); err != nil {
+		return nil, err
+	}
+	if in.shares, err = frostcore.Split(in.secret, t, n, random); err != nil {
+		return nil, err
+	}
+	drbg.New(seed, in.name+"/message").Read(in.msg)
+	for id := 1; id <= t; id++ {
+		in.randomness[id] = make([]byte, 2*frostcore.NonceSeedSize)
+		drbg.New(seed, fmt.Sprintf("%s/device/%d", in.name, id)).Read(in.randomness[id])
+	}
+	return in, nil
+}
+
+// vectorInputs reads the inputs back from a vector, to recompute it.
+func vectorInputs(v *corpus.SigningVector) (*signingInputs, error) {
+	in := &signingInputs{name: v.Name, t: v.Threshold, n: v.Total, randomness: make(map[int][]byte)}
+	var err error
+	if in.secret, err = frostcore.ParseScalar("group_secret_key", v.GroupSecretKey); err != nil {
+		return nil, err
+	}
+	for i, s := range v.Shares {
+		if s.ID != i+1 {
+			return nil, fmt.Errorf("participant_shares: entry %d is participant %d", i, s.ID)
+		}
+		share, err := frostcore.ParseScalar("participant_share", s.Share)
+		if err != nil {
+			return nil, err
+		}
+		in.shares = append(in.shares, share)
+	}
+	if in.msg, err = frostcore.ParseBytes("message", v.Message, 32); err != nil {
+		return nil, err
+	}
+	for _, s := range v.Signers {
+		if s.ID < 1 || s.ID > len(in.shares) {
+			return nil, fmt.Errorf("signers: participant %d has no share", s.ID)
+		}
+		hiding, err := frostcore.ParseBytes("hiding_nonce_randomness", s.HidingNonceRandomness, frostcore.NonceSeedSize)
+		if err != nil {
+			return nil, err
+		}
+		binding, err := frostcore.ParseBytes("binding_nonce_randomness", s.BindingNonceRandomness, frostcore.NonceSeedSize)
+		if err != nil {
+			return nil, err
+		}
+		in.randomness[s.ID] = append(hiding, binding...)
+	}
+	return in, nil
+}
+
+// signingVector computes the vector of in with frostcore, checking that the
+// signature verifies.
+func signingVector(in *signingInputs) (*corpus.SigningVector, error) {
+	groupKey := frostcore.BasePoint(in.secret)
+	v := &corpus.SigningVector{
+		Name:           in.name,
+		Threshold:      in.t,
+		Total:          in.n,
+		GroupSecretKey: hex.EncodeToString(frostcore.ScalarBytes(in.secret)),
+		GroupPublicKey: hex.EncodeToString(groupKey),
+		Message:        hex.EncodeToString(in.msg),
+	}
+	for i, s := range in.shares {
+		v.Shares = append(v.Shares, corpus.ParticipantShare{
+			ID:          i + 1,
+			Share:       hex.EncodeToString(frostcore.ScalarBytes(s)),
+			PublicShare: hex.EncodeToString(frostcore.BasePoint(s)),
+		})
+	}
+
+	var list []frostcore.Commitment
+	nonces := make(map[int][2]*big.Int)
+	for id := 1; id <= in.n; id++ {
+		r, ok := in.randomness[id]
+		if !ok {
+			continue
+		}
+		d := frostcore.NonceGenerate(r[:frostcore.NonceSeedSize], in.shares[id-1], nil)
+		e := frostcore.NonceGenerate(r[frostcore.NonceSeedSize:], in.shares[id-1], nil)
+		nonces[id] = [2]*big.Int{d, e}
+		list = append(list, frostcore.Commitment{ID: frostcore.IDBytes(uint16(id)), Hiding: frostcore.BasePoint(d), Binding: frostcore.BasePoint(e)})
+	}
+	if len(list) < in.t {
+		return nil, fmt.Errorf("%s: %d signers for threshold %d", in.name, len(list), in.t)
+	}
+	trace, err := frostcore.NewTrace(in.msg, groupKey, list, nil)
+	if err != nil {
+		return nil, err
+	}
+	v.CommitmentList = hex.EncodeToString(trace.CommitmentList)
+	v.GroupCommitment = hex.EncodeToString(trace.GroupCommitment)
+	v.Challenge = hex.EncodeToString(frostcore.ScalarBytes(trace.Challenge))
+
+	z := new(big.Int)
+	for i, p := range trace.Participants {
+		id := int(p.ID)
+		zi := frostcore.PartialSig(nonces[id][0], nonces[id][1], p.BindingFactor, in.shares[id-1], trace.Challenge, p.Lambda)
+		z.Add(z, zi)
+		v.Signers = append(v.Signers, corpus.SignerVector{
+			ID:                     id,
+			HidingNonceRandomness:  hex.EncodeToString(in.randomness[id][:frostcore.NonceSeedSize]),
+			BindingNonceRandomness: hex.EncodeToString(in.randomness[id][frostcore.NonceSeedSize:]),
+			HidingNonce:            hex.EncodeToString(frostcore.ScalarBytes(nonces[id][0])),
+			BindingNonce:           hex.EncodeToString(frostcore.ScalarBytes(nonces[id][1])),
+			HidingNonceCommitment:  hex.EncodeToString(list[i].Hiding),
+			BindingNonceCommitment: hex.EncodeToString(list[i].Binding),
+			BindingFactor:          hex.EncodeToString(frostcore.ScalarBytes(p.BindingFactor)),
+			Lambda:                 hex.EncodeToString(frostcore.ScalarBytes(p.Lambda)),
+			SigShare:               hex.EncodeToString(frostcore.ScalarBytes(zi)),
+		})
+	}
+	zBytes := frostcore.ScalarBytes(z)
+	valid, err := frostcore.Verify(groupKey, in.msg, trace.GroupCommitment, zBytes)
+	if err != nil {
+		return nil, err
+	}
+	if !valid {
+		return nil, fmt.Errorf("%s: signature does not verify", in.name)
+	}
+	v.Signature = hex.EncodeToString(trace.GroupCommitment) + hex.EncodeToString(zBytes)
+	return v, nil
+}
+
+// signingScript runs a signer's session of v on a simulated device fed
+// random, and returns it as a script with the device's responses. The
+// device must agree with v on the commitments and the signature share.
+func signingScript(v *corpus.SigningVector, s corpus.SignerVector, share *big.Int, random []byte) (*corpus.Script, error) {
+	groupKey, _ := hex.DecodeString(v.GroupPublicKey)
+	msg, _ := hex.DecodeString(v.Message)
+	list, _ := hex.DecodeString(v.CommitmentList)
+
+	type step struct {
+		comment string
+		command []byte
+	}
+	steps := []step{
+		{"INJECT_KEYS", injectKeysAPDU(groupKey, uint16(s.ID), share, "")},
+		{"GET_PUBLIC_KEY", apdu.Command(apdu.InsGetPublicKey, 0, 0, nil)},
+		{"COMMIT", apdu.Command(apdu.InsCommit, 0, 0, nil)},
+		{"INJECT_MESSAGE", apdu.Command(apdu.InsInjectMessage, 0, 0, msg)},
+	}
+	frames, err := apdu.CommitmentFrames(list, 0)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range frames {
+		steps = append(steps, step{"INJECT_COMMITMENTS", f})
+	}
+	steps = append(steps, step{"PARTIAL_SIGN", apdu.Command(apdu.InsPartialSign, 0, 0, nil)})
+
+	rng := bytes.NewReader(random)
+	dev := simdevice.New()
+	dev.Rand = rng
+	script := &corpus.Script{Name: fmt.Sprintf("participant-%d", s.ID)}
+	for _, st := range steps {
+		resp := dev.Exchange(st.command)
+		data, sw := apdu.SplitResponse(resp)
+		if sw != apdu.SwOK {
+			return nil, fmt.Errorf("participant %d: %s: %s", s.ID, st.comment, apdu.ExplainStatus(sw, st.command[1]))
+		}
+		var want string
+		switch st.command[1] {
+		case apdu.InsCommit:
+			want = s.HidingNonceCommitment + s.BindingNonceCommitment
+		case apdu.InsPartialSign:
+			want = s.SigShare
+		}
+		if want != "" && hex.EncodeToString(data) != want {
+			return nil, fmt.Errorf("participant %d: %s: simdevice returned %x, frostcore computed %s", s.ID, st.comment, data, want)
+		}
+		script.Steps = append(script.Steps, corpus.Step{Comment: st.comment, Command: st.command, Expected: resp})
+	}
+	if rng.Len() != 0 {
+		return nil, fmt.Errorf("participant %d: the device drew %d bytes of randomness, not %d", s.ID, len(random)-rng.Len(), len(random))
+	}
+	return script, nil
+}
+
+// writeCorpus regenerates the h2c vectors, the signing vectors and their
+// reproducer bundles under dir.
+func writeCorpus(dir string, seed []byte) error {
+	if err := h2c.CheckVectors(); err != nil {
+		return err
+	}
+	if err := writeCorpusJSON(filepath.Join(dir, "h2c", "vectors.json"), h2c.Vectors); err != nil {
+		return err
+	}
+	for _, c := range corpusConfigs {
+		in, err := seededInputs(seed, c.t, c.n)
+		if err != nil {
+			return err
+		}
+		v, err := signingVector(in)
+		if err != nil {
+			return err
+		}
+		if err := writeCorpusJSON(filepath.Join(dir, "frost", v.Name+".json"), v); err != nil {
+			return err
+		}
+
+		b := corpus.Bundle{
+			Description: fmt.Sprintf("Signing vector %s on simulated devices, one script per signer", v.Name),
+			Vector:      v.Name,
+		}
+		bundleDir := filepath.Join(dir, "repro", "sign-"+v.Name)
+		for _, s := range v.Signers {
+			script, err := signingScript(v, s, in.shares[s.ID-1], in.randomness[s.ID])
+			if err != nil {
+				return fmt.Errorf("%s: %w", v.Name, err)
+			}
+			d := corpus.BundleDevice{ID: s.ID, Random: hex.EncodeToString(in.randomness[s.ID]), ScriptFile: script.Name + ".apdu"}
+			if err := writeCorpusFile(filepath.Join(bundleDir, d.ScriptFile), script.Format()); err != nil {
+				return err
+			}
+			b.Devices = append(b.Devices, d)
+		}
+		if err := writeCorpusJSON(filepath.Join(bundleDir, "bundle.json"), b); err != nil {
+			return err
+		}
+		for _, share := range in.shares {
+			share.SetInt64(0)
+		}
+		in.secret.SetInt64(0)
+	}
+	return nil
+}
+
+func writeCorpusJSON(path string, v any) error {
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeCorpusFile(path, append(b, '\n'))
+}
+
+func writeCorpusFile(path string, b []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, b, 0644); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Wrote %s\n", path)
+	return nil
+}
+
+// checkCorpus recomputes every vector of the embedded corpus and replays
+// its scripts and bundles on simulated devices.
+func checkCorpus() ([]CorpusCheck, error) {
+	var checks []CorpusCheck
+	add := func(kind, name string, err error) {
+		c := CorpusCheck{Kind: kind, Name: name, Pass: err == nil}
+		if err != nil {
+			c.Detail = err.Error()
+		}
+		checks = append(checks, c)
+	}
+
+	h2cVectors, err := corpus.H2CVectors()
+	if err != nil {
+		return nil, err
+	}
+	for i, v := range h2cVectors {
+		add("h2c", fmt.Sprintf("%d", i), h2c.CheckVector(h2c.Vector(v)))
+	}
+
+	vectors, err := corpus.SigningVectors()
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range vectors {
+		add("frost", v.Name, checkSigningVector(&v))
+	}
+
+	scripts, err := corpus.Scripts()
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range scripts {
+		add("apdu", s.Name, replayScript(simdevice.New(), s))
+	}
+
+	bundles, err := corpus.Bundles()
+	if err != nil {
+		return nil, err
+	}
+	for _, b := range bundles {
+		for _, d := range b.Devices {
+			add("repro", d.Script.Name, replayBundleDevice(d))
+		}
+	}
+	return checks, nil
+}
+
+// checkSigningVector recomputes v from its inputs and reports the first
+// field that differs.
+func checkSigningVector(v *corpus.SigningVector) error {
+	in, err := vectorInputs(v)
+	if err != nil {
+		return err
+	}
+	got, err := signingVector(in)
+	if err != nil {
+		return err
+	}
+	var want, have map[string]json.RawMessage
+	b, _ := json.Marshal(v)
+	json.Unmarshal(b, &want)
+	b, _ = json.Marshal(got)
+	json.Unmarshal(b, &have)
+	for k := range want {
+		if !bytes.Equal(want[k], have[k]) {
+			return fmt.Errorf("%s: got %s, want %s", k, have[k], want[k])
+		}
+	}
+	return nil
+}
+
+func replayBundleDevice(d corpus.BundleDevice) error {
+	random, err := hex.DecodeString(d.Random)
+	if err != nil {
+		return fmt.Errorf("random: %w", err)
+	}
+	rng := bytes.NewReader(random)
+	dev := simdevice.New()
+	dev.Rand = rng
+	if err := replayScript(dev, d.Script); err != nil {
+		return err
+	}
+	if rng.Len() != 0 {
+		return fmt.Errorf("the device drew %d bytes of randomness, not %d", len(random)-rng.Len(), len(random))
+	}
+	return nil
+}
+
+// replayScript sends each step of s to dev and compares the response.
+func replayScript(dev *simdevice.Device, s *corpus.Script) (err error) {
+	defer func() {
+		// An RNG that runs dry panics inside the device
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+	for _, step := range s.Steps {
+		resp := dev.Exchange(step.Command)
+		if step.Expected == nil {
+			if _, sw := apdu.SplitResponse(resp); sw != apdu.SwOK {
+				return fmt.Errorf("line %d: %s returned %04X %s", step.Line, apdu.InsName(step.Command[1]), sw, apdu.ExplainStatus(sw, step.Command[1]).Name)
+			}
+			continue
+		}
+		if diff := apdu.CompareResponse(step.Command[1], step.Expected, resp); !diff.Equal() {
+			return fmt.Errorf("line %d: %s: %s", step.Line, apdu.InsName(step.Command[1]), diff)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,397 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/f3rmion/fy/frost"
+
+	"keygen/apdu"
+	"keygen/drbg"
+	"keygen/frostcore"
+	"keygen/simdevice"
+)
+
+// FuzzManifest is manifest.json of a corpus written by corpus fuzz.
+type FuzzManifest struct {
+	Seed     string      `json:"seed"`
+	GroupKey string      `json:"group_key"` // Of the DKG the sessions inject participant 1 of
+	Inputs   []FuzzInput `json:"inputs"`
+}
+
+// FuzzInput is one corpus file: a session of APDUs sent to a device
+// without keys, the last of them the one the file exercises.
+type FuzzInput struct {
+	File     string `json:"file"`               // Relative to the corpus directory
+	Ins      string `json:"ins"`                // Instruction of the last APDU
+	Session  string `json:"session"`            // The valid session it derives from
+	Mutation string `json:"mutation,omitempty"` // Empty for the valid session itself
+	Frames   int    `json:"frames"`
+	SW       string `json:"sw"` // simdevice's status word for the last APDU
+}
+
+// fuzzSession is a valid sequence of APDUs from a device without keys.
+type fuzzSession struct {
+	name   string
+	frames [][]byte
+}
+
+// fuzzMutation rewrites the last APDU of a session, or returns nil if it
+// does not apply to it.
+type fuzzMutation struct {
+	name   string
+	mutate func(command []byte) []byte
+}
+
+// runCorpusFuzz writes a corpus for the app's APDU parser fuzz harness:
+//
+//	corpus fuzz [-dir d] [-seed hex] [-t 2] [-n 3] [-bitflips 8]
+//
+// The sessions drive participant 1's device through every instruction with
+// keys from a t-of-n DKG, commitment lists of 2, t and 15 participants, and
+// the list split into frames of the largest size and of one entry. Each
+// session is written as is and with its last APDU mutated: the CLA, P1 and
+// P2 off by one, Lc off by one, zero or 255 over unchanged data, the data
+// one byte short or long with a matching Lc, the header alone, and
+// -bitflips single bit flips of the data. Commitment lists are also cut by
+// an entry and sent without their first frame. Everything derives from the
+// seed, so the same seed writes the same files.
+//
+// A file is the session's APDUs, each after its length as two bytes, big
+// endian, so a mutated Lc does not lose the framing. manifest.json lists
+// each file with the status word simdevice answers its last APDU with.
+func runCorpusFuzz(args []string) {
+	cmd := flag.NewFlagSet("corpus fuzz", flag.ExitOnError)
+	dir := cmd.String("dir", "fuzz-corpus", "Directory to write; must not exist or be empty")
+	seed := cmd.String("seed", hex.EncodeToString([]byte(corpusSeed)), "Hex seed the DKG, messages, commitments and mutations derive from")
+	t := cmd.Int("t", 2, "Threshold of the DKG")
+	n := cmd.Int("n", 3, "Participants of the DKG")
+	bitflips := cmd.Int("bitflips", 8, "Single bit flips per valid APDU")
+	stdioFlags(cmd)
+	cmd.Parse(args)
+	if cmd.NArg() != 0 {
+		fail(KindUsage, "Usage: keygen corpus fuzz [-dir d] [-seed hex] [-t 2] [-n 3] [-bitflips 8]")
+	}
+	seedBytes, err := hex.DecodeString(*seed)
+	if err != nil || len(seedBytes) == 0 {
+		fail(KindInput, "Error: -seed: expected non-empty hex")
+	}
+	if *t < 2 || *t > *n || *n > apdu.MaxParticipants {
+		fail(KindUsage, "Error: invalid threshold %d of %d (devices sign with 2 to %d participants)", *t, *n, apdu.MaxParticipants)
+	}
+	if *bitflips < 0 {
+		fail(KindUsage, "Error: -bitflips must not be negative")
+	}
+	if entries, err := os.ReadDir(*dir); err == nil && len(entries) > 0 {
+		fail(KindInput, "Error: %s is not empty", *dir)
+	}
+
+	groupKey, share, err := fuzzDKG(seedBytes, *t, *n)
+	if err != nil {
+		fail(KindCrypto, "Error: %v", err)
+	}
+	sessions, err := fuzzSessions(seedBytes, groupKey, share, *t)
+	share.SetInt64(0)
+	if err != nil {
+		fail(KindCrypto, "Error: %v", err)
+	}
+	manifest := FuzzManifest{Seed: *seed, GroupKey: hex.EncodeToString(groupKey)}
+	flips := drbg.New(seedBytes, "fuzz/bitflips")
+	seen := make(map[string]bool)
+	add := func(s fuzzSession, mutation string) {
+		key := string(fuzzFile(s.frames))
+		if seen[key] {
+			return
+		}
+		seen[key] = true
+		last := s.frames[len(s.frames)-1]
+		ins := strings.ToLower(apdu.InsName(last[1]))
+		name := s.name
+		if mutation != "" {
+			name += "." + mutation
+		}
+		in := FuzzInput{
+			File:     filepath.ToSlash(filepath.Join(ins, name+".bin")),
+			Ins:      apdu.InsName(last[1]),
+			Session:  s.name,
+			Mutation: mutation,
+			Frames:   len(s.frames),
+			SW:       fmt.Sprintf("%04X", fuzzReplay(seedBytes, s.frames)),
+		}
+		path := filepath.Join(*dir, filepath.FromSlash(in.File))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			fail(KindFailure, "Error: %v", err)
+		}
+		if err := os.WriteFile(path, fuzzFile(s.frames), 0644); err != nil {
+			fail(KindFailure, "Error: %v", err)
+		}
+		manifest.Inputs = append(manifest.Inputs, in)
+	}
+	for _, s := range sessions {
+		add(s, "")
+		last := len(s.frames) - 1
+		mutations := append(fuzzMutations(), fuzzBitflips(flips, s.frames[last], *bitflips)...)
+		for _, m := range mutations {
+			if mutated := m.mutate(append([]byte(nil), s.frames[last]...)); mutated != nil {
+				frames := append(s.frames[:last:last], mutated)
+				add(fuzzSession{s.name, frames}, m.name)
+			}
+		}
+		for _, m := range fuzzListMutations(s) {
+			add(fuzzSession{s.name, m.frames}, m.name)
+		}
+	}
+	if err := writeCorpusJSON(filepath.Join(*dir, "manifest.json"), manifest); err != nil {
+		fail(KindFailure, "Error: %v", err)
+	}
+	fmt.Fprintf(os.Stderr, "Wrote %d inputs from %d sessions to %s\n", len(manifest.Inputs), len(sessions), *dir)
+}
+
+// fuzzDKG runs a t-of-n DKG in process, as keygen does, and returns the
+// group key and participant 1's share.
+func fuzzDKG(seed []byte, t, n int) ([]byte, *big.Int, error) {
+	random := drbg.New(seed, fmt.Sprintf("fuzz/dkg/%d-of-%d", t, n))
+	f, err := newFROST(t, n)
+	if err != nil {
+		return nil, nil, err
+	}
+	participants := make([]*frost.Participant, n)
+	broadcasts := make([]*frost.Round1Data, n)
+	private := make([][]*frost.Round1PrivateData, n)
+	for i := range participants {
+		if participants[i], err = f.NewParticipant(random, i+1); err != nil {
+			return nil, nil, fmt.Errorf("participant %d: %w", i+1, err)
+		}
+		broadcasts[i] = participants[i].Round1Broadcast()
+		private[i] = make([]*frost.Round1PrivateData, n)
+		for j := range participants {
+			if i != j {
+				private[i][j] = f.Round1PrivateSend(participants[i], j+1)
+			}
+		}
+	}
+	for i := range participants {
+		for j := range participants {
+			if i != j {
+				if err := f.Round2ReceiveShare(participants[i], private[j][i], broadcasts[j].Commitments); err != nil {
+					return nil, nil, fmt.Errorf("round 2: %w", err)
+				}
+			}
+		}
+	}
+	keyShare, err := f.Finalize(participants[0], broadcasts)
+	if err != nil {
+		return nil, nil, fmt.Errorf("finalizing: %w", err)
+	}
+	return keyShare.GroupKey.Bytes(), new(big.Int).SetBytes(keyShare.SecretKey.Bytes()), nil
+}
+
+// fuzzSessions builds the valid sessions of participant 1's device.
+func fuzzSessions(seed, groupKey []byte, share *big.Int, t int) ([]fuzzSession, error) {
+	random := drbg.New(seed, "fuzz/sessions")
+	msg := make([]byte, 32)
+	random.Read(msg)
+	challenge := make([]byte, 32)
+	random.Read(challenge)
+	// Commitments of participants 1 to 15; the device signs with any valid
+	// points under its identifier
+	commitments := make([]frostcore.Commitment, apdu.MaxParticipants)
+	for i := range commitments {
+		d, err := frostcore.RandomScalar(random)
+		if err != nil {
+			return nil, err
+		}
+		e, err := frostcore.RandomScalar(random)
+		if err != nil {
+			return nil, err
+		}
+		commitments[i] = frostcore.Commitment{ID: frostcore.IDBytes(uint16(i + 1)), Hiding: frostcore.BasePoint(d), Binding: frostcore.BasePoint(e)}
+	}
+	frames := func(n, chunkSize int) ([][]byte, error) {
+		return apdu.CommitmentFrames(frostcore.EncodeCommitments(commitments[:n]), chunkSize)
+	}
+
+	inject := injectKeysAPDU(groupKey, 1, share, "")
+	commit := apdu.Command(apdu.InsCommit, 0, 0, nil)
+	message := apdu.Command(apdu.InsInjectMessage, 0, 0, msg)
+	sign := apdu.Command(apdu.InsPartialSign, 0, 0, nil)
+	session := func(name string, frames ...[]byte) fuzzSession {
+		return fuzzSession{name, frames}
+	}
+	join := func(parts ...[][]byte) [][]byte {
+		var out [][]byte
+		for _, p := range parts {
+			out = append(out, p...)
+		}
+		return out
+	}
+	started := [][]byte{inject, commit, message}
+
+	sessions := []fuzzSession{
+		session("get-version", apdu.Command(apdu.InsGetVersion, 0, 0, nil)),
+		session("inject-keys", inject),
+		session("inject-keys-purpose", injectKeysAPDU(groupKey, 1, share, "fuzz-purpose-tag")),
+		session("get-public-key", inject, apdu.Command(apdu.InsGetPublicKey, 0, 0, nil)),
+		session("commit", inject, commit),
+		session("inject-message", inject, commit, message),
+		session("reset", inject, commit, apdu.Command(apdu.InsReset, 0, 0, nil)),
+		session("wipe-keys", inject, apdu.Command(apdu.InsWipeKeys, 0, 0, append(append([]byte(nil), groupKey...), frostcore.IDBytes(1)...))),
+	}
+	sizes := []int{2, t, apdu.MaxParticipants}
+	if t == 2 {
+		sizes = sizes[1:]
+	}
+	for _, n := range sizes {
+		for _, chunk := range []int{apdu.MaxChunk, apdu.CommitmentEntrySize} {
+			f, err := frames(n, chunk)
+			if err != nil {
+				return nil, err
+			}
+			name := fmt.Sprintf("commitments-%d-by-%d", n, chunk)
+			// The first frame, and the whole list
+			sessions = append(sessions, fuzzSession{name + "-first", join(started, f[:1])})
+			if len(f) > 1 {
+				sessions = append(sessions, fuzzSession{name, join(started, f)})
+			}
+		}
+	}
+	f, err := frames(t, apdu.MaxChunk)
+	if err != nil {
+		return nil, err
+	}
+	listed := join(started, f)
+	injectChallenge := apdu.Command(apdu.InsInjectChallenge, 0, 0, challenge)
+	return append(sessions,
+		fuzzSession{"partial-sign", join(listed, [][]byte{sign})},
+		fuzzSession{"inject-challenge", join(listed, [][]byte{injectChallenge})},
+		fuzzSession{"partial-sign-challenge", join(listed, [][]byte{injectChallenge, sign})},
+	), nil
+}
+
+// fuzzMutations are the mutations of a session's last APDU.
+func fuzzMutations() []fuzzMutation {
+	data := func(c []byte) []byte {
+		if len(c) < 5 {
+			return nil
+		}
+		return c[5:]
+	}
+	withLc := func(f func(lc byte) byte) func([]byte) []byte {
+		return func(c []byte) []byte {
+			if len(c) < 5 {
+				return nil
+			}
+			c[4] = f(c[4])
+			return c
+		}
+	}
+	return []fuzzMutation{
+		{"cla", func(c []byte) []byte { c[0] ^= 0x01; return c }},
+		{"p1-inc", func(c []byte) []byte { c[2]++; return c }},
+		{"p1-dec", func(c []byte) []byte { c[2]--; return c }},
+		{"p2-inc", func(c []byte) []byte { c[3]++; return c }},
+		{"lc-inc", withLc(func(lc byte) byte { return lc + 1 })},
+		{"lc-dec", withLc(func(lc byte) byte { return lc - 1 })},
+		{"lc-zero", withLc(func(byte) byte { return 0 })},
+		{"lc-max", withLc(func(byte) byte { return 0xFF })},
+		{"data-short", func(c []byte) []byte {
+			if len(data(c)) == 0 {
+				return nil
+			}
+			c[4]--
+			return c[:len(c)-1]
+		}},
+		{"data-long", func(c []byte) []byte {
+			if len(c) < 5 || c[4] == 0xFF {
+				return nil
+			}
+			c[4]++
+			return append(c, 0x00)
+		}},
+		{"data-empty", func(c []byte) []byte {
+			if len(data(c)) == 0 {
+				return nil
+			}
+			c[4] = 0
+			return c[:5]
+		}},
+		{"header-only", func(c []byte) []byte { return c[:4] }},
+	}
+}
+
+// fuzzBitflips returns n mutations each flipping one bit of command's data,
+// drawn from random.
+func fuzzBitflips(random io.Reader, command []byte, n int) []fuzzMutation {
+	if len(command) <= 5 {
+		return nil
+	}
+	var out []fuzzMutation
+	for i := range n {
+		var b [4]byte
+		io.ReadFull(random, b[:])
+		bit := int(binary.BigEndian.Uint32(b[:]) % uint32(8*(len(command)-5)))
+		out = append(out, fuzzMutation{fmt.Sprintf("bitflip-%d", i+1), func(c []byte) []byte {
+			c[5+bit/8] ^= 1 << (bit % 8)
+			return c
+		}})
+	}
+	return out
+}
+
+// fuzzListMutations returns the mutations of a whole commitment list, named
+// by the mutation: the list cut by its last entry, with the first frame's
+// count unchanged, and the list without its first frame.
+func fuzzListMutations(s fuzzSession) []fuzzSession {
+	first := -1
+	for i, f := range s.frames {
+		if f[1] == apdu.InsInjectCommitmentsP1 {
+			first = i
+		}
+	}
+	if first < 0 || first == len(s.frames)-1 || s.frames[len(s.frames)-1][1] != apdu.InsInjectCommitmentsP2 {
+		return nil
+	}
+	var list []byte
+	for _, f := range s.frames[first:] {
+		list = append(list, f[5:]...)
+	}
+	chunk := len(s.frames[first]) - 5
+	short := list[:len(list)-apdu.CommitmentEntrySize]
+	cut := [][]byte{apdu.Command(apdu.InsInjectCommitmentsP1, s.frames[first][2], 0, short[:min(chunk, len(short))])}
+	for off := chunk; off < len(short); off += chunk {
+		cut = append(cut, apdu.Command(apdu.InsInjectCommitmentsP2, 0, 0, short[off:min(off+chunk, len(short))]))
+	}
+	return []fuzzSession{
+		{"missing-entry", append(s.frames[:first:first], cut...)},
+		{"no-first-frame", append(s.frames[:first:first], s.frames[first+1:]...)},
+	}
+}
+
+// fuzzFile encodes a session as a corpus file.
+func fuzzFile(frames [][]byte) []byte {
+	var out []byte
+	for _, f := range frames {
+		out = binary.BigEndian.AppendUint16(out, uint16(len(f)))
+		out = append(out, f...)
+	}
+	return out
+}
+
+// fuzzReplay sends a session to a new simdevice, approving every prompt,
+// and returns the status word of its last APDU.
+func fuzzReplay(seed []byte, frames [][]byte) uint16 {
+	dev := simdevice.New()
+	dev.Rand = drbg.New(seed, "fuzz/device")
+	var sw uint16
+	for _, f := range frames {
+		_, sw = apdu.SplitResponse(dev.Exchange(f))
+	}
+	return sw
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"keygen/workspace"
+)
+
+// commands are the built-in commands; aliases may not shadow them.
+var commands = []string{
+	"keygen", "split", "recover", "recipient-key", "reshare-init", "reshare-contribute", "reshare-finalize", "reshare-codes",
+	"change-threshold", "refresh", "enroll", "commit", "sign", "aggregate", "verify-partial", "select",
+	"simdevice", "speculos-pool", "soak", "reject-test", "debug", "diagnose", "group-state", "timestamp", "translog",
+	"verify", "apdu", "export", "schema", "ctx", "h2c", "nonces", "session", "corpus", "serve",
+	"participant", "standby", "dkg", "audit", "provenance", "bip340", "rfc9591", "hash",
+	"vectors", "share", "test",
+}
+
+// runCtx implements the ctx subcommands:
+//
+//	ctx list                       list contexts; * marks the current one
+//	ctx current                    print the current context's name
+//	ctx show [name]                print a context (default: current)
+//	ctx set <name> [-group-state f] [-group-key hex] [-transport addr|sim]
+//	        [-profile f] [-coordinator url] [-keystore path] [-tsa url]
+//	ctx use <name>                 switch contexts
+//	ctx delete <name>
+//	ctx alias [<name> <command...>]   list aliases, or define one
+//	ctx unalias <name>
+//
+// $FY_LEDGER_CONTEXT overrides the current context for a single command.
+func runCtx(args []string) {
+	if len(args) < 1 {
+		fail(KindUsage, "Usage: keygen ctx <list|current|show|set|use|delete|alias|unalias> [options]")
+	}
+	path, err := workspace.Path()
+	if err != nil {
+		fail(KindFailure, "Error: %v", err)
+	}
+	cfg := loadWorkspace(path)
+
+	switch args[0] {
+	case "list":
+		for _, name := range cfg.Names() {
+			mark := " "
+			if name == cfg.Current {
+				mark = "*"
+			}
+			fmt.Printf("%s %s\n", mark, name)
+		}
+		return
+
+	case "current":
+		name, _, err := cfg.Active()
+		if err != nil {
+			fail(KindInput, "Error: %v", err)
+		}
+		if name == "" {
+			fail(KindInput, "No current context")
+		}
+		fmt.Println(name)
+		return
+
+	case "show":
+		name, ctx, err := cfg.Active()
+		if len(args) > 1 {
+			name, ctx, err = args[1], cfg.Contexts[args[1]], nil
+			if ctx == nil {
+				err = fmt.Errorf("context %q does not exist", name)
+			}
+		}
+		if err == nil && ctx == nil {
+			err = fmt.Errorf("no current context")
+		}
+		if err != nil {
+			fail(KindInput, "Error: %v", err)
+		}
+		writeJSON(ctx)
+		return
+
+	case "set":
+		cmd := flag.NewFlagSet("ctx set", flag.ExitOnError)
+		groupState := cmd.String("group-state", "", "Group-state document; also sets -group-key from it")
+		groupKey := cmd.String("group-key", "", "Group public key (hex); sign refuses other groups")
+		transport := cmd.String("transport", "", "Device address for apdu send, or \"sim\"")
+		profile := cmd.String("profile", "", "CLA/INS profile for apdu commands")
+		coordinator := cmd.String("coordinator", "", "Coordinator URL")
+		keystore := cmd.String("keystore", "", "Keystore path")
+		tsaURL := cmd.String("tsa", "", "RFC 3161 timestamping authority URL for aggregate")
+		logURL := cmd.String("translog", "", "Transparency log URL for translog submit")
+		if len(args) < 2 || strings.HasPrefix(args[1], "-") {
+			fail(KindUsage, "Usage: keygen ctx set <name> [options]")
+		}
+		name := args[1]
+		stdioFlags(cmd)
+		cmd.Parse(args[2:])
+
+		ctx := cfg.Contexts[name]
+		if ctx == nil {
+			ctx = &workspace.Context{}
+			cfg.Contexts[name] = ctx
+		}
+		// Only the given flags change, so a context can be edited field by field
+		cmd.Visit(func(f *flag.Flag) {
+			switch f.Name {
+			case "group-state":
+				ctx.GroupState = *groupState
+			case "group-key":
+				ctx.GroupKey = *groupKey
+			case "transport":
+				ctx.Transport = *transport
+			case "profile":
+				ctx.Profile = *profile
+			case "coordinator":
+				ctx.Coordinator = *coordinator
+			case "keystore":
+				ctx.Keystore = *keystore
+			case "tsa":
+				ctx.TSA = *tsaURL
+			case "translog":
+				ctx.TransLog = *logURL
+			}
+		})
+		if *groupState != "" && *groupKey == "" {
+			ctx.GroupKey = loadGroupState(*groupState).GroupKey
+		}
+		if cfg.Current == "" {
+			cfg.Current = name
+		}
+
+	case "use", "delete":
+		if len(args) != 2 {
+			fail(KindUsage, "Usage: keygen ctx %s <name>", args[0])
+		}
+		if args[0] == "use" {
+			err = cfg.Use(args[1])
+		} else {
+			err = cfg.Delete(args[1])
+		}
+		if err != nil {
+			fail(KindInput, "Error: %v", err)
+		}
+
+	case "alias":
+		if len(args) == 1 {
+			names := make([]string, 0, len(cfg.Aliases))
+			for name := range cfg.Aliases {
+				names = append(names, name)
+			}
+			slices.Sort(names)
+			for _, name := range names {
+				fmt.Printf("%s = %s\n", name, cfg.Aliases[name])
+			}
+			return
+		}
+		if len(args) < 3 {
+			fail(KindUsage, "Usage: keygen ctx alias <name> <command> [args...]")
+		}
+		if slices.Contains(commands, args[1]) {
+			fail(KindInput, "Error: %s is a built-in command", args[1])
+		}
+		if !slices.Contains(commands, args[2]) {
+			fail(KindInput, "Error: unknown command %s", args[2])
+		}
+		cfg.Aliases[args[1]] = strings.Join(args[2:], " ")
+
+	case "unalias":
+		if len(args) != 2 {
+			fail(KindUsage, "Usage: keygen ctx unalias <name>")
+		}
+		if _, ok := cfg.Aliases[args[1]]; !ok {
+			fail(KindInput, "Error: alias %q does not exist", args[1])
+		}
+		delete(cfg.Aliases, args[1])
+
+	default:
+		fail(KindUsage, "Unknown ctx command: %s", args[0])
+	}
+
+	if err := cfg.Save(path); err != nil {
+		fail(KindFailure, "Error writing %s: %v", path, err)
+	}
+	if cfg.Current != "" {
+		fmt.Fprintf(os.Stderr, "Current context: %s\n", cfg.Current)
+	}
+}
+
+func loadWorkspace(path string) *workspace.Config {
+	cfg, err := workspace.Load(path)
+	if err != nil {
+		fail(KindInput, "Error reading config: %v", err)
+	}
+	return cfg
+}
+
+// ceremony is the ceremony file in effect (see workspace.Ceremony), loaded
+// by main before flags are defined.
+var ceremony = &workspace.Ceremony{}
+
+func loadCeremony() *workspace.Ceremony {
+	c, err := workspace.LoadCeremony(workspace.CeremonyPath())
+	if err != nil {
+		fail(KindInput, "Error reading ceremony: %v", err)
+	}
+	return c
+}
+
+// loadContext applies aliases to args and returns the context in effect, or
+// an empty one if none is set. The ctx command itself skips the context so a
+// bad $FY_LEDGER_CONTEXT can still be inspected.
+func loadContext(args []string) ([]string, string, *workspace.Context) {
+	path, err := workspace.Path()
+	if err != nil {
+		return args, "", &workspace.Context{}
+	}
+	cfg := loadWorkspace(path)
+	if len(args) > 1 {
+		if alias, ok := cfg.Aliases[args[1]]; ok {
+			// Aliases split on whitespace; arguments after the alias are appended
+			args = append(append([]string{args[0]}, strings.Fields(alias)...), args[2:]...)
+		}
+	}
+	if len(args) > 1 && args[1] == "ctx" {
+		return args, "", &workspace.Context{}
+	}
+	name, ctx, err := cfg.Active()
+	if err != nil {
+		fail(KindInput, "Error: %v", err)
+	}
+	if ctx == nil {
+		ctx = &workspace.Context{}
+	}
+	return args, name, ctx
+}
+
+// announceContext names the context and ceremony file on stderr before a
+// command that signs, so an operator sees which environment they are about
+// to use.
+func announceContext(name string, ctx *workspace.Context) {
+	if ceremony.Path != "" {
+		fmt.Fprintf(os.Stderr, "Ceremony: %s\n", ceremony.Path)
+	}
+	if name == "" {
+		return
+	}
+	group := workspace.ShortKey(ctx.GroupKey)
+	if group == "" {
+		group = "any"
+	}
+	fmt.Fprintf(os.Stderr, "Context: %s (group %s)\n", name, group)
+}
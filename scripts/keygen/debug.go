@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"keygen/diag"
+)
+
+// debugTokenEnv holds the bearer token of the diagnostics endpoint. It is
+// read from the environment rather than a flag so it does not show in the
+// process list.
+const debugTokenEnv = "FY_LEDGER_DEBUG_TOKEN"
+
+// debugFlag adds -debug-listen to a long-running command.
+func debugFlag(fs *flag.FlagSet) *string {
+	return fs.String("debug-listen", "", "Serve pprof and /debug/dump on this address, guarded by $"+debugTokenEnv)
+}
+
+// serveDebug serves the diagnostics endpoint (diag.Server) on addr, with
+// the service's stats, until the process exits. It does nothing if addr is
+// empty, and fails if no token is set, rather than serve profiles to anyone.
+func serveDebug(addr string, sources map[string]diag.Source) {
+	if addr == "" {
+		return
+	}
+	token := os.Getenv(debugTokenEnv)
+	if token == "" {
+		fail(KindUsage, "Error: -debug-listen requires a token in $%s", debugTokenEnv)
+	}
+	d := diag.New(token)
+	for name, src := range sources {
+		d.Register(name, src)
+	}
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		fail(KindFailure, "Error listening for diagnostics: %v", err)
+	}
+	fmt.Fprintf(os.Stderr, "Diagnostics on http://%s/debug/\n", l.Addr())
+	go http.Serve(l, d.Handler())
+}
+
+// runDebug implements the debug subcommands:
+//
+//	debug dump [-url url] [-stacks]   print a service's runtime diagnostics
+//
+// The token is read from $FY_LEDGER_DEBUG_TOKEN, as by the service.
+func runDebug(args []string) {
+	if len(args) < 1 || args[0] != "dump" {
+		fail(KindUsage, "Usage: keygen debug dump [-url http://127.0.0.1:6060] [-stacks]")
+	}
+	cmd := flag.NewFlagSet("debug dump", flag.ExitOnError)
+	url := cmd.String("url", "http://127.0.0.1:6060", "Diagnostics address of the service (its -debug-listen)")
+	stacks := cmd.Bool("stacks", false, "Include every goroutine's stack")
+	timeout := cmd.Duration("timeout", 30*time.Second, "Give up after this long")
+	stdioFlags(cmd)
+	cmd.Parse(args[1:])
+
+	token := os.Getenv(debugTokenEnv)
+	if token == "" {
+		fail(KindUsage, "Error: set the service's diagnostics token in $%s", debugTokenEnv)
+	}
+	endpoint := strings.TrimSuffix(*url, "/") + "/debug/dump"
+	if *stacks {
+		endpoint += "?stacks=1"
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		fail(KindUsage, "Error: -url: %v", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		fail(KindTransport, "Error: %v", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		fail(KindTransport, "Error reading dump: %v", err)
+	}
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized:
+		fail(KindInput, "Error: %s rejected the token in $%s", *url, debugTokenEnv)
+	case resp.StatusCode != http.StatusOK:
+		fail(KindTransport, "Error: %s: %s", endpoint, resp.Status)
+	}
+
+	var dump diag.Dump
+	if err := json.Unmarshal(body, &dump); err != nil {
+		fail(KindTransport, "Error parsing dump: %v", err)
+	}
+	writeJSON(dump)
+}
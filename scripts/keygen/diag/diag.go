@@ -0,0 +1,154 @@
+// Package diag serves runtime diagnostics for the long-running services
+// (speculos-pool, translog serve, simdevice -listen, coordinator
+// deployments), so an incident can be diagnosed without a restart: the
+// net/http/pprof profiles, and a JSON dump of goroutines, memory and the
+// stats each service registers (session store, nonce pool, leases).
+//
+// Profiles and stacks reveal code paths and memory contents, so every
+// endpoint requires a bearer token, and a server without tokens refuses
+// every request. Serve it on its own listener, not the service's:
+//
+//	d := diag.New(os.Getenv("FY_LEDGER_DEBUG_TOKEN"))
+//	d.Register("coordinator", func() any { return c.Stats() })
+//	go http.ListenAndServe("127.0.0.1:6060", d.Handler())
+package diag
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	rpprof "runtime/pprof"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Source reports one service's stats for a Dump. It is called on every
+// dump, concurrently with the service, and must be safe for that.
+type Source func() any
+
+// Dump is the JSON served at /debug/dump.
+type Dump struct {
+	Time        time.Time      `json:"time"`
+	Uptime      string         `json:"uptime"`
+	Goroutines  int            `json:"goroutines"`
+	HeapInuse   uint64         `json:"heap_inuse"`
+	HeapObjects uint64         `json:"heap_objects"`
+	NumGC       uint32         `json:"num_gc"`
+	Stats       map[string]any `json:"stats,omitempty"`  // By source name
+	Stacks      string         `json:"stacks,omitempty"` // All goroutine stacks, with ?stacks=1
+}
+
+// Server holds the tokens and sources of a diagnostics endpoint.
+type Server struct {
+	start  time.Time
+	tokens [][]byte
+
+	mu      sync.Mutex
+	sources map[string]Source
+}
+
+// New returns a server accepting the given bearer tokens. Empty tokens are
+// ignored.
+func New(tokens ...string) *Server {
+	s := &Server{start: time.Now(), sources: make(map[string]Source)}
+	for _, t := range tokens {
+		if t != "" {
+			s.tokens = append(s.tokens, []byte(t))
+		}
+	}
+	return s
+}
+
+// Register adds a source of stats under name, replacing any of that name.
+func (s *Server) Register(name string, src Source) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sources[name] = src
+}
+
+// Take collects a dump, with every goroutine's stack if stacks is set.
+func (s *Server) Take(stacks bool) *Dump {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	d := &Dump{
+		Time:        time.Now().UTC(),
+		Uptime:      time.Since(s.start).Round(time.Second).String(),
+		Goroutines:  runtime.NumGoroutine(),
+		HeapInuse:   m.HeapInuse,
+		HeapObjects: m.HeapObjects,
+		NumGC:       m.NumGC,
+	}
+
+	s.mu.Lock()
+	names := make([]string, 0, len(s.sources))
+	for name := range s.sources {
+		names = append(names, name)
+	}
+	sources := make([]Source, 0, len(names))
+	slices.Sort(names)
+	for _, name := range names {
+		sources = append(sources, s.sources[name])
+	}
+	s.mu.Unlock()
+	if len(names) > 0 {
+		d.Stats = make(map[string]any, len(names))
+		for i, name := range names {
+			d.Stats[name] = sources[i]()
+		}
+	}
+
+	if stacks {
+		var b bytes.Buffer
+		rpprof.Lookup("goroutine").WriteTo(&b, 2)
+		d.Stacks = b.String()
+	}
+	return d
+}
+
+// Handler serves
+//
+//	GET /debug/dump[?stacks=1]   the Dump as JSON
+//	GET /debug/pprof/...         the net/http/pprof profiles
+//
+// to requests carrying "Authorization: Bearer <token>" with one of the
+// server's tokens; anything else gets 401.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /debug/dump", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		enc.Encode(s.Take(r.URL.Query().Get("stacks") == "1"))
+	})
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !s.authorized(r) {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="diag"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) authorized(r *http.Request) bool {
+	got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return false
+	}
+	match := 0
+	for _, t := range s.tokens {
+		match |= subtle.ConstantTimeCompare([]byte(got), t)
+	}
+	return match == 1
+}
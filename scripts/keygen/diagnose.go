@@ -0,0 +1,200 @@
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"math/big"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"keygen/apdu"
+	"keygen/frostcore"
+	"keygen/schema"
+	"keygen/workspace"
+)
+
+// DiagnoseInput is what the host meant the device to sign: the same inputs
+// as verify-partial, where the public share and partial signature are
+// optional.
+type DiagnoseInput struct {
+	GroupKey    string `json:"group_key"`
+	MessageHash string `json:"message_hash"`
+
+	// The signing commitments, as for verify-partial
+	Participants   []ParticipantInput `json:"participants,omitempty"`
+	CommitmentList string             `json:"commitment_list,omitempty"`
+
+	PublicShare string `json:"public_share,omitempty"` // Y_i of the device, to check z_i
+	Challenge   string `json:"challenge,omitempty"`    // Injected challenge, if INJECT_CHALLENGE was used
+}
+
+// DiagnoseOutput compares the host's signing computation with the device's,
+// step by step in the order the device computes it.
+type DiagnoseOutput struct {
+	ID              int            `json:"id"` // The device's participant ID
+	Steps           []DiagnoseStep `json:"steps"`
+	FirstDivergence string         `json:"first_divergence,omitempty"` // Step name; empty if all match
+}
+
+// DiagnoseStep is one compared value.
+type DiagnoseStep struct {
+	Step   string `json:"step"`
+	Host   string `json:"host"`
+	Device string `json:"device"`
+	Match  bool   `json:"match"`
+}
+
+func (d *DiagnoseOutput) add(step, host, device string) {
+	match := host == device
+	d.Steps = append(d.Steps, DiagnoseStep{Step: step, Host: host, Device: device, Match: match})
+	if !match && d.FirstDivergence == "" {
+		d.FirstDivergence = step
+	}
+}
+
+func (d *DiagnoseOutput) addBytes(step string, host, device []byte) {
+	d.add(step, hex.EncodeToString(host), hex.EncodeToString(device))
+}
+
+// runDiagnose reads the intermediates of the device's last PARTIAL_SIGN
+// with GET_DEBUG_TRACE, which only debug builds of the app answer, and
+// recomputes them on the host. Inputs are compared first, then each value
+// is recomputed from what the device received, so the first divergence is
+// where the device's arithmetic, rather than its input, went wrong.
+func runDiagnose(args []string, ws *workspace.Context) {
+	cmd := flag.NewFlagSet("diagnose", flag.ExitOnError)
+	addr := "127.0.0.1:9999"
+	if ws.Transport != "" && ws.Transport != "sim" {
+		addr = ws.Transport
+	}
+	addrFlag := cmd.String("addr", addr, "Speculos APDU port")
+	profilePath := cmd.String("profile", ws.Profile, "CLA/INS profile of a forked app (JSON)")
+	asJSON := cmd.Bool("json", false, "Print JSON instead of text")
+	stdioFlags(cmd)
+	cmd.Parse(args)
+
+	var input DiagnoseInput
+	if err := schema.Decode(os.Stdin, &input, stdinName); err != nil {
+		fail(KindInput, "Error reading input: %v", err)
+	}
+	list, err := verifyPartialCommitments(&VerifyPartialInput{
+		Participants:   input.Participants,
+		CommitmentList: input.CommitmentList,
+	})
+	if err != nil {
+		fail(KindInput, "Error: %v", err)
+	}
+	groupKey, err := hex.DecodeString(input.GroupKey)
+	if err != nil {
+		fail(KindInput, "Error: group_key: %v", err)
+	}
+	msg, err := hex.DecodeString(input.MessageHash)
+	if err != nil || len(msg) != 32 {
+		fail(KindInput, "Error: message_hash: expected 32 bytes of hex")
+	}
+	var challenge *big.Int // nil: computed from R
+	if input.Challenge != "" {
+		b, err := hex.DecodeString(input.Challenge)
+		if err != nil || len(b) != frostcore.ScalarSize {
+			fail(KindInput, "Error: challenge: expected %d bytes of hex", frostcore.ScalarSize)
+		}
+		challenge = frostcore.ScalarFromBytes(b)
+	}
+
+	s, err := apdu.DialSpeculos(*addrFlag, 5*time.Second)
+	if err != nil {
+		fail(KindTransport, "Error connecting to %s: %v", *addrFlag, err)
+	}
+	t := logTransport(loadAPDUProfile(*profilePath).Wrap(s))
+	tr, err := apdu.ReadDebugTrace(t)
+	t.Close()
+	if errors.Is(err, apdu.ErrNoDebugTrace) {
+		fail(KindTransport, "Error: %v; diagnose needs a debug build of the app", err)
+	}
+	if err != nil {
+		fail(KindTransport, "Error: %v", err)
+	}
+
+	d := diagnose(tr, msg, groupKey, list, challenge, input.PublicShare)
+	if *asJSON {
+		writeJSON(d)
+	} else {
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "STEP\tHOST\tDEVICE\t")
+		for _, s := range d.Steps {
+			mark := ""
+			if !s.Match {
+				mark = "<- differs"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", s.Step, s.Host, s.Device, mark)
+		}
+		w.Flush()
+	}
+	if d.FirstDivergence != "" {
+		fail(KindCrypto, "Host and device diverge first at %s", d.FirstDivergence)
+	}
+}
+
+// diagnose compares the device's trace with the host's computation of
+// signing msg over list.
+func diagnose(tr *apdu.DebugTrace, msg, groupKey []byte, list []frostcore.Commitment, challenge *big.Int, publicShare string) *DiagnoseOutput {
+	d := &DiagnoseOutput{ID: int(tr.ID)}
+
+	// Inputs, as the host meant them and as the device received them
+	d.addBytes("message_hash", msg, tr.MessageHash)
+	source := map[bool]string{false: "computed", true: "injected"}
+	d.add("challenge_source", source[challenge != nil], source[tr.ExternalChallenge])
+	d.add("participants", fmt.Sprint(len(list)), fmt.Sprint(len(tr.Entries)))
+	received := make([]frostcore.Commitment, len(tr.Entries))
+	for i, e := range tr.Entries {
+		received[i] = frostcore.Commitment{ID: e.ID, Hiding: e.Hiding, Binding: e.Binding}
+		var host []byte
+		if i < len(list) {
+			host = frostcore.EncodeCommitments(list[i : i+1])
+		}
+		d.addBytes(fmt.Sprintf("commitment[%d]", i), host, frostcore.EncodeCommitments(received[i:i+1]))
+	}
+
+	// Intermediates, recomputed from what the device received
+	if challenge == nil && tr.ExternalChallenge {
+		challenge = frostcore.ScalarFromBytes(tr.Challenge)
+	}
+	ht, err := frostcore.NewTrace(tr.MessageHash, groupKey, received, challenge)
+	if err != nil {
+		d.add("host_trace", err.Error(), "")
+		return d
+	}
+	for i, p := range ht.Participants {
+		d.addBytes(fmt.Sprintf("binding_factor[%d]", i), frostcore.ScalarBytes(p.BindingFactor), tr.Entries[i].BindingFactor)
+		d.addBytes(fmt.Sprintf("commitment_term[%d]", i), p.Commitment, tr.Entries[i].Commitment)
+	}
+	d.addBytes("group_commitment", ht.GroupCommitment, tr.GroupCommitment)
+	d.addBytes("challenge", frostcore.ScalarBytes(ht.Challenge), tr.Challenge)
+	var lambda []byte
+	for _, p := range ht.Participants {
+		if p.ID == tr.ID {
+			lambda = frostcore.ScalarBytes(p.Lambda)
+		}
+	}
+	d.addBytes("lambda", lambda, tr.Lambda)
+
+	if publicShare == "" {
+		return d
+	}
+	share, err := hex.DecodeString(publicShare)
+	if err != nil {
+		d.add("partial_sig", "public_share: "+err.Error(), hex.EncodeToString(tr.PartialSig))
+		return d
+	}
+	check, err := frostcore.VerifyShare(tr.MessageHash, groupKey, received, tr.ID, share, tr.PartialSig, challenge)
+	if err != nil {
+		d.add("partial_sig", err.Error(), hex.EncodeToString(tr.PartialSig))
+		return d
+	}
+	// z_i itself needs the share, so compare z_i*G with what it should be
+	d.addBytes("partial_sig", check.Expected, check.Actual)
+	return d
+}
@@ -0,0 +1,481 @@
+// Package dkg runs frostcore's distributed key generation between operators
+// on different machines, so that each ends up holding only its own share
+// and no machine ever sees the group secret or another participant's share.
+//
+// The participants meet over libp2p, with no coordinator: each runs a host
+// under its Identity, finds the others by mDNS on the local network or at
+// the addresses given for them, and accepts connections only from the
+// pinned peer IDs. Broadcasts go on a GossipSub topic of the session and
+// private sends on direct streams (see transport.go). Each run is bound to
+// a context of the session name agreed beforehand, the threshold, the total
+// and every participant's peer ID, and goes:
+//
+//	hello    broadcast: each peer checks the others agree on the context,
+//	         and announces its addresses
+//	round1   broadcast: commitments, proof of knowledge and an encryption
+//	         key for the run, signed by the identity
+//	round2   private: the sub-share for that peer, encrypted to its round-1
+//	         key (see package ecies), and a hash of the round-1 messages
+//	         received, so a participant that sent different commitments to
+//	         different peers is caught
+//	confirm  private: the group key, once every sub-share verified
+//
+// A participant that fails broadcasts an abort with its reason. Run returns
+// the share only once every participant has confirmed the same group key.
+// No message holds a secret in the clear, so Config.Record can keep them
+// all.
+//
+// Every pair of participants must connect directly: there is no relay or
+// NAT traversal. It is enough that one of each pair reaches the other, and
+// addresses need only be given for one participant that all the others
+// reach: the rest learn each other's from the hellos relayed through it.
+package dkg
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdh"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"slices"
+	"sync"
+	"time"
+
+	"keygen/ecies"
+	"keygen/frostcore"
+	"keygen/h2c"
+	"keygen/secret"
+
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// Message types
+const (
+	msgHello   = "hello"
+	msgRound1  = "round1"
+	msgRound2  = "round2"
+	msgConfirm = "confirm"
+	msgAbort   = "abort"
+)
+
+const (
+	// maxReceived bounds what one peer may send during a run.
+	maxReceived = 1 << 20
+
+	// redialInterval is how often a peer that is not reachable yet is
+	// dialed again, a private send retried and a broadcast republished.
+	redialInterval = time.Second
+)
+
+// Sub-shares travel encrypted to the recipient's encryption key, an X25519
+// key drawn for the run and sent in round 1. The libp2p secure channel
+// alone would protect them in transit, but not once a message is recorded
+// or logged; encrypted, a run's messages hold nothing secret.
+const eciesInfo = "fy-ledger dkg sub-share v1"
+
+// Peer is another participant of the run.
+type Peer struct {
+	ID     int      // Participant number
+	PeerID string   // Its Identity's peer ID
+	Addrs  []string // Multiaddrs it listens on, if known; without /p2p
+}
+
+// Config describes one participant's side of a run.
+type Config struct {
+	ID        int
+	Threshold int
+	Total     int
+
+	// Session names the run. The operators agree on it beforehand; it is
+	// bound into every proof, so messages of one run are useless in another.
+	Session string
+
+	Identity *Identity
+	Listen   []string // Multiaddrs to listen on; nil is DefaultListen
+	Peers    []Peer   // Every other participant
+	MDNS     bool     // Look for the peers on the local network
+
+	Random io.Reader                        // nil uses crypto/rand
+	Logf   func(format string, args ...any) // Progress, if set
+
+	// Record, if set, receives every message sent and received, as a line
+	// of JSON with its "from" and "to" participants, "to" 0 for a
+	// broadcast.
+	Record io.Writer
+}
+
+// Result is a participant's outcome of a run.
+type Result struct {
+	GroupKey     []byte
+	PublicShares [][]byte       // Index j-1 for participant j
+	Share        *secret.Scalar // This participant's secret share
+	Transcript   []byte         // SHA-256 of the round-1 messages every participant received
+}
+
+// message is one protocol message, sent as JSON.
+type message struct {
+	Type string `json:"type"`
+
+	// hello
+	From    int      `json:"from,omitempty"`
+	Context string   `json:"context,omitempty"` // SHA-256 of the run's context
+	Addrs   []string `json:"addrs,omitempty"`   // Where it listens, with /p2p
+
+	// round1
+	Commitments   []string `json:"commitments,omitempty"`
+	Proof         string   `json:"proof,omitempty"`
+	EncryptionKey string   `json:"encryption_key,omitempty"` // X25519
+	Signature     string   `json:"signature,omitempty"`      // Of round1Signed, by the sender's identity
+
+	// round2
+	EncryptedShare string `json:"encrypted_share,omitempty"`
+	Transcript     string `json:"transcript,omitempty"`
+
+	// confirm
+	GroupKey string `json:"group_key,omitempty"`
+
+	// abort
+	Error string `json:"error,omitempty"`
+}
+
+// recorder writes the messages of a run to Config.Record.
+type recorder struct {
+	self int
+	mu   sync.Mutex
+	enc  *json.Encoder
+}
+
+// recorded is a message as recorded.
+type recorded struct {
+	From int `json:"from"`
+	To   int `json:"to"`
+	*message
+}
+
+func (r *recorder) sent(to int, m *message) {
+	if r != nil {
+		r.write(recorded{From: r.self, To: to, message: m})
+	}
+}
+
+func (r *recorder) received(from int, m *message) {
+	if r != nil {
+		r.write(recorded{From: from, To: r.self, message: m})
+	}
+}
+
+func (r *recorder) write(m recorded) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.enc.Encode(m)
+}
+
+// Check validates the configuration.
+func (c *Config) Check() error {
+	_, err := c.check()
+	return err
+}
+
+// check validates the configuration and returns every participant's
+// public key, by participant.
+func (c *Config) check() (map[int]ed25519.PublicKey, error) {
+	if c.Threshold < 1 || c.Threshold > c.Total || c.Total > 0xFFFF {
+		return nil, fmt.Errorf("invalid threshold %d of %d", c.Threshold, c.Total)
+	}
+	if c.ID < 1 || c.ID > c.Total {
+		return nil, fmt.Errorf("participant %d is not in 1..%d", c.ID, c.Total)
+	}
+	if c.Session == "" {
+		return nil, errors.New("no session name")
+	}
+	if c.Identity == nil {
+		return nil, errors.New("no identity")
+	}
+	keys := map[int]ed25519.PublicKey{c.ID: c.Identity.key.Public().(ed25519.PublicKey)}
+	for _, p := range c.Peers {
+		if p.ID < 1 || p.ID > c.Total {
+			return nil, fmt.Errorf("peer %d is not in 1..%d", p.ID, c.Total)
+		}
+		if _, dup := keys[p.ID]; dup {
+			return nil, fmt.Errorf("participant %d given twice", p.ID)
+		}
+		key, err := ParsePeerID(p.PeerID)
+		if err != nil {
+			return nil, fmt.Errorf("peer %d: %w", p.ID, err)
+		}
+		for _, a := range p.Addrs {
+			if _, err := ma.NewMultiaddr(a); err != nil {
+				return nil, fmt.Errorf("peer %d: %w", p.ID, err)
+			}
+		}
+		for id, k := range keys {
+			if samePeer(k, key) {
+				return nil, fmt.Errorf("participants %d and %d have the same peer ID", id, p.ID)
+			}
+		}
+		keys[p.ID] = key
+	}
+	if len(keys) != c.Total {
+		var missing []int
+		for id := 1; id <= c.Total; id++ {
+			if _, ok := keys[id]; !ok {
+				missing = append(missing, id)
+			}
+		}
+		return nil, fmt.Errorf("no peer given for participants %v", missing)
+	}
+	for _, a := range c.Listen {
+		if _, err := ma.NewMultiaddr(a); err != nil {
+			return nil, fmt.Errorf("listen address: %w", err)
+		}
+	}
+	return keys, nil
+}
+
+// bind returns the context the run is bound to: the session, threshold,
+// total and every participant's key in order.
+func (c *Config) bind(keys map[int]ed25519.PublicKey) []byte {
+	parts := [][]byte{
+		[]byte("fy-ledger dkg v3"),
+		[]byte(c.Session),
+		binary.BigEndian.AppendUint16(nil, uint16(c.Threshold)),
+		binary.BigEndian.AppendUint16(nil, uint16(c.Total)),
+	}
+	for id := 1; id <= c.Total; id++ {
+		parts = append(parts, keys[id])
+	}
+	return h2c.Context(parts...)
+}
+
+func (c *Config) logf(format string, args ...any) {
+	if c.Logf != nil {
+		c.Logf(format, args...)
+	}
+}
+
+// Run finds the peers and runs the DKG. It returns once every participant
+// has confirmed the group key, or fails when ctx is done.
+func Run(ctx context.Context, cfg *Config) (*Result, error) {
+	keys, err := cfg.check()
+	if err != nil {
+		return nil, err
+	}
+	tr, err := newTransport(ctx, cfg, keys)
+	if err != nil {
+		return nil, err
+	}
+	defer tr.close()
+	if cfg.Record != nil {
+		tr.rec = &recorder{self: cfg.ID, enc: json.NewEncoder(cfg.Record)}
+	}
+
+	res, err := run(ctx, cfg, tr, keys, cfg.bind(keys))
+	if err != nil {
+		if ctx.Err() != nil {
+			if !errors.Is(err, ctx.Err()) {
+				err = fmt.Errorf("%w: %v", ctx.Err(), err)
+			}
+			return nil, err
+		}
+		tr.abort(err)
+		return nil, err
+	}
+	return res, nil
+}
+
+// run goes through the rounds over tr.
+func run(ctx context.Context, cfg *Config, tr *transport, keys map[int]ed25519.PublicKey, bind []byte) (*Result, error) {
+	t, n, self := cfg.Threshold, cfg.Total, cfg.ID
+	bindHash := sha256.Sum256(bind)
+	hello := &message{Type: msgHello, From: self, Context: hex.EncodeToString(bindHash[:]), Addrs: tr.addrs()}
+	if err := tr.broadcast(ctx, hello); err != nil {
+		return nil, err
+	}
+	in, err := tr.collect(ctx, msgHello)
+	if err != nil {
+		return nil, err
+	}
+	for id, m := range in {
+		if m.From != id {
+			return nil, fmt.Errorf("participant %d: hello claims to be from participant %d", id, m.From)
+		}
+		if m.Context != hex.EncodeToString(bindHash[:]) {
+			return nil, fmt.Errorf("participant %d runs with a different session, threshold, total or peer IDs", id)
+		}
+	}
+	cfg.logf("All %d participants joined; dealing", n)
+
+	random := cfg.Random
+	if random == nil {
+		random = rand.Reader
+	}
+	deal, err := frostcore.DealDKG(uint16(self), t, n, bind, random)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		for _, s := range deal.SubShares {
+			secret.WipeInt(s)
+		}
+	}()
+	encKey, err := ecies.NewKey(random)
+	if err != nil {
+		return nil, err
+	}
+	round1 := &message{
+		Type:          msgRound1,
+		Proof:         hex.EncodeToString(deal.Proof.Bytes()),
+		EncryptionKey: hex.EncodeToString(encKey.PublicKey().Bytes()),
+	}
+	for _, c := range deal.Commitments {
+		round1.Commitments = append(round1.Commitments, hex.EncodeToString(c))
+	}
+	round1.Signature = hex.EncodeToString(ed25519.Sign(cfg.Identity.key, round1Signed(bind, self, deal.Commitments, deal.Proof.Bytes(), encKey.PublicKey().Bytes())))
+	if err := tr.broadcast(ctx, round1); err != nil {
+		return nil, err
+	}
+	if in, err = tr.collect(ctx, msgRound1); err != nil {
+		return nil, err
+	}
+	commitments := make([][][]byte, n)
+	proofs := make([][]byte, n)
+	encKeys := make([][]byte, n)
+	peerEncKeys := make(map[int]*ecdh.PublicKey, len(in))
+	commitments[self-1], proofs[self-1], encKeys[self-1] = deal.Commitments, deal.Proof.Bytes(), encKey.PublicKey().Bytes()
+	for id, m := range in {
+		cs := make([][]byte, len(m.Commitments))
+		for k, h := range m.Commitments {
+			if cs[k], err = hex.DecodeString(h); err != nil {
+				return nil, fmt.Errorf("participant %d: commitment %d: malformed hex", id, k)
+			}
+		}
+		pb, err := hex.DecodeString(m.Proof)
+		if err != nil {
+			return nil, fmt.Errorf("participant %d: proof: malformed hex", id)
+		}
+		proof, err := frostcore.ParseDKGProof(pb)
+		if err != nil {
+			return nil, fmt.Errorf("participant %d: %w", id, err)
+		}
+		ek, err := hex.DecodeString(m.EncryptionKey)
+		if err != nil {
+			return nil, fmt.Errorf("participant %d: encryption key: malformed hex", id)
+		}
+		if peerEncKeys[id], err = ecies.ParsePublicKey(ek); err != nil {
+			return nil, fmt.Errorf("participant %d: %w", id, err)
+		}
+		sig, err := hex.DecodeString(m.Signature)
+		if err != nil || !ed25519.Verify(keys[id], round1Signed(bind, id, cs, pb, ek), sig) {
+			return nil, fmt.Errorf("participant %d: round-1 signature does not verify", id)
+		}
+		if err := frostcore.VerifyDKGCommitments(uint16(id), t, cs, proof, bind); err != nil {
+			return nil, err
+		}
+		commitments[id-1], proofs[id-1], encKeys[id-1] = cs, pb, ek
+	}
+
+	// Every participant hashes the round-1 messages it received; they
+	// compare in round 2, so pubsub need not deliver the same round 1 to
+	// every peer
+	th := sha256.New()
+	th.Write(bind)
+	for i := range commitments {
+		th.Write(h2c.Context(append(slices.Clone(commitments[i]), proofs[i], encKeys[i])...))
+	}
+	transcript := th.Sum(nil)
+	round2 := make(map[int]*message, len(tr.ids))
+	for id := range tr.ids {
+		sub := frostcore.ScalarBytes(deal.SubShares[id-1])
+		box, err := ecies.Seal(eciesInfo, peerEncKeys[id], sub, shareAAD(bind, self, id), random)
+		secret.Wipe(sub)
+		if err != nil {
+			return nil, err
+		}
+		round2[id] = &message{
+			Type:           msgRound2,
+			EncryptedShare: hex.EncodeToString(box),
+			Transcript:     hex.EncodeToString(transcript),
+		}
+	}
+	if in, err = tr.exchange(ctx, msgRound2, func(id int) *message { return round2[id] }); err != nil {
+		return nil, err
+	}
+	share := new(big.Int).Set(deal.SubShares[self-1])
+	defer secret.WipeInt(share)
+	for id, m := range in {
+		if m.Transcript != hex.EncodeToString(transcript) {
+			return nil, fmt.Errorf("participant %d received different round-1 messages: a participant sent different commitments to different peers", id)
+		}
+		box, err := hex.DecodeString(m.EncryptedShare)
+		if err != nil {
+			return nil, fmt.Errorf("participant %d: sub-share: malformed hex", id)
+		}
+		b, err := ecies.Open(eciesInfo, encKey, box, shareAAD(bind, id, self))
+		if err != nil {
+			return nil, fmt.Errorf("participant %d: %w", id, err)
+		}
+		if len(b) != frostcore.ScalarSize {
+			secret.Wipe(b)
+			return nil, fmt.Errorf("participant %d: malformed sub-share", id)
+		}
+		sub := frostcore.ScalarFromBytes(b)
+		secret.Wipe(b)
+		if sub.Cmp(frostcore.Order) >= 0 {
+			secret.WipeInt(sub)
+			return nil, fmt.Errorf("participant %d: sub-share is not reduced", id)
+		}
+		err = frostcore.VerifySubShare(commitments[id-1], uint16(self), sub)
+		share.Add(share, sub)
+		secret.WipeInt(sub)
+		if err != nil {
+			return nil, fmt.Errorf("participant %d: %w", id, err)
+		}
+	}
+	share.Mod(share, frostcore.Order)
+
+	result, err := frostcore.FinishDKG(commitments)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(frostcore.BasePoint(share), result.PublicShares[self-1]) {
+		return nil, errors.New("share does not match its public share")
+	}
+	groupKey := hex.EncodeToString(result.GroupKey)
+	if in, err = tr.exchange(ctx, msgConfirm, func(int) *message { return &message{Type: msgConfirm, GroupKey: groupKey} }); err != nil {
+		return nil, err
+	}
+	for id, m := range in {
+		if m.GroupKey != groupKey {
+			return nil, fmt.Errorf("participant %d computed group key %s, not %s", id, m.GroupKey, groupKey)
+		}
+	}
+
+	s, err := secret.FromInt(new(big.Int).Set(share))
+	if err != nil {
+		return nil, err
+	}
+	return &Result{GroupKey: result.GroupKey, PublicShares: result.PublicShares, Share: s, Transcript: transcript}, nil
+}
+
+// round1Signed returns what a participant's identity signs in round 1: its
+// commitments, proof and encryption key, bound to the run and the sender,
+// so a relayed or recorded round 1 can be checked against the peer IDs.
+func round1Signed(bind []byte, from int, commitments [][]byte, proof, encKey []byte) []byte {
+	parts := [][]byte{bind, []byte(msgRound1), binary.BigEndian.AppendUint16(nil, uint16(from))}
+	parts = append(parts, commitments...)
+	return h2c.Context(append(parts, proof, encKey)...)
+}
+
+// shareAAD binds a sealed sub-share to the run, its sender and its
+// recipient.
+func shareAAD(bind []byte, from, to int) []byte {
+	return h2c.Context(bind, binary.BigEndian.AppendUint16(nil, uint16(from)), binary.BigEndian.AppendUint16(nil, uint16(to)))
+}
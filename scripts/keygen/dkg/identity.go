@@ -0,0 +1,135 @@
+package dkg
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/libp2p/go-libp2p/core/crypto"
+	crypto_pb "github.com/libp2p/go-libp2p/core/crypto/pb"
+	"github.com/libp2p/go-libp2p/core/peer"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// Identity is an operator's long-term transport key, an Ed25519 key. Its
+// peer ID is the libp2p peer ID of the key ("12D3KooW…"), which the other
+// operators pin with -peer: libp2p's secure channel proves every
+// connection's peer holds the key its peer ID names.
+type Identity struct {
+	key ed25519.PrivateKey
+}
+
+// NewIdentity draws a new identity.
+func NewIdentity() (*Identity, error) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return &Identity{key: key}, nil
+}
+
+// ParseIdentity reads an identity from a PEM "PRIVATE KEY" block, as
+// MarshalPEM writes it.
+func ParseIdentity(data []byte) (*Identity, error) {
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "PRIVATE KEY" {
+		return nil, errors.New("identity: expected a PEM PRIVATE KEY block")
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("identity: %w", err)
+	}
+	ed, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, errors.New("identity: not an Ed25519 key")
+	}
+	return &Identity{key: ed}, nil
+}
+
+// MarshalPEM encodes the identity's private key as PKCS #8 in PEM.
+func (id *Identity) MarshalPEM() []byte {
+	der, _ := x509.MarshalPKCS8PrivateKey(id.key)
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+}
+
+// PeerID returns the identity's libp2p peer ID.
+func (id *Identity) PeerID() string {
+	return id.peerID().String()
+}
+
+func (id *Identity) peerID() peer.ID {
+	pid, _ := peerIDOf(id.key.Public().(ed25519.PublicKey))
+	return pid
+}
+
+// privKey returns the identity as a libp2p private key.
+func (id *Identity) privKey() (crypto.PrivKey, error) {
+	return crypto.UnmarshalEd25519PrivateKey(id.key)
+}
+
+// ParsePeerID decodes a peer ID into the Ed25519 key it names.
+func ParsePeerID(s string) (ed25519.PublicKey, error) {
+	pid, err := peer.Decode(strings.TrimSpace(s))
+	if err != nil {
+		return nil, fmt.Errorf("peer ID: %w", err)
+	}
+	pub, err := pid.ExtractPublicKey()
+	if err != nil {
+		return nil, fmt.Errorf("peer ID: %w", err)
+	}
+	if pub.Type() != crypto_pb.KeyType_Ed25519 {
+		return nil, errors.New("peer ID: not an Ed25519 key")
+	}
+	raw, err := pub.Raw()
+	if err != nil {
+		return nil, fmt.Errorf("peer ID: %w", err)
+	}
+	return ed25519.PublicKey(raw), nil
+}
+
+// ParsePeer decodes participant id's -peer value: its peer ID alone, or a
+// multiaddr it listens on ending in /p2p/ and its peer ID.
+func ParsePeer(id int, s string) (Peer, error) {
+	s = strings.TrimSpace(s)
+	if !strings.HasPrefix(s, "/") {
+		if _, err := ParsePeerID(s); err != nil {
+			return Peer{}, err
+		}
+		return Peer{ID: id, PeerID: s}, nil
+	}
+	addr, err := ma.NewMultiaddr(s)
+	if err != nil {
+		return Peer{}, err
+	}
+	info, err := peer.AddrInfoFromP2pAddr(addr)
+	if err != nil {
+		return Peer{}, err
+	}
+	if _, err := ParsePeerID(info.ID.String()); err != nil {
+		return Peer{}, err
+	}
+	p := Peer{ID: id, PeerID: info.ID.String()}
+	for _, a := range info.Addrs {
+		p.Addrs = append(p.Addrs, a.String())
+	}
+	return p, nil
+}
+
+// peerIDOf returns the peer ID of an Ed25519 key.
+func peerIDOf(key ed25519.PublicKey) (peer.ID, error) {
+	pub, err := crypto.UnmarshalEd25519PublicKey(key)
+	if err != nil {
+		return "", err
+	}
+	return peer.IDFromPublicKey(pub)
+}
+
+// samePeer reports whether two keys are the same peer.
+func samePeer(a, b ed25519.PublicKey) bool {
+	return bytes.Equal(a, b)
+}
@@ -0,0 +1,534 @@
+package dkg
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p"
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+	"github.com/libp2p/go-libp2p/core/control"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/peerstore"
+	"github.com/libp2p/go-libp2p/core/protocol"
+	"github.com/libp2p/go-libp2p/p2p/discovery/mdns"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+const (
+	// protocolID is the direct-stream protocol of private sends.
+	protocolID = protocol.ID("/fy-ledger/dkg/1.0.0")
+
+	// topicPrefix, followed by the hash of the session name, is the
+	// GossipSub topic of a run's broadcasts.
+	topicPrefix = "/fy-ledger/dkg/1.0.0/"
+
+	// mdnsService is the mDNS service name peers look for each other under.
+	mdnsService = "fy-ledger-dkg"
+
+	// streamTimeout bounds one private send, acknowledgement included.
+	streamTimeout = 10 * time.Second
+)
+
+// DefaultListen is where a participant listens without Config.Listen: on
+// every interface, TCP and QUIC, on ports the system picks.
+var DefaultListen = []string{"/ip4/0.0.0.0/tcp/0", "/ip4/0.0.0.0/udp/0/quic-v1"}
+
+// Broadcast and private messages. A message of the wrong kind is refused,
+// so round 2 never travels over pubsub, nor round 1 to a single peer.
+var (
+	broadcastTypes = []string{msgHello, msgRound1, msgAbort}
+	privateTypes   = []string{msgRound2, msgConfirm, msgAbort}
+)
+
+// transport carries a run's messages over libp2p: broadcasts on a
+// GossipSub topic of the session, republished until the run ends so late
+// subscribers get them, and private sends on direct streams the recipient
+// acknowledges.
+type transport struct {
+	cfg    *Config
+	cancel context.CancelFunc // Stops the background work
+	host   host.Host
+	topic  *pubsub.Topic
+	sub    *pubsub.Subscription
+	ids    map[int]peer.ID
+	peers  map[peer.ID]int // Every other participant
+	rec    *recorder       // nil records nothing
+
+	mu        sync.Mutex
+	inbox     map[string]map[int][]byte // Message by type and sender, as received
+	err       error                     // Set by an abort or an equivocation
+	changed   chan struct{}             // Closed when inbox or err changes
+	published [][]byte                  // This participant's broadcasts
+	closing   bool                      // Set by close; no new private sends
+	handlers  sync.WaitGroup            // Private sends being taken
+}
+
+// gater keeps every connection to the run's participants.
+type gater map[peer.ID]int
+
+func (g gater) InterceptPeerDial(p peer.ID) bool {
+	_, ok := g[p]
+	return ok
+}
+
+func (g gater) InterceptAddrDial(p peer.ID, _ ma.Multiaddr) bool {
+	return g.InterceptPeerDial(p)
+}
+
+func (g gater) InterceptAccept(network.ConnMultiaddrs) bool {
+	return true
+}
+
+func (g gater) InterceptSecured(_ network.Direction, p peer.ID, _ network.ConnMultiaddrs) bool {
+	return g.InterceptPeerDial(p)
+}
+
+func (g gater) InterceptUpgraded(network.Conn) (bool, control.DisconnectReason) {
+	return true, 0
+}
+
+// newTransport starts the participant's libp2p host, joins the session's
+// topic and starts looking for the peers.
+func newTransport(ctx context.Context, cfg *Config, keys map[int]ed25519.PublicKey) (*transport, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	t := &transport{
+		cfg:     cfg,
+		cancel:  cancel,
+		ids:     make(map[int]peer.ID, len(keys)),
+		peers:   make(map[peer.ID]int, len(keys)),
+		inbox:   make(map[string]map[int][]byte),
+		changed: make(chan struct{}),
+	}
+	for id, key := range keys {
+		if id == cfg.ID {
+			continue
+		}
+		pid, err := peerIDOf(key)
+		if err != nil {
+			cancel()
+			return nil, fmt.Errorf("participant %d: %w", id, err)
+		}
+		t.ids[id], t.peers[pid] = pid, id
+	}
+	priv, err := cfg.Identity.privKey()
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	listen := cfg.Listen
+	if len(listen) == 0 {
+		listen = DefaultListen
+	}
+	t.host, err = libp2p.New(
+		libp2p.Identity(priv),
+		libp2p.ListenAddrStrings(listen...),
+		libp2p.ConnectionGater(gater(t.peers)),
+	)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	t.host.SetStreamHandler(protocolID, t.handle)
+	for _, a := range t.addrs() {
+		cfg.logf("Listening on %s", a)
+	}
+
+	ps, err := pubsub.NewGossipSub(ctx, t.host)
+	if err == nil {
+		session := sha256.Sum256([]byte(cfg.Session))
+		t.topic, err = ps.Join(topicPrefix + hex.EncodeToString(session[:]))
+	}
+	if err == nil {
+		t.sub, err = t.topic.Subscribe()
+	}
+	if err != nil {
+		t.close()
+		return nil, err
+	}
+	go t.receive(ctx)
+	go t.republish(ctx)
+
+	if cfg.MDNS {
+		svc := mdns.NewMdnsService(t.host, mdnsService, t)
+		if err := svc.Start(); err != nil {
+			t.close()
+			return nil, fmt.Errorf("mDNS: %w", err)
+		}
+		context.AfterFunc(ctx, func() { svc.Close() })
+	}
+	for _, p := range cfg.Peers {
+		for _, s := range p.Addrs {
+			addr, err := ma.NewMultiaddr(s)
+			if err != nil {
+				t.close()
+				return nil, fmt.Errorf("participant %d: %w", p.ID, err)
+			}
+			t.host.Peerstore().AddAddr(t.ids[p.ID], addr, peerstore.PermanentAddrTTL)
+		}
+		go t.connect(ctx, p.ID)
+	}
+	return t, nil
+}
+
+// addrs returns the participant's addresses, with its peer ID, as another
+// participant's -peer takes them.
+func (t *transport) addrs() []string {
+	addrs, _ := peer.AddrInfoToP2pAddrs(&peer.AddrInfo{ID: t.host.ID(), Addrs: t.host.Addrs()})
+	out := make([]string, len(addrs))
+	for i, a := range addrs {
+		out[i] = a.String()
+	}
+	return out
+}
+
+// learn records the addresses a participant announced in its hello, which
+// may have come relayed by another peer.
+func (t *transport) learn(id int, addrs []string) {
+	for _, s := range addrs {
+		addr, err := ma.NewMultiaddr(s)
+		if err != nil {
+			continue
+		}
+		info, err := peer.AddrInfoFromP2pAddr(addr)
+		if err != nil || info.ID != t.ids[id] {
+			continue
+		}
+		t.host.Peerstore().AddAddrs(info.ID, info.Addrs, peerstore.PermanentAddrTTL)
+	}
+}
+
+// HandlePeerFound is called by mDNS for every host it finds.
+func (t *transport) HandlePeerFound(info peer.AddrInfo) {
+	if _, ok := t.peers[info.ID]; ok {
+		t.host.Peerstore().AddAddrs(info.ID, info.Addrs, peerstore.PermanentAddrTTL)
+	}
+}
+
+// connect dials participant id until it is connected, with whatever
+// addresses are known for it by then: given with -peer, found by mDNS or
+// announced in its hello. Either side dialing is enough.
+func (t *transport) connect(ctx context.Context, id int) {
+	pid := t.ids[id]
+	for waited := false; ; waited = true {
+		if t.host.Network().Connectedness(pid) == network.Connected {
+			t.cfg.logf("Connected to participant %d", id)
+			return
+		}
+		if len(t.host.Peerstore().Addrs(pid)) > 0 {
+			err := t.host.Connect(ctx, peer.AddrInfo{ID: pid})
+			if err == nil {
+				continue
+			}
+			if !waited {
+				t.cfg.logf("Waiting for participant %d: %v", id, err)
+			}
+		}
+		select {
+		case <-time.After(redialInterval):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// close leaves the topic and stops the host, once the private sends being
+// taken are over, so their senders get the acknowledgement.
+func (t *transport) close() {
+	t.mu.Lock()
+	t.closing = true
+	t.mu.Unlock()
+	t.handlers.Wait()
+	t.cancel()
+	if t.sub != nil {
+		t.sub.Cancel()
+	}
+	if t.topic != nil {
+		t.topic.Close()
+	}
+	t.host.Close()
+}
+
+// receive delivers the topic's messages until ctx is done. pubsub has
+// checked each is signed by the peer it is from.
+func (t *transport) receive(ctx context.Context) {
+	for {
+		msg, err := t.sub.Next(ctx)
+		if err != nil {
+			return
+		}
+		if id, ok := t.peers[msg.GetFrom()]; ok {
+			t.deliver(id, msg.Data, broadcastTypes)
+		}
+	}
+}
+
+// republish publishes the participant's broadcasts again every interval,
+// for the peers that subscribed or connected after they went out.
+func (t *transport) republish(ctx context.Context) {
+	for {
+		select {
+		case <-time.After(redialInterval):
+		case <-ctx.Done():
+			return
+		}
+		t.mu.Lock()
+		published := slices.Clone(t.published)
+		t.mu.Unlock()
+		for _, data := range published {
+			t.topic.Publish(ctx, data)
+		}
+	}
+}
+
+// handle takes a private send: one message, its length first, acknowledged
+// with 1 once it is in the inbox and 0 if it was refused. It returns when
+// the sender has closed the stream after reading the acknowledgement.
+func (t *transport) handle(s network.Stream) {
+	defer s.Close()
+	id, ok := t.peers[s.Conn().RemotePeer()]
+	t.mu.Lock()
+	if !ok || t.closing {
+		t.mu.Unlock()
+		s.Reset()
+		return
+	}
+	t.handlers.Add(1)
+	t.mu.Unlock()
+	defer t.handlers.Done()
+	s.SetDeadline(time.Now().Add(streamTimeout))
+	var size [4]byte
+	if _, err := io.ReadFull(s, size[:]); err != nil || binary.BigEndian.Uint32(size[:]) > maxReceived {
+		s.Reset()
+		return
+	}
+	data := make([]byte, binary.BigEndian.Uint32(size[:]))
+	if _, err := io.ReadFull(s, data); err != nil {
+		s.Reset()
+		return
+	}
+	ack := byte(0)
+	if t.deliver(id, data, privateTypes) {
+		ack = 1
+	}
+	if _, err := s.Write([]byte{ack}); err == nil {
+		io.Copy(io.Discard, s)
+	}
+}
+
+// deliver files a message from participant id. The same message again is
+// ignored; a different one of the same type is an equivocation and fails
+// the run, as does an abort.
+func (t *transport) deliver(id int, data []byte, types []string) bool {
+	var m message
+	if err := json.Unmarshal(data, &m); err != nil || !slices.Contains(types, m.Type) {
+		t.cfg.logf("Ignored a malformed message from participant %d", id)
+		return false
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if m.Type == msgAbort {
+		t.rec.received(id, &m)
+		t.fail(fmt.Errorf("participant %d aborted: %s", id, m.Error))
+		return true
+	}
+	byType := t.inbox[m.Type]
+	if byType == nil {
+		byType = make(map[int][]byte)
+		t.inbox[m.Type] = byType
+	}
+	if prev, ok := byType[id]; ok {
+		if !bytes.Equal(prev, data) {
+			t.fail(fmt.Errorf("participant %d sent two different %s messages", id, m.Type))
+			return false
+		}
+		return true
+	}
+	byType[id] = data
+	t.rec.received(id, &m)
+	if m.Type == msgHello {
+		t.learn(id, m.Addrs)
+	}
+	close(t.changed)
+	t.changed = make(chan struct{})
+	return true
+}
+
+// fail records the first reason the run cannot go on. t.mu is held.
+func (t *transport) fail(err error) {
+	if t.err == nil {
+		t.err = err
+		close(t.changed)
+		t.changed = make(chan struct{})
+	}
+}
+
+// broadcast publishes m to every participant, and keeps publishing it.
+func (t *transport) broadcast(ctx context.Context, m *message) error {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	t.mu.Lock()
+	t.published = append(t.published, data)
+	t.mu.Unlock()
+	t.rec.sent(0, m)
+	return t.topic.Publish(ctx, data)
+}
+
+// send delivers m to participant id on a direct stream, retrying until the
+// peer takes it or ctx is done.
+func (t *transport) send(ctx context.Context, id int, m *message) error {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	for waited := false; ; waited = true {
+		err := t.sendOnce(ctx, t.ids[id], data)
+		if err == nil {
+			t.rec.sent(id, m)
+			return nil
+		}
+		if errors.Is(err, errRefused) {
+			return fmt.Errorf("participant %d: %w", id, err)
+		}
+		if !waited {
+			t.cfg.logf("Sending the %s message to participant %d: %v; retrying", m.Type, id, err)
+		}
+		select {
+		case <-time.After(redialInterval):
+		case <-ctx.Done():
+			return fmt.Errorf("participant %d: %w", id, err)
+		}
+	}
+}
+
+var errRefused = errors.New("refused the message")
+
+func (t *transport) sendOnce(ctx context.Context, pid peer.ID, data []byte) error {
+	s, err := t.host.NewStream(ctx, pid, protocolID)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	s.SetDeadline(time.Now().Add(streamTimeout))
+	if _, err := s.Write(binary.BigEndian.AppendUint32(nil, uint32(len(data)))); err != nil {
+		s.Reset()
+		return err
+	}
+	if _, err := s.Write(data); err != nil {
+		s.Reset()
+		return err
+	}
+	ack := make([]byte, 1)
+	if _, err := io.ReadFull(s, ack); err != nil {
+		return err
+	}
+	if ack[0] != 1 {
+		return errRefused
+	}
+	return nil
+}
+
+// collect waits for every peer's message of type typ.
+func (t *transport) collect(ctx context.Context, typ string) (map[int]*message, error) {
+	for {
+		t.mu.Lock()
+		if t.err != nil {
+			err := t.err
+			t.mu.Unlock()
+			return nil, err
+		}
+		got := t.inbox[typ]
+		if len(got) == len(t.peers) {
+			in := make(map[int]*message, len(got))
+			for id, data := range got {
+				var m message
+				json.Unmarshal(data, &m) // Checked by deliver
+				in[id] = &m
+			}
+			t.mu.Unlock()
+			return in, nil
+		}
+		var missing []int
+		for id := range t.ids {
+			if _, ok := got[id]; !ok {
+				missing = append(missing, id)
+			}
+		}
+		changed := t.changed
+		t.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			slices.Sort(missing)
+			err := fmt.Errorf("waiting for the %s messages of participants %v: %w", typ, missing, ctx.Err())
+			if typ == msgHello {
+				// The topic is the session's, so a peer of another session
+				// connects but is never heard from
+				var connected []int
+				for _, id := range missing {
+					if t.host.Network().Connectedness(t.ids[id]) == network.Connected {
+						connected = append(connected, id)
+					}
+				}
+				if len(connected) > 0 {
+					err = fmt.Errorf("%w; participants %v are connected, so check they run with the same session", err, connected)
+				}
+			}
+			return nil, err
+		}
+	}
+}
+
+// exchange sends every peer its message from out on a direct stream and
+// collects theirs of the same type.
+func (t *transport) exchange(ctx context.Context, typ string, out func(id int) *message) (map[int]*message, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var mu sync.Mutex
+	var errs []error
+	var wg sync.WaitGroup
+	for id := range t.ids {
+		wg.Go(func() {
+			if err := t.send(ctx, id, out(id)); err != nil && ctx.Err() == nil {
+				mu.Lock()
+				errs = append(errs, err)
+				mu.Unlock()
+				cancel()
+			}
+		})
+	}
+	in, err := t.collect(ctx, typ)
+	if err != nil {
+		cancel()
+	}
+	wg.Wait()
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return in, err
+}
+
+// abort tells every peer why the run failed, giving the message a moment
+// to go out before the host stops.
+func (t *transport) abort(reason error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	data, _ := json.Marshal(&message{Type: msgAbort, Error: reason.Error()})
+	t.topic.Publish(ctx, data)
+	<-ctx.Done()
+}
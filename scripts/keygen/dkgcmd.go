@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"keygen/dkg"
+	"keygen/frostcore"
+	"keygen/secret"
+)
+
+const dkgUsage = "Usage: keygen dkg -identity f -id i -t t -n n -session s -peer j=peer-id... [-listen multiaddr]... [-mdns=false] [-record f]\n       keygen dkg identity -key f"
+
+// DKGIdentity describes an identity written by dkg identity.
+type DKGIdentity struct {
+	PeerID string `json:"peer_id"`
+	File   string `json:"file"`
+}
+
+// runDKG implements distributed key generation between operators on
+// different machines:
+//
+//	dkg identity -key f                                  create a transport identity and print its peer ID
+//	dkg -identity f -id i -session s -peer j=peer-id...  run the DKG with the other participants
+//
+// Each operator creates an identity once and hands its peer ID to the
+// others, who pin it with -peer, along with the multiaddr it listens on
+// when mDNS will not find it. The operators then run dkg at the same
+// time with the same -t, -n and -session, each with its own -id; every one
+// ends up with its own share file and prints the group's public values,
+// as keygen does, which group-state init takes. No machine holds more than
+// its own share, and the group secret never exists anywhere.
+func runDKG(args []string) {
+	if len(args) > 0 && args[0] == "identity" {
+		cmd := flag.NewFlagSet("dkg identity", flag.ExitOnError)
+		// -key, since stdioFlags takes -out for the printed peer ID
+		out := cmd.String("key", "", "Write the identity's private key here (required)")
+		stdioFlags(cmd)
+		cmd.Parse(args[1:])
+		if *out == "" || cmd.NArg() != 0 {
+			fail(KindUsage, "Usage: keygen dkg identity -key f")
+		}
+		id, err := dkg.NewIdentity()
+		if err != nil {
+			fail(KindFailure, "Error: %v", err)
+		}
+		writeNewFile(*out, id.MarshalPEM(), 0600)
+		fmt.Fprintf(os.Stderr, "Wrote %s; give the peer ID to the other operators\n", *out)
+		writeJSON(DKGIdentity{PeerID: id.PeerID(), File: *out})
+		return
+	}
+
+	cmd := flag.NewFlagSet("dkg", flag.ExitOnError)
+	identityPath := cmd.String("identity", "", "Identity written by dkg identity (required)")
+	self := cmd.Int("id", 0, "This participant's number (required)")
+	threshold := cmd.Int("t", ceremony.ThresholdOr(2), "Threshold (minimum signers)")
+	total := cmd.Int("n", ceremony.TotalOr(3), "Total participants")
+	session := cmd.String("session", "", "Name of the run, agreed with the other operators (required)")
+	var listen []string
+	cmd.Func("listen", "Multiaddr to listen on (repeatable; default TCP and QUIC on all interfaces, any port)", func(s string) error {
+		listen = append(listen, s)
+		return nil
+	})
+	mdns := cmd.Bool("mdns", true, "Look for the other participants on the local network")
+	timeout := cmd.Duration("timeout", 10*time.Minute, "Give up after this long")
+	recordPath := cmd.String("record", "", "Write every message sent and received to this new file (JSON lines)")
+	out := shareOutputFlags(cmd, ceremony.SharesOr("shares"))
+	var peers []dkg.Peer
+	cmd.Func("peer", "Other participant as id=peer-id or id=multiaddr/p2p/peer-id (repeatable)", func(s string) error {
+		idStr, rest, ok := strings.Cut(s, "=")
+		id, err := strconv.Atoi(idStr)
+		if !ok || err != nil || id < 1 {
+			return fmt.Errorf("expected id=peer-id or id=multiaddr/p2p/peer-id, got %q", s)
+		}
+		p, err := dkg.ParsePeer(id, rest)
+		if err != nil {
+			return fmt.Errorf("participant %d: %v", id, err)
+		}
+		// The same participant may be given once per address
+		for i := range peers {
+			if peers[i].ID == id && peers[i].PeerID == p.PeerID {
+				peers[i].Addrs = append(peers[i].Addrs, p.Addrs...)
+				return nil
+			}
+		}
+		peers = append(peers, p)
+		return nil
+	})
+	stdioFlags(cmd)
+	cmd.Parse(args)
+
+	if *identityPath == "" || *self == 0 || *session == "" || len(peers) == 0 || cmd.NArg() != 0 {
+		fail(KindUsage, dkgUsage)
+	}
+	if err := frostcore.CheckPurpose(*out.purpose); err != nil {
+		fail(KindUsage, "Error: -purpose: %v", err)
+	}
+	// Fail before the other operators wait on this one
+	if path := shareFilePath(*out.dir, *self); !*out.insecureStdout {
+		if _, err := os.Lstat(path); err == nil {
+			fail(KindInput, "Error: %s already exists", path)
+		}
+	}
+	data, err := os.ReadFile(*identityPath)
+	if err != nil {
+		fail(KindInput, "Error reading %s: %v", *identityPath, err)
+	}
+	identity, err := dkg.ParseIdentity(data)
+	if err != nil {
+		fail(KindInput, "Error: %s: %v", *identityPath, err)
+	}
+
+	var recordFile *os.File
+	if *recordPath != "" {
+		if recordFile, err = os.OpenFile(*recordPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644); err != nil {
+			fail(KindInput, "Error: %v", err)
+		}
+		defer recordFile.Close()
+	}
+
+	cfg := &dkg.Config{
+		ID:        *self,
+		Threshold: *threshold,
+		Total:     *total,
+		Session:   *session,
+		Identity:  identity,
+		Listen:    listen,
+		Peers:     peers,
+		MDNS:      *mdns,
+		Logf: func(format string, args ...any) {
+			fmt.Fprintf(os.Stderr, format+"\n", args...)
+		},
+	}
+	switch {
+	case recordFile != nil && ceremonyLog != nil:
+		cfg.Record = io.MultiWriter(recordFile, &transcriptLines{kind: entryDKGMessage})
+	case recordFile != nil:
+		cfg.Record = recordFile
+	case ceremonyLog != nil:
+		cfg.Record = &transcriptLines{kind: entryDKGMessage}
+	}
+	if err := cfg.Check(); err != nil {
+		fail(KindUsage, "Error: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+	ctx, stop := secret.NotifyContext(ctx)
+	defer stop()
+	fmt.Fprintf(os.Stderr, "Participant %d of %d-of-%d run %q, peer ID %s\n", *self, *threshold, *total, *session, identity.PeerID())
+	res, err := dkg.Run(ctx, cfg)
+	if err != nil {
+		secret.DestroyAll() // fail exits past main's deferred wipe
+		fail(KindTransport, "Error: %v", err)
+	}
+	fmt.Fprintf(os.Stderr, "Every participant confirmed group key %x\n", res.GroupKey)
+	fmt.Fprintf(os.Stderr, "Transcript %x; compare it with the other operators\n", res.Transcript)
+
+	output := KeyGenOutput{
+		Threshold: *threshold,
+		Total:     *total,
+		Shares:    make([]KeyShareOutput, *total),
+	}
+	for i := range output.Shares {
+		output.Shares[i] = KeyShareOutput{
+			Participant: i + 1,
+			GroupKey:    hex.EncodeToString(res.GroupKey),
+			ID:          hex.EncodeToString(frostcore.IDBytes(uint16(i + 1))),
+			PublicShare: hex.EncodeToString(res.PublicShares[i]),
+			Purpose:     *out.purpose,
+			Threshold:   *threshold,
+			Total:       *total,
+		}
+	}
+	output.Shares[*self-1].SecretShare = res.Share
+	out.write(output.Shares[*self-1 : *self])
+	writeJSON(output)
+}
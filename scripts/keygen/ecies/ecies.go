@@ -0,0 +1,108 @@
+// Package ecies encrypts secrets to a recipient's X25519 key: an ephemeral
+// X25519 key per message, HKDF-SHA256 and AES-256-GCM. Sub-shares of key
+// generation, resharing, refresh and enrollment travel this way, so a
+// message that is recorded, relayed or logged holds nothing secret, and
+// whoever carries the messages of a ceremony learns no share.
+package ecies
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/hkdf"
+	"crypto/sha256"
+	"errors"
+	"io"
+
+	"keygen/h2c"
+	"keygen/secret"
+)
+
+// Overhead is the size of a sealed message beyond the plaintext: the
+// ephemeral public key and the GCM tag.
+const Overhead = 32 + 16
+
+// NewKey draws a recipient key.
+func NewKey(random io.Reader) (*ecdh.PrivateKey, error) {
+	return ecdh.X25519().GenerateKey(random)
+}
+
+// ParsePublicKey decodes a recipient's public key.
+func ParsePublicKey(b []byte) (*ecdh.PublicKey, error) {
+	key, err := ecdh.X25519().NewPublicKey(b)
+	if err != nil {
+		return nil, errors.New("malformed encryption key")
+	}
+	return key, nil
+}
+
+// ParsePrivateKey decodes a recipient key.
+func ParsePrivateKey(b []byte) (*ecdh.PrivateKey, error) {
+	key, err := ecdh.X25519().NewPrivateKey(b)
+	if err != nil {
+		return nil, errors.New("malformed private encryption key")
+	}
+	return key, nil
+}
+
+// Seal encrypts plaintext to the key to. info separates the uses of a key;
+// aad is authenticated but not encrypted, and binds the ciphertext to its
+// session, sender and recipient.
+func Seal(info string, to *ecdh.PublicKey, plaintext, aad []byte, random io.Reader) ([]byte, error) {
+	eph, err := ecdh.X25519().GenerateKey(random)
+	if err != nil {
+		return nil, err
+	}
+	shared, err := eph.ECDH(to)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(info, shared, eph.PublicKey().Bytes(), to.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	// The key is used once, so the nonce can be fixed
+	nonce := make([]byte, aead.NonceSize())
+	return aead.Seal(eph.PublicKey().Bytes(), nonce, plaintext, aad), nil
+}
+
+// Open decrypts what Seal encrypted to key's public half with the same info
+// and aad.
+func Open(info string, key *ecdh.PrivateKey, box, aad []byte) ([]byte, error) {
+	if len(box) < Overhead {
+		return nil, errors.New("sealed message too short")
+	}
+	eph, err := ecdh.X25519().NewPublicKey(box[:32])
+	if err != nil {
+		return nil, errors.New("malformed ephemeral key")
+	}
+	shared, err := key.ECDH(eph)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(info, shared, box[:32], key.PublicKey().Bytes())
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := aead.Open(nil, make([]byte, aead.NonceSize()), box[32:], aad)
+	if err != nil {
+		return nil, errors.New("does not decrypt with this key")
+	}
+	return plaintext, nil
+}
+
+// newAEAD derives the AEAD of one sealed message from its X25519 shared
+// secret, salted with the ephemeral and recipient keys. It wipes shared.
+func newAEAD(info string, shared, eph, recipient []byte) (cipher.AEAD, error) {
+	defer secret.Wipe(shared)
+	k, err := hkdf.Key(sha256.New, shared, h2c.Context(eph, recipient), info, 32)
+	if err != nil {
+		return nil, err
+	}
+	defer secret.Wipe(k)
+	block, err := aes.NewCipher(k)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
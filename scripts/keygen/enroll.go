@@ -0,0 +1,372 @@
+package main
+
+import (
+	"crypto/ecdh"
+	"crypto/rand"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"slices"
+	"strings"
+
+	"keygen/apdu"
+	"keygen/frostcore"
+	"keygen/groupstate"
+	"keygen/schema"
+	"keygen/secret"
+)
+
+// EnrollSession fixes an enrollment of participant NewID into a group. It is
+// public and is given to every helper and the new participant.
+type EnrollSession struct {
+	ID           string   `json:"id"` // Random; binds messages to this session
+	GroupKey     string   `json:"group_key"`
+	Threshold    int      `json:"threshold"`
+	Total        int      `json:"total"`   // Before enrollment
+	Helpers      []int    `json:"helpers"` // Existing participants, at least the threshold
+	NewID        int      `json:"new_id"`
+	PublicShares []string `json:"public_shares"` // Index i is participant i+1
+
+	// HelperKeys are the helpers' keys from recipient-key, in the order of
+	// Helpers, and NewKey the new participant's. Pieces are sealed to the
+	// helpers and sums to the new participant.
+	HelperKeys []string `json:"helper_keys"`
+	NewKey     string   `json:"new_key"`
+}
+
+// EnrollSum is the sum of the pieces one helper received, sealed to the new
+// participant.
+type EnrollSum struct {
+	Session string `json:"session"`
+	From    int    `json:"from"`
+	Sum     string `json:"sum"`
+}
+
+// runEnroll adds participant n+1 to a group without changing its key:
+//
+//	enroll init -helpers 1,2 -recipients k1,k2 -new-key k [-state f]        start a session
+//	enroll split -share f [-id i] [-session f] [-out-dir d]                  each helper splits its contribution
+//	enroll combine -id j -key f [-session f] <enroll-i-to-j.json>...         each helper sums the pieces sealed to it
+//	enroll finalize -key f [-ledger] [-out-dir d] <sum.json>...             the new participant's share
+//
+// split seals each piece to its helper and writes it to
+// enroll-<i>-to-<j>.json; combine seals its sum to the new participant.
+func runEnroll(args []string) {
+	if len(args) < 1 {
+		fail(KindUsage, "Usage: keygen enroll <init|split|combine|finalize> [options]")
+	}
+	cmd := flag.NewFlagSet("enroll "+args[0], flag.ExitOnError)
+	statePath := cmd.String("state", ceremony.GroupStateOr("group-state.json"), "Group-state document of the group")
+	helpers := cmd.String("helpers", "", "Existing participants helping (comma-separated, at least t)")
+	sessionPath := cmd.String("session", "enroll-session.json", "Session from enroll init")
+	sharePath := cmd.String("share", "", "Own key share (a share or a keygen output)")
+	id := cmd.Int("id", 0, "Helper to act as")
+	recipients := cmd.String("recipients", "", "Helpers' recipient keys from recipient-key, comma-separated in the order of -helpers")
+	newKey := cmd.String("new-key", "", "The new participant's recipient key from recipient-key")
+	keyPath := cmd.String("key", "", "Own recipient key from recipient-key")
+	seedHex := cmd.String("seed", "", "Derive the pieces from this hex seed (test fixtures only)")
+	ledger := cmd.Bool("ledger", false, "The new participant is a Ledger: write an APDU script instead of a share file")
+	outDir := cmd.String("out-dir", "enroll-out", "Output directory; split writes the sealed pieces here")
+	stdioFlags(cmd)
+	cmd.Parse(args[1:])
+
+	var err error
+	switch args[0] {
+	case "init":
+		var ids []int
+		if ids, err = parseIDList(*helpers); err == nil {
+			var session *EnrollSession
+			if session, err = newEnrollSession(loadGroupState(*statePath), ids, *recipients, *newKey); err == nil {
+				writeJSON(session)
+			}
+		}
+
+	case "split":
+		session := loadEnrollSession(*sessionPath)
+		var pieces []*ReshareSubShare
+		if pieces, err = enrollSplit(session, selectShare(*sharePath, *id), randomSource(*seedHex, "enroll")); err == nil {
+			writeSubShares(*outDir, "enroll", pieces)
+			fmt.Fprintf(os.Stderr, "Deliver enroll-%d-to-<j>.json to helper j\n", pieces[0].From)
+		}
+
+	case "combine":
+		if *keyPath == "" {
+			fail(KindUsage, "Usage: keygen enroll combine -id j -key f [-session f] <enroll-i-to-j.json>...")
+		}
+		session := loadEnrollSession(*sessionPath)
+		var out *EnrollSum
+		if out, err = enrollCombine(session, *id, loadRecipientKey(*keyPath), loadSubShares(cmd.Args(), *id), rand.Reader); err == nil {
+			fmt.Fprintf(os.Stderr, "The sum is sealed to participant %d; deliver it there\n", session.NewID)
+			writeJSON(out)
+		}
+
+	case "finalize":
+		if *keyPath == "" {
+			fail(KindUsage, "Usage: keygen enroll finalize -key f [-ledger] [-out-dir d] <sum.json>...")
+		}
+		session := loadEnrollSession(*sessionPath)
+		var list []*EnrollSum
+		for _, path := range cmd.Args() {
+			var s EnrollSum
+			readJSONFile(path, &s)
+			list = append(list, &s)
+		}
+		var share *KeyShareOutput
+		if share, err = enrollFinalize(session, loadRecipientKey(*keyPath), list); err == nil {
+			doc := loadGroupState(*statePath)
+			if doc.GroupKey != session.GroupKey || doc.Total != session.Total {
+				fail(KindInput, "Error: %s is not the group as it was when the session started", *statePath)
+			}
+			next := *doc
+			next.Total = session.NewID
+			next.PublicShares = append(slices.Clone(doc.PublicShares), share.PublicShare)
+			var hw []int
+			if *ledger {
+				hw = []int{share.Participant}
+			}
+			share.Purpose = doc.Purpose
+			key := share.SecretShare.Int()
+			inject := hex.EncodeToString(injectKeysAPDU(hexBytes(share.GroupKey), uint16(share.Participant), key, share.Purpose))
+			secret.WipeInt(key)
+			writeRosterFiles(*outDir, &next, []KeyShareOutput{*share}, []string{inject}, hw,
+				fmt.Sprintf("%d-of-%d", next.Threshold, next.Total))
+			fmt.Fprintf(os.Stderr, "Enrolled participant %d into group %s (now %d-of-%d) in %s\n",
+				share.Participant, share.GroupKey, next.Threshold, next.Total, *outDir)
+		}
+
+	default:
+		fail(KindUsage, "Unknown enroll command: %s", args[0])
+	}
+	if err != nil {
+		fail(KindInput, "Error: %v", err)
+	}
+}
+
+// newEnrollSession starts enrolling participant n+1 with the given helpers
+// and the recipient keys their pieces and sums are sealed to.
+func newEnrollSession(doc *groupstate.Document, helpers []int, helperKeys, newKey string) (*EnrollSession, error) {
+	if err := doc.CheckActive(); err != nil {
+		return nil, fmt.Errorf("%w; refusing to enroll", err)
+	}
+	if len(helpers) < doc.Threshold {
+		return nil, fmt.Errorf("%d helpers, group threshold is %d", len(helpers), doc.Threshold)
+	}
+	if len(doc.PublicShares) != doc.Total {
+		return nil, fmt.Errorf("group state lists %d public shares for %d participants", len(doc.PublicShares), doc.Total)
+	}
+	for _, h := range helpers {
+		if h > doc.Total {
+			return nil, fmt.Errorf("helper %d is not a participant of this group", h)
+		}
+	}
+	if doc.Total+1 > apdu.MaxParticipants {
+		return nil, fmt.Errorf("group already has %d participants, the app accepts at most %d", doc.Total, apdu.MaxParticipants)
+	}
+	keys, err := parseRecipientKeys(helperKeys, len(helpers))
+	if err != nil {
+		return nil, fmt.Errorf("-recipients: %w", err)
+	}
+	newKey = strings.ToLower(strings.TrimSpace(newKey))
+	if _, err := recipientPublicKey(newKey); err != nil {
+		return nil, fmt.Errorf("-new-key: %w", err)
+	}
+	id := make([]byte, 16)
+	rand.Read(id)
+	return &EnrollSession{
+		ID:           hex.EncodeToString(id),
+		GroupKey:     doc.GroupKey,
+		Threshold:    doc.Threshold,
+		Total:        doc.Total,
+		Helpers:      helpers,
+		NewID:        doc.Total + 1,
+		PublicShares: doc.PublicShares,
+		HelperKeys:   keys,
+		NewKey:       newKey,
+	}, nil
+}
+
+// enrollSplit splits a helper's weighted share into a piece per helper and
+// seals each piece to its helper's key. The pieces add up to the weighted
+// share, so no two may travel together in the clear.
+func enrollSplit(session *EnrollSession, share *KeyShareOutput, random io.Reader) ([]*ReshareSubShare, error) {
+	if share.GroupKey != session.GroupKey {
+		return nil, fmt.Errorf("share is for group %s, session is for %s", share.GroupKey, session.GroupKey)
+	}
+	if !slices.Contains(session.Helpers, share.Participant) {
+		return nil, fmt.Errorf("participant %d is not a helper in this session", share.Participant)
+	}
+	if share.PublicShare != session.PublicShares[share.Participant-1] {
+		return nil, fmt.Errorf("share %d does not match the group's public shares", share.Participant)
+	}
+	if share.SecretShare == nil {
+		return nil, fmt.Errorf("participant %d: no secret_share", share.Participant)
+	}
+	key := share.SecretShare.Int()
+	defer secret.WipeInt(key)
+	pieces, err := frostcore.EnrollSplit(uint16(share.Participant), key,
+		helperIDs(session), uint16(session.NewID), random)
+	if err != nil {
+		return nil, err
+	}
+	defer wipeScalars(pieces)
+	var out []*ReshareSubShare
+	for k, p := range pieces {
+		to := session.Helpers[k]
+		sealed, err := sealScalar(enrollPieceInfo, session.ID, share.Participant, to, session.HelperKeys[k], p, random)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, &ReshareSubShare{Session: session.ID, From: share.Participant, To: to, Share: sealed})
+	}
+	return out, nil
+}
+
+// enrollCombine opens the pieces every helper sealed to helper id under
+// key, and seals their sum to the new participant.
+func enrollCombine(session *EnrollSession, id int, key *ecdh.PrivateKey, list []*ReshareSubShare, random io.Reader) (*EnrollSum, error) {
+	k := slices.Index(session.Helpers, id)
+	if k < 0 {
+		return nil, fmt.Errorf("-id %d is not a helper in this session", id)
+	}
+	if !strings.EqualFold(session.HelperKeys[k], hex.EncodeToString(key.PublicKey().Bytes())) {
+		return nil, fmt.Errorf("the key is not helper %d's recipient key in this session", id)
+	}
+	received := make(map[int]*big.Int)
+	defer func() {
+		for _, x := range received {
+			secret.WipeInt(x)
+		}
+	}()
+	for _, p := range list {
+		if p.Session != session.ID {
+			return nil, fmt.Errorf("piece from participant %d belongs to session %s, not %s", p.From, p.Session, session.ID)
+		}
+		if !slices.Contains(session.Helpers, p.From) {
+			return nil, fmt.Errorf("participant %d is not a helper in this session", p.From)
+		}
+		if p.To != id {
+			return nil, fmt.Errorf("piece from participant %d is for %d, not %d", p.From, p.To, id)
+		}
+		if _, dup := received[p.From]; dup {
+			return nil, fmt.Errorf("two pieces from participant %d", p.From)
+		}
+		x, err := openScalar(enrollPieceInfo, session.ID, p.From, id, key, p.Share)
+		if err != nil {
+			return nil, err
+		}
+		received[p.From] = x
+	}
+	sum := new(big.Int)
+	defer secret.WipeInt(sum)
+	for _, h := range session.Helpers {
+		piece, ok := received[h]
+		if !ok {
+			return nil, fmt.Errorf("missing piece from participant %d", h)
+		}
+		sum.Add(sum, piece)
+	}
+	sum.Mod(sum, frostcore.Order)
+	sealed, err := sealScalar(enrollSumInfo, session.ID, id, session.NewID, session.NewKey, sum, random)
+	if err != nil {
+		return nil, err
+	}
+	return &EnrollSum{Session: session.ID, From: id, Sum: sealed}, nil
+}
+
+// enrollFinalize opens every helper's sum under the new participant's key,
+// adds them and checks the result against the public share the helpers'
+// public shares interpolate to.
+func enrollFinalize(session *EnrollSession, key *ecdh.PrivateKey, list []*EnrollSum) (*KeyShareOutput, error) {
+	if !strings.EqualFold(session.NewKey, hex.EncodeToString(key.PublicKey().Bytes())) {
+		return nil, fmt.Errorf("the key is not participant %d's recipient key in this session", session.NewID)
+	}
+	sums := make(map[int]*big.Int)
+	for _, s := range list {
+		if s.Session != session.ID {
+			return nil, fmt.Errorf("sum from participant %d belongs to session %s, not %s", s.From, s.Session, session.ID)
+		}
+		if !slices.Contains(session.Helpers, s.From) {
+			return nil, fmt.Errorf("participant %d is not a helper in this session", s.From)
+		}
+		if _, dup := sums[s.From]; dup {
+			return nil, fmt.Errorf("two sums from participant %d", s.From)
+		}
+		x, err := openScalar(enrollSumInfo, session.ID, s.From, session.NewID, key, s.Sum)
+		if err != nil {
+			return nil, err
+		}
+		sums[s.From] = x
+	}
+	fx := new(big.Int) // f(x), the new participant's share
+	var publicShares [][]byte
+	for _, h := range session.Helpers {
+		sum, ok := sums[h]
+		if !ok {
+			return nil, fmt.Errorf("missing sum from participant %d", h)
+		}
+		fx.Add(fx, sum)
+		secret.WipeInt(sum)
+		publicShares = append(publicShares, hexBytes(session.PublicShares[h-1]))
+	}
+	fx.Mod(fx, frostcore.Order)
+
+	public, err := frostcore.EnrollPublicShare(helperIDs(session), publicShares, uint16(session.NewID))
+	if err != nil {
+		return nil, err
+	}
+	if !slices.Equal(frostcore.BasePoint(fx), public) {
+		return nil, fmt.Errorf("enrolled share does not match the group's polynomial; a helper sent a wrong piece or sum")
+	}
+	share, err := secret.FromInt(fx)
+	if err != nil {
+		return nil, err
+	}
+	return &KeyShareOutput{
+		Participant: session.NewID,
+		GroupKey:    session.GroupKey,
+		ID:          hex.EncodeToString(frostcore.IDBytes(uint16(session.NewID))),
+		SecretShare: share,
+		PublicShare: hex.EncodeToString(public),
+		Threshold:   session.Threshold,
+		Total:       max(session.Total, session.NewID),
+	}, nil
+}
+
+func loadEnrollSession(path string) *EnrollSession {
+	var s EnrollSession
+	readJSONFile(path, &s)
+	if len(s.PublicShares) != s.Total || s.NewID != s.Total+1 {
+		fail(KindInput, "Error: %s: inconsistent session", path)
+	}
+	for _, h := range s.Helpers {
+		if h < 1 || h > s.Total {
+			fail(KindInput, "Error: %s: helper %d has no public share", path, h)
+		}
+	}
+	if len(s.HelperKeys) != len(s.Helpers) || s.NewKey == "" {
+		fail(KindInput, "Error: %s: missing recipient keys; start the session with enroll init -recipients and -new-key", path)
+	}
+	return &s
+}
+
+func helperIDs(s *EnrollSession) []uint16 {
+	ids := make([]uint16, len(s.Helpers))
+	for i, id := range s.Helpers {
+		ids[i] = uint16(id)
+	}
+	return ids
+}
+
+// readJSONFile decodes a JSON file or exits.
+func readJSONFile(path string, v any) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		fail(KindInput, "Error reading %s: %v", path, err)
+	}
+	if err := schema.Unmarshal(data, v, path); err != nil {
+		fail(KindInput, "Error: %s: %v", path, err)
+	}
+}
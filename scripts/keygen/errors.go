@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"keygen/apdu"
+)
+
+// ErrorKind classifies why a command failed. Each kind exits with its own
+// status, so scripts can tell a typo from a forged signature without parsing
+// the message.
+type ErrorKind string
+
+const (
+	KindFailure   ErrorKind = "failure"   // Anything else, e.g. an output file that cannot be written
+	KindUsage     ErrorKind = "usage"     // Unknown command, bad flags or missing arguments
+	KindInput     ErrorKind = "bad_input" // Malformed or inconsistent input: files, JSON, hex, parameters
+	KindCrypto    ErrorKind = "crypto"    // A signature, share, proof, code or counter does not check out
+	KindTransport ErrorKind = "transport" // A device, emulator or remote service could not be reached
+	KindRejected  ErrorKind = "rejected"  // The user rejected the operation on the device
+)
+
+// ExitCode returns the process exit status for the kind. Bad flags exit
+// with 2 from the flag package itself, the same as KindUsage.
+func (k ErrorKind) ExitCode() int {
+	switch k {
+	case KindUsage:
+		return 2
+	case KindInput:
+		return 3
+	case KindCrypto:
+		return 4
+	case KindTransport:
+		return 5
+	case KindRejected:
+		return 6
+	}
+	return 1
+}
+
+// ErrorOutput is what --json-errors writes to stderr, one object per line,
+// in place of the error message.
+type ErrorOutput struct {
+	Error    string    `json:"error"`
+	Kind     ErrorKind `json:"kind"`
+	ExitCode int       `json:"exit_code"`
+	Command  string    `json:"command,omitempty"`
+}
+
+// jsonErrors is set by --json-errors.
+var jsonErrors bool
+
+// fail reports a failure and exits with the status of its kind. The message
+// is printed as formatted, or with --json-errors as an ErrorOutput without
+// its "Error: " prefix.
+func fail(kind ErrorKind, format string, args ...any) {
+	msg := fmt.Sprintf(format, args...)
+	short := strings.TrimPrefix(strings.TrimPrefix(msg, "Error: "), "Error ")
+	logger.Error("failed", "kind", kind, "exit_code", kind.ExitCode(), "error", short, "elapsed", time.Since(started))
+	record(entryFailure, map[string]any{"kind": kind, "exit_code": kind.ExitCode(), "error": short})
+	if !jsonErrors {
+		fmt.Fprintln(os.Stderr, msg)
+		os.Exit(kind.ExitCode())
+	}
+	out := ErrorOutput{
+		Error:    short,
+		Kind:     kind,
+		ExitCode: kind.ExitCode(),
+	}
+	if len(os.Args) > 1 {
+		out.Command = os.Args[1]
+	}
+	json.NewEncoder(os.Stderr).Encode(out)
+	os.Exit(out.ExitCode)
+}
+
+// statusKind classifies a status word the device answered ins with. 6985
+// to a command with a confirmation screen is taken as a rejection, although
+// PARTIAL_SIGN also returns it when the commitments are incomplete.
+func statusKind(sw uint16, ins byte) ErrorKind {
+	if sw == apdu.SwUserRejected && apdu.NeedsApproval(ins) {
+		return KindRejected
+	}
+	return KindFailure
+}
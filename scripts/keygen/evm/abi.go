@@ -0,0 +1,50 @@
+// Package evm encodes verifier calls as EVM calldata and estimates what they
+// cost to submit, offline or against a JSON-RPC endpoint.
+package evm
+
+import (
+	"encoding/hex"
+	"fmt"
+	"math/big"
+
+	"golang.org/x/crypto/sha3"
+)
+
+// WordSize is the size of an ABI word.
+const WordSize = 32
+
+// Selector returns the 4-byte function selector for a canonical signature
+// such as "verify(uint256,uint256)".
+func Selector(signature string) []byte {
+	h := sha3.NewLegacyKeccak256()
+	h.Write([]byte(signature))
+	return h.Sum(nil)[:4]
+}
+
+// Word encodes a non-negative integer below 2^256 as an ABI word.
+func Word(x *big.Int) ([]byte, error) {
+	if x.Sign() < 0 || x.BitLen() > 8*WordSize {
+		return nil, fmt.Errorf("evm: %s does not fit a uint256", x)
+	}
+	return x.FillBytes(make([]byte, WordSize)), nil
+}
+
+// EncodeCall encodes a call to a function whose arguments are all static
+// words (uint256, bytes32 and fixed-size arrays of them), which the ABI lays
+// out inline in order.
+func EncodeCall(signature string, args ...*big.Int) ([]byte, error) {
+	out := append(make([]byte, 0, 4+len(args)*WordSize), Selector(signature)...)
+	for i, a := range args {
+		w, err := Word(a)
+		if err != nil {
+			return nil, fmt.Errorf("%s argument %d: %w", signature, i, err)
+		}
+		out = append(out, w...)
+	}
+	return out, nil
+}
+
+// Hex encodes data as 0x-prefixed hex, as JSON-RPC expects.
+func Hex(data []byte) string {
+	return "0x" + hex.EncodeToString(data)
+}
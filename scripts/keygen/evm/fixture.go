@@ -0,0 +1,98 @@
+package evm
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Fixture is a group signature made with the Poseidon challenge, as a
+// Solidity test of a BabyJubJub EdDSA-Poseidon verifier takes it: bytes32
+// values as 0x-prefixed hex, uint256 values in decimal.
+type Fixture struct {
+	GroupKey    string `json:"group_key"`    // bytes32 Y, compressed
+	MessageHash string `json:"message_hash"` // bytes32
+	R           string `json:"R"`            // bytes32, compressed
+
+	// Arguments of verify(Ax, Ay, R8x, R8y, S, M): circomlib's A = Y/8,
+	// R in affine form, S = z and M = message_hash
+	Ax  string `json:"Ax"`
+	Ay  string `json:"Ay"`
+	R8x string `json:"R8x"`
+	R8y string `json:"R8y"`
+	S   string `json:"S"`
+	M   string `json:"M"`
+
+	// The call the test makes
+	Function string `json:"function"`
+	Calldata string `json:"calldata"`
+}
+
+// TestContract renders a forge-std test that deploys the verifier from
+// artifact (as deployCode takes it) and checks that it accepts the
+// fixture and rejects it with the message changed. compressed selects
+// verify(bytes32 Y, bytes32 R, uint256 S, uint256 M) over the affine
+// verify(Ax, Ay, R8x, R8y, S, M); function is the name of either.
+func (f *Fixture) TestContract(contract, artifact, function string, compressed bool) string {
+	params := "uint256 Ax, uint256 Ay, uint256 R8x, uint256 R8y, uint256 S, uint256 M"
+	args := "AX, AY, R8X, R8Y, S, %s"
+	if compressed {
+		params = "bytes32 Y, bytes32 R, uint256 S, uint256 M"
+		args = "GROUP_KEY, R, S, %s"
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, `// SPDX-License-Identifier: MIT
+// Generated by keygen export solidity; regenerate rather than edit.
+pragma solidity ^0.8.20;
+
+import {Test} from "forge-std/Test.sol";
+
+interface IFrostVerifier {
+    function %[1]s(%[2]s) external view returns (bool);
+}
+
+/// A FROST group signature made with the Poseidon challenge.
+library %[3]sFixture {
+    bytes32 internal constant GROUP_KEY = %[4]s;
+    bytes32 internal constant MESSAGE_HASH = %[5]s;
+    bytes32 internal constant R = %[6]s;
+
+    uint256 internal constant AX = %[7]s;
+    uint256 internal constant AY = %[8]s;
+    uint256 internal constant R8X = %[9]s;
+    uint256 internal constant R8Y = %[10]s;
+    uint256 internal constant S = %[11]s;
+    uint256 internal constant M = %[12]s;
+}
+
+contract %[3]s is Test {
+    IFrostVerifier internal verifier;
+
+    function setUp() public {
+        verifier = IFrostVerifier(deployCode(%[13]q));
+    }
+
+    function testAcceptsGroupSignature() public view {
+        assertTrue(verifier.%[1]s(%[14]s));
+    }
+
+    function testRejectsOtherMessage() public view {
+        assertFalse(verifier.%[1]s(%[15]s));
+    }
+}
+`, function, params, contract,
+		f.GroupKey, f.MessageHash, f.R,
+		f.Ax, f.Ay, f.R8x, f.R8y, f.S, f.M,
+		artifact,
+		prefixed(contract+"Fixture.", fmt.Sprintf(args, "M")),
+		prefixed(contract+"Fixture.", fmt.Sprintf(args, "M ^ 1")))
+	return b.String()
+}
+
+// prefixed qualifies each comma-separated constant with the library name.
+func prefixed(lib, args string) string {
+	parts := strings.Split(args, ", ")
+	for i, p := range parts {
+		parts[i] = lib + p
+	}
+	return strings.Join(parts, ", ")
+}
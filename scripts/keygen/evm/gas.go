@@ -0,0 +1,43 @@
+package evm
+
+// Gas schedule (Istanbul onwards)
+const (
+	TxGas            = 21000 // Base cost of a transaction
+	TxDataZeroGas    = 4     // Per zero calldata byte (EIP-2028)
+	TxDataNonZeroGas = 16    // Per non-zero calldata byte (EIP-2028)
+
+	// BN254 precompiles (EIP-1108)
+	EcAddGas          = 150
+	EcMulGas          = 6000
+	PairingBaseGas    = 45000
+	PairingPerPairGas = 34000
+)
+
+// CalldataGas returns what a transaction pays for data, and how many of its
+// bytes are zero.
+func CalldataGas(data []byte) (gas uint64, zeros int) {
+	for _, b := range data {
+		if b == 0 {
+			zeros++
+			gas += TxDataZeroGas
+		} else {
+			gas += TxDataNonZeroGas
+		}
+	}
+	return gas, zeros
+}
+
+// IntrinsicGas is the gas a call with data costs before any code runs.
+func IntrinsicGas(data []byte) uint64 {
+	gas, _ := CalldataGas(data)
+	return TxGas + gas
+}
+
+// Groth16VerifyGas is the precompile gas of a snarkjs-style Groth16 verifier
+// with nPublic public inputs: one ecMul and ecAdd per input to fold them into
+// the verifying key, and a four-pair pairing check. The contract's own
+// execution comes on top, so this is a lower bound.
+func Groth16VerifyGas(nPublic int) uint64 {
+	n := uint64(nPublic)
+	return n*(EcMulGas+EcAddGas) + PairingBaseGas + 4*PairingPerPairGas
+}
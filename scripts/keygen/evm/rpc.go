@@ -0,0 +1,234 @@
+package evm
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Client calls an Ethereum JSON-RPC endpoint.
+type Client struct {
+	URL    string
+	Client *http.Client
+
+	id atomic.Uint64
+}
+
+// CallMsg is a call to simulate or estimate. Addresses are 0x-prefixed hex.
+type CallMsg struct {
+	From string `json:"from,omitempty"`
+	To   string `json:"to"`
+	Data string `json:"data"` // 0x-prefixed calldata
+}
+
+// RPCError is an error returned by the endpoint, such as a revert.
+type RPCError struct {
+	Code    int             `json:"code"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data,omitempty"`
+}
+
+func (e *RPCError) Error() string {
+	return fmt.Sprintf("%s (code %d)", e.Message, e.Code)
+}
+
+type rpcRequest struct {
+	JSONRPC string `json:"jsonrpc"`
+	ID      uint64 `json:"id"`
+	Method  string `json:"method"`
+	Params  []any  `json:"params"`
+}
+
+type rpcResponse struct {
+	Result json.RawMessage `json:"result"`
+	Error  *RPCError       `json:"error"`
+}
+
+func (c *Client) call(ctx context.Context, method string, result any, params ...any) error {
+	if params == nil {
+		params = []any{}
+	}
+	body, _ := json.Marshal(rpcRequest{JSONRPC: "2.0", ID: c.id.Add(1), Method: method, Params: params})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	client := c.Client
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("evm: %s: %w", method, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("evm: %s: endpoint returned %s", method, resp.Status)
+	}
+	var r rpcResponse
+	if err := json.NewDecoder(resp.Body).Decode(&r); err != nil {
+		return fmt.Errorf("evm: %s: decoding response: %w", method, err)
+	}
+	if r.Error != nil {
+		return fmt.Errorf("evm: %s: %w", method, r.Error)
+	}
+	if err := json.Unmarshal(r.Result, result); err != nil {
+		return fmt.Errorf("evm: %s: decoding result: %w", method, err)
+	}
+	return nil
+}
+
+// parseQuantity decodes a 0x-prefixed hex quantity.
+func parseQuantity(method, s string) (*big.Int, error) {
+	x, ok := new(big.Int).SetString(strings.TrimPrefix(s, "0x"), 16)
+	if !ok || !strings.HasPrefix(s, "0x") {
+		return nil, fmt.Errorf("evm: %s: invalid quantity %q", method, s)
+	}
+	return x, nil
+}
+
+func (c *Client) quantity(ctx context.Context, method string, params ...any) (*big.Int, error) {
+	var s string
+	if err := c.call(ctx, method, &s, params...); err != nil {
+		return nil, err
+	}
+	return parseQuantity(method, s)
+}
+
+// ChainID returns the endpoint's chain ID.
+func (c *Client) ChainID(ctx context.Context) (uint64, error) {
+	x, err := c.quantity(ctx, "eth_chainId")
+	if err != nil {
+		return 0, err
+	}
+	return x.Uint64(), nil
+}
+
+// GasPrice returns the endpoint's suggested gas price in wei.
+func (c *Client) GasPrice(ctx context.Context) (*big.Int, error) {
+	return c.quantity(ctx, "eth_gasPrice")
+}
+
+// EstimateGas returns the gas msg would use, including the intrinsic gas. A
+// call that reverts is an error.
+func (c *Client) EstimateGas(ctx context.Context, msg CallMsg) (uint64, error) {
+	x, err := c.quantity(ctx, "eth_estimateGas", msg)
+	if err != nil {
+		return 0, err
+	}
+	if !x.IsUint64() {
+		return 0, fmt.Errorf("evm: eth_estimateGas: %s is out of range", x)
+	}
+	return x.Uint64(), nil
+}
+
+// Call runs msg against the latest block and returns its return data.
+func (c *Client) Call(ctx context.Context, msg CallMsg) ([]byte, error) {
+	var s string
+	if err := c.call(ctx, "eth_call", &s, msg, "latest"); err != nil {
+		return nil, err
+	}
+	data, err := hex.DecodeString(strings.TrimPrefix(s, "0x"))
+	if err != nil {
+		return nil, fmt.Errorf("evm: eth_call: invalid return data: %w", err)
+	}
+	return data, nil
+}
+
+// SendTransaction sends msg as a transaction from msg.From, which the
+// endpoint must sign for (an unlocked or node-managed account), and returns
+// its hash.
+func (c *Client) SendTransaction(ctx context.Context, msg CallMsg) (string, error) {
+	if msg.From == "" {
+		return "", fmt.Errorf("evm: eth_sendTransaction: no sender")
+	}
+	var hash string
+	if err := c.call(ctx, "eth_sendTransaction", &hash, msg); err != nil {
+		return "", err
+	}
+	return hash, nil
+}
+
+// Receipt is the part of a transaction receipt that tells whether it was
+// mined and succeeded.
+type Receipt struct {
+	BlockNumber uint64
+	Success     bool
+}
+
+// TransactionReceipt returns the receipt of a transaction, or nil if it is
+// not mined yet.
+func (c *Client) TransactionReceipt(ctx context.Context, hash string) (*Receipt, error) {
+	var r *struct {
+		BlockNumber string `json:"blockNumber"`
+		Status      string `json:"status"`
+	}
+	if err := c.call(ctx, "eth_getTransactionReceipt", &r, hash); err != nil {
+		return nil, err
+	}
+	if r == nil || r.BlockNumber == "" {
+		return nil, nil
+	}
+	block, err := parseQuantity("eth_getTransactionReceipt", r.BlockNumber)
+	if err != nil {
+		return nil, err
+	}
+	return &Receipt{BlockNumber: block.Uint64(), Success: r.Status == "0x1"}, nil
+}
+
+// BlockNumber returns the number of the latest block.
+func (c *Client) BlockNumber(ctx context.Context) (uint64, error) {
+	x, err := c.quantity(ctx, "eth_blockNumber")
+	if err != nil {
+		return 0, err
+	}
+	return x.Uint64(), nil
+}
+
+// Bool decodes return data holding a single bool. ok is false for anything
+// else.
+func Bool(ret []byte) (v, ok bool) {
+	if len(ret) != WordSize {
+		return false, false
+	}
+	for _, b := range ret[:WordSize-1] {
+		if b != 0 {
+			return false, false
+		}
+	}
+	switch ret[WordSize-1] {
+	case 0:
+		return false, true
+	case 1:
+		return true, true
+	}
+	return false, false
+}
+
+// ParseGwei parses a gas price in gwei, such as "0.05" or "30", into wei.
+func ParseGwei(s string) (*big.Int, error) {
+	r, ok := new(big.Rat).SetString(s)
+	if !ok || r.Sign() < 0 {
+		return nil, fmt.Errorf("invalid gas price %q", s)
+	}
+	r.Mul(r, new(big.Rat).SetInt64(1e9))
+	if !r.IsInt() {
+		return nil, fmt.Errorf("gas price %s gwei is not a whole number of wei", s)
+	}
+	return r.Num(), nil
+}
+
+// FormatGwei formats wei as gwei.
+func FormatGwei(wei *big.Int) string {
+	f, _ := new(big.Rat).SetFrac(wei, big.NewInt(1e9)).Float64()
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
@@ -0,0 +1,348 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"keygen/circom"
+	"keygen/evm"
+	"keygen/frostcore"
+	"keygen/sandbox"
+	"keygen/schema"
+	"keygen/workspace"
+)
+
+// pluginPrefix names exporter plugins on PATH: export plugin foo runs
+// keygen-export-foo.
+const pluginPrefix = "keygen-export-"
+
+// CircomHarnessInput is read from stdin by export circom-harness: a group
+// signature made with the Poseidon challenge (INJECT_CHALLENGE).
+type CircomHarnessInput struct {
+	GroupKey    string `json:"group_key"`
+	MessageHash string `json:"message_hash"` // M, a 32-byte field element
+	R           string `json:"R"`
+	Z           string `json:"z"`
+}
+
+// runExport implements the export subcommands:
+//
+//	export circom-harness [-out-dir dir] [-include path] [-force] (signature JSON on stdin)
+//	export calldata [-encoding list] [-rpc url -to addr] [-json]   (signature JSON on stdin)
+//	export solidity [-out-dir dir] [-contract name] [-artifact a]  (signature JSON on stdin)
+//	export plugin [limits] <name> [args...]                       (input on stdin)
+func runExport(args []string, ws *workspace.Context) {
+	if len(args) < 1 {
+		fail(KindUsage, "Usage: keygen export <circom-harness|calldata|solidity|plugin> [options]")
+	}
+
+	switch args[0] {
+	case "circom-harness":
+		cmd := flag.NewFlagSet("export circom-harness", flag.ExitOnError)
+		out := cmd.String("out-dir", "circom-harness", "Output directory")
+		include := cmd.String("include", circom.DefaultInclude, "Directory containing circomlib's eddsaposeidon.circom, relative to the output")
+		force := cmd.Bool("force", false, "Write the harness even if the signature does not verify")
+		stdioFlags(cmd)
+		cmd.Parse(args[1:])
+		runExportCircomHarness(*out, *include, *force)
+	case "calldata":
+		cmd := flag.NewFlagSet("export calldata", flag.ExitOnError)
+		encoding := cmd.String("encoding", "all", "Encodings to compare: "+strings.Join(calldataEncodings, ",")+" or all (groth16 needs -proof)")
+		function := cmd.String("function", "verify", "Verifier function name for the affine and compressed encodings")
+		proof := cmd.String("proof", "", "snarkjs proof.json of the Circom harness, for the groth16 encoding")
+		public := cmd.String("public", "", "snarkjs public.json for -proof")
+		rpc := cmd.String("rpc", ceremony.RPC, "Ethereum JSON-RPC endpoint for gas estimates")
+		to := cmd.String("to", ceremony.Verifier, "Verifier contract address to estimate against")
+		from := cmd.String("from", "", "Sender address for the estimates")
+		gasPrice := cmd.String("gas-price", "", "Gas price in gwei (default: the endpoint's eth_gasPrice)")
+		timeout := cmd.Duration("timeout", 30*time.Second, "Limit for all RPC calls")
+		asJSON := cmd.Bool("json", false, "Print the report as JSON")
+		stdioFlags(cmd)
+		cmd.Parse(args[1:])
+		encodings, err := parseEncodings(*encoding, *proof != "")
+		if err != nil {
+			fail(KindInput, "Error: -encoding: %v", err)
+		}
+		runExportCalldata(calldataConfig{
+			encodings:  encodings,
+			function:   *function,
+			proofPath:  *proof,
+			publicPath: *public,
+			rpc:        *rpc,
+			to:         *to,
+			from:       *from,
+			gasPrice:   *gasPrice,
+			timeout:    *timeout,
+			asJSON:     *asJSON,
+		})
+	case "solidity":
+		cmd := flag.NewFlagSet("export solidity", flag.ExitOnError)
+		out := cmd.String("out-dir", "solidity-fixture", "Output directory")
+		contract := cmd.String("contract", "FrostVerifierTest", "Name of the test contract")
+		artifact := cmd.String("artifact", "FrostVerifier.sol", "Verifier to deploy, as forge-std's deployCode takes it")
+		function := cmd.String("function", "verify", "Verifier function name")
+		encoding := cmd.String("encoding", EncodingAffine, "Verifier interface: affine or compressed")
+		force := cmd.Bool("force", false, "Write the fixture even if the signature does not verify")
+		stdioFlags(cmd)
+		cmd.Parse(args[1:])
+		if *encoding != EncodingAffine && *encoding != EncodingCompressed {
+			fail(KindUsage, "Error: -encoding %q: expected affine or compressed", *encoding)
+		}
+		runExportSolidity(*out, *contract, *artifact, *function, *encoding, *force)
+	case "plugin":
+		cmd := flag.NewFlagSet("export plugin", flag.ExitOnError)
+		timeout := cmd.Duration("timeout", sandbox.Default.Timeout, "Wall-clock limit")
+		cpu := cmd.Duration("cpu", sandbox.Default.CPU, "CPU time limit")
+		memory := cmd.Int64("memory", sandbox.Default.Memory>>20, "Address space limit in MiB")
+		network := cmd.Bool("network", false, "Allow network access")
+		hide := cmd.String("hide", "", "Further paths to hide from the plugin (comma-separated)")
+		unconfined := cmd.Bool("unconfined", false, "Run even if paths cannot be hidden (no bwrap)")
+		stdioFlags(cmd)
+		cmd.Parse(args[1:])
+		if cmd.NArg() < 1 {
+			fail(KindUsage, "Usage: keygen export plugin [limits] <name> [args...]")
+		}
+		limits := sandbox.Limits{
+			Timeout:    *timeout,
+			CPU:        *cpu,
+			Memory:     *memory << 20,
+			Output:     sandbox.Default.Output,
+			Hide:       pluginHiddenPaths(ws, *hide),
+			Network:    *network,
+			Unconfined: *unconfined,
+		}
+		runExportPlugin(limits, cmd.Arg(0), cmd.Args()[1:])
+	default:
+		fail(KindUsage, "Unknown export command: %s", args[0])
+	}
+}
+
+// circomSignature converts a signature made with the Poseidon challenge to
+// circomlib's form.
+func circomSignature(groupKey, msg, r, z []byte) circom.Signature {
+	ax, ay, err := frostcore.CircomPublicKey(groupKey)
+	if err != nil {
+		fail(KindInput, "Error: %v", err)
+	}
+	rx, ry, err := frostcore.Affine(r)
+	if err != nil {
+		fail(KindInput, "Error: R: %v", err)
+	}
+	return circom.NewHarness(ax, ay, frostcore.ScalarFromBytes(msg), rx, ry, frostcore.ScalarFromBytes(z)).Signature()
+}
+
+// writeCircomSignature prints a signature made with the Poseidon challenge
+// as a circom.Signature and records it in the transcript. The output is not
+// stamped with the ciphersuite, since witness generation rejects an input
+// the circuit has no signal for.
+func writeCircomSignature(groupKey, msg, r, z []byte) {
+	sig := circomSignature(groupKey, msg, r, z)
+	record(entryOutput, sig)
+	data, _ := json.MarshalIndent(sig, "", "  ")
+	os.Stdout.Write(append(data, '\n'))
+}
+
+// emitCircomWitness writes a signature made with the Poseidon challenge to
+// path as the witness input of a circuit verifying it, unstamped like
+// writeCircomSignature's output.
+func emitCircomWitness(path string, groupKey, msg, r, z []byte) {
+	data, _ := json.MarshalIndent(circomSignature(groupKey, msg, r, z), "", "  ")
+	if err := os.WriteFile(path, append(data, '\n'), 0644); err != nil {
+		fail(KindFailure, "Error writing %s: %v", path, err)
+	}
+	fmt.Fprintf(os.Stderr, "Wrote the witness input to %s\n", path)
+}
+
+// runExportSolidity writes the signature on stdin as a JSON fixture and a
+// forge-std test contract that checks the on-chain verifier accepts it.
+func runExportSolidity(out, contract, artifact, function, encoding string, force bool) {
+	var input CircomHarnessInput
+	if err := schema.Decode(os.Stdin, &input, stdinName); err != nil {
+		fail(KindInput, "Error reading input: %v", err)
+	}
+	if !validSolidityName.MatchString(contract) {
+		fail(KindUsage, "Error: -contract %q is not a Solidity identifier", contract)
+	}
+	cfg := calldataConfig{function: function}
+	sig, args, err := calldataArgs(encoding, cfg, &input)
+	if err != nil {
+		fail(KindInput, "Error: %v", err)
+	}
+	data, err := evm.EncodeCall(sig, args...)
+	if err != nil {
+		fail(KindInput, "Error: %v", err)
+	}
+	affine := args
+	if encoding != EncodingAffine {
+		_, affine, _ = calldataArgs(EncodingAffine, cfg, &input)
+	}
+
+	// As for the harness, a fixture that cannot verify is not shipped
+	valid, err := frostcore.VerifyPoseidon(hexBytes(input.GroupKey), hexBytes(input.MessageHash), hexBytes(input.R), hexBytes(input.Z))
+	if err != nil {
+		fail(KindCrypto, "Error verifying signature: %v", err)
+	}
+	if !valid {
+		const msg = "Signature does not verify with the Poseidon challenge (was it signed with INJECT_CHALLENGE?)"
+		if !force {
+			fail(KindCrypto, msg)
+		}
+		fmt.Fprintln(os.Stderr, msg)
+	}
+
+	fixture := &evm.Fixture{
+		GroupKey:    "0x" + strings.ToLower(input.GroupKey),
+		MessageHash: "0x" + strings.ToLower(input.MessageHash),
+		R:           "0x" + strings.ToLower(input.R),
+		Ax:          affine[0].String(),
+		Ay:          affine[1].String(),
+		R8x:         affine[2].String(),
+		R8y:         affine[3].String(),
+		S:           affine[4].String(),
+		M:           affine[5].String(),
+		Function:    sig,
+		Calldata:    evm.Hex(data),
+	}
+	fixtureJSON, err := jsonOutput(fixture)
+	if err != nil {
+		fail(KindFailure, "Error encoding the fixture: %v", err)
+	}
+	files := []struct {
+		name string
+		data string
+	}{
+		{contract + ".t.sol", fixture.TestContract(contract, artifact, function, encoding == EncodingCompressed)},
+		{"fixture.json", string(fixtureJSON)},
+	}
+	if err := os.MkdirAll(out, 0755); err != nil {
+		fail(KindFailure, "Error creating %s: %v", out, err)
+	}
+	for _, f := range files {
+		path := filepath.Join(out, f.name)
+		if err := os.WriteFile(path, []byte(f.data), 0644); err != nil {
+			fail(KindFailure, "Error writing %s: %v", path, err)
+		}
+	}
+	fmt.Fprintf(os.Stderr, "Wrote %s; copy %s.t.sol to the verifier's test directory and run forge test\n", out, contract)
+}
+
+var validSolidityName = regexp.MustCompile(`^[A-Za-z_$][A-Za-z0-9_$]*$`)
+
+// runExportCircomHarness writes a Circom circuit verifying signatures of this
+// group, an input.json from the given signature and a script to run both.
+func runExportCircomHarness(out, include string, force bool) {
+	var input CircomHarnessInput
+	if err := schema.Decode(os.Stdin, &input, stdinName); err != nil {
+		fail(KindInput, "Error reading input: %v", err)
+	}
+	groupKey, err := hex.DecodeString(input.GroupKey)
+	if err != nil {
+		fail(KindInput, "Error: group_key: %v", err)
+	}
+	msg, err := hex.DecodeString(input.MessageHash)
+	if err != nil || len(msg) != 32 {
+		fail(KindInput, "Error: message_hash: expected 32 bytes of hex")
+	}
+	r, err := hex.DecodeString(input.R)
+	if err != nil {
+		fail(KindInput, "Error: R: %v", err)
+	}
+	z, err := hex.DecodeString(input.Z)
+	if err != nil {
+		fail(KindInput, "Error: z: %v", err)
+	}
+
+	// Check first, so a harness never ships with an input that cannot verify
+	valid, err := frostcore.VerifyPoseidon(groupKey, msg, r, z)
+	if err != nil {
+		fail(KindCrypto, "Error verifying signature: %v", err)
+	}
+	if !valid {
+		const msg = "Signature does not verify with the Poseidon challenge (was it signed with INJECT_CHALLENGE?)"
+		if !force {
+			fail(KindCrypto, msg)
+		}
+		fmt.Fprintln(os.Stderr, msg)
+	}
+
+	ax, ay, err := frostcore.CircomPublicKey(groupKey)
+	if err != nil {
+		fail(KindInput, "Error: %v", err)
+	}
+	rx, ry, err := frostcore.Affine(r)
+	if err != nil {
+		fail(KindInput, "Error: R: %v", err)
+	}
+	m := frostcore.ScalarFromBytes(msg)
+	h := circom.NewHarness(ax, ay, m, rx, ry, frostcore.ScalarFromBytes(z))
+
+	inputJSON, _ := json.MarshalIndent(h.Input, "", "  ")
+	files := []struct {
+		name string
+		data string
+		mode os.FileMode
+	}{
+		{"frost_verify.circom", h.Circuit(include), 0644},
+		{"input.json", string(inputJSON) + "\n", 0644},
+		{"run.sh", circom.Script, 0755},
+	}
+	if err := os.MkdirAll(out, 0755); err != nil {
+		fail(KindFailure, "Error creating %s: %v", out, err)
+	}
+	for _, f := range files {
+		path := filepath.Join(out, f.name)
+		if err := os.WriteFile(path, []byte(f.data), f.mode); err != nil {
+			fail(KindFailure, "Error writing %s: %v", path, err)
+		}
+	}
+	fmt.Fprintf(os.Stderr, "Wrote %s; compile and check with %s\n", out, filepath.Join(out, "run.sh"))
+}
+
+// runExportPlugin runs an exporter plugin, keygen-export-<name> on PATH, in a
+// sandbox. It reads this command's stdin and its output is passed through.
+func runExportPlugin(limits sandbox.Limits, name string, args []string) {
+	path, err := exec.LookPath(pluginPrefix + name)
+	if err != nil {
+		fail(KindInput, "Error: no exporter plugin %q (%s%s on PATH)", name, pluginPrefix, name)
+	}
+	res, err := sandbox.Run(context.Background(), limits, append([]string{path}, args...), os.Stdin)
+	if err != nil {
+		fail(KindFailure, "Error: %v", err)
+	}
+	os.Stderr.Write(res.Stderr)
+	if res.ExitCode != 0 {
+		fail(KindFailure, "Error: plugin %s exited with status %d", name, res.ExitCode)
+	}
+	os.Stdout.Write(res.Stdout)
+}
+
+// pluginHiddenPaths lists what plugins must not read: the home directory,
+// where keystores and share files usually live, the context's keystore and
+// the config file's directory, plus any paths given.
+func pluginHiddenPaths(ws *workspace.Context, extra string) []string {
+	var paths []string
+	if home, err := os.UserHomeDir(); err == nil {
+		paths = append(paths, home)
+	}
+	if ws.Keystore != "" {
+		paths = append(paths, ws.Keystore)
+	}
+	if cfg, err := workspace.Path(); err == nil {
+		paths = append(paths, filepath.Dir(cfg))
+	}
+	for _, p := range strings.Split(extra, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			paths = append(paths, p)
+		}
+	}
+	return paths
+}
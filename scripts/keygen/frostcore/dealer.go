@@ -0,0 +1,96 @@
+package frostcore
+
+import (
+	"fmt"
+	"io"
+	"math/big"
+)
+
+// Split performs a trusted-dealer Shamir split of secret into n shares with
+// threshold t: share i is f(i) for a random polynomial f of degree t-1 with
+// f(0) = secret. Any t shares sign for the public key secret*G.
+func Split(secret *big.Int, t, n int, random io.Reader) ([]*big.Int, error) {
+	_, shares, err := SplitPolynomial(secret, t, n, random)
+	return shares, err
+}
+
+// SplitPolynomial is Split, also returning the polynomial's coefficients,
+// constant term first, as test vectors list them.
+func SplitPolynomial(secret *big.Int, t, n int, random io.Reader) (coeffs, shares []*big.Int, err error) {
+	if t < 1 || t > n {
+		return nil, nil, fmt.Errorf("invalid threshold %d of %d", t, n)
+	}
+	if n > 0xFFFF {
+		return nil, nil, fmt.Errorf("%d participants exceed the 16-bit identifier range", n)
+	}
+	if s := new(big.Int).Mod(secret, Order); s.Sign() == 0 {
+		return nil, nil, fmt.Errorf("secret is zero mod the group order")
+	}
+
+	if coeffs, err = randomPolynomial(secret, t, random); err != nil {
+		return nil, nil, err
+	}
+	shares = make([]*big.Int, n)
+	for i := range shares {
+		shares[i] = evalPolynomial(coeffs, uint16(i+1))
+	}
+	return coeffs, shares, nil
+}
+
+// randomPolynomial returns the coefficients of a random polynomial of degree
+// t-1 with constant term c0.
+func randomPolynomial(c0 *big.Int, t int, random io.Reader) ([]*big.Int, error) {
+	coeffs := make([]*big.Int, t)
+	coeffs[0] = new(big.Int).Mod(c0, Order)
+	for k := 1; k < t; k++ {
+		c, err := RandomScalar(random)
+		if err != nil {
+			return nil, err
+		}
+		coeffs[k] = c
+	}
+	return coeffs, nil
+}
+
+// evalPolynomial evaluates the polynomial at x by Horner's rule.
+func evalPolynomial(coeffs []*big.Int, x uint16) *big.Int {
+	bx := big.NewInt(int64(x))
+	y := new(big.Int)
+	for k := len(coeffs) - 1; k >= 0; k-- {
+		y.Mul(y, bx)
+		y.Add(y, coeffs[k])
+		y.Mod(y, Order)
+	}
+	return y
+}
+
+// Interpolate recovers f(0) from shares keyed by participant ID.
+func Interpolate(shares map[uint16]*big.Int) (*big.Int, error) {
+	ids := make([]uint16, 0, len(shares))
+	for id := range shares {
+		ids = append(ids, id)
+	}
+	secret := new(big.Int)
+	for _, id := range ids {
+		lambda, err := Lagrange(id, ids)
+		if err != nil {
+			return nil, err
+		}
+		secret.Add(secret, new(big.Int).Mul(lambda, shares[id]))
+	}
+	return secret.Mod(secret, Order), nil
+}
+
+// RandomScalar returns a uniformly random non-zero scalar, reducing 64 bytes
+// so the modulo bias is negligible.
+func RandomScalar(random io.Reader) (*big.Int, error) {
+	var buf [64]byte
+	for {
+		if _, err := io.ReadFull(random, buf[:]); err != nil {
+			return nil, fmt.Errorf("random scalar: %w", err)
+		}
+		if s := new(big.Int).Mod(new(big.Int).SetBytes(buf[:]), Order); s.Sign() != 0 {
+			return s, nil
+		}
+	}
+}
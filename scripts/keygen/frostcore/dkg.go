@@ -0,0 +1,160 @@
+package frostcore
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+)
+
+// Distributed key generation (Pedersen's DKG with proofs of knowledge, the
+// FROST paper's KeyGen): no one ever holds the group secret. Each
+// participant i deals a random polynomial f_i of degree t-1, broadcasting
+// Feldman commitments C_ik = a_ik*G and a proof of knowledge of a_i0, and
+// sends f_i(j) privately to each participant j. Participant j's share is
+// sum_i f_i(j), the group key sum_i C_i0, and participant j's public share
+// sum_i f_i(j)*G, which anyone can compute from the commitments.
+//
+// The proof stops a participant from choosing its C_i0 as a function of the
+// others' (a rogue key that would cancel theirs). Its context binds it to
+// one run of the protocol, so it cannot be replayed into another.
+
+// DKGProofSize is the encoded size of a DKGProof: R || z.
+const DKGProofSize = PointSize + ScalarSize
+
+// DKGProof is a Schnorr proof of knowledge of a_i0 for C_i0 = a_i0*G, with
+// c = H("dkg" || context || id || C_i0 || R) and z = k + c*a_i0.
+type DKGProof struct {
+	R []byte
+	Z *big.Int
+}
+
+// DKGDeal is one participant's contribution: its polynomial's commitments
+// and the proof to broadcast, and the sub-share for each participant (index
+// j-1 for participant j) to send privately. SubShares[id-1] is kept.
+type DKGDeal struct {
+	Commitments [][]byte
+	Proof       *DKGProof
+	SubShares   []*big.Int
+}
+
+func dkgChallenge(context []byte, id uint16, c0, r []byte) *big.Int {
+	return hashToScalar("dkg", context, IDBytes(id), c0, r)
+}
+
+// DealDKG computes participant id's contribution to a t-of-n DKG run under
+// context.
+func DealDKG(id uint16, t, n int, context []byte, random io.Reader) (*DKGDeal, error) {
+	if t < 1 || t > n {
+		return nil, fmt.Errorf("invalid threshold %d of %d", t, n)
+	}
+	if n > 0xFFFF {
+		return nil, fmt.Errorf("%d participants exceed the 16-bit identifier range", n)
+	}
+	if id < 1 || int(id) > n {
+		return nil, fmt.Errorf("participant %d is not in 1..%d", id, n)
+	}
+	a0, err := RandomScalar(random)
+	if err != nil {
+		return nil, err
+	}
+	coeffs, err := randomPolynomial(a0, t, random)
+	if err != nil {
+		return nil, err
+	}
+	k, err := RandomScalar(random)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &DKGDeal{
+		Commitments: make([][]byte, t),
+		Proof:       &DKGProof{R: BasePoint(k)},
+		SubShares:   make([]*big.Int, n),
+	}
+	for i, a := range coeffs {
+		d.Commitments[i] = BasePoint(a)
+	}
+	c := dkgChallenge(context, id, d.Commitments[0], d.Proof.R)
+	d.Proof.Z = new(big.Int).Mul(c, coeffs[0])
+	d.Proof.Z.Add(d.Proof.Z, k).Mod(d.Proof.Z, Order)
+	for j := range d.SubShares {
+		d.SubShares[j] = evalPolynomial(coeffs, uint16(j+1))
+	}
+	return d, nil
+}
+
+// Bytes encodes the proof as R || z.
+func (p *DKGProof) Bytes() []byte {
+	return append(bytes.Clone(p.R), ScalarBytes(p.Z)...)
+}
+
+// ParseDKGProof decodes an encoded DKGProof.
+func ParseDKGProof(b []byte) (*DKGProof, error) {
+	if len(b) != DKGProofSize {
+		return nil, fmt.Errorf("dkg proof: expected %d bytes, got %d", DKGProofSize, len(b))
+	}
+	p := &DKGProof{R: b[:PointSize], Z: ScalarFromBytes(b[PointSize:])}
+	if p.Z.Cmp(Order) >= 0 {
+		return nil, errors.New("dkg proof: response is not reduced")
+	}
+	return p, nil
+}
+
+// VerifyDKGCommitments checks participant id's broadcast for a t-of-n run
+// under context: t commitments, and z*G == R + c*C_0.
+func VerifyDKGCommitments(id uint16, t int, commitments [][]byte, p *DKGProof, context []byte) error {
+	if len(commitments) != t {
+		return fmt.Errorf("participant %d: expected %d commitments, got %d", id, t, len(commitments))
+	}
+	c0, err := DecodePoint(commitments[0])
+	if err != nil {
+		return fmt.Errorf("participant %d: commitment 0: %w", id, err)
+	}
+	r, err := DecodePoint(p.R)
+	if err != nil {
+		return fmt.Errorf("participant %d: proof commitment: %w", id, err)
+	}
+	c := dkgChallenge(context, id, commitments[0], p.R)
+	want := Curve.NewPoint().Add(r, scalarMult(c, c0))
+	if !bytes.Equal(BasePoint(p.Z), want.Bytes()) {
+		return fmt.Errorf("participant %d: proof of knowledge does not verify", id)
+	}
+	return nil
+}
+
+// DKGResult is what every participant computes from all the broadcasts:
+// the group key and each participant's public share (index j-1).
+type DKGResult struct {
+	GroupKey     []byte
+	PublicShares [][]byte
+}
+
+// FinishDKG computes the group key and public shares from the commitments
+// of participants 1..n (index i-1 for participant i), already checked with
+// VerifyDKGCommitments.
+func FinishDKG(commitments [][][]byte) (*DKGResult, error) {
+	n := len(commitments)
+	r := &DKGResult{PublicShares: make([][]byte, n)}
+	c0 := make([][]byte, n)
+	for i, c := range commitments {
+		c0[i] = c[0]
+	}
+	var err error
+	if r.GroupKey, err = AddPoints(c0...); err != nil {
+		return nil, err
+	}
+	for j := range r.PublicShares {
+		parts := make([][]byte, n)
+		for i, c := range commitments {
+			if parts[i], err = EvalCommitments(c, uint16(j+1)); err != nil {
+				return nil, fmt.Errorf("participant %d: %w", i+1, err)
+			}
+		}
+		if r.PublicShares[j], err = AddPoints(parts...); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
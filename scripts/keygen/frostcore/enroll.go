@@ -0,0 +1,68 @@
+package frostcore
+
+import (
+	"fmt"
+	"io"
+	"math/big"
+)
+
+// Enrollment gives a new participant x a share f(x) of the existing
+// polynomial, so the group key and every other share stay unchanged
+// (the repairable threshold scheme of Laing and Stinson). Each helper i in a
+// set S of at least t participants computes delta_i = lambda_i(S; x) * s_i
+// and splits it into random additive pieces, one per helper. Each helper
+// sends the sum sigma_j of the pieces it received to the new participant,
+// whose share is sum_j sigma_j = sum_i delta_i = f(x). A helper's pieces
+// add up to delta_i, from which s_i follows, so each piece must reach only
+// its helper and each sum only the new participant. Kept apart, the pieces a
+// helper receives are uniformly random and the sums reveal only f(x).
+
+// EnrollSplit returns helper id's pieces of delta_i, one per helper in the
+// order of helpers.
+func EnrollSplit(id uint16, s *big.Int, helpers []uint16, x uint16, random io.Reader) ([]*big.Int, error) {
+	for _, h := range helpers {
+		if h == x {
+			return nil, fmt.Errorf("participant %d is already a helper", x)
+		}
+	}
+	lambda, err := LagrangeAt(id, helpers, x)
+	if err != nil {
+		return nil, err
+	}
+	delta := new(big.Int).Mul(lambda, s)
+	delta.Mod(delta, Order)
+
+	pieces := make([]*big.Int, len(helpers))
+	last := delta
+	for k := range helpers[1:] {
+		p, err := RandomScalar(random)
+		if err != nil {
+			return nil, err
+		}
+		pieces[k] = p
+		last = new(big.Int).Sub(last, p)
+	}
+	pieces[len(helpers)-1] = last.Mod(last, Order)
+	return pieces, nil
+}
+
+// EnrollPublicShare computes the new participant's public share
+// Y_x = sum_i lambda_i(S; x) * Y_i from the helpers' public shares.
+func EnrollPublicShare(helpers []uint16, publicShares [][]byte, x uint16) ([]byte, error) {
+	if len(helpers) != len(publicShares) {
+		return nil, fmt.Errorf("%d helpers, %d public shares", len(helpers), len(publicShares))
+	}
+	terms := make([][]byte, len(helpers))
+	for i, id := range helpers {
+		lambda, err := LagrangeAt(id, helpers, x)
+		if err != nil {
+			return nil, err
+		}
+		y, err := DecodePoint(publicShares[i])
+		if err != nil {
+			return nil, fmt.Errorf("public share %d: %w", id, err)
+		}
+		terms[i] = scalarMult(lambda, y).Bytes()
+	}
+	return AddPoints(terms...)
+}
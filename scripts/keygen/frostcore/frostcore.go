@@ -0,0 +1,487 @@
+// Package frostcore mirrors the FROST computations performed by the Ledger
+// app (src/frost.c) on the host: fy-compatible Blake2b hashing, binding
+// factors, group commitment, challenge, Lagrange coefficients and partial
+// signatures, exposed step by step so intermediates can be inspected. The
+// group and hashes are those of Suite, Baby Jubjub with Blake2b unless Use
+// picks another ciphersuite.
+//
+// Scalars are 32-byte big-endian, points are 32-byte compressed (for Baby
+// Jubjub, the gnark-crypto encoding), and identifiers are 32-byte scalars
+// with the participant number in the last two bytes, exactly as sent to the
+// device.
+package frostcore
+
+import (
+	"bytes"
+	"cmp"
+	"errors"
+	"fmt"
+	"math/big"
+	"slices"
+
+	"github.com/f3rmion/fy/group"
+
+	"keygen/ciphersuite"
+)
+
+// Sizes of the device protocol's encodings
+const (
+	ScalarSize          = 32
+	PointSize           = 32
+	CommitmentEntrySize = 32 + 2*PointSize // id || hiding || binding
+)
+
+// Suite is the ciphersuite in use, by default ciphersuite.Default.
+var Suite = ciphersuite.Default
+
+// Order is the order of the suite's prime subgroup.
+var Order = Suite.Order()
+
+// Curve is the suite's group, used for all point arithmetic.
+var Curve = Suite.Group()
+
+// Use switches to the ciphersuite cs. It must be called before anything
+// else in the package is, as --ciphersuite does.
+func Use(cs ciphersuite.Ciphersuite) error {
+	if cs.ScalarSize() != ScalarSize || cs.PointSize() != PointSize {
+		return fmt.Errorf("ciphersuite %s has %d-byte scalars and %d-byte points; the device protocol takes %d-byte ones",
+			cs.Name(), cs.ScalarSize(), cs.PointSize(), ScalarSize)
+	}
+	Suite, Order, Curve = cs, cs.Order(), cs.Group()
+	return nil
+}
+
+// ============================================================================
+// Encodings
+// ============================================================================
+
+// ScalarBytes encodes x mod Order as 32 big-endian bytes.
+func ScalarBytes(x *big.Int) []byte {
+	out := make([]byte, ScalarSize)
+	new(big.Int).Mod(x, Order).FillBytes(out)
+	return out
+}
+
+// ScalarFromBytes interprets b as a big-endian integer (no reduction).
+func ScalarFromBytes(b []byte) *big.Int {
+	return new(big.Int).SetBytes(b)
+}
+
+// IDBytes encodes a participant number as a 32-byte identifier: the
+// number as a scalar.
+func IDBytes(id uint16) []byte {
+	return ScalarBytes(big.NewInt(int64(id)))
+}
+
+// IDFromBytes extracts the participant number the way the device does:
+// from the last two bytes of the identifier.
+func IDFromBytes(b []byte) uint16 {
+	if len(b) < 2 {
+		return 0
+	}
+	return uint16(b[len(b)-2])<<8 | uint16(b[len(b)-1])
+}
+
+// DecodePoint parses a compressed point.
+func DecodePoint(b []byte) (group.Point, error) {
+	if len(b) != PointSize {
+		return nil, fmt.Errorf("point: expected %d bytes, got %d", PointSize, len(b))
+	}
+	opCounts.decompressions.Add(1)
+	p := Curve.NewPoint()
+	if _, err := p.SetBytes(b); err != nil {
+		return nil, fmt.Errorf("point: %w", err)
+	}
+	return p, nil
+}
+
+// Scalar converts x mod Order to a group scalar.
+func Scalar(x *big.Int) group.Scalar {
+	s := Curve.NewScalar()
+	s.SetBytes(ScalarBytes(x))
+	return s
+}
+
+// ============================================================================
+// Hash Functions (fy Blake2bHasher compatible with the default suite)
+// ============================================================================
+
+// hashToScalar hashes the suite's ID || tag || parts... to a scalar; with
+// the default suite, Blake2b-512 read as little-endian and reduced mod Order
+// (h2c.Blake2bScalar).
+func hashToScalar(tag string, parts ...[]byte) *big.Int {
+	opCounts.hashes.Add(1)
+	return Suite.HashToScalar(tag, parts...)
+}
+
+// BindingFactor is H1: Blake2b(prefix || "rho" || msg || encCommitList || signerID).
+func BindingFactor(msg, encCommitList, signerID []byte) *big.Int {
+	return hashToScalar("rho", msg, encCommitList, signerID)
+}
+
+// Challenge is H2: Blake2b(prefix || "chal" || R || Y || msg).
+func Challenge(groupCommitment, groupKey, msg []byte) *big.Int {
+	return hashToScalar("chal", groupCommitment, groupKey, msg)
+}
+
+// NonceSeedSize is the number of fresh random bytes NonceGenerate mixes in.
+const NonceSeedSize = 32
+
+// NonceGenerate is H3, nonce_generate of RFC 9591:
+// Blake2b(prefix || "nonce" || random || secret || context), where random
+// is NonceSeedSize fresh random bytes and secret the signer's share. The
+// nonce stays unpredictable with a weak RNG as long as the share is secret.
+// context, which may be nil, binds the nonce to a session.
+func NonceGenerate(random []byte, secret *big.Int, context []byte) *big.Int {
+	return hashToScalar("nonce", random, ScalarBytes(secret), context)
+}
+
+// ============================================================================
+// Commitment List
+// ============================================================================
+
+// Commitment is one participant's entry in the signing commitment list.
+type Commitment struct {
+	ID      []byte // 32-byte identifier
+	Hiding  []byte // 32-byte compressed point
+	Binding []byte // 32-byte compressed point
+}
+
+// Identifier returns the participant number.
+func (c *Commitment) Identifier() uint16 {
+	return IDFromBytes(c.ID)
+}
+
+// decode decodes the commitment's points without further checks.
+func (c *Commitment) decode() (hiding, binding group.Point, err error) {
+	hiding, err = DecodePoint(c.Hiding)
+	if err != nil {
+		return nil, nil, fmt.Errorf("participant %d hiding commitment: %w", c.Identifier(), err)
+	}
+	binding, err = DecodePoint(c.Binding)
+	if err != nil {
+		return nil, nil, fmt.Errorf("participant %d binding commitment: %w", c.Identifier(), err)
+	}
+	return hiding, binding, nil
+}
+
+// points decodes the commitment with CheckPoint, naming the participant in
+// any error.
+func (c *Commitment) points() (hiding, binding group.Point, err error) {
+	hiding, err = CheckPoint(fmt.Sprintf("participant %d hiding commitment", c.Identifier()), c.Hiding)
+	if err != nil {
+		return nil, nil, err
+	}
+	binding, err = CheckPoint(fmt.Sprintf("participant %d binding commitment", c.Identifier()), c.Binding)
+	if err != nil {
+		return nil, nil, err
+	}
+	return hiding, binding, nil
+}
+
+// EncodeCommitments serializes the list as id || hiding || binding per entry,
+// in the given order. This is both the INJECT_COMMITMENTS payload and the
+// encCommitList input to H1.
+func EncodeCommitments(list []Commitment) []byte {
+	out := make([]byte, 0, len(list)*CommitmentEntrySize)
+	for _, c := range list {
+		out = append(out, c.ID...)
+		out = append(out, c.Hiding...)
+		out = append(out, c.Binding...)
+	}
+	return out
+}
+
+// ParseCommitments splits an encoded commitment list.
+func ParseCommitments(b []byte) ([]Commitment, error) {
+	if len(b)%CommitmentEntrySize != 0 {
+		return nil, fmt.Errorf("commitment list: length %d is not a multiple of %d", len(b), CommitmentEntrySize)
+	}
+	list := make([]Commitment, len(b)/CommitmentEntrySize)
+	for i := range list {
+		entry := b[i*CommitmentEntrySize : (i+1)*CommitmentEntrySize]
+		list[i] = Commitment{
+			ID:      entry[0:32],
+			Hiding:  entry[32:64],
+			Binding: entry[64:96],
+		}
+	}
+	return list, nil
+}
+
+// SortCommitments returns the list in canonical order, by ascending
+// participant number, and rejects duplicate or zero identifiers. The binding
+// factors hash the encoded list, so host and device only agree on them if
+// both use the same order; every host path uses this one.
+func SortCommitments(list []Commitment) ([]Commitment, error) {
+	sorted := slices.Clone(list)
+	slices.SortStableFunc(sorted, func(a, b Commitment) int {
+		return cmp.Compare(a.Identifier(), b.Identifier())
+	})
+	for i := range sorted {
+		if sorted[i].Identifier() == 0 {
+			return nil, errors.New("commitment list: participant identifier 0")
+		}
+		if i > 0 && sorted[i].Identifier() == sorted[i-1].Identifier() {
+			return nil, fmt.Errorf("commitment list: duplicate participant %d", sorted[i].Identifier())
+		}
+	}
+	return sorted, nil
+}
+
+// IsCanonical reports whether the list is already in canonical order with no
+// duplicates, e.g. to check a captured INJECT_COMMITMENTS payload.
+func IsCanonical(list []Commitment) bool {
+	for i := 1; i < len(list); i++ {
+		if list[i].Identifier() <= list[i-1].Identifier() {
+			return false
+		}
+	}
+	return len(list) == 0 || list[0].Identifier() != 0
+}
+
+// CanonicalCommitments is the canonical serialization of the list: sorted
+// with SortCommitments, then encoded with EncodeCommitments. It is the
+// INJECT_COMMITMENTS payload to send to the device.
+func CanonicalCommitments(list []Commitment) ([]byte, error) {
+	sorted, err := SortCommitments(list)
+	if err != nil {
+		return nil, err
+	}
+	return EncodeCommitments(sorted), nil
+}
+
+// ============================================================================
+// Signing Computations
+// ============================================================================
+
+// BindingFactors computes rho_i for every entry of the list.
+func BindingFactors(msg []byte, list []Commitment) []*big.Int {
+	enc := EncodeCommitments(list)
+	rhos := make([]*big.Int, len(list))
+	for i, c := range list {
+		rhos[i] = BindingFactor(msg, enc, c.ID)
+	}
+	return rhos
+}
+
+// GroupCommitment computes R = sum(D_i + rho_i * E_i). Every commitment must
+// pass CheckPoint: Baby Jubjub has cofactor 8, and a low-order or identity
+// commitment from a malicious co-signer would otherwise be folded into R.
+func GroupCommitment(list []Commitment, rhos []*big.Int) ([]byte, error) {
+	return groupCommitment(list, rhos, (*Commitment).points)
+}
+
+// DeviceGroupCommitment computes R as the app does: commitments are decoded
+// but not checked for small order or the identity. Only the device
+// simulator should use it.
+func DeviceGroupCommitment(list []Commitment, rhos []*big.Int) ([]byte, error) {
+	return groupCommitment(list, rhos, (*Commitment).decode)
+}
+
+func groupCommitment(list []Commitment, rhos []*big.Int, points func(*Commitment) (group.Point, group.Point, error)) ([]byte, error) {
+	if len(list) == 0 || len(list) != len(rhos) {
+		return nil, errors.New("group commitment: empty or mismatched inputs")
+	}
+	var sum group.Point
+	for i := range list {
+		hiding, binding, err := points(&list[i])
+		if err != nil {
+			return nil, err
+		}
+		term := scalarMult(rhos[i], binding)
+		term = Curve.NewPoint().Add(hiding, term)
+		if sum == nil {
+			sum = term
+		} else {
+			sum = Curve.NewPoint().Add(sum, term)
+		}
+	}
+	return sum.Bytes(), nil
+}
+
+// Lagrange computes lambda_i = prod_{j != i} x_j / (x_j - x_i) mod Order.
+func Lagrange(id uint16, ids []uint16) (*big.Int, error) {
+	return LagrangeAt(id, ids, 0)
+}
+
+// LagrangeAt computes the coefficient of share i when interpolating at x:
+// prod_{j != i} (x_j - x) / (x_j - x_i) mod Order.
+func LagrangeAt(id uint16, ids []uint16, x uint16) (*big.Int, error) {
+	lambda := big.NewInt(1)
+	xi := big.NewInt(int64(id))
+	bx := big.NewInt(int64(x))
+	for _, j := range ids {
+		if j == id {
+			continue
+		}
+		xj := big.NewInt(int64(j))
+		den := new(big.Int).Sub(xj, xi)
+		den.Mod(den, Order)
+		if den.ModInverse(den, Order) == nil {
+			return nil, fmt.Errorf("lagrange: identifier %d collides with %d", j, id)
+		}
+		lambda.Mul(lambda, new(big.Int).Sub(xj, bx))
+		lambda.Mul(lambda, den)
+		lambda.Mod(lambda, Order)
+	}
+	return lambda, nil
+}
+
+// PartialSig computes z_i = d + e*rho + lambda*s*c mod Order.
+func PartialSig(hidingNonce, bindingNonce, rho, secret, challenge, lambda *big.Int) *big.Int {
+	z := new(big.Int).Mul(bindingNonce, rho)
+	z.Add(z, hidingNonce)
+	t := new(big.Int).Mul(secret, challenge)
+	t.Mul(t, lambda)
+	z.Add(z, t)
+	return z.Mod(z, Order)
+}
+
+// BasePoint computes x*G as a compressed point.
+func BasePoint(x *big.Int) []byte {
+	return scalarMult(x, Curve.Generator()).Bytes()
+}
+
+// Verify checks a Schnorr signature (R, z) under the group key:
+// z*G == R + c*Y with c = H2(R, Y, msg).
+func Verify(groupKey, msg, r, z []byte) (bool, error) {
+	v := Explain(groupKey, msg, r, z)
+	if v.malformed() {
+		return false, v.Err()
+	}
+	return v.Valid, nil
+}
+
+// Trace holds the intermediates of a signing session, for comparing the
+// host's computation with the device's step by step.
+type Trace struct {
+	CommitmentList  []byte       // Encoded list the binding factors hash
+	GroupCommitment []byte       // R
+	Challenge       *big.Int     // c
+	Participants    []TraceEntry // In list order
+}
+
+// TraceEntry is one participant's part of a Trace.
+type TraceEntry struct {
+	ID            uint16
+	BindingFactor *big.Int // rho_i
+	Lambda        *big.Int // lambda_i
+	Commitment    []byte   // D_i + rho_i*E_i, its term of R
+}
+
+// NewTrace computes the Trace of signing msg over list, in the order given.
+// A nil challenge is computed from R, as PARTIAL_SIGN does without
+// INJECT_CHALLENGE.
+func NewTrace(msg, groupKey []byte, list []Commitment, challenge *big.Int) (*Trace, error) {
+	rhos := BindingFactors(msg, list)
+	r, err := GroupCommitment(list, rhos)
+	if err != nil {
+		return nil, err
+	}
+	if challenge == nil {
+		challenge = Challenge(r, groupKey, msg)
+	}
+	ids := make([]uint16, len(list))
+	for i := range list {
+		ids[i] = list[i].Identifier()
+	}
+
+	t := &Trace{CommitmentList: EncodeCommitments(list), GroupCommitment: r, Challenge: challenge}
+	for i := range list {
+		lambda, err := Lagrange(ids[i], ids)
+		if err != nil {
+			return nil, err
+		}
+		term, err := GroupCommitment(list[i:i+1], rhos[i:i+1])
+		if err != nil {
+			return nil, err
+		}
+		t.Participants = append(t.Participants, TraceEntry{
+			ID:            ids[i],
+			BindingFactor: rhos[i],
+			Lambda:        lambda,
+			Commitment:    term,
+		})
+	}
+	return t, nil
+}
+
+// ShareCheck holds the values computed while verifying one signature share,
+// so they can be compared against a device or host trace.
+type ShareCheck struct {
+	ID              uint16
+	BindingFactor   *big.Int // rho_i
+	Lambda          *big.Int // lambda_i
+	Challenge       *big.Int // c
+	GroupCommitment []byte   // R
+	Expected        []byte   // D_i + rho_i*E_i + lambda_i*c*Y_i
+	Actual          []byte   // z_i*G
+	Valid           bool
+}
+
+// VerifyShare checks a participant's signature share with the FROST
+// share-verification equation
+//
+//	z_i*G == D_i + rho_i*E_i + lambda_i*c*Y_i
+//
+// where Y_i is the participant's public share. challenge overrides c, as
+// INJECT_CHALLENGE does on the device; nil computes it from R.
+func VerifyShare(msg, groupKey []byte, list []Commitment, id uint16, publicShare, z []byte, challenge *big.Int) (*ShareCheck, error) {
+	if len(z) != ScalarSize {
+		return nil, fmt.Errorf("z: expected %d bytes, got %d", ScalarSize, len(z))
+	}
+	if _, err := CheckPoint("group key", groupKey); err != nil {
+		return nil, err
+	}
+	share, err := CheckPoint("public share", publicShare)
+	if err != nil {
+		return nil, err
+	}
+
+	index := -1
+	ids := make([]uint16, len(list))
+	for i := range list {
+		ids[i] = list[i].Identifier()
+		if ids[i] == id {
+			index = i
+		}
+	}
+	if index < 0 {
+		return nil, fmt.Errorf("participant %d is not in the commitment list", id)
+	}
+
+	rhos := BindingFactors(msg, list)
+	r, err := GroupCommitment(list, rhos)
+	if err != nil {
+		return nil, err
+	}
+	lambda, err := Lagrange(id, ids)
+	if err != nil {
+		return nil, err
+	}
+	if challenge == nil {
+		challenge = Challenge(r, groupKey, msg)
+	}
+
+	hiding, binding, err := list[index].points()
+	if err != nil {
+		return nil, err
+	}
+	lc := new(big.Int).Mul(lambda, challenge)
+	lc.Mod(lc, Order)
+	expected := Curve.NewPoint().Add(hiding, scalarMult(rhos[index], binding))
+	expected = Curve.NewPoint().Add(expected, scalarMult(lc, share))
+
+	check := &ShareCheck{
+		ID:              id,
+		BindingFactor:   rhos[index],
+		Lambda:          lambda,
+		Challenge:       challenge,
+		GroupCommitment: r,
+		Expected:        expected.Bytes(),
+		Actual:          BasePoint(ScalarFromBytes(z)),
+	}
+	check.Valid = bytes.Equal(check.Expected, check.Actual)
+	return check, nil
+}
@@ -0,0 +1,100 @@
+package frostcore
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+
+	"github.com/f3rmion/fy/group"
+)
+
+// InputReason classifies why an input field is not a valid encoding.
+type InputReason string
+
+const (
+	NotHex           InputReason = "not_hex"
+	WrongLength      InputReason = "wrong_length"
+	ScalarOutOfRange InputReason = "scalar_out_of_range" // Not reduced mod Order
+	NotOnCurve       InputReason = "not_on_curve"        // No curve point has this encoding
+	NotInSubgroup    InputReason = "not_in_subgroup"     // On the curve, but in a small-order coset
+	IdentityPoint    InputReason = "identity_point"      // The neutral element, never a valid key or commitment
+)
+
+// InputError reports an input field that does not decode to the value it
+// should, before any of it reaches the curve arithmetic.
+type InputError struct {
+	Field  string // e.g. participants[2].hiding_commit
+	Reason InputReason
+	Detail string
+}
+
+func (e *InputError) Error() string {
+	return fmt.Sprintf("%s: %s (%s)", e.Field, e.Detail, e.Reason)
+}
+
+func inputError(field string, reason InputReason, format string, args ...any) *InputError {
+	return &InputError{Field: field, Reason: reason, Detail: fmt.Sprintf(format, args...)}
+}
+
+// ParseBytes decodes a hex field of exactly n bytes.
+func ParseBytes(field, s string, n int) ([]byte, error) {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return nil, inputError(field, NotHex, "%v", err)
+	}
+	if len(b) != n {
+		return nil, inputError(field, WrongLength, "expected %d bytes, got %d", n, len(b))
+	}
+	return b, nil
+}
+
+// CheckScalar checks that b is a 32-byte scalar reduced mod Order.
+func CheckScalar(field string, b []byte) (*big.Int, error) {
+	if len(b) != ScalarSize {
+		return nil, inputError(field, WrongLength, "expected %d bytes, got %d", ScalarSize, len(b))
+	}
+	x := ScalarFromBytes(b)
+	if x.Cmp(Order) >= 0 {
+		return nil, inputError(field, ScalarOutOfRange, "scalar is not reduced mod the subgroup order")
+	}
+	return x, nil
+}
+
+// ParseScalar decodes a hex scalar field and checks it with CheckScalar.
+func ParseScalar(field, s string) (*big.Int, error) {
+	b, err := ParseBytes(field, s, ScalarSize)
+	if err != nil {
+		return nil, err
+	}
+	return CheckScalar(field, b)
+}
+
+// CheckPoint decodes a compressed point and checks that it is on the curve,
+// in the prime-order subgroup and not the identity.
+func CheckPoint(field string, b []byte) (group.Point, error) {
+	if len(b) != PointSize {
+		return nil, inputError(field, WrongLength, "expected %d bytes, got %d", PointSize, len(b))
+	}
+	opCounts.decompressions.Add(1)
+	p := Curve.NewPoint()
+	if _, err := p.SetBytes(b); err != nil {
+		return nil, inputError(field, NotOnCurve, "%v", err)
+	}
+	if bytes.Equal(b, BasePoint(new(big.Int))) {
+		return nil, inputError(field, IdentityPoint, "point is the identity")
+	}
+	if !InSubgroup(p) {
+		return nil, inputError(field, NotInSubgroup, "point is not in the prime-order subgroup")
+	}
+	return p, nil
+}
+
+// ParsePoint decodes a hex point field and checks it with CheckPoint.
+func ParsePoint(field, s string) (group.Point, error) {
+	b, err := ParseBytes(field, s, PointSize)
+	if err != nil {
+		return nil, err
+	}
+	return CheckPoint(field, b)
+}
@@ -0,0 +1,64 @@
+package frostcore
+
+import (
+	"log/slog"
+	"math/big"
+	"sync/atomic"
+
+	"github.com/f3rmion/fy/group"
+)
+
+// Ops counts the expensive operations this package performed: scalar
+// multiplications, point decompressions and hash invocations (Blake2b
+// hashes to scalars and Poseidon challenges). The counters are process-wide;
+// callers measure a ceremony or session by the difference of two ReadOps:
+//
+//	before := frostcore.ReadOps()
+//	…
+//	ops := frostcore.ReadOps().Sub(before)
+//
+// Only operations of this package are counted, not those inside the fy
+// library that keygen, sign and aggregate call directly.
+type Ops struct {
+	ScalarMults    uint64 `json:"scalar_mults"`
+	Decompressions uint64 `json:"point_decompressions"`
+	Hashes         uint64 `json:"hashes"`
+}
+
+var opCounts struct {
+	scalarMults, decompressions, hashes atomic.Uint64
+}
+
+// ReadOps returns the operations counted so far in this process.
+func ReadOps() Ops {
+	return Ops{
+		ScalarMults:    opCounts.scalarMults.Load(),
+		Decompressions: opCounts.decompressions.Load(),
+		Hashes:         opCounts.hashes.Load(),
+	}
+}
+
+// Add returns o + p.
+func (o Ops) Add(p Ops) Ops {
+	return Ops{o.ScalarMults + p.ScalarMults, o.Decompressions + p.Decompressions, o.Hashes + p.Hashes}
+}
+
+// Sub returns o - p, the operations between an earlier reading p and o.
+func (o Ops) Sub(p Ops) Ops {
+	return Ops{o.ScalarMults - p.ScalarMults, o.Decompressions - p.Decompressions, o.Hashes - p.Hashes}
+}
+
+// LogValue logs the counts as a group.
+func (o Ops) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.Uint64("scalar_mults", o.ScalarMults),
+		slog.Uint64("point_decompressions", o.Decompressions),
+		slog.Uint64("hashes", o.Hashes),
+	)
+}
+
+// scalarMult computes x*p, counted.
+func scalarMult(x *big.Int, p group.Point) group.Point {
+	opCounts.scalarMults.Add(1)
+	return Curve.NewPoint().ScalarMult(Scalar(x), p)
+}
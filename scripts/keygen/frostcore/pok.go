@@ -0,0 +1,115 @@
+package frostcore
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+
+	"keygen/h2c"
+)
+
+// NonceProofSize is the encoded size of a NonceProof:
+// R_D || R_E || z_D || z_E.
+const NonceProofSize = 2*PointSize + 2*ScalarSize
+
+// NonceProof is a Schnorr proof of knowledge of the discrete logs d and e of
+// a signing commitment (D, E) = (d*G, e*G). A participant that cannot produce
+// one chose its commitment as a function of other participants' commitments
+// (a rogue commitment) rather than from nonces it knows.
+//
+// Both proofs share one challenge
+// c = H("pok" || context || id || D || E || R_D || R_E), with z_D = k_D + c*d
+// and z_E = k_E + c*e. The context binds the proof to one session, so a
+// proof cannot be replayed by another participant or into another session.
+type NonceProof struct {
+	HidingR  []byte   // R_D = k_D*G
+	BindingR []byte   // R_E = k_E*G
+	HidingZ  *big.Int // z_D
+	BindingZ *big.Int // z_E
+}
+
+// NonceProofContext is the context of a proof for a coordinator session:
+// the session ID and the message being signed, joined with h2c.Context.
+func NonceProofContext(sessionID string, msg []byte) []byte {
+	return h2c.Context([]byte(sessionID), msg)
+}
+
+func nonceProofChallenge(context []byte, id uint16, hidingCommit, bindingCommit, hidingR, bindingR []byte) *big.Int {
+	return hashToScalar("pok", context, IDBytes(id), hidingCommit, bindingCommit, hidingR, bindingR)
+}
+
+// ProveNonces proves knowledge of participant id's hiding and binding nonces
+// under context.
+func ProveNonces(id uint16, hidingNonce, bindingNonce *big.Int, context []byte, random io.Reader) (*NonceProof, error) {
+	kd, err := RandomScalar(random)
+	if err != nil {
+		return nil, err
+	}
+	ke, err := RandomScalar(random)
+	if err != nil {
+		return nil, err
+	}
+	p := &NonceProof{HidingR: BasePoint(kd), BindingR: BasePoint(ke)}
+	c := nonceProofChallenge(context, id, BasePoint(hidingNonce), BasePoint(bindingNonce), p.HidingR, p.BindingR)
+	p.HidingZ = new(big.Int).Mul(c, hidingNonce)
+	p.HidingZ.Add(p.HidingZ, kd).Mod(p.HidingZ, Order)
+	p.BindingZ = new(big.Int).Mul(c, bindingNonce)
+	p.BindingZ.Add(p.BindingZ, ke).Mod(p.BindingZ, Order)
+	return p, nil
+}
+
+// Bytes encodes the proof as R_D || R_E || z_D || z_E.
+func (p *NonceProof) Bytes() []byte {
+	out := make([]byte, 0, NonceProofSize)
+	out = append(out, p.HidingR...)
+	out = append(out, p.BindingR...)
+	out = append(out, ScalarBytes(p.HidingZ)...)
+	return append(out, ScalarBytes(p.BindingZ)...)
+}
+
+// ParseNonceProof decodes an encoded NonceProof.
+func ParseNonceProof(b []byte) (*NonceProof, error) {
+	if len(b) != NonceProofSize {
+		return nil, fmt.Errorf("nonce proof: expected %d bytes, got %d", NonceProofSize, len(b))
+	}
+	p := &NonceProof{
+		HidingR:  b[:PointSize],
+		BindingR: b[PointSize : 2*PointSize],
+		HidingZ:  ScalarFromBytes(b[2*PointSize : 2*PointSize+ScalarSize]),
+		BindingZ: ScalarFromBytes(b[2*PointSize+ScalarSize:]),
+	}
+	if p.HidingZ.Cmp(Order) >= 0 || p.BindingZ.Cmp(Order) >= 0 {
+		return nil, errors.New("nonce proof: response is not reduced")
+	}
+	return p, nil
+}
+
+// VerifyNonces checks a proof for participant id's commitment (D, E) under
+// context: z_D*G == R_D + c*D and z_E*G == R_E + c*E.
+func (p *NonceProof) VerifyNonces(id uint16, hidingCommit, bindingCommit, context []byte) error {
+	c := nonceProofChallenge(context, id, hidingCommit, bindingCommit, p.HidingR, p.BindingR)
+	for _, leg := range []struct {
+		name      string
+		commit, r []byte
+		z         *big.Int
+	}{
+		{"hiding", hidingCommit, p.HidingR, p.HidingZ},
+		{"binding", bindingCommit, p.BindingR, p.BindingZ},
+	} {
+		x, err := DecodePoint(leg.commit)
+		if err != nil {
+			return fmt.Errorf("%s commitment: %w", leg.name, err)
+		}
+		r, err := DecodePoint(leg.r)
+		if err != nil {
+			return fmt.Errorf("%s proof commitment: %w", leg.name, err)
+		}
+		want := Curve.NewPoint().Add(r, scalarMult(c, x))
+		if !bytes.Equal(BasePoint(leg.z), want.Bytes()) {
+			return fmt.Errorf("%s nonce: z*G != R + c*X", leg.name)
+		}
+	}
+	return nil
+}
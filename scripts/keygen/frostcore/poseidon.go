@@ -0,0 +1,140 @@
+package frostcore
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/iden3/go-iden3-crypto/poseidon"
+
+	"keygen/h2c"
+)
+
+// ============================================================================
+// Railgun / circomlib Poseidon challenge
+// ============================================================================
+//
+// Railgun verifies signatures with circomlib's EdDSAPoseidonVerifier, which
+// checks S*B8 == R8 + 8*hm*A with hm = Poseidon(R8x, R8y, Ax, Ay, M). With
+// the group key Y = 8*A this is the FROST equation z*G == R + c*Y for the
+// challenge c = hm, which the host injects with INJECT_CHALLENGE.
+
+// FieldModulus is the Baby Jubjub base field (the BN254 scalar field).
+var FieldModulus = h2c.FieldModulus
+
+// Twisted Edwards coefficients: a*x^2 + y^2 = 1 + d*x^2*y^2
+var (
+	edwardsA = big.NewInt(168700)
+	edwardsD = big.NewInt(168696)
+)
+
+// Affine decompresses a point into its x and y coordinates. The encoding is
+// y little-endian with the top bit of the last byte set when x is the
+// lexicographically larger root.
+func Affine(b []byte) (x, y *big.Int, err error) {
+	if len(b) != PointSize {
+		return nil, nil, fmt.Errorf("point: expected %d bytes, got %d", PointSize, len(b))
+	}
+	opCounts.decompressions.Add(1)
+	le := append([]byte(nil), b...)
+	largest := le[PointSize-1]&0x80 != 0
+	le[PointSize-1] &= 0x7F
+	for i, j := 0, len(le)-1; i < j; i, j = i+1, j-1 {
+		le[i], le[j] = le[j], le[i]
+	}
+	y = new(big.Int).SetBytes(le)
+	if y.Cmp(FieldModulus) >= 0 {
+		return nil, nil, fmt.Errorf("point: y is not a field element")
+	}
+
+	// x^2 = (1 - y^2) / (a - d*y^2)
+	p := FieldModulus
+	y2 := new(big.Int).Mul(y, y)
+	num := new(big.Int).Sub(big.NewInt(1), y2)
+	num.Mod(num, p)
+	den := new(big.Int).Mul(edwardsD, y2)
+	den.Sub(edwardsA, den)
+	den.Mod(den, p)
+	if den.ModInverse(den, p) == nil {
+		return nil, nil, fmt.Errorf("point: not on the curve")
+	}
+	x2 := num.Mul(num, den)
+	x2.Mod(x2, p)
+	x = new(big.Int).ModSqrt(x2, p)
+	if x == nil {
+		return nil, nil, fmt.Errorf("point: not on the curve")
+	}
+	half := new(big.Int).Rsh(p, 1)
+	if (x.Cmp(half) > 0) != largest {
+		x.Sub(p, x)
+	}
+	return x, y, nil
+}
+
+// CircomPublicKey returns the circomlib public key A = Y/8 for a group key,
+// as used by EdDSAPoseidonVerifier and circomlibjs.
+func CircomPublicKey(groupKey []byte) (ax, ay *big.Int, err error) {
+	y, err := DecodePoint(groupKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("group key: %w", err)
+	}
+	inv8 := new(big.Int).ModInverse(big.NewInt(8), Order)
+	a := scalarMult(inv8, y)
+	return Affine(a.Bytes())
+}
+
+// PoseidonChallenge computes hm = Poseidon(R.x, R.y, A.x, A.y, M) with
+// A = Y/8. The result is a field element; the device takes it mod Order.
+// msg is M as a 32-byte big-endian field element.
+func PoseidonChallenge(groupCommitment, groupKey, msg []byte) (*big.Int, error) {
+	rx, ry, err := Affine(groupCommitment)
+	if err != nil {
+		return nil, fmt.Errorf("R: %w", err)
+	}
+	ax, ay, err := CircomPublicKey(groupKey)
+	if err != nil {
+		return nil, err
+	}
+	m := new(big.Int).SetBytes(msg)
+	if m.Cmp(FieldModulus) >= 0 {
+		return nil, fmt.Errorf("message is not a field element")
+	}
+	opCounts.hashes.Add(1)
+	return poseidon.Hash([]*big.Int{rx, ry, ax, ay, m})
+}
+
+// VerifyPoseidon checks a signature (R, z) made with the Poseidon challenge,
+// as EdDSAPoseidonVerifier would.
+func VerifyPoseidon(groupKey, msg, r, z []byte) (bool, error) {
+	v := ExplainPoseidon(groupKey, msg, r, z)
+	if v.malformed() {
+		return false, v.Err()
+	}
+	return v.Valid, nil
+}
+
+// MaxMessageFields is the most field elements PoseidonMessageHash takes,
+// the widest circomlib Poseidon.
+const MaxMessageFields = 16
+
+// PoseidonMessageHash hashes structured field elements to a message hash a
+// circuit can recompute: Poseidon(fields...) as 32 big-endian bytes. The
+// result is itself a field element, so it can also be the M of
+// PoseidonChallenge.
+func PoseidonMessageHash(fields []*big.Int) ([]byte, error) {
+	if len(fields) == 0 || len(fields) > MaxMessageFields {
+		return nil, fmt.Errorf("poseidon message: expected 1 to %d field elements, got %d", MaxMessageFields, len(fields))
+	}
+	for i, f := range fields {
+		if f.Sign() < 0 || f.Cmp(FieldModulus) >= 0 {
+			return nil, fmt.Errorf("poseidon message: field %d is not a field element", i)
+		}
+	}
+	opCounts.hashes.Add(1)
+	h, err := poseidon.Hash(fields)
+	if err != nil {
+		return nil, fmt.Errorf("poseidon message: %w", err)
+	}
+	out := make([]byte, ScalarSize)
+	h.FillBytes(out)
+	return out, nil
+}
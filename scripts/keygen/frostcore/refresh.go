@@ -0,0 +1,68 @@
+package frostcore
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math/big"
+)
+
+// Proactive refresh re-randomizes every share without changing the group
+// key or roster. Each participant deals a sharing of zero, a polynomial h_i
+// of degree t-1 with h_i(0) = 0, committing to C_ik = a_ik*G for k >= 1
+// (C_i0 is the identity and is left out). Participant j's new share is
+// s_j + sum_i h_i(j). Shares from before a refresh cannot be combined with
+// shares from after it, so an attacker must collect t shares between two
+// refreshes.
+
+// RefreshDeal deals a sharing of zero to a t-of-n group. Commitments holds
+// C_1..C_{t-1}.
+func RefreshDeal(t, n int, random io.Reader) (*Reshare, error) {
+	if t < 2 || t > n {
+		return nil, fmt.Errorf("refresh needs a threshold of at least 2 (got %d of %d)", t, n)
+	}
+	if n > 0xFFFF {
+		return nil, fmt.Errorf("%d participants exceed the 16-bit identifier range", n)
+	}
+	coeffs, err := randomPolynomial(new(big.Int), t, random)
+	if err != nil {
+		return nil, err
+	}
+	r := &Reshare{
+		Commitments: make([][]byte, t-1),
+		SubShares:   make([]*big.Int, n),
+	}
+	for k, a := range coeffs[1:] {
+		r.Commitments[k] = BasePoint(a)
+	}
+	for j := range r.SubShares {
+		r.SubShares[j] = evalPolynomial(coeffs, uint16(j+1))
+	}
+	return r, nil
+}
+
+// EvalZeroCommitments computes sum_{k>=1} x^k * C_k from C_1..C_{t-1}, as
+// x * sum_k x^k * C_{k+1}.
+func EvalZeroCommitments(commitments [][]byte, x uint16) ([]byte, error) {
+	sum, err := EvalCommitments(commitments, x)
+	if err != nil {
+		return nil, err
+	}
+	p, err := DecodePoint(sum)
+	if err != nil {
+		return nil, err
+	}
+	return scalarMult(big.NewInt(int64(x)), p).Bytes(), nil
+}
+
+// VerifyZeroSubShare checks sub*G against a zero-sharing's commitments at x.
+func VerifyZeroSubShare(commitments [][]byte, x uint16, sub *big.Int) error {
+	expected, err := EvalZeroCommitments(commitments, x)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(BasePoint(sub), expected) {
+		return fmt.Errorf("sub-share for participant %d does not match the commitments", x)
+	}
+	return nil
+}
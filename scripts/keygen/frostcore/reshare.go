@@ -0,0 +1,134 @@
+package frostcore
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math/big"
+
+	"github.com/f3rmion/fy/group"
+)
+
+// Resharing moves a group key to a new participant set without changing it.
+// Each old signer i in a threshold set S deals its weighted share
+// w_i = lambda_i(S) * s_i with a fresh polynomial g_i of degree t'-1,
+// g_i(0) = w_i, publishing Feldman commitments C_ik = a_ik*G. New participant
+// j's share is sum_i g_i(j); since sum_i w_i is the group secret, the group
+// key is unchanged. Old shares stay valid for the old polynomial and must be
+// destroyed.
+
+// Reshare is one old signer's contribution: commitments to its polynomial
+// and the sub-share for each new participant (index j-1 for participant j).
+type Reshare struct {
+	Commitments [][]byte
+	SubShares   []*big.Int
+}
+
+// ReshareDeal computes the contribution of old signer id, holding secret
+// share s, among oldSigners, to a newT-of-newN roster.
+func ReshareDeal(id uint16, s *big.Int, oldSigners []uint16, newT, newN int, random io.Reader) (*Reshare, error) {
+	if newT < 1 || newT > newN {
+		return nil, fmt.Errorf("invalid threshold %d of %d", newT, newN)
+	}
+	if newN > 0xFFFF {
+		return nil, fmt.Errorf("%d participants exceed the 16-bit identifier range", newN)
+	}
+	lambda, err := Lagrange(id, oldSigners)
+	if err != nil {
+		return nil, err
+	}
+	w := new(big.Int).Mul(lambda, s)
+	coeffs, err := randomPolynomial(w, newT, random)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Reshare{
+		Commitments: make([][]byte, newT),
+		SubShares:   make([]*big.Int, newN),
+	}
+	for k, a := range coeffs {
+		r.Commitments[k] = BasePoint(a)
+	}
+	for j := range r.SubShares {
+		r.SubShares[j] = evalPolynomial(coeffs, uint16(j+1))
+	}
+	return r, nil
+}
+
+// EvalCommitments computes sum_k x^k * C_k, the public value of a
+// committed polynomial at x.
+func EvalCommitments(commitments [][]byte, x uint16) ([]byte, error) {
+	if len(commitments) == 0 {
+		return nil, fmt.Errorf("no commitments")
+	}
+	var sum group.Point
+	pow := big.NewInt(1)
+	bx := big.NewInt(int64(x))
+	for k, c := range commitments {
+		p, err := DecodePoint(c)
+		if err != nil {
+			return nil, fmt.Errorf("commitment %d: %w", k, err)
+		}
+		term := scalarMult(pow, p)
+		if sum == nil {
+			sum = term
+		} else {
+			sum = Curve.NewPoint().Add(sum, term)
+		}
+		pow = new(big.Int).Mod(new(big.Int).Mul(pow, bx), Order)
+	}
+	return sum.Bytes(), nil
+}
+
+// VerifySubShare checks sub*G against the dealer's commitments at x.
+func VerifySubShare(commitments [][]byte, x uint16, sub *big.Int) error {
+	expected, err := EvalCommitments(commitments, x)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(BasePoint(sub), expected) {
+		return fmt.Errorf("sub-share for participant %d does not match the commitments", x)
+	}
+	return nil
+}
+
+// VerifyDealerShare checks that a contribution deals the weighted share of
+// old signer id: C_0 == lambda_i(S) * Y_i for its public share Y_i.
+func VerifyDealerShare(commitments [][]byte, id uint16, oldSigners []uint16, publicShare []byte) error {
+	if len(commitments) == 0 {
+		return fmt.Errorf("no commitments")
+	}
+	y, err := DecodePoint(publicShare)
+	if err != nil {
+		return fmt.Errorf("public share: %w", err)
+	}
+	lambda, err := Lagrange(id, oldSigners)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(commitments[0], scalarMult(lambda, y).Bytes()) {
+		return fmt.Errorf("participant %d does not deal its own share", id)
+	}
+	return nil
+}
+
+// AddPoints sums compressed points.
+func AddPoints(points ...[]byte) ([]byte, error) {
+	if len(points) == 0 {
+		return nil, fmt.Errorf("no points")
+	}
+	var sum group.Point
+	for i, b := range points {
+		p, err := DecodePoint(b)
+		if err != nil {
+			return nil, fmt.Errorf("point %d: %w", i, err)
+		}
+		if sum == nil {
+			sum = p
+		} else {
+			sum = Curve.NewPoint().Add(sum, p)
+		}
+	}
+	return sum.Bytes(), nil
+}
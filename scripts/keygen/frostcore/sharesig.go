@@ -0,0 +1,61 @@
+package frostcore
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+)
+
+// ShareSignatureSize is the encoded size of a share signature: R || z.
+const ShareSignatureSize = PointSize + ScalarSize
+
+// A share signature is a plain Schnorr signature by one participant's secret
+// share s_i, verified against its public share Y_i = s_i*G, with
+// c = H("share" || id || Y_i || R || msg) and z = k + c*s_i. It lets a
+// participant speak for itself alone, e.g. to record that it destroyed its
+// share, which no threshold of others could sign for it.
+
+func shareChallenge(id uint16, publicShare, r, msg []byte) *big.Int {
+	return hashToScalar("share", IDBytes(id), publicShare, r, msg)
+}
+
+// SignWithShare signs msg with participant id's secret share.
+func SignWithShare(id uint16, share *big.Int, msg []byte, random io.Reader) ([]byte, error) {
+	k, err := RandomScalar(random)
+	if err != nil {
+		return nil, err
+	}
+	r := BasePoint(k)
+	c := shareChallenge(id, BasePoint(share), r, msg)
+	z := new(big.Int).Mul(c, share)
+	z.Add(z, k).Mod(z, Order)
+	return append(r, ScalarBytes(z)...), nil
+}
+
+// VerifyShareSignature checks a share signature by participant id on msg
+// against its public share: z*G == R + c*Y_i.
+func VerifyShareSignature(id uint16, publicShare, msg, sig []byte) error {
+	if len(sig) != ShareSignatureSize {
+		return fmt.Errorf("share signature: expected %d bytes, got %d", ShareSignatureSize, len(sig))
+	}
+	z := ScalarFromBytes(sig[PointSize:])
+	if z.Cmp(Order) >= 0 {
+		return errors.New("share signature: z is not reduced")
+	}
+	y, err := DecodePoint(publicShare)
+	if err != nil {
+		return fmt.Errorf("public share: %w", err)
+	}
+	r, err := DecodePoint(sig[:PointSize])
+	if err != nil {
+		return fmt.Errorf("share signature: R: %w", err)
+	}
+	c := shareChallenge(id, publicShare, sig[:PointSize], msg)
+	want := Curve.NewPoint().Add(r, scalarMult(c, y))
+	if !bytes.Equal(BasePoint(z), want.Bytes()) {
+		return errors.New("share signature: z*G != R + c*Y")
+	}
+	return nil
+}
@@ -0,0 +1,158 @@
+package frostcore
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+
+	"github.com/f3rmion/fy/group"
+)
+
+// Reason classifies why a signature does not verify.
+type Reason string
+
+const (
+	BadGroupKey          Reason = "bad_group_key_encoding" // Not a compressed curve point
+	GroupKeyNotInGroup   Reason = "group_key_not_in_subgroup"
+	GroupKeyIdentity     Reason = "group_key_identity" // Every R verifies with z = 0 under it
+	BadREncoding         Reason = "bad_r_encoding"
+	RNotInGroup          Reason = "r_not_in_subgroup"
+	BadZEncoding         Reason = "bad_z_encoding"     // Not 32 bytes
+	ZOutOfRange          Reason = "z_out_of_range"     // Not reduced mod Order
+	ChallengeMismatch    Reason = "challenge_mismatch" // z*G != R + c*Y
+	WrongGroupKey        Reason = "wrong_group_key"    // Verifies under another key given
+	WrongChallengeScheme Reason = "wrong_challenge"    // Verifies with the other challenge hash
+	WrongPurpose         Reason = "wrong_purpose"      // Verifies untagged, not for the purpose
+	BadMessage           Reason = "bad_message"        // Not a field element (Poseidon)
+)
+
+// Verification is the outcome of verifying a signature, with the reason it
+// failed.
+type Verification struct {
+	Valid     bool   `json:"valid"`
+	Reason    Reason `json:"reason,omitempty"`
+	Detail    string `json:"detail,omitempty"`
+	Challenge string `json:"challenge,omitempty"` // c, once R and Y decode
+}
+
+// Err returns nil for a valid signature, otherwise an error naming the
+// reason.
+func (v *Verification) Err() error {
+	if v.Valid {
+		return nil
+	}
+	return fmt.Errorf("%s: %s", v.Reason, v.Detail)
+}
+
+// malformed reports whether the failure is in decoding the inputs rather
+// than in the verification equation.
+func (v *Verification) malformed() bool {
+	switch v.Reason {
+	case BadGroupKey, BadREncoding, BadZEncoding, BadMessage:
+		return true
+	}
+	return false
+}
+
+// Explain verifies a Blake2b-challenge signature like Verify and says why
+// it fails. When the equation does not hold, it is retried under each of
+// otherKeys and with the Poseidon challenge, to tell a signature made for
+// another group or with INJECT_CHALLENGE from a wrong one.
+func Explain(groupKey, msg, r, z []byte, otherKeys ...[]byte) *Verification {
+	return explain(groupKey, msg, r, z, blake2bChallenge, PoseidonChallengeScalar, otherKeys)
+}
+
+// ExplainPoseidon is Explain for signatures made with the Poseidon challenge.
+func ExplainPoseidon(groupKey, msg, r, z []byte, otherKeys ...[]byte) *Verification {
+	return explain(groupKey, msg, r, z, PoseidonChallengeScalar, blake2bChallenge, otherKeys)
+}
+
+type challengeFunc func(r, groupKey, msg []byte) (*big.Int, error)
+
+func blake2bChallenge(r, groupKey, msg []byte) (*big.Int, error) {
+	return Challenge(r, groupKey, msg), nil
+}
+
+// PoseidonChallengeScalar is the Poseidon challenge reduced mod Order.
+func PoseidonChallengeScalar(r, groupKey, msg []byte) (*big.Int, error) {
+	hm, err := PoseidonChallenge(r, groupKey, msg)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).Mod(hm, Order), nil
+}
+
+func explain(groupKey, msg, r, z []byte, challenge, other challengeFunc, otherKeys [][]byte) *Verification {
+	fail := func(reason Reason, format string, args ...any) *Verification {
+		return &Verification{Reason: reason, Detail: fmt.Sprintf(format, args...)}
+	}
+
+	y, err := DecodePoint(groupKey)
+	if err != nil {
+		return fail(BadGroupKey, "group key: %v", err)
+	}
+	if bytes.Equal(groupKey, BasePoint(new(big.Int))) {
+		return fail(GroupKeyIdentity, "group key is the identity")
+	}
+	if !InSubgroup(y) {
+		return fail(GroupKeyNotInGroup, "group key is not in the prime-order subgroup")
+	}
+	R, err := DecodePoint(r)
+	if err != nil {
+		return fail(BadREncoding, "R: %v", err)
+	}
+	if !InSubgroup(R) {
+		return fail(RNotInGroup, "R is not in the prime-order subgroup")
+	}
+	if len(z) != ScalarSize {
+		return fail(BadZEncoding, "z: expected %d bytes, got %d", ScalarSize, len(z))
+	}
+	if ScalarFromBytes(z).Cmp(Order) >= 0 {
+		return fail(ZOutOfRange, "z is not reduced mod the subgroup order")
+	}
+
+	c, err := challenge(r, groupKey, msg)
+	if err != nil {
+		return fail(BadMessage, "challenge: %v", err)
+	}
+	v := &Verification{Challenge: hex.EncodeToString(ScalarBytes(c))}
+	lhs := BasePoint(ScalarFromBytes(z))
+	if equationHolds(lhs, R, y, c) {
+		v.Valid = true
+		return v
+	}
+
+	for _, key := range otherKeys {
+		if bytes.Equal(key, groupKey) {
+			continue
+		}
+		other, err := DecodePoint(key)
+		if err != nil {
+			continue
+		}
+		if c, err := challenge(r, key, msg); err == nil && equationHolds(lhs, R, other, c) {
+			v.Reason, v.Detail = WrongGroupKey, fmt.Sprintf("signature is valid for group key %x", key)
+			return v
+		}
+	}
+	if c, err := other(r, groupKey, msg); err == nil && equationHolds(lhs, R, y, c) {
+		v.Reason, v.Detail = WrongChallengeScheme, "signature is valid with the other challenge hash (Blake2b vs Poseidon/INJECT_CHALLENGE)"
+		return v
+	}
+	v.Reason, v.Detail = ChallengeMismatch, "z*G != R + c*Y: wrong message, wrong nonce commitments or a bad partial signature"
+	return v
+}
+
+func equationHolds(lhs []byte, R, y group.Point, c *big.Int) bool {
+	rhs := Curve.NewPoint().Add(R, scalarMult(c, y))
+	return bytes.Equal(lhs, rhs.Bytes())
+}
+
+// InSubgroup reports whether p is in the prime-order subgroup, i.e.
+// Order*p is the identity (0*G), computed as (Order-1)*p + p since scalars
+// are reduced mod Order.
+func InSubgroup(p group.Point) bool {
+	q := scalarMult(new(big.Int).Sub(Order, big.NewInt(1)), p)
+	return bytes.Equal(q.Add(q, p).Bytes(), BasePoint(new(big.Int)))
+}
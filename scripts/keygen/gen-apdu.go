@@ -1,13 +1,29 @@
+//go:build ignore
+
+// Manual APDU walkthrough for pasting into the Speculos GUI.
+// Run with: go run gen-apdu.go
+//
+// With -negative it prints malformed and out-of-order APDUs instead, each
+// with the status word the app answers (see negative cases below); -json
+// prints them for a test harness.
 package main
 
 import (
 	"crypto/rand"
 	"encoding/hex"
+	"encoding/json"
+	"flag"
 	"fmt"
+	"math/big"
 	"os"
 
 	"github.com/f3rmion/fy/bjj"
 	"github.com/f3rmion/fy/frost"
+	"github.com/f3rmion/fy/group"
+
+	"keygen/apdu"
+	"keygen/frostcore"
+	"keygen/simdevice"
 )
 
 func padTo32(b []byte) []byte {
@@ -20,6 +36,10 @@ func padTo32(b []byte) []byte {
 }
 
 func main() {
+	negative := flag.Bool("negative", false, "Print malformed and out-of-order APDUs with the status words the app answers")
+	asJSON := flag.Bool("json", false, "With -negative, print the cases as JSON")
+	flag.Parse()
+
 	g := &bjj.BJJ{}
 	hasher := frost.NewBlake2bHasher()
 	f, err := frost.NewWithHasher(g, 2, 3, hasher)
@@ -79,6 +99,33 @@ func main() {
 		message[i+3] = 0xef
 	}
 
+	if *negative {
+		hidingNonce1, _ := g.RandomScalar(rand.Reader)
+		bindingNonce1, _ := g.RandomScalar(rand.Reader)
+		k := negativeKeys{
+			groupKey: groupKey,
+			id1:      id1,
+			secret1:  secret1,
+			id2:      id2,
+			id3:      padTo32(keyShares[2].ID.Bytes()),
+			message:  message,
+			commit1:  commitPair(g, hidingNonce1, bindingNonce1),
+			commit2:  append(append([]byte{}, hidingCommit2...), bindingCommit2...),
+			offCurve: offCurvePoint(g),
+		}
+		cases := negativeCases(k)
+		if err := checkNegativeCases(cases); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		if *asJSON {
+			printNegativeJSON(cases)
+		} else {
+			printNegativeCases(cases)
+		}
+		return
+	}
+
 	fmt.Println("╔══════════════════════════════════════════════════════════════════╗")
 	fmt.Println("║              FROST 2-of-3 Manual Test APDUs                      ║")
 	fmt.Println("╚══════════════════════════════════════════════════════════════════╝")
@@ -151,3 +198,320 @@ func main() {
 	fmt.Printf("Hiding nonce 2:       %s\n", hex.EncodeToString(padTo32(hidingNonce2.Bytes())))
 	fmt.Printf("Binding nonce 2:      %s\n", hex.EncodeToString(padTo32(bindingNonce2.Bytes())))
 }
+
+// ============================================================================
+// Negative cases
+// ============================================================================
+
+// negativeStep is one APDU of a negative case and the status word the app
+// answers it with.
+type negativeStep struct {
+	command []byte
+	sw      uint16
+	approve bool   // The device prompts; approve it
+	note    string // Why the app answers sw, where that is not obvious
+}
+
+// negativeCase exercises one error path of the app. Its first steps bring
+// the device to the state the path starts from.
+type negativeCase struct {
+	name    string // category/name
+	summary string
+	steps   []negativeStep
+}
+
+// negativeKeys are the values the cases are built from: participant 1's
+// keys, two valid commitment pairs and an encoding of no point.
+type negativeKeys struct {
+	groupKey, id1, secret1, id2, id3 []byte
+	message                          []byte
+	commit1, commit2                 []byte // hiding || binding
+	offCurve                         []byte
+}
+
+func commitPair(g group.Group, hiding, binding group.Scalar) []byte {
+	h := padTo32(g.NewPoint().ScalarMult(hiding, g.Generator()).Bytes())
+	b := padTo32(g.NewPoint().ScalarMult(binding, g.Generator()).Bytes())
+	return append(append([]byte{}, h...), b...)
+}
+
+// offCurvePoint returns the first 32-byte encoding, counting up from y = 2,
+// that decodes to no point of the curve.
+func offCurvePoint(g group.Group) []byte {
+	for y := 2; ; y++ {
+		b := make([]byte, 32)
+		b[0], b[1] = byte(y), byte(y>>8) // Little-endian y, sign bit clear
+		if _, err := g.NewPoint().SetBytes(b); err != nil {
+			return b
+		}
+	}
+}
+
+func cat(parts ...[]byte) []byte {
+	var out []byte
+	for _, p := range parts {
+		out = append(out, p...)
+	}
+	return out
+}
+
+// negativeCases lists the cases in the order they run on one device: first
+// those needing a device without keys, then the injection the others need.
+// Every case after it starts with RESET, so it does not depend on the state
+// the one before left.
+func negativeCases(k negativeKeys) []negativeCase {
+	step := func(command []byte, sw uint16, note string) negativeStep {
+		return negativeStep{command: command, sw: sw, note: note}
+	}
+	ok := func(command []byte) negativeStep { return step(command, apdu.SwOK, "") }
+	approved := func(s negativeStep) negativeStep {
+		s.approve = true
+		return s
+	}
+	withCLA := func(command []byte, cla byte) []byte {
+		command[0] = cla
+		return command
+	}
+
+	inject := apdu.Command(apdu.InsInjectKeys, apdu.CurveBJJ, 0, cat(k.groupKey, k.id1, k.secret1))
+	reset := apdu.Command(apdu.InsReset, 0, 0, nil)
+	commit := apdu.Command(apdu.InsCommit, 0, 0, nil)
+	message := apdu.Command(apdu.InsInjectMessage, 0, 0, k.message)
+	list := cat(k.id1, k.commit1, k.id2, k.commit2)
+	commitments := apdu.Command(apdu.InsInjectCommitmentsP1, 2, 0, list)
+	sign := apdu.Command(apdu.InsPartialSign, 0, 0, nil)
+	// The session up to the commitment list
+	session := []negativeStep{ok(commit), ok(message)}
+	withList := append(session[:2:2], ok(commitments))
+
+	noKeys := []negativeCase{
+		{"state/no-keys-get-public-key", "GET_PUBLIC_KEY before any keys are injected", []negativeStep{
+			step(apdu.Command(apdu.InsGetPublicKey, 0, 0, nil), apdu.SwConditionsNotSat, ""),
+		}},
+		{"state/no-keys-commit", "COMMIT before any keys are injected", []negativeStep{
+			step(commit, apdu.SwConditionsNotSat, ""),
+		}},
+		{"state/no-keys-wipe", "WIPE_KEYS before any keys are injected", []negativeStep{
+			step(apdu.Command(apdu.InsWipeKeys, 0, 0, cat(k.groupKey, k.id1)), apdu.SwOK, "not an error: the response is 00, nothing wiped"),
+		}},
+		{"setup/inject-keys", "Inject participant 1's keys, which the cases below need", []negativeStep{
+			approved(ok(inject)),
+		}},
+	}
+
+	cases := []negativeCase{
+		// Header
+		{"header/wrong-cla", "A CLA other than E0", []negativeStep{
+			ok(commit),
+			step(withCLA(apdu.Command(apdu.InsInjectMessage, 0, 0, k.message), 0x80), apdu.SwClaNotSupported, ""),
+			step(message, apdu.SwConditionsNotSat, "a thrown error clears the signing state, nonces included"),
+		}},
+		{"header/unknown-ins", "An instruction the app does not have", []negativeStep{
+			ok(commit),
+			step(apdu.Command(0x7F, 0, 0, nil), apdu.SwInsNotSupported, ""),
+			step(message, apdu.SwConditionsNotSat, "a thrown error clears the signing state, nonces included"),
+		}},
+		{"header/reserved-ins", "GET_COUNTER, reserved but not implemented", []negativeStep{
+			step(apdu.Command(apdu.InsGetCounter, 0, 0, nil), apdu.SwInsNotSupported, ""),
+		}},
+
+		// Lengths
+		{"length/lc-exceeds-data", "INJECT_MESSAGE whose Lc announces 32 bytes but carries 16", []negativeStep{
+			ok(commit),
+			step(append(apdu.Command(apdu.InsInjectMessage, 0, 0, nil)[:4:4], append([]byte{32}, k.message[:16]...)...), apdu.SwWrongLength,
+				"the app takes Lc from the header: a device answering 9000 read past the data it received"),
+		}},
+		{"length/message-truncated", "INJECT_MESSAGE with 31 bytes", []negativeStep{
+			ok(commit),
+			step(apdu.Command(apdu.InsInjectMessage, 0, 0, k.message[:31]), apdu.SwWrongLength, ""),
+			step(message, apdu.SwOK, "a handler's error keeps the signing state"),
+		}},
+		{"length/message-long", "INJECT_MESSAGE with 33 bytes", []negativeStep{
+			ok(commit),
+			step(apdu.Command(apdu.InsInjectMessage, 0, 0, cat(k.message, []byte{0})), apdu.SwWrongLength, ""),
+		}},
+		{"length/inject-keys-truncated", "INJECT_KEYS with the share cut to 31 bytes", []negativeStep{
+			step(apdu.Command(apdu.InsInjectKeys, apdu.CurveBJJ, 0, cat(k.groupKey, k.id1, k.secret1[:31])), apdu.SwWrongLength, "refused before the prompt"),
+		}},
+		{"length/inject-keys-long-purpose", "INJECT_KEYS with a purpose tag over 16 bytes", []negativeStep{
+			step(apdu.Command(apdu.InsInjectKeys, apdu.CurveBJJ, 0, cat(k.groupKey, k.id1, k.secret1, []byte("purpose-tag-of-17"))), apdu.SwWrongLength, "refused before the prompt"),
+		}},
+		{"length/challenge-truncated", "INJECT_CHALLENGE with 31 bytes", append(withList[:3:3],
+			step(apdu.Command(apdu.InsInjectChallenge, 0, 0, make([]byte, 31)), apdu.SwWrongLength, ""),
+		)},
+		{"length/wipe-keys-truncated", "WIPE_KEYS with the identifier cut to 31 bytes", []negativeStep{
+			step(apdu.Command(apdu.InsWipeKeys, 0, 0, cat(k.groupKey, k.id1[:31])), apdu.SwWrongLength, "refused before the prompt"),
+		}},
+		{"length/commitments-truncated", "INJECT_COMMITMENTS announcing 2 participants and sending 1", append(session[:2:2],
+			step(apdu.Command(apdu.InsInjectCommitmentsP1, 2, 0, list[:apdu.CommitmentEntrySize]), apdu.SwOK, "the response counts 96 bytes received"),
+			step(sign, apdu.SwConditionsNotSat, "the list is incomplete"),
+		)},
+
+		// Parameters
+		{"params/inject-keys-curve", "INJECT_KEYS for Ed25519 (P1 01)", []negativeStep{
+			step(apdu.Command(apdu.InsInjectKeys, apdu.CurveEd25519, 0, cat(k.groupKey, k.id1, k.secret1)), apdu.SwWrongP1P2, ""),
+		}},
+		{"params/commitments-one", "INJECT_COMMITMENTS for 1 participant", append(session[:2:2],
+			step(apdu.Command(apdu.InsInjectCommitmentsP1, 1, 0, list[:apdu.CommitmentEntrySize]), apdu.SwInvalidData, ""),
+		)},
+		{"params/commitments-zero", "INJECT_COMMITMENTS for 0 participants", append(session[:2:2],
+			step(apdu.Command(apdu.InsInjectCommitmentsP1, 0, 0, nil), apdu.SwInvalidData, ""),
+		)},
+		{"params/commitments-too-many", "INJECT_COMMITMENTS for 255 participants", append(session[:2:2],
+			step(apdu.Command(apdu.InsInjectCommitmentsP1, 0xFF, 0, list), apdu.SwInvalidData, ""),
+		)},
+
+		// State machine
+		{"state/message-before-commit", "INJECT_MESSAGE without nonces", []negativeStep{
+			step(message, apdu.SwConditionsNotSat, ""),
+		}},
+		{"state/commit-twice", "COMMIT while nonces are pending", []negativeStep{
+			ok(commit),
+			step(commit, apdu.SwConditionsNotSat, "the pending nonces are kept"),
+			ok(message),
+		}},
+		{"state/message-twice", "INJECT_MESSAGE twice", append(session[:2:2],
+			step(message, apdu.SwConditionsNotSat, ""),
+		)},
+		{"state/commitments-before-message", "INJECT_COMMITMENTS before INJECT_MESSAGE", []negativeStep{
+			ok(commit),
+			step(commitments, apdu.SwConditionsNotSat, ""),
+		}},
+		{"state/commitments-twice", "INJECT_COMMITMENTS once the list is complete", append(withList[:3:3],
+			step(commitments, apdu.SwConditionsNotSat, ""),
+		)},
+		{"state/continuation-first", "INJECT_COMMITMENTS continuation (1D) with no first frame", append(session[:2:2],
+			step(apdu.Command(apdu.InsInjectCommitmentsP2, 0, 0, list), apdu.SwOK, "the app takes it as a complete list of 0 participants, 0 bytes received"),
+			approved(step(sign, apdu.SwInvalidData, "the empty list has no entry for the device, found only after the prompt")),
+		)},
+		{"state/challenge-before-commitments", "INJECT_CHALLENGE before INJECT_COMMITMENTS", append(session[:2:2],
+			step(apdu.Command(apdu.InsInjectChallenge, 0, 0, make([]byte, 32)), apdu.SwConditionsNotSat, ""),
+		)},
+		{"state/sign-before-commitments", "PARTIAL_SIGN before INJECT_COMMITMENTS", append(session[:2:2],
+			step(sign, apdu.SwConditionsNotSat, ""),
+		)},
+		{"state/sign-twice", "PARTIAL_SIGN again with the same nonces", append(withList[:3:3],
+			approved(ok(sign)),
+			step(sign, apdu.SwConditionsNotSat, "nonces are single use"),
+		)},
+		{"state/not-a-signer", "PARTIAL_SIGN for a list of participants 2 and 3", append(session[:2:2],
+			ok(apdu.Command(apdu.InsInjectCommitmentsP1, 2, 0, cat(k.id2, k.commit2, k.id3, k.commit1))),
+			approved(step(sign, apdu.SwInvalidData, "found only after the prompt")),
+		)},
+
+		// Data
+		{"data/identifier-zero", "INJECT_KEYS for participant 0", []negativeStep{
+			step(apdu.Command(apdu.InsInjectKeys, apdu.CurveBJJ, 0, cat(k.groupKey, make([]byte, 32), k.secret1)), apdu.SwInvalidData, "refused before the prompt"),
+		}},
+		{"data/purpose-invalid", "INJECT_KEYS with an upper-case purpose tag", []negativeStep{
+			step(apdu.Command(apdu.InsInjectKeys, apdu.CurveBJJ, 0, cat(k.groupKey, k.id1, k.secret1, []byte("Payments"))), apdu.SwInvalidData, "refused before the prompt"),
+		}},
+		{"data/wipe-other-group", "WIPE_KEYS naming another group key", []negativeStep{
+			step(apdu.Command(apdu.InsWipeKeys, 0, 0, cat(k.commit1[:32], k.id1)), apdu.SwInvalidData, "refused before the prompt; the keys stay"),
+			ok(apdu.Command(apdu.InsGetPublicKey, 0, 0, nil)),
+		}},
+
+		// Scalars the app does not reduce or check
+		{"scalar/identifier-high-bytes", "INJECT_KEYS with identifier bytes above the low two set", []negativeStep{
+			approved(step(apdu.Command(apdu.InsInjectKeys, apdu.CurveBJJ, 0, cat(k.groupKey, cat([]byte{1}, k.id1[1:]), k.secret1)), apdu.SwOK,
+				"not checked: the app reads the identifier from the last two bytes, so this is participant 1")),
+		}},
+		{"scalar/share-not-reduced", "INJECT_KEYS with the share plus the group order", []negativeStep{
+			approved(step(apdu.Command(apdu.InsInjectKeys, apdu.CurveBJJ, 0, cat(k.groupKey, k.id1, nonCanonical(k.secret1))), apdu.SwOK,
+				"not checked: the app stores the share as given")),
+			approved(ok(inject)),
+		}},
+		{"scalar/challenge-not-reduced", "INJECT_CHALLENGE with FF x 32, above the group order", append(withList[:3:3],
+			step(apdu.Command(apdu.InsInjectChallenge, 0, 0, bytesOf(0xFF, 32)), apdu.SwOK, "not checked: the app stores the challenge as given"),
+		)},
+
+		// Points the app does not check on injection
+		{"point/commitment-off-curve", "INJECT_COMMITMENTS with a hiding commitment that is not on the curve", append(session[:2:2],
+			step(apdu.Command(apdu.InsInjectCommitmentsP1, 2, 0, cat(k.id1, k.offCurve, k.commit1[32:], k.id2, k.commit2)), apdu.SwOK, "not checked on injection"),
+			approved(step(sign, apdu.SwInternalError, "the group commitment fails, only after the prompt")),
+		)},
+		{"point/group-key-off-curve", "INJECT_KEYS with a group key that is not on the curve", []negativeStep{
+			approved(step(apdu.Command(apdu.InsInjectKeys, apdu.CurveBJJ, 0, cat(k.offCurve, k.id1, k.secret1)), apdu.SwOK,
+				"not checked: the app stores the group key as given, so the host must check it")),
+			approved(ok(inject)),
+		}},
+	}
+	for i := range cases {
+		cases[i].steps = append([]negativeStep{ok(reset)}, cases[i].steps...)
+	}
+	return append(noKeys, cases...)
+}
+
+// nonCanonical returns the 32-byte scalar s plus the group order.
+func nonCanonical(s []byte) []byte {
+	x := new(big.Int).Add(new(big.Int).SetBytes(s), frostcore.Order)
+	return x.FillBytes(make([]byte, 32))
+}
+
+func bytesOf(b byte, n int) []byte {
+	out := make([]byte, n)
+	for i := range out {
+		out[i] = b
+	}
+	return out
+}
+
+// checkNegativeCases replays the cases in order on a new simdevice, which
+// follows src/handler.c, approving every prompt, and fails if any status
+// word differs from the one printed.
+func checkNegativeCases(cases []negativeCase) error {
+	dev := simdevice.New()
+	for _, c := range cases {
+		for i, st := range c.steps {
+			_, sw := apdu.SplitResponse(dev.Exchange(st.command))
+			if sw != st.sw {
+				return fmt.Errorf("%s: step %d (%s) answered %04X, not %04X", c.name, i+1, apdu.InsName(st.command[1]), sw, st.sw)
+			}
+		}
+	}
+	return nil
+}
+
+func printNegativeCases(cases []negativeCase) {
+	fmt.Println("Negative APDU cases. Send them in order to one device, starting without keys;")
+	fmt.Println("approve the prompts marked [approve]. Each line gives the expected status word.")
+	for _, c := range cases {
+		fmt.Println()
+		fmt.Printf("## %s: %s\n", c.name, c.summary)
+		for _, st := range c.steps {
+			line := fmt.Sprintf("%-20s %04X", apdu.InsName(st.command[1]), st.sw)
+			if st.approve {
+				line += " [approve]"
+			}
+			if st.note != "" {
+				line += "  # " + st.note
+			}
+			fmt.Println(line)
+			fmt.Printf("  %s\n", hex.EncodeToString(st.command))
+		}
+	}
+}
+
+func printNegativeJSON(cases []negativeCase) {
+	type step struct {
+		Command string `json:"command"`
+		SW      string `json:"sw"`
+		Approve bool   `json:"approve,omitempty"`
+		Note    string `json:"note,omitempty"`
+	}
+	type testCase struct {
+		Name    string `json:"name"`
+		Summary string `json:"summary"`
+		Steps   []step `json:"steps"`
+	}
+	out := make([]testCase, len(cases))
+	for i, c := range cases {
+		out[i] = testCase{Name: c.name, Summary: c.summary}
+		for _, st := range c.steps {
+			out[i].Steps = append(out[i].Steps, step{hex.EncodeToString(st.command), fmt.Sprintf("%04X", st.sw), st.approve, st.note})
+		}
+	}
+	e := json.NewEncoder(os.Stdout)
+	e.SetIndent("", "  ")
+	e.Encode(out)
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"keygen/coordinator"
+	"keygen/groupstate"
+	"keygen/schema"
+)
+
+// runGroupState implements the group-state subcommands:
+//
+//	group-state init              < keygen.json > state.json
+//	group-state action -state f -op freeze|unfreeze [-reason text]
+//	group-state action -state f -op failover -participant i -standby id [-reason text]
+//	group-state apply  -state f [-coordinator url]   < signed-action.json
+//	group-state accounting -state f [-cost-center c] [-project p] [-labels k=v,...]
+//
+// init and accounting set the group's accounting metadata (see
+// groupstate.Accounting); "-labels k=" removes label k. accounting with no
+// flags prints it.
+//
+// An action is signed by t participants over its message_hash with the usual
+// commit/sign/aggregate flow; copy the aggregate R and z into the action
+// before applying it. A failover hands participant i's share to its standby
+// signer (see runStandby). apply -coordinator also applies the action on a
+// coordinator run with keygen serve, authenticating with
+// $FY_LEDGER_COORDINATOR_TOKEN, so it honours a freeze or lists the standby
+// in its registry without a restart.
+func runGroupState(args []string) {
+	if len(args) < 1 {
+		fail(KindUsage, "Usage: keygen group-state <init|action|apply|accounting> [options]")
+	}
+
+	cmd := flag.NewFlagSet("group-state "+args[0], flag.ExitOnError)
+	statePath := cmd.String("state", ceremony.GroupStateOr("group-state.json"), "Group-state document")
+	op := cmd.String("op", groupstate.OpFreeze, "Action: freeze, unfreeze or failover")
+	participant := cmd.Int("participant", 0, "Participant to fail over to its standby")
+	standby := cmd.String("standby", "", "Standby to fail over to (the ID from standby designate)")
+	coordURL := cmd.String("coordinator", "", "Also apply the action on this coordinator")
+	reason := cmd.String("reason", "", "Reason recorded with the action")
+	costCenter := cmd.String("cost-center", "", "Cost center to charge the group's signing to")
+	project := cmd.String("project", "", "Project to charge the group's signing to")
+	labels := cmd.String("labels", "", "Further accounting labels (comma-separated key=value)")
+	stdioFlags(cmd)
+	cmd.Parse(args[1:])
+	accounting := func(doc *groupstate.Document) {
+		a := &groupstate.Accounting{CostCenter: *costCenter, Project: *project}
+		var removed []string
+		if *labels != "" {
+			a.Labels = make(map[string]string)
+			for _, kv := range strings.Split(*labels, ",") {
+				k, v, ok := strings.Cut(kv, "=")
+				if !ok || k == "" {
+					fail(KindUsage, "Error: -labels: expected key=value, got %q", kv)
+				}
+				if v == "" {
+					removed = append(removed, k)
+					continue
+				}
+				a.Labels[k] = v
+			}
+		}
+		doc.Accounting = doc.Accounting.Merge(a)
+		for _, k := range removed {
+			delete(doc.Accounting.Labels, k)
+		}
+		if len(doc.Accounting.Labels) == 0 {
+			doc.Accounting.Labels = nil
+		}
+		if doc.Accounting.CostCenter == "" && doc.Accounting.Project == "" && doc.Accounting.Labels == nil {
+			doc.Accounting = nil
+		}
+	}
+
+	switch args[0] {
+	case "init":
+		var keys KeyGenOutput
+		if err := schema.Decode(os.Stdin, &keys, stdinName); err != nil {
+			fail(KindInput, "Error reading input: %v", err)
+		}
+		if len(keys.Shares) == 0 {
+			fail(KindInput, "Error: keygen output has no shares")
+		}
+		doc := groupstate.Document{
+			GroupKey:  keys.Shares[0].GroupKey,
+			Threshold: keys.Threshold,
+			Total:     keys.Total,
+			Purpose:   keys.Shares[0].Purpose,
+		}
+		for _, s := range keys.Shares {
+			doc.PublicShares = append(doc.PublicShares, s.PublicShare)
+		}
+		accounting(&doc)
+		writeJSON(doc)
+
+	case "accounting":
+		doc := loadGroupState(*statePath)
+		if *costCenter != "" || *project != "" || *labels != "" {
+			accounting(doc)
+			if err := doc.Save(*statePath); err != nil {
+				fail(KindFailure, "Error writing %s: %v", *statePath, err)
+			}
+		}
+		writeJSON(doc.Accounting)
+
+	case "action":
+		doc := loadGroupState(*statePath)
+		var action *groupstate.Action
+		var err error
+		if *op == groupstate.OpFailover {
+			action, err = doc.NewFailover(*participant, *standby, *reason)
+		} else {
+			action, err = doc.NewAction(*op, *reason)
+		}
+		if err != nil {
+			fail(KindInput, "Error: %v", err)
+		}
+		writeJSON(action)
+
+	case "apply":
+		doc := loadGroupState(*statePath)
+		var action groupstate.Action
+		if err := schema.Decode(os.Stdin, &action, stdinName); err != nil {
+			fail(KindInput, "Error reading input: %v", err)
+		}
+		if err := doc.Apply(&action); err != nil {
+			fail(KindCrypto, "Error: rejected %s action: %v", action.Op, err)
+		}
+		if err := doc.Save(*statePath); err != nil {
+			fail(KindFailure, "Error writing %s: %v", *statePath, err)
+		}
+		if *coordURL != "" {
+			applyOnCoordinator(*coordURL, doc.GroupKey, &action)
+		}
+		writeJSON(doc)
+
+	default:
+		fail(KindUsage, "Unknown group-state command: %s", args[0])
+	}
+}
+
+// applyOnCoordinator delivers a signed action to a coordinator run with
+// keygen serve. The local document is already updated, so a coordinator
+// that has the action already is not an error.
+func applyOnCoordinator(url, groupKey string, action *groupstate.Action) {
+	body, _ := json.Marshal(coordinator.ActionParams{GroupKey: groupKey, Action: *action})
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	h := coordinatorClient(url)
+	_, err := h.Handle(ctx, &coordinator.Request{Op: coordinator.OpApplyAction, Body: body})
+	if coordinator.CodeOf(err) == coordinator.CodeConflict {
+		fmt.Fprintf(os.Stderr, "Coordinator %s: %v\n", url, err)
+		return
+	}
+	if err != nil {
+		fail(KindTransport, "Error applying the action on %s: %v (the local document is updated)", url, err)
+	}
+	fmt.Fprintf(os.Stderr, "Applied on coordinator %s\n", url)
+}
+
+func loadGroupState(path string) *groupstate.Document {
+	doc, err := groupstate.Load(path)
+	if err != nil {
+		fail(KindInput, "Error reading group state: %v", err)
+	}
+	return doc
+}
+
+// requireActiveGroup refuses to start a session for a frozen group, or for
+// participant id if it is retired (id 0 skips that check). An empty path
+// skips the checks.
+func requireActiveGroup(path string, id int) {
+	if path == "" {
+		return
+	}
+	doc := loadGroupState(path)
+	if err := doc.CheckActive(); err != nil {
+		fail(KindInput, "Error: %v; refusing to start a session", err)
+	}
+	if id != 0 {
+		if err := doc.CheckSigners([]int{id}); err != nil {
+			fail(KindInput, "Error: %v; refusing to start a session", err)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package groupstate
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"slices"
+	"strings"
+	"time"
+
+	"keygen/frostcore"
+)
+
+// destructionDomain separates destruction records from other messages a
+// share signs.
+const destructionDomain = "fy-ledger/share-destruction/v1"
+
+// Destruction is a participant's record that it destroyed its key share:
+// the share file, its unused nonces and the device key slot holding it.
+// It is signed with the share itself, just before the share is overwritten,
+// so it verifies against the participant's public share and only the holder
+// could have made it. Unlike an Action it needs no quorum: a participant
+// may always leave the group.
+type Destruction struct {
+	GroupKey    string      `json:"group_key"`
+	Participant int         `json:"participant"`
+	PublicShare string      `json:"public_share"`
+	Reason      string      `json:"reason,omitempty"`
+	ShareFile   string      `json:"share_file"`            // SHA-256 of the share file as it was
+	NonceFiles  []string    `json:"nonce_files,omitempty"` // SHA-256 of each nonce file destroyed with it
+	Device      *DeviceWipe `json:"device,omitempty"`      // Set if a device key slot was wiped
+	Host        string      `json:"host,omitempty"`
+	Time        time.Time   `json:"time"`
+	Signature   string      `json:"signature"` // Share signature on Message; see frostcore.SignWithShare
+}
+
+// DeviceWipe is the WIPE_KEYS part of a Destruction.
+type DeviceWipe struct {
+	Transport string `json:"transport"` // Speculos address, or "sim"
+	Wiped     bool   `json:"wiped"`     // False if the slot was empty already
+}
+
+// Message computes SHA-256(domain || record), the record being its JSON
+// encoding without the signature.
+func (r *Destruction) Message() []byte {
+	unsigned := *r
+	unsigned.Signature = ""
+	b, _ := json.Marshal(&unsigned)
+	h := sha256.New()
+	h.Write([]byte(destructionDomain))
+	h.Write(b)
+	return h.Sum(nil)
+}
+
+// Sign signs the record with the participant's secret share.
+func (r *Destruction) Sign(share *big.Int, random io.Reader) error {
+	sig, err := frostcore.SignWithShare(uint16(r.Participant), share, r.Message(), random)
+	if err != nil {
+		return err
+	}
+	r.Signature = hex.EncodeToString(sig)
+	return nil
+}
+
+// Verify checks the record's signature against its public share.
+func (r *Destruction) Verify() error {
+	if r.Participant < 1 || r.Participant > 0xFFFF {
+		return fmt.Errorf("participant %d out of range", r.Participant)
+	}
+	publicShare, err := hex.DecodeString(r.PublicShare)
+	if err != nil {
+		return fmt.Errorf("public share: %w", err)
+	}
+	sig, err := hex.DecodeString(r.Signature)
+	if err != nil {
+		return fmt.Errorf("signature: %w", err)
+	}
+	return frostcore.VerifyShareSignature(uint16(r.Participant), publicShare, r.Message(), sig)
+}
+
+// Retire records a participant's destruction of its share, after checking
+// the record is the group's and signed by that participant's share. Retiring
+// a participant twice is not an error.
+func (d *Document) Retire(r *Destruction) error {
+	switch {
+	case !strings.EqualFold(r.GroupKey, d.GroupKey):
+		return fmt.Errorf("record is for group %s", r.GroupKey)
+	case r.Participant < 1 || r.Participant > len(d.PublicShares):
+		return fmt.Errorf("participant %d is not in the group", r.Participant)
+	case !strings.EqualFold(r.PublicShare, d.PublicShares[r.Participant-1]):
+		return fmt.Errorf("record's public share is not participant %d's", r.Participant)
+	}
+	if err := r.Verify(); err != nil {
+		return err
+	}
+	if _, ok := d.Retired[r.Participant]; ok {
+		return nil
+	}
+	if d.Retired == nil {
+		d.Retired = make(map[int]time.Time)
+	}
+	d.Retired[r.Participant] = r.Time
+	return nil
+}
+
+// ErrRetired is returned by CheckSigners for a participant that destroyed
+// its share.
+var ErrRetired = errors.New("participant destroyed its share")
+
+// CheckSigners returns ErrRetired if any of ids is a retired participant.
+func (d *Document) CheckSigners(ids []int) error {
+	for _, id := range slices.Sorted(slices.Values(ids)) {
+		if t, ok := d.Retired[id]; ok {
+			return fmt.Errorf("%w: participant %d, at %s", ErrRetired, id, t.Format(time.RFC3339))
+		}
+	}
+	return nil
+}
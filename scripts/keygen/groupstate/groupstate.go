@@ -0,0 +1,305 @@
+// Package groupstate maintains the group-state document: the public record of
+// a FROST group (group key, threshold, roster) plus administrative state that
+// signers and coordinators must honour before starting a session.
+//
+// Administrative actions such as an emergency freeze or a standby failover
+// are only accepted when they carry a threshold signature by the group
+// itself, so no single operator can freeze or unfreeze a group, or hand a
+// participant's share to its standby.
+package groupstate
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"keygen/frostcore"
+	"keygen/schema"
+)
+
+// Action operations
+const (
+	OpFreeze   = "freeze"
+	OpUnfreeze = "unfreeze"
+	OpFailover = "failover" // Activate a participant's standby signer
+)
+
+// actionDomain separates group-state actions from ordinary signed messages.
+const actionDomain = "fy-ledger/group-state/v1"
+
+// ErrFrozen is returned by CheckActive for a frozen group.
+var ErrFrozen = errors.New("group is frozen")
+
+// Document is the group-state document.
+type Document struct {
+	Ciphersuite  string   `json:"ciphersuite,omitempty"` // ID of the group's ciphersuite; empty for the default
+	GroupKey     string   `json:"group_key"`             // 32 bytes compressed
+	Threshold    int      `json:"threshold"`             // Signing threshold (t)
+	Total        int      `json:"total"`                 // Total participants (n)
+	PublicShares []string `json:"public_shares"`         // Per-participant public shares, index i is participant i+1
+	Purpose      string   `json:"purpose,omitempty"`     // Purpose tag the shares were provisioned for
+	Frozen       bool     `json:"frozen"`
+	Sequence     uint64   `json:"sequence"` // Number of applied actions
+	History      []Action `json:"history,omitempty"`
+
+	// Failovers maps each participant whose share a failover handed to a
+	// standby signer to that standby (Action.Standby).
+	Failovers map[int]string `json:"failovers,omitempty"`
+
+	// Retired holds the participants that destroyed their share, by when
+	// (see Destruction). They never sign again.
+	Retired map[int]time.Time `json:"retired,omitempty"`
+
+	// Accounting attributes the group's signing activity to a budget. It
+	// is operator metadata, not covered by the group's signature.
+	Accounting *Accounting `json:"accounting,omitempty"`
+}
+
+// Accounting is cost-center metadata carried into audit records and event
+// streams, so signing activity can be charged to internal budgets. It is
+// not interpreted.
+type Accounting struct {
+	CostCenter string            `json:"cost_center,omitempty"`
+	Project    string            `json:"project,omitempty"`
+	Labels     map[string]string `json:"labels,omitempty"`
+}
+
+// Merge returns a with the fields set in over replacing its own, e.g. a
+// session's accounting over its group's. Labels are merged key by key.
+// Either may be nil; the result is nil if both are.
+func (a *Accounting) Merge(over *Accounting) *Accounting {
+	if a == nil && over == nil {
+		return nil
+	}
+	out := &Accounting{}
+	for _, src := range []*Accounting{a, over} {
+		if src == nil {
+			continue
+		}
+		if src.CostCenter != "" {
+			out.CostCenter = src.CostCenter
+		}
+		if src.Project != "" {
+			out.Project = src.Project
+		}
+		for k, v := range src.Labels {
+			if out.Labels == nil {
+				out.Labels = make(map[string]string)
+			}
+			out.Labels[k] = v
+		}
+	}
+	return out
+}
+
+// Action is a quorum-signed administrative operation on the group.
+type Action struct {
+	Op          string `json:"op"`
+	Sequence    uint64 `json:"sequence"` // Must be Document.Sequence+1
+	Reason      string `json:"reason,omitempty"`
+	MessageHash string `json:"message_hash"` // 32 bytes, the message the group signs
+	R           string `json:"R,omitempty"`  // Aggregated signature commitment
+	Z           string `json:"z,omitempty"`  // Aggregated signature scalar
+
+	// Participant and Standby name a failover: the participant whose
+	// share the standby takes over, and the standby's ID.
+	Participant int    `json:"participant,omitempty"`
+	Standby     string `json:"standby,omitempty"`
+}
+
+// Load reads a document from a JSON file.
+func Load(path string) (*Document, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var doc Document
+	if err := schema.Unmarshal(b, &doc, path); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &doc, nil
+}
+
+// Save writes the document as indented JSON.
+func (d *Document) Save(path string) error {
+	if d.Ciphersuite == "" {
+		d.Ciphersuite = frostcore.Suite.ID()
+	}
+	b, err := json.MarshalIndent(d, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(b, '\n'), 0o644)
+}
+
+// CheckActive returns ErrFrozen if new sessions must be refused.
+func (d *Document) CheckActive() error {
+	if d.Frozen {
+		return ErrFrozen
+	}
+	return nil
+}
+
+// NewAction prepares the next unsigned action. The returned MessageHash is
+// signed by t participants through the normal commit/sign/aggregate flow.
+func (d *Document) NewAction(op, reason string) (*Action, error) {
+	if op != OpFreeze && op != OpUnfreeze {
+		return nil, fmt.Errorf("unknown operation %q", op)
+	}
+	a := &Action{Op: op, Sequence: d.Sequence + 1, Reason: reason}
+	msg, err := d.actionMessage(a)
+	if err != nil {
+		return nil, err
+	}
+	a.MessageHash = hex.EncodeToString(msg)
+	return a, nil
+}
+
+// NewFailover prepares the next unsigned failover, handing participant's
+// share to the standby with the given ID.
+func (d *Document) NewFailover(participant int, standby, reason string) (*Action, error) {
+	a := &Action{Op: OpFailover, Sequence: d.Sequence + 1, Reason: reason, Participant: participant, Standby: standby}
+	if err := d.checkFailover(a); err != nil {
+		return nil, err
+	}
+	msg, err := d.actionMessage(a)
+	if err != nil {
+		return nil, err
+	}
+	a.MessageHash = hex.EncodeToString(msg)
+	return a, nil
+}
+
+func (d *Document) checkFailover(a *Action) error {
+	switch {
+	case a.Participant < 1 || a.Participant > d.Total:
+		return fmt.Errorf("participant %d is not in the group", a.Participant)
+	case a.Standby == "":
+		return errors.New("failover names no standby")
+	case d.Failovers[a.Participant] == a.Standby:
+		return fmt.Errorf("participant %d already failed over to standby %s", a.Participant, a.Standby)
+	}
+	return nil
+}
+
+// actionMessage computes
+// SHA-256(domain || group_key || len(op) || op || sequence || len(reason) ||
+// reason), followed for a failover by participant (2 bytes) || standby.
+// reason's length is 2 bytes, so no reason can pass for another reason
+// and a failover's participant.
+func (d *Document) actionMessage(a *Action) ([]byte, error) {
+	groupKey, err := hex.DecodeString(d.GroupKey)
+	if err != nil {
+		return nil, fmt.Errorf("group key: %w", err)
+	}
+	if len(a.Reason) > 0xFFFF {
+		return nil, errors.New("reason is longer than 65535 bytes")
+	}
+	h := sha256.New()
+	h.Write([]byte(actionDomain))
+	h.Write(groupKey)
+	h.Write([]byte{byte(len(a.Op))})
+	h.Write([]byte(a.Op))
+	h.Write(binary.BigEndian.AppendUint64(nil, a.Sequence))
+	h.Write(binary.BigEndian.AppendUint16(nil, uint16(len(a.Reason))))
+	h.Write([]byte(a.Reason))
+	if a.Op == OpFailover {
+		h.Write(binary.BigEndian.AppendUint16(nil, uint16(a.Participant)))
+		h.Write([]byte(a.Standby))
+	}
+	return h.Sum(nil), nil
+}
+
+// Apply verifies the group's signature on the action and updates the
+// document.
+func (d *Document) Apply(a *Action) error {
+	if a.Sequence != d.Sequence+1 {
+		return fmt.Errorf("action sequence %d, expected %d", a.Sequence, d.Sequence+1)
+	}
+	switch a.Op {
+	case OpFreeze:
+		if d.Frozen {
+			return errors.New("group is already frozen")
+		}
+	case OpUnfreeze:
+		if !d.Frozen {
+			return errors.New("group is not frozen")
+		}
+	case OpFailover:
+		if err := d.checkFailover(a); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown operation %q", a.Op)
+	}
+	if err := d.VerifyAction(a); err != nil {
+		return err
+	}
+
+	switch a.Op {
+	case OpFailover:
+		if d.Failovers == nil {
+			d.Failovers = make(map[int]string)
+		}
+		d.Failovers[a.Participant] = a.Standby
+	default:
+		d.Frozen = a.Op == OpFreeze
+	}
+	d.Sequence = a.Sequence
+	d.History = append(d.History, *a)
+	return nil
+}
+
+// VerifyAction checks that the action's message hash matches its contents
+// and that the group signed it, whether or not it can still be applied. A
+// standby verifies the failover that activates it this way, from the
+// document's history, so that editing the document alone cannot activate
+// it.
+func (d *Document) VerifyAction(a *Action) error {
+	msg, err := d.actionMessage(a)
+	if err != nil {
+		return err
+	}
+	if a.MessageHash != hex.EncodeToString(msg) {
+		return errors.New("action message hash does not match its contents")
+	}
+
+	groupKey, _ := hex.DecodeString(d.GroupKey)
+	r, err := hex.DecodeString(a.R)
+	if err != nil {
+		return fmt.Errorf("R: %w", err)
+	}
+	z, err := hex.DecodeString(a.Z)
+	if err != nil {
+		return fmt.Errorf("z: %w", err)
+	}
+	valid, err := frostcore.VerifyPurpose(d.Purpose, groupKey, msg, r, z)
+	if err != nil {
+		return err
+	}
+	if !valid {
+		return errors.New("action signature does not verify under the group key")
+	}
+	return nil
+}
+
+// Failover returns the latest failover of participant in the history,
+// after checking its signature; nil if there is none.
+func (d *Document) Failover(participant int) (*Action, error) {
+	for i := len(d.History) - 1; i >= 0; i-- {
+		a := &d.History[i]
+		if a.Op != OpFailover || a.Participant != participant {
+			continue
+		}
+		if err := d.VerifyAction(a); err != nil {
+			return nil, fmt.Errorf("failover at sequence %d: %w", a.Sequence, err)
+		}
+		return a, nil
+	}
+	return nil, nil
+}
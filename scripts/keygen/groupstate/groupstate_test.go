@@ -0,0 +1,114 @@
+package groupstate
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	"keygen/frostcore"
+)
+
+// signAction signs a's message hash with the group secret, as an
+// aggregated signature of the group would.
+func signAction(t *testing.T, d *Document, secret *big.Int, a *Action) {
+	t.Helper()
+	groupKey, _ := hex.DecodeString(d.GroupKey)
+	msg, err := hex.DecodeString(a.MessageHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	k, err := frostcore.RandomScalar(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := frostcore.BasePoint(k)
+	c := frostcore.PurposeChallenge(d.Purpose, r, groupKey, msg)
+	z := frostcore.PartialSig(k, big.NewInt(0), big.NewInt(0), secret, c, big.NewInt(1))
+	a.R, a.Z = hex.EncodeToString(r), hex.EncodeToString(frostcore.ScalarBytes(z))
+}
+
+func TestActionRoundTrip(t *testing.T) {
+	secret, err := frostcore.RandomScalar(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newDoc := func() *Document {
+		return &Document{GroupKey: hex.EncodeToString(frostcore.BasePoint(secret)), Threshold: 2, Total: 1000}
+	}
+
+	tests := []struct {
+		name    string
+		prepare func(d *Document) (*Action, error)
+		tamper  func(a *Action) // After signing; nil applies as signed
+		check   func(d *Document) bool
+	}{
+		{"freeze", func(d *Document) (*Action, error) { return d.NewAction(OpFreeze, "INC-57") }, nil,
+			func(d *Document) bool { return d.Frozen }},
+		{"failover", func(d *Document) (*Action, error) { return d.NewFailover(2, "7f3a9c01d2e4b5f6", "host lost") }, nil,
+			func(d *Document) bool { return d.Failovers[2] == "7f3a9c01d2e4b5f6" }},
+		{"reason edited", func(d *Document) (*Action, error) { return d.NewAction(OpFreeze, "INC-57") },
+			func(a *Action) { a.Reason = "INC-58" }, nil},
+		{"op edited", func(d *Document) (*Action, error) { return d.NewAction(OpFreeze, "") },
+			func(a *Action) { a.Op = OpFailover; a.Participant, a.Standby = 1, "x" }, nil},
+		{"standby edited", func(d *Document) (*Action, error) { return d.NewFailover(2, "7f3a9c01d2e4b5f6", "") },
+			func(a *Action) { a.Standby = "0000000000000000" }, nil},
+		{"participant edited", func(d *Document) (*Action, error) { return d.NewFailover(2, "7f3a9c01d2e4b5f6", "") },
+			func(a *Action) { a.Participant = 3 }, nil},
+		// Without the reason's length both encode as "r" 01 02 "st"
+		{"reason absorbs participant", func(d *Document) (*Action, error) { return d.NewFailover(0x0102, "st", "r") },
+			func(a *Action) { a.Reason, a.Participant, a.Standby = "r\x01", 0x0273, "t" }, nil},
+		{"signature from another key", func(d *Document) (*Action, error) { return d.NewAction(OpFreeze, "") },
+			func(a *Action) {
+				other := newDoc()
+				other.GroupKey = hex.EncodeToString(frostcore.BasePoint(big.NewInt(7)))
+				signAction(t, other, big.NewInt(7), a)
+			}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := newDoc()
+			a, err := tt.prepare(d)
+			if err != nil {
+				t.Fatal(err)
+			}
+			signAction(t, d, secret, a)
+			if tt.tamper != nil {
+				tt.tamper(a)
+			}
+
+			// Round-trip the action through JSON, as it travels
+			b, err := json.Marshal(a)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got Action
+			if err := json.Unmarshal(b, &got); err != nil {
+				t.Fatal(err)
+			}
+			err = d.Apply(&got)
+			if tt.tamper != nil {
+				if err == nil {
+					t.Fatal("Apply accepted a tampered action")
+				}
+				if d.Sequence != 0 || d.Frozen || len(d.History) != 0 {
+					t.Fatalf("a rejected action changed the document: %+v", d)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Apply: %v", err)
+			}
+			if !tt.check(d) || d.Sequence != 1 || len(d.History) != 1 {
+				t.Fatalf("document after Apply: %+v", d)
+			}
+			if err := d.VerifyAction(&d.History[0]); err != nil {
+				t.Fatalf("VerifyAction from history: %v", err)
+			}
+			if err := d.Apply(&got); err == nil {
+				t.Fatal("Apply accepted the same action twice")
+			}
+		})
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/hex"
+	"flag"
+
+	"keygen/frostcore"
+	"keygen/h2c"
+)
+
+type H2COutput struct {
+	Suite  string   `json:"suite,omitempty"` // For curve
+	DST    string   `json:"dst"`
+	Msg    string   `json:"msg"`         // Hex
+	U      []string `json:"u,omitempty"` // hash_to_field output, for curve
+	Point  string   `json:"point,omitempty"`
+	Scalar string   `json:"scalar,omitempty"`
+}
+
+const h2cUsage = "Usage: keygen h2c <curve|scalar> -dst tag [-text] <msg> | keygen h2c vectors"
+
+// runH2C implements the h2c subcommands:
+//
+//	h2c curve -dst tag <msg>    hash to a point of the prime subgroup
+//	h2c scalar -dst tag <msg>   hash to a scalar
+//	h2c vectors                 check and print the test vectors
+//
+// msg is hex, or text with -text.
+func runH2C(args []string) {
+	if len(args) < 1 {
+		fail(KindUsage, h2cUsage)
+	}
+	if args[0] == "vectors" {
+		if err := h2c.CheckVectors(); err != nil {
+			fail(KindCrypto, "Error: %v", err)
+		}
+		writeJSON(h2c.Vectors)
+		return
+	}
+	if args[0] != "curve" && args[0] != "scalar" {
+		fail(KindUsage, h2cUsage)
+	}
+
+	cmd := flag.NewFlagSet("h2c "+args[0], flag.ExitOnError)
+	dst := cmd.String("dst", "", "Domain separation tag (1-255 bytes), unique to the use")
+	text := cmd.Bool("text", false, "msg is text rather than hex")
+	stdioFlags(cmd)
+	cmd.Parse(args[1:])
+	if *dst == "" || cmd.NArg() != 1 {
+		fail(KindUsage, h2cUsage)
+	}
+	msg := []byte(cmd.Arg(0))
+	if !*text {
+		var err error
+		if msg, err = hex.DecodeString(cmd.Arg(0)); err != nil {
+			fail(KindInput, "Error: msg: %v", err)
+		}
+	}
+
+	out := H2COutput{DST: *dst, Msg: hex.EncodeToString(msg)}
+	if args[0] == "scalar" {
+		s, err := h2c.HashToScalar(msg, []byte(*dst))
+		if err != nil {
+			fail(KindUsage, "Error: %v", err)
+		}
+		out.Scalar = hex.EncodeToString(frostcore.ScalarBytes(s))
+		writeJSON(out)
+		return
+	}
+
+	u, err := h2c.HashToField(msg, []byte(*dst), 2, h2c.FieldModulus)
+	if err != nil {
+		fail(KindUsage, "Error: %v", err)
+	}
+	p, err := h2c.HashToCurve(msg, []byte(*dst))
+	if err != nil {
+		fail(KindUsage, "Error: %v", err)
+	}
+	out.Suite = h2c.Suite
+	for _, e := range u {
+		out.U = append(out.U, hex.EncodeToString(e.FillBytes(make([]byte, frostcore.ScalarSize))))
+	}
+	out.Point = hex.EncodeToString(p)
+	writeJSON(out)
+}
@@ -0,0 +1,152 @@
+package h2c
+
+import "math/big"
+
+// Twisted Edwards coefficients: a*x^2 + y^2 = 1 + d*x^2*y^2. Its Montgomery
+// form v^2 = u^3 + A*u^2 + u has A = 2(a+d)/(a-d) = 168698 and B = 1.
+var (
+	edwardsA   = big.NewInt(168700)
+	edwardsD   = big.NewInt(168696)
+	montgomery = big.NewInt(168698)
+)
+
+// elligatorZ is Z of the Elligator 2 map, a non-square in the base field.
+var elligatorZ = big.NewInt(5)
+
+// point is an affine twisted Edwards point.
+type point struct {
+	x, y *big.Int
+}
+
+func mod(x *big.Int) *big.Int {
+	return x.Mod(x, FieldModulus)
+}
+
+func inv(x *big.Int) *big.Int {
+	return new(big.Int).ModInverse(x, FieldModulus)
+}
+
+func isSquare(x *big.Int) bool {
+	return big.Jacobi(x, FieldModulus) >= 0
+}
+
+// mapToCurve is map_to_curve_elligator2 of RFC 9380 section 6.7.1 followed
+// by the rational map to the twisted Edwards curve (appendix D.1).
+func mapToCurve(u *big.Int) point {
+	p := FieldModulus
+
+	// x1 = -A / (1 + Z*u^2), or -A if the denominator is 0
+	den := new(big.Int).Mul(u, u)
+	den.Mul(den, elligatorZ).Add(den, big.NewInt(1))
+	mod(den)
+	x1 := new(big.Int).Neg(montgomery)
+	if den.Sign() != 0 {
+		x1.Mul(x1, inv(den))
+	}
+	mod(x1)
+	// x2 = -x1 - A
+	x2 := new(big.Int).Neg(x1)
+	mod(x2.Sub(x2, montgomery))
+
+	s, t := x2, new(big.Int)
+	if gx1 := montgomeryRHS(x1); isSquare(gx1) {
+		s = x1
+		t.ModSqrt(gx1, p)
+		if t.Bit(0) == 0 { // sgn0(t) == 1
+			t.Sub(p, t)
+		}
+	} else {
+		t.ModSqrt(montgomeryRHS(x2), p)
+		if t.Bit(0) == 1 { // sgn0(t) == 0
+			t.Sub(p, t)
+		}
+	}
+	mod(t)
+
+	// (x, y) = (s/t, (s-1)/(s+1)); the exceptional cases map to the identity
+	sPlus1 := mod(new(big.Int).Add(s, big.NewInt(1)))
+	if t.Sign() == 0 || sPlus1.Sign() == 0 {
+		return identity()
+	}
+	x := mod(new(big.Int).Mul(s, inv(t)))
+	y := new(big.Int).Sub(s, big.NewInt(1))
+	mod(y.Mul(y, inv(sPlus1)))
+	return point{x, y}
+}
+
+// montgomeryRHS is u^3 + A*u^2 + u.
+func montgomeryRHS(u *big.Int) *big.Int {
+	r := new(big.Int).Add(u, montgomery)
+	r.Mul(r, u).Add(r, big.NewInt(1))
+	return mod(r.Mul(r, u))
+}
+
+func identity() point {
+	return point{new(big.Int), big.NewInt(1)}
+}
+
+// add is the complete twisted Edwards addition law.
+func (p point) add(q point) point {
+	x1y2 := new(big.Int).Mul(p.x, q.y)
+	y1x2 := new(big.Int).Mul(p.y, q.x)
+	y1y2 := new(big.Int).Mul(p.y, q.y)
+	x1x2 := new(big.Int).Mul(p.x, q.x)
+	dxy := new(big.Int).Mul(x1x2, y1y2)
+	mod(dxy.Mul(dxy, edwardsD))
+
+	x := x1y2.Add(x1y2, y1x2)
+	x.Mul(x, inv(mod(new(big.Int).Add(big.NewInt(1), dxy))))
+	y := y1y2.Sub(y1y2, x1x2.Mul(x1x2, edwardsA))
+	y.Mul(y, inv(mod(new(big.Int).Sub(big.NewInt(1), dxy))))
+	return point{mod(x), mod(y)}
+}
+
+// clearCofactor multiplies by the cofactor 8.
+func (p point) clearCofactor() point {
+	for range 3 {
+		p = p.add(p)
+	}
+	return p
+}
+
+// mul computes k*p.
+func (p point) mul(k *big.Int) point {
+	r := identity()
+	for i := k.BitLen() - 1; i >= 0; i-- {
+		r = r.add(r)
+		if k.Bit(i) == 1 {
+			r = r.add(p)
+		}
+	}
+	return r
+}
+
+// onCurve reports whether a*x^2 + y^2 = 1 + d*x^2*y^2.
+func (p point) onCurve() bool {
+	x2 := new(big.Int).Mul(p.x, p.x)
+	y2 := new(big.Int).Mul(p.y, p.y)
+	lhs := new(big.Int).Mul(edwardsA, x2)
+	lhs.Add(lhs, y2)
+	rhs := new(big.Int).Mul(edwardsD, x2)
+	rhs.Mul(rhs, y2).Add(rhs, big.NewInt(1))
+	return mod(lhs).Cmp(mod(rhs)) == 0
+}
+
+func (p point) isIdentity() bool {
+	return p.x.Sign() == 0 && p.y.Cmp(big.NewInt(1)) == 0
+}
+
+// bytes compresses p the way fy and gnark-crypto do: y little-endian with
+// the top bit of the last byte set when x is the lexicographically larger
+// root.
+func (p point) bytes() []byte {
+	out := make([]byte, 32)
+	p.y.FillBytes(out)
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
+	}
+	if p.x.Cmp(new(big.Int).Rsh(FieldModulus, 1)) > 0 {
+		out[31] |= 0x80
+	}
+	return out
+}
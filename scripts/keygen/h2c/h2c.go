@@ -0,0 +1,149 @@
+// Package h2c hashes byte strings to Baby Jubjub scalars and points, following
+// RFC 9380 with BLAKE2b-512 as the hash: expand_message_xmd, hash_to_field,
+// and hash_to_curve with Elligator 2 on the curve's Montgomery form (suite
+// BJJ_XMD:BLAKE2b_ELL2_RO_). It works on math/big alone, so its output can
+// be reproduced by any implementation from the test vectors in Vectors.
+//
+// Every use takes its own domain separation tag (DST), so the same input
+// hashed for two purposes gives unrelated values. Inputs made of several
+// fields are joined with Context, which length-prefixes them, rather than
+// concatenated.
+//
+// The FROST hashes H1 and H2 are fixed by fy and the Ledger app and do not
+// go through this package's hash_to_field; Blake2bScalar is their form.
+package h2c
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+// Suite is the RFC 9380 suite ID of HashToCurve.
+const Suite = "BJJ_XMD:BLAKE2b_ELL2_RO_"
+
+// Field sizes
+var (
+	// FieldModulus is the Baby Jubjub base field (the BN254 scalar field).
+	FieldModulus, _ = new(big.Int).SetString("21888242871839275222246405745257275088548364400416034343698204186575808495617", 10)
+
+	// Order is the order of the Baby Jubjub prime subgroup.
+	Order, _ = new(big.Int).SetString("2736030358979909402780800718157159386076813972158567259200215660948447373041", 10)
+)
+
+// expandLen is L of hash_to_field, ceil((ceil(log2(p)) + k) / 8) with
+// k = 128, for both the base field and the scalar field.
+const expandLen = 48
+
+// BLAKE2b-512 block and digest sizes, s_in_bytes and b_in_bytes of
+// expand_message_xmd
+const (
+	blockSize  = 128
+	digestSize = blake2b.Size
+)
+
+// ExpandMessageXMD is expand_message_xmd of RFC 9380 section 5.3.1 with
+// BLAKE2b-512. It returns n uniform bytes.
+func ExpandMessageXMD(msg, dst []byte, n int) ([]byte, error) {
+	ell := (n + digestSize - 1) / digestSize
+	if ell > 255 || n > 65535 {
+		return nil, fmt.Errorf("h2c: cannot expand to %d bytes", n)
+	}
+	if len(dst) == 0 || len(dst) > 255 {
+		return nil, errors.New("h2c: DST must be 1 to 255 bytes")
+	}
+	dstPrime := append(append([]byte(nil), dst...), byte(len(dst)))
+
+	h, _ := blake2b.New512(nil)
+	h.Write(make([]byte, blockSize))
+	h.Write(msg)
+	h.Write([]byte{byte(n >> 8), byte(n), 0})
+	h.Write(dstPrime)
+	b0 := h.Sum(nil)
+
+	out := make([]byte, 0, ell*digestSize)
+	prev := make([]byte, digestSize) // b_0 XOR b_0 for b_1
+	for i := 1; i <= ell; i++ {
+		for j := range prev {
+			prev[j] ^= b0[j]
+		}
+		h.Reset()
+		h.Write(prev)
+		h.Write([]byte{byte(i)})
+		h.Write(dstPrime)
+		prev = h.Sum(nil)
+		out = append(out, prev...)
+	}
+	return out[:n], nil
+}
+
+// HashToField is hash_to_field of RFC 9380 section 5.2: count elements of
+// the field of the given modulus (FieldModulus or Order).
+func HashToField(msg, dst []byte, count int, modulus *big.Int) ([]*big.Int, error) {
+	uniform, err := ExpandMessageXMD(msg, dst, count*expandLen)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]*big.Int, count)
+	for i := range out {
+		e := new(big.Int).SetBytes(uniform[i*expandLen : (i+1)*expandLen])
+		out[i] = e.Mod(e, modulus)
+	}
+	return out, nil
+}
+
+// HashToScalar hashes msg to a scalar mod Order, for tweaks, derived
+// identifiers and other scalars that must be unpredictable.
+func HashToScalar(msg, dst []byte) (*big.Int, error) {
+	s, err := HashToField(msg, dst, 1, Order)
+	if err != nil {
+		return nil, err
+	}
+	return s[0], nil
+}
+
+// HashToCurve hashes msg to a point of the prime subgroup, compressed. No
+// one knows its discrete logarithm to any other point.
+func HashToCurve(msg, dst []byte) ([]byte, error) {
+	u, err := HashToField(msg, dst, 2, FieldModulus)
+	if err != nil {
+		return nil, err
+	}
+	q0 := mapToCurve(u[0])
+	q1 := mapToCurve(u[1])
+	return q0.add(q1).clearCofactor().bytes(), nil
+}
+
+// Blake2bScalar computes Blake2b-512(prefix || tag || parts...), interprets
+// the digest as little-endian and reduces it mod Order: fy's Blake2bHasher,
+// which the FROST binding factor and challenge must use to match the app.
+func Blake2bScalar(prefix, tag string, parts ...[]byte) *big.Int {
+	h, _ := blake2b.New512(nil)
+	h.Write([]byte(prefix))
+	h.Write([]byte(tag))
+	for _, p := range parts {
+		h.Write(p)
+	}
+	digest := h.Sum(nil)
+
+	reversed := make([]byte, len(digest))
+	for i := range digest {
+		reversed[i] = digest[len(digest)-1-i]
+	}
+	return new(big.Int).Mod(new(big.Int).SetBytes(reversed), Order)
+}
+
+// Context joins the fields a value is bound to, each prefixed with its
+// length as 4 big-endian bytes, so that no two lists of fields give the same
+// bytes.
+func Context(parts ...[]byte) []byte {
+	var out []byte
+	for _, p := range parts {
+		out = binary.BigEndian.AppendUint32(out, uint32(len(p)))
+		out = append(out, p...)
+	}
+	return out
+}
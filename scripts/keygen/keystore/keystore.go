@@ -0,0 +1,190 @@
+// Package keystore encrypts key-share files under a passphrase: Argon2id
+// derives an AES-256-GCM key, and the share's public fields are bound as
+// associated data so they cannot be swapped between files.
+package keystore
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// Version is the file format version.
+const Version = 1
+
+// Argon2id parameters for new files (RFC 9106, second recommended option).
+const (
+	argonTime    = 3
+	argonMemory  = 64 * 1024 // KiB
+	argonThreads = 4
+	keySize      = 32
+	saltSize     = 16
+)
+
+// ErrPassphrase is returned when a file does not decrypt.
+var ErrPassphrase = errors.New("keystore: wrong passphrase or corrupted file")
+
+// ErrStandby is returned by Open for a standby copy, which keygen only
+// opens with OpenStandby once a failover has activated it.
+var ErrStandby = errors.New("keystore: standby copy of a share; keygen opens it only after a failover activates it")
+
+// File is an encrypted key share. Participant, GroupKey, PublicShare and
+// Purpose are readable without the passphrase.
+type File struct {
+	Version     int    `json:"version"`
+	Participant int    `json:"participant"`
+	GroupKey    string `json:"group_key"`
+	PublicShare string `json:"public_share"`
+	Purpose     string `json:"purpose,omitempty"` // Purpose tag the share was provisioned for
+	Standby     string `json:"standby,omitempty"` // For a standby copy, the standby's ID
+	KDF         KDF    `json:"kdf"`
+	Cipher      string `json:"cipher"`
+	Nonce       string `json:"nonce"`
+	Ciphertext  string `json:"ciphertext"`
+}
+
+// KDF records the key derivation parameters.
+type KDF struct {
+	Name    string `json:"name"`
+	Salt    string `json:"salt"`
+	Time    uint32 `json:"time"`
+	Memory  uint32 `json:"memory"` // KiB
+	Threads uint8  `json:"threads"`
+}
+
+// IsEncrypted reports whether data is an encrypted key-share file.
+func IsEncrypted(data []byte) bool {
+	var probe struct {
+		Ciphertext *string `json:"ciphertext"`
+		KDF        *KDF    `json:"kdf"`
+	}
+	return json.Unmarshal(data, &probe) == nil && probe.Ciphertext != nil && probe.KDF != nil
+}
+
+// Seal encrypts plaintext, a participant's share, under passphrase.
+func Seal(plaintext []byte, participant int, groupKey, publicShare, purpose string, passphrase []byte) (*File, error) {
+	return seal(plaintext, &File{Participant: participant, GroupKey: groupKey, PublicShare: publicShare, Purpose: purpose}, passphrase)
+}
+
+// SealStandby encrypts plaintext, a participant's share, as a copy for the
+// standby signer with the given ID, under the standby's passphrase. The ID
+// is bound to the ciphertext, so a failover to one standby cannot activate
+// another's copy.
+//
+// The failover is a policy gate, not a cryptographic one: the passphrase
+// alone decrypts the copy, so its holder can read the share at any time
+// without keygen. Give copies only to standbys trusted with the share.
+func SealStandby(plaintext []byte, participant int, groupKey, publicShare, purpose, standby string, passphrase []byte) (*File, error) {
+	if standby == "" {
+		return nil, errors.New("keystore: empty standby ID")
+	}
+	return seal(plaintext, &File{Participant: participant, GroupKey: groupKey, PublicShare: publicShare, Purpose: purpose, Standby: standby}, passphrase)
+}
+
+func seal(plaintext []byte, f *File, passphrase []byte) (*File, error) {
+	if len(passphrase) == 0 {
+		return nil, errors.New("keystore: empty passphrase")
+	}
+	salt := make([]byte, saltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	f.Version = Version
+	f.KDF = KDF{
+		Name:    "argon2id",
+		Salt:    hex.EncodeToString(salt),
+		Time:    argonTime,
+		Memory:  argonMemory,
+		Threads: argonThreads,
+	}
+	f.Cipher = "aes-256-gcm"
+	aead, err := f.aead(passphrase)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	f.Nonce = hex.EncodeToString(nonce)
+	f.Ciphertext = hex.EncodeToString(aead.Seal(nil, nonce, plaintext, f.associatedData()))
+	return f, nil
+}
+
+// Open decrypts the file. It refuses standby copies.
+func (f *File) Open(passphrase []byte) ([]byte, error) {
+	if f.Standby != "" {
+		return nil, ErrStandby
+	}
+	return f.open(passphrase)
+}
+
+// OpenStandby decrypts a standby copy. Callers check first that a failover
+// signed by the group activated f.Standby for f.Participant; nothing here
+// enforces it (see SealStandby).
+func (f *File) OpenStandby(passphrase []byte) ([]byte, error) {
+	if f.Standby == "" {
+		return nil, errors.New("keystore: not a standby copy")
+	}
+	return f.open(passphrase)
+}
+
+func (f *File) open(passphrase []byte) ([]byte, error) {
+	if f.Version != Version {
+		return nil, fmt.Errorf("keystore: unsupported version %d", f.Version)
+	}
+	aead, err := f.aead(passphrase)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err1 := hex.DecodeString(f.Nonce)
+	ciphertext, err2 := hex.DecodeString(f.Ciphertext)
+	if err1 != nil || err2 != nil || len(nonce) != aead.NonceSize() {
+		return nil, errors.New("keystore: malformed nonce or ciphertext")
+	}
+	plaintext, err := aead.Open(nil, nonce, ciphertext, f.associatedData())
+	if err != nil {
+		return nil, ErrPassphrase
+	}
+	return plaintext, nil
+}
+
+func (f *File) aead(passphrase []byte) (cipher.AEAD, error) {
+	if f.KDF.Name != "argon2id" || f.Cipher != "aes-256-gcm" {
+		return nil, fmt.Errorf("keystore: unsupported kdf %q or cipher %q", f.KDF.Name, f.Cipher)
+	}
+	salt, err := hex.DecodeString(f.KDF.Salt)
+	if err != nil || len(salt) < saltSize {
+		return nil, errors.New("keystore: malformed salt")
+	}
+	// Bound the parameters so a crafted file cannot exhaust memory
+	if f.KDF.Time == 0 || f.KDF.Time > 16 || f.KDF.Memory < 8*1024 || f.KDF.Memory > 4*1024*1024 || f.KDF.Threads == 0 {
+		return nil, errors.New("keystore: kdf parameters out of range")
+	}
+	key := argon2.IDKey(passphrase, salt, f.KDF.Time, f.KDF.Memory, f.KDF.Threads, keySize)
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// associatedData binds the readable fields to the ciphertext. The purpose
+// and standby ID are only appended when set, so files written before they
+// existed still open.
+func (f *File) associatedData() []byte {
+	ad := fmt.Appendf(nil, "fy-ledger/keystore/v%d\n%d\n%s\n%s\n", f.Version, f.Participant, f.GroupKey, f.PublicShare)
+	if f.Purpose != "" {
+		ad = fmt.Appendf(ad, "purpose=%s\n", f.Purpose)
+	}
+	if f.Standby != "" {
+		ad = fmt.Appendf(ad, "standby=%s\n", f.Standby)
+	}
+	return ad
+}
@@ -0,0 +1,93 @@
+package keystore
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestSealOpen(t *testing.T) {
+	share := bytes.Repeat([]byte{0x42}, 32)
+	passphrase := []byte("correct horse battery staple")
+	sealed, err := Seal(share, 2, strings.Repeat("ab", 32), strings.Repeat("cd", 32), "payments", passphrase)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		passphrase []byte
+		tamper     func(*File)
+		want       error // nil: opens to share
+	}{
+		{"as sealed", passphrase, func(*File) {}, nil},
+		{"wrong passphrase", []byte("incorrect horse"), func(*File) {}, ErrPassphrase},
+		{"participant", passphrase, func(f *File) { f.Participant = 3 }, ErrPassphrase},
+		{"group key", passphrase, func(f *File) { f.GroupKey = strings.Repeat("ef", 32) }, ErrPassphrase},
+		{"public share", passphrase, func(f *File) { f.PublicShare = strings.Repeat("ef", 32) }, ErrPassphrase},
+		{"purpose", passphrase, func(f *File) { f.Purpose = "custody" }, ErrPassphrase},
+		{"purpose dropped", passphrase, func(f *File) { f.Purpose = "" }, ErrPassphrase},
+		{"salt", passphrase, func(f *File) { f.KDF.Salt = strings.Repeat("00", saltSize) }, ErrPassphrase},
+		{"kdf time", passphrase, func(f *File) { f.KDF.Time++ }, ErrPassphrase},
+		{"ciphertext", passphrase, func(f *File) { f.Ciphertext = "00" + f.Ciphertext[2:] }, ErrPassphrase},
+		{"made a standby copy", passphrase, func(f *File) { f.Standby = "7f3a9c01d2e4b5f6" }, ErrStandby},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Round-trip through JSON, as files are read
+			b, err := json.Marshal(sealed)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var f File
+			if err := json.Unmarshal(b, &f); err != nil {
+				t.Fatal(err)
+			}
+			tt.tamper(&f)
+			got, err := f.Open(tt.passphrase)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("Open: got error %v, want %v", err, tt.want)
+			}
+			if tt.want == nil && !bytes.Equal(got, share) {
+				t.Fatalf("Open: got %x, want %x", got, share)
+			}
+		})
+	}
+}
+
+func TestSealStandby(t *testing.T) {
+	share := bytes.Repeat([]byte{0x17}, 32)
+	passphrase := []byte("standby passphrase")
+	sealed, err := SealStandby(share, 2, strings.Repeat("ab", 32), strings.Repeat("cd", 32), "", "7f3a9c01d2e4b5f6", passphrase)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		tamper func(*File)
+		want   error
+	}{
+		{"as sealed", func(*File) {}, nil},
+		{"other standby", func(f *File) { f.Standby = "0000000000000000" }, ErrPassphrase},
+		{"other participant", func(f *File) { f.Participant = 1 }, ErrPassphrase},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := *sealed
+			tt.tamper(&f)
+			if _, err := f.Open(passphrase); !errors.Is(err, ErrStandby) {
+				t.Fatalf("Open: got error %v, want %v", err, ErrStandby)
+			}
+			got, err := f.OpenStandby(passphrase)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("OpenStandby: got error %v, want %v", err, tt.want)
+			}
+			if tt.want == nil && !bytes.Equal(got, share) {
+				t.Fatalf("OpenStandby: got %x, want %x", got, share)
+			}
+		})
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"io"
+	"log/slog"
+	"os"
+	"time"
+
+	"keygen/apdu"
+	"keygen/frostcore"
+)
+
+// logOptions are set by the global logging flags and their environment
+// variables.
+var logOptions struct {
+	level string // debug, info, warn or error; "" for the default
+	json  bool   // JSON records instead of key=value text
+	file  string // Append to this file instead of stderr
+}
+
+// logger is the command's logger, installed by setupLogging. It discards
+// records until then.
+var logger = slog.New(slog.DiscardHandler)
+
+// started is when the command started, for the elapsed time of its records.
+var started = time.Now()
+
+// setupLogging installs logger, also as the default slog logger. Logging is
+// off unless one of --log-level, --log-json or --log-file is given; the
+// latter two log at info unless a level is given too. Records never carry
+// secret scalars: APDU fields marked SECRET are redacted, and inputs are
+// logged by ID and public value only.
+func setupLogging() {
+	o := logOptions
+	if o.level == "" && !o.json && o.file == "" {
+		return
+	}
+
+	level := slog.LevelInfo
+	if o.level != "" {
+		if err := level.UnmarshalText([]byte(o.level)); err != nil {
+			fail(KindUsage, "Error: --log-level: %v (want debug, info, warn or error)", err)
+		}
+	}
+
+	var w io.Writer = os.Stderr
+	if o.file != "" {
+		f, err := os.OpenFile(o.file, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+		if err != nil {
+			fail(KindFailure, "Error opening log file: %v", err)
+		}
+		w = f // Closed at exit; each record is a single write
+	}
+
+	opts := &slog.HandlerOptions{Level: level}
+	var h slog.Handler = slog.NewTextHandler(w, opts)
+	if o.json {
+		h = slog.NewJSONHandler(w, opts)
+	}
+	logger = slog.New(h)
+	if len(os.Args) > 1 {
+		logger = logger.With("command", os.Args[1])
+	}
+	slog.SetDefault(logger)
+}
+
+// logTransport logs the exchanges with a device (apdu.Logged), and records
+// them in the transcript of --transcript.
+func logTransport(t apdu.Transport) apdu.Transport {
+	if ceremonyLog != nil {
+		t = transcriptTransport{t}
+	}
+	return apdu.Logged(t, logger)
+}
+
+// logStep logs the completion of a step of a command with its duration
+// and the cryptographic operations it performed (frostcore.Ops):
+//
+//	defer logStep("finalize")()
+func logStep(name string, args ...any) func() {
+	start, ops := time.Now(), frostcore.ReadOps()
+	return func() {
+		logger.Info(name, append(args, "elapsed", time.Since(start), "ops", frostcore.ReadOps().Sub(ops))...)
+	}
+}
@@ -4,64 +4,103 @@
 package main
 
 import (
+	"bytes"
+	"cmp"
 	"crypto/rand"
 	"encoding/hex"
-	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
+	"math/big"
 	"os"
+	"slices"
+	"strings"
+	"time"
 
-	"github.com/f3rmion/fy/bjj"
 	"github.com/f3rmion/fy/frost"
+	"github.com/f3rmion/fy/group"
+
+	"keygen/drbg"
+	"keygen/frostcore"
+	"keygen/h2c"
+	"keygen/noncestore"
+	"keygen/schema"
+	"keygen/secret"
+	"keygen/signsession"
+	"keygen/speculos"
+	"keygen/submit"
+	"keygen/tsa"
+	"keygen/workspace"
 )
 
 type KeyShareOutput struct {
-	Participant int    `json:"participant"`
-	GroupKey    string `json:"group_key"`    // 32 bytes compressed
-	ID          string `json:"id"`           // 32 bytes (id in first 2 bytes, rest zero)
-	SecretShare string `json:"secret_share"` // 32 bytes
-	PublicShare string `json:"public_share"` // 32 bytes compressed (for verification)
+	Participant int            `json:"participant"`
+	GroupKey    string         `json:"group_key"`              // 32 bytes compressed
+	ID          string         `json:"id"`                     // 32 bytes (id in first 2 bytes, rest zero)
+	SecretShare *secret.Scalar `json:"secret_share,omitempty"` // Omitted when written to encrypted files
+	PublicShare string         `json:"public_share"`           // 32 bytes compressed (for verification)
+	Purpose     string         `json:"purpose,omitempty"`      // Purpose tag the share was provisioned for
+	Threshold   int            `json:"threshold,omitempty"`    // The group's t, checked by sign; 0 in older files
+	Total       int            `json:"total,omitempty"`        // The group's n
 }
 
 type KeyGenOutput struct {
 	Threshold int              `json:"threshold"`
 	Total     int              `json:"total"`
+	Seed      string           `json:"seed,omitempty"` // Set for deterministic fixtures
 	Shares    []KeyShareOutput `json:"shares"`
 }
 
 type CommitmentOutput struct {
-	Participant   int    `json:"participant"`
-	HidingNonce   string `json:"hiding_nonce"`   // 32 bytes (secret)
-	BindingNonce  string `json:"binding_nonce"`  // 32 bytes (secret)
-	HidingCommit  string `json:"hiding_commit"`  // 32 bytes
-	BindingCommit string `json:"binding_commit"` // 32 bytes
+	Participant   int            `json:"participant"`
+	HidingNonce   *secret.Scalar `json:"hiding_nonce,omitempty"`  // Omitted when written to a nonce file
+	BindingNonce  *secret.Scalar `json:"binding_nonce,omitempty"` // Omitted when written to a nonce file
+	HidingCommit  string         `json:"hiding_commit"`           // 32 bytes
+	BindingCommit string         `json:"binding_commit"`          // 32 bytes
+	Proof         string         `json:"proof,omitempty"`         // Nonce proof of knowledge (frostcore.NonceProof), with -session
 }
 
 type SignInput struct {
-	MessageHash  string             `json:"message_hash"` // 32 bytes
-	GroupKey     string             `json:"group_key"`    // 32 bytes
-	Participants []ParticipantInput `json:"participants"` // All signing participants
-	SignerIndex  int                `json:"signer_index"` // Index of this signer in participants
+	MessageHash   string             `json:"message_hash,omitempty"`   // 32 bytes
+	MessageFields []string           `json:"message_fields,omitempty"` // With -hash poseidon, what message_hash is the hash of
+	GroupKey      string             `json:"group_key"`                // 32 bytes
+	Participants  []ParticipantInput `json:"participants"`             // All signing participants
+	SignerIndex   int                `json:"signer_index"`             // Index of this signer in participants
+	Purpose       string             `json:"purpose,omitempty"`        // Purpose tag of the signer's share
+	Threshold     int                `json:"threshold,omitempty"`      // The group's t, if the share file, session or group state does not say
+	Total         int                `json:"total,omitempty"`          // The group's n
 }
 
 type ParticipantInput struct {
-	ID            int    `json:"id"`
-	SecretShare   string `json:"secret_share,omitempty"`   // Only for local signer
-	HidingNonce   string `json:"hiding_nonce,omitempty"`   // Only for local signer
-	BindingNonce  string `json:"binding_nonce,omitempty"`  // Only for local signer
-	HidingCommit  string `json:"hiding_commit"`
-	BindingCommit string `json:"binding_commit"`
+	ID            int            `json:"id"`
+	SecretShare   *secret.Scalar `json:"secret_share,omitempty" deprecated:"use sign -share"`   // Only for local signer
+	HidingNonce   *secret.Scalar `json:"hiding_nonce,omitempty" deprecated:"use sign -nonces"`  // Only for local signer
+	BindingNonce  *secret.Scalar `json:"binding_nonce,omitempty" deprecated:"use sign -nonces"` // Only for local signer
+	HidingCommit  string         `json:"hiding_commit"`
+	BindingCommit string         `json:"binding_commit"`
 }
 
 type SignOutput struct {
-	PartialSig string `json:"partial_sig"` // 32 bytes
+	PartialSig     string `json:"partial_sig"`     // 32 bytes
+	CommitmentList string `json:"commitment_list"` // Canonical INJECT_COMMITMENTS payload the signature was made over
 }
 
 type AggregateInput struct {
-	GroupKey     string             `json:"group_key"`
-	MessageHash  string             `json:"message_hash"`
-	Participants []ParticipantInput `json:"participants"`
-	PartialSigs  []PartialSigInput  `json:"partial_sigs"`
+	GroupKey      string             `json:"group_key"`
+	MessageHash   string             `json:"message_hash,omitempty"`
+	MessageFields []string           `json:"message_fields,omitempty"` // With -hash poseidon, what message_hash is the hash of
+	Participants  []ParticipantInput `json:"participants"`
+	PartialSigs   []PartialSigInput  `json:"partial_sigs"`
+	PublicShares  []PublicShareInput `json:"public_shares,omitempty"` // To identify invalid partial signatures
+	Purpose       string             `json:"purpose,omitempty"`       // Purpose tag the shares signed for
+	Threshold     int                `json:"threshold,omitempty"`     // The group's t, if the session or group state does not say
+	Total         int                `json:"total,omitempty"`         // The group's n
+}
+
+type PublicShareInput struct {
+	ID          int    `json:"id"`
+	PublicShare string `json:"public_share"`
 }
 
 type PartialSigInput struct {
@@ -73,57 +112,532 @@ type AggregateOutput struct {
 	R     string `json:"R"`     // 32 bytes (group commitment)
 	Z     string `json:"z"`     // 32 bytes (aggregated signature)
 	Valid bool   `json:"valid"` // Verification result
+
+	// Purpose tag the signature was made and verified for, if any
+	Purpose string `json:"purpose,omitempty"`
+
+	// Why the signature is invalid (see frostcore.Explain)
+	Reason frostcore.Reason `json:"reason,omitempty"`
+	Detail string           `json:"detail,omitempty"`
+
+	// Participants whose partial signature failed share verification; only
+	// checked when the signature is invalid and public shares were given
+	InvalidShares []int `json:"invalid_shares,omitempty"`
+
+	// Set with -tsa: the signed statement and an RFC 3161 token over it
+	// (see signatureImprint)
+	GroupKey    string     `json:"group_key,omitempty"`
+	MessageHash string     `json:"message_hash,omitempty"`
+	Timestamp   *tsa.Token `json:"timestamp,omitempty"`
+
+	// Set by provenance attach: how the signature was produced, signed by
+	// the same group
+	Provenance *ProvenanceEnvelope `json:"provenance,omitempty"`
+
+	// Set with -submit: the signature's delivery to each target
+	Deliveries []submit.Delivery `json:"deliveries,omitempty"`
 }
 
+// Environment variables
+const (
+	envStrict     = "FY_LEDGER_STRICT"      // Strict JSON input checking, like --strict
+	envLockMemory = "FY_LEDGER_LOCK_MEMORY" // Secrets in locked memory, like --lock-memory
+	envJSONErrors = "FY_LEDGER_JSON_ERRORS" // Errors as JSON objects, like --json-errors
+	envLogLevel   = "FY_LEDGER_LOG_LEVEL"   // Like --log-level
+	envLogJSON    = "FY_LEDGER_LOG_JSON"    // Like --log-json
+	envLogFile    = "FY_LEDGER_LOG_FILE"    // Like --log-file
+	envTranscript = "FY_LEDGER_TRANSCRIPT"  // Like --transcript
+	envSuite      = "FY_LEDGER_CIPHERSUITE" // Like --ciphersuite
+	envHasher     = "FY_LEDGER_HASHER"      // Like --hasher
+)
+
 func main() {
+	os.Args = globalFlags(os.Args)
+	setupCiphersuite()
+	setupLogging()
+	setupTranscript()
+	defer secret.DestroyAll()
+	args, ctxName, ws := loadContext(os.Args)
+	os.Args = args
+	ceremony = loadCeremony()
+	ceremony.Apply(ws)
+
 	// Subcommands
 	keygenCmd := flag.NewFlagSet("keygen", flag.ExitOnError)
-	threshold := keygenCmd.Int("t", 2, "Threshold (minimum signers)")
-	total := keygenCmd.Int("n", 3, "Total participants")
+	threshold := keygenCmd.Int("t", ceremony.ThresholdOr(2), "Threshold (minimum signers)")
+	total := keygenCmd.Int("n", ceremony.TotalOr(3), "Total participants")
+	seed := keygenCmd.String("seed", "", "Derive all randomness from this hex seed (reproducible fixtures only)")
+	keygenOut := shareOutputFlags(keygenCmd, ceremony.SharesOr("shares"))
+
+	recoverCmd := flag.NewFlagSet("recover", flag.ExitOnError)
+	recoverThreshold := recoverCmd.Int("t", ceremony.Threshold, "Threshold; if set, check that every t-subset of the shares gives the same key")
+	recoverKeyFile := recoverCmd.String("key-file", "recovered-key.json", "Write the recovered key to this new file (mode 0600)")
+	recoverInsecureStdout := recoverCmd.Bool("insecure-stdout", false, "Print the recovered key to stdout instead of writing -key-file")
+
+	reshareInitCmd := flag.NewFlagSet("reshare-init", flag.ExitOnError)
+	reshareState := reshareInitCmd.String("state", ceremony.GroupStateOr("group-state.json"), "Group-state document of the group to reshare")
+	reshareSigners := reshareInitCmd.String("signers", ceremony.SignerList(), "Old participants dealing their shares (comma-separated, at least t)")
+	reshareThreshold := reshareInitCmd.Int("t", 2, "New threshold")
+	reshareTotal := reshareInitCmd.Int("n", 3, "New total participants")
+	reshareRecipients := reshareInitCmd.String("recipients", "", "New participants' recipient keys from recipient-key, comma-separated in participant order (required)")
+
+	reshareContributeCmd := flag.NewFlagSet("reshare-contribute", flag.ExitOnError)
+	contributeSession := reshareContributeCmd.String("session", "reshare-session.json", "Session from reshare-init")
+	contributeShare := reshareContributeCmd.String("share", "", "Own key share (a share or a keygen output)")
+	contributeID := reshareContributeCmd.Int("id", 0, "Participant to use if -share holds several")
+	contributeSeed := reshareContributeCmd.String("seed", "", "Derive the polynomial from this hex seed (test fixtures only)")
+	contributeOut := reshareContributeCmd.String("out-dir", ".", "Write each new participant's sealed sub-share to reshare-<id>-to-<j>.json here")
+
+	reshareFinalizeCmd := flag.NewFlagSet("reshare-finalize", flag.ExitOnError)
+	finalizeSession := reshareFinalizeCmd.String("session", "reshare-session.json", "Session from reshare-init")
+	finalizeID := reshareFinalizeCmd.Int("id", 0, "New participant whose share to compute (required)")
+	finalizeKey := reshareFinalizeCmd.String("key", "", "The participant's recipient key from recipient-key (required)")
+	finalizeVerifyCodes := reshareFinalizeCmd.Bool("verify-codes", false, "Confirm the code words read by each old signer before computing the share")
+	finalizeLedger := reshareFinalizeCmd.Bool("ledger", false, "The participant is a Ledger: write participant-<id>.apdu to -out-dir instead of a share file")
+	finalizeOut := shareOutputFlags(reshareFinalizeCmd, ceremony.SharesOr("shares"))
+
+	reshareCodesCmd := flag.NewFlagSet("reshare-codes", flag.ExitOnError)
+	codesSession := reshareCodesCmd.String("session", "reshare-session.json", "Session from reshare-init")
+	codesAs := reshareCodesCmd.String("as", "", "Own role: old:<id> for an old signer, new:<id> for a new participant")
+	codesVerify := reshareCodesCmd.Bool("verify", false, "Prompt for the code each peer reads and check it")
+
+	changeThresholdCmd := flag.NewFlagSet("change-threshold", flag.ExitOnError)
+	changeState := changeThresholdCmd.String("state", ceremony.GroupStateOr("group-state.json"), "Group-state document of the group")
+	changeThreshold := changeThresholdCmd.Int("t", 3, "New threshold")
+	changeTotal := changeThresholdCmd.Int("n", 5, "New total participants")
+	changeHardware := changeThresholdCmd.String("hardware", "", "New participants on Ledger devices (comma-separated); they get APDU scripts instead of share files")
+	changeOut := changeThresholdCmd.String("out-dir", "reshare-out", "Output directory")
+	changeSeed := changeThresholdCmd.String("seed", "", "Derive the polynomials from this hex seed (test fixtures only)")
 
 	commitCmd := flag.NewFlagSet("commit", flag.ExitOnError)
 	participantID := commitCmd.Int("id", 1, "Participant ID")
+	commitGroupState := commitCmd.String("group-state", ws.GroupState, "Refuse to commit if this group-state document is frozen or retires -id")
+	commitNonces := commitCmd.String("nonces", "", "Write the nonces here (default: nonces-<id>.json)")
+	commitInsecure := commitCmd.Bool("insecure-stdout", false, "Print the nonces to stdout instead of writing a file")
+	commitSession := commitCmd.String("session", "", "Commit in this named session, or prove knowledge of the nonces for this coordinator session")
+	commitMessage := commitCmd.String("message", "", "Message hash of the -session, in hex (default: the named session's)")
+	commitShare := commitCmd.String("share", "", "Mix the participant's secret share from this file into the nonces (RFC 9591 nonce_generate)")
+	commitPassFile := commitCmd.String("passphrase-file", "", "Passphrase for an encrypted -share (default: prompt)")
+	commitStore := nonceStoreFlag(commitCmd)
+	commitSessionDir := sessionDirFlag(commitCmd)
 
 	signCmd := flag.NewFlagSet("sign", flag.ExitOnError)
+	signGroupState := signCmd.String("group-state", ws.GroupState, "Refuse to sign if this group-state document is frozen or retires -id")
+	signShare := signCmd.String("share", "", "Take the signer's secret share from this file (encrypted or plain) instead of the input")
+	signPassFile := signCmd.String("passphrase-file", "", "Passphrase for an encrypted -share (default: prompt)")
+	signNonces := signCmd.String("nonces", "", "Take the signer's nonces from this commit nonce file, and delete it")
+	signStore := nonceStoreFlag(signCmd)
+	signTrace := signCmd.Bool("trace", false, "Write the binding factors, R, c and Lagrange coefficients to stderr")
+	signSession := signCmd.String("session", "", "Sign in this named session instead of reading the input from stdin")
+	signID := signCmd.Int("id", 0, "Signer's participant ID in the -session (default: the -nonces file's)")
+	signSessionDir := sessionDirFlag(signCmd)
+	signHash := signCmd.String("hash", "", "Take the message hash as the poseidon hash of the input's message_fields")
 	aggregateCmd := flag.NewFlagSet("aggregate", flag.ExitOnError)
+	aggregateGroupState := aggregateCmd.String("group-state", ws.GroupState, "Take the group's threshold from this group-state document and refuse a signer set that cannot meet it")
+	aggregateTSA := aggregateCmd.String("tsa", ws.TSA, "Timestamp the signature with this RFC 3161 TSA URL")
+	aggregateTrace := aggregateCmd.Bool("trace", false, "Write the binding factors, R, c and Lagrange coefficients to stderr")
+	aggregateSession := aggregateCmd.String("session", "", "Aggregate this named session's partial signatures instead of reading the input from stdin")
+	aggregateSessionDir := sessionDirFlag(aggregateCmd)
+	aggregateHash := aggregateCmd.String("hash", "", "Take the message hash as the poseidon hash of the input's message_fields")
+	aggregateFormat := aggregateCmd.String("format", formatJSON, "Output: json, or circomlib for a Poseidon-challenge signature as EdDSAPoseidonVerifier's inputs")
+	aggregateWitness := aggregateCmd.String("emit-witness", "", "Also write the Poseidon-challenge signature as the verification circuit's witness input to this file")
+	aggregateSubmit := submitFlags(aggregateCmd)
+
+	verifyCmd := flag.NewFlagSet("verify", flag.ExitOnError)
+	verifyBundle := verifyCmd.String("bundle", "", "Transparency log receipt (default: <file>.anchor.json)")
+	verifyKey := verifyCmd.String("key", "", "Expected log public key (hex)")
+	verifyLog := verifyCmd.String("log", "", "Log URL for -online (default: the one in the bundle)")
+	verifyOnline := verifyCmd.Bool("online", false, "Also check that the log's current head extends the bundle's")
+	verifySignature := verifyCmd.String("signature", "", "Verify this signature file (R, z, group_key, message_hash) instead of a receipt")
+	verifyGroupKey := verifyCmd.String("group-key", "", "Group key for -signature (default: the file's, then the context's)")
+	verifyMessage := verifyCmd.String("message", "", "Message hash for -signature (default: the file's)")
+	verifyPoseidon := verifyCmd.Bool("poseidon", ceremony.Poseidon(), "The -signature uses the Poseidon challenge (INJECT_CHALLENGE)")
+	verifyPurpose := verifyCmd.String("purpose", "", "Require the -signature to be made for this purpose tag (default: the file's)")
+
+	simDeviceCmd := flag.NewFlagSet("simdevice", flag.ExitOnError)
+	simDeviceListen := simDeviceCmd.String("listen", "", "Serve the Speculos APDU protocol on this address (e.g. 127.0.0.1:9999)")
+	simDeviceCounter := simDeviceCmd.Bool("counter", false, "Model the planned signing counter (GET_COUNTER)")
+	simDeviceCommitBatch := simDeviceCmd.Bool("commit-batch", false, "Model the planned nonce pool (COMMIT_BATCH)")
+	simDeviceDebugTrace := simDeviceCmd.Bool("debug-trace", false, "Model a debug build, which answers GET_DEBUG_TRACE")
+	simDeviceReject := simDeviceCmd.String("reject", "", "Reject these prompts instead of approving them (comma-separated: inject_keys, sign, wipe_keys)")
+	simDeviceDebug := debugFlag(simDeviceCmd)
+
+	splitCmd := flag.NewFlagSet("split", flag.ExitOnError)
+	splitKey := splitCmd.String("sk", "", "Private key scalar to split (hex; read from stdin if empty)")
+	splitThreshold := splitCmd.Int("t", ceremony.ThresholdOr(2), "Threshold (minimum signers)")
+	splitTotal := splitCmd.Int("n", ceremony.TotalOr(3), "Total participants")
+	splitSeed := splitCmd.String("seed", "", "Derive the polynomial from this hex seed (test fixtures only)")
+	splitOut := shareOutputFlags(splitCmd, ceremony.SharesOr("shares"))
+
+	poolCmd := flag.NewFlagSet("speculos-pool", flag.ExitOnError)
+	poolELF := poolCmd.String("elf", "bin/app.elf", "App binary")
+	poolModel := poolCmd.String("model", "nanosp", "Device model")
+	poolSize := poolCmd.Int("n", 4, "Number of instances")
+	poolBasePort := poolCmd.Int("base-port", 0, "First APDU port (0 = pick free ports)")
+	poolDocker := poolCmd.Bool("docker", false, "Run instances in the Speculos Docker image")
+	poolLogDir := poolCmd.String("log-dir", "", "Write each instance's output to this directory")
+	poolListen := poolCmd.String("listen", "127.0.0.1:9990", "Lease API address")
+	poolLeaseTTL := poolCmd.Duration("lease-ttl", 10*time.Minute, "Reclaim leases not released within this time")
+	poolDebug := debugFlag(poolCmd)
+
+	for _, fs := range []*flag.FlagSet{
+		keygenCmd, recoverCmd, reshareInitCmd, reshareContributeCmd, reshareFinalizeCmd, reshareCodesCmd, changeThresholdCmd,
+		commitCmd, signCmd, aggregateCmd, verifyCmd, simDeviceCmd, splitCmd, poolCmd,
+	} {
+		stdioFlags(fs)
+	}
 
 	if len(os.Args) < 2 {
-		fmt.Println("Usage: keygen <command> [options]")
-		fmt.Println("Commands: keygen, commit, sign, aggregate")
-		os.Exit(1)
+		fail(KindUsage, "Usage: keygen [--strict] [--lock-memory] [--json-errors] [--log-level level] [--log-json] [--log-file f] [--transcript f] [--ceremony file] <command> [options]\nCommands: %s",
+			strings.Join(commands, ", "))
 	}
 
 	switch os.Args[1] {
 	case "keygen":
 		keygenCmd.Parse(os.Args[2:])
-		runKeygen(*threshold, *total)
+		runKeygen(*threshold, *total, *seed, keygenOut)
+	case "split":
+		splitCmd.Parse(os.Args[2:])
+		runSplit(*splitKey, *splitThreshold, *splitTotal, *splitSeed, splitOut)
+	case "recover":
+		recoverCmd.Parse(os.Args[2:])
+		runRecover(recoverCmd.Args(), *recoverThreshold, *recoverKeyFile, *recoverInsecureStdout)
+	case "recipient-key":
+		runRecipientKey(os.Args[2:])
+	case "reshare-init":
+		reshareInitCmd.Parse(os.Args[2:])
+		runReshareInit(*reshareState, *reshareSigners, *reshareRecipients, *reshareThreshold, *reshareTotal)
+	case "reshare-contribute":
+		reshareContributeCmd.Parse(os.Args[2:])
+		runReshareContribute(*contributeSession, *contributeShare, *contributeID, *contributeSeed, *contributeOut)
+	case "reshare-finalize":
+		reshareFinalizeCmd.Parse(os.Args[2:])
+		runReshareFinalize(*finalizeSession, *finalizeID, *finalizeKey, *finalizeVerifyCodes, *finalizeLedger, finalizeOut, reshareFinalizeCmd.Args())
+	case "reshare-codes":
+		reshareCodesCmd.Parse(os.Args[2:])
+		runReshareCodes(*codesSession, *codesAs, *codesVerify, reshareCodesCmd.Args())
+	case "enroll":
+		runEnroll(os.Args[2:])
+	case "refresh":
+		runRefresh(os.Args[2:])
+	case "change-threshold":
+		changeThresholdCmd.Parse(os.Args[2:])
+		runChangeThreshold(*changeState, *changeThreshold, *changeTotal, *changeHardware, *changeOut, *changeSeed, changeThresholdCmd.Args())
 	case "commit":
 		commitCmd.Parse(os.Args[2:])
-		runCommit(*participantID)
+		announceContext(ctxName, ws)
+		requireActiveGroup(*commitGroupState, *participantID)
+		runCommit(*participantID, *commitNonces, *commitInsecure, *commitSession, *commitMessage, *commitShare, *commitPassFile, *commitStore, *commitSessionDir)
 	case "sign":
 		signCmd.Parse(os.Args[2:])
-		runSign()
+		announceContext(ctxName, ws)
+		requireActiveGroup(*signGroupState, *signID)
+		runSign(ws, *signGroupState, *signShare, *signPassFile, *signNonces, *signStore, *signTrace, *signSession, *signSessionDir, *signID, *signHash)
 	case "aggregate":
 		aggregateCmd.Parse(os.Args[2:])
-		runAggregate()
+		runAggregate(*aggregateGroupState, *aggregateTSA, *aggregateTrace, *aggregateSession, *aggregateSessionDir, *aggregateHash, *aggregateFormat, *aggregateWitness, aggregateSubmit)
+	case "verify-partial":
+		runVerifyPartial()
+	case "select":
+		runSelect(os.Args[2:])
+	case "simdevice":
+		simDeviceCmd.Parse(os.Args[2:])
+		runSimDevice(*simDeviceListen, *simDeviceCounter, *simDeviceCommitBatch, *simDeviceDebugTrace, *simDeviceReject, *simDeviceDebug)
+	case "speculos-pool":
+		poolCmd.Parse(os.Args[2:])
+		runSpeculosPool(speculos.Config{
+			ELF:      *poolELF,
+			Model:    *poolModel,
+			Size:     *poolSize,
+			BasePort: *poolBasePort,
+			Docker:   *poolDocker,
+			LogDir:   *poolLogDir,
+		}, *poolListen, *poolLeaseTTL, *poolDebug)
+	case "soak":
+		runSoak(os.Args[2:])
+	case "reject-test":
+		runRejectTest(os.Args[2:])
+	case "debug":
+		runDebug(os.Args[2:])
+	case "diagnose":
+		runDiagnose(os.Args[2:], ws)
+	case "h2c":
+		runH2C(os.Args[2:])
+	case "nonces":
+		runNonces(os.Args[2:])
+	case "corpus":
+		runCorpus(os.Args[2:])
+	case "serve":
+		runServe(os.Args[2:], ws)
+	case "participant":
+		runParticipant(os.Args[2:], ws)
+	case "session":
+		runSession(os.Args[2:], ws.GroupState)
+	case "group-state":
+		runGroupState(os.Args[2:])
+	case "standby":
+		runStandby(os.Args[2:], ws)
+	case "dkg":
+		runDKG(os.Args[2:])
+	case "audit":
+		runAudit(os.Args[2:], ws)
+	case "provenance":
+		runProvenance(os.Args[2:])
+	case "export":
+		runExport(os.Args[2:], ws)
+	case "schema":
+		runSchema(os.Args[2:])
+	case "ctx":
+		runCtx(os.Args[2:])
+	case "timestamp":
+		runTimestamp(os.Args[2:], ws)
+	case "translog":
+		runTranslog(os.Args[2:], ws)
+	case "verify":
+		verifyCmd.Parse(os.Args[2:])
+		if *verifySignature != "" {
+			runVerifySignature(ws, *verifySignature, *verifyGroupKey, *verifyMessage, *verifyPurpose, *verifyPoseidon)
+			return
+		}
+		runVerify(*verifyBundle, *verifyKey, *verifyLog, *verifyOnline, verifyCmd.Args())
+	case "apdu":
+		runAPDU(os.Args[2:], ws)
+	case "bip340":
+		runBIP340(os.Args[2:])
+	case "rfc9591":
+		runRFC9591(os.Args[2:])
+	case "hash":
+		runHash(os.Args[2:])
+	case "vectors":
+		runVectors(os.Args[2:])
+	case "share":
+		runShare(os.Args[2:])
+	case "test":
+		runTest(os.Args[2:])
 	default:
-		fmt.Fprintf(os.Stderr, "Unknown command: %s\n", os.Args[1])
-		os.Exit(1)
+		fail(KindUsage, "Unknown command: %s", os.Args[1])
+	}
+	logger.Info("done", "elapsed", time.Since(started), "ops", frostcore.ReadOps())
+	record(entryDone, map[string]any{"ops": frostcore.ReadOps()})
+}
+
+// globalFlags strips the options given before the command. --strict makes
+// unknown, deprecated, duplicate and case-mismatched keys and nulls in JSON
+// inputs errors instead of warnings. --json-errors writes a failure to
+// stderr as an ErrorOutput instead of a message. --log-level, --log-json
+// and --log-file turn on logging (see setupLogging). --transcript records
+// the command in a ceremony transcript (see setupTranscript). --ciphersuite
+// picks the FROST ciphersuite and --hasher the hash of a Baby Jubjub one
+// (see setupCiphersuite).
+func globalFlags(args []string) []string {
+	schema.Strict = os.Getenv(envStrict) == "1"
+	secret.Lock = os.Getenv(envLockMemory) == "1"
+	jsonErrors = os.Getenv(envJSONErrors) == "1"
+	logOptions.level = os.Getenv(envLogLevel)
+	logOptions.json = os.Getenv(envLogJSON) == "1"
+	logOptions.file = os.Getenv(envLogFile)
+	transcriptPath = os.Getenv(envTranscript)
+	ciphersuiteName = os.Getenv(envSuite)
+	hasherName = os.Getenv(envHasher)
+	for len(args) > 1 {
+		switch args[1] {
+		case "--strict", "-strict":
+			schema.Strict = true
+		case "--lock-memory", "-lock-memory":
+			secret.Lock = true
+		case "--json-errors", "-json-errors":
+			jsonErrors = true
+		case "--log-json", "-log-json":
+			logOptions.json = true
+		case "--log-level", "-log-level", "--log-file", "-log-file":
+			if len(args) < 3 {
+				fail(KindUsage, "Error: %s needs a value", args[1])
+			}
+			if strings.HasSuffix(args[1], "level") {
+				logOptions.level = args[2]
+			} else {
+				logOptions.file = args[2]
+			}
+			args = append(args[:2:2], args[3:]...)
+		case "--transcript", "-transcript":
+			if len(args) < 3 {
+				fail(KindUsage, "Error: --transcript needs a file")
+			}
+			transcriptPath = args[2]
+			args = append(args[:2:2], args[3:]...)
+		case "--ciphersuite", "-ciphersuite":
+			if len(args) < 3 {
+				fail(KindUsage, "Error: --ciphersuite needs a name")
+			}
+			ciphersuiteName = args[2]
+			args = append(args[:2:2], args[3:]...)
+		case "--hasher", "-hasher":
+			if len(args) < 3 {
+				fail(KindUsage, "Error: --hasher needs a name")
+			}
+			hasherName = args[2]
+			args = append(args[:2:2], args[3:]...)
+		case "--ceremony", "-ceremony":
+			if len(args) < 3 {
+				fail(KindUsage, "Error: --ceremony needs a file")
+			}
+			os.Setenv(workspace.EnvCeremony, args[2])
+			args = append(args[:2:2], args[3:]...)
+		default:
+			return args
+		}
+		args = append(args[:1:1], args[2:]...)
+	}
+	return args
+}
+
+// mustSecret returns s, or exits if the scalar could not be stored.
+func mustSecret(s *secret.Scalar, err error) *secret.Scalar {
+	if err != nil {
+		fail(KindFailure, "Error: %v", err)
+	}
+	return s
+}
+
+// decodeHex decodes a hex field of the input, or exits naming the field.
+// Inputs are validated against their schema first, so this only fails for
+// values that bypass it.
+func decodeHex(field, s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		fail(KindInput, "Error: %s: %v", field, err)
+	}
+	return b
+}
+
+// canonicalOrder returns the indices of participants sorted by ID, the order
+// the binding factors are computed over (frostcore.SortCommitments), or
+// exits on a duplicate ID. Indices rather than a sorted copy keep error
+// messages pointing at the input's own participants[i].
+func canonicalOrder(participants []ParticipantInput) []int {
+	order := make([]int, len(participants))
+	for i := range order {
+		checkParticipantID(fmt.Sprintf("participants[%d]", i), participants[i].ID)
+		order[i] = i
 	}
+	slices.SortStableFunc(order, func(a, b int) int {
+		return cmp.Compare(participants[a].ID, participants[b].ID)
+	})
+	for k := 1; k < len(order); k++ {
+		if participants[order[k]].ID == participants[order[k-1]].ID {
+			fail(KindInput, "Error: participants[%d] and participants[%d] are both participant %d",
+				order[k-1], order[k], participants[order[k]].ID)
+		}
+	}
+	return order
+}
+
+// checkParticipantID exits unless id fits the device's 16-bit identifier;
+// anything wider would be truncated into some other participant's ID.
+func checkParticipantID(field string, id int) {
+	if id < 1 || id > 0xFFFF {
+		fail(KindInput, "Error: %s: identifier %d is outside 1..65535", field, id)
+	}
+}
+
+// idScalar is participant id's identifier scalar, laid out as
+// frostcore.IDBytes lays it out. id must have passed checkParticipantID.
+func idScalar(id int) group.Scalar {
+	s := frostcore.Curve.NewScalar()
+	if _, err := s.SetBytes(frostcore.IDBytes(uint16(id))); err != nil {
+		fail(KindCrypto, "Error: identifier %d: %v", id, err)
+	}
+	return s
+}
+
+// participantIDs lists the participants' IDs in order, for log records.
+func participantIDs(participants []ParticipantInput, order []int) []int {
+	ids := make([]int, len(order))
+	for k, i := range order {
+		ids[k] = participants[i].ID
+	}
+	return ids
+}
+
+// canonicalCommitmentList is the canonical serialization of the
+// participants' commitments, as sent to the device with INJECT_COMMITMENTS.
+func canonicalCommitmentList(participants []ParticipantInput) string {
+	list, err := commitmentList(participants)
+	if err == nil {
+		var enc []byte
+		if enc, err = frostcore.CanonicalCommitments(list); err == nil {
+			return hex.EncodeToString(enc)
+		}
+	}
+	fail(KindInput, "Error: %v", err)
+	return ""
+}
+
+// inputBytes, inputScalar, inputPoint and inputSecret decode a field of the
+// input with the frostcore.Parse* checks (length, scalar range, on the curve,
+// in the prime-order subgroup, not the identity), or exit naming the field,
+// so malformed input never reaches SetBytes.
+func inputBytes(field, s string, n int) []byte {
+	b, err := frostcore.ParseBytes(field, s, n)
+	exitOnInputError(err)
+	return b
+}
+
+func inputScalar(field, s string) group.Scalar {
+	x, err := frostcore.ParseScalar(field, s)
+	exitOnInputError(err)
+	return frostcore.Scalar(x)
+}
+
+func inputPoint(field, s string) group.Point {
+	p, err := frostcore.ParsePoint(field, s)
+	exitOnInputError(err)
+	return p
+}
+
+func inputSecret(field string, s *secret.Scalar) group.Scalar {
+	x, err := frostcore.CheckScalar(field, s.Bytes())
+	exitOnInputError(err)
+	defer secret.WipeInt(x)
+	return frostcore.Scalar(x)
 }
 
-func runKeygen(threshold, total int) {
+func exitOnInputError(err error) {
+	if err != nil {
+		fail(KindInput, "Error: invalid input: %v", err)
+	}
+}
+
+// randomSource returns crypto/rand, or a DRBG seeded from seedHex so every
+// run produces the same keys, for test fixtures.
+func randomSource(seedHex, label string) io.Reader {
+	if seedHex == "" {
+		return rand.Reader
+	}
+	seed, err := hex.DecodeString(seedHex)
+	if err != nil || len(seed) == 0 {
+		fail(KindInput, "Error: -seed: expected non-empty hex")
+	}
+	fmt.Fprintln(os.Stderr, "Warning: deterministic keys from -seed; use for test fixtures only")
+	return drbg.New(seed, label)
+}
+
+// newFROST returns fy's FROST with the group and hasher of the ciphersuite
+// in use.
+func newFROST(threshold, total int) (*frost.FROST, error) {
+	return frost.NewWithHasher(frostcore.Curve, threshold, total, frostcore.Suite.Hasher())
+}
+
+func runKeygen(threshold, total int, seedHex string, out *shareOutput) {
 	if threshold > total {
-		fmt.Fprintf(os.Stderr, "Error: threshold must be <= total\n")
-		os.Exit(1)
+		fail(KindInput, "Error: threshold must be <= total")
 	}
 
-	g := &bjj.BJJ{}
-	hasher := frost.NewBlake2bHasher()
-	f, err := frost.NewWithHasher(g, threshold, total, hasher)
+	random := randomSource(seedHex, "keygen")
+
+	f, err := newFROST(threshold, total)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error creating FROST: %v\n", err)
-		os.Exit(1)
+		fail(KindFailure, "Error creating FROST: %v", err)
 	}
 
 	participants := make([]*frost.Participant, total)
@@ -131,10 +645,9 @@ func runKeygen(threshold, total int) {
 	round1PrivateData := make([][]*frost.Round1PrivateData, total)
 
 	for i := 0; i < total; i++ {
-		participants[i], err = f.NewParticipant(rand.Reader, i+1)
+		participants[i], err = f.NewParticipant(random, i+1)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error creating participant %d: %v\n", i+1, err)
-			os.Exit(1)
+			fail(KindFailure, "Error creating participant %d: %v", i+1, err)
 		}
 		round1Broadcasts[i] = participants[i].Round1Broadcast()
 		round1PrivateData[i] = make([]*frost.Round1PrivateData, total)
@@ -150,8 +663,7 @@ func runKeygen(threshold, total int) {
 			if i != j {
 				err := f.Round2ReceiveShare(participants[i], round1PrivateData[j][i], round1Broadcasts[j].Commitments)
 				if err != nil {
-					fmt.Fprintf(os.Stderr, "Error in round 2: %v\n", err)
-					os.Exit(1)
+					fail(KindCrypto, "Error in round 2: %v", err)
 				}
 			}
 		}
@@ -160,94 +672,232 @@ func runKeygen(threshold, total int) {
 	output := KeyGenOutput{
 		Threshold: threshold,
 		Total:     total,
+		Seed:      seedHex,
 		Shares:    make([]KeyShareOutput, total),
 	}
 
 	for i := 0; i < total; i++ {
 		keyShare, err := f.Finalize(participants[i], round1Broadcasts)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error finalizing: %v\n", err)
-			os.Exit(1)
+			fail(KindCrypto, "Error finalizing: %v", err)
 		}
 
 		groupKeyBytes := keyShare.GroupKey.Bytes()
 		idBytes := keyShare.ID.Bytes() // Use fy's scalar representation directly
-		secretBytes := keyShare.SecretKey.Bytes()
 		publicBytes := keyShare.PublicKey.Bytes()
 
 		output.Shares[i] = KeyShareOutput{
 			Participant: i + 1,
 			GroupKey:    hex.EncodeToString(groupKeyBytes),
 			ID:          hex.EncodeToString(idBytes),
-			SecretShare: hex.EncodeToString(secretBytes),
+			SecretShare: mustSecret(secret.FromBytes(keyShare.SecretKey.Bytes())),
 			PublicShare: hex.EncodeToString(publicBytes),
+			Threshold:   threshold,
+			Total:       total,
 		}
 	}
 
-	enc := json.NewEncoder(os.Stdout)
-	enc.SetIndent("", "  ")
-	enc.Encode(output)
-}
+	// Only public values reach stdout once shares go to files
+	out.write(output.Shares)
 
-func runCommit(participantID int) {
-	g := &bjj.BJJ{}
+	writeJSON(output)
+}
 
-	// Generate random nonces
-	hidingNonce, _ := g.RandomScalar(rand.Reader)
-	bindingNonce, _ := g.RandomScalar(rand.Reader)
+// runCommit draws a nonce pair and writes it to the nonce file. With a
+// share the nonces follow nonce_generate of RFC 9591, as the app's do, and
+// a session binds them to the session ID and message hash. The pair is
+// recorded in the nonce store at storePath before it is written out. If
+// sessionID names a session in sessionDir, the message comes from it and
+// the commitment is recorded in it.
+func runCommit(participantID int, outPath string, insecureStdout bool, sessionID, messageHash, sharePath, passphraseFile, storePath, sessionDir string) {
+	var msg []byte
+	var named *signsession.Session
+	if sessionID != "" {
+		if named = findSession(sessionDir, sessionID); named != nil {
+			if messageHash == "" {
+				messageHash = named.MessageHash
+			} else if !strings.EqualFold(messageHash, named.MessageHash) {
+				fail(KindInput, "Error: session %s signs message %s, not %s", sessionID, named.MessageHash, messageHash)
+			}
+			if !slices.Contains(named.Signers, participantID) {
+				fail(KindInput, "Error: participant %d is not a signer of session %s", participantID, sessionID)
+			}
+			if c, ok := named.Commitment(participantID); ok {
+				fail(KindInput, "Error: participant %d already committed to %s in session %s", participantID, c.HidingCommit, sessionID)
+			}
+		}
+		msg = decodeHex("message", messageHash)
+		if len(msg) != 32 {
+			fail(KindInput, "Error: -session needs the session's 32-byte -message hash")
+		}
+	}
 
-	// Compute commitments
-	hidingCommit := g.NewPoint().ScalarMult(hidingNonce, g.Generator())
-	bindingCommit := g.NewPoint().ScalarMult(bindingNonce, g.Generator())
+	var hidingNonce, bindingNonce *big.Int
+	if sharePath != "" {
+		share := loadSigningShare(sharePath, passphraseFile, participantID)
+		if share.Participant != participantID {
+			fail(KindInput, "Error: %s holds participant %d's share, not participant %d's", sharePath, share.Participant, participantID)
+		}
+		var context []byte
+		if sessionID != "" {
+			context = h2c.Context([]byte(sessionID), msg)
+		}
+		hidingNonce = generateNonce(share.SecretShare, context)
+		bindingNonce = generateNonce(share.SecretShare, context)
+		share.SecretShare.Destroy()
+	} else {
+		fmt.Fprintln(os.Stderr, "Warning: no -share: nonces are drawn from the RNG alone, not mixed with the share as RFC 9591 requires")
+		var err error
+		if hidingNonce, err = frostcore.RandomScalar(rand.Reader); err == nil {
+			bindingNonce, err = frostcore.RandomScalar(rand.Reader)
+		}
+		if err != nil {
+			fail(KindFailure, "Error: %v", err)
+		}
+	}
 
 	output := CommitmentOutput{
 		Participant:   participantID,
-		HidingNonce:   hex.EncodeToString(hidingNonce.Bytes()),
-		BindingNonce:  hex.EncodeToString(bindingNonce.Bytes()),
-		HidingCommit:  hex.EncodeToString(hidingCommit.Bytes()),
-		BindingCommit: hex.EncodeToString(bindingCommit.Bytes()),
+		HidingCommit:  hex.EncodeToString(frostcore.BasePoint(hidingNonce)),
+		BindingCommit: hex.EncodeToString(frostcore.BasePoint(bindingNonce)),
+	}
+	logger.Debug("commitment", "participant", participantID, "hiding_commit", output.HidingCommit, "binding_commit", output.BindingCommit)
+	if sessionID != "" {
+		proof, err := frostcore.ProveNonces(uint16(participantID), hidingNonce, bindingNonce,
+			frostcore.NonceProofContext(sessionID, msg), rand.Reader)
+		if err != nil {
+			fail(KindFailure, "Error proving nonces: %v", err)
+		}
+		output.Proof = hex.EncodeToString(proof.Bytes())
+		logger.Debug("nonce proof", "session", sessionID, "message_hash", messageHash)
+	}
+	if store := openNonceStore(storePath); store != nil {
+		err := store.Commit(participantID, output.HidingCommit, output.BindingCommit)
+		store.Close()
+		if errors.Is(err, noncestore.ErrReused) {
+			fail(KindCrypto, "Error: %v; the RNG is broken, do not sign with this participant", err)
+		}
+		if err != nil {
+			fail(KindFailure, "Error recording nonces: %v", err)
+		}
 	}
+	// FromInt wipes the nonces
+	output.HidingNonce = mustSecret(secret.FromInt(hidingNonce))
+	output.BindingNonce = mustSecret(secret.FromInt(bindingNonce))
 
-	enc := json.NewEncoder(os.Stdout)
-	enc.SetIndent("", "  ")
-	enc.Encode(output)
+	if insecureStdout {
+		fmt.Fprintln(os.Stderr, "Warning: -insecure-stdout: secret nonces are printed to stdout")
+	} else {
+		if outPath == "" {
+			outPath = fmt.Sprintf("nonces-%d.json", participantID)
+		}
+		writeNonceFile(outPath, &output)
+	}
+	if named != nil {
+		updateSession(sessionDir, sessionID, func(s *signsession.Session) error {
+			return s.AddCommitment(signsession.Commitment{
+				ID: participantID, HidingCommit: output.HidingCommit, BindingCommit: output.BindingCommit, Proof: output.Proof,
+			})
+		})
+		fmt.Fprintf(os.Stderr, "Recorded the commitment in session %s\n", sessionID)
+	}
+
+	writeJSON(output)
+}
+
+// generateNonce draws a nonce with nonce_generate from the share, under
+// context.
+func generateNonce(share *secret.Scalar, context []byte) *big.Int {
+	var seed [frostcore.NonceSeedSize]byte
+	if _, err := rand.Read(seed[:]); err != nil {
+		fail(KindFailure, "Error: %v", err)
+	}
+	defer secret.Wipe(seed[:])
+	s := share.Int()
+	defer secret.WipeInt(s)
+	return frostcore.NonceGenerate(seed[:], s, context)
 }
 
-func runSign() {
+// runSign computes the signer's partial signature over the input from
+// stdin or, with sessionName, participant signerID's in the named session,
+// where the signature is then recorded. hashMode poseidon takes the message
+// hash from the input's message_fields (see inputMessageHash). The signer
+// set is checked against the group's threshold (see checkSignerSet).
+func runSign(ws *workspace.Context, statePath, sharePath, passphraseFile, noncesPath, storePath string, trace bool, sessionName, sessionDir string, signerID int, hashMode string) {
 	var input SignInput
-	if err := json.NewDecoder(os.Stdin).Decode(&input); err != nil {
-		fmt.Fprintf(os.Stderr, "Error reading input: %v\n", err)
-		os.Exit(1)
+	if sessionName != "" {
+		if signerID == 0 && noncesPath != "" {
+			var c CommitmentOutput
+			readJSONFile(noncesPath, &c)
+			c.HidingNonce.Destroy()
+			c.BindingNonce.Destroy()
+			signerID = c.Participant
+		}
+		if signerID == 0 {
+			fail(KindUsage, "Error: -session needs the signer's -id or -nonces file")
+		}
+		input = sessionSignInput(loadSession(sessionDir, sessionName), signerID)
+	} else if err := schema.DecodeAgainst(os.Stdin, &input, "sign-input", stdinName); err != nil {
+		fail(KindInput, "Error reading input: %v", err)
+	}
+	record(entryInput, input)
+	messageHash := inputMessageHash(hashMode, input.MessageHash, input.MessageFields)
+	input.MessageHash = hex.EncodeToString(messageHash)
+	if err := ws.CheckGroup(input.GroupKey); err != nil {
+		fail(KindInput, "Error: %v; refusing to sign (switch with ctx use)", err)
+	}
+	if input.SignerIndex < 0 || input.SignerIndex >= len(input.Participants) {
+		fail(KindInput, "Error: signer_index %d is out of range", input.SignerIndex)
+	}
+	order := canonicalOrder(input.Participants)
+	logger.Debug("sign input", "group_key", input.GroupKey, "message_hash", input.MessageHash,
+		"signer", input.Participants[input.SignerIndex].ID, "participants", participantIDs(input.Participants, order))
+	defer logStep("signed")()
+	if noncesPath != "" {
+		loadNonces(noncesPath, &input.Participants[input.SignerIndex])
+	}
+	var share *KeyShareOutput
+	if sharePath != "" {
+		signer := &input.Participants[input.SignerIndex]
+		loaded := loadSigningShare(sharePath, passphraseFile, signer.ID)
+		share = &loaded
+		if share.GroupKey != input.GroupKey || share.Participant != signer.ID {
+			fail(KindInput, "Error: %s holds participant %d's share of group %s, not participant %d's of %s",
+				sharePath, share.Participant, share.GroupKey, signer.ID, input.GroupKey)
+		}
+		// The share's purpose binds the challenge, whatever the input asks
+		if share.Purpose != input.Purpose {
+			fail(KindInput, "Error: %s is provisioned for %s, refusing to sign for %s",
+				sharePath, purposeName(share.Purpose), purposeName(input.Purpose))
+		}
+		signer.SecretShare = share.SecretShare
+	}
+	if err := frostcore.CheckPurpose(input.Purpose); err != nil {
+		fail(KindInput, "Error: %v", err)
 	}
+	threshold, total := checkSignerSet(input.GroupKey, input.Participants, input.Threshold, input.Total, share, statePath, "emit a partial signature")
 
-	g := &bjj.BJJ{}
-	hasher := frost.NewBlake2bHasher()
-	f, _ := frost.NewWithHasher(g, 2, 3, hasher) // threshold doesn't matter for signing
+	f, err := newFROST(threshold, total)
+	if err != nil {
+		fail(KindInput, "Error: %v", err)
+	}
 
 	// Parse inputs
-	messageHash, _ := hex.DecodeString(input.MessageHash)
-	groupKeyBytes, _ := hex.DecodeString(input.GroupKey)
-	groupKey := g.NewPoint()
-	groupKey.SetBytes(groupKeyBytes)
+	groupKey := inputPoint("group_key", input.GroupKey)
 
 	// Get signer's data
 	signer := input.Participants[input.SignerIndex]
-	secretBytes, _ := hex.DecodeString(signer.SecretShare)
-	hidingNonceBytes, _ := hex.DecodeString(signer.HidingNonce)
-	bindingNonceBytes, _ := hex.DecodeString(signer.BindingNonce)
+	if signer.SecretShare == nil || signer.HidingNonce == nil || signer.BindingNonce == nil {
+		fail(KindInput, "Error: signer %d needs secret_share, hiding_nonce and binding_nonce", signer.ID)
+	}
 
-	secretKey := g.NewScalar()
-	secretKey.SetBytes(secretBytes)
-	hidingNonce := g.NewScalar()
-	hidingNonce.SetBytes(hidingNonceBytes)
-	bindingNonce := g.NewScalar()
-	bindingNonce.SetBytes(bindingNonceBytes)
+	field := fmt.Sprintf("participants[%d].", input.SignerIndex)
+	secretKey := inputSecret(field+"secret_share", signer.SecretShare)
+	hidingNonce := inputSecret(field+"hiding_nonce", signer.HidingNonce)
+	bindingNonce := inputSecret(field+"binding_nonce", signer.BindingNonce)
 
 	// Build signer ID
-	signerIDScalar := g.NewScalar()
-	signerIDBytes := make([]byte, 32)
-	signerIDBytes[31] = byte(signer.ID)
-	signerIDScalar.SetBytes(signerIDBytes)
+	signerIDScalar := idScalar(signer.ID)
 
 	// Build key share and nonce
 	keyShare := &frost.KeyShare{
@@ -264,78 +914,192 @@ func runSign() {
 
 	// Build commitment list
 	var commitments []*frost.SigningCommitment
-	for _, p := range input.Participants {
-		hidingBytes, _ := hex.DecodeString(p.HidingCommit)
-		bindingBytes, _ := hex.DecodeString(p.BindingCommit)
-		hiding := g.NewPoint()
-		hiding.SetBytes(hidingBytes)
-		binding := g.NewPoint()
-		binding.SetBytes(bindingBytes)
-
-		idScalar := g.NewScalar()
-		idBytes := make([]byte, 32)
-		idBytes[31] = byte(p.ID)
-		idScalar.SetBytes(idBytes)
+	for _, i := range order {
+		p := input.Participants[i]
+		hiding := inputPoint(fmt.Sprintf("participants[%d].hiding_commit", i), p.HidingCommit)
+		binding := inputPoint(fmt.Sprintf("participants[%d].binding_commit", i), p.BindingCommit)
 
 		commitments = append(commitments, &frost.SigningCommitment{
-			ID:           idScalar,
+			ID:           idScalar(p.ID),
 			HidingPoint:  hiding,
 			BindingPoint: binding,
 		})
 	}
 
-	// Compute partial signature using the FROST library
-	sigShare, err := f.SignRound2(keyShare, nonce, messageHash, commitments)
+	// Nonces sign one message over one list, ever
+	commitmentList := canonicalCommitmentList(input.Participants)
+	if store := openNonceStore(storePath); store != nil {
+		recordNonceUse(store, &signer, messageHash, commitmentList)
+		store.Close()
+	}
+
+	// Compute partial signature using the FROST library, over the list in
+	// canonical order. The library only knows the untagged challenge, so
+	// purpose-tagged shares sign with frostcore as the app does.
+	var z []byte
+	if input.Purpose != "" {
+		z, err = purposePartialSig(input.Purpose, messageHash, groupKey.Bytes(), input.Participants, &signer)
+	} else {
+		var sigShare *frost.SignatureShare
+		if sigShare, err = f.SignRound2(keyShare, nonce, messageHash, commitments); err == nil {
+			z = sigShare.Z.Bytes()
+		}
+	}
+	signer.HidingNonce.Destroy() // Nonces are single use
+	signer.BindingNonce.Destroy()
+	if noncesPath != "" {
+		if err := os.Remove(noncesPath); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: could not delete used nonces: %v\n", err)
+		}
+	}
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error computing partial sig: %v\n", err)
-		os.Exit(1)
+		fail(KindCrypto, "Error computing partial sig: %v", err)
 	}
 
 	output := SignOutput{
-		PartialSig: hex.EncodeToString(sigShare.Z.Bytes()),
+		PartialSig:     hex.EncodeToString(z),
+		CommitmentList: commitmentList,
+	}
+	logger.Debug("partial signature", "partial_sig", output.PartialSig, "commitment_list", output.CommitmentList)
+	if trace {
+		writeTrace(messageHash, groupKey.Bytes(), input.Participants, map[int]string{signer.ID: output.PartialSig}, input.Purpose)
+	}
+	if sessionName != "" {
+		updateSession(sessionDir, sessionName, func(s *signsession.Session) error {
+			return s.AddPartialSig(signsession.PartialSig{ID: signer.ID, PartialSig: output.PartialSig})
+		})
+		fmt.Fprintf(os.Stderr, "Recorded the partial signature in session %s\n", sessionName)
 	}
 
-	enc := json.NewEncoder(os.Stdout)
-	enc.SetIndent("", "  ")
-	enc.Encode(output)
+	writeJSON(output)
 }
 
-func runAggregate() {
+// checkSignerSet returns the group's threshold and total as the share
+// file (if any), the input (or its session) and the group-state document
+// at statePath record them, which must agree, and refuses a signer set
+// that cannot meet the threshold or names a participant outside the group.
+// A partial signature of too few signers is of no use to anyone but an
+// attacker collecting them. Groups made before (t, n) was recorded are
+// signed for with a warning. action is what the caller refuses to do.
+func checkSignerSet(groupKey string, participants []ParticipantInput, inputT, inputN int, share *KeyShareOutput, statePath, action string) (threshold, total int) {
+	type record struct {
+		source string
+		t, n   int
+	}
+	var records []record
+	if share != nil && share.Threshold > 0 {
+		records = append(records, record{"the share file", share.Threshold, share.Total})
+	}
+	if inputT > 0 {
+		records = append(records, record{"the input", inputT, inputN})
+	}
+	if statePath != "" {
+		if doc := loadGroupState(statePath); strings.EqualFold(doc.GroupKey, groupKey) {
+			records = append(records, record{statePath, doc.Threshold, doc.Total})
+		}
+	}
+
+	ids := make(map[int]bool, len(participants))
+	maxID := 0
+	for _, p := range participants {
+		ids[p.ID] = true
+		maxID = max(maxID, p.ID)
+	}
+	if len(records) == 0 {
+		fmt.Fprintln(os.Stderr, "Warning: no share file, session or group-state document records the group's threshold; the signer set is not checked")
+		return len(ids), maxID
+	}
+	threshold, total = records[0].t, records[0].n
+	for _, r := range records[1:] {
+		if r.t != threshold || (r.n != 0 && total != 0 && r.n != total) {
+			fail(KindInput, "Error: %s says the group is %d-of-%d, %s says %d-of-%d; refusing to %s",
+				records[0].source, threshold, total, r.source, r.t, r.n, action)
+		}
+		total = max(total, r.n)
+	}
+	if len(ids) < threshold {
+		fail(KindInput, "Error: %d signers cannot meet the group's threshold of %d; refusing to %s", len(ids), threshold, action)
+	}
+	if total == 0 {
+		total = max(maxID, threshold)
+	} else if maxID > total {
+		fail(KindInput, "Error: participant %d is not in the group of %d; refusing to %s", maxID, total, action)
+	}
+	return threshold, total
+}
+
+// Output formats of aggregate
+const (
+	formatJSON      = "json"      // AggregateOutput
+	formatCircomlib = "circomlib" // circom.Signature, of a signature made with the Poseidon challenge
+)
+
+// runAggregate aggregates the partial signatures from stdin or, with
+// sessionName, the named session's, and records the result there.
+// hashMode is as for runSign. With format circomlib the signature is
+// verified with the Poseidon challenge, as a circuit verifies it, and
+// printed as EdDSAPoseidonVerifier's inputs; with witnessPath it is
+// verified the same way and those inputs are written there.
+func runAggregate(statePath, tsaURL string, trace bool, sessionName, sessionDir, hashMode, format, witnessPath string, sub *submitConfig) {
+	circomlib := format == formatCircomlib
+	poseidon := circomlib || witnessPath != ""
+	if !circomlib && format != formatJSON {
+		fail(KindUsage, "Error: unknown -format %q (json or circomlib)", format)
+	}
+	if circomlib && tsaURL != "" {
+		fail(KindUsage, "Error: -tsa timestamps the json output; aggregate without -format circomlib")
+	}
+	if circomlib && len(sub.targets) > 0 {
+		fail(KindUsage, "Error: -submit records its deliveries in the json output; aggregate without -format circomlib")
+	}
 	var input AggregateInput
-	if err := json.NewDecoder(os.Stdin).Decode(&input); err != nil {
-		fmt.Fprintf(os.Stderr, "Error reading input: %v\n", err)
-		os.Exit(1)
+	if sessionName != "" {
+		input = sessionAggregateInput(loadSession(sessionDir, sessionName))
+	} else if err := schema.DecodeAgainst(os.Stdin, &input, "aggregate-input", stdinName); err != nil {
+		fail(KindInput, "Error reading input: %v", err)
+	}
+	record(entryInput, input)
+	if poseidon && input.Purpose != "" {
+		fail(KindUsage, "Error: a purpose-tagged share never signs with an injected Poseidon challenge")
 	}
+	messageHash := inputMessageHash(hashMode, input.MessageHash, input.MessageFields)
+	input.MessageHash = hex.EncodeToString(messageHash)
+	order := canonicalOrder(input.Participants)
+	seen := make(map[int]bool, len(input.PartialSigs))
+	for i, ps := range input.PartialSigs {
+		checkParticipantID(fmt.Sprintf("partial_sigs[%d]", i), ps.ID)
+		if seen[ps.ID] {
+			fail(KindInput, "Error: partial_sigs: duplicate participant %d", ps.ID)
+		}
+		seen[ps.ID] = true
+	}
+	logger.Debug("aggregate input", "group_key", input.GroupKey, "message_hash", input.MessageHash,
+		"participants", participantIDs(input.Participants, order), "partial_sigs", len(input.PartialSigs),
+		"public_shares", len(input.PublicShares))
+	defer logStep("aggregated")()
 
-	g := &bjj.BJJ{}
-	hasher := frost.NewBlake2bHasher()
-	f, _ := frost.NewWithHasher(g, 2, 3, hasher)
+	threshold, total := checkSignerSet(input.GroupKey, input.Participants, input.Threshold, input.Total, nil, statePath, "aggregate")
+	if len(input.PartialSigs) < threshold {
+		fail(KindInput, "Error: %d partial signatures cannot meet the group's threshold of %d; refusing to aggregate", len(input.PartialSigs), threshold)
+	}
+	f, err := newFROST(threshold, total)
+	if err != nil {
+		fail(KindInput, "Error: %v", err)
+	}
 
 	// Parse group key
-	groupKeyBytes, _ := hex.DecodeString(input.GroupKey)
-	groupKey := g.NewPoint()
-	groupKey.SetBytes(groupKeyBytes)
-
-	// Parse message
-	messageHash, _ := hex.DecodeString(input.MessageHash)
+	groupKeyBytes := inputBytes("group_key", input.GroupKey, frostcore.PointSize)
+	groupKey := inputPoint("group_key", input.GroupKey)
 
 	// Build commitment list
 	var commitments []*frost.SigningCommitment
-	for _, p := range input.Participants {
-		hidingBytes, _ := hex.DecodeString(p.HidingCommit)
-		bindingBytes, _ := hex.DecodeString(p.BindingCommit)
-		hiding := g.NewPoint()
-		hiding.SetBytes(hidingBytes)
-		binding := g.NewPoint()
-		binding.SetBytes(bindingBytes)
-
-		idScalar := g.NewScalar()
-		idBytes := make([]byte, 32)
-		idBytes[31] = byte(p.ID)
-		idScalar.SetBytes(idBytes)
+	for _, i := range order {
+		p := input.Participants[i]
+		hiding := inputPoint(fmt.Sprintf("participants[%d].hiding_commit", i), p.HidingCommit)
+		binding := inputPoint(fmt.Sprintf("participants[%d].binding_commit", i), p.BindingCommit)
 
 		commitments = append(commitments, &frost.SigningCommitment{
-			ID:           idScalar,
+			ID:           idScalar(p.ID),
 			HidingPoint:  hiding,
 			BindingPoint: binding,
 		})
@@ -343,18 +1107,11 @@ func runAggregate() {
 
 	// Parse partial signatures
 	var sigShares []*frost.SignatureShare
-	for _, ps := range input.PartialSigs {
-		sigBytes, _ := hex.DecodeString(ps.PartialSig)
-		sig := g.NewScalar()
-		sig.SetBytes(sigBytes)
-
-		idScalar := g.NewScalar()
-		idBytes := make([]byte, 32)
-		idBytes[31] = byte(ps.ID)
-		idScalar.SetBytes(idBytes)
+	for i, ps := range input.PartialSigs {
+		sig := inputScalar(fmt.Sprintf("partial_sigs[%d].partial_sig", i), ps.PartialSig)
 
 		sigShares = append(sigShares, &frost.SignatureShare{
-			ID: idScalar,
+			ID: idScalar(ps.ID),
 			Z:  sig,
 		})
 	}
@@ -362,20 +1119,121 @@ func runAggregate() {
 	// Aggregate signatures
 	signature, err := f.Aggregate(messageHash, commitments, sigShares)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error aggregating: %v\n", err)
-		os.Exit(1)
+		fail(KindCrypto, "Error aggregating: %v", err)
 	}
 
-	// Verify signature
+	// Verify signature; the fy library only knows the untagged challenge
 	valid := f.Verify(messageHash, signature, groupKey)
+	if input.Purpose != "" {
+		valid, _ = frostcore.VerifyPurpose(input.Purpose, groupKeyBytes, messageHash, signature.R.Bytes(), signature.Z.Bytes())
+	}
+	if poseidon {
+		valid, _ = frostcore.VerifyPoseidon(groupKeyBytes, messageHash, signature.R.Bytes(), signature.Z.Bytes())
+	}
 
 	output := AggregateOutput{
-		R:     hex.EncodeToString(signature.R.Bytes()),
-		Z:     hex.EncodeToString(signature.Z.Bytes()),
-		Valid: valid,
+		R:       hex.EncodeToString(signature.R.Bytes()),
+		Z:       hex.EncodeToString(signature.Z.Bytes()),
+		Valid:   valid,
+		Purpose: input.Purpose,
+	}
+	logger.Debug("signature", "R", output.R, "z", output.Z, "valid", valid)
+	if trace {
+		partials := make(map[int]string, len(input.PartialSigs))
+		for _, ps := range input.PartialSigs {
+			partials[ps.ID] = ps.PartialSig
+		}
+		if r := writeTrace(messageHash, groupKeyBytes, input.Participants, partials, input.Purpose); !bytes.Equal(r, signature.R.Bytes()) {
+			fmt.Fprintln(os.Stderr, "Warning: the fy library's R differs from the traced group commitment")
+		}
+	}
+
+	// Identifiable abort: name the participants whose shares are wrong
+	if !valid {
+		v := frostcore.ExplainPurpose(input.Purpose, groupKeyBytes, messageHash, signature.R.Bytes(), signature.Z.Bytes())
+		var challenge *big.Int
+		if poseidon {
+			v = frostcore.ExplainPoseidon(groupKeyBytes, messageHash, signature.R.Bytes(), signature.Z.Bytes())
+			challenge, _ = frostcore.PoseidonChallengeScalar(signature.R.Bytes(), groupKeyBytes, messageHash)
+		}
+		output.Reason, output.Detail = v.Reason, v.Detail
+		if len(input.PublicShares) == 0 {
+			fmt.Fprintln(os.Stderr, "Signature invalid; pass public_shares to identify the faulty participant")
+		} else if poseidon && challenge == nil {
+			fmt.Fprintf(os.Stderr, "Signature invalid: %v\n", v.Err())
+		} else {
+			invalid, err := findInvalidShares(messageHash, groupKeyBytes, &input, challenge)
+			if err != nil {
+				fail(KindCrypto, "Error verifying shares: %v", err)
+			}
+			for _, id := range invalid {
+				logger.Warn("invalid partial signature", "participant", id)
+				fmt.Fprintf(os.Stderr, "Participant %d produced an invalid partial signature\n", id)
+			}
+			output.InvalidShares = invalid
+		}
+	}
+
+	// Only a valid signature is worth a third-party timestamp
+	if tsaURL != "" && valid {
+		output.GroupKey = input.GroupKey
+		output.MessageHash = input.MessageHash
+		if err := timestampSignature(&output, tsaURL); err != nil {
+			fail(KindTransport, "Error timestamping: %v", err)
+		}
+		fmt.Fprintf(os.Stderr, "Timestamped by %s at %s\n", tsaURL, output.Timestamp.GenTime.Format(time.RFC3339))
+	}
+	var recorded []submit.Delivery
+	if sessionName != "" {
+		s := updateSession(sessionDir, sessionName, func(s *signsession.Session) error {
+			s.Result = &signsession.Result{R: output.R, Z: output.Z, Valid: output.Valid}
+			return nil
+		})
+		recorded = s.Deliveries
 	}
 
-	enc := json.NewEncoder(os.Stdout)
-	enc.SetIndent("", "  ")
-	enc.Encode(output)
+	// Only a valid signature is delivered
+	if len(sub.targets) > 0 && !valid {
+		fmt.Fprintln(os.Stderr, "Not submitting the invalid signature")
+	} else if len(sub.targets) > 0 {
+		sig := &submit.Signature{
+			Ciphersuite: frostcore.Suite.ID(),
+			Session:     sessionName,
+			GroupKey:    input.GroupKey,
+			MessageHash: input.MessageHash,
+			Purpose:     input.Purpose,
+			R:           output.R,
+			Z:           output.Z,
+		}
+		var save func([]submit.Delivery)
+		if sessionName != "" {
+			save = func(ds []submit.Delivery) {
+				updateSession(sessionDir, sessionName, func(s *signsession.Session) error {
+					s.Deliveries = ds
+					return nil
+				})
+			}
+		}
+		output.Deliveries = deliverSignature(sub, sig, recorded, save)
+		if save != nil {
+			save(output.Deliveries)
+		}
+	}
+
+	if poseidon && !valid {
+		fail(KindCrypto, "Error: the signature does not verify with the Poseidon challenge (%s); was it signed with INJECT_CHALLENGE?", output.Reason)
+	}
+	if witnessPath != "" {
+		emitCircomWitness(witnessPath, groupKeyBytes, messageHash, signature.R.Bytes(), signature.Z.Bytes())
+	}
+	if circomlib {
+		writeCircomSignature(groupKeyBytes, messageHash, signature.R.Bytes(), signature.Z.Bytes())
+		return
+	}
+	writeJSON(output)
+	if n := unconfirmed(output.Deliveries); n > 0 && sessionName != "" {
+		fail(KindTransport, "Error: %d of %d targets have not confirmed the signature; retry with keygen session submit %s", n, len(output.Deliveries), sessionName)
+	} else if n > 0 {
+		fail(KindTransport, "Error: %d of %d targets have not confirmed the signature", n, len(output.Deliveries))
+	}
 }
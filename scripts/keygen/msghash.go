@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+
+	"keygen/frostcore"
+	"keygen/schema"
+)
+
+// Message hashing modes of hash, and of sign and aggregate -hash
+const (
+	hashSHA256   = "sha256"   // SHA-256 of the message bytes
+	hashPoseidon = "poseidon" // Poseidon of structured field elements, for circom circuits
+)
+
+// HashInput is the stdin input of hash without arguments.
+type HashInput struct {
+	Fields  []string `json:"fields,omitempty"`  // For poseidon: decimal or 0x-hex field elements
+	Message string   `json:"message,omitempty"` // For sha256: hex
+}
+
+type HashOutput struct {
+	Hash        string   `json:"hash"`
+	MessageHash string   `json:"message_hash"` // 32 bytes, as sign and INJECT_MESSAGE take it
+	Decimal     string   `json:"decimal"`      // The hash as a field element, as circuits take it
+	Fields      []string `json:"fields,omitempty"`
+}
+
+const hashUsage = "Usage: keygen hash [-hash poseidon|sha256] [-text] [field ... | msg]"
+
+// runHash implements the hash command:
+//
+//	hash [-hash poseidon] [field ...]      Poseidon of up to 16 field elements
+//	hash -hash sha256 [-text] [msg]        SHA-256 of a hex (or text) message
+//
+// Field elements are decimal or 0x-prefixed hex. Without arguments the
+// input is read from stdin as a HashInput.
+func runHash(args []string) {
+	cmd := flag.NewFlagSet("hash", flag.ExitOnError)
+	mode := cmd.String("hash", hashPoseidon, "Hash: poseidon (field elements) or sha256 (bytes)")
+	text := cmd.Bool("text", false, "For sha256: msg is text rather than hex")
+	stdioFlags(cmd)
+	cmd.Parse(args)
+
+	var input HashInput
+	if cmd.NArg() == 0 {
+		if err := schema.Decode(os.Stdin, &input, stdinName); err != nil {
+			fail(KindInput, "Error reading input: %v", err)
+		}
+	}
+	out := HashOutput{Hash: *mode}
+	var digest []byte
+	switch *mode {
+	case hashPoseidon:
+		if cmd.NArg() > 0 {
+			input.Fields = cmd.Args()
+		}
+		digest = poseidonMessage("fields", input.Fields)
+		out.Fields = input.Fields
+	case hashSHA256:
+		msg := input.Message
+		if cmd.NArg() > 1 {
+			fail(KindUsage, hashUsage)
+		} else if cmd.NArg() == 1 {
+			msg = cmd.Arg(0)
+		}
+		data := []byte(msg)
+		if !*text || cmd.NArg() == 0 {
+			var err error
+			if data, err = hex.DecodeString(msg); err != nil {
+				fail(KindInput, "Error: msg: %v", err)
+			}
+		}
+		sum := sha256.Sum256(data)
+		digest = sum[:]
+	default:
+		fail(KindUsage, "Error: unknown -hash %q (poseidon or sha256)", *mode)
+	}
+	out.MessageHash = hex.EncodeToString(digest)
+	out.Decimal = new(big.Int).SetBytes(digest).String()
+	writeJSON(out)
+}
+
+// parseFieldElement parses a decimal or 0x-prefixed hex field element.
+func parseFieldElement(s string) (*big.Int, error) {
+	x, ok := new(big.Int), false
+	if h, isHex := strings.CutPrefix(strings.ToLower(s), "0x"); isHex {
+		x, ok = x.SetString(h, 16)
+	} else {
+		x, ok = x.SetString(s, 10)
+	}
+	if !ok {
+		return nil, fmt.Errorf("%q is not a decimal or 0x-hex number", s)
+	}
+	return x, nil
+}
+
+// poseidonMessage hashes the field elements of an input field with
+// frostcore.PoseidonMessageHash, or exits.
+func poseidonMessage(field string, fields []string) []byte {
+	elems := make([]*big.Int, len(fields))
+	for i, f := range fields {
+		x, err := parseFieldElement(f)
+		if err != nil {
+			fail(KindInput, "Error: %s[%d]: %v", field, i, err)
+		}
+		elems[i] = x
+	}
+	digest, err := frostcore.PoseidonMessageHash(elems)
+	if err != nil {
+		fail(KindInput, "Error: %s: %v", field, err)
+	}
+	return digest
+}
+
+// inputMessageHash returns the message hash a sign or aggregate input
+// signs. With mode poseidon it is the Poseidon hash of message_fields,
+// which must match message_hash if that is given too; otherwise it is
+// message_hash.
+func inputMessageHash(mode, messageHash string, messageFields []string) []byte {
+	switch mode {
+	case "":
+		if len(messageFields) > 0 {
+			fail(KindInput, "Error: message_fields needs -hash poseidon")
+		}
+		return inputBytes("message_hash", messageHash, 32)
+	case hashPoseidon:
+		if len(messageFields) == 0 {
+			fail(KindInput, "Error: -hash poseidon needs message_fields")
+		}
+		digest := poseidonMessage("message_fields", messageFields)
+		if messageHash != "" && !bytes.Equal(inputBytes("message_hash", messageHash, 32), digest) {
+			fail(KindInput, "Error: message_hash %s is not the Poseidon hash of message_fields (%x)", messageHash, digest)
+		}
+		return digest
+	}
+	fail(KindUsage, "Error: unknown -hash %q (poseidon)", mode)
+	return nil
+}
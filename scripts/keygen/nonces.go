@@ -0,0 +1,119 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"keygen/noncestore"
+)
+
+// noStore disables the nonce store for one command.
+const noStore = "none"
+
+// nonceStoreFlag adds -nonce-store to commit and sign.
+func nonceStoreFlag(fs *flag.FlagSet) *string {
+	path, err := noncestore.DefaultPath()
+	if err != nil {
+		path = "nonces.jsonl"
+	}
+	return fs.String("nonce-store", path, "Record nonce pairs here and refuse to reuse one (\""+noStore+"\" disables)")
+}
+
+// openNonceStore opens the nonce store at path, or returns nil for noStore.
+func openNonceStore(path string) *noncestore.Store {
+	if path == noStore {
+		fmt.Fprintln(os.Stderr, "Warning: -nonce-store none: nothing guards these nonces against reuse")
+		return nil
+	}
+	s, err := noncestore.Open(path)
+	if err != nil {
+		fail(KindFailure, "Error opening nonce store: %v", err)
+	}
+	return s
+}
+
+// recordNonceUse records in the store that the signer's nonces sign msg
+// over the canonical commitment list (hex), and fails on reuse.
+func recordNonceUse(store *noncestore.Store, signer *ParticipantInput, msg []byte, commitmentList string) {
+	if store == nil {
+		return
+	}
+	list, err := hex.DecodeString(commitmentList)
+	if err != nil {
+		fail(KindInput, "Error: commitment list: %v", err)
+	}
+	listHash := sha256.Sum256(list)
+	err = store.Use(signer.ID, signer.HidingCommit, signer.BindingCommit, hex.EncodeToString(msg), hex.EncodeToString(listHash[:]))
+	if errors.Is(err, noncestore.ErrReused) {
+		fail(KindCrypto, "Error: refusing to sign: %v", err)
+	}
+	if err != nil {
+		fail(KindFailure, "Error recording nonce use: %v", err)
+	}
+}
+
+// runNonces implements the nonces subcommands:
+//
+//	nonces list [-json]                list the recorded pairs
+//	nonces purge -older-than 720h      forget pairs not touched since
+func runNonces(args []string) {
+	if len(args) < 1 {
+		fail(KindUsage, "Usage: keygen nonces <list|purge> [-nonce-store file] [options]")
+	}
+	cmd := flag.NewFlagSet("nonces "+args[0], flag.ExitOnError)
+	storePath := nonceStoreFlag(cmd)
+	var asJSON *bool
+	var olderThan *time.Duration
+	switch args[0] {
+	case "list":
+		asJSON = cmd.Bool("json", false, "Print JSON instead of text")
+	case "purge":
+		olderThan = cmd.Duration("older-than", 0, "Forget pairs last committed or used longer ago than this")
+	default:
+		fail(KindUsage, "Unknown nonces command: %s", args[0])
+	}
+	stdioFlags(cmd)
+	cmd.Parse(args[1:])
+	if *storePath == noStore {
+		fail(KindUsage, "Error: -nonce-store: give the store's path")
+	}
+	store := openNonceStore(*storePath)
+	defer store.Close()
+
+	if args[0] == "purge" {
+		if *olderThan <= 0 {
+			fail(KindUsage, "Usage: keygen nonces purge -older-than 720h")
+		}
+		n, err := store.Purge(time.Now().Add(-*olderThan))
+		if err != nil {
+			fail(KindFailure, "Error purging nonce store: %v", err)
+		}
+		fmt.Fprintf(os.Stderr, "Purged %d pairs; destroy any nonce files left from them\n", n)
+		return
+	}
+
+	pairs := store.Pairs()
+	if *asJSON {
+		writeJSON(pairs)
+		return
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "PARTICIPANT\tHIDING\tCOMMITTED\tUSED\tMESSAGE")
+	for _, p := range pairs {
+		committed, used := "-", "-"
+		if !p.Committed.IsZero() {
+			committed = p.Committed.Format(time.RFC3339)
+		}
+		if !p.Used.IsZero() {
+			used = p.Used.Format(time.RFC3339)
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\n", p.Participant, p.HidingCommit, committed, used, p.MessageHash)
+	}
+	w.Flush()
+}
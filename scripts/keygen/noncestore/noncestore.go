@@ -0,0 +1,327 @@
+// Package noncestore records every nonce commitment pair a software
+// participant emits and what each was used to sign, so the same nonces can
+// never sign two different things. Signing twice with one nonce pair, over
+// two messages or two commitment lists, reveals the secret share.
+//
+// The store is an append-only file of JSON lines, like the transparency
+// log's, in the user config directory by default. An event is written before
+// the command it guards goes ahead, so a crash can only leave a pair
+// recorded as used that was not.
+//
+// An open store holds an exclusive lock on <path>.lock until it is closed,
+// so no two processes share a store: one could otherwise record a use of a
+// pair another just used for something else, or purge the file under it.
+package noncestore
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"keygen/clock"
+)
+
+// Record operations
+const (
+	OpCommit = "commit" // commit emitted the pair
+	OpUse    = "use"    // sign used the pair
+)
+
+// Record is one line of the store.
+type Record struct {
+	Op            string    `json:"op"`
+	Participant   int       `json:"participant"`
+	HidingCommit  string    `json:"hiding_commit"`
+	BindingCommit string    `json:"binding_commit"`
+	MessageHash   string    `json:"message_hash,omitempty"` // OpUse
+	ListHash      string    `json:"list_hash,omitempty"`    // OpUse: SHA-256 of the canonical commitment list
+	Time          time.Time `json:"time"`
+}
+
+// Pair is the state of one commitment pair.
+type Pair struct {
+	Participant   int       `json:"participant"`
+	HidingCommit  string    `json:"hiding_commit"`
+	BindingCommit string    `json:"binding_commit"`
+	Committed     time.Time `json:"committed,omitzero"` // Zero if the pair did not come from commit
+	MessageHash   string    `json:"message_hash,omitempty"`
+	ListHash      string    `json:"list_hash,omitempty"`
+	Used          time.Time `json:"used,omitzero"`
+}
+
+// Last returns when the pair was last committed or used.
+func (p *Pair) Last() time.Time {
+	if p.Used.After(p.Committed) {
+		return p.Used
+	}
+	return p.Committed
+}
+
+// ErrReused is returned by Commit and Use when a commitment was recorded
+// before in another role: the same nonce was drawn twice, or a pair is used
+// to sign something other than what it signed already.
+var ErrReused = errors.New("nonce reuse")
+
+// DefaultPath returns fy-ledger/nonces.jsonl in the user config directory.
+func DefaultPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "fy-ledger", "nonces.jsonl"), nil
+}
+
+// Store is an open nonce store.
+type Store struct {
+	// Clock dates new records; nil is clock.Real.
+	Clock clock.Clock
+
+	mu    sync.Mutex
+	path  string
+	pairs []*Pair
+	index map[string]*Pair // By hiding and by binding commitment
+	file  *os.File
+	lock  *os.File
+}
+
+// lockWait is how long Open waits for another process to close the store.
+const lockWait = 10 * time.Second
+
+// ErrLocked is returned by Open when another process kept the store open
+// for longer than lockWait.
+var ErrLocked = errors.New("noncestore: the store is open in another process")
+
+// lockStore takes an exclusive flock on path's lock file, waiting up to
+// lockWait for it. The lock file is never renamed, so Purge swapping the
+// store file does not hand it to a waiting process, and the kernel
+// releases the lock if the holder dies.
+func lockStore(path string) (*os.File, error) {
+	f, err := os.OpenFile(path+".lock", os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	deadline := time.Now().Add(lockWait)
+	for {
+		err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+		if err == nil {
+			return f, nil
+		}
+		if !errors.Is(err, syscall.EWOULDBLOCK) || time.Now().After(deadline) {
+			f.Close()
+			if errors.Is(err, syscall.EWOULDBLOCK) {
+				return nil, fmt.Errorf("%w: %s", ErrLocked, path)
+			}
+			return nil, err
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// Open opens or creates the store at path and holds it until Close,
+// waiting up to 10 seconds for another process to close it first.
+func Open(path string) (_ *Store, err error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+	s := &Store{path: path, index: make(map[string]*Pair)}
+	if s.lock, err = lockStore(path); err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			s.lock.Close()
+		}
+	}()
+	if f, err := os.Open(path); err == nil {
+		scanner := bufio.NewScanner(f)
+		for line := 1; scanner.Scan(); line++ {
+			var r Record
+			if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+				f.Close()
+				return nil, fmt.Errorf("noncestore: %s:%d: %w", path, line, err)
+			}
+			s.apply(&r)
+		}
+		f.Close()
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	if s.file, err = os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Close closes the store file and releases the store to other processes.
+func (s *Store) Close() error {
+	err := s.file.Close()
+	s.lock.Close()
+	return err
+}
+
+// apply adds a record to the in-memory state.
+func (s *Store) apply(r *Record) {
+	hiding, binding := strings.ToLower(r.HidingCommit), strings.ToLower(r.BindingCommit)
+	p := s.index[hiding]
+	if p == nil {
+		p = &Pair{Participant: r.Participant, HidingCommit: hiding, BindingCommit: binding}
+		s.pairs = append(s.pairs, p)
+		s.index[hiding], s.index[binding] = p, p
+	}
+	switch r.Op {
+	case OpCommit:
+		p.Committed = r.Time
+	case OpUse:
+		p.MessageHash, p.ListHash, p.Used = r.MessageHash, r.ListHash, r.Time
+	}
+}
+
+func (s *Store) write(r *Record) error {
+	line, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	if _, err := s.file.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	if err := s.file.Sync(); err != nil {
+		return err
+	}
+	s.apply(r)
+	return nil
+}
+
+// Commit records a pair commit emitted. Either commitment having been seen
+// before means the RNG repeated itself, and is ErrReused.
+func (s *Store) Commit(participant int, hidingCommit, bindingCommit string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	hiding, binding := strings.ToLower(hidingCommit), strings.ToLower(bindingCommit)
+	for _, c := range []string{hiding, binding} {
+		if p := s.index[c]; p != nil {
+			return fmt.Errorf("%w: commitment %s was already recorded for participant %d", ErrReused, c, p.Participant)
+		}
+	}
+	return s.write(&Record{Op: OpCommit, Participant: participant, HidingCommit: hiding, BindingCommit: binding, Time: clock.Or(s.Clock).Now().UTC()})
+}
+
+// Use records that a pair signs messageHash over the commitment list with
+// SHA-256 listHash, before the signature is computed. It fails with
+// ErrReused if the pair, or either of its commitments in another pair,
+// already signed anything else. Using a pair again for the same message and
+// list gives the same partial signature, and is allowed.
+func (s *Store) Use(participant int, hidingCommit, bindingCommit, messageHash, listHash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	hiding, binding := strings.ToLower(hidingCommit), strings.ToLower(bindingCommit)
+	messageHash, listHash = strings.ToLower(messageHash), strings.ToLower(listHash)
+
+	p, q := s.index[hiding], s.index[binding]
+	if p != q {
+		return fmt.Errorf("%w: the hiding and binding commitments are not a recorded pair", ErrReused)
+	}
+	if p != nil && (p.HidingCommit != hiding || p.BindingCommit != binding) {
+		return fmt.Errorf("%w: the commitments were recorded with their roles swapped", ErrReused)
+	}
+	if p != nil && !p.Used.IsZero() {
+		if p.MessageHash != messageHash || p.ListHash != listHash {
+			return fmt.Errorf("%w: these nonces already signed message %s over commitment list %s at %s",
+				ErrReused, p.MessageHash, p.ListHash, p.Used.Format(time.RFC3339))
+		}
+		return nil
+	}
+	return s.write(&Record{Op: OpUse, Participant: participant, HidingCommit: hiding, BindingCommit: binding,
+		MessageHash: messageHash, ListHash: listHash, Time: clock.Or(s.Clock).Now().UTC()})
+}
+
+// Pairs returns the recorded pairs, oldest first.
+func (s *Store) Pairs() []Pair {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]Pair, len(s.pairs))
+	for i, p := range s.pairs {
+		out[i] = *p
+	}
+	return out
+}
+
+// Purge drops the pairs last committed or used before cutoff, rewriting the
+// file, and returns how many it dropped. The store no longer guards them:
+// their nonce files must be gone. No other process has the store open
+// while s holds it, so none appends to the file being replaced.
+func (s *Store) Purge(cutoff time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	keep := slices.DeleteFunc(slices.Clone(s.pairs), func(p *Pair) bool { return p.Last().Before(cutoff) })
+	dropped := len(s.pairs) - len(keep)
+	if dropped == 0 {
+		return 0, nil
+	}
+
+	// Write the kept pairs' records to a new file and swap it in
+	tmp := s.path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return 0, err
+	}
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for _, p := range keep {
+		for _, r := range p.records() {
+			if err := enc.Encode(r); err != nil {
+				f.Close()
+				return 0, err
+			}
+		}
+	}
+	if err := w.Flush(); err == nil {
+		err = f.Sync()
+	}
+	if err != nil {
+		f.Close()
+		return 0, err
+	}
+	if err := f.Close(); err != nil {
+		return 0, err
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return 0, err
+	}
+
+	s.file.Close()
+	if s.file, err = os.OpenFile(s.path, os.O_WRONLY|os.O_APPEND, 0600); err != nil {
+		return 0, err
+	}
+	s.pairs, s.index = nil, make(map[string]*Pair)
+	for _, p := range keep {
+		for _, r := range p.records() {
+			s.apply(&r)
+		}
+	}
+	return dropped, nil
+}
+
+// records returns the records that rebuild p.
+func (p *Pair) records() []Record {
+	var out []Record
+	if !p.Committed.IsZero() {
+		out = append(out, Record{Op: OpCommit, Participant: p.Participant, HidingCommit: p.HidingCommit, BindingCommit: p.BindingCommit, Time: p.Committed})
+	}
+	if !p.Used.IsZero() {
+		out = append(out, Record{Op: OpUse, Participant: p.Participant, HidingCommit: p.HidingCommit, BindingCommit: p.BindingCommit,
+			MessageHash: p.MessageHash, ListHash: p.ListHash, Time: p.Used})
+	}
+	return out
+}
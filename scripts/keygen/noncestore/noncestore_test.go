@@ -0,0 +1,101 @@
+package noncestore
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"keygen/clock"
+)
+
+func TestUse(t *testing.T) {
+	hiding, binding := strings.Repeat("a1", 32), strings.Repeat("b2", 32)
+	other := strings.Repeat("c3", 32)
+	msg, list := strings.Repeat("11", 32), strings.Repeat("22", 32)
+
+	tests := []struct {
+		name string
+		use  func(s *Store) error
+		want error
+	}{
+		{"same message and list", func(s *Store) error { return s.Use(1, hiding, binding, msg, list) }, nil},
+		{"same, other case", func(s *Store) error {
+			return s.Use(1, strings.ToUpper(hiding), binding, strings.ToUpper(msg), list)
+		}, nil},
+		{"other message", func(s *Store) error { return s.Use(1, hiding, binding, strings.Repeat("33", 32), list) }, ErrReused},
+		{"other list", func(s *Store) error { return s.Use(1, hiding, binding, msg, strings.Repeat("44", 32)) }, ErrReused},
+		{"roles swapped", func(s *Store) error { return s.Use(1, binding, hiding, msg, list) }, ErrReused},
+		{"hiding in another pair", func(s *Store) error { return s.Use(1, hiding, other, msg, list) }, ErrReused},
+		{"binding in another pair", func(s *Store) error { return s.Use(1, other, binding, msg, list) }, ErrReused},
+		{"committed again", func(s *Store) error { return s.Commit(1, hiding, other) }, ErrReused},
+		{"binding committed again", func(s *Store) error { return s.Commit(1, other, binding) }, ErrReused},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "nonces.jsonl")
+			s, err := Open(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := s.Commit(1, hiding, binding); err != nil {
+				t.Fatal(err)
+			}
+			if err := s.Use(1, hiding, binding, msg, list); err != nil {
+				t.Fatal(err)
+			}
+			if err := tt.use(s); !errors.Is(err, tt.want) {
+				t.Fatalf("got error %v, want %v", err, tt.want)
+			}
+			s.Close()
+
+			// The store refuses the same after reopening
+			s, err = Open(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer s.Close()
+			if err := tt.use(s); !errors.Is(err, tt.want) {
+				t.Fatalf("reopened: got error %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestPurge(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	clk := clock.NewFake(start)
+	path := filepath.Join(t.TempDir(), "nonces.jsonl")
+	s, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Clock = clk
+	old, recent := strings.Repeat("a1", 32), strings.Repeat("c3", 32)
+	if err := s.Commit(1, old, strings.Repeat("b2", 32)); err != nil {
+		t.Fatal(err)
+	}
+	clk.Advance(48 * time.Hour)
+	if err := s.Commit(1, recent, strings.Repeat("d4", 32)); err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := s.Purge(start.Add(24 * time.Hour))
+	if err != nil || n != 1 {
+		t.Fatalf("Purge: got %d, %v; want 1 pair dropped", n, err)
+	}
+	s.Close()
+
+	s, err = Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if pairs := s.Pairs(); len(pairs) != 1 || pairs[0].HidingCommit != recent {
+		t.Fatalf("after Purge: got %+v, want only the recent pair", pairs)
+	}
+	if err := s.Commit(1, recent, strings.Repeat("e5", 32)); !errors.Is(err, ErrReused) {
+		t.Fatalf("kept pair: got error %v, want %v", err, ErrReused)
+	}
+}
@@ -0,0 +1,156 @@
+package participant
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"keygen/coordinator"
+	"keygen/schema"
+)
+
+// Fanout runs a coordinator session with remote participants: it asks every
+// signer for a commitment and submits it, then, once the coordinator holds
+// them all, asks every signer for its partial signature over the
+// coordinator's commitment list and submits that. Signers whose commitment
+// the coordinator already has (salvaged by restart_session) are not asked
+// again. h is an in-process coordinator or a coordinator.Client. It returns
+// the session as it stands at the end, with its result if every step
+// succeeded.
+func Fanout(ctx context.Context, h coordinator.Handler, sessionID string, remotes map[int]Service) (*coordinator.Session, error) {
+	s, err := call(ctx, h, coordinator.OpGetSession, sessionID, nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range s.Signers {
+		if remotes[id] == nil {
+			return s, fmt.Errorf("no remote for signer %d", id)
+		}
+	}
+	groupKey, _ := hex.DecodeString(s.GroupKey)
+	msg, _ := hex.DecodeString(s.MessageHash)
+
+	if s.State == coordinator.StateCollectingCommitments {
+		var pending []int
+		for _, id := range s.Signers {
+			if _, ok := s.Commitments[id]; !ok {
+				pending = append(pending, id)
+			}
+		}
+		err := each(pending, func(id int) error {
+			c, err := remotes[id].Commit(ctx, &CommitRequest{SessionID: s.ID, GroupKey: groupKey, MessageHash: msg, Purpose: s.Purpose})
+			if err != nil {
+				return fmt.Errorf("participant %d: commit: %w", id, err)
+			}
+			if c.ID != id {
+				return fmt.Errorf("participant %d: commit: answered as participant %d", id, c.ID)
+			}
+			_, err = call(ctx, h, coordinator.OpSubmitCommitment, s.ID, coordinator.CommitmentParams{
+				ID:            id,
+				HidingCommit:  hex.EncodeToString(c.HidingCommit),
+				BindingCommit: hex.EncodeToString(c.BindingCommit),
+				Proof:         hex.EncodeToString(c.Proof),
+			})
+			return err
+		})
+		if s, err = refresh(ctx, h, s, err); err != nil {
+			return s, err
+		}
+	}
+	if s.State != coordinator.StateCollectingPartials {
+		return s, fmt.Errorf("session %s is %s, not collecting partial signatures", s.ID, s.State)
+	}
+
+	req := &SignRequest{SessionID: s.ID, GroupKey: groupKey, MessageHash: msg, Purpose: s.Purpose}
+	for _, id := range s.Signers {
+		cm := s.Commitments[id]
+		hiding, _ := hex.DecodeString(cm.HidingCommit)
+		binding, _ := hex.DecodeString(cm.BindingCommit)
+		req.Commitments = append(req.Commitments, Commitment{ID: id, HidingCommit: hiding, BindingCommit: binding})
+	}
+	var pending []int
+	for _, id := range s.Signers {
+		if _, ok := s.Partials[id]; !ok {
+			pending = append(pending, id)
+		}
+	}
+	err = each(pending, func(id int) error {
+		p, err := remotes[id].Sign(ctx, req)
+		if err != nil {
+			return fmt.Errorf("participant %d: sign: %w", id, err)
+		}
+		if p.ID != id {
+			return fmt.Errorf("participant %d: sign: answered as participant %d", id, p.ID)
+		}
+		_, err = call(ctx, h, coordinator.OpSubmitPartial, s.ID, coordinator.PartialParams{
+			ID:         id,
+			PartialSig: hex.EncodeToString(p.PartialSig),
+		})
+		return err
+	})
+	if s, err = refresh(ctx, h, s, err); err != nil {
+		return s, err
+	}
+	if s.Result == nil {
+		return s, fmt.Errorf("session %s is %s: %s", s.ID, s.State, s.Error)
+	}
+	if !s.Result.Valid {
+		return s, fmt.Errorf("session %s: the aggregated signature does not verify", s.ID)
+	}
+	return s, nil
+}
+
+// each runs f for every ID concurrently and joins their errors.
+func each(ids []int, f func(id int) error) error {
+	errs := make([]error, len(ids))
+	var wg sync.WaitGroup
+	for i, id := range ids {
+		wg.Go(func() {
+			errs[i] = f(id)
+		})
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// refresh fetches the session after a round, keeping the round's error.
+func refresh(ctx context.Context, h coordinator.Handler, s *coordinator.Session, roundErr error) (*coordinator.Session, error) {
+	latest, err := call(ctx, h, coordinator.OpGetSession, s.ID, nil)
+	if err != nil {
+		return s, errors.Join(roundErr, err)
+	}
+	return latest, roundErr
+}
+
+// call sends one request and decodes the session it returns. The session
+// goes through JSON, so a Handler that returns it already encoded (a
+// coordinator.Client) works as well.
+func call(ctx context.Context, h coordinator.Handler, op, sessionID string, params any) (*coordinator.Session, error) {
+	var body []byte
+	if params != nil {
+		var err error
+		if body, err = json.Marshal(params); err != nil {
+			return nil, err
+		}
+	}
+	resp, err := h.Handle(ctx, &coordinator.Request{Op: op, SessionID: sessionID, Body: body})
+	if err != nil {
+		return nil, fmt.Errorf("%s %s: %w", op, sessionID, err)
+	}
+	b, ok := resp.Body.(json.RawMessage)
+	if !ok {
+		if b, err = json.Marshal(resp.Body); err != nil {
+			return nil, err
+		}
+	}
+	var s coordinator.Session
+	if err := schema.Unmarshal(b, &s, op); err != nil {
+		return nil, fmt.Errorf("%s %s: %w", op, sessionID, err)
+	}
+	sort.Ints(s.Signers)
+	return &s, nil
+}
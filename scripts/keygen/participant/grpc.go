@@ -0,0 +1,299 @@
+package participant
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// The gRPC protocol over HTTP/2, as net/http serves it: each call is a POST
+// to /<service>/<method> whose body is one length-prefixed protobuf
+// message, answered with one message and a grpc-status trailer. Plaintext
+// servers speak HTTP/2 with prior knowledge (h2c), as gRPC clients expect.
+
+// ServiceName is the gRPC service name of participant.proto.
+const ServiceName = "fyledger.participant.v1.Participant"
+
+// maxMessageSize bounds requests; a SignRequest for 255 signers is about
+// 20 KiB.
+const maxMessageSize = 64 << 10
+
+// Code is a gRPC status code.
+type Code uint32
+
+// The gRPC codes this service returns.
+const (
+	CodeOK                 Code = 0
+	CodeCanceled           Code = 1
+	CodeUnknown            Code = 2
+	CodeInvalidArgument    Code = 3
+	CodeDeadlineExceeded   Code = 4
+	CodeNotFound           Code = 5
+	CodeAlreadyExists      Code = 6
+	CodePermissionDenied   Code = 7
+	CodeFailedPrecondition Code = 9
+	CodeUnimplemented      Code = 12
+	CodeInternal           Code = 13
+	CodeUnavailable        Code = 14
+	CodeUnauthenticated    Code = 16
+)
+
+var codeNames = map[Code]string{
+	CodeOK:                 "OK",
+	CodeCanceled:           "CANCELLED",
+	CodeUnknown:            "UNKNOWN",
+	CodeInvalidArgument:    "INVALID_ARGUMENT",
+	CodeDeadlineExceeded:   "DEADLINE_EXCEEDED",
+	CodeNotFound:           "NOT_FOUND",
+	CodeAlreadyExists:      "ALREADY_EXISTS",
+	CodePermissionDenied:   "PERMISSION_DENIED",
+	CodeFailedPrecondition: "FAILED_PRECONDITION",
+	CodeUnimplemented:      "UNIMPLEMENTED",
+	CodeInternal:           "INTERNAL",
+	CodeUnavailable:        "UNAVAILABLE",
+	CodeUnauthenticated:    "UNAUTHENTICATED",
+}
+
+func (c Code) String() string {
+	if s, ok := codeNames[c]; ok {
+		return s
+	}
+	return "CODE(" + strconv.Itoa(int(c)) + ")"
+}
+
+// Error is a failed call: the status a server returns, or one received by a
+// Client.
+type Error struct {
+	Code    Code
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %s", e.Code, e.Message)
+}
+
+// Errorf returns an *Error with the given code.
+func Errorf(code Code, format string, args ...any) error {
+	return &Error{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// CodeOf returns the code of err: CodeOK for nil, CodeUnknown for errors
+// that are not an *Error.
+func CodeOf(err error) Code {
+	if err == nil {
+		return CodeOK
+	}
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Code
+	}
+	return CodeUnknown
+}
+
+// Service is the Participant service: a *Signer in process, or a *Client
+// calling one remotely.
+type Service interface {
+	Commit(ctx context.Context, req *CommitRequest) (*CommitResponse, error)
+	Sign(ctx context.Context, req *SignRequest) (*SignResponse, error)
+}
+
+// GRPCHandler serves svc as the Participant gRPC service. Calls need
+// "authorization: Bearer <token>" metadata unless token is empty. Serve it
+// with HTTP/2: TLS, or an http.Server whose Protocols enable unencrypted
+// HTTP/2.
+func GRPCHandler(svc Service, token string) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /"+ServiceName+"/Commit", func(w http.ResponseWriter, r *http.Request) {
+		serveCall(w, r, token, &CommitRequest{}, func(ctx context.Context, req message) (message, error) {
+			return svc.Commit(ctx, req.(*CommitRequest))
+		})
+	})
+	mux.HandleFunc("POST /"+ServiceName+"/Sign", func(w http.ResponseWriter, r *http.Request) {
+		serveCall(w, r, token, &SignRequest{}, func(ctx context.Context, req message) (message, error) {
+			return svc.Sign(ctx, req.(*SignRequest))
+		})
+	})
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		writeStatus(w, Errorf(CodeUnimplemented, "unknown method %s", r.URL.Path))
+	})
+	return mux
+}
+
+func serveCall(w http.ResponseWriter, r *http.Request, token string, req message, call func(context.Context, message) (message, error)) {
+	if !strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc") {
+		http.Error(w, "expected application/grpc", http.StatusUnsupportedMediaType)
+		return
+	}
+	if token != "" {
+		got, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			writeStatus(w, Errorf(CodeUnauthenticated, "missing or unknown bearer token"))
+			return
+		}
+	}
+	body, err := readFrame(http.MaxBytesReader(w, r.Body, maxMessageSize+5))
+	if err == nil {
+		err = req.unmarshal(body)
+	}
+	if err != nil {
+		writeStatus(w, Errorf(CodeInvalidArgument, "%v", err))
+		return
+	}
+	resp, err := call(r.Context(), req)
+	if err != nil {
+		writeStatus(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/grpc+proto")
+	w.Header().Set("Trailer", "Grpc-Status, Grpc-Message")
+	w.Write(frame(resp.marshal()))
+	w.Header().Set("Grpc-Status", "0")
+	w.Header().Set("Grpc-Message", "")
+}
+
+// writeStatus answers a call with an error status and no message (a
+// trailers-only response).
+func writeStatus(w http.ResponseWriter, err error) {
+	var e *Error
+	if !errors.As(err, &e) {
+		e = &Error{Code: CodeUnknown, Message: err.Error()}
+	}
+	w.Header().Set("Content-Type", "application/grpc+proto")
+	w.Header().Set("Grpc-Status", strconv.Itoa(int(e.Code)))
+	w.Header().Set("Grpc-Message", url.PathEscape(e.Message))
+	w.WriteHeader(http.StatusOK)
+}
+
+// frame prefixes a message with its gRPC header: not compressed, and its
+// length.
+func frame(msg []byte) []byte {
+	b := make([]byte, 5, 5+len(msg))
+	binary.BigEndian.PutUint32(b[1:], uint32(len(msg)))
+	return append(b, msg...)
+}
+
+// readFrame reads the single message of a unary call.
+func readFrame(r io.Reader) ([]byte, error) {
+	var hdr [5]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return nil, fmt.Errorf("grpc: reading message: %w", err)
+	}
+	if hdr[0] != 0 {
+		return nil, errors.New("grpc: compressed messages are not supported")
+	}
+	n := binary.BigEndian.Uint32(hdr[1:])
+	if n > maxMessageSize {
+		return nil, fmt.Errorf("grpc: message of %d bytes exceeds %d", n, maxMessageSize)
+	}
+	msg := make([]byte, n)
+	if _, err := io.ReadFull(r, msg); err != nil {
+		return nil, fmt.Errorf("grpc: reading message: %w", err)
+	}
+	return msg, nil
+}
+
+// Client calls a remote participant served by GRPCHandler, or any other
+// implementation of participant.proto.
+type Client struct {
+	URL   string // http://host:port for h2c, https://host:port for TLS
+	Token string // Bearer token; empty sends none
+
+	// TLS configures https connections; nil uses the system roots.
+	TLS *tls.Config
+
+	once sync.Once
+	http *http.Client
+}
+
+// Commit calls Participant/Commit.
+func (c *Client) Commit(ctx context.Context, req *CommitRequest) (*CommitResponse, error) {
+	resp := &CommitResponse{}
+	if err := c.call(ctx, "Commit", req, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// Sign calls Participant/Sign.
+func (c *Client) Sign(ctx context.Context, req *SignRequest) (*SignResponse, error) {
+	resp := &SignResponse{}
+	if err := c.call(ctx, "Sign", req, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (c *Client) call(ctx context.Context, method string, req, resp message) error {
+	c.once.Do(func() {
+		var p http.Protocols
+		if strings.HasPrefix(c.URL, "https://") {
+			p.SetHTTP2(true)
+		} else {
+			p.SetUnencryptedHTTP2(true)
+		}
+		c.http = &http.Client{Transport: &http.Transport{Protocols: &p, TLSClientConfig: c.TLS}}
+	})
+	u := strings.TrimSuffix(c.URL, "/") + "/" + ServiceName + "/" + method
+	hr, err := http.NewRequestWithContext(ctx, http.MethodPost, u, bytes.NewReader(frame(req.marshal())))
+	if err != nil {
+		return err
+	}
+	hr.Header.Set("Content-Type", "application/grpc+proto")
+	hr.Header.Set("TE", "trailers")
+	if c.Token != "" {
+		hr.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+	hresp, err := c.http.Do(hr)
+	if err != nil {
+		return &Error{Code: CodeUnavailable, Message: err.Error()}
+	}
+	defer hresp.Body.Close()
+	if hresp.StatusCode != http.StatusOK {
+		return Errorf(CodeUnknown, "%s: HTTP %s", method, hresp.Status)
+	}
+
+	// A trailers-only response carries the status in its headers
+	if status := hresp.Header.Get("Grpc-Status"); status != "" {
+		return statusError(status, hresp.Header.Get("Grpc-Message"))
+	}
+	body, err := readFrame(io.LimitReader(hresp.Body, maxMessageSize+5))
+	if err == nil {
+		_, err = io.Copy(io.Discard, hresp.Body) // The trailers follow the body
+	}
+	if err != nil {
+		return &Error{Code: CodeUnavailable, Message: err.Error()}
+	}
+	if err := statusError(hresp.Trailer.Get("Grpc-Status"), hresp.Trailer.Get("Grpc-Message")); err != nil {
+		return err
+	}
+	if err := resp.unmarshal(body); err != nil {
+		return Errorf(CodeInternal, "%s response: %v", method, err)
+	}
+	return nil
+}
+
+// statusError returns the error of a grpc-status and grpc-message, nil for
+// OK.
+func statusError(status, msg string) error {
+	code, err := strconv.ParseUint(status, 10, 32)
+	if err != nil {
+		return Errorf(CodeInternal, "malformed grpc-status %q", status)
+	}
+	if code == 0 {
+		return nil
+	}
+	if m, err := url.PathUnescape(msg); err == nil {
+		msg = m
+	}
+	return &Error{Code: Code(code), Message: msg}
+}
@@ -0,0 +1,251 @@
+// Package participant is a software FROST participant that a coordinator
+// can drive remotely: a Signer holding one share, the Participant gRPC
+// service serving it (participant.proto), a Client for that service, and
+// Fanout, which runs a coordinator session across remote participants.
+package participant
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"math/big"
+	"sync"
+	"time"
+
+	"keygen/clock"
+	"keygen/frostcore"
+	"keygen/h2c"
+	"keygen/noncestore"
+	"keygen/secret"
+)
+
+// DefaultNonceTTL is how long a Signer keeps a session's nonces waiting for
+// Sign.
+const DefaultNonceTTL = time.Hour
+
+// Signer is a software participant: it commits and signs for sessions with
+// one share. Nonces follow nonce_generate of RFC 9591, bound to the session
+// ID and message hash as keygen commit does, and are kept in memory only,
+// so a restarted Signer cannot sign for sessions it committed to before.
+type Signer struct {
+	ID       int
+	GroupKey []byte
+
+	// Purpose is the purpose tag the share was provisioned for. It is
+	// bound into every challenge, and requests for another purpose are
+	// refused.
+	Purpose string
+
+	// Store, if set, records each pair when committed and when used, and
+	// refuses to sign with a pair used before.
+	Store *noncestore.Store
+
+	// NonceTTL drops nonces not used within it; 0 uses DefaultNonceTTL.
+	NonceTTL time.Duration
+
+	// Clock times the NonceTTL; nil is clock.Real.
+	Clock clock.Clock
+
+	share   *secret.Scalar
+	mu      sync.Mutex
+	pending map[string]*pendingNonces // By session ID
+}
+
+type pendingNonces struct {
+	msg                         []byte
+	hiding, binding             *big.Int
+	hidingCommit, bindingCommit []byte
+	created                     time.Time
+}
+
+func (p *pendingNonces) destroy() {
+	secret.WipeInt(p.hiding)
+	secret.WipeInt(p.binding)
+}
+
+// NewSigner returns a Signer for participant id of the group. It takes
+// ownership of share and destroys it on Close.
+func NewSigner(id int, groupKey []byte, share *secret.Scalar) *Signer {
+	return &Signer{ID: id, GroupKey: groupKey, share: share, pending: make(map[string]*pendingNonces)}
+}
+
+// Close destroys the share and every pending nonce.
+func (s *Signer) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, p := range s.pending {
+		p.destroy()
+		delete(s.pending, id)
+	}
+	s.share.Destroy()
+}
+
+// Commit draws a nonce pair for the session and returns its commitments and
+// a proof of knowledge of the nonces.
+func (s *Signer) Commit(ctx context.Context, req *CommitRequest) (*CommitResponse, error) {
+	if err := s.checkRequest(req.SessionID, req.GroupKey, req.MessageHash, req.Purpose); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := clock.Or(s.Clock).Now()
+	s.expire(now)
+	if _, ok := s.pending[req.SessionID]; ok {
+		return nil, Errorf(CodeAlreadyExists, "participant %d already committed to session %s", s.ID, req.SessionID)
+	}
+
+	context := h2c.Context([]byte(req.SessionID), req.MessageHash)
+	hiding, err := s.nonce(context)
+	if err != nil {
+		return nil, err
+	}
+	binding, err := s.nonce(context)
+	if err != nil {
+		secret.WipeInt(hiding)
+		return nil, err
+	}
+	p := &pendingNonces{
+		msg:           bytes.Clone(req.MessageHash),
+		hiding:        hiding,
+		binding:       binding,
+		hidingCommit:  frostcore.BasePoint(hiding),
+		bindingCommit: frostcore.BasePoint(binding),
+		created:       now,
+	}
+	proof, err := frostcore.ProveNonces(uint16(s.ID), hiding, binding, frostcore.NonceProofContext(req.SessionID, req.MessageHash), rand.Reader)
+	if err == nil && s.Store != nil {
+		err = s.Store.Commit(s.ID, hex.EncodeToString(p.hidingCommit), hex.EncodeToString(p.bindingCommit))
+	}
+	if err != nil {
+		p.destroy()
+		if errors.Is(err, noncestore.ErrReused) {
+			return nil, Errorf(CodeInternal, "%v; the RNG is broken", err)
+		}
+		return nil, Errorf(CodeInternal, "%v", err)
+	}
+	s.pending[req.SessionID] = p
+	return &CommitResponse{ID: s.ID, HidingCommit: p.hidingCommit, BindingCommit: p.bindingCommit, Proof: proof.Bytes()}, nil
+}
+
+// Sign computes the partial signature for the session over its commitment
+// list, which must hold this participant's commitment unchanged. The nonces
+// are spent even if the request is rejected, so a session can only be
+// signed once; a rejected one has to be committed to anew.
+func (s *Signer) Sign(ctx context.Context, req *SignRequest) (*SignResponse, error) {
+	if err := s.checkRequest(req.SessionID, req.GroupKey, req.MessageHash, req.Purpose); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	s.expire(clock.Or(s.Clock).Now())
+	p, ok := s.pending[req.SessionID]
+	delete(s.pending, req.SessionID)
+	s.mu.Unlock()
+	if !ok {
+		return nil, Errorf(CodeFailedPrecondition, "participant %d has no nonces for session %s", s.ID, req.SessionID)
+	}
+	defer p.destroy()
+	if !bytes.Equal(p.msg, req.MessageHash) {
+		return nil, Errorf(CodeInvalidArgument, "session %s committed to a different message", req.SessionID)
+	}
+
+	list := make([]frostcore.Commitment, len(req.Commitments))
+	ids := make([]uint16, len(req.Commitments))
+	for i, c := range req.Commitments {
+		if c.ID < 1 || c.ID > 0xFFFF {
+			return nil, Errorf(CodeInvalidArgument, "commitment %d: identifier %d is outside 1..65535", i, c.ID)
+		}
+		list[i] = frostcore.Commitment{ID: frostcore.IDBytes(uint16(c.ID)), Hiding: c.HidingCommit, Binding: c.BindingCommit}
+	}
+	list, err := frostcore.SortCommitments(list)
+	if err != nil {
+		return nil, Errorf(CodeInvalidArgument, "%v", err)
+	}
+	own := -1
+	for i := range list {
+		ids[i] = list[i].Identifier()
+		if int(ids[i]) == s.ID {
+			own = i
+		}
+	}
+	if own < 0 {
+		return nil, Errorf(CodeInvalidArgument, "commitment list has no commitment of participant %d", s.ID)
+	}
+	if !bytes.Equal(list[own].Hiding, p.hidingCommit) || !bytes.Equal(list[own].Binding, p.bindingCommit) {
+		return nil, Errorf(CodeInvalidArgument, "commitment list carries a different commitment for participant %d", s.ID)
+	}
+
+	rhos := frostcore.BindingFactors(req.MessageHash, list)
+	r, err := frostcore.GroupCommitment(list, rhos)
+	if err != nil {
+		return nil, Errorf(CodeInvalidArgument, "%v", err)
+	}
+	lambda, err := frostcore.Lagrange(uint16(s.ID), ids)
+	if err != nil {
+		return nil, Errorf(CodeInvalidArgument, "%v", err)
+	}
+	if s.Store != nil {
+		listHash := sha256.Sum256(frostcore.EncodeCommitments(list))
+		err := s.Store.Use(s.ID, hex.EncodeToString(p.hidingCommit), hex.EncodeToString(p.bindingCommit),
+			hex.EncodeToString(req.MessageHash), hex.EncodeToString(listHash[:]))
+		if errors.Is(err, noncestore.ErrReused) {
+			return nil, Errorf(CodePermissionDenied, "refusing to sign: %v", err)
+		}
+		if err != nil {
+			return nil, Errorf(CodeInternal, "recording nonce use: %v", err)
+		}
+	}
+
+	challenge := frostcore.PurposeChallenge(s.Purpose, r, s.GroupKey, req.MessageHash)
+	share := s.share.Int()
+	defer secret.WipeInt(share)
+	z := frostcore.PartialSig(p.hiding, p.binding, rhos[own], share, challenge, lambda)
+	return &SignResponse{ID: s.ID, PartialSig: frostcore.ScalarBytes(z)}, nil
+}
+
+// checkRequest checks the fields common to Commit and Sign.
+func (s *Signer) checkRequest(sessionID string, groupKey, msg []byte, purpose string) error {
+	if sessionID == "" {
+		return Errorf(CodeInvalidArgument, "session_id is empty")
+	}
+	if !bytes.Equal(groupKey, s.GroupKey) {
+		return Errorf(CodeNotFound, "participant %d holds no share of group %x", s.ID, groupKey)
+	}
+	if len(msg) != 32 {
+		return Errorf(CodeInvalidArgument, "message_hash: expected 32 bytes, got %d", len(msg))
+	}
+	if purpose != s.Purpose {
+		return Errorf(CodePermissionDenied, "participant %d's share is provisioned for purpose %q, not %q", s.ID, s.Purpose, purpose)
+	}
+	return nil
+}
+
+// nonce draws a nonce with nonce_generate from the share.
+func (s *Signer) nonce(context []byte) (*big.Int, error) {
+	var seed [frostcore.NonceSeedSize]byte
+	if _, err := rand.Read(seed[:]); err != nil {
+		return nil, Errorf(CodeInternal, "%v", err)
+	}
+	defer secret.Wipe(seed[:])
+	share := s.share.Int()
+	defer secret.WipeInt(share)
+	return frostcore.NonceGenerate(seed[:], share, context), nil
+}
+
+// expire drops nonces older than the TTL. Callers hold s.mu.
+func (s *Signer) expire(now time.Time) {
+	ttl := s.NonceTTL
+	if ttl == 0 {
+		ttl = DefaultNonceTTL
+	}
+	for id, p := range s.pending {
+		if now.Sub(p.created) > ttl {
+			p.destroy()
+			delete(s.pending, id)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package participant
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"testing"
+	"time"
+
+	"keygen/clock"
+	"keygen/frostcore"
+	"keygen/secret"
+)
+
+func TestNonceTTL(t *testing.T) {
+	const ttl = 10 * time.Minute
+	tests := []struct {
+		name    string
+		advance time.Duration // Between Commit and Sign
+		want    Code          // CodeOK: signs
+	}{
+		{"at once", 0, CodeOK},
+		{"within the TTL", ttl - time.Second, CodeOK},
+		{"at the TTL", ttl, CodeOK},
+		{"past the TTL", ttl + time.Second, CodeFailedPrecondition},
+		{"a day later", 24 * time.Hour, CodeFailedPrecondition},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			x, err := frostcore.RandomScalar(rand.Reader)
+			if err != nil {
+				t.Fatal(err)
+			}
+			groupKey := frostcore.BasePoint(x)
+			share, err := secret.FromInt(x) // Wipes x
+			if err != nil {
+				t.Fatal(err)
+			}
+			clk := clock.NewFake(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+			s := NewSigner(1, groupKey, share)
+			defer s.Close()
+			s.NonceTTL, s.Clock = ttl, clk
+
+			msg := bytes.Repeat([]byte{0x5a}, 32)
+			c, err := s.Commit(context.Background(), &CommitRequest{SessionID: "s1", GroupKey: groupKey, MessageHash: msg})
+			if err != nil {
+				t.Fatal(err)
+			}
+			clk.Advance(tt.advance)
+			resp, err := s.Sign(context.Background(), &SignRequest{SessionID: "s1", GroupKey: groupKey, MessageHash: msg,
+				Commitments: []Commitment{{ID: 1, HidingCommit: c.HidingCommit, BindingCommit: c.BindingCommit}}})
+			if got := CodeOf(err); got != tt.want {
+				t.Fatalf("Sign: got %v (%v), want %v", got, err, tt.want)
+			}
+			if err != nil {
+				return
+			}
+
+			// With one signer the partial signature is the signature
+			list := []frostcore.Commitment{{ID: frostcore.IDBytes(1), Hiding: c.HidingCommit, Binding: c.BindingCommit}}
+			r, err := frostcore.GroupCommitment(list, frostcore.BindingFactors(msg, list))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ok, err := frostcore.Verify(groupKey, msg, r, resp.PartialSig); !ok || err != nil {
+				t.Fatalf("signature does not verify: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,294 @@
+package participant
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// The messages of participant.proto, with the protobuf encoding written out
+// by hand: five flat messages do not justify a code generator and runtime.
+// Unknown fields are skipped, so newer peers can add fields.
+
+// CommitRequest asks a participant to commit to a session.
+type CommitRequest struct {
+	SessionID   string
+	GroupKey    []byte
+	MessageHash []byte
+	Purpose     string
+}
+
+// CommitResponse is a participant's commitment.
+type CommitResponse struct {
+	ID            int
+	HidingCommit  []byte
+	BindingCommit []byte
+	Proof         []byte
+}
+
+// Commitment is one signer's entry in a SignRequest.
+type Commitment struct {
+	ID            int
+	HidingCommit  []byte
+	BindingCommit []byte
+}
+
+// SignRequest asks a participant for its partial signature.
+type SignRequest struct {
+	SessionID   string
+	GroupKey    []byte
+	MessageHash []byte
+	Commitments []Commitment
+	Purpose     string
+}
+
+// SignResponse is a participant's partial signature.
+type SignResponse struct {
+	ID         int
+	PartialSig []byte
+}
+
+// message is a protobuf message.
+type message interface {
+	marshal() []byte
+	unmarshal([]byte) error
+}
+
+// Wire types
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+func appendTag(b []byte, num, typ int) []byte {
+	return binary.AppendUvarint(b, uint64(num)<<3|uint64(typ))
+}
+
+// appendVarint appends a varint field, omitted when zero as in proto3.
+func appendVarint(b []byte, num int, v uint64) []byte {
+	if v == 0 {
+		return b
+	}
+	return binary.AppendUvarint(appendTag(b, num, wireVarint), v)
+}
+
+// appendBytes appends a bytes, string or message field, omitted when empty.
+func appendBytes(b []byte, num int, v []byte) []byte {
+	if len(v) == 0 {
+		return b
+	}
+	b = binary.AppendUvarint(appendTag(b, num, wireBytes), uint64(len(v)))
+	return append(b, v...)
+}
+
+var errTruncated = errors.New("protobuf: truncated message")
+
+// parseFields calls f with each field of b: varints in v, length-delimited
+// fields in data. Fixed-width fields are skipped.
+func parseFields(b []byte, f func(num, typ int, v uint64, data []byte) error) error {
+	for len(b) > 0 {
+		key, n := binary.Uvarint(b)
+		if n <= 0 {
+			return errTruncated
+		}
+		b = b[n:]
+		num, typ := int(key>>3), int(key&7)
+		if num == 0 {
+			return errors.New("protobuf: field number 0")
+		}
+		var v uint64
+		var data []byte
+		switch typ {
+		case wireVarint:
+			if v, n = binary.Uvarint(b); n <= 0 {
+				return errTruncated
+			}
+			b = b[n:]
+		case wireBytes:
+			l, n := binary.Uvarint(b)
+			if n <= 0 || l > uint64(len(b)-n) {
+				return errTruncated
+			}
+			data, b = b[n:n+int(l)], b[n+int(l):]
+		case wireFixed64, wireFixed32:
+			size := 8
+			if typ == wireFixed32 {
+				size = 4
+			}
+			if len(b) < size {
+				return errTruncated
+			}
+			b = b[size:]
+			continue
+		default:
+			return fmt.Errorf("protobuf: unsupported wire type %d", typ)
+		}
+		if err := f(num, typ, v, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// field checks that field num has the wire type its message declares.
+func field(num, typ, want int) error {
+	if typ != want {
+		return fmt.Errorf("protobuf: field %d has wire type %d, want %d", num, typ, want)
+	}
+	return nil
+}
+
+// identifier converts a uint32 field to a participant ID.
+func identifier(v uint64) (int, error) {
+	if v > 0xffff {
+		return 0, fmt.Errorf("protobuf: identifier %d out of range", v)
+	}
+	return int(v), nil
+}
+
+func (m *CommitRequest) marshal() []byte {
+	b := appendBytes(nil, 1, []byte(m.SessionID))
+	b = appendBytes(b, 2, m.GroupKey)
+	b = appendBytes(b, 3, m.MessageHash)
+	return appendBytes(b, 4, []byte(m.Purpose))
+}
+
+func (m *CommitRequest) unmarshal(b []byte) error {
+	return parseFields(b, func(num, typ int, _ uint64, data []byte) error {
+		switch num {
+		case 1:
+			m.SessionID = string(data)
+		case 2:
+			m.GroupKey = data
+		case 3:
+			m.MessageHash = data
+		case 4:
+			m.Purpose = string(data)
+		default:
+			return nil
+		}
+		return field(num, typ, wireBytes)
+	})
+}
+
+func (m *CommitResponse) marshal() []byte {
+	b := appendVarint(nil, 1, uint64(m.ID))
+	b = appendBytes(b, 2, m.HidingCommit)
+	b = appendBytes(b, 3, m.BindingCommit)
+	return appendBytes(b, 4, m.Proof)
+}
+
+func (m *CommitResponse) unmarshal(b []byte) error {
+	return parseFields(b, func(num, typ int, v uint64, data []byte) error {
+		var err error
+		switch num {
+		case 1:
+			if err = field(num, typ, wireVarint); err == nil {
+				m.ID, err = identifier(v)
+			}
+			return err
+		case 2:
+			m.HidingCommit = data
+		case 3:
+			m.BindingCommit = data
+		case 4:
+			m.Proof = data
+		default:
+			return nil
+		}
+		return field(num, typ, wireBytes)
+	})
+}
+
+func (m *Commitment) marshal() []byte {
+	b := appendVarint(nil, 1, uint64(m.ID))
+	b = appendBytes(b, 2, m.HidingCommit)
+	return appendBytes(b, 3, m.BindingCommit)
+}
+
+func (m *Commitment) unmarshal(b []byte) error {
+	return parseFields(b, func(num, typ int, v uint64, data []byte) error {
+		var err error
+		switch num {
+		case 1:
+			if err = field(num, typ, wireVarint); err == nil {
+				m.ID, err = identifier(v)
+			}
+			return err
+		case 2:
+			m.HidingCommit = data
+		case 3:
+			m.BindingCommit = data
+		default:
+			return nil
+		}
+		return field(num, typ, wireBytes)
+	})
+}
+
+func (m *SignRequest) marshal() []byte {
+	b := appendBytes(nil, 1, []byte(m.SessionID))
+	b = appendBytes(b, 2, m.GroupKey)
+	b = appendBytes(b, 3, m.MessageHash)
+	for i := range m.Commitments {
+		// An empty message still takes a slot in a repeated field
+		b = appendTag(b, 4, wireBytes)
+		enc := m.Commitments[i].marshal()
+		b = binary.AppendUvarint(b, uint64(len(enc)))
+		b = append(b, enc...)
+	}
+	return appendBytes(b, 5, []byte(m.Purpose))
+}
+
+func (m *SignRequest) unmarshal(b []byte) error {
+	return parseFields(b, func(num, typ int, _ uint64, data []byte) error {
+		switch num {
+		case 1:
+			m.SessionID = string(data)
+		case 2:
+			m.GroupKey = data
+		case 3:
+			m.MessageHash = data
+		case 4:
+			if err := field(num, typ, wireBytes); err != nil {
+				return err
+			}
+			var c Commitment
+			if err := c.unmarshal(data); err != nil {
+				return err
+			}
+			m.Commitments = append(m.Commitments, c)
+			return nil
+		case 5:
+			m.Purpose = string(data)
+		default:
+			return nil
+		}
+		return field(num, typ, wireBytes)
+	})
+}
+
+func (m *SignResponse) marshal() []byte {
+	b := appendVarint(nil, 1, uint64(m.ID))
+	return appendBytes(b, 2, m.PartialSig)
+}
+
+func (m *SignResponse) unmarshal(b []byte) error {
+	return parseFields(b, func(num, typ int, v uint64, data []byte) error {
+		var err error
+		switch num {
+		case 1:
+			if err = field(num, typ, wireVarint); err == nil {
+				m.ID, err = identifier(v)
+			}
+			return err
+		case 2:
+			m.PartialSig = data
+		default:
+			return nil
+		}
+		return field(num, typ, wireBytes)
+	})
+}
@@ -0,0 +1,311 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"keygen/coordinator"
+	"keygen/diag"
+	"keygen/frostcore"
+	"keygen/participant"
+	"keygen/schema"
+	"keygen/secret"
+	"keygen/workspace"
+)
+
+// Bearer tokens of remote participants and of a remote coordinator, read
+// from the environment so they do not show in the process list.
+const (
+	participantTokenEnv = "FY_LEDGER_PARTICIPANT_TOKEN"
+	coordinatorTokenEnv = "FY_LEDGER_COORDINATOR_TOKEN"
+)
+
+// The client certificate presented to coordinators and remote participants
+// that require one (serve -client-ca, participant serve -client-ca), and the
+// CA their server certificates are checked against instead of the system
+// roots.
+const (
+	tlsClientCertEnv = "FY_LEDGER_TLS_CLIENT_CERT"
+	tlsClientKeyEnv  = "FY_LEDGER_TLS_CLIENT_KEY"
+	tlsCAEnv         = "FY_LEDGER_TLS_CA"
+)
+
+const (
+	participantUsage     = "Usage: keygen participant <serve|sign> [options]"
+	participantSignUsage = "Usage: keygen participant sign (-message hash | -coordinator url -session id) -remote id=url... [-group-state f]"
+)
+
+// runParticipant implements the participant subcommands:
+//
+//	participant serve -share f [-id n] [-listen addr]       serve one share as a remote participant (gRPC)
+//	participant sign -message hash -remote id=url...        sign with remote participants
+func runParticipant(args []string, ws *workspace.Context) {
+	if len(args) < 1 {
+		fail(KindUsage, participantUsage)
+	}
+	switch args[0] {
+	case "serve":
+		runParticipantServe(args[1:])
+	case "sign":
+		runParticipantSign(args[1:], ws)
+	default:
+		fail(KindUsage, participantUsage)
+	}
+}
+
+// runParticipantServe serves a share as the Participant gRPC service
+// (participant/participant.proto), so a coordinator can fan signing out to
+// it. Calls need the bearer token in $FY_LEDGER_PARTICIPANT_TOKEN.
+func runParticipantServe(args []string) {
+	cmd := flag.NewFlagSet("participant serve", flag.ExitOnError)
+	sharePath := cmd.String("share", "", "Share file, encrypted or plaintext (required)")
+	passFile := cmd.String("passphrase-file", "", "Passphrase of an encrypted -share (default: prompt)")
+	id := cmd.Int("id", 0, "Participant to serve, for share files holding several")
+	listen := cmd.String("listen", "127.0.0.1:8430", "Address to serve the participant on")
+	storePath := nonceStoreFlag(cmd)
+	nonceTTL := cmd.Duration("nonce-ttl", participant.DefaultNonceTTL, "Drop nonces not used to sign within this long")
+	tlsCert := cmd.String("tls-cert", "", "Serve over TLS with this certificate (PEM)")
+	tlsKey := cmd.String("tls-key", "", "Private key of -tls-cert (PEM)")
+	clientCA := cmd.String("client-ca", "", "Require client certificates issued by this CA (PEM), e.g. the coordinator's")
+	debugListen := debugFlag(cmd)
+	stdioFlags(cmd)
+	cmd.Parse(args)
+
+	if *sharePath == "" || cmd.NArg() != 0 {
+		fail(KindUsage, "Usage: keygen participant serve -share f [-id n] [-listen addr] [-tls-cert c -tls-key k [-client-ca ca]]")
+	}
+	if (*tlsCert == "") != (*tlsKey == "") {
+		fail(KindUsage, "Error: give both -tls-cert and -tls-key")
+	}
+	if *clientCA != "" && *tlsCert == "" {
+		fail(KindUsage, "Error: -client-ca needs -tls-cert and -tls-key")
+	}
+	token := os.Getenv(participantTokenEnv)
+	if token == "" {
+		fail(KindUsage, "Error: participant serve requires a token in $%s", participantTokenEnv)
+	}
+
+	share := loadSigningShare(*sharePath, *passFile, *id)
+	groupKey, err := hex.DecodeString(share.GroupKey)
+	if err != nil || len(groupKey) != 32 {
+		fail(KindInput, "Error: %s: malformed group_key", *sharePath)
+	}
+	signer := participant.NewSigner(share.Participant, groupKey, share.SecretShare)
+	defer signer.Close()
+	signer.Purpose = share.Purpose
+	signer.NonceTTL = *nonceTTL
+	if store := openNonceStore(*storePath); store != nil {
+		defer store.Close()
+		signer.Store = store
+	}
+
+	ctx, stop := secret.NotifyContext(context.Background())
+	defer stop()
+	serveDebug(*debugListen, map[string]diag.Source{
+		"participant": func() any {
+			return map[string]any{"id": signer.ID, "group_key": share.GroupKey, "purpose": share.Purpose, "ops": frostcore.ReadOps()}
+		},
+	})
+	var protocols http.Protocols
+	protocols.SetHTTP2(true)
+	protocols.SetUnencryptedHTTP2(*tlsCert == "")
+	srv := &http.Server{
+		Addr:              *listen,
+		Handler:           participant.GRPCHandler(signer, token),
+		Protocols:         &protocols,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	if *clientCA != "" {
+		srv.TLSConfig = &tls.Config{ClientCAs: loadCertPool(*clientCA), ClientAuth: tls.RequireAndVerifyClientCert}
+	}
+	// On a signal, let in-flight requests finish before the deferred
+	// signer.Close and main's DestroyAll wipe the share under them
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		<-ctx.Done()
+		drain, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if srv.Shutdown(drain) != nil {
+			srv.Close()
+		}
+	}()
+
+	fmt.Fprintf(os.Stderr, "Participant %d of group %s", share.Participant, share.GroupKey)
+	if share.Purpose != "" {
+		fmt.Fprintf(os.Stderr, ", purpose %s", share.Purpose)
+	}
+	fmt.Fprintln(os.Stderr)
+	if *tlsCert != "" {
+		fmt.Fprintf(os.Stderr, "Serving on https://%s\n", *listen)
+		err = srv.ListenAndServeTLS(*tlsCert, *tlsKey)
+	} else {
+		fmt.Fprintf(os.Stderr, "Serving on http://%s (h2c, no TLS: the token travels in the clear)\n", *listen)
+		err = srv.ListenAndServe()
+	}
+	if err != nil && err != http.ErrServerClosed {
+		fail(KindFailure, "Error: %v", err)
+	}
+	<-stopped
+}
+
+// runParticipantSign signs a message with remote participants
+// (participant.Fanout). Without -coordinator it coordinates in process for
+// the -group-state group; with it, it creates the session on that
+// coordinator, or joins -session, authenticating with
+// $FY_LEDGER_COORDINATOR_TOKEN. It prints the final session.
+func runParticipantSign(args []string, ws *workspace.Context) {
+	cmd := flag.NewFlagSet("participant sign", flag.ExitOnError)
+	message := cmd.String("message", "", "Message hash to sign (32 bytes hex)")
+	groupStatePath := cmd.String("group-state", ws.GroupState, "Group-state document of the group")
+	coordURL := cmd.String("coordinator", "", "URL of a coordinator run with keygen serve (default: in process)")
+	sessionID := cmd.String("session", "", "Join this session on -coordinator instead of creating one")
+	requireProofs := cmd.Bool("require-proofs", false, "Require commitment proofs")
+	timeout := cmd.Duration("timeout", 5*time.Minute, "Give up after this long")
+	remotes := make(map[int]participant.Service)
+	token := os.Getenv(participantTokenEnv)
+	tlsClient := clientTLS()
+	cmd.Func("remote", "Remote participant as id=url, e.g. 2=http://10.0.0.2:8430 (repeatable)", func(s string) error {
+		idStr, url, ok := strings.Cut(s, "=")
+		id, err := strconv.Atoi(idStr)
+		if !ok || err != nil || id < 1 {
+			return fmt.Errorf("expected id=url, got %q", s)
+		}
+		if _, dup := remotes[id]; dup {
+			return fmt.Errorf("participant %d given twice", id)
+		}
+		remotes[id] = &participant.Client{URL: url, Token: token, TLS: tlsClient}
+		return nil
+	})
+	stdioFlags(cmd)
+	cmd.Parse(args)
+
+	if cmd.NArg() != 0 || len(remotes) == 0 || (*sessionID == "") == (*message == "") {
+		fail(KindUsage, participantSignUsage)
+	}
+	if *sessionID != "" && *coordURL == "" {
+		fail(KindUsage, "Error: -session joins a session on -coordinator")
+	}
+	if *sessionID == "" && *groupStatePath == "" {
+		fail(KindUsage, "Error: give the group with -group-state")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+	ctx, stop := secret.NotifyContext(ctx)
+	defer stop()
+
+	var h coordinator.Handler
+	if *coordURL != "" {
+		h = coordinatorClient(*coordURL)
+	} else {
+		c := coordinator.New()
+		c.AddGroup(loadGroupState(*groupStatePath))
+		if *requireProofs {
+			c.RequireCommitmentProofs()
+		}
+		h = c
+	}
+
+	id := *sessionID
+	if id == "" {
+		signers := make([]int, 0, len(remotes))
+		for id := range remotes {
+			signers = append(signers, id)
+		}
+		doc := loadGroupState(*groupStatePath)
+		body, _ := json.Marshal(coordinator.CreateSessionParams{
+			GroupKey:                doc.GroupKey,
+			MessageHash:             *message,
+			Purpose:                 doc.Purpose,
+			Signers:                 signers,
+			RequireCommitmentProofs: *requireProofs,
+		})
+		resp, err := h.Handle(ctx, &coordinator.Request{Op: coordinator.OpCreateSession, Body: body})
+		if err != nil {
+			fail(KindTransport, "Error creating session: %v", err)
+		}
+		var s coordinator.Session
+		b, ok := resp.Body.(json.RawMessage)
+		if !ok {
+			b, _ = json.Marshal(resp.Body)
+		}
+		if err := schema.Unmarshal(b, &s, coordinator.OpCreateSession); err != nil {
+			fail(KindTransport, "Error creating session: %v", err)
+		}
+		id = s.ID
+		fmt.Fprintf(os.Stderr, "Created session %s\n", id)
+	}
+
+	s, err := participant.Fanout(ctx, h, id, remotes)
+	if s != nil {
+		writeJSON(s)
+	}
+	if err != nil {
+		kind := KindTransport
+		if s != nil && s.Result != nil && !s.Result.Valid {
+			kind = KindCrypto
+		}
+		fail(kind, "Error: %v", err)
+	}
+}
+
+// coordinatorClient returns a client of the coordinator at url,
+// authenticating with $FY_LEDGER_COORDINATOR_TOKEN and the client
+// certificate of clientTLS.
+func coordinatorClient(url string) *coordinator.Client {
+	c := &coordinator.Client{URL: url, Token: os.Getenv(coordinatorTokenEnv)}
+	if conf := clientTLS(); conf != nil {
+		c.HTTP = &http.Client{Transport: &http.Transport{TLSClientConfig: conf, ForceAttemptHTTP2: true}}
+	}
+	return c
+}
+
+// clientTLS returns the TLS configuration of connections to coordinators
+// and remote participants: the client certificate of
+// $FY_LEDGER_TLS_CLIENT_CERT and $FY_LEDGER_TLS_CLIENT_KEY, and the server
+// CA of $FY_LEDGER_TLS_CA. It returns nil when none is set.
+func clientTLS() *tls.Config {
+	certPath, keyPath, caPath := os.Getenv(tlsClientCertEnv), os.Getenv(tlsClientKeyEnv), os.Getenv(tlsCAEnv)
+	if certPath == "" && keyPath == "" && caPath == "" {
+		return nil
+	}
+	if (certPath == "") != (keyPath == "") {
+		fail(KindUsage, "Error: set both $%s and $%s", tlsClientCertEnv, tlsClientKeyEnv)
+	}
+	conf := &tls.Config{MinVersion: tls.VersionTLS12}
+	if certPath != "" {
+		cert, err := tls.LoadX509KeyPair(certPath, keyPath)
+		if err != nil {
+			fail(KindInput, "Error loading the client certificate: %v", err)
+		}
+		conf.Certificates = []tls.Certificate{cert}
+	}
+	if caPath != "" {
+		conf.RootCAs = loadCertPool(caPath)
+	}
+	return conf
+}
+
+// loadCertPool reads the PEM certificates of a CA file.
+func loadCertPool(path string) *x509.CertPool {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		fail(KindInput, "Error reading %s: %v", path, err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		fail(KindInput, "Error: %s holds no PEM certificates", path)
+	}
+	return pool
+}
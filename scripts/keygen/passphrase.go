@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"keygen/keystore"
+	"keygen/schema"
+	"keygen/secret"
+)
+
+// writeEncryptedShares writes participant-<id>.share.json per share, each
+// encrypted under its own passphrase (or a shared one, see loadPassphrases).
+func writeEncryptedShares(outDir, passphraseFile string, shares []KeyShareOutput) {
+	passphrases := loadPassphrases(passphraseFile, len(shares), true)
+	if err := os.MkdirAll(outDir, 0700); err != nil {
+		fail(KindFailure, "Error creating %s: %v", outDir, err)
+	}
+	for i, s := range shares {
+		plaintext, _ := json.Marshal(s)
+		f, err := keystore.Seal(plaintext, s.Participant, s.GroupKey, s.PublicShare, s.Purpose, passphrases(s.Participant))
+		secret.Wipe(plaintext)
+		if err != nil {
+			fail(KindFailure, "Error encrypting share %d: %v", s.Participant, err)
+		}
+		data, _ := jsonOutput(f)
+		path := shareFilePath(outDir, s.Participant)
+		writeNewFile(path, data, 0600)
+		shares[i].SecretShare.Destroy()
+		shares[i].SecretShare = nil
+		fmt.Fprintf(os.Stderr, "Wrote %s\n", path)
+	}
+}
+
+// openShareFile decrypts an encrypted share file read from path.
+func openShareFile(path string, data []byte, passphraseFile string) KeyShareOutput {
+	var f keystore.File
+	if err := schema.Unmarshal(data, &f, path); err != nil {
+		fail(KindInput, "Error: %s: %v", path, err)
+	}
+	if f.Standby != "" {
+		fail(KindInput, "Error: %s is a standby copy of participant %d's share; activate it with keygen standby activate", path, f.Participant)
+	}
+	passphrase := loadPassphrases(passphraseFile, 0, false)(f.Participant)
+	plaintext, err := f.Open(passphrase)
+	if err != nil {
+		fail(KindCrypto, "Error: %s: %v", path, err)
+	}
+	var share KeyShareOutput
+	err = schema.Unmarshal(plaintext, &share, path)
+	secret.Wipe(plaintext)
+	if err != nil {
+		fail(KindInput, "Error: %s: %v", path, err)
+	}
+	if share.Participant != f.Participant || share.GroupKey != f.GroupKey || share.PublicShare != f.PublicShare || share.Purpose != f.Purpose {
+		fail(KindCrypto, "Error: %s: encrypted share does not match its header", path)
+	}
+	return share
+}
+
+// loadSigningShare reads participant id's share from an encrypted share file
+// or a plain share or keygen output.
+func loadSigningShare(path, passphraseFile string, id int) KeyShareOutput {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		fail(KindInput, "Error reading %s: %v", path, err)
+	}
+	if keystore.IsEncrypted(data) {
+		return openShareFile(path, data, passphraseFile)
+	}
+	return *selectShare(path, id)
+}
+
+// loadPassphrases returns the passphrase for each participant: from a file
+// holding one line for all participants or one line per participant (n
+// lines, if n is known), or prompted for on the terminal (twice when confirm
+// is set).
+func loadPassphrases(path string, n int, confirm bool) func(participant int) []byte {
+	if path == "" {
+		return func(participant int) []byte {
+			p, err := promptPassphrase(fmt.Sprintf("Passphrase for participant %d: ", participant))
+			if err == nil && confirm {
+				var again []byte
+				if again, err = promptPassphrase("Repeat passphrase: "); err == nil && !bytes.Equal(p, again) {
+					err = fmt.Errorf("passphrases do not match")
+				}
+			}
+			if err == nil && len(p) == 0 {
+				err = fmt.Errorf("empty passphrase")
+			}
+			if err != nil {
+				fail(KindInput, "Error: %v", err)
+			}
+			return p
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		fail(KindInput, "Error reading passphrase file: %v", err)
+	}
+	lines := bytes.Split(bytes.TrimRight(data, "\r\n"), []byte("\n"))
+	for i := range lines {
+		lines[i] = bytes.TrimSuffix(lines[i], []byte("\r"))
+		if len(lines[i]) == 0 {
+			fail(KindInput, "Error: %s: line %d is empty", path, i+1)
+		}
+	}
+	if len(lines) != 1 && n > 0 && len(lines) != n {
+		fail(KindInput, "Error: %s: expected 1 line or %d lines (one per participant), got %d", path, n, len(lines))
+	}
+	return func(participant int) []byte {
+		if len(lines) == 1 {
+			return lines[0]
+		}
+		if participant < 1 || participant > len(lines) {
+			fail(KindInput, "Error: %s has no line for participant %d", path, participant)
+		}
+		return lines[participant-1]
+	}
+}
+
+// promptPassphrase reads a line from the terminal with echo off. stdin is
+// left alone, since commands read their JSON input from it.
+func promptPassphrase(prompt string) ([]byte, error) {
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		return nil, fmt.Errorf("no terminal to prompt for a passphrase; use -passphrase-file")
+	}
+	defer tty.Close()
+	fmt.Fprint(tty, prompt)
+	if err := stty(tty, "-echo"); err != nil {
+		return nil, fmt.Errorf("cannot turn off terminal echo (%v); use -passphrase-file", err)
+	}
+	line, err := bufio.NewReader(tty).ReadBytes('\n')
+	stty(tty, "echo")
+	fmt.Fprintln(tty)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.TrimRight(line, "\r\n"), nil
+}
+
+// promptLine reads a line from the terminal, echoed.
+func promptLine(prompt string) (string, error) {
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		return "", fmt.Errorf("no terminal to prompt on")
+	}
+	defer tty.Close()
+	fmt.Fprint(tty, prompt)
+	line, err := bufio.NewReader(tty).ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func stty(tty *os.File, arg string) error {
+	cmd := exec.Command("stty", arg)
+	cmd.Stdin = tty
+	return cmd.Run()
+}
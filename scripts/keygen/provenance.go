@@ -0,0 +1,316 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"keygen/frostcore"
+)
+
+// Provenance: an in-toto statement, with a SLSA provenance predicate, of how
+// a signature was produced, in a DSSE envelope threshold-signed by the same
+// group. The statement's subject is the signature (signatureImprint), so the
+// provenance cannot be moved to another signature; the group signs the
+// SHA-256 of the envelope's PAE, since devices sign 32-byte hashes.
+const (
+	inTotoPayloadType  = "application/vnd.in-toto+json"
+	inTotoStatementV1  = "https://in-toto.io/Statement/v1"
+	slsaProvenanceV1   = "https://slsa.dev/provenance/v1"
+	provenanceBuild    = "https://github.com/f3rmion/fy-ledger/threshold-signature/v1"
+	provenanceBuilder  = "https://github.com/f3rmion/fy-ledger/keygen"
+	provenanceSubject  = "fy-ledger-signature"
+	provenanceDigestID = "sha256"
+)
+
+// ProvenanceEnvelope is a DSSE envelope of an in-toto statement.
+type ProvenanceEnvelope struct {
+	PayloadType string                `json:"payloadType"`
+	Payload     string                `json:"payload"` // Base64 of the statement
+	Signatures  []ProvenanceSignature `json:"signatures"`
+}
+
+// ProvenanceSignature is the group's signature of an envelope: R || z in
+// base64, under the group key as keyid.
+type ProvenanceSignature struct {
+	KeyID string `json:"keyid"`
+	Sig   string `json:"sig"`
+}
+
+// InTotoStatement is an in-toto v1 statement with a SLSA v1 provenance
+// predicate.
+type InTotoStatement struct {
+	Type          string               `json:"_type"`
+	Subject       []ResourceDescriptor `json:"subject"`
+	PredicateType string               `json:"predicateType"`
+	Predicate     SLSAProvenance       `json:"predicate"`
+}
+
+// ResourceDescriptor names an artifact by its digests.
+type ResourceDescriptor struct {
+	Name   string            `json:"name,omitempty"`
+	URI    string            `json:"uri,omitempty"`
+	Digest map[string]string `json:"digest"`
+}
+
+// SLSAProvenance is the SLSA v1 provenance predicate of a signing ceremony.
+type SLSAProvenance struct {
+	BuildDefinition struct {
+		BuildType            string               `json:"buildType"`
+		ExternalParameters   ProvenanceParameters `json:"externalParameters"`
+		ResolvedDependencies []ResourceDescriptor `json:"resolvedDependencies,omitempty"` // The runbooks and the keygen binary
+	} `json:"buildDefinition"`
+	RunDetails struct {
+		Builder struct {
+			ID      string            `json:"id"`
+			Version map[string]string `json:"version,omitempty"`
+		} `json:"builder"`
+		Metadata struct {
+			InvocationID string    `json:"invocationId,omitempty"`
+			FinishedOn   time.Time `json:"finishedOn,omitzero"`
+		} `json:"metadata"`
+	} `json:"runDetails"`
+}
+
+// ProvenanceParameters are what the ceremony signed and who took part.
+type ProvenanceParameters struct {
+	GroupKey    string   `json:"group_key"`
+	MessageHash string   `json:"message_hash"`
+	Purpose     string   `json:"purpose,omitempty"`
+	Operators   []string `json:"operators,omitempty"`
+}
+
+// pae is DSSE's pre-authentication encoding of a payload.
+func pae(payloadType string, payload []byte) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "DSSEv1 %d %s %d ", len(payloadType), payloadType, len(payload))
+	b.Write(payload)
+	return b.Bytes()
+}
+
+// messageHash is the message the group signs for the envelope: the SHA-256
+// of its PAE.
+func (e *ProvenanceEnvelope) messageHash() ([]byte, error) {
+	payload, err := base64.StdEncoding.DecodeString(e.Payload)
+	if err != nil {
+		return nil, fmt.Errorf("payload: %w", err)
+	}
+	h := sha256.Sum256(pae(e.PayloadType, payload))
+	return h[:], nil
+}
+
+// statement decodes the envelope's statement.
+func (e *ProvenanceEnvelope) statement() (*InTotoStatement, error) {
+	if e.PayloadType != inTotoPayloadType {
+		return nil, fmt.Errorf("payload type %q is not %s", e.PayloadType, inTotoPayloadType)
+	}
+	payload, err := base64.StdEncoding.DecodeString(e.Payload)
+	if err != nil {
+		return nil, fmt.Errorf("payload: %w", err)
+	}
+	var s InTotoStatement
+	if err := json.Unmarshal(payload, &s); err != nil {
+		return nil, fmt.Errorf("statement: %w", err)
+	}
+	if s.Type != inTotoStatementV1 || s.PredicateType != slsaProvenanceV1 {
+		return nil, fmt.Errorf("statement is not an in-toto v1 statement of SLSA v1 provenance")
+	}
+	return &s, nil
+}
+
+// checkProvenance checks a signature's provenance: its statement is about
+// this signature, and the group signed the envelope under the same key and
+// purpose.
+func checkProvenance(sig *AggregateOutput) error {
+	e := sig.Provenance
+	s, err := e.statement()
+	if err != nil {
+		return err
+	}
+	imprint, err := signatureImprint(sig)
+	if err != nil {
+		return err
+	}
+	if len(s.Subject) != 1 || s.Subject[0].Digest[provenanceDigestID] != hex.EncodeToString(imprint) {
+		return fmt.Errorf("provenance is about another signature")
+	}
+	msg, err := e.messageHash()
+	if err != nil {
+		return err
+	}
+	for _, ps := range e.Signatures {
+		if ps.KeyID != sig.GroupKey {
+			continue
+		}
+		rz, err := base64.StdEncoding.DecodeString(ps.Sig)
+		if err != nil || len(rz) != 64 {
+			return fmt.Errorf("provenance signature: expected 64 bytes of base64")
+		}
+		valid, err := frostcore.VerifyPurpose(sig.Purpose, hexBytes(sig.GroupKey), msg, rz[:32], rz[32:])
+		if err != nil || !valid {
+			return fmt.Errorf("provenance signature does not verify (%v)", err)
+		}
+		return nil
+	}
+	return fmt.Errorf("provenance is not signed by group %s", sig.GroupKey)
+}
+
+// builderVersion describes the running keygen binary from its build info.
+func builderVersion() map[string]string {
+	v := map[string]string{}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		v["keygen"] = info.Main.Version
+		v["go"] = info.GoVersion
+		for _, s := range info.Settings {
+			switch s.Key {
+			case "vcs.revision", "vcs.time", "vcs.modified":
+				v[s.Key] = s.Value
+			}
+		}
+	}
+	return v
+}
+
+// fileDescriptor names a file by its SHA-256, exiting if it cannot be read.
+func fileDescriptor(name, path string) ResourceDescriptor {
+	f, err := os.Open(path)
+	if err != nil {
+		fail(KindInput, "Error: %v", err)
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		fail(KindInput, "Error reading %s: %v", path, err)
+	}
+	return ResourceDescriptor{Name: name, Digest: map[string]string{provenanceDigestID: hex.EncodeToString(h.Sum(nil))}}
+}
+
+// runProvenance implements the provenance subcommands:
+//
+//	provenance new -signature sig.json [-runbook f]... [-operator name]...  print the unsigned envelope
+//	provenance attach -signature sig.json -envelope env.json -envelope-signature s.json
+//
+// The operators sign the message hash new prints in an ordinary signing
+// session of the same group; attach checks that signature and adds the
+// signed envelope to the signature as its provenance, which verify
+// -signature then checks too.
+func runProvenance(args []string) {
+	if len(args) < 1 || (args[0] != "new" && args[0] != "attach") {
+		fail(KindUsage, "Usage: keygen provenance <new|attach> -signature sig.json [options]")
+	}
+	cmd := flag.NewFlagSet("provenance "+args[0], flag.ExitOnError)
+	sigPath := cmd.String("signature", "", "Signature the provenance is about, as aggregate prints it (required)")
+	groupKey := cmd.String("group-key", "", "Group key, if the signature file has none")
+	message := cmd.String("message", "", "Message hash, if the signature file has none")
+	var runbooks, operators []string
+	var envelopePath, envSigPath, invocation *string
+	if args[0] == "new" {
+		cmd.Func("runbook", "Runbook or ceremony file followed, recorded by SHA-256 (repeatable)", func(s string) error {
+			runbooks = append(runbooks, s)
+			return nil
+		})
+		cmd.Func("operator", "Operator who took part (repeatable)", func(s string) error {
+			operators = append(operators, s)
+			return nil
+		})
+		invocation = cmd.String("invocation", "", "Identifier of the ceremony, e.g. its session name")
+	} else {
+		envelopePath = cmd.String("envelope", "", "Envelope printed by provenance new (required)")
+		envSigPath = cmd.String("envelope-signature", "", "The group's signature of the envelope, as aggregate prints it (required)")
+	}
+	stdioFlags(cmd)
+	cmd.Parse(args[1:])
+	if *sigPath == "" || cmd.NArg() != 0 {
+		fail(KindUsage, "Usage: keygen provenance <new|attach> -signature sig.json [options]")
+	}
+
+	var sig AggregateOutput
+	readJSONFile(*sigPath, &sig)
+	if sig.GroupKey == "" {
+		sig.GroupKey = strings.ToLower(*groupKey)
+	}
+	if sig.MessageHash == "" {
+		sig.MessageHash = strings.ToLower(*message)
+	}
+	if sig.GroupKey == "" || sig.MessageHash == "" {
+		fail(KindInput, "Error: %s has no group_key or message_hash; give -group-key and -message", *sigPath)
+	}
+	// Never vouch for a signature that does not verify
+	valid, err := frostcore.VerifyPurpose(sig.Purpose, decodeHex("group_key", sig.GroupKey), decodeHex("message_hash", sig.MessageHash),
+		decodeHex("R", sig.R), decodeHex("z", sig.Z))
+	if err != nil || !valid {
+		fail(KindCrypto, "Error: %s does not verify (%v)", *sigPath, err)
+	}
+	imprint, err := signatureImprint(&sig)
+	if err != nil {
+		fail(KindInput, "Error: %s: %v", *sigPath, err)
+	}
+
+	switch args[0] {
+	case "new":
+		s := InTotoStatement{
+			Type:          inTotoStatementV1,
+			Subject:       []ResourceDescriptor{{Name: provenanceSubject, Digest: map[string]string{provenanceDigestID: hex.EncodeToString(imprint)}}},
+			PredicateType: slsaProvenanceV1,
+		}
+		p := &s.Predicate
+		p.BuildDefinition.BuildType = provenanceBuild
+		p.BuildDefinition.ExternalParameters = ProvenanceParameters{
+			GroupKey: sig.GroupKey, MessageHash: sig.MessageHash, Purpose: sig.Purpose, Operators: operators,
+		}
+		for _, path := range runbooks {
+			p.BuildDefinition.ResolvedDependencies = append(p.BuildDefinition.ResolvedDependencies, fileDescriptor(path, path))
+		}
+		if exe, err := os.Executable(); err == nil {
+			p.BuildDefinition.ResolvedDependencies = append(p.BuildDefinition.ResolvedDependencies, fileDescriptor("keygen", exe))
+		}
+		p.RunDetails.Builder.ID = provenanceBuilder
+		p.RunDetails.Builder.Version = builderVersion()
+		p.RunDetails.Metadata.InvocationID = *invocation
+		p.RunDetails.Metadata.FinishedOn = time.Now().UTC().Truncate(time.Second)
+		if sig.Timestamp != nil {
+			p.RunDetails.Metadata.FinishedOn = sig.Timestamp.GenTime
+		}
+		payload, err := json.Marshal(s)
+		if err != nil {
+			fail(KindFailure, "Error: %v", err)
+		}
+		e := ProvenanceEnvelope{PayloadType: inTotoPayloadType, Payload: base64.StdEncoding.EncodeToString(payload), Signatures: []ProvenanceSignature{}}
+		msg, _ := e.messageHash()
+		fmt.Fprintf(os.Stderr, "Have the group sign message hash %x, then run provenance attach\n", msg)
+		writeJSON(e)
+
+	case "attach":
+		if *envelopePath == "" || *envSigPath == "" {
+			fail(KindUsage, "Usage: keygen provenance attach -signature sig.json -envelope env.json -envelope-signature s.json")
+		}
+		var e ProvenanceEnvelope
+		readJSONFile(*envelopePath, &e)
+		var envSig AggregateOutput
+		readJSONFile(*envSigPath, &envSig)
+		msg, err := e.messageHash()
+		if err != nil {
+			fail(KindInput, "Error: %s: %v", *envelopePath, err)
+		}
+		if envSig.MessageHash != "" && envSig.MessageHash != hex.EncodeToString(msg) {
+			fail(KindInput, "Error: %s signs message hash %s, not the envelope's %x", *envSigPath, envSig.MessageHash, msg)
+		}
+		r, z := decodeHex("R", envSig.R), decodeHex("z", envSig.Z)
+		e.Signatures = []ProvenanceSignature{{KeyID: sig.GroupKey, Sig: base64.StdEncoding.EncodeToString(append(r, z...))}}
+		sig.Provenance = &e
+		if err := checkProvenance(&sig); err != nil {
+			fail(KindCrypto, "Error: %v", err)
+		}
+		fmt.Fprintf(os.Stderr, "Attached provenance signed by group %s\n", sig.GroupKey)
+		writeJSON(sig)
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+
+	"keygen/frostcore"
+	"keygen/secret"
+)
+
+// purposeName names a purpose tag in messages.
+func purposeName(purpose string) string {
+	if purpose == "" {
+		return "no purpose (untagged)"
+	}
+	return fmt.Sprintf("purpose %q", purpose)
+}
+
+// purposePartialSig computes the signer's partial signature with the
+// challenge bound to purpose (frostcore.PurposeChallenge), over the
+// participants' commitments in canonical order, as the app does for a
+// purpose-tagged share.
+func purposePartialSig(purpose string, msg, groupKey []byte, participants []ParticipantInput, signer *ParticipantInput) ([]byte, error) {
+	list, err := commitmentList(participants)
+	if err == nil {
+		list, err = frostcore.SortCommitments(list)
+	}
+	if err != nil {
+		return nil, err
+	}
+	own := -1
+	ids := make([]uint16, len(list))
+	for i := range list {
+		ids[i] = list[i].Identifier()
+		if int(ids[i]) == signer.ID {
+			own = i
+		}
+	}
+	if own < 0 {
+		return nil, fmt.Errorf("participant %d is not in the commitment list", signer.ID)
+	}
+
+	rhos := frostcore.BindingFactors(msg, list)
+	r, err := frostcore.GroupCommitment(list, rhos)
+	if err != nil {
+		return nil, err
+	}
+	lambda, err := frostcore.Lagrange(uint16(signer.ID), ids)
+	if err != nil {
+		return nil, err
+	}
+	challenge := frostcore.PurposeChallenge(purpose, r, groupKey, msg)
+
+	share, hiding, binding := signer.SecretShare.Int(), signer.HidingNonce.Int(), signer.BindingNonce.Int()
+	defer secret.WipeInt(share)
+	defer secret.WipeInt(hiding)
+	defer secret.WipeInt(binding)
+	z := frostcore.PartialSig(hiding, binding, rhos[own], share, challenge, lambda)
+	return frostcore.ScalarBytes(z), nil
+}
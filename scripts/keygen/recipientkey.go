@@ -0,0 +1,147 @@
+package main
+
+import (
+	"crypto/ecdh"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"strings"
+
+	"keygen/ecies"
+	"keygen/frostcore"
+	"keygen/h2c"
+	"keygen/secret"
+)
+
+// RecipientKey describes a key written by recipient-key.
+type RecipientKey struct {
+	PublicKey string `json:"public_key"`
+	File      string `json:"file"`
+}
+
+// runRecipientKey creates the key a participant receives sub-shares under in
+// resharing, refresh and enrollment:
+//
+//	recipient-key -key f
+//
+// The participant hands the public key to whoever starts the session, which
+// lists every recipient's key. Contributors seal each sub-share to its
+// recipient's key and write it to a file of its own, so the files of a
+// ceremony can pass through any hands: only the holder of the key opens
+// what is addressed to it.
+func runRecipientKey(args []string) {
+	cmd := flag.NewFlagSet("recipient-key", flag.ExitOnError)
+	out := cmd.String("key", "", "Write the private key here (required)")
+	stdioFlags(cmd)
+	cmd.Parse(args)
+	if *out == "" || cmd.NArg() != 0 {
+		fail(KindUsage, "Usage: keygen recipient-key -key f")
+	}
+	key, err := ecies.NewKey(rand.Reader)
+	if err != nil {
+		fail(KindFailure, "Error: %v", err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		fail(KindFailure, "Error: %v", err)
+	}
+	writeNewFile(*out, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600)
+	secret.Wipe(der)
+	fmt.Fprintf(os.Stderr, "Wrote %s; give the public key to whoever starts the session\n", *out)
+	writeJSON(RecipientKey{PublicKey: hex.EncodeToString(key.PublicKey().Bytes()), File: *out})
+}
+
+// loadRecipientKey reads a key written by recipient-key.
+func loadRecipientKey(path string) *ecdh.PrivateKey {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		fail(KindInput, "Error reading %s: %v", path, err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "PRIVATE KEY" {
+		fail(KindInput, "Error: %s: expected a PEM PRIVATE KEY block", path)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		fail(KindInput, "Error: %s: %v", path, err)
+	}
+	k, ok := key.(*ecdh.PrivateKey)
+	if !ok || k.Curve() != ecdh.X25519() {
+		fail(KindInput, "Error: %s: not an X25519 key written by recipient-key", path)
+	}
+	return k
+}
+
+// parseRecipientKeys parses n comma-separated public keys, in the order of
+// the recipients.
+func parseRecipientKeys(s string, n int) ([]string, error) {
+	if s == "" {
+		return nil, errors.New("the recipients' keys are required (keygen recipient-key)")
+	}
+	var keys []string
+	for _, f := range strings.Split(s, ",") {
+		k := strings.ToLower(strings.TrimSpace(f))
+		if _, err := recipientPublicKey(k); err != nil {
+			return nil, fmt.Errorf("key %d: %w", len(keys)+1, err)
+		}
+		keys = append(keys, k)
+	}
+	if len(keys) != n {
+		return nil, fmt.Errorf("%d keys for %d recipients", len(keys), n)
+	}
+	return keys, nil
+}
+
+func recipientPublicKey(s string) (*ecdh.PublicKey, error) {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return nil, errors.New("malformed hex")
+	}
+	return ecies.ParsePublicKey(b)
+}
+
+// subShareAAD binds a sealed scalar to its session, sender and recipient.
+func subShareAAD(session string, from, to int) []byte {
+	return h2c.Context([]byte(session), binary.BigEndian.AppendUint16(nil, uint16(from)), binary.BigEndian.AppendUint16(nil, uint16(to)))
+}
+
+// sealScalar encrypts x from participant from to participant to's
+// recipient key. info names the kind of scalar, e.g. a reshare sub-share.
+func sealScalar(info, session string, from, to int, recipientKey string, x *big.Int, random io.Reader) (string, error) {
+	key, err := recipientPublicKey(recipientKey)
+	if err != nil {
+		return "", fmt.Errorf("recipient key of %d: %w", to, err)
+	}
+	b := frostcore.ScalarBytes(x)
+	defer secret.Wipe(b)
+	box, err := ecies.Seal(info, key, b, subShareAAD(session, from, to), random)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(box), nil
+}
+
+// openScalar decrypts what sealScalar encrypted to key.
+func openScalar(info, session string, from, to int, key *ecdh.PrivateKey, sealed string) (*big.Int, error) {
+	box, err := hex.DecodeString(sealed)
+	if err != nil {
+		return nil, fmt.Errorf("from participant %d: malformed hex", from)
+	}
+	b, err := ecies.Open(info, key, box, subShareAAD(session, from, to))
+	if err != nil {
+		return nil, fmt.Errorf("from participant %d: %w", from, err)
+	}
+	defer secret.Wipe(b)
+	if len(b) != frostcore.ScalarSize {
+		return nil, fmt.Errorf("from participant %d: malformed scalar", from)
+	}
+	return frostcore.ScalarFromBytes(b), nil
+}
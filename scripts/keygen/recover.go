@@ -0,0 +1,185 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+	"slices"
+
+	"keygen/frostcore"
+	"keygen/keystore"
+	"keygen/schema"
+	"keygen/secret"
+)
+
+// RecoverOutput is the reconstructed group secret.
+type RecoverOutput struct {
+	GroupKey     string `json:"group_key"`
+	SecretKey    string `json:"secret_key,omitempty"` // 32 bytes; controls the group's funds
+	KeyFile      string `json:"key_file,omitempty"`   // Where the secret key was written
+	Participants []int  `json:"participants"`
+	Subsets      int    `json:"subsets_checked,omitempty"` // t-subsets that gave the same key
+}
+
+// runRecover reconstructs the group private key from key shares, for
+// disaster-recovery drills and as a check on DKG output. Each file holds one
+// share (an entry of keygen's shares) or a whole keygen output. The key is
+// verified against the group public key; with threshold > 0 every t-subset
+// of the shares must give the same key. The key goes to keyFile (mode
+// 0600, never overwritten) and only public values are printed, unless
+// insecureStdout.
+func runRecover(files []string, threshold int, keyFile string, insecureStdout bool) {
+	if len(files) == 0 {
+		fail(KindUsage, "Usage: keygen recover [-t threshold] [-key-file f] <share.json>...")
+	}
+	if !insecureStdout {
+		if _, err := os.Lstat(keyFile); err == nil {
+			fail(KindInput, "Error: %s already exists", keyFile)
+		}
+	}
+
+	shares := make(map[uint16]*big.Int)
+	groupKey := ""
+	for _, path := range files {
+		for _, s := range readShares(path) {
+			if groupKey == "" {
+				groupKey = s.GroupKey
+			}
+			if s.GroupKey != groupKey {
+				fail(KindInput, "Error: %s: participant %d is for group %s, not %s", path, s.Participant, s.GroupKey, groupKey)
+			}
+			if s.Participant < 1 || s.Participant > 0xFFFF {
+				fail(KindInput, "Error: %s: invalid participant %d", path, s.Participant)
+			}
+			if s.SecretShare == nil {
+				fail(KindInput, "Error: %s: participant %d: no secret_share", path, s.Participant)
+			}
+			x := s.SecretShare.Int()
+			if s.PublicShare != "" && hex.EncodeToString(frostcore.BasePoint(x)) != s.PublicShare {
+				fail(KindCrypto, "Error: %s: participant %d: secret share does not match its public share", path, s.Participant)
+			}
+			id := uint16(s.Participant)
+			if prev, ok := shares[id]; ok && prev.Cmp(x) != 0 {
+				fail(KindInput, "Error: participant %d given twice with different shares", id)
+			}
+			shares[id] = x
+		}
+	}
+	if threshold > 0 && len(shares) < threshold {
+		fail(KindInput, "Error: %d shares given, threshold is %d", len(shares), threshold)
+	}
+
+	key, err := frostcore.Interpolate(shares)
+	if err != nil {
+		fail(KindInput, "Error: %v", err)
+	}
+	defer secret.WipeInt(key)
+	if hex.EncodeToString(frostcore.BasePoint(key)) != groupKey {
+		// Too few shares, or shares from a faulty DKG
+		fail(KindCrypto, "Error: recovered key does not match the group public key (fewer than t shares, or inconsistent shares)")
+	}
+
+	ids := make([]uint16, 0, len(shares))
+	for id := range shares {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	subsets := 0
+	if threshold > 0 && len(ids) > threshold {
+		// Shares on a polynomial of degree t-1 agree in every t-subset
+		err := forEachSubset(ids, threshold, func(subset []uint16) error {
+			m := make(map[uint16]*big.Int, threshold)
+			for _, id := range subset {
+				m[id] = shares[id]
+			}
+			got, err := frostcore.Interpolate(m)
+			if err != nil {
+				return err
+			}
+			if got.Cmp(key) != 0 {
+				return fmt.Errorf("participants %v give a different key", subset)
+			}
+			subsets++
+			return nil
+		})
+		if err != nil {
+			fail(KindCrypto, "Error: %v", err)
+		}
+	}
+
+	output := RecoverOutput{
+		GroupKey:  groupKey,
+		SecretKey: hex.EncodeToString(frostcore.ScalarBytes(key)),
+		Subsets:   subsets,
+	}
+	for _, id := range ids {
+		output.Participants = append(output.Participants, int(id))
+	}
+	if insecureStdout {
+		fmt.Fprintln(os.Stderr, "WARNING: -insecure-stdout: the output is the FULL GROUP PRIVATE KEY. Anyone holding it can sign alone.")
+	} else {
+		data, _ := jsonOutput(output)
+		writeNewFile(keyFile, data, 0600)
+		secret.Wipe(data)
+		output.SecretKey, output.KeyFile = "", keyFile
+		fmt.Fprintf(os.Stderr, "WARNING: %s holds the FULL GROUP PRIVATE KEY. Anyone holding it can sign alone.\n", keyFile)
+	}
+	fmt.Fprintln(os.Stderr, "WARNING: use it on an offline machine only and destroy it after the drill.")
+	writeJSON(output)
+}
+
+// readShares reads a single share or a whole keygen output.
+func readShares(path string) []KeyShareOutput {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		fail(KindInput, "Error reading %s: %v", path, err)
+	}
+	if keystore.IsEncrypted(data) {
+		return []KeyShareOutput{openShareFile(path, data, "")}
+	}
+	// Outputs of keygen and reshare-finalize list shares; share files do not
+	var probe struct {
+		Shares json.RawMessage `json:"shares"`
+	}
+	if err := json.Unmarshal(data, &probe); err == nil && probe.Shares != nil {
+		var out ReshareOutput
+		if err := schema.Unmarshal(data, &out, path); err != nil {
+			fail(KindInput, "Error: %s: %v", path, err)
+		}
+		if len(out.Shares) == 0 {
+			fail(KindInput, "Error: %s holds no key shares", path)
+		}
+		return out.Shares
+	}
+	var share KeyShareOutput
+	if err := schema.Unmarshal(data, &share, path); err != nil {
+		fail(KindInput, "Error: %s: %v", path, err)
+	}
+	if share.SecretShare == nil {
+		fail(KindInput, "Error: %s is not a key share", path)
+	}
+	return []KeyShareOutput{share}
+}
+
+// forEachSubset calls fn with every k-element subset of ids, stopping at the
+// first error.
+func forEachSubset(ids []uint16, k int, fn func([]uint16) error) error {
+	subset := make([]uint16, 0, k)
+	var walk func(start int) error
+	walk = func(start int) error {
+		if len(subset) == k {
+			return fn(subset)
+		}
+		for i := start; i <= len(ids)-(k-len(subset)); i++ {
+			subset = append(subset, ids[i])
+			if err := walk(i + 1); err != nil {
+				return err
+			}
+			subset = subset[:len(subset)-1]
+		}
+		return nil
+	}
+	return walk(0)
+}
@@ -0,0 +1,295 @@
+package main
+
+import (
+	"crypto/ecdh"
+	"crypto/rand"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+
+	"keygen/frostcore"
+	"keygen/groupstate"
+	"keygen/schema"
+	"keygen/secret"
+)
+
+// RefreshSession fixes the group being refreshed. It is public and is given
+// to every participant.
+type RefreshSession struct {
+	ID           string   `json:"id"` // Random; binds contributions to this session
+	GroupKey     string   `json:"group_key"`
+	Threshold    int      `json:"threshold"`
+	Total        int      `json:"total"`
+	PublicShares []string `json:"public_shares"` // Before the refresh, index i is participant i+1
+
+	// RecipientKeys are the participants' keys from recipient-key, index i
+	// is participant i+1's. Sub-shares are sealed to them.
+	RecipientKeys []string `json:"recipient_keys"`
+}
+
+// RefreshContribution is the public half of one participant's sharing of
+// zero; the sub-shares go to their recipients sealed, one file each.
+type RefreshContribution struct {
+	Session     string   `json:"session"`
+	From        int      `json:"from"`
+	Commitments []string `json:"commitments"` // C_1..C_{t-1}; C_0 is the identity
+}
+
+// runRefresh implements proactive share refresh, which gives every
+// participant a new share of the same group key:
+//
+//	refresh init -recipients k1,... [-state f]                start a session
+//	refresh contribute -id i [-session f] [-out-dir d]        deal participant i's sharing of zero
+//	refresh finalize -share f -key f [-hardware ids] [-out-dir d] <refresh-i-to-j.json>...
+//
+// contribute seals each sub-share to its recipient's key and writes it to
+// refresh-<i>-to-<j>.json. Each participant then finalizes its own share
+// from the files addressed to it, one from every participant, since a share
+// only stays compatible with shares refreshed by the same contributions.
+func runRefresh(args []string) {
+	if len(args) < 1 {
+		fail(KindUsage, "Usage: keygen refresh <init|contribute|finalize> [options]")
+	}
+	cmd := flag.NewFlagSet("refresh "+args[0], flag.ExitOnError)
+	statePath := cmd.String("state", ceremony.GroupStateOr("group-state.json"), "Group-state document of the group")
+	sessionPath := cmd.String("session", "refresh-session.json", "Session from refresh init")
+	id := cmd.Int("id", 0, "Participant dealing this contribution, or whose share finalize refreshes")
+	seedHex := cmd.String("seed", "", "Derive the polynomial from this hex seed (test fixtures only)")
+	sharePath := cmd.String("share", "", "Share to refresh (a share, or a keygen output with -id)")
+	recipients := cmd.String("recipients", "", "Participants' recipient keys from recipient-key, comma-separated in participant order")
+	keyPath := cmd.String("key", "", "The participant's recipient key from recipient-key")
+	hardware := cmd.String("hardware", ceremony.HardwareList(), "Participants on Ledger devices (comma-separated); they get APDU scripts instead of share files")
+	outDir := cmd.String("out-dir", "refresh-out", "Output directory; contribute writes the sealed sub-shares here")
+	stdioFlags(cmd)
+	cmd.Parse(args[1:])
+
+	switch args[0] {
+	case "init":
+		session, err := newRefreshSession(loadGroupState(*statePath))
+		if err != nil {
+			fail(KindInput, "Error: %v", err)
+		}
+		if session.RecipientKeys, err = parseRecipientKeys(*recipients, session.Total); err != nil {
+			fail(KindInput, "Error: -recipients: %v", err)
+		}
+		writeJSON(session)
+
+	case "contribute":
+		session := loadRefreshSession(*sessionPath)
+		out, subShares, err := refreshContribute(session, *id, randomSource(*seedHex, "refresh"))
+		if err != nil {
+			fail(KindInput, "Error: %v", err)
+		}
+		writeSubShares(*outDir, "refresh", subShares)
+		fmt.Fprintf(os.Stderr, "Deliver refresh-%d-to-<j>.json to participant j\n", *id)
+		writeJSON(out)
+
+	case "finalize":
+		if *sharePath == "" || *keyPath == "" {
+			fail(KindUsage, "Usage: keygen refresh finalize -share f -key f [-id i] [-hardware ids] [-out-dir d] <refresh-i-to-j.json>...")
+		}
+		runRefreshFinalize(*sessionPath, *statePath, selectShare(*sharePath, *id), loadRecipientKey(*keyPath), *hardware, *outDir, cmd.Args())
+
+	default:
+		fail(KindUsage, "Unknown refresh command: %s", args[0])
+	}
+}
+
+// runRefreshFinalize opens the sub-shares sealed to the share's participant,
+// checks them and every participant's commitments, computes the new public
+// shares and the refreshed share, and writes it with the updated
+// group-state document.
+func runRefreshFinalize(sessionPath, statePath string, share *KeyShareOutput, key *ecdh.PrivateKey, hardware, outDir string, files []string) {
+	session := loadRefreshSession(sessionPath)
+	doc := loadGroupState(statePath)
+	if doc.GroupKey != session.GroupKey || !slices.Equal(doc.PublicShares, session.PublicShares) {
+		fail(KindInput, "Error: %s does not describe the group as it was when the session started", statePath)
+	}
+	var hw []int
+	if hardware != "" {
+		var err error
+		if hw, err = parseIDList(hardware); err != nil {
+			fail(KindInput, "Error: -hardware: %v", err)
+		}
+	}
+	subShares := loadSubShares(files, share.Participant)
+	defer logStep("refreshed", "session", session.ID)()
+
+	publicShares, refreshed, err := refreshFinalize(session, share, key, subShares)
+	if err != nil {
+		fail(KindCrypto, "Error: %v", err)
+	}
+	k := refreshed.SecretShare.Int()
+	inject := hex.EncodeToString(injectKeysAPDU(hexBytes(session.GroupKey), uint16(refreshed.Participant), k, refreshed.Purpose))
+	secret.WipeInt(k)
+
+	next := *doc
+	next.PublicShares = publicShares
+	next.Failovers = nil // Standby copies are of the old shares
+	writeRosterFiles(outDir, &next, []KeyShareOutput{*refreshed}, []string{inject}, hw, "refreshed")
+
+	fmt.Fprintf(os.Stderr, "Refreshed participant %d's share of group %s in %s\n", refreshed.Participant, session.GroupKey, outDir)
+	fmt.Fprintln(os.Stderr, "Every participant must switch to its refreshed share: old and new shares do not combine. Destroy the old one")
+}
+
+// newRefreshSession starts a refresh of the group in a group-state document.
+func newRefreshSession(doc *groupstate.Document) (*RefreshSession, error) {
+	if err := doc.CheckActive(); err != nil {
+		return nil, fmt.Errorf("%w; refusing to refresh", err)
+	}
+	if doc.Threshold < 2 {
+		return nil, fmt.Errorf("a %d-of-%d group has nothing to refresh", doc.Threshold, doc.Total)
+	}
+	if len(doc.PublicShares) != doc.Total {
+		return nil, fmt.Errorf("group state lists %d public shares for %d participants", len(doc.PublicShares), doc.Total)
+	}
+	id := make([]byte, 16)
+	rand.Read(id)
+	return &RefreshSession{
+		ID:           hex.EncodeToString(id),
+		GroupKey:     doc.GroupKey,
+		Threshold:    doc.Threshold,
+		Total:        doc.Total,
+		PublicShares: doc.PublicShares,
+	}, nil
+}
+
+// refreshContribute deals participant id's sharing of zero and seals each
+// sub-share to its recipient's key.
+func refreshContribute(session *RefreshSession, id int, random io.Reader) (*RefreshContribution, []*ReshareSubShare, error) {
+	if id < 1 || id > session.Total {
+		return nil, nil, fmt.Errorf("-id %d is not a participant (1..%d)", id, session.Total)
+	}
+	deal, err := frostcore.RefreshDeal(session.Threshold, session.Total, random)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer wipeScalars(deal.SubShares)
+	out := &RefreshContribution{Session: session.ID, From: id}
+	for _, c := range deal.Commitments {
+		out.Commitments = append(out.Commitments, hex.EncodeToString(c))
+	}
+	var subShares []*ReshareSubShare
+	for k, x := range deal.SubShares {
+		j := k + 1
+		sealed, err := sealScalar(refreshSubShareInfo, session.ID, id, j, session.RecipientKeys[k], x, random)
+		if err != nil {
+			return nil, nil, err
+		}
+		subShares = append(subShares, &ReshareSubShare{Session: session.ID, From: id, To: j, Commitments: out.Commitments, Share: sealed})
+	}
+	return out, subShares, nil
+}
+
+// refreshFinalize opens the sub-shares sealed to the share's participant
+// under key, one from every participant, and returns the new public shares
+// of all participants and the refreshed share.
+func refreshFinalize(session *RefreshSession, share *KeyShareOutput, key *ecdh.PrivateKey, list []*ReshareSubShare) ([]string, *KeyShareOutput, error) {
+	j := share.Participant
+	if share.GroupKey != session.GroupKey {
+		return nil, nil, fmt.Errorf("share %d is for group %s, session is for %s", j, share.GroupKey, session.GroupKey)
+	}
+	if j < 1 || j > session.Total || share.PublicShare != session.PublicShares[j-1] {
+		return nil, nil, fmt.Errorf("share %d does not match the group's public shares", j)
+	}
+	if share.SecretShare == nil {
+		return nil, nil, fmt.Errorf("participant %d: no secret_share", j)
+	}
+	if !strings.EqualFold(session.RecipientKeys[j-1], hex.EncodeToString(key.PublicKey().Bytes())) {
+		return nil, nil, fmt.Errorf("the key is not participant %d's recipient key in this session", j)
+	}
+	subShares := make(map[int]*ReshareSubShare, len(list))
+	for _, s := range list {
+		if s.Session != session.ID {
+			return nil, nil, fmt.Errorf("sub-share from participant %d belongs to session %s, not %s", s.From, s.Session, session.ID)
+		}
+		if s.From < 1 || s.From > session.Total || s.To != j {
+			return nil, nil, fmt.Errorf("sub-share from %d to %d is not from a participant to participant %d", s.From, s.To, j)
+		}
+		if _, dup := subShares[s.From]; dup {
+			return nil, nil, fmt.Errorf("two sub-shares from participant %d", s.From)
+		}
+		if len(s.Commitments) != session.Threshold-1 {
+			return nil, nil, fmt.Errorf("participant %d: expected %d commitments", s.From, session.Threshold-1)
+		}
+		subShares[s.From] = s
+	}
+	commitments := make(map[int][][]byte)
+	for from := 1; from <= session.Total; from++ {
+		s, ok := subShares[from]
+		if !ok {
+			return nil, nil, fmt.Errorf("missing sub-share from participant %d", from)
+		}
+		for _, h := range s.Commitments {
+			commitments[from] = append(commitments[from], hexBytes(h))
+		}
+	}
+
+	// Y_j' = Y_j + sum_i h_i(j)*G
+	publicShares := make([]string, session.Total)
+	for i := 1; i <= session.Total; i++ {
+		points := [][]byte{hexBytes(session.PublicShares[i-1])}
+		for from := 1; from <= session.Total; from++ {
+			p, err := frostcore.EvalZeroCommitments(commitments[from], uint16(i))
+			if err != nil {
+				return nil, nil, fmt.Errorf("participant %d: %w", from, err)
+			}
+			points = append(points, p)
+		}
+		public, err := frostcore.AddPoints(points...)
+		if err != nil {
+			return nil, nil, err
+		}
+		publicShares[i-1] = hex.EncodeToString(public)
+	}
+
+	sum := share.SecretShare.Int()
+	defer secret.WipeInt(sum)
+	for from := 1; from <= session.Total; from++ {
+		x, err := openScalar(refreshSubShareInfo, session.ID, from, j, key, subShares[from].Share)
+		if err != nil {
+			return nil, nil, err
+		}
+		err = frostcore.VerifyZeroSubShare(commitments[from], uint16(j), x)
+		sum.Add(sum, x)
+		secret.WipeInt(x)
+		if err != nil {
+			return nil, nil, fmt.Errorf("from participant %d: %w", from, err)
+		}
+	}
+	sum.Mod(sum, frostcore.Order)
+	if hex.EncodeToString(frostcore.BasePoint(sum)) != publicShares[j-1] {
+		return nil, nil, fmt.Errorf("participant %d: refreshed share does not match its public share", j)
+	}
+	refreshed, err := secret.FromInt(sum)
+	if err != nil {
+		return nil, nil, err
+	}
+	out := *share
+	out.SecretShare = refreshed
+	out.PublicShare = publicShares[j-1]
+	out.Threshold, out.Total = session.Threshold, session.Total
+	return publicShares, &out, nil
+}
+
+func loadRefreshSession(path string) *RefreshSession {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		fail(KindInput, "Error reading session: %v", err)
+	}
+	var s RefreshSession
+	if err := schema.Unmarshal(data, &s, path); err != nil {
+		fail(KindInput, "Error: %s: %v", path, err)
+	}
+	if s.Threshold < 2 || s.Threshold > s.Total || len(s.PublicShares) != s.Total {
+		fail(KindInput, "Error: %s: invalid %d-of-%d session with %d public shares", path, s.Threshold, s.Total, len(s.PublicShares))
+	}
+	if len(s.RecipientKeys) != s.Total {
+		fail(KindInput, "Error: %s: %d recipient keys for %d participants; start the session with refresh init -recipients", path, len(s.RecipientKeys), s.Total)
+	}
+	return &s
+}
@@ -0,0 +1,321 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"sync/atomic"
+	"text/tabwriter"
+	"time"
+
+	"keygen/apdu"
+	"keygen/coordinator"
+	"keygen/frostcore"
+	"keygen/groupstate"
+	"keygen/simdevice"
+)
+
+// RejectReport is the output of reject-test.
+type RejectReport struct {
+	Cases []RejectCase `json:"cases"`
+	Pass  bool         `json:"pass"`
+}
+
+// RejectCase is one approval point rejected by one participant.
+type RejectCase struct {
+	Prompt      string        `json:"prompt"` // inject_keys or sign
+	Participant int           `json:"participant"`
+	Checks      []RejectCheck `json:"checks"`
+	Pass        bool          `json:"pass"`
+}
+
+// RejectCheck is one assertion of a case.
+type RejectCheck struct {
+	Name   string `json:"name"`
+	Pass   bool   `json:"pass"`
+	Detail string `json:"detail,omitempty"` // What was observed instead
+}
+
+func (c *RejectCase) check(name string, ok bool, format string, args ...any) {
+	chk := RejectCheck{Name: name, Pass: ok}
+	if !ok {
+		chk.Detail = fmt.Sprintf(format, args...)
+	}
+	c.Checks = append(c.Checks, chk)
+}
+
+func (c *RejectCase) done() RejectCase {
+	c.Pass = true
+	for _, chk := range c.Checks {
+		c.Pass = c.Pass && chk.Pass
+	}
+	return *c
+}
+
+// runRejectTest rejects each approval point of the simulated device in turn,
+// INJECT_KEYS for every participant and PARTIAL_SIGN for every signer, and
+// checks that the host classifies the status as a rejection, that the device
+// keeps no keys or drops its nonces, and that the coordinator session is
+// left waiting rather than completed or corrupted. A new session then has
+// to sign. Speculos can only be driven by hand, so this runs on simdevice:
+//
+//	keygen reject-test -t 2 -n 3 -tcp
+func runRejectTest(args []string) {
+	cmd := flag.NewFlagSet("reject-test", flag.ExitOnError)
+	threshold := cmd.Int("t", 2, "Signing threshold")
+	total := cmd.Int("n", 3, "Participants")
+	useTCP := cmd.Bool("tcp", false, "Reach the devices over the Speculos APDU protocol on loopback")
+	asJSON := cmd.Bool("json", false, "Print JSON instead of text")
+	stdioFlags(cmd)
+	cmd.Parse(args)
+
+	if *threshold < 2 || *threshold > *total || *total > apdu.MaxParticipants {
+		fail(KindInput, "Error: need 2 <= t <= n <= %d", apdu.MaxParticipants)
+	}
+	groupKey, shares, doc, err := newTestGroup(*threshold, *total)
+	if err != nil {
+		fail(KindFailure, "Error generating key: %v", err)
+	}
+	c := coordinator.New()
+	c.AddGroup(doc)
+
+	var report RejectReport
+	for i, share := range shares {
+		rc, err := rejectInjectKeys(groupKey, share, i+1, *useTCP)
+		if err != nil {
+			fail(KindTransport, "Error: inject_keys, participant %d: %v", i+1, err)
+		}
+		report.Cases = append(report.Cases, rc)
+	}
+	signers := make([]int, *threshold)
+	for j := range signers {
+		signers[j] = j + 1
+	}
+	for _, id := range signers {
+		rc, err := rejectSign(context.Background(), c, doc, groupKey, shares, signers, id, *useTCP)
+		if err != nil {
+			fail(KindTransport, "Error: sign, participant %d: %v", id, err)
+		}
+		report.Cases = append(report.Cases, rc)
+	}
+
+	report.Pass = true
+	for _, rc := range report.Cases {
+		report.Pass = report.Pass && rc.Pass
+	}
+	if *asJSON {
+		writeJSON(report)
+	} else {
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "PROMPT\tPARTICIPANT\tCHECK\tRESULT")
+		for _, rc := range report.Cases {
+			for _, chk := range rc.Checks {
+				result := "ok"
+				if !chk.Pass {
+					result = "FAIL: " + chk.Detail
+				}
+				fmt.Fprintf(w, "%s\t%d\t%s\t%s\n", rc.Prompt, rc.Participant, chk.Name, result)
+			}
+		}
+		w.Flush()
+	}
+	if !report.Pass {
+		fail(KindFailure, "Rejection test failed")
+	}
+}
+
+// rejectInjectKeys has participant id's new device reject INJECT_KEYS, then
+// approve it.
+func rejectInjectKeys(groupKey []byte, share *big.Int, id int, useTCP bool) (RejectCase, error) {
+	rc := RejectCase{Prompt: simdevice.PromptInjectKeys.String(), Participant: id}
+	var rejecting atomic.Bool
+	rejecting.Store(true)
+	dev := simdevice.New()
+	dev.Approve = func(p simdevice.Prompt) bool {
+		return p.Kind != simdevice.PromptInjectKeys || !rejecting.Load()
+	}
+	t, closeDevice, err := rejectTransport(dev, useTCP)
+	if err != nil {
+		return rc, err
+	}
+	defer closeDevice()
+
+	inject := injectKeysAPDU(groupKey, uint16(id), share, "")
+	_, sw, err := rejectExchange(t, inject)
+	if err != nil {
+		return rc, err
+	}
+	rc.check("rejection surfaced", statusKind(sw, apdu.InsInjectKeys) == KindRejected && apdu.ExplainStatus(sw, apdu.InsInjectKeys).Name == "USER_REJECTED",
+		"INJECT_KEYS answered %04X", sw)
+
+	_, sw, err = rejectExchange(t, apdu.Command(apdu.InsCommit, 0, 0, nil))
+	if err != nil {
+		return rc, err
+	}
+	rc.check("no keys stored", sw == apdu.SwConditionsNotSat && !dev.Stats().Initialized,
+		"COMMIT after the rejection answered %04X", sw)
+
+	rejecting.Store(false)
+	_, sw, err = rejectExchange(t, inject)
+	if err != nil {
+		return rc, err
+	}
+	rc.check("approved retry", sw == apdu.SwOK, "INJECT_KEYS after approval answered %04X", sw)
+	return rc.done(), nil
+}
+
+// rejectSign runs a session of the signers in which rejecter rejects
+// PARTIAL_SIGN and the others sign, then a new session in which all approve.
+func rejectSign(ctx context.Context, c *coordinator.Coordinator, doc *groupstate.Document, groupKey []byte, shares []*big.Int, signers []int, rejecter int, useTCP bool) (RejectCase, error) {
+	rc := RejectCase{Prompt: simdevice.PromptSign.String(), Participant: rejecter}
+	var rejecting atomic.Bool
+	rejecting.Store(true)
+	ds, err := newSoakDevices(groupKey, shares, useTCP, func(id int, p simdevice.Prompt) bool {
+		return id != rejecter || p.Kind != simdevice.PromptSign || !rejecting.Load()
+	})
+	if err != nil {
+		return rc, err
+	}
+	defer ds.close()
+
+	transports := make(map[int]apdu.Transport, len(signers))
+	defer func() {
+		for _, t := range transports {
+			t.Close()
+		}
+	}()
+	for _, id := range signers {
+		t, err := ds.open(id)
+		if err != nil {
+			return rc, fmt.Errorf("participant %d: %w", id, err)
+		}
+		transports[id] = t
+	}
+
+	msg := make([]byte, 32)
+	rand.Read(msg)
+	s, err := soakRequest(ctx, c, coordinator.OpCreateSession, "", coordinator.CreateSessionParams{
+		GroupKey:    doc.GroupKey,
+		MessageHash: hex.EncodeToString(msg),
+		Signers:     signers,
+	})
+	if err != nil {
+		return rc, err
+	}
+	commitments := make(map[int][]byte, len(signers))
+	for _, id := range signers {
+		data, err := soakExchange(transports[id], apdu.Command(apdu.InsCommit, 0, 0, nil))
+		if err != nil {
+			return rc, fmt.Errorf("participant %d: %w", id, err)
+		}
+		commitments[id] = data
+		if s, err = soakRequest(ctx, c, coordinator.OpSubmitCommitment, s.ID, coordinator.CommitmentParams{
+			ID:            id,
+			HidingCommit:  hex.EncodeToString(data[:frostcore.PointSize]),
+			BindingCommit: hex.EncodeToString(data[frostcore.PointSize:]),
+		}); err != nil {
+			return rc, err
+		}
+	}
+
+	list := frostcore.EncodeCommitments(s.CommitmentList())
+	partialSign := apdu.Command(apdu.InsPartialSign, 0, 0, nil)
+	for _, id := range signers {
+		t := transports[id]
+		if _, err := soakExchange(t, apdu.Command(apdu.InsInjectMessage, 0, 0, msg)); err != nil {
+			return rc, fmt.Errorf("participant %d: %w", id, err)
+		}
+		if err := apdu.SendCommitments(t, list, 0); err != nil {
+			return rc, fmt.Errorf("participant %d: %w", id, err)
+		}
+		z, sw, err := rejectExchange(t, partialSign)
+		if err != nil {
+			return rc, fmt.Errorf("participant %d: %w", id, err)
+		}
+		if id != rejecter {
+			if sw != apdu.SwOK {
+				return rc, fmt.Errorf("participant %d: PARTIAL_SIGN: %s", id, apdu.ExplainStatus(sw, apdu.InsPartialSign))
+			}
+			if s, err = soakRequest(ctx, c, coordinator.OpSubmitPartial, s.ID, coordinator.PartialParams{
+				ID:         id,
+				PartialSig: hex.EncodeToString(z),
+			}); err != nil {
+				return rc, err
+			}
+			continue
+		}
+
+		rc.check("rejection surfaced", sw == apdu.SwUserRejected && statusKind(sw, apdu.InsPartialSign) == KindRejected,
+			"PARTIAL_SIGN answered %04X", sw)
+		state := ds.devices[id-1].Stats().State
+		rc.check("device reset", state == simdevice.StateIdle.String(), "device left in state %s", state)
+
+		// Approving now must not find the nonces the rejection cleared
+		rejecting.Store(false)
+		_, sw, err = rejectExchange(t, partialSign)
+		if err != nil {
+			return rc, err
+		}
+		rc.check("nonces retired", sw == apdu.SwConditionsNotSat, "PARTIAL_SIGN after approval answered %04X", sw)
+		data, err := soakExchange(t, apdu.Command(apdu.InsCommit, 0, 0, nil))
+		if err != nil {
+			return rc, err
+		}
+		rc.check("fresh commitments", !bytes.Equal(data, commitments[id]), "COMMIT returned the rejected session's commitments")
+		if _, err := soakExchange(t, apdu.Command(apdu.InsReset, 0, 0, nil)); err != nil {
+			return rc, err
+		}
+	}
+
+	if s, err = soakRequest(ctx, c, coordinator.OpGetSession, s.ID, nil); err != nil {
+		return rc, err
+	}
+	_, signed := s.Partials[rejecter]
+	rc.check("session held", s.State == coordinator.StateCollectingPartials && s.Result == nil && !signed && len(s.Partials) == len(signers)-1,
+		"session %s is %s with %d partial signatures", s.ID, s.State, len(s.Partials))
+
+	for _, t := range transports {
+		t.Close()
+	}
+	clear(transports)
+	err = ds.sign(ctx, c, doc, signers[0]-1)
+	rc.check("new session signs", err == nil, "%v", err)
+	return rc.done(), nil
+}
+
+// rejectTransport returns a transport to dev, over loopback with useTCP,
+// and a function that closes both.
+func rejectTransport(dev *simdevice.Device, useTCP bool) (apdu.Transport, func(), error) {
+	if !useTCP {
+		t := dev.Transport()
+		return t, func() { t.Close() }, nil
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, nil, err
+	}
+	go simdevice.Serve(l, dev)
+	t, err := apdu.DialSpeculos(l.Addr().String(), 5*time.Second)
+	if err != nil {
+		l.Close()
+		return nil, nil, err
+	}
+	return t, func() { t.Close(); l.Close() }, nil
+}
+
+// rejectExchange sends one APDU and returns the response data and status
+// word, whatever the status.
+func rejectExchange(t apdu.Transport, command []byte) ([]byte, uint16, error) {
+	resp, err := t.Exchange(command)
+	if err != nil {
+		return nil, 0, fmt.Errorf("%s: %w", apdu.InsName(command[1]), err)
+	}
+	data, sw := apdu.SplitResponse(resp)
+	return data, sw, nil
+}
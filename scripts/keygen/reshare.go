@@ -0,0 +1,701 @@
+package main
+
+import (
+	"crypto/ecdh"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"keygen/apdu"
+	"keygen/frostcore"
+	"keygen/groupstate"
+	"keygen/sas"
+	"keygen/schema"
+	"keygen/secret"
+)
+
+// ReshareSession fixes the parameters of a resharing. It is public and is
+// given to every old signer and new participant.
+type ReshareSession struct {
+	ID           string   `json:"id"` // Random; binds contributions to this session
+	GroupKey     string   `json:"group_key"`
+	OldThreshold int      `json:"old_threshold"`
+	OldSigners   []int    `json:"old_signers"`   // Old participants dealing their shares
+	PublicShares []string `json:"public_shares"` // Old public shares, index i is participant i+1
+	NewThreshold int      `json:"new_threshold"`
+	NewTotal     int      `json:"new_total"`
+	Purpose      string   `json:"purpose,omitempty"` // Purpose tag the new shares inherit
+
+	// RecipientKeys are the new participants' keys from recipient-key,
+	// index j-1 is participant j's. Sub-shares are sealed to them.
+	RecipientKeys []string `json:"recipient_keys,omitempty"`
+}
+
+// ReshareContribution is one old signer's public commitments, which every
+// participant compares (reshare-codes).
+type ReshareContribution struct {
+	Session     string   `json:"session"`
+	From        int      `json:"from"`
+	Commitments []string `json:"commitments"` // C_0..C_{t'-1}
+}
+
+// ReshareSubShare is one secret scalar for one recipient, sealed to its
+// recipient key: g_i(j) for new participant j in a resharing, with the
+// dealer's commitments to check it against. Refresh and enrollment send
+// theirs in the same form.
+type ReshareSubShare struct {
+	Session     string   `json:"session"`
+	From        int      `json:"from"`
+	To          int      `json:"to"`
+	Commitments []string `json:"commitments,omitempty"`
+	Share       string   `json:"share"` // Sealed with package ecies to the recipient key of To
+}
+
+// Info strings of the sealed scalars, so one cannot pass for another.
+const (
+	reshareSubShareInfo = "fy-ledger reshare sub-share v1"
+	refreshSubShareInfo = "fy-ledger refresh sub-share v1"
+	enrollPieceInfo     = "fy-ledger enroll piece v1"
+	enrollSumInfo       = "fy-ledger enroll sum v1"
+)
+
+// ReshareOutput is new key shares, keygen-compatible, plus the APDUs that
+// inject each share into its device: one participant's from
+// reshare-finalize, the whole roster's in change-threshold.
+type ReshareOutput struct {
+	KeyGenOutput
+	PublicShares []string `json:"public_shares"`          // All new public shares, index i is participant i+1
+	InjectAPDUs  []string `json:"inject_apdus,omitempty"` // INJECT_KEYS per share, in the order of shares
+}
+
+// runReshareInit starts a resharing of the group in a group-state document
+// from the old signers to a newT-of-newN roster whose recipient keys are
+// given in participant order.
+func runReshareInit(statePath, signers, recipients string, newT, newN int) {
+	doc := loadGroupState(statePath)
+	ids, err := parseIDList(signers)
+	if err != nil {
+		fail(KindInput, "Error: -signers: %v", err)
+	}
+	session, err := newReshareSession(doc, ids, newT, newN)
+	if err != nil {
+		fail(KindInput, "Error: %v", err)
+	}
+	if session.RecipientKeys, err = parseRecipientKeys(recipients, newN); err != nil {
+		fail(KindInput, "Error: -recipients: %v", err)
+	}
+	writeJSON(session)
+}
+
+// runReshareContribute deals one old signer's share to the new roster. It
+// prints the public commitments and writes each new participant's sealed
+// sub-share to reshare-<from>-to-<j>.json in outDir.
+func runReshareContribute(sessionPath, sharePath string, id int, seedHex, outDir string) {
+	session := loadReshareSession(sessionPath)
+	out, subShares, err := reshareContribute(session, selectShare(sharePath, id), randomSource(seedHex, "reshare"))
+	if err != nil {
+		fail(KindInput, "Error: %v", err)
+	}
+	writeSubShares(outDir, "reshare", subShares)
+	fmt.Fprintf(os.Stderr, "Deliver reshare-%d-to-<j>.json to new participant j; destroy your old share once the new roster is live\n", out.From)
+	writeJSON(out)
+}
+
+// runReshareFinalize opens the sub-shares sealed to new participant id,
+// checks them and every old signer's commitments, and computes id's new
+// share. With verifyCodes, participant id first confirms the code words
+// with every old signer. The share goes where o puts it, or with ledger to
+// an APDU script; stdout gets only public values.
+func runReshareFinalize(sessionPath string, id int, keyPath string, verifyCodes, ledger bool, o *shareOutput, files []string) {
+	session := loadReshareSession(sessionPath)
+	if id < 1 || id > session.NewTotal || keyPath == "" {
+		fail(KindUsage, "Usage: keygen reshare-finalize -id j -key recipient.key [-ledger] [-out-dir d] <reshare-i-to-j.json>...")
+	}
+	subShares := loadSubShares(files, id)
+	defer logStep("reshared", "session", session.ID)()
+
+	if verifyCodes {
+		codes, err := reshareCodes(session, subShareCommitments(subShares), newParticipant(id))
+		if err != nil {
+			fail(KindInput, "Error: %v", err)
+		}
+		confirmCodes(codes)
+	}
+
+	// The new shares inherit the group's purpose; -purpose can only confirm it
+	if *o.purpose != "" && *o.purpose != session.Purpose {
+		fail(KindUsage, "Error: -purpose %q: the reshared shares inherit the group's purpose %q", *o.purpose, session.Purpose)
+	}
+	*o.purpose = session.Purpose
+
+	out, err := reshareFinalize(session, id, loadRecipientKey(keyPath), subShares)
+	if err != nil {
+		fail(KindCrypto, "Error: %v", err)
+	}
+	// Only public values reach stdout unless -insecure-stdout
+	switch {
+	case *o.insecureStdout:
+		o.write(out.Shares)
+	case ledger:
+		if err := os.MkdirAll(*o.dir, 0700); err != nil {
+			fail(KindFailure, "Error creating %s: %v", *o.dir, err)
+		}
+		writeInjectScript(*o.dir, &out.Shares[0], out.InjectAPDUs[0], "reshared")
+		fmt.Fprintf(os.Stderr, "Wrote %s\n", filepath.Join(*o.dir, fmt.Sprintf("participant-%d.apdu", id)))
+		out.Shares[0].SecretShare.Destroy()
+		out.Shares[0].SecretShare = nil
+		out.InjectAPDUs = nil
+	default:
+		o.write(out.Shares)
+		out.InjectAPDUs = nil
+	}
+	fmt.Fprintf(os.Stderr, "Reshared group %s to %d-of-%d: participant %d's share; old shares still sign for this key and must be destroyed\n",
+		session.GroupKey, session.NewThreshold, session.NewTotal, id)
+	writeJSON(out)
+}
+
+// ReshareCode is the code a participant reads with one peer, from
+// reshare-codes.
+type ReshareCode struct {
+	Peer string `json:"peer"` // e.g. "old 2" or "new 3"
+	Code string `json:"code"`
+}
+
+// runReshareCodes prints the code words participant as reads aloud with each
+// peer once every old signer has published their commitments: old signers
+// with each new participant, new participants with each old signer. With
+// verify, it prompts for the code each peer reads and fails on a mismatch.
+func runReshareCodes(sessionPath, as string, verify bool, files []string) {
+	session := loadReshareSession(sessionPath)
+	codes, err := reshareCodes(session, loadContributions(files), as)
+	if err != nil {
+		fail(KindInput, "Error: %v", err)
+	}
+	if verify {
+		confirmCodes(codes)
+	}
+	writeJSON(codes)
+}
+
+func oldSigner(id int) string      { return fmt.Sprintf("old %d", id) }
+func newParticipant(id int) string { return fmt.Sprintf("new %d", id) }
+
+// reshareCodes returns participant as's code with each of its peers. as is
+// "old <id>" or "new <id>" (or "old:<id>", "new:<id>").
+func reshareCodes(session *ReshareSession, list []*ReshareContribution, as string) ([]ReshareCode, error) {
+	role, n, ok := strings.Cut(strings.ReplaceAll(as, ":", " "), " ")
+	id, err := strconv.Atoi(n)
+	if !ok || err != nil {
+		return nil, fmt.Errorf("-as %q: expected old:<id> or new:<id>", as)
+	}
+	var self string
+	var peers []string
+	switch role {
+	case "old":
+		if !slices.Contains(session.OldSigners, id) {
+			return nil, fmt.Errorf("participant %d is not an old signer in this session", id)
+		}
+		self = oldSigner(id)
+		for j := 1; j <= session.NewTotal; j++ {
+			peers = append(peers, newParticipant(j))
+		}
+	case "new":
+		if id < 1 || id > session.NewTotal {
+			return nil, fmt.Errorf("%d is not a new participant (1..%d)", id, session.NewTotal)
+		}
+		self = newParticipant(id)
+		for _, i := range session.OldSigners {
+			peers = append(peers, oldSigner(i))
+		}
+	default:
+		return nil, fmt.Errorf("-as %q: expected old:<id> or new:<id>", as)
+	}
+
+	transcript, err := reshareTranscript(session, list)
+	if err != nil {
+		return nil, err
+	}
+	codes := make([]ReshareCode, len(peers))
+	for k, peer := range peers {
+		codes[k] = ReshareCode{Peer: peer, Code: sas.Code(transcript, self, peer)}
+	}
+	return codes, nil
+}
+
+// reshareTranscript is what the participants must agree on before any new
+// share is computed: the session and every old signer's commitments, in
+// old-signer order. The sub-shares are left out, so every participant
+// computes the codes from what it holds.
+func reshareTranscript(session *ReshareSession, list []*ReshareContribution) ([]byte, error) {
+	type dealer struct {
+		From        int      `json:"from"`
+		Commitments []string `json:"commitments"`
+	}
+	byFrom := make(map[int]*ReshareContribution, len(list))
+	for _, c := range list {
+		if c.Session != session.ID {
+			return nil, fmt.Errorf("contribution from participant %d belongs to session %s, not %s", c.From, c.Session, session.ID)
+		}
+		byFrom[c.From] = c
+	}
+	dealers := make([]dealer, len(session.OldSigners))
+	for k, id := range session.OldSigners {
+		c, ok := byFrom[id]
+		if !ok {
+			return nil, fmt.Errorf("missing contribution from old signer %d", id)
+		}
+		dealers[k] = dealer{From: id, Commitments: c.Commitments}
+	}
+	return json.Marshal(struct {
+		Session *ReshareSession `json:"session"`
+		Dealers []dealer        `json:"dealers"`
+	}{session, dealers})
+}
+
+// confirmCodes prompts on the terminal for the code each peer reads aloud and
+// exits unless every one matches.
+func confirmCodes(codes []ReshareCode) {
+	for _, c := range codes {
+		for {
+			entered, err := promptLine(fmt.Sprintf("Code read by %s: ", c.Peer))
+			if err != nil {
+				fail(KindFailure, "Error: %v", err)
+			}
+			err = sas.Check(c.Code, entered)
+			if errors.Is(err, sas.ErrMismatch) {
+				fail(KindCrypto, "Error: the code read by %s does not match (yours is %q); you saw different commitments, stop the ceremony", c.Peer, c.Code)
+			}
+			if err == nil {
+				break
+			}
+			fmt.Fprintf(os.Stderr, "%v; try again\n", err)
+		}
+	}
+	fmt.Fprintf(os.Stderr, "All %d codes match\n", len(codes))
+}
+
+func loadContributions(files []string) []*ReshareContribution {
+	var contributions []*ReshareContribution
+	for _, path := range files {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			fail(KindInput, "Error reading %s: %v", path, err)
+		}
+		var c ReshareContribution
+		if err := schema.Unmarshal(data, &c, path); err != nil {
+			fail(KindInput, "Error: %s: %v", path, err)
+		}
+		logger.Debug("contribution", "file", path, "session", c.Session, "from", c.From, "commitments", c.Commitments)
+		contributions = append(contributions, &c)
+	}
+	return contributions
+}
+
+// loadSubShares reads sealed sub-shares, refusing any not addressed to
+// participant to.
+func loadSubShares(files []string, to int) []*ReshareSubShare {
+	var list []*ReshareSubShare
+	for _, path := range files {
+		var s ReshareSubShare
+		readJSONFile(path, &s)
+		if s.To != to {
+			fail(KindInput, "Error: %s is addressed to participant %d, not %d", path, s.To, to)
+		}
+		logger.Debug("sub-share", "file", path, "session", s.Session, "from", s.From, "to", s.To)
+		list = append(list, &s)
+	}
+	return list
+}
+
+// writeSubShares writes each sealed sub-share to <kind>-<from>-to-<to>.json
+// in dir. They are sealed, so the files need no protection beyond the
+// recipient's.
+func writeSubShares(dir, kind string, list []*ReshareSubShare) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		fail(KindFailure, "Error creating %s: %v", dir, err)
+	}
+	for _, s := range list {
+		data, _ := jsonOutput(s)
+		path := filepath.Join(dir, fmt.Sprintf("%s-%d-to-%d.json", kind, s.From, s.To))
+		writeNewFile(path, data, 0644)
+		fmt.Fprintf(os.Stderr, "Wrote %s\n", path)
+	}
+}
+
+// subShareCommitments returns the commitments the sub-shares carry, one
+// contribution per dealer.
+func subShareCommitments(list []*ReshareSubShare) []*ReshareContribution {
+	out := make([]*ReshareContribution, len(list))
+	for i, s := range list {
+		out[i] = &ReshareContribution{Session: s.Session, From: s.From, Commitments: s.Commitments}
+	}
+	return out
+}
+
+// newReshareSession checks the old signers against the group and the new
+// roster size.
+func newReshareSession(doc *groupstate.Document, signers []int, newT, newN int) (*ReshareSession, error) {
+	if err := doc.CheckActive(); err != nil {
+		return nil, fmt.Errorf("%w; refusing to reshare", err)
+	}
+	if len(signers) < doc.Threshold {
+		return nil, fmt.Errorf("%d old signers, group threshold is %d", len(signers), doc.Threshold)
+	}
+	for _, id := range signers {
+		if id < 1 || id > doc.Total || id > len(doc.PublicShares) {
+			return nil, fmt.Errorf("signer %d is not a participant of this group", id)
+		}
+	}
+	if newT < 1 || newT > newN || newN > apdu.MaxParticipants {
+		return nil, fmt.Errorf("invalid new threshold %d of %d (at most %d participants)", newT, newN, apdu.MaxParticipants)
+	}
+
+	id := make([]byte, 16)
+	rand.Read(id)
+	return &ReshareSession{
+		ID:           hex.EncodeToString(id),
+		GroupKey:     doc.GroupKey,
+		OldThreshold: doc.Threshold,
+		OldSigners:   signers,
+		PublicShares: doc.PublicShares,
+		NewThreshold: newT,
+		NewTotal:     newN,
+		Purpose:      doc.Purpose,
+	}, nil
+}
+
+// reshareDeal checks an old signer's share against the session and deals
+// it with a fresh polynomial.
+func reshareDeal(session *ReshareSession, share *KeyShareOutput, random io.Reader) (*frostcore.Reshare, error) {
+	if share.GroupKey != session.GroupKey {
+		return nil, fmt.Errorf("share is for group %s, session is for %s", share.GroupKey, session.GroupKey)
+	}
+	if !slices.Contains(session.OldSigners, share.Participant) {
+		return nil, fmt.Errorf("participant %d is not an old signer in this session", share.Participant)
+	}
+	if share.SecretShare == nil {
+		return nil, fmt.Errorf("participant %d: no secret_share", share.Participant)
+	}
+	key := share.SecretShare.Int()
+	defer secret.WipeInt(key)
+
+	oldIDs := oldSignerIDs(session)
+	deal, err := frostcore.ReshareDeal(uint16(share.Participant), key,
+		oldIDs, session.NewThreshold, session.NewTotal, random)
+	if err != nil {
+		return nil, err
+	}
+	// Refuse to deal anything the new participants would reject
+	if err := frostcore.VerifyDealerShare(deal.Commitments, uint16(share.Participant), oldIDs,
+		hexBytes(session.PublicShares[share.Participant-1])); err != nil {
+		return nil, fmt.Errorf("%w (share does not match the group state)", err)
+	}
+	return deal, nil
+}
+
+// reshareContribute deals an old signer's share and seals each sub-share to
+// its recipient's key.
+func reshareContribute(session *ReshareSession, share *KeyShareOutput, random io.Reader) (*ReshareContribution, []*ReshareSubShare, error) {
+	if len(session.RecipientKeys) != session.NewTotal {
+		return nil, nil, fmt.Errorf("session lists %d recipient keys for %d new participants", len(session.RecipientKeys), session.NewTotal)
+	}
+	deal, err := reshareDeal(session, share, random)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer wipeScalars(deal.SubShares)
+
+	out := &ReshareContribution{Session: session.ID, From: share.Participant}
+	for _, c := range deal.Commitments {
+		out.Commitments = append(out.Commitments, hex.EncodeToString(c))
+	}
+	var subShares []*ReshareSubShare
+	for k, x := range deal.SubShares {
+		j := k + 1
+		sealed, err := sealScalar(reshareSubShareInfo, session.ID, share.Participant, j, session.RecipientKeys[k], x, random)
+		if err != nil {
+			return nil, nil, err
+		}
+		subShares = append(subShares, &ReshareSubShare{Session: session.ID, From: share.Participant, To: j, Commitments: out.Commitments, Share: sealed})
+	}
+	return out, subShares, nil
+}
+
+// reshareFinalize opens the sub-shares sealed to new participant id under
+// key and computes its new share, after checking every old signer's
+// commitments.
+func reshareFinalize(session *ReshareSession, id int, key *ecdh.PrivateKey, list []*ReshareSubShare) (*ReshareOutput, error) {
+	if id < 1 || id > session.NewTotal {
+		return nil, fmt.Errorf("-id %d is not a new participant (1..%d)", id, session.NewTotal)
+	}
+	if len(session.RecipientKeys) != session.NewTotal || !strings.EqualFold(session.RecipientKeys[id-1], hex.EncodeToString(key.PublicKey().Bytes())) {
+		return nil, fmt.Errorf("the key is not new participant %d's recipient key in this session", id)
+	}
+	subShares := make(map[int]*big.Int, len(list))
+	defer func() {
+		for _, x := range subShares {
+			secret.WipeInt(x)
+		}
+	}()
+	for _, s := range list {
+		if s.Session != session.ID {
+			return nil, fmt.Errorf("sub-share from participant %d belongs to session %s, not %s", s.From, s.Session, session.ID)
+		}
+		if s.To != id || !slices.Contains(session.OldSigners, s.From) {
+			return nil, fmt.Errorf("sub-share from %d to %d is not from an old signer to participant %d", s.From, s.To, id)
+		}
+		if _, dup := subShares[s.From]; dup {
+			return nil, fmt.Errorf("two sub-shares from participant %d", s.From)
+		}
+		x, err := openScalar(reshareSubShareInfo, session.ID, s.From, id, key, s.Share)
+		if err != nil {
+			return nil, err
+		}
+		subShares[s.From] = x
+	}
+	commitments, publicShares, err := reshareCommitments(session, subShareCommitments(list))
+	if err != nil {
+		return nil, err
+	}
+	share, inject, err := reshareShare(session, id, commitments, subShares, publicShares[id-1])
+	if err != nil {
+		return nil, err
+	}
+	return &ReshareOutput{
+		KeyGenOutput: KeyGenOutput{Threshold: session.NewThreshold, Total: session.NewTotal, Shares: []KeyShareOutput{*share}},
+		PublicShares: publicShares,
+		InjectAPDUs:  []string{inject},
+	}, nil
+}
+
+// reshareAll runs every role of a resharing in one process, for
+// change-threshold and the test scenarios, which hold the old shares on one
+// machine anyway. The sub-shares are not sealed and the session needs no
+// recipient keys.
+func reshareAll(session *ReshareSession, shares []*KeyShareOutput, random io.Reader) (*ReshareOutput, error) {
+	var contributions []*ReshareContribution
+	subShares := make([]map[int]*big.Int, session.NewTotal) // By new participant, then dealer
+	for j := range subShares {
+		subShares[j] = make(map[int]*big.Int)
+	}
+	defer func() {
+		for _, m := range subShares {
+			for _, x := range m {
+				secret.WipeInt(x)
+			}
+		}
+	}()
+	for _, share := range shares {
+		deal, err := reshareDeal(session, share, random)
+		if err != nil {
+			return nil, fmt.Errorf("participant %d: %w", share.Participant, err)
+		}
+		c := &ReshareContribution{Session: session.ID, From: share.Participant}
+		for _, h := range deal.Commitments {
+			c.Commitments = append(c.Commitments, hex.EncodeToString(h))
+		}
+		contributions = append(contributions, c)
+		for k, x := range deal.SubShares {
+			subShares[k][share.Participant] = x
+		}
+	}
+	commitments, publicShares, err := reshareCommitments(session, contributions)
+	if err != nil {
+		return nil, err
+	}
+	out := &ReshareOutput{KeyGenOutput: KeyGenOutput{Threshold: session.NewThreshold, Total: session.NewTotal}, PublicShares: publicShares}
+	for j := 1; j <= session.NewTotal; j++ {
+		share, inject, err := reshareShare(session, j, commitments, subShares[j-1], publicShares[j-1])
+		if err != nil {
+			return nil, err
+		}
+		out.Shares = append(out.Shares, *share)
+		out.InjectAPDUs = append(out.InjectAPDUs, inject)
+	}
+	return out, nil
+}
+
+// reshareCommitments checks that every old signer contributed, each against
+// its old public share, and that the contributions add up to the group key.
+// It returns the commitments by dealer and all new public shares.
+func reshareCommitments(session *ReshareSession, list []*ReshareContribution) (map[int][][]byte, []string, error) {
+	contributions := make(map[int]*ReshareContribution, len(list))
+	for _, c := range list {
+		if c.Session != session.ID {
+			return nil, nil, fmt.Errorf("contribution from participant %d belongs to session %s, not %s", c.From, c.Session, session.ID)
+		}
+		if !slices.Contains(session.OldSigners, c.From) {
+			return nil, nil, fmt.Errorf("participant %d is not an old signer in this session", c.From)
+		}
+		contributions[c.From] = c
+	}
+
+	// Every old signer must contribute: the weighted shares only sum to the
+	// group secret over the whole set
+	oldIDs := oldSignerIDs(session)
+	var constants [][]byte
+	commitments := make(map[int][][]byte)
+	for _, from := range session.OldSigners {
+		c, ok := contributions[from]
+		if !ok {
+			return nil, nil, fmt.Errorf("missing contribution from participant %d", from)
+		}
+		if len(c.Commitments) != session.NewThreshold {
+			return nil, nil, fmt.Errorf("participant %d: expected %d commitments", from, session.NewThreshold)
+		}
+		for _, h := range c.Commitments {
+			commitments[from] = append(commitments[from], hexBytes(h))
+		}
+		if err := frostcore.VerifyDealerShare(commitments[from], uint16(from), oldIDs, hexBytes(session.PublicShares[from-1])); err != nil {
+			return nil, nil, err
+		}
+		constants = append(constants, commitments[from][0])
+	}
+	groupKey, err := frostcore.AddPoints(constants...)
+	if err != nil || hex.EncodeToString(groupKey) != session.GroupKey {
+		return nil, nil, fmt.Errorf("contributions do not add up to the group key")
+	}
+
+	var publicShares []string
+	for j := 1; j <= session.NewTotal; j++ {
+		// New public share: sum over dealers of their committed polynomial at j
+		var points [][]byte
+		for _, from := range session.OldSigners {
+			p, err := frostcore.EvalCommitments(commitments[from], uint16(j))
+			if err != nil {
+				return nil, nil, fmt.Errorf("participant %d: %w", from, err)
+			}
+			points = append(points, p)
+		}
+		public, err := frostcore.AddPoints(points...)
+		if err != nil {
+			return nil, nil, err
+		}
+		publicShares = append(publicShares, hex.EncodeToString(public))
+	}
+	return commitments, publicShares, nil
+}
+
+// reshareShare checks each old signer's sub-share for new participant j
+// against its commitments and sums them into j's share, returned with its
+// INJECT_KEYS APDU.
+func reshareShare(session *ReshareSession, j int, commitments map[int][][]byte, subShares map[int]*big.Int, public string) (*KeyShareOutput, string, error) {
+	key := new(big.Int)
+	defer secret.WipeInt(key)
+	for _, from := range session.OldSigners {
+		x, ok := subShares[from]
+		if !ok {
+			return nil, "", fmt.Errorf("missing sub-share from participant %d", from)
+		}
+		if err := frostcore.VerifySubShare(commitments[from], uint16(j), x); err != nil {
+			return nil, "", fmt.Errorf("from participant %d: %w", from, err)
+		}
+		key.Add(key, x)
+	}
+	key.Mod(key, frostcore.Order)
+
+	inject := hex.EncodeToString(injectKeysAPDU(hexBytes(session.GroupKey), uint16(j), key, session.Purpose))
+	share, err := secret.FromInt(key)
+	if err != nil {
+		return nil, "", err
+	}
+	return &KeyShareOutput{
+		Participant: j,
+		GroupKey:    session.GroupKey,
+		ID:          hex.EncodeToString(frostcore.IDBytes(uint16(j))),
+		SecretShare: share,
+		PublicShare: public,
+		Purpose:     session.Purpose,
+		Threshold:   session.NewThreshold,
+		Total:       session.NewTotal,
+	}, inject, nil
+}
+
+// wipeScalars zeroes secret scalars once they are sealed.
+func wipeScalars(xs []*big.Int) {
+	for _, x := range xs {
+		secret.WipeInt(x)
+	}
+}
+
+// injectKeysAPDU builds INJECT_KEYS: group key || identifier || secret share,
+// followed by the purpose tag of a tagged share.
+func injectKeysAPDU(groupKey []byte, id uint16, secret *big.Int, purpose string) []byte {
+	payload := append(append(append([]byte(nil), groupKey...), frostcore.IDBytes(id)...), frostcore.ScalarBytes(secret)...)
+	payload = append(payload, purpose...)
+	return apdu.Command(apdu.InsInjectKeys, deviceCurve(), 0, payload)
+}
+
+// selectShare reads a share file, or picks participant id's share from a
+// file holding several.
+func selectShare(path string, id int) *KeyShareOutput {
+	shares := readShares(path)
+	for i := range shares {
+		if len(shares) == 1 || shares[i].Participant == id {
+			return &shares[i]
+		}
+	}
+	fail(KindInput, "Error: %s holds several shares; pick one with -id", path)
+	return nil
+}
+
+func loadReshareSession(path string) *ReshareSession {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		fail(KindInput, "Error reading session: %v", err)
+	}
+	var s ReshareSession
+	if err := schema.Unmarshal(data, &s, path); err != nil {
+		fail(KindInput, "Error: %s: %v", path, err)
+	}
+	for _, id := range s.OldSigners {
+		if id < 1 || id > len(s.PublicShares) {
+			fail(KindInput, "Error: %s: old signer %d has no public share", path, id)
+		}
+	}
+	if len(s.RecipientKeys) != s.NewTotal {
+		fail(KindInput, "Error: %s: %d recipient keys for %d new participants; start the session with reshare-init -recipients", path, len(s.RecipientKeys), s.NewTotal)
+	}
+	return &s
+}
+
+func oldSignerIDs(s *ReshareSession) []uint16 {
+	ids := make([]uint16, len(s.OldSigners))
+	for i, id := range s.OldSigners {
+		ids[i] = uint16(id)
+	}
+	return ids
+}
+
+// parseIDList parses comma-separated participant IDs, sorted and unique.
+func parseIDList(s string) ([]int, error) {
+	var ids []int
+	for _, f := range strings.Split(s, ",") {
+		id, err := strconv.Atoi(strings.TrimSpace(f))
+		if err != nil || id < 1 || id > 0xFFFF {
+			return nil, fmt.Errorf("invalid participant %q", f)
+		}
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	if len(slices.Compact(slices.Clone(ids))) != len(ids) {
+		return nil, fmt.Errorf("duplicate participant")
+	}
+	return ids, nil
+}
+
+// hexBytes decodes hex whose length is checked downstream: bad input decodes
+// to nil and fails point decoding.
+func hexBytes(s string) []byte {
+	b, _ := hex.DecodeString(s)
+	return b
+}
@@ -0,0 +1,387 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"keygen/rfc9591"
+	"keygen/schema"
+	"keygen/secret"
+)
+
+// RFC9591Share is one participant's share of an Ed25519 or ristretto255
+// group, as participant-<id>.<suite>.json. Scalars are little-endian, as
+// the RFC serializes them.
+type RFC9591Share struct {
+	Ciphersuite string         `json:"ciphersuite"`
+	Participant int            `json:"participant"`
+	Threshold   int            `json:"threshold"`
+	Total       int            `json:"total"`
+	GroupKey    string         `json:"group_key"`
+	SecretShare *secret.Scalar `json:"secret_share"`
+	PublicShare string         `json:"public_share"`
+}
+
+// RFC9591Group is the public output of rfc9591 keygen.
+type RFC9591Group struct {
+	Ciphersuite  string         `json:"ciphersuite"`
+	Threshold    int            `json:"threshold"`
+	Total        int            `json:"total"`
+	GroupKey     string         `json:"group_key"`
+	PublicShares map[int]string `json:"public_shares"`
+	Files        []string       `json:"files"`
+}
+
+// RFC9591Commitment is a signer's round-one commitment. The copy rfc9591
+// commit writes to -nonces also holds the nonces behind it.
+type RFC9591Commitment struct {
+	Ciphersuite  string         `json:"ciphersuite"`
+	Participant  int            `json:"participant"`
+	Hiding       string         `json:"hiding"`
+	Binding      string         `json:"binding"`
+	HidingNonce  *secret.Scalar `json:"hiding_nonce,omitempty"`
+	BindingNonce *secret.Scalar `json:"binding_nonce,omitempty"`
+}
+
+// RFC9591SignInput is the input of rfc9591 sign.
+type RFC9591SignInput struct {
+	Message     string              `json:"message"` // Hex, signed as is
+	GroupKey    string              `json:"group_key"`
+	Commitments []RFC9591Commitment `json:"commitments"`
+}
+
+// RFC9591Partial is a signer's signature share.
+type RFC9591Partial struct {
+	Ciphersuite string `json:"ciphersuite"`
+	Participant int    `json:"participant"`
+	PartialSig  string `json:"partial_sig"`
+}
+
+// RFC9591AggregateInput is the input of rfc9591 aggregate. With
+// public_shares every signature share is checked before summing.
+type RFC9591AggregateInput struct {
+	Message      string              `json:"message"`
+	GroupKey     string              `json:"group_key"`
+	Commitments  []RFC9591Commitment `json:"commitments"`
+	PartialSigs  []RFC9591Partial    `json:"partial_sigs"`
+	PublicShares map[int]string      `json:"public_shares,omitempty"`
+}
+
+// RFC9591Signature is the output of rfc9591 aggregate.
+type RFC9591Signature struct {
+	Ciphersuite string `json:"ciphersuite"`
+	GroupKey    string `json:"group_key"`
+	Message     string `json:"message"`
+	Signature   string `json:"signature"` // R || z, 64 bytes
+	Valid       bool   `json:"valid"`
+}
+
+const rfc9591Usage = "Usage: keygen rfc9591 <vectors|keygen|commit|sign|aggregate|verify> [-suite ed25519|ristretto255] [options]"
+
+// runRFC9591 implements the rfc9591 subcommands: FROST(Ed25519, SHA-512)
+// and FROST(ristretto255, SHA-512) on the host (see package rfc9591).
+func runRFC9591(args []string) {
+	if len(args) < 1 {
+		fail(KindUsage, rfc9591Usage)
+	}
+	if args[0] == "vectors" {
+		if err := rfc9591.CheckVectors(); err != nil {
+			fail(KindCrypto, "Error: %v", err)
+		}
+		writeJSON(rfc9591.Vectors)
+		return
+	}
+	cmd := flag.NewFlagSet("rfc9591 "+args[0], flag.ExitOnError)
+	suiteName := cmd.String("suite", "ed25519", "Ciphersuite: ed25519 or ristretto255")
+	stdioFlags(cmd)
+	var s *rfc9591.Suite
+	parse := func(usage string) {
+		cmd.Parse(args[1:])
+		if cmd.NArg() != 0 {
+			fail(KindUsage, "%s", usage)
+		}
+		var err error
+		if s, err = rfc9591.Lookup(*suiteName); err != nil {
+			fail(KindUsage, "Error: -suite: %v", err)
+		}
+		schema.Ciphersuite = s.ID
+		schema.Adopt = nil
+	}
+	switch args[0] {
+	case "keygen":
+		threshold := cmd.Int("t", 2, "Threshold")
+		total := cmd.Int("n", 3, "Total participants")
+		seed := cmd.String("seed", "", "Hex seed for deterministic keys (test fixtures only)")
+		outDir := cmd.String("out-dir", ".", "Write participant-<id>.<suite>.json here")
+		parse("Usage: keygen rfc9591 keygen [-suite s] [-t 2] [-n 3] [-seed hex] [-out-dir d]")
+		rfc9591Keygen(s, *threshold, *total, *seed, *outDir)
+	case "commit":
+		sharePath := cmd.String("share", "", "Share file of the signer (required)")
+		noncesPath := cmd.String("nonces", "", "Write the nonces to this new file (required)")
+		parse("Usage: keygen rfc9591 commit [-suite s] -share f -nonces f")
+		if *sharePath == "" || *noncesPath == "" {
+			fail(KindUsage, "Usage: keygen rfc9591 commit [-suite s] -share f -nonces f")
+		}
+		rfc9591Commit(s, *sharePath, *noncesPath)
+	case "sign":
+		sharePath := cmd.String("share", "", "Share file of the signer (required)")
+		noncesPath := cmd.String("nonces", "", "Nonces file from rfc9591 commit, deleted once used (required)")
+		parse("Usage: keygen rfc9591 sign [-suite s] -share f -nonces f < sign-input.json")
+		if *sharePath == "" || *noncesPath == "" {
+			fail(KindUsage, "Usage: keygen rfc9591 sign [-suite s] -share f -nonces f < sign-input.json")
+		}
+		rfc9591Sign(s, *sharePath, *noncesPath)
+	case "aggregate":
+		parse("Usage: keygen rfc9591 aggregate [-suite s] < aggregate-input.json")
+		rfc9591Aggregate(s)
+	case "verify":
+		key := cmd.String("key", "", "Group public key, hex (required)")
+		message := cmd.String("message", "", "Message, hex")
+		signature := cmd.String("signature", "", "Signature, hex (required)")
+		parse("Usage: keygen rfc9591 verify [-suite s] -key hex -message hex -signature hex")
+		if *key == "" || *signature == "" {
+			fail(KindUsage, "Usage: keygen rfc9591 verify [-suite s] -key hex -message hex -signature hex")
+		}
+		if err := s.Verify(decodeHex("-key", *key), decodeHex("-message", *message), decodeHex("-signature", *signature)); err != nil {
+			fail(KindCrypto, "Error: %v", err)
+		}
+		fmt.Printf("Valid %s signature\n", s.ID)
+	default:
+		fail(KindUsage, rfc9591Usage)
+	}
+}
+
+func rfc9591Keygen(s *rfc9591.Suite, threshold, total int, seedHex, outDir string) {
+	key, shares, err := s.Deal(threshold, total, randomSource(seedHex, "rfc9591-"+s.Name))
+	if err != nil {
+		fail(KindInput, "Error: %v", err)
+	}
+	group := RFC9591Group{
+		Ciphersuite:  s.ID,
+		Threshold:    threshold,
+		Total:        total,
+		GroupKey:     hex.EncodeToString(key.Bytes()),
+		PublicShares: make(map[int]string, total),
+	}
+	paths := make([]string, total)
+	for i := range shares {
+		paths[i] = filepath.Join(outDir, fmt.Sprintf("participant-%d.%s.json", i+1, s.Name))
+		if _, err := os.Lstat(paths[i]); err == nil {
+			fail(KindInput, "Error: %s already exists", paths[i])
+		}
+	}
+	for i, x := range shares {
+		public := hex.EncodeToString(s.BaseMul(x).Bytes())
+		sc, err := secret.FromBytes(rfc9591.ScalarBytes(x))
+		rfc9591.WipeScalar(x)
+		if err != nil {
+			fail(KindFailure, "Error: %v", err)
+		}
+		data, err := jsonOutput(RFC9591Share{
+			Ciphersuite: s.ID,
+			Participant: i + 1,
+			Threshold:   threshold,
+			Total:       total,
+			GroupKey:    group.GroupKey,
+			SecretShare: sc,
+			PublicShare: public,
+		})
+		sc.Destroy()
+		if err != nil {
+			fail(KindFailure, "Error encoding share %d: %v", i+1, err)
+		}
+		writeNewFile(paths[i], data, 0600)
+		secret.Wipe(data)
+		group.PublicShares[i+1] = public
+		group.Files = append(group.Files, paths[i])
+	}
+	writeJSON(group)
+}
+
+// rfc9591Scalar decodes a little-endian secret scalar. The caller wipes it.
+func rfc9591Scalar(field string, sc *secret.Scalar) *rfc9591.Scalar {
+	x, err := rfc9591.ParseScalar(sc.Bytes())
+	if err != nil {
+		fail(KindInput, "Error: %s: %v", field, err)
+	}
+	return x
+}
+
+func parseRFC9591Element(s *rfc9591.Suite, field, h string) rfc9591.Element {
+	e, err := s.ParseElement(decodeHex(field, h))
+	if err != nil {
+		fail(KindInput, "Error: %s: %v", field, err)
+	}
+	return e
+}
+
+// loadRFC9591Share reads a share file and checks its secret against its
+// public share.
+func loadRFC9591Share(s *rfc9591.Suite, path string) (RFC9591Share, rfc9591.Element) {
+	var share RFC9591Share
+	readJSONFile(path, &share)
+	if share.SecretShare == nil {
+		fail(KindInput, "Error: %s holds no secret_share", path)
+	}
+	key := parseRFC9591Element(s, "group_key", share.GroupKey)
+	x := rfc9591Scalar(path+": secret_share", share.SecretShare)
+	defer rfc9591.WipeScalar(x)
+	if x.Equal(rfc9591.NewScalar()) == 1 || hex.EncodeToString(s.BaseMul(x).Bytes()) != share.PublicShare {
+		fail(KindCrypto, "Error: %s: the secret share does not match its public share", path)
+	}
+	return share, key
+}
+
+func rfc9591Commit(s *rfc9591.Suite, sharePath, noncesPath string) {
+	share, _ := loadRFC9591Share(s, sharePath)
+	defer share.SecretShare.Destroy()
+	x := rfc9591Scalar("secret_share", share.SecretShare)
+	defer rfc9591.WipeScalar(x)
+
+	d, err := s.NonceGenerate(rand.Reader, x)
+	if err != nil {
+		fail(KindFailure, "Error generating nonces: %v", err)
+	}
+	e, err := s.NonceGenerate(rand.Reader, x)
+	if err != nil {
+		fail(KindFailure, "Error generating nonces: %v", err)
+	}
+	c := RFC9591Commitment{
+		Ciphersuite: s.ID,
+		Participant: share.Participant,
+		Hiding:      hex.EncodeToString(s.BaseMul(d).Bytes()),
+		Binding:     hex.EncodeToString(s.BaseMul(e).Bytes()),
+	}
+	withNonces := c
+	if withNonces.HidingNonce, err = secret.FromBytes(rfc9591.ScalarBytes(d)); err == nil {
+		withNonces.BindingNonce, err = secret.FromBytes(rfc9591.ScalarBytes(e))
+	}
+	rfc9591.WipeScalar(d)
+	rfc9591.WipeScalar(e)
+	defer withNonces.HidingNonce.Destroy()
+	defer withNonces.BindingNonce.Destroy()
+	if err != nil {
+		fail(KindFailure, "Error: %v", err)
+	}
+	data, err := jsonOutput(withNonces)
+	if err != nil {
+		fail(KindFailure, "Error encoding the nonces: %v", err)
+	}
+	writeNewFile(noncesPath, data, 0600)
+	secret.Wipe(data)
+	writeJSON(c)
+}
+
+// rfc9591Session builds the signing session of an input.
+func rfc9591Session(s *rfc9591.Suite, message, groupKey string, commitments []RFC9591Commitment) *rfc9591.Session {
+	key := parseRFC9591Element(s, "group_key", groupKey)
+	list := make([]rfc9591.Commitment, len(commitments))
+	for i, c := range commitments {
+		list[i] = rfc9591.Commitment{
+			ID:      c.Participant,
+			Hiding:  parseRFC9591Element(s, fmt.Sprintf("commitments[%d].hiding", i), c.Hiding),
+			Binding: parseRFC9591Element(s, fmt.Sprintf("commitments[%d].binding", i), c.Binding),
+		}
+	}
+	session, err := s.NewSession(key, decodeHex("message", message), list)
+	if err != nil {
+		fail(KindInput, "Error: %v", err)
+	}
+	return session
+}
+
+func rfc9591Sign(s *rfc9591.Suite, sharePath, noncesPath string) {
+	var input RFC9591SignInput
+	if err := schema.Decode(os.Stdin, &input, stdinName); err != nil {
+		fail(KindInput, "Error reading input: %v", err)
+	}
+	share, key := loadRFC9591Share(s, sharePath)
+	defer share.SecretShare.Destroy()
+	if !key.Equal(parseRFC9591Element(s, "group_key", input.GroupKey)) {
+		fail(KindInput, "Error: the input is for another group key than %s", sharePath)
+	}
+	var nonces RFC9591Commitment
+	readJSONFile(noncesPath, &nonces)
+	defer nonces.HidingNonce.Destroy()
+	defer nonces.BindingNonce.Destroy()
+	if nonces.HidingNonce == nil || nonces.BindingNonce == nil {
+		fail(KindInput, "Error: %s holds no nonces", noncesPath)
+	}
+	if nonces.Participant != share.Participant {
+		fail(KindInput, "Error: %s holds participant %d's nonces, not participant %d's", noncesPath, nonces.Participant, share.Participant)
+	}
+
+	session := rfc9591Session(s, input.Message, input.GroupKey, input.Commitments)
+	x := rfc9591Scalar("secret_share", share.SecretShare)
+	d := rfc9591Scalar("hiding_nonce", nonces.HidingNonce)
+	e := rfc9591Scalar("binding_nonce", nonces.BindingNonce)
+	z, err := session.Sign(share.Participant, x, d, e)
+	rfc9591.WipeScalar(x)
+	rfc9591.WipeScalar(d)
+	rfc9591.WipeScalar(e)
+	if err == nil {
+		// Nonces are single use
+		if rerr := os.Remove(noncesPath); rerr != nil {
+			fmt.Fprintf(os.Stderr, "Warning: could not delete used nonces: %v\n", rerr)
+		}
+	}
+	if err != nil {
+		fail(KindCrypto, "Error computing partial sig: %v", err)
+	}
+	writeJSON(RFC9591Partial{
+		Ciphersuite: s.ID,
+		Participant: share.Participant,
+		PartialSig:  hex.EncodeToString(rfc9591.ScalarBytes(z)),
+	})
+}
+
+func rfc9591Aggregate(s *rfc9591.Suite) {
+	var input RFC9591AggregateInput
+	if err := schema.Decode(os.Stdin, &input, stdinName); err != nil {
+		fail(KindInput, "Error reading input: %v", err)
+	}
+	session := rfc9591Session(s, input.Message, input.GroupKey, input.Commitments)
+	shares := make(map[int]*rfc9591.Scalar, len(input.PartialSigs))
+	for i, p := range input.PartialSigs {
+		z, err := rfc9591.ParseScalar(decodeHex(fmt.Sprintf("partial_sigs[%d]", i), p.PartialSig))
+		if err != nil {
+			fail(KindInput, "Error: partial_sigs[%d]: %v", i, err)
+		}
+		if _, dup := shares[p.Participant]; dup {
+			fail(KindInput, "Error: partial_sigs[%d]: second share from participant %d", i, p.Participant)
+		}
+		shares[p.Participant] = z
+	}
+	if len(input.PublicShares) > 0 {
+		ids := make([]int, 0, len(shares))
+		for id := range shares {
+			ids = append(ids, id)
+		}
+		slices.Sort(ids)
+		for _, id := range ids {
+			public, ok := input.PublicShares[id]
+			if !ok {
+				fail(KindInput, "Error: public_shares: none for participant %d", id)
+			}
+			if !session.VerifyShare(id, parseRFC9591Element(s, fmt.Sprintf("public_shares[%d]", id), public), shares[id]) {
+				fail(KindCrypto, "Error: participant %d's partial sig does not verify", id)
+			}
+		}
+	}
+	sig, err := session.Aggregate(shares)
+	if err != nil {
+		fail(KindCrypto, "Error: %v", err)
+	}
+	writeJSON(RFC9591Signature{
+		Ciphersuite: s.ID,
+		GroupKey:    input.GroupKey,
+		Message:     input.Message,
+		Signature:   hex.EncodeToString(sig),
+		Valid:       true,
+	})
+}
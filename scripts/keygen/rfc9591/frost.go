@@ -0,0 +1,388 @@
+// Package rfc9591 is FROST(Ed25519, SHA-512) and FROST(ristretto255,
+// SHA-512) as RFC 9591 specifies them, for checking the tool against the
+// RFC's test vectors and against other implementations (frost-rustcrypto,
+// frost-ed25519 and the like) on the same inputs. An Ed25519 signature it
+// aggregates is a plain RFC 8032 signature, which crypto/ed25519 verifies.
+//
+// The group arithmetic is filippo.io/edwards25519's and
+// github.com/gtank/ristretto255's, and the scalar arithmetic
+// edwards25519.Scalar's, all constant time: secret shares and nonces never
+// go through math/big. Both suites encode scalars little-endian, unlike the
+// big-endian scalars of frostcore, and the app does not run either, so they
+// are host-only suites used directly by the keygen rfc9591 commands rather
+// than frostcore ciphersuites.
+package rfc9591
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha512"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+)
+
+// Sizes of encoded scalars and elements, the same in both suites
+const (
+	ScalarSize  = 32
+	ElementSize = 32
+)
+
+// Suite is one of the RFC 9591 ciphersuites.
+type Suite struct {
+	// Name is the short name the commands take.
+	Name string
+	// ID is the context string.
+	ID string
+
+	identity func() element
+	baseMul  func(*Scalar) element
+	decode   func([]byte) (element, error)
+	// rawChallenge makes H2 SHA-512(m) without the context string, as
+	// Ed25519 hashes its challenge.
+	rawChallenge bool
+	// cofactor of the curve the group is built on; DeserializeElement
+	// checks Ed25519 elements are in the prime-order subgroup.
+	cofactor int64
+}
+
+// The suites
+var (
+	Ed25519 = &Suite{
+		Name:         "ed25519",
+		ID:           "FROST-ED25519-SHA512-v1",
+		identity:     edwardsIdentity,
+		baseMul:      edwardsBaseMul,
+		decode:       decodeEdwards,
+		rawChallenge: true,
+		cofactor:     8,
+	}
+	Ristretto255 = &Suite{
+		Name:     "ristretto255",
+		ID:       "FROST-RISTRETTO255-SHA512-v1",
+		identity: ristrettoIdentity,
+		baseMul:  ristrettoBaseMul,
+		decode:   decodeRistretto,
+		cofactor: 1,
+	}
+	Suites = []*Suite{Ed25519, Ristretto255}
+)
+
+// Lookup returns the suite with the given name or ID, case-insensitively.
+func Lookup(name string) (*Suite, error) {
+	for _, s := range Suites {
+		if strings.EqualFold(name, s.Name) || strings.EqualFold(name, s.ID) {
+			return s, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown suite %q (have ed25519, ristretto255)", name)
+}
+
+// Element is a group element of a suite.
+type Element struct {
+	s *Suite
+	p element
+}
+
+// Bytes is SerializeElement.
+func (e Element) Bytes() []byte {
+	return e.p.bytes()
+}
+
+// Equal reports whether e and f are the same element.
+func (e Element) Equal(f Element) bool {
+	return e.p.equal(f.p)
+}
+
+func (e Element) add(f Element) Element {
+	return Element{e.s, e.p.add(f.p)}
+}
+
+func (e Element) mul(k *Scalar) Element {
+	return Element{e.s, e.p.mul(k)}
+}
+
+// BaseMul returns k*G.
+func (s *Suite) BaseMul(k *Scalar) Element {
+	return Element{s, s.baseMul(k)}
+}
+
+// ParseElement is DeserializeElement: it rejects non-canonical encodings,
+// the identity, and for Ed25519, points outside the prime-order subgroup.
+func (s *Suite) ParseElement(b []byte) (Element, error) {
+	q, err := s.decode(b)
+	if err != nil {
+		return Element{}, err
+	}
+	if !bytes.Equal(q.bytes(), b) {
+		return Element{}, fmt.Errorf("%s: %w", s.Name, errNotCanonical)
+	}
+	if q.equal(s.identity()) {
+		return Element{}, fmt.Errorf("%s: element is the identity", s.Name)
+	}
+	if s.cofactor != 1 && !inPrimeOrderSubgroup(q.ed) {
+		return Element{}, fmt.Errorf("%s: element is not in the prime-order subgroup", s.Name)
+	}
+	return Element{s, q}, nil
+}
+
+// ScalarBytes is SerializeScalar: 32 bytes little-endian.
+func ScalarBytes(x *Scalar) []byte {
+	return x.Bytes()
+}
+
+// ParseScalar is DeserializeScalar: 32 bytes little-endian, below L.
+func ParseScalar(b []byte) (*Scalar, error) {
+	if len(b) != ScalarSize {
+		return nil, errors.New("expected a 32-byte scalar")
+	}
+	x, err := NewScalar().SetCanonicalBytes(b)
+	if err != nil {
+		return nil, errors.New("scalar is not reduced mod L")
+	}
+	return x, nil
+}
+
+func (s *Suite) digest(tag string, parts ...[]byte) []byte {
+	h := sha512.New()
+	if tag != "" {
+		h.Write([]byte(s.ID + tag))
+	}
+	for _, m := range parts {
+		h.Write(m)
+	}
+	return h.Sum(nil)
+}
+
+// hashToScalar is H1 ("rho"), H2 ("chal") and H3 ("nonce"): the SHA-512
+// digest read little-endian mod L.
+func (s *Suite) hashToScalar(tag string, parts ...[]byte) *Scalar {
+	if tag == "chal" && s.rawChallenge {
+		tag = ""
+	}
+	x, err := NewScalar().SetUniformBytes(s.digest(tag, parts...))
+	if err != nil {
+		panic("rfc9591: SHA-512 digest is not 64 bytes")
+	}
+	return x
+}
+
+// Split is trusted_dealer_keygen with the polynomial's coefficients given,
+// the group secret key first: it returns the group public key and the
+// shares of participants 1 to n, participant i+1's at i.
+func (s *Suite) Split(coeffs []*Scalar, n int) (Element, []*Scalar, error) {
+	if len(coeffs) < 1 || len(coeffs) > n || n > 0xFFFF {
+		return Element{}, nil, fmt.Errorf("need 1 <= t <= n, got %d-of-%d", len(coeffs), n)
+	}
+	if coeffs[0].Equal(NewScalar()) == 1 {
+		return Element{}, nil, errors.New("group secret key is zero")
+	}
+	shares := make([]*Scalar, n)
+	for i := range shares {
+		x := scalarOf(i + 1)
+		y := NewScalar()
+		for j := len(coeffs) - 1; j >= 0; j-- {
+			y.MultiplyAdd(y, x, coeffs[j])
+		}
+		shares[i] = y
+	}
+	return s.BaseMul(coeffs[0]), shares, nil
+}
+
+// Deal is trusted_dealer_keygen with a fresh random polynomial of degree
+// t-1.
+func (s *Suite) Deal(t, n int, random io.Reader) (Element, []*Scalar, error) {
+	if t < 1 {
+		return Element{}, nil, fmt.Errorf("need 1 <= t <= n, got %d-of-%d", t, n)
+	}
+	coeffs := make([]*Scalar, t)
+	for i := range coeffs {
+		var err error
+		if coeffs[i], err = randomScalar(random); err != nil {
+			return Element{}, nil, err
+		}
+	}
+	key, shares, err := s.Split(coeffs, n)
+	for _, c := range coeffs {
+		WipeScalar(c)
+	}
+	return key, shares, err
+}
+
+// randomScalar draws a non-zero scalar from 64 bytes, so it is uniform.
+func randomScalar(random io.Reader) (*Scalar, error) {
+	b := make([]byte, 64)
+	defer clear(b)
+	for {
+		if _, err := io.ReadFull(random, b); err != nil {
+			return nil, err
+		}
+		x, err := NewScalar().SetUniformBytes(b)
+		if err != nil {
+			return nil, err
+		}
+		if x.Equal(NewScalar()) == 0 {
+			return x, nil
+		}
+	}
+}
+
+// NonceGenerate is nonce_generate: H3(random || secret), with the 32 random
+// bytes read from random. The vectors fix them.
+func (s *Suite) NonceGenerate(random io.Reader, secret *Scalar) (*Scalar, error) {
+	r := make([]byte, 32)
+	if _, err := io.ReadFull(random, r); err != nil {
+		return nil, err
+	}
+	return s.hashToScalar("nonce", r, ScalarBytes(secret)), nil
+}
+
+// Commitment is one signer's entry of the commitment list.
+type Commitment struct {
+	ID      int
+	Hiding  Element
+	Binding Element
+}
+
+// Session is the state every party of a signing session computes alike
+// from the group key, the message and the commitment list.
+type Session struct {
+	Suite       *Suite
+	GroupKey    Element
+	Message     []byte
+	Commitments []Commitment // By ascending ID
+	rhos        map[int]*Scalar
+	r           Element
+	c           *Scalar
+}
+
+// NewSession sorts the commitments, and computes the binding factors, the
+// group commitment and the challenge.
+func (s *Suite) NewSession(groupKey Element, msg []byte, list []Commitment) (*Session, error) {
+	list = slices.Clone(list)
+	slices.SortFunc(list, func(a, b Commitment) int { return a.ID - b.ID })
+	if len(list) == 0 {
+		return nil, errors.New("commitment list is empty")
+	}
+	var enc []byte
+	for i, c := range list {
+		if c.ID < 1 || c.ID > 0xFFFF || (i > 0 && c.ID == list[i-1].ID) {
+			return nil, fmt.Errorf("commitment list: bad or duplicate identifier %d", c.ID)
+		}
+		enc = slices.Concat(enc, ScalarBytes(scalarOf(c.ID)), c.Hiding.Bytes(), c.Binding.Bytes())
+	}
+
+	ss := &Session{Suite: s, GroupKey: groupKey, Message: bytes.Clone(msg), Commitments: list, rhos: make(map[int]*Scalar)}
+	prefix := slices.Concat(groupKey.Bytes(), s.digest("msg", msg), s.digest("com", enc))
+	ss.r = Element{s, s.identity()}
+	for _, c := range list {
+		rho := s.hashToScalar("rho", prefix, ScalarBytes(scalarOf(c.ID)))
+		ss.rhos[c.ID] = rho
+		ss.r = ss.r.add(c.Hiding.add(c.Binding.mul(rho)))
+	}
+	ss.c = s.hashToScalar("chal", ss.r.Bytes(), groupKey.Bytes(), msg)
+	return ss, nil
+}
+
+// BindingFactor returns participant id's binding factor.
+func (ss *Session) BindingFactor(id int) *Scalar {
+	return ss.rhos[id]
+}
+
+// lagrange is participant id's coefficient for interpolating at 0 over the
+// session's signers.
+func (ss *Session) lagrange(id int) *Scalar {
+	num, den := scalarOf(1), scalarOf(1)
+	for _, c := range ss.Commitments {
+		if c.ID == id {
+			continue
+		}
+		num.Multiply(num, scalarOf(c.ID))
+		den.Multiply(den, NewScalar().Subtract(scalarOf(c.ID), scalarOf(id)))
+	}
+	return num.Multiply(num, den.Invert(den))
+}
+
+func (ss *Session) commitment(id int) (Commitment, bool) {
+	i := slices.IndexFunc(ss.Commitments, func(c Commitment) bool { return c.ID == id })
+	if i < 0 {
+		return Commitment{}, false
+	}
+	return ss.Commitments[i], true
+}
+
+// Sign is sign: participant id's signature share from its share and the
+// nonces behind its commitment.
+func (ss *Session) Sign(id int, share, hiding, binding *Scalar) (*Scalar, error) {
+	c, ok := ss.commitment(id)
+	if !ok {
+		return nil, fmt.Errorf("participant %d is not in the commitment list", id)
+	}
+	if !ss.Suite.BaseMul(hiding).Equal(c.Hiding) || !ss.Suite.BaseMul(binding).Equal(c.Binding) {
+		return nil, fmt.Errorf("the commitment list carries a different commitment for participant %d", id)
+	}
+	// z = d + e*rho + lambda*s*c
+	z := NewScalar().MultiplyAdd(binding, ss.rhos[id], hiding)
+	x := NewScalar().Multiply(share, ss.lagrange(id))
+	z.MultiplyAdd(x, ss.c, z)
+	WipeScalar(x)
+	return z, nil
+}
+
+// VerifyShare is verify_signature_share.
+func (ss *Session) VerifyShare(id int, publicShare Element, z *Scalar) bool {
+	c, ok := ss.commitment(id)
+	if !ok {
+		return false
+	}
+	r := c.Hiding.add(c.Binding.mul(ss.rhos[id]))
+	lc := NewScalar().Multiply(ss.lagrange(id), ss.c)
+	return ss.Suite.BaseMul(z).Equal(r.add(publicShare.mul(lc)))
+}
+
+// Aggregate is aggregate: the signature R || z, checked with Verify.
+func (ss *Session) Aggregate(shares map[int]*Scalar) ([]byte, error) {
+	z := NewScalar()
+	for _, c := range ss.Commitments {
+		zi, ok := shares[c.ID]
+		if !ok {
+			return nil, fmt.Errorf("no signature share from participant %d", c.ID)
+		}
+		z.Add(z, zi)
+	}
+	sig := slices.Concat(ss.r.Bytes(), ScalarBytes(z))
+	if err := ss.Suite.Verify(ss.GroupKey.Bytes(), ss.Message, sig); err != nil {
+		return nil, err
+	}
+	return sig, nil
+}
+
+// Verify checks a signature R || z: z*G == R + c*PK. An Ed25519 signature
+// must also pass crypto/ed25519, as any RFC 8032 verifier would take it.
+func (s *Suite) Verify(publicKey, msg, sig []byte) error {
+	if len(sig) != ElementSize+ScalarSize {
+		return errors.New("signature is not 64 bytes")
+	}
+	pk, err := s.ParseElement(publicKey)
+	if err != nil {
+		return fmt.Errorf("public key: %w", err)
+	}
+	r, err := s.ParseElement(sig[:ElementSize])
+	if err != nil {
+		return fmt.Errorf("signature R: %w", err)
+	}
+	z, err := ParseScalar(sig[ElementSize:])
+	if err != nil {
+		return fmt.Errorf("signature z: %w", err)
+	}
+	c := s.hashToScalar("chal", sig[:ElementSize], publicKey, msg)
+	if !s.BaseMul(z).Equal(r.add(pk.mul(c))) {
+		return errors.New("the signature does not verify")
+	}
+	if s == Ed25519 && !ed25519.Verify(ed25519.PublicKey(publicKey), msg, sig) {
+		return errors.New("the signature does not verify as an RFC 8032 signature")
+	}
+	return nil
+}
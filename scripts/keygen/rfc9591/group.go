@@ -0,0 +1,124 @@
+package rfc9591
+
+import (
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+
+	"filippo.io/edwards25519"
+	"github.com/gtank/ristretto255"
+)
+
+// Scalar is an element of the scalar field of both suites, the integers
+// mod L, the order of edwards25519's prime-order subgroup.
+type Scalar = edwards25519.Scalar
+
+var errNotCanonical = errors.New("not a canonical encoding")
+
+// NewScalar returns the zero scalar.
+func NewScalar() *Scalar {
+	return edwards25519.NewScalar()
+}
+
+// scalarOf returns the scalar of a participant identifier.
+func scalarOf(id int) *Scalar {
+	b := make([]byte, ScalarSize)
+	binary.LittleEndian.PutUint16(b, uint16(id))
+	x, _ := NewScalar().SetCanonicalBytes(b)
+	return x
+}
+
+// WipeScalar zeroes x.
+func WipeScalar(x *Scalar) {
+	if x != nil {
+		x.Set(NewScalar())
+	}
+}
+
+// element is a point of either suite's group. Ed25519 elements are
+// edwards25519 points; ristretto255 elements are ristretto255's, which
+// only expose the quotient group.
+type element struct {
+	ed *edwards25519.Point
+	rs *ristretto255.Element
+}
+
+func (a element) add(b element) element {
+	if a.rs != nil {
+		return element{rs: ristretto255.NewElement().Add(a.rs, b.rs)}
+	}
+	return element{ed: edwards25519.NewIdentityPoint().Add(a.ed, b.ed)}
+}
+
+func (a element) mul(k *Scalar) element {
+	if a.rs != nil {
+		return element{rs: ristretto255.NewElement().ScalarMult(ristrettoScalar(k), a.rs)}
+	}
+	return element{ed: edwards25519.NewIdentityPoint().ScalarMult(k, a.ed)}
+}
+
+func (a element) bytes() []byte {
+	if a.rs != nil {
+		return a.rs.Bytes()
+	}
+	return a.ed.Bytes()
+}
+
+func (a element) equal(b element) bool {
+	return subtle.ConstantTimeCompare(a.bytes(), b.bytes()) == 1
+}
+
+// ristrettoScalar converts k to ristretto255's scalar type, which wraps
+// the same field.
+func ristrettoScalar(k *Scalar) *ristretto255.Scalar {
+	x, err := ristretto255.NewScalar().SetCanonicalBytes(k.Bytes())
+	if err != nil {
+		panic("rfc9591: scalar is not reduced")
+	}
+	return x
+}
+
+// Ed25519 group: edwards25519 in the RFC 8032 encoding.
+
+func edwardsIdentity() element { return element{ed: edwards25519.NewIdentityPoint()} }
+
+func edwardsBaseMul(k *Scalar) element {
+	return element{ed: edwards25519.NewIdentityPoint().ScalarBaseMult(k)}
+}
+
+// decodeEdwards decodes an RFC 8032 point. edwards25519 accepts
+// non-canonical encodings of y, so the caller compares the re-encoding.
+func decodeEdwards(b []byte) (element, error) {
+	q, err := edwards25519.NewIdentityPoint().SetBytes(b)
+	if err != nil {
+		return element{}, errors.New("edwards25519: not a point on the curve")
+	}
+	return element{ed: q}, nil
+}
+
+// inPrimeOrderSubgroup reports whether L*q is the identity: (L-1)*q + q,
+// as L itself is 0 mod L.
+func inPrimeOrderSubgroup(q *edwards25519.Point) bool {
+	minusOne := NewScalar().Negate(scalarOf(1))
+	lq := edwards25519.NewIdentityPoint().ScalarMult(minusOne, q)
+	lq.Add(lq, q)
+	return lq.Equal(edwards25519.NewIdentityPoint()) == 1
+}
+
+// ristretto255 group, RFC 9496.
+
+func ristrettoIdentity() element { return element{rs: ristretto255.NewIdentityElement()} }
+
+func ristrettoBaseMul(k *Scalar) element {
+	return element{rs: ristretto255.NewElement().ScalarBaseMult(ristrettoScalar(k))}
+}
+
+// decodeRistretto is DECODE of RFC 9496, which only takes canonical
+// encodings.
+func decodeRistretto(b []byte) (element, error) {
+	e, err := ristretto255.NewElement().SetCanonicalBytes(b)
+	if err != nil {
+		return element{}, errors.New("ristretto255: not a valid encoding")
+	}
+	return element{rs: e}, nil
+}
@@ -0,0 +1,224 @@
+package rfc9591
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+)
+
+// Signer is one participant's part of a Vector, in the layout of RFC 9591
+// appendix E. Empty fields are not checked.
+type Signer struct {
+	ID                     int    `json:"identifier"`
+	HidingNonceRandomness  string `json:"hiding_nonce_randomness"`
+	BindingNonceRandomness string `json:"binding_nonce_randomness,omitempty"`
+	HidingNonce            string `json:"hiding_nonce"`
+	BindingNonce           string `json:"binding_nonce,omitempty"`
+	HidingCommitment       string `json:"hiding_nonce_commitment"`
+	BindingCommitment      string `json:"binding_nonce_commitment,omitempty"`
+	BindingFactor          string `json:"binding_factor,omitempty"`
+	SigShare               string `json:"sig_share,omitempty"`
+}
+
+// Vector is a known answer for a 2-of-3 group: trusted dealer key
+// generation from fixed coefficients, round one from fixed nonce
+// randomness and, when every signer's values are given, round two and
+// aggregation.
+type Vector struct {
+	Suite          string   `json:"ciphersuite"`
+	GroupSecretKey string   `json:"group_secret_key"`
+	GroupPublicKey string   `json:"group_public_key"`
+	Message        string   `json:"message"`
+	Coefficients   []string `json:"share_polynomial_coefficients"` // After the secret key
+	Shares         []string `json:"participant_shares"`
+	Signers        []Signer `json:"signers"`
+	Signature      string   `json:"sig,omitempty"`
+}
+
+// Vectors are the known answers of RFC 9591 appendix E. The ristretto255
+// one holds key generation and participant 1's hiding nonce so far.
+var Vectors = []Vector{
+	{
+		Suite:          "FROST-ED25519-SHA512-v1",
+		GroupSecretKey: "7b1c33d3f5291d85de664833beb1ad469f7fb6025a0ec78b3a790c6e13a98304",
+		GroupPublicKey: "15d21ccd7ee42959562fc8aa63224c8851fb3ec85a3faf66040d380fb9738673",
+		Message:        "74657374",
+		Coefficients:   []string{"178199860edd8c62f5212ee91eff1295d0d670ab4ed4506866bae57e7030b204"},
+		Shares: []string{
+			"929dcc590407aae7d388761cddb0c0db6f5627aea8e217f4a033f2ec83d93509",
+			"a91e66e012e4364ac9aaa405fcafd370402d9859f7b6685c07eed76bf409e80d",
+			"d3cb090a075eb154e82fdb4b3cb507f110040905468bb9c46da8bdea643a9a02",
+		},
+		Signers: []Signer{{
+			ID:                     1,
+			HidingNonceRandomness:  "0fd2e39e111cdc266f6c0f4d0fd45c947761f1f5d3cb583dfcb9bbaf8d4c9fec",
+			BindingNonceRandomness: "69cd85f631d5f7f2721ed5e40519b1366f340a87c2f6856363dbdcda348a7501",
+			HidingNonce:            "812d6104142944d5a55924de6d49940956206909f2acaeedecda2b726e630407",
+			BindingNonce:           "b1110165fc2334149750b28dd813a39244f315cff14d4e89e6142f262ed83301",
+			HidingCommitment:       "b5aa8ab305882a6fc69cbee9327e5a45e54c08af61ae77cb8207be3d2ce13de3",
+			BindingCommitment:      "67e98ab55aa310c3120418e5050c9cf76cf387cb20ac9e4b6fdb6f82a469f932",
+			BindingFactor:          "f2cb9d7dd9beff688da6fcc83fa89046b3479417f47f55600b106760eb3b5603",
+			SigShare:               "001719ab5a53ee1a12095cd088fd149702c0720ce5fd2f29dbecf24b7281b603",
+		}, {
+			ID:                     3,
+			HidingNonceRandomness:  "86d64a260059e495d0fb4fcc17ea3da7452391baa494d4b00321098ed2a0062f",
+			BindingNonceRandomness: "13e6b25afb2eba51716a9a7d44130c0dbae0004a9ef8d7b5550c8a0e07c61775",
+			HidingNonce:            "c256de65476204095ebdc01bd11dc10e57b36bc96284595b8215222374f99c0e",
+			BindingNonce:           "243d71944d929063bc51205714ae3c2218bd3451d0214dfb5aeec2a90c35180d",
+			HidingCommitment:       "cfbdb165bd8aad6eb79deb8d287bcc0ab6658ae57fdcc98ed12c0669e90aec91",
+			BindingCommitment:      "7487bc41a6e712eea2f2af24681b58b1cf1da278ea11fe4e8b78398965f13552",
+			BindingFactor:          "b087686bf35a13f3dc78e780a34b0fe8a77fef1b9938c563f5573d71d8d7890f",
+			SigShare:               "bd86125de990acc5e1f13781d8e32c03a9bbd4c53539bbc106058bfd14326007",
+		}},
+		Signature: "36282629c383bb820a88b71cae937d41f2f2adfcc3d02e55507e2fb9e2dd3cbebd9d2b0844e49ae0f3fa935161e1419aab7b47d21a37ebeae1f17d4987b3160b",
+	},
+	{
+		Suite:          "FROST-RISTRETTO255-SHA512-v1",
+		GroupSecretKey: "1b25a55e463cfd15cf14a5d3acc3d15053f08da49c8afcf3ab265f2ebc4f970b",
+		GroupPublicKey: "e2a62f39eede11269e3bd5a7d97554f5ca384f9f6d3dd9c3c0d05083c7254f57",
+		Message:        "74657374",
+		Coefficients:   []string{"410f8b744b19325891d73736923525a4f596c805d060dfb9c98009d34e3fec02"},
+		Shares: []string{
+			"5c3430d391552f6e60ecdc093ff9f6f4488756aa6cebdbad75a768010b8f830e",
+			"b06fc5eac20b4f6e1b271d9df2343d843e1e1fb03c4cbb673f2872d459ce6f01",
+			"f17e505f0e2581c6acfe54d3846a622834b5e7b50cad9a2109a97ba7a80d5c04",
+		},
+		Signers: []Signer{{
+			ID:                    1,
+			HidingNonceRandomness: "f595a133b4d95c6e1f79887220c8b275ce6277e7f68a6640e1e7140f9be2fb5c",
+			HidingNonce:           "214f2cabb86ed71427ea7ad4283b0fae26b6746c801ce824b83ceb2b99278c03",
+			HidingCommitment:      "965def4d0958398391fc06d8c2d72932608b1e6255226de4fb8d972dac15fd57",
+		}},
+	},
+}
+
+// CheckVectors recomputes every Vector and reports the first that differs.
+func CheckVectors() error {
+	for _, v := range Vectors {
+		if err := CheckVector(v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CheckVector recomputes v and reports how it differs, if it does.
+func CheckVector(v Vector) error {
+	s, err := Lookup(v.Suite)
+	if err != nil {
+		return err
+	}
+	scalar := func(field, h string) (*Scalar, error) {
+		b, err := hex.DecodeString(h)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s: %w", s.Name, field, err)
+		}
+		x, err := ParseScalar(b)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s: %w", s.Name, field, err)
+		}
+		return x, nil
+	}
+	check := func(field, want string, got []byte) error {
+		if want != "" && hex.EncodeToString(got) != want {
+			return fmt.Errorf("%s: %s: got %x, want %s", s.Name, field, got, want)
+		}
+		return nil
+	}
+
+	coeffs := make([]*Scalar, 1+len(v.Coefficients))
+	if coeffs[0], err = scalar("group_secret_key", v.GroupSecretKey); err != nil {
+		return err
+	}
+	for i, c := range v.Coefficients {
+		if coeffs[i+1], err = scalar("share_polynomial_coefficients", c); err != nil {
+			return err
+		}
+	}
+	key, shares, err := s.Split(coeffs, len(v.Shares))
+	if err != nil {
+		return fmt.Errorf("%s: %w", s.Name, err)
+	}
+	if err := check("group_public_key", v.GroupPublicKey, key.Bytes()); err != nil {
+		return err
+	}
+	for i, want := range v.Shares {
+		if err := check(fmt.Sprintf("P%d participant_share", i+1), want, ScalarBytes(shares[i])); err != nil {
+			return err
+		}
+	}
+
+	// Round one; round two only with both nonces of every signer
+	var list []Commitment
+	nonces := make(map[int][2]*Scalar)
+	complete := v.Signature != ""
+	for _, sg := range v.Signers {
+		if sg.ID < 1 || sg.ID > len(shares) {
+			return fmt.Errorf("%s: signer %d is not a participant", s.Name, sg.ID)
+		}
+		share := shares[sg.ID-1]
+		nonce := func(field, randomness, want, wantCommit string) (*Scalar, error) {
+			r, err := hex.DecodeString(randomness)
+			if err != nil {
+				return nil, fmt.Errorf("%s: P%d %s_randomness: %w", s.Name, sg.ID, field, err)
+			}
+			k, err := s.NonceGenerate(bytes.NewReader(r), share)
+			if err != nil {
+				return nil, fmt.Errorf("%s: P%d %s_randomness: %w", s.Name, sg.ID, field, err)
+			}
+			if err := check(fmt.Sprintf("P%d %s", sg.ID, field), want, ScalarBytes(k)); err != nil {
+				return nil, err
+			}
+			return k, check(fmt.Sprintf("P%d %s_commitment", sg.ID, field), wantCommit, s.BaseMul(k).Bytes())
+		}
+		hiding, err := nonce("hiding_nonce", sg.HidingNonceRandomness, sg.HidingNonce, sg.HidingCommitment)
+		if err != nil {
+			return err
+		}
+		if sg.BindingNonceRandomness == "" {
+			complete = false
+			continue
+		}
+		binding, err := nonce("binding_nonce", sg.BindingNonceRandomness, sg.BindingNonce, sg.BindingCommitment)
+		if err != nil {
+			return err
+		}
+		nonces[sg.ID] = [2]*Scalar{hiding, binding}
+		list = append(list, Commitment{ID: sg.ID, Hiding: s.BaseMul(hiding), Binding: s.BaseMul(binding)})
+	}
+	if !complete {
+		return nil
+	}
+
+	msg, err := hex.DecodeString(v.Message)
+	if err != nil {
+		return fmt.Errorf("%s: message: %w", s.Name, err)
+	}
+	session, err := s.NewSession(key, msg, list)
+	if err != nil {
+		return fmt.Errorf("%s: %w", s.Name, err)
+	}
+	zs := make(map[int]*Scalar)
+	for _, sg := range v.Signers {
+		if err := check(fmt.Sprintf("P%d binding_factor", sg.ID), sg.BindingFactor, ScalarBytes(session.BindingFactor(sg.ID))); err != nil {
+			return err
+		}
+		share := shares[sg.ID-1]
+		z, err := session.Sign(sg.ID, share, nonces[sg.ID][0], nonces[sg.ID][1])
+		if err != nil {
+			return fmt.Errorf("%s: %w", s.Name, err)
+		}
+		if err := check(fmt.Sprintf("P%d sig_share", sg.ID), sg.SigShare, ScalarBytes(z)); err != nil {
+			return err
+		}
+		if !session.VerifyShare(sg.ID, s.BaseMul(share), z) {
+			return fmt.Errorf("%s: P%d sig_share does not verify", s.Name, sg.ID)
+		}
+		zs[sg.ID] = z
+	}
+	sig, err := session.Aggregate(zs)
+	if err != nil {
+		return fmt.Errorf("%s: %w", s.Name, err)
+	}
+	return check("sig", v.Signature, sig)
+}
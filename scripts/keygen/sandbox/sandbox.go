@@ -0,0 +1,236 @@
+// Package sandbox runs helper programs that keygen does not trust, such as
+// coordinator approval hooks and exporter plugins, with resource limits and
+// without access to key material.
+//
+// Each program runs in its own process group with a wall-clock timeout, CPU
+// and address-space limits (set with ulimit before exec), a bounded amount
+// of captured output, an empty working directory and an environment holding
+// only PATH and the variables passed in. When bubblewrap (bwrap) is
+// installed, the program also gets a read-only view of the file system with
+// the Hide paths replaced by empty ones, and no network unless allowed.
+// Without bwrap hidden paths cannot be enforced, and Run refuses unless
+// Limits.Unconfined is set.
+package sandbox
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Errors
+var (
+	ErrTimeout    = errors.New("time limit exceeded")
+	ErrCPU        = errors.New("CPU limit exceeded")
+	ErrOutput     = errors.New("output limit exceeded")
+	ErrUnconfined = errors.New("cannot hide paths without bubblewrap (bwrap)")
+)
+
+// Limits configures a run. Zero values mean no limit, except Output.
+type Limits struct {
+	Timeout time.Duration // Wall clock; the whole process group is killed after it
+	CPU     time.Duration // CPU time, rounded up to whole seconds
+	Memory  int64         // Address space in bytes
+	Output  int64         // Bytes kept of stdout and of stderr each; default 1 MiB
+	Env     []string      // NAME=value pairs; nothing else but PATH is inherited
+	Hide    []string      // Paths the program must not read (keystores, share files)
+	Network bool          // Keep network access when confined by bwrap
+
+	// Unconfined runs the program even when Hide cannot be enforced.
+	Unconfined bool
+}
+
+// Default are the limits for hooks and plugins unless configured otherwise.
+var Default = Limits{
+	Timeout: 30 * time.Second,
+	CPU:     10 * time.Second,
+	Memory:  1 << 30,
+	Output:  16 << 20,
+}
+
+// Result is the output of a program that ran to completion.
+type Result struct {
+	Stdout   []byte
+	Stderr   []byte
+	ExitCode int
+}
+
+// Run runs argv with stdin under l. A non-zero exit is not an error: it is
+// reported in Result.ExitCode. Errors are returned for programs that could
+// not start or broke a limit.
+func Run(ctx context.Context, l Limits, argv []string, stdin io.Reader) (*Result, error) {
+	if len(argv) == 0 {
+		return nil, errors.New("sandbox: empty command")
+	}
+	hide, err := hidden(l.Hide)
+	if err != nil {
+		return nil, err
+	}
+	bwrap, _ := exec.LookPath("bwrap")
+	if bwrap == "" && len(hide) > 0 && !l.Unconfined {
+		return nil, fmt.Errorf("sandbox: %s: %w", argv[0], ErrUnconfined)
+	}
+
+	dir, err := os.MkdirTemp("", "fy-ledger-sandbox-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	// ulimit applies to the shell, and exec hands the limits to the program
+	script := "ulimit -c 0"
+	if l.CPU > 0 {
+		// SIGXCPU at the soft limit, SIGKILL a second later if ignored
+		secs := int64((l.CPU + time.Second - 1) / time.Second)
+		script += fmt.Sprintf(" && ulimit -t %d && ulimit -S -t %d", secs+1, secs)
+	}
+	if l.Memory > 0 {
+		script += fmt.Sprintf(" && ulimit -v %d", (l.Memory+1023)/1024)
+	}
+	script += ` && exec "$@"`
+	cmdline := append([]string{"/bin/sh", "-c", script, "sh"}, argv...)
+
+	cwd := dir
+	if bwrap != "" {
+		cmdline, cwd = confine(bwrap, l, hide, dir, cmdline, argv), "/"
+	}
+
+	if l.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, l.Timeout)
+		defer cancel()
+	}
+	cmd := exec.CommandContext(ctx, cmdline[0], cmdline[1:]...)
+	cmd.Dir = cwd
+	cmd.Env = environ(l.Env, dir)
+	cmd.Stdin = stdin
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+	cmd.WaitDelay = time.Second // Do not wait on descendants holding the pipes
+
+	limit := l.Output
+	if limit <= 0 {
+		limit = 1 << 20
+	}
+	stdout := &capped{limit: limit}
+	stderr := &capped{limit: limit}
+	cmd.Stdout, cmd.Stderr = stdout, stderr
+
+	err = cmd.Run()
+	res := &Result{Stdout: stdout.buf.Bytes(), Stderr: stderr.buf.Bytes(), ExitCode: cmd.ProcessState.ExitCode()}
+	switch {
+	case ctx.Err() == context.DeadlineExceeded:
+		return nil, fmt.Errorf("sandbox: %s: %w after %s", argv[0], ErrTimeout, l.Timeout)
+	case stdout.over || stderr.over:
+		return nil, fmt.Errorf("sandbox: %s: %w (%d bytes)", argv[0], ErrOutput, limit)
+	case signaled(cmd.ProcessState, syscall.SIGXCPU):
+		return nil, fmt.Errorf("sandbox: %s: %w (%s)", argv[0], ErrCPU, l.CPU)
+	}
+	var exitErr *exec.ExitError
+	if err != nil && !errors.As(err, &exitErr) {
+		return nil, fmt.Errorf("sandbox: %s: %w", argv[0], err)
+	}
+	return res, nil
+}
+
+// confine wraps cmdline in bwrap, with dir as the writable working directory.
+func confine(bwrap string, l Limits, hide []string, dir string, cmdline, argv []string) []string {
+	args := []string{bwrap,
+		"--die-with-parent", "--new-session", "--unshare-all",
+		"--ro-bind", "/", "/",
+		"--dev", "/dev",
+		"--proc", "/proc",
+		"--tmpfs", "/tmp",
+		"--chdir", dir,
+	}
+	if l.Network {
+		args = append(args, "--share-net")
+	}
+	for _, p := range hide {
+		if fi, err := os.Stat(p); err == nil && !fi.IsDir() {
+			args = append(args, "--ro-bind", "/dev/null", p)
+		} else {
+			args = append(args, "--tmpfs", p)
+		}
+	}
+	// The working directory and the program are bound after the hidden
+	// paths, so they stay usable when they lie under one of them (e.g.
+	// TMPDIR or ~/bin inside $HOME)
+	args = append(args, "--bind", dir, dir)
+	if program := argv[0]; filepath.IsAbs(program) {
+		args = append(args, "--ro-bind", program, program)
+	}
+	args = append(args, "--")
+	return append(args, cmdline...)
+}
+
+// hidden resolves the paths to hide, dropping those that do not exist.
+func hidden(paths []string) ([]string, error) {
+	var out []string
+	for _, p := range paths {
+		if p == "" {
+			continue
+		}
+		abs, err := filepath.Abs(p)
+		if err != nil {
+			return nil, err
+		}
+		if real, err := filepath.EvalSymlinks(abs); err == nil {
+			abs = real
+		} else if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if abs == "/" {
+			return nil, fmt.Errorf("sandbox: refusing to hide /")
+		}
+		out = append(out, abs)
+	}
+	return out, nil
+}
+
+func environ(extra []string, dir string) []string {
+	env := []string{"HOME=" + dir, "TMPDIR=" + dir, "LANG=C.UTF-8"}
+	if path := os.Getenv("PATH"); path != "" {
+		env = append(env, "PATH="+path)
+	}
+	for _, kv := range extra {
+		if strings.Contains(kv, "=") {
+			env = append(env, kv)
+		}
+	}
+	return env
+}
+
+func signaled(ps *os.ProcessState, sig syscall.Signal) bool {
+	if ps == nil {
+		return false
+	}
+	ws, ok := ps.Sys().(syscall.WaitStatus)
+	return ok && ws.Signaled() && ws.Signal() == sig
+}
+
+// capped keeps the first limit bytes written and fails writes beyond them.
+type capped struct {
+	buf   bytes.Buffer
+	limit int64
+	over  bool
+}
+
+func (c *capped) Write(p []byte) (int, error) {
+	if room := c.limit - int64(c.buf.Len()); int64(len(p)) > room {
+		c.buf.Write(p[:max(room, 0)])
+		c.over = true
+		return 0, ErrOutput
+	}
+	return c.buf.Write(p)
+}
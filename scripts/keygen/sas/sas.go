@@ -0,0 +1,76 @@
+// Package sas derives short authentication strings: a few words two
+// participants of a ceremony read to each other over a video call to confirm
+// they saw the same transcript.
+//
+// A coordinator or relay that shows different participants different
+// commitments (to bias the key, or to learn a share it should not) gives the
+// affected pairs different codes. The codes are short, so they only resist
+// an attacker who must commit to the transcript before the call, as every
+// ceremony participant does by publishing their commitments first.
+package sas
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Size is the number of words in a code (32 bits).
+const Size = 4
+
+const domain = "fy-ledger/sas/v1"
+
+// Code returns the code participants a and b read to each other for a
+// transcript. It does not depend on the order of a and b.
+func Code(transcript []byte, a, b string) string {
+	if a > b {
+		a, b = b, a
+	}
+	h := sha256.New()
+	h.Write([]byte(domain))
+	for _, part := range [][]byte{transcript, []byte(a), []byte(b)} {
+		var n [8]byte
+		binary.BigEndian.PutUint64(n[:], uint64(len(part)))
+		h.Write(n[:])
+		h.Write(part)
+	}
+	sum := h.Sum(nil)
+	words := make([]string, Size)
+	for i := range words {
+		words[i] = Words[sum[i]]
+	}
+	return strings.Join(words, " ")
+}
+
+// Check compares a code as entered by a participant with the expected one,
+// ignoring case and separators. A word not in Words is reported as a typo
+// rather than a mismatch, so it can be re-entered.
+func Check(expected, entered string) error {
+	got := strings.FieldsFunc(strings.ToLower(entered), func(r rune) bool {
+		return r == ' ' || r == '-' || r == ',' || r == '\t'
+	})
+	for _, w := range got {
+		if !isWord(w) {
+			return fmt.Errorf("%q is not a code word", w)
+		}
+	}
+	if strings.Join(got, " ") != expected {
+		return ErrMismatch
+	}
+	return nil
+}
+
+// ErrMismatch is returned by Check when the codes differ: the two
+// participants saw different transcripts.
+var ErrMismatch = errors.New("codes differ: the transcripts do not match")
+
+func isWord(w string) bool {
+	for _, x := range Words {
+		if x == w {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,42 @@
+package sas
+
+// Words maps each byte of a code to a word: 256 common, concrete words, easy
+// to say and to tell apart over a poor audio link.
+var Words = [256]string{
+	"acid", "acorn", "actor", "adobe", "agent", "alarm", "album", "alley",
+	"amber", "angle", "ankle", "apple", "april", "arena", "armor", "arrow",
+	"atlas", "attic", "autumn", "bacon", "badge", "bagel", "baker", "bamboo",
+	"banjo", "barrel", "basket", "beacon", "berry", "bishop", "blanket",
+	"blossom", "bonfire", "border", "bottle", "bracket", "breeze", "bridge",
+	"bucket", "buffalo", "bundle", "butter", "cabin", "cactus", "camel",
+	"canyon", "carpet", "castle", "cedar", "cello", "chalk", "cherry",
+	"chimney", "cider", "circus", "citrus", "clover", "cobalt", "cocoa",
+	"coffee", "comet", "copper", "coral", "cosmos", "cotton", "coyote",
+	"crayon", "cricket", "crystal", "curtain", "cypress", "dagger", "daisy",
+	"dancer", "delta", "denim", "desert", "dinner", "doctor", "dolphin",
+	"domino", "donkey", "dragon", "dune", "eagle", "easel", "eclipse", "elbow",
+	"ember", "engine", "falcon", "fennel", "ferry", "fiddle", "finch",
+	"flannel", "flute", "forest", "fossil", "fountain", "fox", "fridge", "frog",
+	"galaxy", "garlic", "gazelle", "geyser", "ginger", "glacier", "goblet",
+	"gopher", "granite", "grape", "guitar", "hammer", "harvest", "hazel",
+	"helmet", "hickory", "hippo", "honey", "hornet", "iceberg", "igloo",
+	"indigo", "island", "ivory", "jacket", "jaguar", "jasmine", "jelly",
+	"jersey", "jigsaw", "jungle", "kayak", "kennel", "kernel", "kettle",
+	"kitten", "koala", "ladder", "lagoon", "lantern", "laser", "lemon",
+	"lentil", "lettuce", "lilac", "lizard", "lobster", "locket", "lotus",
+	"lumber", "magnet", "mango", "maple", "marble", "meadow", "melon", "mitten",
+	"monsoon", "mosaic", "muffin", "mustard", "napkin", "nectar", "needle",
+	"nickel", "noodle", "nutmeg", "oasis", "oatmeal", "ocean", "olive", "onion",
+	"opal", "orbit", "orchid", "otter", "oyster", "paddle", "pagoda", "panda",
+	"papaya", "parrot", "peanut", "pebble", "pelican", "pepper", "piano",
+	"pickle", "pigeon", "pilot", "pirate", "planet", "plum", "pocket", "pony",
+	"poppy", "potato", "pretzel", "puffin", "pumpkin", "puzzle", "quartz",
+	"quiver", "rabbit", "radar", "raven", "ribbon", "river", "robin", "rocket",
+	"rooster", "saddle", "salmon", "satchel", "scarf", "scooter", "shovel",
+	"silver", "skate", "sparrow", "spinach", "squirrel", "statue", "sugar",
+	"summit", "sunset", "swallow", "tablet", "tango", "teapot", "thimble",
+	"thunder", "tiger", "tomato", "topaz", "tractor", "trumpet", "tulip",
+	"tundra", "turtle", "unicorn", "valley", "vanilla", "velvet", "violin",
+	"volcano", "waffle", "walnut", "wizard", "yogurt", "zebra", "zipper",
+	"zucchini",
+}
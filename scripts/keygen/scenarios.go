@@ -0,0 +1,668 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"math/big"
+	"os"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"text/tabwriter"
+	"time"
+
+	"keygen/apdu"
+	"keygen/clock"
+	"keygen/coordinator"
+	"keygen/frostcore"
+	"keygen/groupstate"
+	"keygen/secret"
+	"keygen/simdevice"
+)
+
+// ScenarioReport is the output of test scenarios.
+type ScenarioReport struct {
+	Scenarios []ScenarioResult `json:"scenarios"`
+	Pass      bool             `json:"pass"`
+}
+
+// ScenarioResult is one scenario run.
+type ScenarioResult struct {
+	Name    string               `json:"name"`
+	Summary string               `json:"summary"`
+	Steps   []ScenarioStepResult `json:"steps"`
+	Pass    bool                 `json:"pass"`
+}
+
+// ScenarioStepResult is one step of a scenario. Steps after a failed one are
+// skipped, since each builds on the state the one before left.
+type ScenarioStepResult struct {
+	Step   string `json:"step"`
+	Result string `json:"result"`           // ok, fail or skipped
+	Detail string `json:"detail,omitempty"` // Why it failed
+}
+
+// scenario is an acceptance runbook: the steps an operator takes, each
+// saying what must happen, and the code that takes the step and checks it.
+// The runbooks document the expected behaviour of the devices, the host
+// and the coordinator, and test scenarios keeps them true.
+type scenario struct {
+	name    string
+	summary string
+	steps   []scenarioStep
+}
+
+type scenarioStep struct {
+	title string
+	run   func(e *scenarioEnv) error
+}
+
+// scenarios is the library of runbooks, in the order they run.
+var scenarios = []scenario{
+	{
+		name:    "happy-path",
+		summary: "A 2-of-3 group signs a message through the coordinator.",
+		steps: []scenarioStep{
+			{"Deal a 2-of-3 key and inject each share into its device; every device reports the group key.", func(e *scenarioEnv) error {
+				return e.newGroup(2, 3)
+			}},
+			{"Create a session for signers 1 and 2; it waits for their commitments.", func(e *scenarioEnv) error {
+				return e.create(1, 2)
+			}},
+			{"Each signer's device commits; the coordinator accepts both commitments and waits for partial signatures.", func(e *scenarioEnv) error {
+				return e.commit(1, 2)
+			}},
+			{"Each signer approves on its device and submits its partial signature; the coordinator aggregates a valid signature.", func(e *scenarioEnv) error {
+				return e.sign(1, 2)
+			}},
+			{"The signature verifies under the group key.", func(e *scenarioEnv) error {
+				return e.verify()
+			}},
+		},
+	},
+	{
+		name:    "participant-dropout",
+		summary: "Signer 2 never commits; the session times out and restarts with participant 3 in its place.",
+		steps: []scenarioStep{
+			{"Deal a 2-of-3 key and inject each share into its device.", func(e *scenarioEnv) error {
+				return e.newGroup(2, 3)
+			}},
+			{"Create a session for signers 1 and 2; only signer 1 commits.", func(e *scenarioEnv) error {
+				if err := e.create(1, 2); err != nil {
+					return err
+				}
+				return e.commit(1)
+			}},
+			{"The commitment timeout passes: the session fails in the commitments phase, a late commitment from signer 2 is refused, and its device discards the nonces.", func(e *scenarioEnv) error {
+				e.clock.Advance(time.Duration(coordinator.DefaultTimeouts.Commitments) + time.Second)
+				s, err := e.request(coordinator.OpGetSession, e.session.ID, nil)
+				if err != nil {
+					return err
+				}
+				if s.State != coordinator.StateFailed || s.TimedOut != coordinator.PhaseCommitments {
+					return fmt.Errorf("session is %s, timed out in %q", s.State, s.TimedOut)
+				}
+				e.session = s
+				if err := e.commit(2); !errors.Is(err, coordinator.ErrCommitmentTimeout) {
+					return fmt.Errorf("late commitment: got %v, want a commitment timeout", err)
+				}
+				_, err = soakExchange(e.transport(2), apdu.Command(apdu.InsReset, 0, 0, nil))
+				return err
+			}},
+			{"Restart the session with participant 3 replacing signer 2; signer 1's commitment carries over.", func(e *scenarioEnv) error {
+				old := e.session
+				s, err := e.request(coordinator.OpRestartSession, old.ID, coordinator.RestartParams{Replacements: map[int]int{2: 3}})
+				if err != nil {
+					return err
+				}
+				if !slices.Equal(s.Signers, []int{1, 3}) || s.RestartOf != old.ID || s.Salvaged[1] != old.ID {
+					return fmt.Errorf("restarted session has signers %v, restarts %q, salvaged %v", s.Signers, s.RestartOf, s.Salvaged)
+				}
+				e.session = s
+				return nil
+			}},
+			{"Participant 3 commits and both sign; signer 1's device signs with the nonces it committed to before the restart.", func(e *scenarioEnv) error {
+				if err := e.commit(3); err != nil {
+					return err
+				}
+				if err := e.sign(1, 3); err != nil {
+					return err
+				}
+				return e.verify()
+			}},
+		},
+	},
+	{
+		name:    "device-rejection",
+		summary: "Signer 2 rejects the signing prompt; the session waits, and a new session signs.",
+		steps: []scenarioStep{
+			{"Deal a 2-of-3 key and inject each share into its device.", func(e *scenarioEnv) error {
+				return e.newGroup(2, 3)
+			}},
+			{"Create a session for signers 1 and 2; both commit and signer 1 signs.", func(e *scenarioEnv) error {
+				if err := e.create(1, 2); err != nil {
+					return err
+				}
+				if err := e.commit(1, 2); err != nil {
+					return err
+				}
+				return e.sign(1)
+			}},
+			{"Signer 2's operator rejects the prompt: the device answers 6985, the host reports a rejection (exit code 6), and the device drops its nonces.", func(e *scenarioEnv) error {
+				e.rejecting.Store(2)
+				err := e.sign(2)
+				var sw statusError
+				if !errors.As(err, &sw) || statusKind(uint16(sw), apdu.InsPartialSign) != KindRejected {
+					return fmt.Errorf("PARTIAL_SIGN: got %v, want a rejection", err)
+				}
+				if state := e.devices.devices[1].Stats().State; state != simdevice.StateIdle.String() {
+					return fmt.Errorf("device left in state %s", state)
+				}
+				return nil
+			}},
+			{"The coordinator keeps the session waiting for partial signatures, with signer 1's alone.", func(e *scenarioEnv) error {
+				s, err := e.request(coordinator.OpGetSession, e.session.ID, nil)
+				if err != nil {
+					return err
+				}
+				if _, ok := s.Partials[1]; s.State != coordinator.StateCollectingPartials || len(s.Partials) != 1 || !ok {
+					return fmt.Errorf("session is %s with %d partial signatures", s.State, len(s.Partials))
+				}
+				return nil
+			}},
+			{"Signer 2 approves a new session of the same signers, which signs.", func(e *scenarioEnv) error {
+				e.rejecting.Store(0)
+				if err := e.create(1, 2); err != nil {
+					return err
+				}
+				if err := e.commit(1, 2); err != nil {
+					return err
+				}
+				if err := e.sign(1, 2); err != nil {
+					return err
+				}
+				return e.verify()
+			}},
+		},
+	},
+	{
+		name:    "coordinator-restart",
+		summary: "The coordinator restarts mid-session; the session is lost, and a new one signs with fresh nonces.",
+		steps: []scenarioStep{
+			{"Deal a 2-of-3 key and inject each share into its device.", func(e *scenarioEnv) error {
+				return e.newGroup(2, 3)
+			}},
+			{"Create a session for signers 1 and 2; both commit.", func(e *scenarioEnv) error {
+				if err := e.create(1, 2); err != nil {
+					return err
+				}
+				return e.commit(1, 2)
+			}},
+			{"The coordinator restarts with the same group: it keeps sessions in memory only, so the session is not found.", func(e *scenarioEnv) error {
+				e.c = coordinator.New()
+				e.c.SetClock(e.clock)
+				e.c.AddGroup(e.doc)
+				_, err := e.request(coordinator.OpGetSession, e.session.ID, nil)
+				if coordinator.CodeOf(err) != coordinator.CodeNotFound {
+					return fmt.Errorf("get_session after the restart: got %v, want not_found", err)
+				}
+				return nil
+			}},
+			{"Each signer resets its device, discarding the nonces it committed to.", func(e *scenarioEnv) error {
+				for _, id := range []int{1, 2} {
+					if _, err := soakExchange(e.transport(id), apdu.Command(apdu.InsReset, 0, 0, nil)); err != nil {
+						return fmt.Errorf("participant %d: %w", id, err)
+					}
+					if state := e.devices.devices[id-1].Stats().State; state != simdevice.StateIdle.String() {
+						return fmt.Errorf("participant %d: device left in state %s", id, state)
+					}
+				}
+				return nil
+			}},
+			{"A new session on the restarted coordinator signs; the devices commit to fresh nonces.", func(e *scenarioEnv) error {
+				before := e.commitments
+				if err := e.create(1, 2); err != nil {
+					return err
+				}
+				if err := e.commit(1, 2); err != nil {
+					return err
+				}
+				for id, c := range before {
+					if bytes.Equal(c, e.commitments[id]) {
+						return fmt.Errorf("participant %d committed to the lost session's nonces again", id)
+					}
+				}
+				if err := e.sign(1, 2); err != nil {
+					return err
+				}
+				return e.verify()
+			}},
+		},
+	},
+	{
+		name:    "reshare-then-sign",
+		summary: "Signers 1 and 2 reshare the 2-of-3 group to 3-of-4; the new roster signs under the same group key.",
+		steps: []scenarioStep{
+			{"Deal a 2-of-3 key and inject each share into its device.", func(e *scenarioEnv) error {
+				return e.newGroup(2, 3)
+			}},
+			{"Signers 1 and 2 deal their shares to a 3-of-4 roster; every contribution verifies and the new shares add up to the same group key.", func(e *scenarioEnv) error {
+				return e.reshare([]int{1, 2}, 3, 4)
+			}},
+			{"Inject the new shares into four new devices and register the new roster with the coordinator.", func(e *scenarioEnv) error {
+				return e.replaceDevices()
+			}},
+			{"Signers 1, 3 and 4 of the new roster sign a valid signature under the unchanged group key.", func(e *scenarioEnv) error {
+				if err := e.create(1, 3, 4); err != nil {
+					return err
+				}
+				if err := e.commit(1, 3, 4); err != nil {
+					return err
+				}
+				if err := e.sign(1, 3, 4); err != nil {
+					return err
+				}
+				return e.verify()
+			}},
+			{"A device still holding participant 1's old share cannot sign for the new roster: the signature does not verify, so old shares must be destroyed.", func(e *scenarioEnv) error {
+				old, err := newSoakDevices(e.groupKey, e.oldShares[:1], e.useTCP, nil)
+				if err != nil {
+					return err
+				}
+				e.cleanup = append(e.cleanup, old.close)
+				t, err := old.open(1)
+				if err != nil {
+					return err
+				}
+				e.transports[1].Close()
+				e.transports[1] = t
+				if err := e.create(1, 2, 3); err != nil {
+					return err
+				}
+				if err := e.commit(1, 2, 3); err != nil {
+					return err
+				}
+				if err := e.sign(1, 2, 3); err != nil {
+					return err
+				}
+				if e.session.Result == nil || e.session.Result.Valid {
+					return fmt.Errorf("session %s ended %s with a valid signature", e.session.ID, e.session.State)
+				}
+				return nil
+			}},
+		},
+	},
+}
+
+// runTest implements the test subcommands:
+//
+//	test scenarios [-run name,...] [-list] [-tcp] [-json]
+func runTest(args []string) {
+	if len(args) < 1 || args[0] != "scenarios" {
+		fail(KindUsage, "Usage: keygen test scenarios [-run name,...] [-list] [-tcp] [-json]")
+	}
+	runScenarios(args[1:])
+}
+
+// runScenarios runs the acceptance runbooks, or prints them with -list.
+// Each runs on its own simulated network: simdevices, over loopback with
+// -tcp, and an in-process coordinator on a fake clock, so timeouts pass at
+// once. The command prints one line per step and exits 1 if any fails.
+func runScenarios(args []string) {
+	cmd := flag.NewFlagSet("test scenarios", flag.ExitOnError)
+	only := cmd.String("run", "", "Comma-separated scenarios to run (default: all)")
+	list := cmd.Bool("list", false, "Print the runbooks instead of running them")
+	useTCP := cmd.Bool("tcp", false, "Reach the devices over the Speculos APDU protocol on loopback")
+	asJSON := cmd.Bool("json", false, "Print JSON instead of text")
+	stdioFlags(cmd)
+	cmd.Parse(args)
+	if cmd.NArg() != 0 {
+		fail(KindUsage, "Usage: keygen test scenarios [-run name,...] [-list] [-tcp] [-json]")
+	}
+
+	selected := scenarios
+	if *only != "" {
+		selected = nil
+		for _, name := range strings.Split(*only, ",") {
+			i := slices.IndexFunc(scenarios, func(s scenario) bool { return s.name == strings.TrimSpace(name) })
+			if i < 0 {
+				fail(KindUsage, "Error: unknown scenario %q (%s)", name, strings.Join(scenarioNames(), ", "))
+			}
+			selected = append(selected, scenarios[i])
+		}
+	}
+	if *list {
+		for i, s := range selected {
+			if i > 0 {
+				fmt.Println()
+			}
+			fmt.Printf("%s: %s\n", s.name, s.summary)
+			for j, st := range s.steps {
+				fmt.Printf("  %d. %s\n", j+1, st.title)
+			}
+		}
+		return
+	}
+
+	report := ScenarioReport{Pass: true}
+	for _, s := range selected {
+		r := s.run(*useTCP)
+		report.Scenarios = append(report.Scenarios, r)
+		report.Pass = report.Pass && r.Pass
+	}
+	if *asJSON {
+		writeJSON(report)
+	} else {
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "SCENARIO\tSTEP\tRESULT")
+		for _, r := range report.Scenarios {
+			for i, st := range r.Steps {
+				result := st.Result
+				if st.Detail != "" {
+					result = "FAIL: " + st.Detail
+				}
+				fmt.Fprintf(w, "%s\t%d\t%s\n", r.Name, i+1, result)
+			}
+		}
+		w.Flush()
+	}
+	if !report.Pass {
+		fail(KindFailure, "Scenario test failed")
+	}
+}
+
+func scenarioNames() []string {
+	names := make([]string, len(scenarios))
+	for i, s := range scenarios {
+		names[i] = s.name
+	}
+	return names
+}
+
+// run takes the scenario's steps in order on a new network.
+func (s scenario) run(useTCP bool) ScenarioResult {
+	e := &scenarioEnv{useTCP: useTCP, clock: clock.NewFake(time.Now()), transports: make(map[int]apdu.Transport)}
+	defer e.close()
+	r := ScenarioResult{Name: s.name, Summary: s.summary, Pass: true}
+	for _, st := range s.steps {
+		res := ScenarioStepResult{Step: st.title, Result: "ok"}
+		if !r.Pass {
+			res.Result = "skipped"
+		} else if err := st.run(e); err != nil {
+			res.Result, res.Detail = "fail", err.Error()
+			r.Pass = false
+		}
+		r.Steps = append(r.Steps, res)
+	}
+	return r
+}
+
+// scenarioEnv is a scenario's network and what its steps left behind.
+type scenarioEnv struct {
+	useTCP     bool
+	clock      *clock.Fake
+	c          *coordinator.Coordinator
+	groupKey   []byte
+	shares     []*big.Int // Participant i+1's at index i
+	oldShares  []*big.Int // The shares before a reshare
+	doc        *groupstate.Document
+	next       *groupstate.Document // The roster a reshare dealt to
+	devices    *soakDevices
+	rejecting  atomic.Int32 // Participant whose device rejects PARTIAL_SIGN
+	transports map[int]apdu.Transport
+
+	session     *coordinator.Session
+	msg         []byte
+	commitments map[int][]byte // COMMIT responses in the current session
+	cleanup     []func()
+}
+
+// statusError is the status word of a PARTIAL_SIGN that did not succeed.
+type statusError uint16
+
+func (sw statusError) Error() string {
+	return fmt.Sprintf("PARTIAL_SIGN: %s", apdu.ExplainStatus(uint16(sw), apdu.InsPartialSign))
+}
+
+// newGroup deals a t-of-n key, injects the shares into new devices that
+// report the group key, and registers the group with a new coordinator.
+func (e *scenarioEnv) newGroup(t, n int) error {
+	var err error
+	if e.groupKey, e.shares, e.doc, err = newTestGroup(t, n); err != nil {
+		return err
+	}
+	e.c = coordinator.New()
+	e.c.SetClock(e.clock)
+	e.c.AddGroup(e.doc)
+	return e.injectShares()
+}
+
+// injectShares injects e.shares into new devices and checks that each
+// reports the group key.
+func (e *scenarioEnv) injectShares() error {
+	var err error
+	e.devices, err = newSoakDevices(e.groupKey, e.shares, e.useTCP, func(id int, p simdevice.Prompt) bool {
+		return p.Kind != simdevice.PromptSign || int(e.rejecting.Load()) != id
+	})
+	if err != nil {
+		return err
+	}
+	for id := range e.shares {
+		key, err := soakExchange(e.transport(id+1), apdu.Command(apdu.InsGetPublicKey, 0, 0, nil))
+		if err != nil {
+			return fmt.Errorf("participant %d: %w", id+1, err)
+		}
+		if !bytes.Equal(key, e.groupKey) {
+			return fmt.Errorf("participant %d: device reports group key %x", id+1, key)
+		}
+	}
+	return nil
+}
+
+// transport returns the connection to participant id's device, opening it
+// on first use.
+func (e *scenarioEnv) transport(id int) apdu.Transport {
+	t, ok := e.transports[id]
+	if !ok {
+		var err error
+		if t, err = e.devices.open(id); err != nil {
+			t = failedTransport{err}
+		}
+		e.transports[id] = t
+	}
+	return t
+}
+
+// failedTransport fails every exchange with the error that kept it from
+// connecting.
+type failedTransport struct{ err error }
+
+func (t failedTransport) Exchange([]byte) ([]byte, error) { return nil, t.err }
+func (t failedTransport) Close() error                    { return nil }
+
+func (e *scenarioEnv) closeTransports() {
+	for _, t := range e.transports {
+		t.Close()
+	}
+	clear(e.transports)
+}
+
+func (e *scenarioEnv) close() {
+	e.closeTransports()
+	if e.devices != nil {
+		e.devices.close()
+	}
+	for _, f := range e.cleanup {
+		f()
+	}
+}
+
+// request sends one coordinator request and returns the session.
+func (e *scenarioEnv) request(op, sessionID string, params any) (*coordinator.Session, error) {
+	return soakRequest(context.Background(), e.c, op, sessionID, params)
+}
+
+// create starts a session of signers on a random message.
+func (e *scenarioEnv) create(signers ...int) error {
+	e.msg = make([]byte, 32)
+	rand.Read(e.msg)
+	s, err := e.request(coordinator.OpCreateSession, "", coordinator.CreateSessionParams{
+		GroupKey:    e.doc.GroupKey,
+		MessageHash: hex.EncodeToString(e.msg),
+		Signers:     signers,
+	})
+	if err != nil {
+		return err
+	}
+	if s.State != coordinator.StateCollectingCommitments {
+		return fmt.Errorf("new session %s is %s", s.ID, s.State)
+	}
+	e.session, e.commitments = s, make(map[int][]byte)
+	return nil
+}
+
+// commit has each of ids' devices commit and submits the commitment,
+// which the coordinator must accept.
+func (e *scenarioEnv) commit(ids ...int) error {
+	for _, id := range ids {
+		data, err := soakExchange(e.transport(id), apdu.Command(apdu.InsCommit, 0, 0, nil))
+		if err != nil {
+			return fmt.Errorf("participant %d: %w", id, err)
+		}
+		if len(data) != 2*frostcore.PointSize {
+			return fmt.Errorf("participant %d: COMMIT returned %d bytes", id, len(data))
+		}
+		s, err := e.request(coordinator.OpSubmitCommitment, e.session.ID, coordinator.CommitmentParams{
+			ID:            id,
+			HidingCommit:  hex.EncodeToString(data[:frostcore.PointSize]),
+			BindingCommit: hex.EncodeToString(data[frostcore.PointSize:]),
+		})
+		if err != nil {
+			return err
+		}
+		if _, ok := s.Commitments[id]; !ok {
+			return fmt.Errorf("participant %d: commitment not recorded", id)
+		}
+		e.session, e.commitments[id] = s, data
+	}
+	if len(e.session.Commitments) == len(e.session.Signers) && e.session.State != coordinator.StateCollectingPartials {
+		return fmt.Errorf("session %s is %s with every commitment in", e.session.ID, e.session.State)
+	}
+	return nil
+}
+
+// sign has each of ids' devices sign the session and submits the partial
+// signature. A status word other than 9000 is returned as a statusError,
+// after the device has been reset if it was left mid-session.
+func (e *scenarioEnv) sign(ids ...int) error {
+	list := frostcore.EncodeCommitments(e.session.CommitmentList())
+	for _, id := range ids {
+		t := e.transport(id)
+		if _, err := soakExchange(t, apdu.Command(apdu.InsInjectMessage, 0, 0, e.msg)); err != nil {
+			return fmt.Errorf("participant %d: %w", id, err)
+		}
+		if err := apdu.SendCommitments(t, list, 0); err != nil {
+			return fmt.Errorf("participant %d: %w", id, err)
+		}
+		z, sw, err := rejectExchange(t, apdu.Command(apdu.InsPartialSign, 0, 0, nil))
+		if err != nil {
+			return fmt.Errorf("participant %d: %w", id, err)
+		}
+		if sw != apdu.SwOK {
+			return fmt.Errorf("participant %d: %w", id, statusError(sw))
+		}
+		s, err := e.request(coordinator.OpSubmitPartial, e.session.ID, coordinator.PartialParams{ID: id, PartialSig: hex.EncodeToString(z)})
+		if err != nil {
+			return err
+		}
+		e.session = s
+	}
+	if len(e.session.Partials) == len(e.session.Signers) && e.session.State != coordinator.StateComplete {
+		return fmt.Errorf("session %s is %s with every partial signature in: %s", e.session.ID, e.session.State, e.session.Error)
+	}
+	return nil
+}
+
+// verify checks the session's signature under the group key.
+func (e *scenarioEnv) verify() error {
+	s := e.session
+	if s.State != coordinator.StateComplete || s.Result == nil || !s.Result.Valid {
+		return fmt.Errorf("session %s ended %s without a valid signature: %s", s.ID, s.State, s.Error)
+	}
+	r, err := hex.DecodeString(s.Result.R)
+	if err != nil {
+		return fmt.Errorf("R: %w", err)
+	}
+	z, err := hex.DecodeString(s.Result.Z)
+	if err != nil {
+		return fmt.Errorf("z: %w", err)
+	}
+	ok, err := frostcore.Verify(e.groupKey, e.msg, r, z)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errors.New("the signature does not verify under the group key")
+	}
+	return nil
+}
+
+// reshare deals the shares of old signers to a newT-of-newN roster, as
+// change-threshold does, keeping the new shares and document for
+// replaceDevices.
+func (e *scenarioEnv) reshare(signers []int, newT, newN int) error {
+	session, err := newReshareSession(e.doc, signers, newT, newN)
+	if err != nil {
+		return err
+	}
+	var old []*KeyShareOutput
+	for _, id := range signers {
+		share, err := secret.FromInt(new(big.Int).Set(e.shares[id-1]))
+		if err != nil {
+			return err
+		}
+		defer share.Destroy()
+		old = append(old, &KeyShareOutput{Participant: id, GroupKey: e.doc.GroupKey, SecretShare: share})
+	}
+	out, err := reshareAll(session, old, rand.Reader)
+	if err != nil {
+		return err
+	}
+	for _, s := range out.Shares {
+		if !strings.EqualFold(s.GroupKey, e.doc.GroupKey) {
+			return fmt.Errorf("participant %d's new share is of group key %s", s.Participant, s.GroupKey)
+		}
+	}
+	next := *e.doc
+	next.Threshold, next.Total, next.PublicShares = newT, newN, out.PublicShares
+	next.Failovers, next.Retired = nil, nil
+	e.next = &next
+	e.oldShares, e.shares = e.shares, nil
+	for _, s := range out.Shares {
+		e.shares = append(e.shares, s.SecretShare.Int())
+		s.SecretShare.Destroy()
+	}
+	return nil
+}
+
+// replaceDevices moves the group to the roster reshare dealt: new devices
+// with the new shares, and the new document on the coordinator.
+func (e *scenarioEnv) replaceDevices() error {
+	if e.next == nil {
+		return errors.New("no reshare to apply")
+	}
+	e.closeTransports()
+	old := e.devices
+	e.cleanup = append(e.cleanup, old.close)
+	if err := e.injectShares(); err != nil {
+		return err
+	}
+	e.doc, e.next = e.next, nil
+	e.c.AddGroup(e.doc)
+	return nil
+}
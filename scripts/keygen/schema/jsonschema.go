@@ -0,0 +1,291 @@
+package schema
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// The published JSON Schemas of the command inputs, one per file named
+// <id>.schema.json.
+//
+//go:embed schemas/*.schema.json
+var schemaFiles embed.FS
+
+// IDs lists the embedded schemas.
+func IDs() []string {
+	entries, _ := schemaFiles.ReadDir("schemas")
+	ids := make([]string, len(entries))
+	for i, e := range entries {
+		ids[i] = strings.TrimSuffix(e.Name(), ".schema.json")
+	}
+	return ids
+}
+
+// Source returns the JSON Schema document with the given ID.
+func Source(id string) ([]byte, error) {
+	data, err := schemaFiles.ReadFile("schemas/" + id + ".schema.json")
+	if err != nil {
+		return nil, fmt.Errorf("no schema %q (have %s)", id, strings.Join(IDs(), ", "))
+	}
+	return data, nil
+}
+
+// jsonSchema is the subset of JSON Schema (2020-12) the embedded schemas
+// use. contentEncoding "base16" marks hex strings, whose length limits
+// count hex characters.
+type jsonSchema struct {
+	Ref                  string                 `json:"$ref"`
+	Defs                 map[string]*jsonSchema `json:"$defs"`
+	Type                 string                 `json:"type"`
+	Properties           map[string]*jsonSchema `json:"properties"`
+	Required             []string               `json:"required"`
+	AdditionalProperties *bool                  `json:"additionalProperties"`
+	Items                *jsonSchema            `json:"items"`
+	MinItems             *int                   `json:"minItems"`
+	MaxItems             *int                   `json:"maxItems"`
+	Minimum              *json.Number           `json:"minimum"`
+	Maximum              *json.Number           `json:"maximum"`
+	MinLength            *int                   `json:"minLength"`
+	MaxLength            *int                   `json:"maxLength"`
+	Pattern              string                 `json:"pattern"`
+	ContentEncoding      string                 `json:"contentEncoding"`
+}
+
+// FieldError is one place where an input breaks its schema, located by a
+// path such as participants[2].hiding_commit.
+type FieldError struct {
+	Path    string
+	Message string
+}
+
+func (e FieldError) String() string {
+	return e.Path + ": " + e.Message
+}
+
+// ValidationError lists every place an input breaks its schema.
+type ValidationError struct {
+	Schema string
+	Errors []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, len(e.Errors))
+	for i, fe := range e.Errors {
+		msgs[i] = fe.String()
+	}
+	return "does not match " + e.Schema + ": " + strings.Join(msgs, "; ")
+}
+
+// Validate checks data against the embedded schema id, returning a
+// *ValidationError if it does not match.
+func Validate(data []byte, id string) error {
+	src, err := Source(id)
+	if err != nil {
+		return err
+	}
+	var root jsonSchema
+	if err := json.Unmarshal(src, &root); err != nil {
+		return fmt.Errorf("schema %s: %w", id, err)
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return err
+	}
+	val := &validator{root: &root}
+	val.value(&root, v, "")
+	if len(val.errors) > 0 {
+		return &ValidationError{Schema: id, Errors: val.errors}
+	}
+	return nil
+}
+
+// UnmarshalAgainst validates data against the embedded schema id, so
+// malformed input is rejected with the field at fault before it is decoded,
+// then unmarshals it with Unmarshal.
+func UnmarshalAgainst(data []byte, v any, id, name string) error {
+	if err := Validate(data, id); err != nil {
+		return err
+	}
+	return Unmarshal(data, v, name)
+}
+
+// DecodeAgainst reads one JSON value from r and unmarshals it with
+// UnmarshalAgainst.
+func DecodeAgainst(r io.Reader, v any, id, name string) error {
+	var raw json.RawMessage
+	if err := json.NewDecoder(r).Decode(&raw); err != nil {
+		return err
+	}
+	return UnmarshalAgainst(raw, v, id, name)
+}
+
+type validator struct {
+	root   *jsonSchema
+	errors []FieldError
+}
+
+func (val *validator) fail(path, format string, args ...any) {
+	if path == "" {
+		path = "$"
+	}
+	val.errors = append(val.errors, FieldError{Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+// resolve follows a $ref into $defs. Keywords next to $ref apply too, but
+// the embedded schemas only put descriptions there.
+func (val *validator) resolve(s *jsonSchema) *jsonSchema {
+	for s.Ref != "" {
+		name, ok := strings.CutPrefix(s.Ref, "#/$defs/")
+		def := val.root.Defs[name]
+		if !ok || def == nil {
+			panic("schema: unresolved $ref " + s.Ref)
+		}
+		s = def
+	}
+	return s
+}
+
+func (val *validator) value(s *jsonSchema, v any, path string) {
+	s = val.resolve(s)
+	if s.Type != "" && typeOf(v) != s.Type && !(s.Type == "number" && typeOf(v) == "integer") {
+		val.fail(path, "expected %s, got %s", s.Type, describe(v))
+		return
+	}
+	switch v := v.(type) {
+	case map[string]any:
+		val.object(s, v, path)
+	case []any:
+		if s.MinItems != nil && len(v) < *s.MinItems {
+			val.fail(path, "expected at least %d items, got %d", *s.MinItems, len(v))
+		}
+		if s.MaxItems != nil && len(v) > *s.MaxItems {
+			val.fail(path, "expected at most %d items, got %d", *s.MaxItems, len(v))
+		}
+		if s.Items != nil {
+			for i, item := range v {
+				val.value(s.Items, item, fmt.Sprintf("%s[%d]", path, i))
+			}
+		}
+	case string:
+		val.str(s, v, path)
+	case json.Number:
+		val.number(s, v, path)
+	}
+}
+
+func (val *validator) object(s *jsonSchema, v map[string]any, path string) {
+	prefix := path
+	if prefix != "" {
+		prefix += "."
+	}
+	for _, name := range s.Required {
+		if _, ok := v[name]; !ok {
+			val.fail(prefix+name, "missing")
+		}
+	}
+	keys := make([]string, 0, len(v))
+	for k := range v {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		prop, ok := s.Properties[k]
+		if !ok {
+			if s.AdditionalProperties != nil && !*s.AdditionalProperties {
+				val.fail(prefix+k, "unknown field")
+			}
+			continue
+		}
+		val.value(prop, v[k], prefix+k)
+	}
+}
+
+func (val *validator) str(s *jsonSchema, v, path string) {
+	unit := "characters"
+	if s.ContentEncoding == "base16" {
+		unit = "hex chars"
+	}
+	switch {
+	case s.MinLength != nil && s.MaxLength != nil && *s.MinLength == *s.MaxLength && len(v) != *s.MinLength:
+		val.fail(path, "expected %d %s, got %d", *s.MinLength, unit, len(v))
+		return
+	case s.MinLength != nil && len(v) < *s.MinLength:
+		val.fail(path, "expected at least %d %s, got %d", *s.MinLength, unit, len(v))
+		return
+	case s.MaxLength != nil && len(v) > *s.MaxLength:
+		val.fail(path, "expected at most %d %s, got %d", *s.MaxLength, unit, len(v))
+		return
+	}
+	if s.ContentEncoding == "base16" {
+		for i, c := range v {
+			if !strings.ContainsRune("0123456789abcdefABCDEF", c) {
+				val.fail(path, "not hex: %q at offset %d", c, i)
+				return
+			}
+		}
+		if len(v)%2 != 0 {
+			val.fail(path, "odd number of hex chars (%d)", len(v))
+			return
+		}
+	}
+	if s.Pattern != "" && !regexp.MustCompile(s.Pattern).MatchString(v) {
+		val.fail(path, "does not match %s", s.Pattern)
+	}
+}
+
+func (val *validator) number(s *jsonSchema, v json.Number, path string) {
+	x, _ := v.Float64()
+	if s.Minimum != nil {
+		if lo, _ := s.Minimum.Float64(); x < lo {
+			val.fail(path, "expected at least %s, got %s", *s.Minimum, v)
+		}
+	}
+	if s.Maximum != nil {
+		if hi, _ := s.Maximum.Float64(); x > hi {
+			val.fail(path, "expected at most %s, got %s", *s.Maximum, v)
+		}
+	}
+}
+
+// typeOf returns the JSON Schema type of a decoded value.
+func typeOf(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	case json.Number:
+		if _, err := v.Int64(); err == nil {
+			return "integer"
+		}
+		return "number"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+// describe names a value's type for an error, with short values included.
+func describe(v any) string {
+	switch v := v.(type) {
+	case string:
+		if len(v) <= 16 {
+			return fmt.Sprintf("string %q", v)
+		}
+	case json.Number, bool:
+		return fmt.Sprintf("%s %v", typeOf(v), v)
+	}
+	return typeOf(v)
+}
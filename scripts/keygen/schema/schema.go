@@ -0,0 +1,348 @@
+// Package schema checks JSON inputs against the Go types they decode into.
+//
+// encoding/json silently ignores unknown keys, matches keys without regard
+// to case, lets a repeated key override the first and turns null into a zero
+// value. It also rounds numbers that a float64 or float32 field (or an any
+// value) cannot hold exactly, where integer fields reject them. Each of these
+// hides integration drift: a misspelled or renamed field decodes to its zero
+// value, or an amount to a nearby one, and the command carries on. Unmarshal
+// reports them as warnings, or as errors when Strict is set.
+//
+// Fields are marked deprecated with a struct tag naming what replaces them:
+//
+//	Old string `json:"old,omitempty" deprecated:"use new"`
+//
+// Every JSON output carries the ciphersuite it was made with as a top-level
+// "ciphersuite" key, so any input may have one. It is checked against
+// Ciphersuite, or adopted (see Adopt), rather than decoded.
+package schema
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Strict makes every issue an error.
+var Strict bool
+
+// Warnings receives issues outside strict mode.
+var Warnings io.Writer = os.Stderr
+
+// CiphersuiteKey is the top-level key naming an input's ciphersuite.
+const CiphersuiteKey = "ciphersuite"
+
+// Ciphersuite is the ID of the ciphersuite in use. An input naming another
+// is an error, in strict mode or not: its keys and signatures mean nothing
+// under this one.
+var Ciphersuite string
+
+// Adopt, when set, is offered the ciphersuite of the first input naming
+// one. If it differs from Ciphersuite and Adopt returns nil, it becomes
+// Ciphersuite, so that a command run without an explicit choice goes on
+// with the suite its inputs were made with. Either way, later inputs must
+// name the same suite.
+var Adopt func(id string) error
+
+// Kind classifies an issue.
+type Kind string
+
+const (
+	Unknown    Kind = "unknown field"
+	Deprecated Kind = "deprecated field"
+	Duplicate  Kind = "duplicate key"
+	CaseFold   Kind = "case-insensitive match"
+	Null       Kind = "null value"
+	Lossy      Kind = "lossy conversion"
+)
+
+// Issue is one schema problem, located by a JSON path such as
+// $.participants[1].id.
+type Issue struct {
+	Path   string
+	Kind   Kind
+	Detail string
+}
+
+func (i Issue) String() string {
+	return fmt.Sprintf("%s: %s (%s)", i.Path, i.Kind, i.Detail)
+}
+
+// Error is returned in strict mode. Its message omits the input name, which
+// callers already prefix.
+type Error struct {
+	Name   string
+	Issues []Issue
+}
+
+func (e *Error) Error() string {
+	msgs := make([]string, len(e.Issues))
+	for i, issue := range e.Issues {
+		msgs[i] = issue.String()
+	}
+	return "strict: " + strings.Join(msgs, "; ")
+}
+
+// Unmarshal decodes data into v like json.Unmarshal, then reports schema
+// issues: as an *Error in strict mode, otherwise as warnings naming the
+// input.
+func Unmarshal(data []byte, v any, name string) error {
+	if err := json.Unmarshal(data, v); err != nil {
+		return err
+	}
+	if err := checkCiphersuite(data, name); err != nil {
+		return err
+	}
+	issues, err := Check(data, v)
+	if err != nil || len(issues) == 0 {
+		return err
+	}
+	if Strict {
+		return &Error{Name: name, Issues: issues}
+	}
+	for _, i := range issues {
+		fmt.Fprintf(Warnings, "Warning: %s: %s\n", name, i)
+	}
+	return nil
+}
+
+// Decode reads one JSON value from r and unmarshals it with Unmarshal.
+func Decode(r io.Reader, v any, name string) error {
+	var raw json.RawMessage
+	if err := json.NewDecoder(r).Decode(&raw); err != nil {
+		return err
+	}
+	return Unmarshal(raw, v, name)
+}
+
+// Check lists the schema issues of data decoded into v.
+func Check(data []byte, v any) ([]Issue, error) {
+	c := &checker{dec: json.NewDecoder(bytes.NewReader(data))}
+	c.dec.UseNumber()
+	if err := c.value(reflect.TypeOf(v), "$"); err != nil {
+		return nil, err
+	}
+	return c.issues, nil
+}
+
+// checkCiphersuite fails for a JSON object naming another ciphersuite.
+func checkCiphersuite(data []byte, name string) error {
+	var top struct {
+		Ciphersuite *string `json:"ciphersuite"`
+	}
+	if Ciphersuite == "" || json.Unmarshal(data, &top) != nil || top.Ciphersuite == nil {
+		return nil
+	}
+	if adopt := Adopt; adopt != nil {
+		Adopt = nil
+		if !strings.EqualFold(*top.Ciphersuite, Ciphersuite) && adopt(*top.Ciphersuite) == nil {
+			Ciphersuite = *top.Ciphersuite
+		}
+	}
+	if !strings.EqualFold(*top.Ciphersuite, Ciphersuite) {
+		return fmt.Errorf("%s: made with ciphersuite %q, but %q is in use", name, *top.Ciphersuite, Ciphersuite)
+	}
+	return nil
+}
+
+type checker struct {
+	dec    *json.Decoder
+	issues []Issue
+}
+
+func (c *checker) report(path string, kind Kind, format string, args ...any) {
+	c.issues = append(c.issues, Issue{Path: path, Kind: kind, Detail: fmt.Sprintf(format, args...)})
+}
+
+var (
+	unmarshalerType     = reflect.TypeFor[json.Unmarshaler]()
+	textUnmarshalerType = reflect.TypeFor[encoding.TextUnmarshaler]()
+)
+
+// opaque reports whether t decodes itself, so its content is not checked.
+// An any value is walked for numbers only.
+func opaque(t reflect.Type) bool {
+	return (t.Kind() == reflect.Interface && t.NumMethod() > 0) ||
+		reflect.PointerTo(t).Implements(unmarshalerType) ||
+		reflect.PointerTo(t).Implements(textUnmarshalerType)
+}
+
+// lossy describes how the number n changes when decoded into t. Only
+// floating-point targets, and any, which takes a float64, round silently.
+func lossy(t reflect.Type, n json.Number) string {
+	bits := 64
+	switch t.Kind() {
+	case reflect.Float32:
+		bits = 32
+	case reflect.Float64, reflect.Interface:
+	default:
+		return ""
+	}
+	f, err := strconv.ParseFloat(n.String(), bits)
+	if err != nil {
+		return "" // Out of range, which encoding/json rejects
+	}
+	got := strconv.FormatFloat(f, 'g', -1, bits)
+	want, _, err := big.ParseFloat(n.String(), 10, 512, big.ToNearestEven)
+	have, _, err2 := big.ParseFloat(got, 10, 512, big.ToNearestEven)
+	if err != nil || err2 != nil || want.Cmp(have) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%s decodes as %s", n, got)
+}
+
+// value walks one JSON value; t is the type it decodes into, nil for values
+// that are skipped.
+func (c *checker) value(t reflect.Type, path string) error {
+	tok, err := c.dec.Token()
+	if err != nil {
+		return err
+	}
+	nullable := t == nil
+	for t != nil && t.Kind() == reflect.Pointer {
+		t, nullable = t.Elem(), true
+	}
+	if t != nil && opaque(t) {
+		t, nullable = nil, true
+	}
+	if t != nil {
+		switch t.Kind() {
+		case reflect.Slice, reflect.Map, reflect.Interface:
+			nullable = true
+		}
+	}
+
+	delim, ok := tok.(json.Delim)
+	if !ok {
+		if n, isNum := tok.(json.Number); isNum && t != nil {
+			if detail := lossy(t, n); detail != "" {
+				c.report(path, Lossy, "%s", detail)
+			}
+		}
+		if tok == nil && !nullable {
+			c.report(path, Null, "decodes to the zero %s", t)
+		}
+		return nil
+	}
+	switch delim {
+	case '{':
+		var fields map[string]field
+		var elem reflect.Type
+		if t != nil {
+			switch t.Kind() {
+			case reflect.Struct:
+				fields = fieldsOf(t)
+			case reflect.Map:
+				elem = t.Elem()
+			case reflect.Interface:
+				elem = t
+			}
+		}
+		seen := make(map[string]bool)
+		for c.dec.More() {
+			tok, err := c.dec.Token()
+			if err != nil {
+				return err
+			}
+			key := tok.(string)
+			p := path + "." + key
+			if seen[key] {
+				c.report(p, Duplicate, "the last value wins")
+			}
+			seen[key] = true
+
+			ft := elem
+			if fields != nil {
+				f, ok := fields[key]
+				if !ok && path == "$" && key == CiphersuiteKey {
+					f, ok = field{name: key}, true // Checked by checkCiphersuite
+				} else if !ok {
+					if f, ok = foldMatch(fields, key); ok {
+						c.report(p, CaseFold, "decoded as %q", f.name)
+					} else {
+						c.report(p, Unknown, "%s has no such field", t.Name())
+					}
+				}
+				if ok && f.deprecated != "" {
+					c.report(p, Deprecated, "%s", f.deprecated)
+				}
+				ft = f.typ
+			}
+			if err := c.value(ft, p); err != nil {
+				return err
+			}
+		}
+	case '[':
+		var elem reflect.Type
+		if t != nil && (t.Kind() == reflect.Slice || t.Kind() == reflect.Array) {
+			elem = t.Elem()
+		} else if t != nil && t.Kind() == reflect.Interface {
+			elem = t
+		}
+		for i := 0; c.dec.More(); i++ {
+			if err := c.value(elem, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+	}
+	_, err = c.dec.Token() // Closing delimiter
+	return err
+}
+
+type field struct {
+	name       string
+	typ        reflect.Type
+	deprecated string
+}
+
+// fieldsOf maps JSON keys to the fields of a struct, flattening embedded
+// structs as encoding/json does.
+func fieldsOf(t reflect.Type) map[string]field {
+	fields := make(map[string]field)
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+		ft := f.Type
+		if f.Anonymous && name == "" {
+			if ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				for k, v := range fieldsOf(ft) {
+					if _, ok := fields[k]; !ok {
+						fields[k] = v
+					}
+				}
+				continue
+			}
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fields[name] = field{name: name, typ: ft, deprecated: f.Tag.Get("deprecated")}
+	}
+	return fields
+}
+
+func foldMatch(fields map[string]field, key string) (field, bool) {
+	for name, f := range fields {
+		if strings.EqualFold(name, key) {
+			return f, true
+		}
+	}
+	return field{}, false
+}
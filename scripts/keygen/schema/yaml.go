@@ -0,0 +1,337 @@
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// UnmarshalYAML decodes a YAML document into v with the checks of Unmarshal.
+// Only the subset of YAML used for configuration is supported: block
+// mappings and sequences, flow sequences of scalars, plain, single- and
+// double-quoted scalars, and comments. Anchors, tags, multi-line scalars and
+// flow mappings other than {} are rejected.
+func UnmarshalYAML(data []byte, v any, name string) error {
+	j, err := YAMLToJSON(data)
+	if err != nil {
+		return err
+	}
+	return Unmarshal(j, v, name)
+}
+
+// YAMLToJSON converts a YAML document in the subset read by UnmarshalYAML to
+// JSON, keeping the order and repetition of keys so Check sees them.
+func YAMLToJSON(data []byte) ([]byte, error) {
+	p := &yamlParser{}
+	for i, raw := range strings.Split(string(data), "\n") {
+		if err := p.addLine(i+1, raw); err != nil {
+			return nil, err
+		}
+	}
+	if len(p.lines) == 0 {
+		return []byte("null"), nil
+	}
+	var out bytes.Buffer
+	if err := p.node(&out, p.lines[0].indent); err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.lines) {
+		l := p.lines[p.pos]
+		return nil, fmt.Errorf("yaml: line %d: unexpected indentation", l.num)
+	}
+	return out.Bytes(), nil
+}
+
+type yamlLine struct {
+	num    int
+	indent int
+	text   string
+}
+
+type yamlParser struct {
+	lines []yamlLine
+	pos   int
+}
+
+func (p *yamlParser) addLine(num int, raw string) error {
+	raw = strings.TrimRight(raw, " \r")
+	text := strings.TrimLeft(raw, " ")
+	if strings.HasPrefix(text, "\t") {
+		return fmt.Errorf("yaml: line %d: tabs are not allowed for indentation", num)
+	}
+	text = stripComment(text)
+	if text == "" || text == "---" || text == "..." {
+		return nil
+	}
+	p.lines = append(p.lines, yamlLine{num: num, indent: len(raw) - len(strings.TrimLeft(raw, " ")), text: text})
+	return nil
+}
+
+// stripComment removes a # comment that starts the line or follows a space,
+// outside quotes.
+func stripComment(s string) string {
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			if i == 0 || strings.ContainsRune(" [,:-", rune(s[i-1])) {
+				quote = c
+			}
+		case c == '#' && (i == 0 || s[i-1] == ' '):
+			return strings.TrimRight(s[:i], " ")
+		}
+	}
+	return s
+}
+
+// node writes the block node starting at the current line, which is
+// indented by indent.
+func (p *yamlParser) node(out *bytes.Buffer, indent int) error {
+	l := p.lines[p.pos]
+	if isSeqItem(l.text) {
+		return p.sequence(out, indent)
+	}
+	if _, _, ok := splitKey(l.text); ok {
+		return p.mapping(out, indent)
+	}
+	p.pos++
+	return scalar(out, l.text, l.num)
+}
+
+func (p *yamlParser) sequence(out *bytes.Buffer, indent int) error {
+	out.WriteByte('[')
+	for n := 0; p.pos < len(p.lines); n++ {
+		l := p.lines[p.pos]
+		if l.indent != indent || !isSeqItem(l.text) {
+			break
+		}
+		if n > 0 {
+			out.WriteByte(',')
+		}
+		rest := strings.TrimLeft(strings.TrimPrefix(l.text, "-"), " ")
+		if rest == "" {
+			p.pos++
+			if err := p.child(out, indent); err != nil {
+				return err
+			}
+			continue
+		}
+		// The item's content continues as a node indented past the dash
+		p.lines[p.pos] = yamlLine{num: l.num, indent: indent + len(l.text) - len(rest), text: rest}
+		if err := p.node(out, p.lines[p.pos].indent); err != nil {
+			return err
+		}
+	}
+	out.WriteByte(']')
+	return nil
+}
+
+func (p *yamlParser) mapping(out *bytes.Buffer, indent int) error {
+	out.WriteByte('{')
+	for n := 0; p.pos < len(p.lines); n++ {
+		l := p.lines[p.pos]
+		if l.indent != indent {
+			if l.indent > indent {
+				return fmt.Errorf("yaml: line %d: unexpected indentation", l.num)
+			}
+			break
+		}
+		key, value, ok := splitKey(l.text)
+		if !ok {
+			return fmt.Errorf("yaml: line %d: expected \"key: value\"", l.num)
+		}
+		if n > 0 {
+			out.WriteByte(',')
+		}
+		k, err := keyString(key, l.num)
+		if err != nil {
+			return err
+		}
+		b, _ := json.Marshal(k)
+		out.Write(b)
+		out.WriteByte(':')
+		p.pos++
+		if value != "" {
+			if err := scalar(out, value, l.num); err != nil {
+				return err
+			}
+			continue
+		}
+		// A sequence may sit at the key's own indentation
+		if p.pos < len(p.lines) && p.lines[p.pos].indent == indent && isSeqItem(p.lines[p.pos].text) {
+			if err := p.sequence(out, indent); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := p.child(out, indent); err != nil {
+			return err
+		}
+	}
+	out.WriteByte('}')
+	return nil
+}
+
+// child writes the node nested deeper than parent, or null if nothing is
+// nested.
+func (p *yamlParser) child(out *bytes.Buffer, parent int) error {
+	if p.pos >= len(p.lines) || p.lines[p.pos].indent <= parent {
+		out.WriteString("null")
+		return nil
+	}
+	return p.node(out, p.lines[p.pos].indent)
+}
+
+func isSeqItem(text string) bool {
+	return text == "-" || strings.HasPrefix(text, "- ")
+}
+
+// splitKey splits "key: value" (or "key:") outside quotes and flow
+// collections.
+func splitKey(text string) (key, value string, ok bool) {
+	var quote byte
+	depth := 0
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case (c == '"' || c == '\'') && i == 0:
+			quote = c
+		case c == '[' || c == '{':
+			depth++
+		case c == ']' || c == '}':
+			depth--
+		case c == ':' && depth == 0 && (i+1 == len(text) || text[i+1] == ' '):
+			return strings.TrimRight(text[:i], " "), strings.TrimLeft(text[i+1:], " "), i > 0
+		}
+	}
+	return "", "", false
+}
+
+func keyString(key string, num int) (string, error) {
+	if key[0] == '"' || key[0] == '\'' {
+		return quoted(key, num)
+	}
+	return key, nil
+}
+
+var yamlNumber = regexp.MustCompile(`^[-+]?(0|[1-9][0-9]*)(\.[0-9]+)?([eE][-+]?[0-9]+)?$`)
+
+// scalar writes a scalar or flow sequence as JSON.
+func scalar(out *bytes.Buffer, s string, num int) error {
+	switch {
+	case s == "[]" || s == "{}":
+		out.WriteString(s)
+		return nil
+	case s[0] == '[':
+		if !strings.HasSuffix(s, "]") {
+			return fmt.Errorf("yaml: line %d: unterminated flow sequence", num)
+		}
+		items, err := splitFlow(s[1:len(s)-1], num)
+		if err != nil {
+			return err
+		}
+		out.WriteByte('[')
+		for i, item := range items {
+			if i > 0 {
+				out.WriteByte(',')
+			}
+			if err := scalar(out, item, num); err != nil {
+				return err
+			}
+		}
+		out.WriteByte(']')
+		return nil
+	case strings.ContainsRune("{&*!|>%@`", rune(s[0])):
+		return fmt.Errorf("yaml: line %d: unsupported YAML %q (use block mappings and plain or quoted scalars)", num, s)
+	case s[0] == '"' || s[0] == '\'':
+		v, err := quoted(s, num)
+		if err != nil {
+			return err
+		}
+		b, _ := json.Marshal(v)
+		out.Write(b)
+		return nil
+	case s == "null" || s == "~":
+		out.WriteString("null")
+	case s == "true" || s == "false":
+		out.WriteString(s)
+	case yamlNumber.MatchString(s):
+		out.WriteString(strings.TrimPrefix(s, "+"))
+	default:
+		b, _ := json.Marshal(s)
+		out.Write(b)
+	}
+	return nil
+}
+
+// splitFlow splits the items of a flow sequence on commas outside quotes.
+func splitFlow(s string, num int) ([]string, error) {
+	var items []string
+	var quote byte
+	start := 0
+	for i := 0; i <= len(s); i++ {
+		if i < len(s) {
+			c := s[i]
+			switch {
+			case quote != 0:
+				if c == '\\' && quote == '"' {
+					i++
+				} else if c == quote {
+					quote = 0
+				}
+				continue
+			case c == '"' || c == '\'':
+				quote = c
+				continue
+			case c == '[' || c == '{':
+				return nil, fmt.Errorf("yaml: line %d: nested flow collections are not supported", num)
+			case c != ',':
+				continue
+			}
+		}
+		item := strings.TrimSpace(s[start:i])
+		if item == "" {
+			if i == len(s) && len(items) == 0 {
+				break
+			}
+			return nil, fmt.Errorf("yaml: line %d: empty item in flow sequence", num)
+		}
+		items = append(items, item)
+		start = i + 1
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("yaml: line %d: unterminated string", num)
+	}
+	return items, nil
+}
+
+// quoted decodes a single- or double-quoted scalar.
+func quoted(s string, num int) (string, error) {
+	if len(s) < 2 || s[len(s)-1] != s[0] {
+		return "", fmt.Errorf("yaml: line %d: unterminated string", num)
+	}
+	if s[0] == '\'' {
+		return strings.ReplaceAll(s[1:len(s)-1], "''", "'"), nil
+	}
+	v, err := strconv.Unquote(s)
+	if err != nil {
+		return "", fmt.Errorf("yaml: line %d: invalid string %s", num, s)
+	}
+	return v, nil
+}
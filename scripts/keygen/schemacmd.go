@@ -0,0 +1,61 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"keygen/schema"
+)
+
+// runSchema implements the schema subcommands, which publish the JSON
+// Schemas inputs are validated against:
+//
+//	schema list
+//	schema show <id>
+//	schema check <id>   < input.json
+func runSchema(args []string) {
+	if len(args) < 1 {
+		fail(KindUsage, "Usage: keygen schema <list|show|check> [id]")
+	}
+	cmd := flag.NewFlagSet("schema "+args[0], flag.ExitOnError)
+	stdioFlags(cmd)
+	cmd.Parse(args[1:])
+
+	if args[0] == "list" {
+		for _, id := range schema.IDs() {
+			fmt.Println(id)
+		}
+		return
+	}
+	if cmd.NArg() != 1 {
+		fail(KindUsage, "Usage: keygen schema %s <id>", args[0])
+	}
+	id := cmd.Arg(0)
+	switch args[0] {
+	case "show":
+		src, err := schema.Source(id)
+		if err != nil {
+			fail(KindInput, "Error: %v", err)
+		}
+		os.Stdout.Write(src)
+	case "check":
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			fail(KindInput, "Error reading input: %v", err)
+		}
+		if err := schema.Validate(data, id); err != nil {
+			if verr, ok := err.(*schema.ValidationError); ok {
+				for _, fe := range verr.Errors {
+					fmt.Fprintf(os.Stderr, "%s: %s\n", stdinName, fe)
+				}
+				fail(KindInput, "Error: %s does not match %s", stdinName, id)
+			}
+			fail(KindInput, "Error: %v", err)
+		}
+		fmt.Fprintf(os.Stderr, "%s matches %s\n", stdinName, id)
+	default:
+		fail(KindUsage, "Unknown schema command: %s", args[0])
+	}
+}
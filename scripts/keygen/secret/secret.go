@@ -0,0 +1,254 @@
+// Package secret holds secret scalars (key shares, nonces) in buffers that
+// are wiped when they are no longer needed, and all at once when the process
+// is interrupted.
+//
+// Go gives no guarantee that a secret never reaches memory this package does
+// not own: the big.Int and curve scalar copies made for arithmetic, and hex
+// strings written to output, cannot be reliably wiped. Scalar keeps the
+// long-lived copy in one place and wipes the temporary ones it hands out
+// where it can (WipeInt). With Lock set, buffers are also allocated in
+// pages locked into RAM, so they are not written to swap.
+//
+// The first scalar created installs a SIGINT/SIGTERM handler that wipes
+// every live scalar and exits, so an interrupted command leaves none behind.
+// Commands with a shutdown path of their own take the signals with
+// NotifyContext instead: the handler then leaves them alone, and the
+// command wipes with DestroyAll once its workers have stopped.
+package secret
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+)
+
+// Size is the length of a scalar in bytes.
+const Size = 32
+
+// Lock allocates new buffers in locked memory (mlock), for long-running
+// commands. Allocation fails if the pages cannot be locked, e.g. because of
+// RLIMIT_MEMLOCK.
+var Lock bool
+
+var (
+	mu          sync.Mutex
+	live        = make(map[*Scalar]struct{})
+	interrupt   sync.Once
+	cooperative int // NotifyContexts not yet stopped; guarded by mu
+)
+
+// Scalar is a secret 32-byte big-endian scalar. The zero value is not usable;
+// create one with New, FromBytes or FromHex, or by decoding JSON.
+type Scalar struct {
+	b      []byte
+	mapped []byte // The locked pages b lies in, if any
+}
+
+// New returns a zero scalar.
+func New() (*Scalar, error) {
+	interrupt.Do(wipeOnInterrupt)
+	s := &Scalar{}
+	if Lock {
+		page, err := syscall.Mmap(-1, 0, os.Getpagesize(), syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_ANON|syscall.MAP_PRIVATE)
+		if err != nil {
+			return nil, fmt.Errorf("secret: %w", err)
+		}
+		if err := syscall.Mlock(page); err != nil {
+			syscall.Munmap(page)
+			return nil, fmt.Errorf("secret: locking memory: %w", err)
+		}
+		s.mapped, s.b = page, page[:Size:Size]
+	} else {
+		s.b = make([]byte, Size)
+	}
+	mu.Lock()
+	live[s] = struct{}{}
+	mu.Unlock()
+	return s, nil
+}
+
+// FromBytes copies b into a new scalar and wipes b.
+func FromBytes(b []byte) (*Scalar, error) {
+	defer Wipe(b)
+	if len(b) != Size {
+		return nil, fmt.Errorf("secret: expected %d bytes, got %d", Size, len(b))
+	}
+	s, err := New()
+	if err != nil {
+		return nil, err
+	}
+	copy(s.b, b)
+	return s, nil
+}
+
+// FromHex decodes a hex scalar.
+func FromHex(h string) (*Scalar, error) {
+	b, err := hex.DecodeString(h)
+	if err != nil || len(b) != Size {
+		Wipe(b)
+		return nil, fmt.Errorf("secret: expected %d bytes of hex", Size)
+	}
+	return FromBytes(b)
+}
+
+// FromInt stores x (reduced by the caller) as a scalar and wipes x.
+func FromInt(x *big.Int) (*Scalar, error) {
+	defer WipeInt(x)
+	if x.Sign() < 0 || x.BitLen() > 8*Size {
+		return nil, errors.New("secret: scalar out of range")
+	}
+	s, err := New()
+	if err != nil {
+		return nil, err
+	}
+	x.FillBytes(s.b)
+	return s, nil
+}
+
+// Bytes returns the scalar's buffer. It is valid until Destroy; do not keep
+// or modify it.
+func (s *Scalar) Bytes() []byte {
+	if s.b == nil {
+		panic("secret: use of destroyed scalar")
+	}
+	return s.b
+}
+
+// Int returns the scalar as a new big.Int, which the caller wipes with
+// WipeInt.
+func (s *Scalar) Int() *big.Int {
+	return new(big.Int).SetBytes(s.Bytes())
+}
+
+// Hex returns the scalar in hex, for output. The string cannot be wiped.
+func (s *Scalar) Hex() string {
+	return hex.EncodeToString(s.Bytes())
+}
+
+// Destroy wipes the scalar and releases its buffer. It is safe to call more
+// than once and on nil.
+func (s *Scalar) Destroy() {
+	if s == nil {
+		return
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	s.destroy()
+}
+
+func (s *Scalar) destroy() {
+	if s.b == nil {
+		return
+	}
+	Wipe(s.b)
+	if s.mapped != nil {
+		syscall.Munlock(s.mapped)
+		syscall.Munmap(s.mapped)
+	}
+	s.b, s.mapped = nil, nil
+	delete(live, s)
+}
+
+// MarshalJSON writes the scalar as a hex string.
+func (s *Scalar) MarshalJSON() ([]byte, error) {
+	out := make([]byte, 0, 2*Size+2)
+	out = append(out, '"')
+	out = hex.AppendEncode(out, s.Bytes())
+	return append(out, '"'), nil
+}
+
+// UnmarshalJSON reads a hex string. The decoder's copy of the input is out
+// of reach; callers wipe their own.
+func (s *Scalar) UnmarshalJSON(data []byte) error {
+	if len(data) < 2 || data[0] != '"' || data[len(data)-1] != '"' {
+		return fmt.Errorf("secret: expected a hex string")
+	}
+	b := make([]byte, Size)
+	if n, err := hex.Decode(b, data[1:len(data)-1]); err != nil || n != Size || len(data) != 2*Size+2 {
+		Wipe(b)
+		return fmt.Errorf("secret: expected %d bytes of hex", Size)
+	}
+	t, err := FromBytes(b)
+	if err != nil {
+		return err
+	}
+	s.Destroy()
+	*s = Scalar{b: t.b, mapped: t.mapped}
+	mu.Lock()
+	delete(live, t)
+	live[s] = struct{}{}
+	mu.Unlock()
+	return nil
+}
+
+// Wipe zeroes b.
+func Wipe(b []byte) {
+	clear(b)
+}
+
+// WipeInt zeroes x's words and sets it to 0.
+func WipeInt(x *big.Int) {
+	if x == nil {
+		return
+	}
+	clear(x.Bits())
+	x.SetInt64(0)
+}
+
+// DestroyAll wipes every live scalar.
+func DestroyAll() {
+	mu.Lock()
+	defer mu.Unlock()
+	for s := range live {
+		s.destroy()
+	}
+}
+
+// NotifyContext is signal.NotifyContext for SIGINT and SIGTERM. Until stop
+// is called, those signals only cancel the context: the wipe-and-exit
+// handler stands aside so the caller can stop its workers, run its
+// deferred Closes and then call DestroyAll, rather than have scalars
+// zeroed and unmapped under a running Sign.
+func NotifyContext(parent context.Context) (ctx context.Context, stop context.CancelFunc) {
+	mu.Lock()
+	cooperative++
+	mu.Unlock()
+	ctx, cancel := signal.NotifyContext(parent, os.Interrupt, syscall.SIGTERM)
+	var once sync.Once
+	return ctx, func() {
+		cancel()
+		once.Do(func() {
+			mu.Lock()
+			cooperative--
+			mu.Unlock()
+		})
+	}
+}
+
+func wipeOnInterrupt() {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		for sig := range c {
+			mu.Lock()
+			handled := cooperative > 0
+			mu.Unlock()
+			if handled {
+				continue
+			}
+			DestroyAll()
+			fmt.Fprintf(os.Stderr, "Interrupted (%v); secrets wiped\n", sig)
+			code := 130
+			if n, ok := sig.(syscall.Signal); ok {
+				code = 128 + int(n)
+			}
+			os.Exit(code)
+		}
+	}()
+}
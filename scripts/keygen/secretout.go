@@ -0,0 +1,106 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"keygen/frostcore"
+	"keygen/secret"
+)
+
+// shareOutput is where keygen and split put secret shares: a passphrase-
+// encrypted participant-<id>.share.json per share by default, plaintext
+// mode-0600 files with -no-encrypt, or stdout with -insecure-stdout. Only
+// public values are printed otherwise, so secrets stay out of shell history
+// and terminal scrollback.
+type shareOutput struct {
+	dir            *string
+	passphraseFile *string
+	noEncrypt      *bool
+	insecureStdout *bool
+	purpose        *string
+}
+
+func shareOutputFlags(fs *flag.FlagSet, dir string) *shareOutput {
+	return &shareOutput{
+		dir:            fs.String("out-dir", dir, "Write each share to participant-<id>.share.json here"),
+		passphraseFile: fs.String("passphrase-file", "", "Passphrases for the share files: one line for all, or one per participant (default: prompt)"),
+		noEncrypt:      fs.Bool("no-encrypt", false, "Write plaintext share files (mode 0600) instead of encrypted ones"),
+		insecureStdout: fs.Bool("insecure-stdout", false, "Print the secret shares to stdout instead of writing files"),
+		purpose:        fs.String("purpose", "", "Provision the shares for this purpose tag, e.g. tx-signing; it is bound into every challenge they sign"),
+	}
+}
+
+// write tags the shares with -purpose and moves the secret shares into
+// files, leaving only public values in shares, unless -insecure-stdout is
+// set.
+func (o *shareOutput) write(shares []KeyShareOutput) {
+	if err := frostcore.CheckPurpose(*o.purpose); err != nil {
+		fail(KindUsage, "Error: -purpose: %v", err)
+	}
+	for i := range shares {
+		shares[i].Purpose = *o.purpose
+	}
+	if *o.insecureStdout {
+		fmt.Fprintln(os.Stderr, "Warning: -insecure-stdout: secret shares are printed to stdout")
+		return
+	}
+	// Fail before prompting for passphrases rather than halfway through
+	for _, s := range shares {
+		if _, err := os.Lstat(shareFilePath(*o.dir, s.Participant)); err == nil {
+			fail(KindInput, "Error: %s already exists", shareFilePath(*o.dir, s.Participant))
+		}
+	}
+	if !*o.noEncrypt {
+		writeEncryptedShares(*o.dir, *o.passphraseFile, shares)
+		return
+	}
+	if err := os.MkdirAll(*o.dir, 0700); err != nil {
+		fail(KindFailure, "Error creating %s: %v", *o.dir, err)
+	}
+	for i, s := range shares {
+		data, _ := jsonOutput(s)
+		path := shareFilePath(*o.dir, s.Participant)
+		writeNewFile(path, data, 0600)
+		secret.Wipe(data)
+		shares[i].SecretShare.Destroy()
+		shares[i].SecretShare = nil
+		fmt.Fprintf(os.Stderr, "Wrote %s (not encrypted)\n", path)
+	}
+}
+
+func shareFilePath(dir string, participant int) string {
+	return filepath.Join(dir, fmt.Sprintf("participant-%d.share.json", participant))
+}
+
+// writeNonceFile writes a commitment with its nonces to path (mode 0600,
+// never overwritten) and removes the nonces from it, leaving the public
+// commitments to print.
+func writeNonceFile(path string, c *CommitmentOutput) {
+	data, _ := jsonOutput(c)
+	writeNewFile(path, data, 0600)
+	secret.Wipe(data)
+	c.HidingNonce.Destroy()
+	c.BindingNonce.Destroy()
+	c.HidingNonce, c.BindingNonce = nil, nil
+	fmt.Fprintf(os.Stderr, "Wrote %s; pass it to sign -nonces, which deletes it\n", path)
+}
+
+// loadNonces fills in the signer's nonces from a commit nonce file, after
+// checking that the file is the signer's and holds the nonces behind the
+// commitments in the input.
+func loadNonces(path string, signer *ParticipantInput) {
+	var c CommitmentOutput
+	readJSONFile(path, &c)
+	if c.HidingNonce == nil || c.BindingNonce == nil {
+		fail(KindInput, "Error: %s holds no nonces", path)
+	}
+	if c.Participant != signer.ID || !strings.EqualFold(c.HidingCommit, signer.HidingCommit) || !strings.EqualFold(c.BindingCommit, signer.BindingCommit) {
+		fail(KindInput, "Error: %s holds participant %d's nonces, which do not match participant %d's commitments in the input",
+			path, c.Participant, signer.ID)
+	}
+	signer.HidingNonce, signer.BindingNonce = c.HidingNonce, c.BindingNonce
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"keygen/beacon"
+	"keygen/schema"
+)
+
+type SelectOutput struct {
+	Threshold  int                `json:"threshold"`
+	Total      int                `json:"total"`
+	Label      string             `json:"label"`                // Session label bound into the selection
+	Signers    []int              `json:"signers"`              // Selected participant IDs, ascending
+	Beacon     *beacon.Round      `json:"beacon"`               // Beacon round used as the seed
+	Commitment *beacon.Commitment `json:"commitment,omitempty"` // What was fixed before the round was out
+	Chain      *beacon.ChainInfo  `json:"chain,omitempty"`      // The round's chain, to check it again offline
+}
+
+const selectUsage = "Usage: keygen select <commit|draw|local> [options]"
+
+// runSelect implements the select subcommands:
+//
+//	select commit -label s [-t 2] [-n 3] [-drand-url url] [-chain hash] [-ahead 2]
+//	select draw [-drand-url url] [-wait=false] < commitment.json
+//	select local -label s [-t 2] [-n 3]
+//
+// commit fixes the threshold, roster, label and a drand round still in the
+// future, and prints the commitment to publish before the round is out.
+// draw waits for the committed round, checks its signature against the
+// chain's public key and picks the signers from it. local draws from the
+// host RNG instead, for tests and air-gapped setups; nothing about it can
+// be checked by anyone else.
+func runSelect(args []string) {
+	if len(args) < 1 {
+		fail(KindUsage, selectUsage)
+	}
+	cmd := flag.NewFlagSet("select "+args[0], flag.ExitOnError)
+	var threshold, total *int
+	var label string
+	if args[0] == "commit" || args[0] == "local" {
+		threshold = cmd.Int("t", ceremony.ThresholdOr(2), "Number of signers to select")
+		total = cmd.Int("n", ceremony.TotalOr(3), "Total participants")
+		cmd.StringVar(&label, "label", "", "Session label bound into the selection")
+	}
+	var drandURL, chainHash *string
+	var ahead *uint64
+	var wait *bool
+	switch args[0] {
+	case "commit":
+		drandURL = cmd.String("drand-url", beacon.DefaultDrandURL, "drand HTTP relay")
+		chainHash = cmd.String("chain", beacon.DefaultChainHash, "drand chain hash")
+		ahead = cmd.Uint64("ahead", 2, "Commit to the round this many rounds after the latest")
+	case "draw":
+		drandURL = cmd.String("drand-url", "", "drand HTTP relay (default: the commitment's)")
+		wait = cmd.Bool("wait", true, "Wait for the committed round if it is not out yet")
+	case "local":
+	default:
+		fail(KindUsage, selectUsage)
+	}
+	stdioFlags(cmd)
+	cmd.Parse(args[1:])
+	if cmd.NArg() != 0 || (args[0] != "draw" && label == "") {
+		fail(KindUsage, selectUsage)
+	}
+
+	switch args[0] {
+	case "commit":
+		b := &beacon.Drand{URL: *drandURL, ChainHash: *chainHash}
+		info, err := b.Info(context.Background())
+		if err != nil {
+			fail(KindTransport, "Error fetching the drand chain info: %v", err)
+		}
+		c, err := beacon.Commit(info, *drandURL, time.Now(), *ahead, label, *threshold, *total)
+		if err != nil {
+			fail(KindInput, "Error: %v", err)
+		}
+		fmt.Fprintf(os.Stderr, "Committed to drand round %d, due at %s; publish the commitment before then\n",
+			c.Round, c.DueAt.Format(time.RFC3339))
+		writeJSON(c)
+
+	case "draw":
+		var c beacon.Commitment
+		if err := schema.Decode(os.Stdin, &c, stdinName); err != nil {
+			fail(KindInput, "Error reading the commitment: %v", err)
+		}
+		url := c.URL
+		if *drandURL != "" {
+			url = *drandURL
+		}
+		writeJSON(drawSelection(&c, &beacon.Drand{URL: url, ChainHash: c.ChainHash}, *wait))
+
+	case "local":
+		r, err := beacon.Local{}.Fetch(context.Background(), 0)
+		if err != nil {
+			fail(KindFailure, "Error drawing randomness: %v", err)
+		}
+		randomness, err := r.Bytes()
+		if err != nil {
+			fail(KindFailure, "Error: %v", err)
+		}
+		signers, err := beacon.SelectSigners(randomness, label, *threshold, *total)
+		if err != nil {
+			fail(KindInput, "Error selecting signers: %v", err)
+		}
+		writeJSON(SelectOutput{Threshold: *threshold, Total: *total, Label: label, Signers: signers, Beacon: r})
+	}
+}
+
+// drawSelection fetches the committed round from b, waiting for it if wait
+// is set, and picks the signers.
+func drawSelection(c *beacon.Commitment, b *beacon.Drand, wait bool) SelectOutput {
+	ctx := context.Background()
+	info, err := b.Info(ctx)
+	if err != nil {
+		fail(KindTransport, "Error fetching the drand chain info: %v", err)
+	}
+	if err := c.Check(info); err != nil {
+		fail(KindCrypto, "Error: refusing the commitment: %v", err)
+	}
+	if d := time.Until(info.RoundTime(c.Round)); d > 0 {
+		if !wait {
+			fail(KindTransport, "Error: drand round %d is not out until %s", c.Round, info.RoundTime(c.Round).Format(time.RFC3339))
+		}
+		fmt.Fprintf(os.Stderr, "Waiting %s for drand round %d\n", d.Round(time.Second), c.Round)
+		time.Sleep(d)
+	}
+
+	// Relays can lag the schedule by a moment
+	var r *beacon.Round
+	for attempt := 1; ; attempt++ {
+		if r, err = b.Fetch(ctx, c.Round); err == nil || attempt == 5 {
+			break
+		}
+		if !errors.Is(err, beacon.ErrNotPublished) {
+			fmt.Fprintf(os.Stderr, "Fetching drand round %d: %v; retrying\n", c.Round, err)
+		}
+		time.Sleep(2 * time.Second)
+	}
+	if err != nil {
+		fail(KindTransport, "Error fetching drand round %d: %v", c.Round, err)
+	}
+	signers, err := c.Select(info, r)
+	if err != nil {
+		fail(KindCrypto, "Error: %v", err)
+	}
+	return SelectOutput{
+		Threshold:  c.Threshold,
+		Total:      c.Total,
+		Label:      c.Label,
+		Signers:    signers,
+		Beacon:     r,
+		Commitment: c,
+		Chain:      info,
+	}
+}
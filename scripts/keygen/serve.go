@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"keygen/coordinator"
+	"keygen/diag"
+	"keygen/frostcore"
+	"keygen/secret"
+	"keygen/workspace"
+)
+
+// runServe runs a coordinator over HTTP (coordinator.HTTPHandler), so remote
+// participants can create sessions, submit commitments and partial
+// signatures, and fetch the result:
+//
+//	keygen serve -tokens tokens.json [-listen addr] [-group-state f]... [-tls-cert c -tls-key k]
+//	keygen serve -client-ca ca.pem -client-certs certs.json -tls-cert c -tls-key k [-tokens tokens.json]...
+//
+// Every request needs a bearer token from -tokens, a JSON object mapping
+// each token to the principal it authenticates, or a client certificate
+// issued by -client-ca and listed in -client-certs (coordinator.ClientCerts).
+// With -client-certs, commitments and partial signatures are accepted only
+// over the certificate issued for the submitting participant
+// (coordinator.CertParticipants), whatever the token. Sessions can only be created
+// for the groups of the -group-state documents and, with -purposes, only by
+// principals allowed the group's purpose tag (coordinator.PurposePolicy).
+// Browser and mobile co-signers can follow sessions live over a WebSocket
+// at /v1/live (coordinator.LiveHandler), through the same middleware.
+func runServe(args []string, ws *workspace.Context) {
+	cmd := flag.NewFlagSet("serve", flag.ExitOnError)
+	listen := cmd.String("listen", "127.0.0.1:8420", "Address to serve the coordinator on")
+	tokensPath := cmd.String("tokens", "", "JSON file mapping bearer tokens to principals (required)")
+	var groupStates []string
+	cmd.Func("group-state", "Group-state document of a group to coordinate (repeatable; default: the context's)", func(s string) error {
+		groupStates = append(groupStates, s)
+		return nil
+	})
+	rate := cmd.Float64("rate", 10, "Requests per second allowed per principal")
+	burst := cmd.Int("burst", 20, "Burst of requests allowed per principal")
+	retention := cmd.Duration("retention", time.Hour, "Forget sessions this long after they end (0 keeps them)")
+	requireProofs := cmd.Bool("require-proofs", false, "Require commitment proofs in every session")
+	auditPath := cmd.String("audit", "", "Append an audit event per request to this file (JSON lines)")
+	reliabilityPath := cmd.String("reliability-log", "", "Append participant reliability events to this file (JSON lines)")
+	purposesPath := cmd.String("purposes", "", "JSON file mapping principals to the purpose tags they may create sessions for")
+	tlsCert := cmd.String("tls-cert", "", "Serve HTTPS with this certificate (PEM)")
+	tlsKey := cmd.String("tls-key", "", "Private key of -tls-cert (PEM)")
+	clientCA := cmd.String("client-ca", "", "Verify client certificates against this CA (PEM)")
+	clientCertsPath := cmd.String("client-certs", "", "JSON file mapping client certificate common names to principals and participants")
+	debugListen := debugFlag(cmd)
+	stdioFlags(cmd)
+	cmd.Parse(args)
+
+	if (*tokensPath == "" && *clientCertsPath == "") || cmd.NArg() != 0 {
+		fail(KindUsage, "Usage: keygen serve -tokens tokens.json [-listen addr] [-group-state f]... [-tls-cert c -tls-key k [-client-ca ca -client-certs certs.json]]")
+	}
+	if (*tlsCert == "") != (*tlsKey == "") {
+		fail(KindUsage, "Error: give both -tls-cert and -tls-key")
+	}
+	if (*clientCA == "") != (*clientCertsPath == "") {
+		fail(KindUsage, "Error: give both -client-ca and -client-certs")
+	}
+	if *clientCA != "" && *tlsCert == "" {
+		fail(KindUsage, "Error: -client-ca needs -tls-cert and -tls-key")
+	}
+	var auth coordinator.Authenticators
+	var certs coordinator.ClientCerts
+	if *clientCertsPath != "" {
+		readJSONFile(*clientCertsPath, &certs)
+		if len(certs) == 0 {
+			fail(KindInput, "Error: %s holds no certificates", *clientCertsPath)
+		}
+		auth = append(auth, certs)
+	}
+	if *tokensPath != "" {
+		var tokens coordinator.StaticTokens
+		readJSONFile(*tokensPath, &tokens)
+		if len(tokens) == 0 {
+			fail(KindInput, "Error: %s holds no tokens", *tokensPath)
+		}
+		auth = append(auth, tokens)
+	}
+	if len(groupStates) == 0 && ws.GroupState != "" {
+		groupStates = []string{ws.GroupState}
+	}
+	if len(groupStates) == 0 {
+		fail(KindUsage, "Error: give the groups to coordinate with -group-state")
+	}
+
+	c := coordinator.New()
+	c.SetSessionRetention(*retention)
+	if *requireProofs {
+		c.RequireCommitmentProofs()
+	}
+	for _, path := range groupStates {
+		doc := loadGroupState(path)
+		c.AddGroup(doc)
+		fmt.Fprintf(os.Stderr, "Coordinating group %s (%d-of-%d)\n", doc.GroupKey, doc.Threshold, doc.Total)
+	}
+	if *reliabilityPath != "" {
+		c.AddReliabilityHook(coordinator.NewJSONLReliability(openLog(*reliabilityPath)))
+	}
+
+	metrics := coordinator.NewMetrics()
+	mw := []coordinator.Middleware{
+		coordinator.Auth(auth),
+		coordinator.RateLimit(*rate, *burst),
+		metrics.Middleware(),
+	}
+	if *auditPath != "" {
+		mw = append(mw, coordinator.Audit(coordinator.NewJSONLAudit(openLog(*auditPath))))
+	}
+	if *purposesPath != "" {
+		var allowed map[string][]string
+		readJSONFile(*purposesPath, &allowed)
+		for principal, purposes := range allowed {
+			for _, purpose := range purposes {
+				if err := frostcore.CheckPurpose(purpose); err != nil {
+					fail(KindInput, "Error: %s: %s: %v", *purposesPath, principal, err)
+				}
+			}
+		}
+		mw = append(mw, coordinator.Policy(coordinator.PurposePolicy(allowed)))
+	}
+	if ceremonyLog != nil {
+		mw = append(mw, coordinator.Audit(transcriptAudit{}))
+	}
+	if certs != nil {
+		mw = append(mw, coordinator.CertParticipants(certs))
+	}
+	h := coordinator.Chain(c, mw...)
+
+	ctx, stop := secret.NotifyContext(context.Background())
+	defer stop()
+	serveDebug(*debugListen, map[string]diag.Source{
+		"coordinator": func() any { return c.Stats() },
+		"requests":    func() any { return metrics.Snapshot() },
+	})
+	mux := http.NewServeMux()
+	mux.Handle("GET /v1/live", coordinator.LiveHandler(h, c))
+	mux.Handle("/", coordinator.HTTPHandler(h))
+	srv := &http.Server{Addr: *listen, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	if *clientCA != "" {
+		// Operators without a certificate may still come with a token
+		clientAuth := tls.VerifyClientCertIfGiven
+		if *tokensPath == "" {
+			clientAuth = tls.RequireAndVerifyClientCert
+		}
+		srv.TLSConfig = &tls.Config{ClientCAs: loadCertPool(*clientCA), ClientAuth: clientAuth}
+	}
+	go func() {
+		<-ctx.Done()
+		srv.Close()
+	}()
+
+	var err error
+	if *tlsCert != "" {
+		fmt.Fprintf(os.Stderr, "Serving on https://%s\n", *listen)
+		err = srv.ListenAndServeTLS(*tlsCert, *tlsKey)
+	} else {
+		fmt.Fprintf(os.Stderr, "Serving on http://%s (no TLS: tokens travel in the clear)\n", *listen)
+		err = srv.ListenAndServe()
+	}
+	if err != nil && err != http.ErrServerClosed {
+		fail(KindFailure, "Error: %v", err)
+	}
+}
+
+// openLog opens path for appending JSON lines. It stays open until exit.
+func openLog(path string) *os.File {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		fail(KindFailure, "Error opening %s: %v", path, err)
+	}
+	return f
+}
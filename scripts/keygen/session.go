@@ -0,0 +1,441 @@
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"keygen/frostcore"
+	"keygen/sas"
+	"keygen/schema"
+	"keygen/signsession"
+)
+
+// sessionDirFlag adds -session-dir to the commands that take a named
+// session.
+func sessionDirFlag(fs *flag.FlagSet) *string {
+	dir, err := signsession.DefaultDir()
+	if err != nil {
+		dir = "sessions"
+	}
+	return fs.String("session-dir", dir, "Directory of named sessions (see keygen session)")
+}
+
+func openSessionStore(dir string) *signsession.Store {
+	st, err := signsession.Open(dir)
+	if err != nil {
+		fail(KindFailure, "Error opening session directory: %v", err)
+	}
+	return st
+}
+
+// findSession returns the named session, or nil if there is none by that
+// name, in which case name is taken as a coordinator session ID only.
+func findSession(dir, name string) *signsession.Session {
+	if signsession.CheckName(name) != nil {
+		return nil
+	}
+	s, err := openSessionStore(dir).Load(name)
+	if errors.Is(err, signsession.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		fail(KindInput, "Error reading session: %v", err)
+	}
+	return s
+}
+
+// loadSession returns the named session, which must exist.
+func loadSession(dir, name string) *signsession.Session {
+	s, err := openSessionStore(dir).Load(name)
+	if errors.Is(err, signsession.ErrNotFound) {
+		fail(KindInput, "Error: %v (create it with keygen session new)", err)
+	}
+	if err != nil {
+		fail(KindInput, "Error reading session: %v", err)
+	}
+	return s
+}
+
+// updateSession applies fn to the named session and saves it.
+func updateSession(dir, name string, fn func(*signsession.Session) error) *signsession.Session {
+	s, err := openSessionStore(dir).Update(name, fn)
+	if errors.Is(err, signsession.ErrConflict) {
+		fail(KindCrypto, "Error: %v", err)
+	}
+	if err != nil {
+		fail(KindInput, "Error updating session %s: %v", name, err)
+	}
+	return s
+}
+
+// sessionParticipants returns the session's commitments as sign and
+// aggregate inputs, failing if any signer has not committed.
+func sessionParticipants(s *signsession.Session) []ParticipantInput {
+	if missing, _ := s.Missing(); len(missing) > 0 {
+		fail(KindInput, "Error: session %s is missing the commitments of participants %v", s.Name, missing)
+	}
+	out := make([]ParticipantInput, len(s.Commitments))
+	for i, c := range s.Commitments {
+		out[i] = ParticipantInput{ID: c.ID, HidingCommit: c.HidingCommit, BindingCommit: c.BindingCommit}
+	}
+	return out
+}
+
+// sessionSignInput builds the sign input of participant id from a session.
+func sessionSignInput(s *signsession.Session, id int) SignInput {
+	input := SignInput{
+		MessageHash:  s.MessageHash,
+		GroupKey:     s.GroupKey,
+		Participants: sessionParticipants(s),
+		SignerIndex:  -1,
+		Purpose:      s.Purpose,
+		Threshold:    s.Threshold,
+		Total:        s.Total,
+	}
+	for i, p := range input.Participants {
+		if p.ID == id {
+			input.SignerIndex = i
+		}
+	}
+	if input.SignerIndex < 0 {
+		fail(KindInput, "Error: participant %d is not a signer of session %s", id, s.Name)
+	}
+	return input
+}
+
+// sessionAggregateInput builds the aggregate input from a session with
+// every partial signature.
+func sessionAggregateInput(s *signsession.Session) AggregateInput {
+	input := AggregateInput{
+		GroupKey:     s.GroupKey,
+		MessageHash:  s.MessageHash,
+		Participants: sessionParticipants(s),
+		Purpose:      s.Purpose,
+		Threshold:    s.Threshold,
+		Total:        s.Total,
+	}
+	if _, missing := s.Missing(); len(missing) > 0 {
+		fail(KindInput, "Error: session %s is missing the partial signatures of participants %v", s.Name, missing)
+	}
+	for _, p := range s.PartialSigs {
+		input.PartialSigs = append(input.PartialSigs, PartialSigInput{ID: p.ID, PartialSig: p.PartialSig})
+	}
+	for _, ps := range s.PublicShares {
+		input.PublicShares = append(input.PublicShares, PublicShareInput{ID: ps.ID, PublicShare: ps.PublicShare})
+	}
+	return input
+}
+
+func idList(ids []int) string {
+	s := make([]string, len(ids))
+	for i, id := range ids {
+		s[i] = strconv.Itoa(id)
+	}
+	return strings.Join(s, ",")
+}
+
+const sessionUsage = "Usage: keygen session <new|show|list|add|export|import|commitments|submit|delete> [-session-dir dir] [options]"
+
+// runSession implements the session subcommands:
+//
+//	session new <name> -message hash [-signers 1,2] [-group-state f | -group-key k]
+//	session show <name>                      print the session
+//	session list [-json]                     list the sessions
+//	session add <name> <commit output>...    add others' commitments
+//	session export <name>                    print a snapshot to hand off to another machine
+//	session import [-expect code] <file>...  create or merge copies or snapshots of sessions
+//	session commitments <name> <copy>...     compare the commitments with other copies
+//	session submit <name> [-submit spec]...  deliver the signature, or retry its deliveries
+//	session delete <name>
+func runSession(args []string, groupState string) {
+	if len(args) < 1 {
+		fail(KindUsage, sessionUsage)
+	}
+	cmd := flag.NewFlagSet("session "+args[0], flag.ExitOnError)
+	dir := sessionDirFlag(cmd)
+	var message, signers, groupKey, statePath, purpose *string
+	var asJSON *bool
+	var threshold *int
+	var expect *string
+	var sub *submitConfig
+	switch args[0] {
+	case "new":
+		message = cmd.String("message", "", "Message hash to sign (32 bytes hex)")
+		signers = cmd.String("signers", ceremony.SignerList(), "Signing participants (comma-separated)")
+		statePath = cmd.String("group-state", groupState, "Take the group key and public shares from this group-state document")
+		groupKey = cmd.String("group-key", "", "Group key, without a group-state document")
+		purpose = cmd.String("purpose", "", "Purpose tag of the group's shares (default: the group-state document's)")
+		threshold = cmd.Int("threshold", 0, "The group's signing threshold, with -group-key")
+	case "list", "commitments":
+		asJSON = cmd.Bool("json", false, "Print JSON instead of text")
+	case "import":
+		expect = cmd.String("expect", "", "Handoff code or digest the exporting machine printed, for a snapshot")
+	case "submit":
+		sub = submitFlags(cmd)
+	case "show", "add", "export", "delete":
+	default:
+		fail(KindUsage, sessionUsage)
+	}
+	stdioFlags(cmd)
+
+	// The name comes first, as in session new ceremony-42 -message ...
+	var name string
+	rest := args[1:]
+	if args[0] != "list" && args[0] != "import" && len(rest) > 0 && !strings.HasPrefix(rest[0], "-") {
+		name, rest = rest[0], rest[1:]
+	}
+	cmd.Parse(rest)
+	st := openSessionStore(*dir)
+
+	switch args[0] {
+	case "new":
+		if name == "" || cmd.NArg() != 0 || *message == "" || *signers == "" {
+			fail(KindUsage, "Usage: keygen session new <name> -message hash -signers 1,2 [-group-state f | -group-key k]")
+		}
+		ids, err := parseIDList(*signers)
+		if err != nil {
+			fail(KindInput, "Error: -signers: %v", err)
+		}
+		inputBytes("message", *message, 32)
+		if err := frostcore.CheckPurpose(*purpose); err != nil {
+			fail(KindInput, "Error: -purpose: %v", err)
+		}
+		s := &signsession.Session{
+			Name:        name,
+			MessageHash: strings.ToLower(*message),
+			Purpose:     *purpose,
+			Signers:     ids,
+			Commitments: []signsession.Commitment{},
+			PartialSigs: []signsession.PartialSig{},
+		}
+		switch {
+		case *groupKey != "":
+			inputPoint("group_key", *groupKey)
+			s.GroupKey = strings.ToLower(*groupKey)
+			s.Threshold = *threshold
+		case *statePath != "":
+			doc := loadGroupState(*statePath)
+			if err := doc.CheckActive(); err != nil {
+				fail(KindInput, "Error: %v; refusing to start a session", err)
+			}
+			s.GroupKey = doc.GroupKey
+			s.Threshold, s.Total = doc.Threshold, doc.Total
+			if *purpose != "" && *purpose != doc.Purpose {
+				fail(KindInput, "Error: the group's shares are provisioned for %s, not %s", purposeName(doc.Purpose), purposeName(*purpose))
+			}
+			s.Purpose = doc.Purpose
+			for _, id := range ids {
+				if id > len(doc.PublicShares) {
+					fail(KindInput, "Error: participant %d is not in the group of %d", id, len(doc.PublicShares))
+				}
+				s.PublicShares = append(s.PublicShares, signsession.PublicShare{ID: id, PublicShare: doc.PublicShares[id-1]})
+			}
+		default:
+			fail(KindUsage, "Error: give -group-state or -group-key")
+		}
+		if err := st.Create(s); err != nil {
+			fail(KindInput, "Error: %v", err)
+		}
+		writeJSON(s)
+
+	case "show":
+		if name == "" || cmd.NArg() != 0 {
+			fail(KindUsage, "Usage: keygen session show <name>")
+		}
+		writeJSON(loadSession(*dir, name))
+
+	case "list":
+		sessions, err := st.List()
+		if err != nil {
+			fail(KindInput, "Error: %v", err)
+		}
+		if *asJSON {
+			writeJSON(sessions)
+			return
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "NAME\tSIGNERS\tCOMMITMENTS\tPARTIALS\tRESULT\tUPDATED")
+		for _, s := range sessions {
+			result := "-"
+			if s.Result != nil {
+				result = "invalid"
+				if s.Result.Valid {
+					result = "valid"
+				}
+			}
+			fmt.Fprintf(w, "%s\t%s\t%d/%d\t%d/%d\t%s\t%s\n", s.Name, idList(s.Signers),
+				len(s.Commitments), len(s.Signers), len(s.PartialSigs), len(s.Signers), result, s.Updated.Format(time.RFC3339))
+		}
+		w.Flush()
+
+	case "add":
+		if name == "" || cmd.NArg() < 1 {
+			fail(KindUsage, "Usage: keygen session add <name> <commit output>...")
+		}
+		var commitments []signsession.Commitment
+		for _, path := range cmd.Args() {
+			var c CommitmentOutput
+			readJSONFile(path, &c)
+			if c.HidingNonce != nil || c.BindingNonce != nil {
+				c.HidingNonce.Destroy()
+				c.BindingNonce.Destroy()
+				fail(KindInput, "Error: %s holds secret nonces; add the commit command's stdout, not its nonce file", path)
+			}
+			inputPoint(path+": hiding_commit", c.HidingCommit)
+			inputPoint(path+": binding_commit", c.BindingCommit)
+			commitments = append(commitments, signsession.Commitment{
+				ID: c.Participant, HidingCommit: c.HidingCommit, BindingCommit: c.BindingCommit, Proof: c.Proof,
+			})
+		}
+		writeJSON(updateSession(*dir, name, func(s *signsession.Session) error {
+			for _, c := range commitments {
+				if err := s.AddCommitment(c); err != nil {
+					return err
+				}
+			}
+			return nil
+		}))
+
+	case "export":
+		if name == "" || cmd.NArg() != 0 {
+			fail(KindUsage, "Usage: keygen session export <name>")
+		}
+		host, _ := os.Hostname()
+		sn := loadSession(*dir, name).Export(host)
+		writeJSON(sn)
+		fmt.Fprintf(os.Stderr, "Handoff code of %s: %s (digest %s)\n", name, snapshotCode(sn), sn.Digest)
+
+	case "import":
+		if cmd.NArg() < 1 || (*expect != "" && cmd.NArg() != 1) {
+			fail(KindUsage, "Usage: keygen session import [-expect code] <file>...")
+		}
+		for _, path := range cmd.Args() {
+			var copied signsession.Session
+			if sn := readSnapshot(path); sn != nil {
+				checkSnapshot(path, sn, *expect)
+				copied = *sn.Session
+				copied.Handoff = sn.Digest
+			} else if *expect != "" {
+				fail(KindInput, "Error: %s is not a snapshot; -expect only checks snapshots", path)
+			} else {
+				readJSONFile(path, &copied)
+			}
+			if err := st.Create(&copied); err == nil {
+				fmt.Fprintf(os.Stderr, "Created session %s from %s\n", copied.Name, path)
+				continue
+			} else if !errors.Is(err, signsession.ErrExists) {
+				fail(KindInput, "Error: %s: %v", path, err)
+			}
+			updateSession(*dir, copied.Name, func(s *signsession.Session) error {
+				if copied.Handoff != "" {
+					s.Handoff = copied.Handoff
+				}
+				return s.Merge(&copied)
+			})
+			fmt.Fprintf(os.Stderr, "Merged %s into session %s\n", path, copied.Name)
+		}
+
+	case "commitments":
+		if name == "" || cmd.NArg() < 1 {
+			fail(KindUsage, "Usage: keygen session commitments <name> [-json] <copy>...")
+		}
+		copies := []*signsession.Session{loadSession(*dir, name)}
+		names := []string{"local"}
+		for _, path := range cmd.Args() {
+			var copied signsession.Session
+			readJSONFile(path, &copied)
+			if copied.Name != name {
+				fail(KindInput, "Error: %s is a copy of session %s, not %s", path, copied.Name, name)
+			}
+			copies = append(copies, &copied)
+			names = append(names, copyName(path))
+		}
+		out := compareSessionCommitments(copies, names)
+		if *asJSON {
+			writeJSON(out)
+		} else {
+			printSessionCommitments(out)
+		}
+		if !out.Agree {
+			fail(KindCrypto, "Error: the copies differ on %s; do not approve on the device", strings.Join(out.Differ, ", "))
+		}
+
+	case "submit":
+		if name == "" || cmd.NArg() != 0 {
+			fail(KindUsage, "Usage: keygen session submit <name> [-submit spec]... [-submit-attempts n] [-submit-timeout d]")
+		}
+		runSessionSubmit(*dir, name, sub)
+
+	case "delete":
+		if name == "" || cmd.NArg() != 0 {
+			fail(KindUsage, "Usage: keygen session delete <name>")
+		}
+		if err := st.Delete(name); err != nil {
+			fail(KindInput, "Error: %v", err)
+		}
+	}
+}
+
+// readSnapshot reads path as a session snapshot, or returns nil if it holds
+// a plain copy of a session.
+func readSnapshot(path string) *signsession.Snapshot {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		fail(KindInput, "Error reading %s: %v", path, err)
+	}
+	var probe struct {
+		Format string `json:"format"`
+	}
+	if json.Unmarshal(data, &probe) != nil || probe.Format == "" {
+		return nil
+	}
+	var sn signsession.Snapshot
+	if err := schema.Unmarshal(data, &sn, path); err != nil {
+		fail(KindInput, "Error: %s: %v", path, err)
+	}
+	return &sn
+}
+
+// snapshotCode is the short code operators read to each other to confirm a
+// handoff, derived from the snapshot's digest.
+func snapshotCode(sn *signsession.Snapshot) string {
+	return sas.Code([]byte(strings.ToLower(sn.Digest)), "session-handoff", sn.Session.Name)
+}
+
+// checkSnapshot verifies a snapshot's digests and, with expect, that it is
+// the one the exporting machine printed: expect is its handoff code, or its
+// digest or a prefix of at least 16 hex digits.
+func checkSnapshot(path string, sn *signsession.Snapshot, expect string) {
+	if err := sn.Verify(); err != nil {
+		kind := KindInput
+		if errors.Is(err, signsession.ErrSnapshot) {
+			kind = KindCrypto
+		}
+		fail(kind, "Error: %s: %v", path, err)
+	}
+	code := snapshotCode(sn)
+	switch {
+	case expect == "":
+		fmt.Fprintf(os.Stderr, "Handoff code of %s: %s; check it matches the one printed on %s\n", path, code, cmp.Or(sn.From, "the exporting machine"))
+	case isHex(expect):
+		if len(expect) < 16 || !strings.HasPrefix(strings.ToLower(sn.Digest), strings.ToLower(expect)) {
+			fail(KindCrypto, "Error: %s: the snapshot's digest is %s, not %s; it changed on the way", path, sn.Digest, expect)
+		}
+	default:
+		if err := sas.Check(code, expect); err != nil {
+			fail(KindCrypto, "Error: %s: -expect: %v; the snapshot changed on the way", path, err)
+		}
+	}
+}
+
+func isHex(s string) bool {
+	return !strings.ContainsFunc(s, func(r rune) bool { return !strings.ContainsRune("0123456789abcdefABCDEF", r) })
+}
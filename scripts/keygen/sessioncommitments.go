@@ -0,0 +1,176 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"keygen/frostcore"
+	"keygen/signsession"
+)
+
+// SessionCommitmentsOutput compares the binding-factor inputs of a session
+// across copies of it.
+type SessionCommitmentsOutput struct {
+	Session string              `json:"session"`
+	Copies  []string            `json:"copies"` // "local", then the files as given
+	Rows    []SessionCompareRow `json:"rows"`
+	Differ  []string            `json:"differ,omitempty"` // Names of the rows the copies disagree on
+	Agree   bool                `json:"agree"`
+	Missing map[string][]int    `json:"missing,omitempty"` // Copy -> signers whose commitments it lacks
+}
+
+// SessionCompareRow is one input as each copy has it. Values are "" where
+// a copy lacks it; Marked flags the values that differ from the most common
+// one.
+type SessionCompareRow struct {
+	Name   string   `json:"name"` // "group_key", "message_hash", a signer's ID, or "list"
+	Values []string `json:"values"`
+	Marked []bool   `json:"marked,omitempty"`
+	Differ bool     `json:"differ"`
+}
+
+// compareSessionCommitments lines up the group key, message hash, each
+// signer's commitment pair and the SHA-256 of the canonical commitment list
+// across copies of a session.
+func compareSessionCommitments(copies []*signsession.Session, names []string) SessionCommitmentsOutput {
+	out := SessionCommitmentsOutput{Session: copies[0].Name, Copies: names, Agree: true}
+	row := func(name string, value func(*signsession.Session) string) {
+		r := SessionCompareRow{Name: name, Values: make([]string, len(copies))}
+		for i, s := range copies {
+			r.Values[i] = value(s)
+		}
+		r.Marked, r.Differ = markOdd(r.Values)
+		if r.Differ {
+			out.Agree = false
+			out.Differ = append(out.Differ, name)
+		} else {
+			r.Marked = nil
+		}
+		out.Rows = append(out.Rows, r)
+	}
+	row("group_key", func(s *signsession.Session) string { return strings.ToLower(s.GroupKey) })
+	row("message_hash", func(s *signsession.Session) string { return strings.ToLower(s.MessageHash) })
+	for _, id := range copies[0].Signers {
+		row(strconv.Itoa(id), func(s *signsession.Session) string {
+			c, ok := s.Commitment(id)
+			if !ok {
+				return ""
+			}
+			return strings.ToLower(c.HidingCommit) + ":" + strings.ToLower(c.BindingCommit)
+		})
+	}
+	row("list", commitmentListHash)
+	for i, s := range copies {
+		if missing, _ := s.Missing(); len(missing) > 0 {
+			if out.Missing == nil {
+				out.Missing = map[string][]int{}
+			}
+			out.Missing[names[i]] = missing
+		}
+	}
+	return out
+}
+
+// commitmentListHash returns the hex SHA-256 of a session's canonical
+// commitment list, the list_hash of the nonce store, or "" until the
+// session has every commitment.
+func commitmentListHash(s *signsession.Session) string {
+	if missing, _ := s.Missing(); len(missing) > 0 {
+		return ""
+	}
+	list := make([]frostcore.Commitment, len(s.Commitments))
+	for i, c := range s.Commitments {
+		hiding, err1 := hex.DecodeString(c.HidingCommit)
+		binding, err2 := hex.DecodeString(c.BindingCommit)
+		if err1 != nil || err2 != nil {
+			return "invalid"
+		}
+		list[i] = frostcore.Commitment{ID: frostcore.IDBytes(uint16(c.ID)), Hiding: hiding, Binding: binding}
+	}
+	enc, err := frostcore.CanonicalCommitments(list)
+	if err != nil {
+		return "invalid"
+	}
+	h := sha256.Sum256(enc)
+	return hex.EncodeToString(h[:])
+}
+
+// markOdd marks the values that differ from the most common one, the
+// earliest on a tie. Missing values are not compared.
+func markOdd(values []string) (marked []bool, differ bool) {
+	counts := map[string]int{}
+	common := ""
+	for _, v := range values {
+		if v == "" {
+			continue
+		}
+		counts[v]++
+		if common == "" || counts[v] > counts[common] {
+			common = v
+		}
+	}
+	marked = make([]bool, len(values))
+	for i, v := range values {
+		if v != "" && v != common {
+			marked[i], differ = true, true
+		}
+	}
+	return marked, differ
+}
+
+// printSessionCommitments prints the comparison as a table of short
+// fingerprints, a * after each value that differs from the others.
+func printSessionCommitments(out SessionCommitmentsOutput) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "INPUT\t%s\t\n", strings.Join(out.Copies, "\t"))
+	for _, r := range out.Rows {
+		cells := make([]string, len(r.Values))
+		for i, v := range r.Values {
+			cells[i] = fingerprint(v)
+			if r.Marked != nil && r.Marked[i] {
+				cells[i] += " *"
+			}
+		}
+		status := ""
+		if r.Differ {
+			status = "DIFFERS"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", r.Name, strings.Join(cells, "\t"), status)
+	}
+	w.Flush()
+	for _, name := range out.Copies {
+		if missing := out.Missing[name]; len(missing) > 0 {
+			fmt.Fprintf(os.Stderr, "%s lacks the commitments of participants %v\n", name, missing)
+		}
+	}
+}
+
+// fingerprint shortens a value for the table: the first 4 bytes of each
+// commitment of a pair, the first 8 bytes of anything else.
+func fingerprint(v string) string {
+	if v == "" {
+		return "-"
+	}
+	if hiding, binding, ok := strings.Cut(v, ":"); ok {
+		return prefix(hiding, 8) + "/" + prefix(binding, 8)
+	}
+	return prefix(v, 16)
+}
+
+func prefix(s string, n int) string {
+	if len(s) > n {
+		return s[:n]
+	}
+	return s
+}
+
+// copyName labels a session copy file in the comparison.
+func copyName(path string) string {
+	return strings.TrimSuffix(filepath.Base(path), ".json")
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"keygen/apdu"
+	"keygen/coordinator"
+	"keygen/groupstate"
+)
+
+const shareUsage = "Usage: keygen share <destroy|retire> [options]"
+
+// runShare implements the share subcommands:
+//
+//	share destroy -share f [-nonces f]... [-device host:port] [-reason text] [-record f] [-group-state f] [-coordinator url] [-yes]
+//	share retire -record f [-group-state f] [-coordinator url]
+//
+// destroy decommissions a participant in one step: it wipes the key slot of
+// the participant's device with WIPE_KEYS, if -device is given, signs a
+// destruction record with the share and writes it, overwrites the share file
+// and the participant's nonce files, and then retires the participant in the
+// group-state document and on the coordinator, which refuse it as a signer
+// from then on. retire delivers a record again, e.g. to a coordinator that
+// could not be reached at the time.
+func runShare(args []string) {
+	if len(args) < 1 {
+		fail(KindUsage, shareUsage)
+	}
+	cmd := flag.NewFlagSet("share "+args[0], flag.ExitOnError)
+	statePath := cmd.String("group-state", "", "Retire the participant in this group-state document")
+	coordURL := cmd.String("coordinator", "", "Retire the participant on this coordinator (token in $"+coordinatorTokenEnv+")")
+	recordPath := cmd.String("record", "", "Destruction record (destroy: default participant-<id>.destroyed.json next to the share file)")
+	var sharePath, passphraseFile, device, reason *string
+	var yes *bool
+	var nonceFiles []string
+	switch args[0] {
+	case "destroy":
+		sharePath = cmd.String("share", "", "Share file to destroy (encrypted or plain)")
+		passphraseFile = cmd.String("passphrase-file", "", "Passphrase for an encrypted -share (default: prompt)")
+		cmd.Func("nonces", "Commit nonce file of the participant to destroy too (repeatable; default: nonces-<id>.json if present)", func(s string) error {
+			nonceFiles = append(nonceFiles, s)
+			return nil
+		})
+		device = cmd.String("device", "", "Wipe the key slot of the device at this Speculos APDU port too")
+		reason = cmd.String("reason", "", "Reason recorded with the destruction")
+		yes = cmd.Bool("yes", false, "Do not ask to type the participant ID first")
+	case "retire":
+	default:
+		fail(KindUsage, shareUsage)
+	}
+	stdioFlags(cmd)
+	cmd.Parse(args[1:])
+	if cmd.NArg() != 0 {
+		fail(KindUsage, shareUsage)
+	}
+
+	var rec *groupstate.Destruction
+	if args[0] == "destroy" {
+		if *sharePath == "" {
+			fail(KindUsage, "Usage: keygen share destroy -share f [-nonces f]... [-device host:port] [-group-state f] [-coordinator url]")
+		}
+		rec = destroyShare(*sharePath, *passphraseFile, nonceFiles, *device, *reason, *recordPath, *statePath, *yes)
+	} else {
+		if *recordPath == "" || (*statePath == "" && *coordURL == "") {
+			fail(KindUsage, "Usage: keygen share retire -record f [-group-state f] [-coordinator url]")
+		}
+		rec = new(groupstate.Destruction)
+		readJSONFile(*recordPath, rec)
+		if err := rec.Verify(); err != nil {
+			fail(KindCrypto, "Error: %s: %v", *recordPath, err)
+		}
+	}
+
+	// The share is gone by now: a failure to notify leaves the record to
+	// deliver with share retire
+	if *statePath != "" {
+		doc := loadGroupState(*statePath)
+		if err := doc.Retire(rec); err != nil {
+			fail(KindCrypto, "Error: %s: %v", *statePath, err)
+		}
+		if err := doc.Save(*statePath); err != nil {
+			fail(KindFailure, "Error writing %s: %v", *statePath, err)
+		}
+		fmt.Fprintf(os.Stderr, "Retired participant %d in %s\n", rec.Participant, *statePath)
+	}
+	if *coordURL != "" {
+		retireOnCoordinator(*coordURL, rec)
+	}
+	if args[0] == "retire" {
+		writeJSON(rec)
+	}
+}
+
+// destroyShare destroys a participant's share, nonce files and device key
+// slot, writes the signed destruction record and prints it.
+func destroyShare(sharePath, passphraseFile string, nonceFiles []string, device, reason, recordPath, statePath string, yes bool) *groupstate.Destruction {
+	data, err := os.ReadFile(sharePath)
+	if err != nil {
+		fail(KindInput, "Error reading %s: %v", sharePath, err)
+	}
+	shareDigest := sha256.Sum256(data)
+	share := loadSigningShare(sharePath, passphraseFile, 0)
+	if share.SecretShare == nil {
+		fail(KindInput, "Error: %s holds no secret share", sharePath)
+	}
+	defer share.SecretShare.Destroy()
+	id := share.Participant
+	if recordPath == "" {
+		recordPath = filepath.Join(filepath.Dir(sharePath), fmt.Sprintf("participant-%d.destroyed.json", id))
+	}
+	if _, err := os.Lstat(recordPath); err == nil {
+		fail(KindInput, "Error: %s already exists", recordPath)
+	}
+
+	// Check everything before destroying anything
+	if len(nonceFiles) == 0 {
+		if path := fmt.Sprintf("nonces-%d.json", id); isFile(path) {
+			nonceFiles = []string{path}
+		}
+	}
+	nonceDigests := make([]string, len(nonceFiles))
+	for i, path := range nonceFiles {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			fail(KindInput, "Error reading %s: %v", path, err)
+		}
+		var c CommitmentOutput
+		readJSONFile(path, &c)
+		if c.Participant != id {
+			fail(KindInput, "Error: %s holds participant %d's nonces, not %d's", path, c.Participant, id)
+		}
+		c.HidingNonce.Destroy()
+		c.BindingNonce.Destroy()
+		sum := sha256.Sum256(data)
+		nonceDigests[i] = hex.EncodeToString(sum[:])
+	}
+	if statePath != "" {
+		doc := loadGroupState(statePath)
+		if !strings.EqualFold(doc.GroupKey, share.GroupKey) {
+			fail(KindInput, "Error: %s is group %s's document, not %s's", statePath, doc.GroupKey, share.GroupKey)
+		}
+	}
+	if !yes {
+		entered, err := promptLine(fmt.Sprintf("This destroys participant %d's share of group %s for good. Type %d to go on: ", id, share.GroupKey, id))
+		if err != nil {
+			fail(KindUsage, "Error: %v (pass -yes to skip the prompt)", err)
+		}
+		if strings.TrimSpace(entered) != strconv.Itoa(id) {
+			fail(KindUsage, "Error: not confirmed; nothing was destroyed")
+		}
+	}
+
+	rec := &groupstate.Destruction{
+		GroupKey:    share.GroupKey,
+		Participant: id,
+		PublicShare: share.PublicShare,
+		Reason:      reason,
+		ShareFile:   hex.EncodeToString(shareDigest[:]),
+		NonceFiles:  nonceDigests,
+		Time:        time.Now().UTC(),
+	}
+	rec.Host, _ = os.Hostname()
+	if device != "" {
+		rec.Device = wipeDevice(device, share.GroupKey, id)
+	}
+	if err := rec.Sign(share.SecretShare.Int(), rand.Reader); err != nil {
+		fail(KindFailure, "Error signing the destruction record: %v", err)
+	}
+
+	// The record first: it is all that is left once the files are gone
+	out, err := jsonOutput(rec)
+	if err != nil {
+		fail(KindFailure, "Error encoding the record: %v", err)
+	}
+	writeNewFile(recordPath, out, 0644)
+	fmt.Fprintf(os.Stderr, "Wrote %s\n", recordPath)
+	for _, path := range append([]string{sharePath}, nonceFiles...) {
+		if err := shredFile(path); err != nil {
+			fail(KindFailure, "Error destroying %s: %v", path, err)
+		}
+		fmt.Fprintf(os.Stderr, "Overwrote and removed %s\n", path)
+	}
+	writeJSON(rec)
+	return rec
+}
+
+// wipeDevice erases the participant's key slot with WIPE_KEYS.
+func wipeDevice(addr, groupKey string, id int) *groupstate.DeviceWipe {
+	key, err := hex.DecodeString(groupKey)
+	if err != nil {
+		fail(KindInput, "Error: group_key: %v", err)
+	}
+	s, err := apdu.DialSpeculos(addr, 5*time.Second)
+	if err != nil {
+		fail(KindTransport, "Error connecting to %s: %v", addr, err)
+	}
+	t := logTransport(s)
+	defer t.Close()
+	wiped, err := apdu.WipeKeys(t, key, uint16(id))
+	switch {
+	case errors.Is(err, apdu.ErrWipeRejected):
+		fail(KindRejected, "Error: %v; nothing was destroyed", err)
+	case errors.Is(err, apdu.ErrNoWipe):
+		fail(KindFailure, "Error: %v; nothing was destroyed", err)
+	case err != nil:
+		fail(KindTransport, "Error wiping the device: %v; nothing was destroyed", err)
+	}
+	if wiped {
+		fmt.Fprintf(os.Stderr, "Wiped participant %d's keys from the device at %s\n", id, addr)
+	} else {
+		fmt.Fprintf(os.Stderr, "The device at %s holds no keys\n", addr)
+	}
+	return &groupstate.DeviceWipe{Transport: addr, Wiped: wiped}
+}
+
+// shredFile overwrites a file with random bytes and then zeros, syncing
+// each pass to disk, and removes it. Copy-on-write and journaling file
+// systems, and flash wear levelling, may keep old blocks all the same, so
+// shares belong on an encrypted volume as well.
+func shredFile(path string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err == nil {
+		for _, src := range []io.Reader{rand.Reader, zeroReader{}} {
+			if _, err = f.Seek(0, io.SeekStart); err != nil {
+				break
+			}
+			if _, err = io.CopyN(f, src, info.Size()); err != nil {
+				break
+			}
+			if err = f.Sync(); err != nil {
+				break
+			}
+		}
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
+
+// isFile reports whether path names a regular file.
+func isFile(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.Mode().IsRegular()
+}
+
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
+
+// retireOnCoordinator delivers a destruction record to a coordinator run
+// with keygen serve.
+func retireOnCoordinator(url string, rec *groupstate.Destruction) {
+	body, _ := json.Marshal(coordinator.RetireParams{GroupKey: rec.GroupKey, Record: *rec})
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	_, err := coordinatorClient(url).Handle(ctx, &coordinator.Request{Op: coordinator.OpRetireParticipant, Body: body})
+	if err != nil {
+		fail(KindTransport, "Error retiring participant %d on %s: %v (deliver the record later with keygen share retire)", rec.Participant, url, err)
+	}
+	fmt.Fprintf(os.Stderr, "Retired participant %d on coordinator %s\n", rec.Participant, url)
+}
@@ -0,0 +1,401 @@
+// Package signsession keeps the state of a signing session between the
+// commands that make it up, so commit, sign and aggregate can refer to a
+// session by name instead of being handed JSON assembled from each other's
+// output.
+//
+// A session is one JSON file, named after the session, in a directory
+// (fy-ledger/sessions in the user config directory by default). It holds
+// the group, the message and the signers, and collects the commitments,
+// partial signatures and result as they are produced; no secrets. Every
+// change is written to a new file that replaces the old one, under a lock
+// file, so a crash or a concurrent command cannot leave half a session.
+// Copies kept by different participants are combined with Merge, and a
+// session moves between operator machines as a Snapshot.
+package signsession
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"keygen/clock"
+	"keygen/schema"
+	"keygen/submit"
+)
+
+// Session is a signing session's state.
+type Session struct {
+	Name         string            `json:"name"`
+	GroupKey     string            `json:"group_key"`
+	MessageHash  string            `json:"message_hash"`
+	Purpose      string            `json:"purpose,omitempty"`       // Purpose tag of the group's shares
+	Signers      []int             `json:"signers"`                 // Ascending
+	Threshold    int               `json:"threshold,omitempty"`     // The group's t; 0 if not known
+	Total        int               `json:"total,omitempty"`         // The group's n; 0 if not known
+	PublicShares []PublicShare     `json:"public_shares,omitempty"` // The signers', to identify invalid partial signatures
+	Commitments  []Commitment      `json:"commitments"`             // By ID
+	PartialSigs  []PartialSig      `json:"partial_sigs"`            // By ID
+	Result       *Result           `json:"result,omitempty"`
+	Handoff      string            `json:"handoff,omitempty"`    // Digest of the snapshot last imported (see Snapshot)
+	Deliveries   []submit.Delivery `json:"deliveries,omitempty"` // Of the result to submission targets
+	Created      time.Time         `json:"created"`
+	Updated      time.Time         `json:"updated"`
+}
+
+// PublicShare is a signer's public share.
+type PublicShare struct {
+	ID          int    `json:"id"`
+	PublicShare string `json:"public_share"`
+}
+
+// Commitment is a signer's public commitment pair.
+type Commitment struct {
+	ID            int    `json:"id"`
+	HidingCommit  string `json:"hiding_commit"`
+	BindingCommit string `json:"binding_commit"`
+	Proof         string `json:"proof,omitempty"`
+}
+
+// PartialSig is a signer's partial signature.
+type PartialSig struct {
+	ID         int    `json:"id"`
+	PartialSig string `json:"partial_sig"`
+}
+
+// Result is the aggregated signature.
+type Result struct {
+	R     string `json:"R"`
+	Z     string `json:"z"`
+	Valid bool   `json:"valid"`
+}
+
+// Errors
+var (
+	ErrNotFound = errors.New("no such session")
+	ErrExists   = errors.New("session already exists")
+	ErrConflict = errors.New("conflicting session data")
+)
+
+var validName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,63}$`)
+
+// CheckName checks that name can name a session: 1 to 64 letters, digits,
+// dots, underscores and hyphens, not starting with a dot, underscore or
+// hyphen.
+func CheckName(name string) error {
+	if !validName.MatchString(name) {
+		return fmt.Errorf("invalid session name %q", name)
+	}
+	return nil
+}
+
+// isSigner reports whether id is one of the signers.
+func (s *Session) isSigner(id int) bool {
+	_, ok := slices.BinarySearch(s.Signers, id)
+	return ok
+}
+
+// Commitment returns the signer's commitment, if the session has it.
+func (s *Session) Commitment(id int) (Commitment, bool) {
+	i, ok := slices.BinarySearchFunc(s.Commitments, id, func(c Commitment, id int) int { return c.ID - id })
+	if !ok {
+		return Commitment{}, false
+	}
+	return s.Commitments[i], true
+}
+
+// Missing returns the signers whose commitments, and those whose partial
+// signatures, the session does not have yet.
+func (s *Session) Missing() (commitments, partials []int) {
+	for _, id := range s.Signers {
+		if _, ok := s.Commitment(id); !ok {
+			commitments = append(commitments, id)
+		}
+		if !slices.ContainsFunc(s.PartialSigs, func(p PartialSig) bool { return p.ID == id }) {
+			partials = append(partials, id)
+		}
+	}
+	return commitments, partials
+}
+
+// AddCommitment adds a signer's commitment. Adding the one the session
+// has again is a no-op; adding another is ErrConflict, since the signer
+// would then have committed twice, and so is one after any partial
+// signature, which was made over the commitments as they were.
+func (s *Session) AddCommitment(c Commitment) error {
+	if !s.isSigner(c.ID) {
+		return fmt.Errorf("participant %d is not a signer of session %s", c.ID, s.Name)
+	}
+	c.HidingCommit, c.BindingCommit = strings.ToLower(c.HidingCommit), strings.ToLower(c.BindingCommit)
+	i, found := slices.BinarySearchFunc(s.Commitments, c.ID, func(c Commitment, id int) int { return c.ID - id })
+	if found {
+		prev := s.Commitments[i]
+		if prev.HidingCommit != c.HidingCommit || prev.BindingCommit != c.BindingCommit {
+			return fmt.Errorf("%w: participant %d already committed to %s", ErrConflict, c.ID, prev.HidingCommit)
+		}
+		return nil
+	}
+	if len(s.PartialSigs) > 0 {
+		return fmt.Errorf("%w: session %s is already being signed", ErrConflict, s.Name)
+	}
+	s.Commitments = slices.Insert(s.Commitments, i, c)
+	return nil
+}
+
+// AddPartialSig adds a signer's partial signature, once the session has
+// every commitment. A different signature from the same signer is
+// ErrConflict.
+func (s *Session) AddPartialSig(p PartialSig) error {
+	if !s.isSigner(p.ID) {
+		return fmt.Errorf("participant %d is not a signer of session %s", p.ID, s.Name)
+	}
+	if missing, _ := s.Missing(); len(missing) > 0 {
+		return fmt.Errorf("session %s is missing the commitments of %v", s.Name, missing)
+	}
+	p.PartialSig = strings.ToLower(p.PartialSig)
+	i, found := slices.BinarySearchFunc(s.PartialSigs, p.ID, func(p PartialSig, id int) int { return p.ID - id })
+	if found {
+		if s.PartialSigs[i].PartialSig != p.PartialSig {
+			return fmt.Errorf("%w: participant %d already signed with %s", ErrConflict, p.ID, s.PartialSigs[i].PartialSig)
+		}
+		return nil
+	}
+	s.PartialSigs = slices.Insert(s.PartialSigs, i, p)
+	return nil
+}
+
+// Merge adds the commitments and partial signatures of another copy of the
+// same session, and its result if s has none. The copies must agree on the
+// group, message, purpose and signers.
+func (s *Session) Merge(other *Session) error {
+	if other.Name != s.Name || !strings.EqualFold(other.GroupKey, s.GroupKey) || other.Purpose != s.Purpose ||
+		!strings.EqualFold(other.MessageHash, s.MessageHash) || !slices.Equal(slices.Sorted(slices.Values(other.Signers)), s.Signers) {
+		return fmt.Errorf("%w: %s is a different session (group, message, purpose or signers differ)", ErrConflict, other.Name)
+	}
+	for _, c := range other.Commitments {
+		if err := s.AddCommitment(c); err != nil {
+			return err
+		}
+	}
+	for _, p := range other.PartialSigs {
+		if err := s.AddPartialSig(p); err != nil {
+			return err
+		}
+	}
+	for _, ps := range other.PublicShares {
+		if !slices.ContainsFunc(s.PublicShares, func(q PublicShare) bool { return q.ID == ps.ID }) {
+			s.PublicShares = append(s.PublicShares, ps)
+		}
+	}
+	slices.SortFunc(s.PublicShares, func(a, b PublicShare) int { return a.ID - b.ID })
+	if s.Result == nil && other.Result != nil {
+		r := *other.Result
+		s.Result = &r
+	}
+	return nil
+}
+
+// Store is a directory of sessions.
+type Store struct {
+	// Clock dates sessions' Created and Updated; nil is clock.Real.
+	Clock clock.Clock
+
+	dir string
+}
+
+// DefaultDir returns fy-ledger/sessions in the user config directory.
+func DefaultDir() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "fy-ledger", "sessions"), nil
+}
+
+// Open opens or creates the store in dir.
+func Open(dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &Store{dir: dir}, nil
+}
+
+func (st *Store) path(name string) string {
+	return filepath.Join(st.dir, name+".json")
+}
+
+// check checks a session read from elsewhere and sorts its lists.
+func (s *Session) check() error {
+	if err := CheckName(s.Name); err != nil {
+		return err
+	}
+	if s.GroupKey == "" || s.MessageHash == "" || len(s.Signers) == 0 {
+		return fmt.Errorf("session %s needs a group key, a message hash and signers", s.Name)
+	}
+	slices.Sort(s.Signers)
+	if len(slices.Compact(slices.Clone(s.Signers))) != len(s.Signers) {
+		return fmt.Errorf("session %s lists a signer twice", s.Name)
+	}
+	if len(s.Signers) < s.Threshold {
+		return fmt.Errorf("session %s has %d signers, fewer than the group's threshold of %d", s.Name, len(s.Signers), s.Threshold)
+	}
+	if s.Total > 0 && s.Signers[len(s.Signers)-1] > s.Total {
+		return fmt.Errorf("session %s: participant %d is not in the group of %d", s.Name, s.Signers[len(s.Signers)-1], s.Total)
+	}
+	commitments, partials := s.Commitments, s.PartialSigs
+	s.Commitments, s.PartialSigs = []Commitment{}, []PartialSig{}
+	for _, c := range commitments {
+		if err := s.AddCommitment(c); err != nil {
+			return err
+		}
+	}
+	for _, p := range partials {
+		if err := s.AddPartialSig(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Create writes a new session. The name must not be taken.
+func (st *Store) Create(s *Session) error {
+	if err := s.check(); err != nil {
+		return err
+	}
+	unlock, err := st.lock(s.Name)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	if _, err := os.Stat(st.path(s.Name)); err == nil {
+		return fmt.Errorf("%w: %s", ErrExists, s.Name)
+	}
+	s.Created = clock.Or(st.Clock).Now().UTC()
+	s.Updated = s.Created
+	return st.write(s)
+}
+
+// Load reads a session.
+func (st *Store) Load(name string) (*Session, error) {
+	if err := CheckName(name); err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(st.path(name))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var s Session
+	if err := schema.Unmarshal(data, &s, st.path(name)); err != nil {
+		return nil, fmt.Errorf("signsession: %s: %w", st.path(name), err)
+	}
+	return &s, nil
+}
+
+// Update loads a session, applies fn to it and writes it back, unless fn
+// fails. Nothing else can update the session meanwhile.
+func (st *Store) Update(name string, fn func(*Session) error) (*Session, error) {
+	if err := CheckName(name); err != nil {
+		return nil, err
+	}
+	unlock, err := st.lock(name)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	s, err := st.Load(name)
+	if err != nil {
+		return nil, err
+	}
+	if err := fn(s); err != nil {
+		return nil, err
+	}
+	s.Updated = clock.Or(st.Clock).Now().UTC()
+	return s, st.write(s)
+}
+
+// List returns the sessions, most recently updated first.
+func (st *Store) List() ([]*Session, error) {
+	matches, err := filepath.Glob(filepath.Join(st.dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	var out []*Session
+	for _, m := range matches {
+		s, err := st.Load(strings.TrimSuffix(filepath.Base(m), ".json"))
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, s)
+	}
+	slices.SortFunc(out, func(a, b *Session) int { return b.Updated.Compare(a.Updated) })
+	return out, nil
+}
+
+// Delete removes a session.
+func (st *Store) Delete(name string) error {
+	if err := CheckName(name); err != nil {
+		return err
+	}
+	err := os.Remove(st.path(name))
+	if errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+	return err
+}
+
+// write replaces the session's file. Callers hold its lock.
+func (st *Store) write(s *Session) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := st.path(s.Name) + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(data, '\n')); err == nil {
+		err = f.Sync()
+	}
+	if err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, st.path(s.Name))
+}
+
+// lockWait is how long lock waits for another command to finish with a
+// session.
+const lockWait = 10 * time.Second
+
+// lock takes the session's lock file, waiting up to lockWait for it.
+func (st *Store) lock(name string) (func(), error) {
+	path := st.path(name) + ".lock"
+	deadline := time.Now().Add(lockWait)
+	for {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if err == nil {
+			f.Close()
+			return func() { os.Remove(path) }, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, err
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("session %s is locked by another command; remove %s if none is running", name, path)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
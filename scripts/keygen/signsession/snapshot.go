@@ -0,0 +1,149 @@
+package signsession
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SnapshotFormat is the format of snapshots this package writes.
+const SnapshotFormat = "fy-ledger-session-snapshot/v1"
+
+// Snapshot is a session's public state, exported from one operator machine
+// and imported on another to carry on with the ceremony there, e.g. on the
+// machine the Ledger is attached to.
+//
+// Digests hashes the parts of the session separately, so that an importer
+// can say which part differs, and Digest binds them together with Parent,
+// the digest of the snapshot the session was last imported from. Reading
+// Digest (or its Code) between the two machines over another channel
+// confirms the snapshot was not changed in transit; Parent makes a chain of
+// handoffs checkable one link at a time.
+type Snapshot struct {
+	Format     string          `json:"format"`
+	Session    *Session        `json:"session"`
+	Digests    SnapshotDigests `json:"digests"`
+	Parent     string          `json:"parent,omitempty"`
+	From       string          `json:"from,omitempty"` // Host name of the exporting machine
+	ExportedAt time.Time       `json:"exported_at"`
+	Digest     string          `json:"digest"`
+}
+
+// SnapshotDigests are the SHA-256 digests of a session's parts.
+type SnapshotDigests struct {
+	Header      string `json:"header"` // Name, group, message, purpose, signers, threshold, public shares
+	Commitments string `json:"commitments"`
+	PartialSigs string `json:"partial_sigs"`
+	Result      string `json:"result"`
+}
+
+// ErrSnapshot is returned for a snapshot whose digests do not match its
+// contents.
+var ErrSnapshot = errors.New("snapshot does not match its digests")
+
+const snapshotDomain = "fy-ledger/session-snapshot/v1"
+
+// digest hashes a label and parts, each length-prefixed, under the
+// snapshot domain.
+func digest(label string, parts ...string) string {
+	h := sha256.New()
+	for _, part := range append([]string{snapshotDomain, label}, parts...) {
+		var n [8]byte
+		binary.BigEndian.PutUint64(n[:], uint64(len(part)))
+		h.Write(n[:])
+		h.Write([]byte(part))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Digests computes the digests of the session's parts. Hex is compared in
+// lower case, and Created and Updated, which each machine sets for itself,
+// are left out.
+func (s *Session) Digests() SnapshotDigests {
+	header := []string{s.Name, strings.ToLower(s.GroupKey), strings.ToLower(s.MessageHash), s.Purpose}
+	for _, id := range s.Signers {
+		header = append(header, strconv.Itoa(id))
+	}
+	if s.Threshold > 0 || s.Total > 0 {
+		// Only when set, so that older sessions keep their digests
+		header = append(header, "t="+strconv.Itoa(s.Threshold), "n="+strconv.Itoa(s.Total))
+	}
+	for _, ps := range s.PublicShares {
+		header = append(header, strconv.Itoa(ps.ID), strings.ToLower(ps.PublicShare))
+	}
+	var commitments, partials, result []string
+	for _, c := range s.Commitments {
+		commitments = append(commitments, strconv.Itoa(c.ID), strings.ToLower(c.HidingCommit), strings.ToLower(c.BindingCommit), c.Proof)
+	}
+	for _, p := range s.PartialSigs {
+		partials = append(partials, strconv.Itoa(p.ID), strings.ToLower(p.PartialSig))
+	}
+	if s.Result != nil {
+		result = []string{strings.ToLower(s.Result.R), strings.ToLower(s.Result.Z), strconv.FormatBool(s.Result.Valid)}
+	}
+	return SnapshotDigests{
+		Header:      digest("header", header...),
+		Commitments: digest("commitments", commitments...),
+		PartialSigs: digest("partial_sigs", partials...),
+		Result:      digest("result", result...),
+	}
+}
+
+func (sn *Snapshot) digest() string {
+	d := sn.Digests
+	return digest("snapshot", d.Header, d.Commitments, d.PartialSigs, d.Result, sn.Parent)
+}
+
+// Export makes a snapshot of the session. Its parent is the snapshot the
+// session was last imported from, if any.
+func (s *Session) Export(from string) *Snapshot {
+	sn := &Snapshot{
+		Format:     SnapshotFormat,
+		Session:    s,
+		Digests:    s.Digests(),
+		Parent:     s.Handoff,
+		From:       from,
+		ExportedAt: time.Now().UTC(),
+	}
+	sn.Digest = sn.digest()
+	return sn
+}
+
+// Verify checks the snapshot's format and recomputes its digests, naming
+// the parts that differ. It also checks and sorts the session as Create
+// does, so the digests are of the session as it will be stored.
+func (sn *Snapshot) Verify() error {
+	if sn.Format != SnapshotFormat {
+		return fmt.Errorf("unsupported snapshot format %q", sn.Format)
+	}
+	if sn.Session == nil {
+		return errors.New("snapshot holds no session")
+	}
+	if err := sn.Session.check(); err != nil {
+		return err
+	}
+	got, want := sn.Session.Digests(), sn.Digests
+	var differ []string
+	for _, part := range []struct{ name, got, want string }{
+		{"header", got.Header, want.Header},
+		{"commitments", got.Commitments, want.Commitments},
+		{"partial_sigs", got.PartialSigs, want.PartialSigs},
+		{"result", got.Result, want.Result},
+	} {
+		if !strings.EqualFold(part.got, part.want) {
+			differ = append(differ, part.name)
+		}
+	}
+	if len(differ) > 0 {
+		return fmt.Errorf("%w: %s", ErrSnapshot, strings.Join(differ, ", "))
+	}
+	if !strings.EqualFold(sn.digest(), sn.Digest) {
+		return fmt.Errorf("%w: digest", ErrSnapshot)
+	}
+	return nil
+}
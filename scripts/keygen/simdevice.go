@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+
+	"keygen/diag"
+	"keygen/simdevice"
+)
+
+// runSimDevice runs the software model of the Ledger app. With a listen
+// address it serves the Speculos APDU protocol; otherwise it reads one hex
+// APDU per line from stdin and prints the hex response (data || SW).
+// debugListen serves its diagnostics, with the device's nonce pool, while it
+// listens. reject lists the prompts the device rejects, to exercise a host's
+// rejection handling.
+func runSimDevice(listen string, counter, commitBatch, debugTrace bool, reject, debugListen string) {
+	dev := simdevice.New()
+	dev.Counter = counter
+	dev.CommitBatch = commitBatch
+	dev.DebugTrace = debugTrace
+	if reject != "" {
+		var kinds []simdevice.PromptKind
+		for _, name := range strings.Split(reject, ",") {
+			kind, err := simdevice.ParsePromptKind(strings.TrimSpace(name))
+			if err != nil {
+				fail(KindUsage, "Error: -reject: %v", err)
+			}
+			kinds = append(kinds, kind)
+		}
+		dev.Approve = simdevice.Reject(kinds...)
+	}
+
+	if listen != "" {
+		serveDebug(debugListen, map[string]diag.Source{
+			"device": func() any { return dev.Stats() },
+		})
+		l, err := net.Listen("tcp", listen)
+		if err != nil {
+			fail(KindFailure, "Error listening: %v", err)
+		}
+		fmt.Fprintf(os.Stderr, "Simulated device listening on %s\n", l.Addr())
+		if err := simdevice.Serve(l, dev); err != nil {
+			fail(KindFailure, "Error serving: %v", err)
+		}
+		return
+	}
+
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		command, err := hex.DecodeString(line)
+		if err != nil {
+			fail(KindInput, "Error: invalid APDU hex: %v", err)
+		}
+		fmt.Println(hex.EncodeToString(dev.Exchange(command)))
+	}
+	if err := scanner.Err(); err != nil {
+		fail(KindInput, "Error reading input: %v", err)
+	}
+}
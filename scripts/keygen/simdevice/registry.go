@@ -0,0 +1,98 @@
+package simdevice
+
+import "keygen/frostcore"
+
+// Command is a command APDU as handed to a Handler.
+type Command struct {
+	INS, P1, P2 byte
+	Data        []byte // Lc bytes
+}
+
+// Handler implements one instruction. It returns the response data and
+// status word, as a handler in src/handler.c does; the device appends the
+// status word. Handlers run one at a time.
+type Handler interface {
+	HandleAPDU(d *Device, c Command) ([]byte, uint16)
+}
+
+// HandlerFunc adapts a function to Handler.
+type HandlerFunc func(d *Device, c Command) ([]byte, uint16)
+
+func (f HandlerFunc) HandleAPDU(d *Device, c Command) ([]byte, uint16) { return f(d, c) }
+
+// Handle registers h for instruction ins, so a new command (a DKG round, a
+// batch signature) can be prototyped in Go and tested from the host before
+// it is written in C, with the Go version as the oracle. h replaces the
+// built-in handler of ins, if any; a nil h restores it. Handlers keep their
+// own state, e.g. in a closure, and reach the device's through Key, Reset,
+// Random and Confirm:
+//
+//	dev := simdevice.New()
+//	dev.Handle(0x30, simdevice.HandlerFunc(func(d *simdevice.Device, c simdevice.Command) ([]byte, uint16) {
+//		id, _, _, ok := d.Key()
+//		if !ok {
+//			return nil, apdu.SwConditionsNotSat
+//		}
+//		return []byte{byte(id >> 8), byte(id)}, apdu.SwOK
+//	}))
+func (d *Device) Handle(ins byte, h Handler) {
+	if h == nil {
+		delete(d.handlers, ins)
+		return
+	}
+	if d.handlers == nil {
+		d.handlers = make(map[byte]Handler)
+	}
+	d.handlers[ins] = h
+}
+
+// handler returns the handler of ins: a registered one, else the built-in
+// one unless it is planned and not enabled, else nil.
+func (d *Device) handler(ins byte) Handler {
+	if h, ok := d.handlers[ins]; ok {
+		return h
+	}
+	if enabled, ok := planned[ins]; ok && !enabled(d) {
+		return nil
+	}
+	return builtin[ins]
+}
+
+// Key returns the injected key share: the participant identifier, group key
+// and secret share. ok is false before INJECT_KEYS.
+func (d *Device) Key() (identifier uint16, groupKey, secret []byte, ok bool) {
+	if !d.nv.initialized {
+		return 0, nil, nil, false
+	}
+	return d.nv.identifier, append([]byte(nil), d.nv.groupKey[:]...), append([]byte(nil), d.nv.secret[:]...), true
+}
+
+// Purpose returns the purpose tag of the injected key share, which a handler
+// signing with Key must bind into its challenges; empty if untagged.
+func (d *Device) Purpose() string {
+	return d.nv.purpose
+}
+
+// Reset clears the signing context, including nonces, as RESET does.
+func (d *Device) Reset() {
+	d.reset()
+}
+
+// Random fills buf from the device RNG (Device.Rand).
+func (d *Device) Random(buf []byte) {
+	d.random(buf)
+}
+
+// RandomScalar returns a random scalar from the device RNG, reduced as the
+// app reduces its nonces.
+func (d *Device) RandomScalar() []byte {
+	var n [frostcore.ScalarSize]byte
+	d.newNonce(&n)
+	return n[:]
+}
+
+// Confirm shows a confirmation screen and reports whether it was approved
+// (Device.Approve).
+func (d *Device) Confirm(p Prompt) bool {
+	return d.approve(p)
+}
@@ -0,0 +1,55 @@
+package simdevice
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+)
+
+// Serve accepts connections speaking Speculos' raw APDU protocol
+// (4-byte big-endian length || APDU, answered with 4-byte data length ||
+// data || SW) and feeds them to the device, so existing Speculos clients such
+// as scripts/test-2of3.py can run against the software model.
+//
+// The device is shared across connections, like a single emulator. Stats
+// may be called while it serves.
+func Serve(l net.Listener, d *Device) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		go func() {
+			defer conn.Close()
+			serveConn(conn, d)
+		}()
+	}
+}
+
+func serveConn(conn io.ReadWriter, d *Device) {
+	var hdr [4]byte
+	for {
+		if _, err := io.ReadFull(conn, hdr[:]); err != nil {
+			return
+		}
+		command := make([]byte, binary.BigEndian.Uint32(hdr[:]))
+		if _, err := io.ReadFull(conn, command); err != nil {
+			return
+		}
+
+		d.mu.Lock()
+		resp := d.Exchange(command)
+		d.mu.Unlock()
+
+		data := resp[:len(resp)-2]
+		out := binary.BigEndian.AppendUint32(nil, uint32(len(data)))
+		out = append(out, resp...)
+		if _, err := conn.Write(out); err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,724 @@
+// Package simdevice is a software model of the FROST Ledger app. It implements
+// the same APDU state machine as src/main.c and src/handler.c
+//
+//	IDLE -> [COMMIT] -> COMMITTED -> [INJECT_MESSAGE] -> MESSAGE_SET
+//	     -> [INJECT_COMMITMENTS] -> COMMITMENTS_SET -> [PARTIAL_SIGN] -> IDLE
+//
+// With CommitBatch, COMMIT takes its nonces from a pool filled ahead of time
+// by the planned COMMIT_BATCH instruction.
+//
+// and returns the same response data and status words, so APDU sequences and
+// host logic can be validated without Speculos.
+//
+// Instructions are dispatched through a registry of Handlers. Device.Handle
+// adds or replaces one, to prototype a new command in Go before porting it to
+// the app.
+package simdevice
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"math/big"
+	"slices"
+	"sync"
+
+	"keygen/apdu"
+	"keygen/frostcore"
+)
+
+// App version reported by GET_VERSION
+const (
+	MajorVersion = 1
+	MinorVersion = 0
+	PatchVersion = 0
+)
+
+// State is the signing state machine (frost_state_t).
+type State int
+
+const (
+	StateIdle State = iota
+	StateCommitted
+	StateMessageSet
+	StateCommitmentsSet
+	StateChallengeSet
+	StateReadyToSign
+)
+
+func (s State) String() string {
+	switch s {
+	case StateIdle:
+		return "IDLE"
+	case StateCommitted:
+		return "COMMITTED"
+	case StateMessageSet:
+		return "MESSAGE_SET"
+	case StateCommitmentsSet:
+		return "COMMITMENTS_SET"
+	case StateChallengeSet:
+		return "CHALLENGE_SET"
+	case StateReadyToSign:
+		return "READY_TO_SIGN"
+	}
+	return "UNKNOWN"
+}
+
+// PromptKind identifies an on-device approval screen.
+type PromptKind int
+
+const (
+	PromptInjectKeys PromptKind = iota
+	PromptSign
+	PromptCustom   // From a registered handler; see Prompt.Text
+	PromptWipeKeys // WIPE_KEYS
+)
+
+func (k PromptKind) String() string {
+	switch k {
+	case PromptInjectKeys:
+		return "inject_keys"
+	case PromptSign:
+		return "sign"
+	case PromptCustom:
+		return "custom"
+	case PromptWipeKeys:
+		return "wipe_keys"
+	}
+	return "unknown"
+}
+
+// ParsePromptKind parses the String of a PromptKind.
+func ParsePromptKind(s string) (PromptKind, error) {
+	for _, k := range []PromptKind{PromptInjectKeys, PromptSign, PromptCustom, PromptWipeKeys} {
+		if s == k.String() {
+			return k, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown prompt %q (inject_keys, sign, wipe_keys or custom)", s)
+}
+
+// Reject returns an Approve function that rejects the prompts of the given
+// kinds, as an operator pressing Reject would, and approves the others.
+func Reject(kinds ...PromptKind) func(Prompt) bool {
+	return func(p Prompt) bool {
+		return !slices.Contains(kinds, p.Kind)
+	}
+}
+
+// Prompt describes what the device would display for approval.
+type Prompt struct {
+	Kind        PromptKind
+	Fingerprint []byte // INJECT_KEYS, WIPE_KEYS: sha256(group key), first 4 bytes are shown
+	Identifier  uint16 // INJECT_KEYS, WIPE_KEYS: participant ID
+	Purpose     string // INJECT_KEYS: purpose tag, empty if untagged
+	MessageHash []byte // PARTIAL_SIGN: message hash
+	Text        string // PromptCustom: what the screen shows
+}
+
+// storage mirrors frost_storage_t (NVRAM).
+type storage struct {
+	initialized bool
+	curveID     byte
+	identifier  uint16
+	groupKey    [frostcore.PointSize]byte
+	secret      [frostcore.ScalarSize]byte
+	purpose     string // Bound into every challenge; empty if untagged
+	counter     uint32 // Signatures produced; survives INJECT_KEYS
+}
+
+// signingContext mirrors frost_ctx_t (RAM, cleared after each session).
+type signingContext struct {
+	state State
+
+	hidingNonce   [frostcore.ScalarSize]byte
+	bindingNonce  [frostcore.ScalarSize]byte
+	hidingCommit  [frostcore.PointSize]byte
+	bindingCommit [frostcore.PointSize]byte
+
+	messageHash [frostcore.ScalarSize]byte
+
+	numParticipants         int
+	commitmentBytesReceived int
+	commitmentList          [apdu.MaxParticipants * apdu.CommitmentEntrySize]byte
+
+	externalChallenge    [frostcore.ScalarSize]byte
+	useExternalChallenge bool
+}
+
+// noncePool holds nonce pairs generated by COMMIT_BATCH (RAM, kept across
+// sessions, cleared by INJECT_KEYS).
+type noncePool struct {
+	pairs   []pooledNonce
+	nextSeq uint16
+}
+
+type pooledNonce struct {
+	hiding, binding [frostcore.ScalarSize]byte
+}
+
+// Device is an in-memory FROST Ledger app.
+type Device struct {
+	// Approve is called for every confirmation screen. Nil approves
+	// everything, like an auto-approving emulator. It may block, like a
+	// device waiting for its operator, to exercise cancellation.
+	Approve func(Prompt) bool
+
+	// Rand replaces the secure element RNG. Nil uses crypto/rand.
+	Rand io.Reader
+
+	// Counter enables the planned signing counter (GET_COUNTER), which the
+	// app does not implement yet.
+	Counter bool
+
+	// CommitBatch enables the planned nonce pool (COMMIT_BATCH), which the
+	// app does not implement yet.
+	CommitBatch bool
+
+	// DebugTrace models a debug build, which keeps the intermediates of the
+	// last PARTIAL_SIGN for the planned GET_DEBUG_TRACE.
+	DebugTrace bool
+
+	nv       storage
+	ctx      signingContext
+	pool     noncePool
+	trace    [][]byte         // GET_DEBUG_TRACE responses by P1; nil before PARTIAL_SIGN
+	handlers map[byte]Handler // Registered with Handle; override builtin
+
+	mu        sync.Mutex // Held by Serve around Exchange, and by Stats
+	exchanges int
+}
+
+// New returns a device with empty storage that approves every prompt.
+func New() *Device {
+	return &Device{}
+}
+
+// State returns the current signing state.
+func (d *Device) State() State {
+	return d.ctx.state
+}
+
+// Exchange processes one command APDU and returns response data || SW,
+// following the dispatcher in src/main.c.
+func (d *Device) Exchange(command []byte) []byte {
+	d.exchanges++
+	data, sw, thrown := d.dispatch(command)
+	if thrown {
+		// On error, reset signing state for safety
+		if sw != apdu.SwOK && sw != apdu.SwUserRejected {
+			d.reset()
+		}
+		data = nil
+	}
+	return append(data, byte(sw>>8), byte(sw))
+}
+
+// Stats describes a device, for diagnostics. It has no secrets: nonces
+// are only counted.
+type Stats struct {
+	State       string `json:"state"`
+	Initialized bool   `json:"initialized"`
+	Identifier  uint16 `json:"identifier,omitempty"`
+	Purpose     string `json:"purpose,omitempty"`
+	Counter     uint32 `json:"counter"`                 // Signatures produced
+	PoolSize    int    `json:"pool_size"`               // Nonce pairs pooled by COMMIT_BATCH
+	PoolNextSeq uint16 `json:"pool_next_seq,omitempty"` // Sequence number of the next pooled pair
+	Exchanges   int    `json:"exchanges"`               // Commands processed
+}
+
+// Stats returns the device's Stats. It is safe to call while Serve runs,
+// but not concurrently with direct calls to Exchange.
+func (d *Device) Stats() Stats {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return Stats{
+		State:       d.ctx.state.String(),
+		Initialized: d.nv.initialized,
+		Identifier:  d.nv.identifier,
+		Purpose:     d.nv.purpose,
+		Counter:     d.nv.counter,
+		PoolSize:    len(d.pool.pairs),
+		PoolNextSeq: d.pool.nextSeq,
+		Exchanges:   d.exchanges,
+	}
+}
+
+// dispatch returns thrown=true for errors the app raises with THROW rather
+// than returning from a handler.
+func (d *Device) dispatch(command []byte) (resp []byte, sw uint16, thrown bool) {
+	if len(command) < 5 {
+		return nil, apdu.SwWrongLength, true
+	}
+	if command[0] != apdu.CLA {
+		return nil, apdu.SwClaNotSupported, true
+	}
+
+	lc := int(command[4])
+	if len(command) < 5+lc {
+		return nil, apdu.SwWrongLength, true
+	}
+	c := Command{INS: command[1], P1: command[2], P2: command[3], Data: command[5 : 5+lc]}
+
+	h := d.handler(c.INS)
+	if h == nil {
+		return nil, apdu.SwInsNotSupported, true
+	}
+	resp, sw = h.HandleAPDU(d, c)
+	return resp, sw, false
+}
+
+func (d *Device) approve(p Prompt) bool {
+	if d.Approve == nil {
+		return true
+	}
+	return d.Approve(p)
+}
+
+func (d *Device) random(buf []byte) {
+	r := d.Rand
+	if r == nil {
+		r = rand.Reader
+	}
+	if _, err := io.ReadFull(r, buf); err != nil {
+		panic("simdevice: rng: " + err.Error())
+	}
+}
+
+// reset clears the signing context, including nonces (frost_ctx_reset).
+func (d *Device) reset() {
+	d.ctx = signingContext{}
+}
+
+// ============================================================================
+// Handlers (src/handler.c)
+// ============================================================================
+
+// builtin are the app's instructions.
+var builtin = map[byte]Handler{
+	apdu.InsGetVersion: HandlerFunc(func(d *Device, c Command) ([]byte, uint16) {
+		return d.handleGetVersion()
+	}),
+	apdu.InsGetPublicKey: HandlerFunc(func(d *Device, c Command) ([]byte, uint16) {
+		return d.handleGetPublicKey()
+	}),
+	apdu.InsInjectKeys: HandlerFunc(func(d *Device, c Command) ([]byte, uint16) {
+		return nil, d.handleInjectKeys(c.P1, c.P2, c.Data)
+	}),
+	apdu.InsCommit: HandlerFunc(func(d *Device, c Command) ([]byte, uint16) {
+		return d.handleCommit()
+	}),
+	apdu.InsInjectMessage: HandlerFunc(func(d *Device, c Command) ([]byte, uint16) {
+		return nil, d.handleInjectMessage(c.Data)
+	}),
+	apdu.InsInjectCommitmentsP1: HandlerFunc(func(d *Device, c Command) ([]byte, uint16) {
+		return d.handleInjectCommitmentsP1(c.P1, c.Data)
+	}),
+	apdu.InsInjectCommitmentsP2: HandlerFunc(func(d *Device, c Command) ([]byte, uint16) {
+		return d.handleInjectCommitmentsP2(c.Data)
+	}),
+	apdu.InsPartialSign: HandlerFunc(func(d *Device, c Command) ([]byte, uint16) {
+		return d.handlePartialSign()
+	}),
+	apdu.InsReset: HandlerFunc(func(d *Device, c Command) ([]byte, uint16) {
+		return nil, d.handleReset()
+	}),
+	apdu.InsInjectChallenge: HandlerFunc(func(d *Device, c Command) ([]byte, uint16) {
+		return nil, d.handleInjectChallenge(c.Data)
+	}),
+	apdu.InsWipeKeys: HandlerFunc(func(d *Device, c Command) ([]byte, uint16) {
+		return d.handleWipeKeys(c.Data)
+	}),
+	apdu.InsGetCounter: HandlerFunc(func(d *Device, c Command) ([]byte, uint16) {
+		return d.handleGetCounter(c.P1)
+	}),
+	apdu.InsCommitBatch: HandlerFunc(func(d *Device, c Command) ([]byte, uint16) {
+		return d.handleCommitBatch(c.P1, c.Data)
+	}),
+	apdu.InsGetDebugTrace: HandlerFunc(func(d *Device, c Command) ([]byte, uint16) {
+		return d.handleGetDebugTrace(c.P1)
+	}),
+}
+
+// planned are built-in instructions the app does not implement yet; each is
+// only dispatched when its Device option is set.
+var planned = map[byte]func(*Device) bool{
+	apdu.InsGetCounter:    func(d *Device) bool { return d.Counter },
+	apdu.InsCommitBatch:   func(d *Device) bool { return d.CommitBatch },
+	apdu.InsGetDebugTrace: func(d *Device) bool { return d.DebugTrace },
+}
+
+func (d *Device) handleGetVersion() ([]byte, uint16) {
+	flags := byte(apdu.AppFlagPurpose)
+	if d.Approve == nil {
+		flags |= apdu.AppFlagAutoApprove
+	}
+	if d.Counter {
+		flags |= apdu.AppFlagCounter
+	}
+	if d.CommitBatch {
+		flags |= apdu.AppFlagCommitBatch
+	}
+	if d.DebugTrace {
+		flags |= apdu.AppFlagDebugTrace
+	}
+	return []byte{MajorVersion, MinorVersion, PatchVersion, flags}, apdu.SwOK
+}
+
+func (d *Device) handleGetPublicKey() ([]byte, uint16) {
+	if !d.nv.initialized {
+		return nil, apdu.SwConditionsNotSat
+	}
+	return append([]byte(nil), d.nv.groupKey[:]...), apdu.SwOK
+}
+
+func (d *Device) handleInjectKeys(p1, p2 byte, data []byte) uint16 {
+	if p1 != apdu.CurveBJJ {
+		return apdu.SwWrongP1P2
+	}
+	if len(data) < 96 || len(data) > 96+apdu.MaxPurposeLen {
+		return apdu.SwWrongLength
+	}
+
+	groupKey := data[0:32]
+	idBytes := data[32:64]
+	secret := data[64:96]
+	purpose := string(data[96:])
+	if frostcore.CheckPurpose(purpose) != nil {
+		return apdu.SwInvalidData
+	}
+
+	identifier := frostcore.IDFromBytes(idBytes)
+	if identifier == 0 {
+		return apdu.SwInvalidData
+	}
+
+	fingerprint := sha256.Sum256(groupKey)
+	if !d.approve(Prompt{Kind: PromptInjectKeys, Fingerprint: fingerprint[:], Identifier: identifier, Purpose: purpose}) {
+		return apdu.SwUserRejected
+	}
+
+	d.nv.initialized = true
+	d.nv.curveID = p1
+	d.nv.identifier = identifier
+	copy(d.nv.groupKey[:], groupKey)
+	copy(d.nv.secret[:], secret)
+	d.nv.purpose = purpose
+	d.pool = noncePool{} // Pooled nonces belong to the old key
+	d.trace = nil
+	return apdu.SwOK
+}
+
+func (d *Device) handleWipeKeys(data []byte) ([]byte, uint16) {
+	if len(data) != 64 {
+		return nil, apdu.SwWrongLength
+	}
+	if !d.nv.initialized {
+		return []byte{0}, apdu.SwOK // Nothing to wipe
+	}
+	if !bytes.Equal(data[:32], d.nv.groupKey[:]) || frostcore.IDFromBytes(data[32:64]) != d.nv.identifier {
+		return nil, apdu.SwInvalidData
+	}
+	fingerprint := sha256.Sum256(data[:32])
+	if !d.approve(Prompt{Kind: PromptWipeKeys, Fingerprint: fingerprint[:], Identifier: d.nv.identifier}) {
+		return nil, apdu.SwUserRejected
+	}
+	d.nv = storage{}
+	d.pool = noncePool{}
+	d.trace = nil
+	d.reset()
+	return []byte{1}, apdu.SwOK
+}
+
+func (d *Device) handleCommit() ([]byte, uint16) {
+	if !d.nv.initialized {
+		return nil, apdu.SwConditionsNotSat
+	}
+	if d.ctx.state != StateIdle {
+		return nil, apdu.SwConditionsNotSat
+	}
+
+	// The oldest pooled pair if there is one, otherwise fresh nonces
+	if len(d.pool.pairs) > 0 {
+		d.ctx.hidingNonce, d.ctx.bindingNonce = d.pool.pairs[0].hiding, d.pool.pairs[0].binding
+		d.pool.pairs[0] = pooledNonce{}
+		d.pool.pairs = d.pool.pairs[1:]
+	} else {
+		d.newNonce(&d.ctx.hidingNonce)
+		d.newNonce(&d.ctx.bindingNonce)
+	}
+
+	copy(d.ctx.hidingCommit[:], frostcore.BasePoint(frostcore.ScalarFromBytes(d.ctx.hidingNonce[:])))
+	copy(d.ctx.bindingCommit[:], frostcore.BasePoint(frostcore.ScalarFromBytes(d.ctx.bindingNonce[:])))
+
+	d.ctx.state = StateCommitted
+
+	resp := append([]byte(nil), d.ctx.hidingCommit[:]...)
+	return append(resp, d.ctx.bindingCommit[:]...), apdu.SwOK
+}
+
+// newNonce fills n with a nonce drawn from fresh randomness and the secret
+// share (frost_nonce_generate).
+func (d *Device) newNonce(n *[frostcore.ScalarSize]byte) {
+	var seed [frostcore.NonceSeedSize]byte
+	d.random(seed[:])
+	copy(n[:], frostcore.ScalarBytes(frostcore.NonceGenerate(seed[:], frostcore.ScalarFromBytes(d.nv.secret[:]), nil)))
+}
+
+// handleCommitBatch adds up to p1 nonce pairs to the pool and returns their
+// commitments: count || first_seq || count * (hiding || binding). A full
+// pool returns fewer, possibly none.
+func (d *Device) handleCommitBatch(p1 byte, data []byte) ([]byte, uint16) {
+	if !d.nv.initialized {
+		return nil, apdu.SwConditionsNotSat
+	}
+	if p1 < 1 || int(p1) > apdu.MaxCommitBatch {
+		return nil, apdu.SwWrongP1P2
+	}
+	if len(data) != 0 {
+		return nil, apdu.SwWrongLength
+	}
+
+	n := min(int(p1), apdu.NoncePoolSize-len(d.pool.pairs))
+	resp := []byte{byte(n), byte(d.pool.nextSeq >> 8), byte(d.pool.nextSeq)}
+	for i := 0; i < n; i++ {
+		var p pooledNonce
+		d.newNonce(&p.hiding)
+		d.newNonce(&p.binding)
+		d.pool.pairs = append(d.pool.pairs, p)
+		resp = append(resp, frostcore.BasePoint(frostcore.ScalarFromBytes(p.hiding[:]))...)
+		resp = append(resp, frostcore.BasePoint(frostcore.ScalarFromBytes(p.binding[:]))...)
+	}
+	d.pool.nextSeq += uint16(n)
+	return resp, apdu.SwOK
+}
+
+func (d *Device) handleInjectMessage(data []byte) uint16 {
+	if !d.nv.initialized {
+		return apdu.SwConditionsNotSat
+	}
+	if d.ctx.state != StateCommitted {
+		return apdu.SwConditionsNotSat
+	}
+	if len(data) != frostcore.ScalarSize {
+		return apdu.SwWrongLength
+	}
+	copy(d.ctx.messageHash[:], data)
+	d.ctx.state = StateMessageSet
+	return apdu.SwOK
+}
+
+func (d *Device) handleInjectCommitmentsP1(p1 byte, data []byte) ([]byte, uint16) {
+	if !d.nv.initialized {
+		return nil, apdu.SwConditionsNotSat
+	}
+	if d.ctx.state != StateMessageSet {
+		return nil, apdu.SwConditionsNotSat
+	}
+	if p1 < 2 || int(p1) > apdu.MaxParticipants {
+		return nil, apdu.SwInvalidData
+	}
+
+	d.ctx.numParticipants = int(p1)
+	d.ctx.commitmentBytesReceived = 0
+	d.ctx.commitmentList = [len(d.ctx.commitmentList)]byte{}
+
+	expected := int(p1) * apdu.CommitmentEntrySize
+	n := copy(d.ctx.commitmentList[:expected], data)
+	d.ctx.commitmentBytesReceived = n
+
+	if d.ctx.commitmentBytesReceived >= expected {
+		d.ctx.state = StateCommitmentsSet
+	}
+	return d.bytesReceived(), apdu.SwOK
+}
+
+func (d *Device) handleInjectCommitmentsP2(data []byte) ([]byte, uint16) {
+	if !d.nv.initialized {
+		return nil, apdu.SwConditionsNotSat
+	}
+	if d.ctx.state != StateMessageSet {
+		return nil, apdu.SwConditionsNotSat
+	}
+
+	expected := d.ctx.numParticipants * apdu.CommitmentEntrySize
+	n := copy(d.ctx.commitmentList[d.ctx.commitmentBytesReceived:expected], data)
+	d.ctx.commitmentBytesReceived += n
+
+	if d.ctx.commitmentBytesReceived >= expected {
+		d.ctx.state = StateCommitmentsSet
+	}
+	return d.bytesReceived(), apdu.SwOK
+}
+
+func (d *Device) bytesReceived() []byte {
+	n := d.ctx.commitmentBytesReceived
+	return []byte{byte(n >> 8), byte(n)}
+}
+
+func (d *Device) handlePartialSign() ([]byte, uint16) {
+	if !d.nv.initialized {
+		return nil, apdu.SwConditionsNotSat
+	}
+	if d.ctx.state != StateCommitmentsSet && d.ctx.state != StateChallengeSet {
+		return nil, apdu.SwConditionsNotSat
+	}
+
+	if !d.approve(Prompt{Kind: PromptSign, MessageHash: append([]byte(nil), d.ctx.messageHash[:]...)}) {
+		d.reset() // Clear nonces on rejection
+		return nil, apdu.SwUserRejected
+	}
+
+	list, _ := frostcore.ParseCommitments(d.ctx.commitmentList[:d.ctx.numParticipants*apdu.CommitmentEntrySize])
+	ids := make([]uint16, len(list))
+	for i := range list {
+		ids[i] = list[i].Identifier()
+	}
+
+	msg := d.ctx.messageHash[:]
+	rhos := frostcore.BindingFactors(msg, list)
+
+	var myRho *big.Int
+	for i, id := range ids {
+		if id == d.nv.identifier {
+			myRho = rhos[i]
+			break
+		}
+	}
+	if myRho == nil {
+		d.reset()
+		return nil, apdu.SwInvalidData // Our ID not in commitment list
+	}
+
+	groupCommitment, err := frostcore.DeviceGroupCommitment(list, rhos)
+	if err != nil {
+		d.reset()
+		return nil, apdu.SwInternalError
+	}
+
+	var challenge *big.Int
+	if d.ctx.useExternalChallenge {
+		challenge = frostcore.ScalarFromBytes(d.ctx.externalChallenge[:])
+	} else {
+		challenge = frostcore.PurposeChallenge(d.nv.purpose, groupCommitment, d.nv.groupKey[:], msg)
+	}
+
+	lambda, err := frostcore.Lagrange(d.nv.identifier, ids)
+	if err != nil {
+		d.reset()
+		return nil, apdu.SwInternalError
+	}
+
+	z := frostcore.PartialSig(
+		frostcore.ScalarFromBytes(d.ctx.hidingNonce[:]),
+		frostcore.ScalarFromBytes(d.ctx.bindingNonce[:]),
+		myRho,
+		frostcore.ScalarFromBytes(d.nv.secret[:]),
+		challenge,
+		lambda,
+	)
+	if d.DebugTrace {
+		d.recordTrace(list, rhos, groupCommitment, challenge, lambda, z)
+	}
+
+	// Nonces are single use
+	d.reset()
+
+	// The counter is committed before the signature leaves the device
+	if d.Counter {
+		d.nv.counter++
+	}
+
+	return frostcore.ScalarBytes(z), apdu.SwOK
+}
+
+// recordTrace keeps the public intermediates of a PARTIAL_SIGN as
+// GET_DEBUG_TRACE responses, before the signing context is cleared.
+func (d *Device) recordTrace(list []frostcore.Commitment, rhos []*big.Int, r []byte, c, lambda, z *big.Int) {
+	summary := append([]byte(nil), d.ctx.messageHash[:]...)
+	summary = append(summary, r...)
+	for _, x := range []*big.Int{c, lambda, z} {
+		summary = append(summary, frostcore.ScalarBytes(x)...)
+	}
+	var flags byte
+	if d.ctx.useExternalChallenge {
+		flags |= 0x01
+	}
+	summary = append(summary, byte(d.nv.identifier>>8), byte(d.nv.identifier), byte(len(list)), flags)
+
+	d.trace = [][]byte{summary}
+	for i := range list {
+		entry := frostcore.EncodeCommitments(list[i : i+1])
+		entry = append(entry, frostcore.ScalarBytes(rhos[i])...)
+		term, err := frostcore.DeviceGroupCommitment(list[i:i+1], rhos[i:i+1])
+		if err != nil {
+			term = make([]byte, frostcore.PointSize)
+		}
+		d.trace = append(d.trace, append(entry, term...))
+	}
+}
+
+func (d *Device) handleGetDebugTrace(p1 byte) ([]byte, uint16) {
+	if d.trace == nil {
+		return nil, apdu.SwConditionsNotSat
+	}
+	if int(p1) >= len(d.trace) {
+		return nil, apdu.SwWrongP1P2
+	}
+	return append([]byte(nil), d.trace[p1]...), apdu.SwOK
+}
+
+func (d *Device) handleInjectChallenge(data []byte) uint16 {
+	if !d.nv.initialized {
+		return apdu.SwConditionsNotSat
+	}
+	if d.ctx.state != StateCommitmentsSet {
+		return apdu.SwConditionsNotSat
+	}
+	// An injected challenge would bypass the purpose tag
+	if d.nv.purpose != "" {
+		return apdu.SwConditionsNotSat
+	}
+	if len(data) != frostcore.ScalarSize {
+		return apdu.SwWrongLength
+	}
+	copy(d.ctx.externalChallenge[:], data)
+	d.ctx.useExternalChallenge = true
+	d.ctx.state = StateChallengeSet
+	return apdu.SwOK
+}
+
+func (d *Device) handleGetCounter(slot byte) ([]byte, uint16) {
+	if slot != 0 {
+		return nil, apdu.SwWrongP1P2
+	}
+	if !d.nv.initialized {
+		return nil, apdu.SwConditionsNotSat
+	}
+	resp := []byte{byte(d.nv.counter >> 24), byte(d.nv.counter >> 16), byte(d.nv.counter >> 8), byte(d.nv.counter)}
+	return append(resp, d.nv.groupKey[:]...), apdu.SwOK
+}
+
+func (d *Device) handleReset() uint16 {
+	d.reset()
+	return apdu.SwOK
+}
+
+// Transport adapts the device to apdu.Transport.
+func (d *Device) Transport() apdu.Transport {
+	return deviceTransport{d}
+}
+
+type deviceTransport struct {
+	d *Device
+}
+
+func (t deviceTransport) Exchange(command []byte) ([]byte, error) {
+	return t.d.Exchange(command), nil
+}
+
+func (t deviceTransport) Close() error {
+	return nil
+}
@@ -0,0 +1,478 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime/pprof"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"keygen/apdu"
+	"keygen/coordinator"
+	"keygen/frostcore"
+	"keygen/groupstate"
+	"keygen/secret"
+	"keygen/simdevice"
+	"keygen/soak"
+)
+
+// SoakReport is the output of soak.
+type SoakReport struct {
+	Duration   string            `json:"duration"`
+	Sessions   uint64            `json:"sessions"` // Signing sessions completed
+	Failed     uint64            `json:"failed"`
+	Samples    []soak.Sample     `json:"samples"` // Samples taken after warm-up
+	Violations []soak.Violation  `json:"violations,omitempty"`
+	Queues     []apdu.QueueStats `json:"queues,omitempty"` // With -device-slots, participant i+1's at i
+	Pass       bool              `json:"pass"`
+}
+
+// runSoak runs signing sessions through an in-process coordinator against
+// simulated devices until the duration elapses (or it is interrupted),
+// sampling goroutines, heap and open file descriptors every interval. It
+// fails if any session fails or a resource keeps growing after warm-up, which
+// is how the coordinator and device server are qualified for long-running
+// deployments:
+//
+//	keygen soak -duration 4h -interval 1m -warmup 10m -tcp -profile-dir prof/
+func runSoak(args []string) {
+	cmd := flag.NewFlagSet("soak", flag.ExitOnError)
+	duration := cmd.Duration("duration", time.Hour, "How long to run")
+	interval := cmd.Duration("interval", time.Minute, "Time between samples")
+	warmup := cmd.Duration("warmup", 10*time.Minute, "Samples taken before this are not checked")
+	threshold := cmd.Int("t", 2, "Signing threshold")
+	total := cmd.Int("n", 3, "Participants")
+	concurrency := cmd.Int("concurrency", 4, "Sessions run at once, each worker with its own devices")
+	slots := cmd.Int("device-slots", 0, "Share the devices between the workers, queued, with this many instances per participant (1 behaves as a physical device)")
+	retention := cmd.Duration("retention", time.Minute, "Forget finished sessions after this long (0 keeps them, and fails the soak)")
+	useTCP := cmd.Bool("tcp", false, "Reach the devices over the Speculos APDU protocol on loopback, one connection per session")
+	profileDir := cmd.String("profile-dir", "", "Write a heap profile per sample to this directory (heap-N.pprof)")
+	limits := soak.DefaultLimits
+	cmd.IntVar(&limits.Window, "window", limits.Window, "Samples in the baseline and final windows")
+	cmd.IntVar(&limits.Goroutines, "max-goroutines", limits.Goroutines, "Allowed goroutine growth")
+	cmd.Float64Var(&limits.HeapGrowth, "max-heap-growth", limits.HeapGrowth, "Allowed heap growth, as a fraction of the baseline")
+	cmd.IntVar(&limits.FDs, "max-fds", limits.FDs, "Allowed open file descriptor growth")
+	stdioFlags(cmd)
+	cmd.Parse(args)
+
+	if *threshold < 2 || *threshold > *total || *total > apdu.MaxParticipants {
+		fail(KindInput, "Error: need 2 <= t <= n <= %d", apdu.MaxParticipants)
+	}
+	if *concurrency < 1 || *interval <= 0 || *slots < 0 {
+		fail(KindInput, "Error: -concurrency and -interval must be positive, -device-slots not negative")
+	}
+	if *profileDir != "" {
+		if err := os.MkdirAll(*profileDir, 0o700); err != nil {
+			fail(KindFailure, "Error creating profile directory: %v", err)
+		}
+	}
+
+	groupKey, shares, doc, err := newTestGroup(*threshold, *total)
+	if err != nil {
+		fail(KindFailure, "Error generating key: %v", err)
+	}
+
+	c := coordinator.New()
+	c.AddGroup(doc)
+	c.SetSessionRetention(*retention)
+
+	ctx, stop := secret.NotifyContext(context.Background())
+	defer stop()
+	ctx, cancel := context.WithTimeout(ctx, *duration)
+	defer cancel()
+
+	var farm *soakFarm
+	if *slots > 0 {
+		if farm, err = newSoakFarm(groupKey, shares, *useTCP, *slots); err != nil {
+			fail(KindFailure, "Error starting devices: %v", err)
+		}
+		defer farm.close()
+	}
+
+	var done, failed atomic.Uint64
+	var wg sync.WaitGroup
+	for w := 0; w < *concurrency; w++ {
+		sign := func(k int) error { return farm.sign(ctx, c, doc, k, fmt.Sprintf("worker-%d", w)) }
+		if farm == nil {
+			devices, err := newSoakDevices(groupKey, shares, *useTCP, nil)
+			if err != nil {
+				fail(KindFailure, "Error starting devices: %v", err)
+			}
+			defer devices.close()
+			sign = func(k int) error { return devices.sign(ctx, c, doc, k) }
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for k := w; ctx.Err() == nil; k += *concurrency {
+				if err := sign(k); err != nil {
+					if ctx.Err() != nil {
+						return // Interrupted mid-session
+					}
+					if failed.Add(1) <= 10 {
+						fmt.Fprintf(os.Stderr, "Session failed: %v\n", err)
+					}
+					continue
+				}
+				done.Add(1)
+			}
+		}()
+	}
+
+	start := time.Now()
+	report := SoakReport{Duration: duration.String()}
+	ticker := time.NewTicker(*interval)
+	defer ticker.Stop()
+	for n := 0; ; n++ {
+		select {
+		case <-ctx.Done():
+		case <-ticker.C:
+			s := soak.Take()
+			s.Sessions = c.SessionCount()
+			phase := "warm-up"
+			if time.Since(start) >= *warmup {
+				phase = "sample"
+				report.Samples = append(report.Samples, s)
+			}
+			fmt.Fprintf(os.Stderr, "[%s] %s: %d sessions run, %d failed, %d held, %d goroutines, %d KiB heap, %d fds\n",
+				time.Since(start).Round(time.Second), phase, done.Load(), failed.Load(), s.Sessions, s.Goroutines, s.HeapInuse/1024, s.FDs)
+			if farm != nil {
+				fmt.Fprintf(os.Stderr, "  device queues: %s\n", farm.depths())
+			}
+			if *profileDir != "" {
+				if err := writeHeapProfile(filepath.Join(*profileDir, fmt.Sprintf("heap-%d.pprof", n))); err != nil {
+					fail(KindFailure, "Error writing heap profile: %v", err)
+				}
+			}
+			continue
+		}
+		break
+	}
+	wg.Wait()
+
+	report.Duration = time.Since(start).Round(time.Second).String()
+	report.Sessions, report.Failed = done.Load(), failed.Load()
+	if farm != nil {
+		for _, q := range farm.queues {
+			report.Queues = append(report.Queues, q.Stats())
+		}
+	}
+	violations, err := soak.Check(report.Samples, limits)
+	if err != nil {
+		fail(KindFailure, "Error: %v (%d after warm-up, need %d); run longer or sample more often",
+			err, len(report.Samples), 2*limits.Window)
+	}
+	report.Violations = violations
+	report.Pass = len(violations) == 0 && report.Failed == 0 && report.Sessions > 0
+	writeJSON(report)
+
+	for _, v := range violations {
+		fmt.Fprintf(os.Stderr, "Leak: %s\n", v)
+	}
+	if !report.Pass {
+		fail(KindFailure, "Soak failed: %d sessions, %d failed, %d resources grew", report.Sessions, report.Failed, len(violations))
+	}
+	fmt.Fprintf(os.Stderr, "Soak passed: %d sessions in %s\n", report.Sessions, report.Duration)
+}
+
+func writeHeapProfile(path string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	if err := pprof.WriteHeapProfile(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// newTestGroup deals a random t-of-n key, returning the group key, the
+// shares of participants 1 to n and the group's state document.
+func newTestGroup(t, n int) ([]byte, []*big.Int, *groupstate.Document, error) {
+	secret, err := frostcore.RandomScalar(rand.Reader)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	shares, err := frostcore.Split(secret, t, n, rand.Reader)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	groupKey := frostcore.BasePoint(secret)
+	secret.SetInt64(0)
+	doc := &groupstate.Document{GroupKey: hex.EncodeToString(groupKey), Threshold: t, Total: n}
+	for _, s := range shares {
+		doc.PublicShares = append(doc.PublicShares, hex.EncodeToString(frostcore.BasePoint(s)))
+	}
+	return groupKey, shares, doc, nil
+}
+
+// soakDevices are one worker's simulated participants, device i holding
+// participant i+1's share.
+type soakDevices struct {
+	devices   []*simdevice.Device
+	listeners []net.Listener // With -tcp, one per device
+}
+
+// newSoakDevices injects the shares into new devices. approve, if not nil,
+// decides participant id's prompts after its keys are injected; the devices
+// approve everything otherwise.
+func newSoakDevices(groupKey []byte, shares []*big.Int, useTCP bool, approve func(id int, p simdevice.Prompt) bool) (*soakDevices, error) {
+	ds := &soakDevices{}
+	for i, share := range shares {
+		dev := simdevice.New()
+		if _, err := soakExchange(dev.Transport(), injectKeysAPDU(groupKey, uint16(i+1), share, "")); err != nil {
+			return nil, fmt.Errorf("participant %d: %w", i+1, err)
+		}
+		if approve != nil {
+			id := i + 1
+			dev.Approve = func(p simdevice.Prompt) bool { return approve(id, p) }
+		}
+		ds.devices = append(ds.devices, dev)
+		if !useTCP {
+			continue
+		}
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			ds.close()
+			return nil, err
+		}
+		ds.listeners = append(ds.listeners, l)
+		go simdevice.Serve(l, dev)
+	}
+	return ds, nil
+}
+
+func (ds *soakDevices) close() {
+	for _, l := range ds.listeners {
+		l.Close()
+	}
+}
+
+// open returns a transport to participant id's device: a new connection with
+// -tcp, so that connection handling is part of the soak.
+func (ds *soakDevices) open(id int) (apdu.Transport, error) {
+	if len(ds.listeners) == 0 {
+		return ds.devices[id-1].Transport(), nil
+	}
+	return apdu.DialSpeculos(ds.listeners[id-1].Addr().String(), 5*time.Second)
+}
+
+// soakFarm is the devices the workers share with -device-slots: slots
+// instances of each participant's device, each participant's reached
+// through its own queue so that no two sessions use an instance at once.
+type soakFarm struct {
+	instances []*soakDevices // By slot
+	queues    []*apdu.Queue  // Participant i+1's at i
+}
+
+func newSoakFarm(groupKey []byte, shares []*big.Int, useTCP bool, slots int) (*soakFarm, error) {
+	f := &soakFarm{}
+	for range slots {
+		ds, err := newSoakDevices(groupKey, shares, useTCP, nil)
+		if err != nil {
+			f.close()
+			return nil, err
+		}
+		f.instances = append(f.instances, ds)
+	}
+	for range shares {
+		f.queues = append(f.queues, apdu.NewQueue(slots))
+	}
+	return f, nil
+}
+
+func (f *soakFarm) close() {
+	for _, q := range f.queues {
+		q.Close()
+	}
+	for _, ds := range f.instances {
+		ds.close()
+	}
+}
+
+// sign runs session k as soakDevices.sign does, holding a lease on each
+// signer's device for the whole session. Leases are taken in participant
+// order, so sessions waiting on each other's devices cannot deadlock.
+// Sessions of one worker share a queue turn.
+func (f *soakFarm) sign(ctx context.Context, c coordinator.Handler, doc *groupstate.Document, k int, worker string) error {
+	signers := soakSigners(doc, k)
+	slices.Sort(signers)
+	slot := make(map[int]int, len(signers))
+	for _, id := range signers {
+		lease, err := f.queues[id-1].Acquire(ctx, worker)
+		if err != nil {
+			return fmt.Errorf("participant %d: %w", id, err)
+		}
+		defer lease.Release()
+		slot[id] = lease.Slot
+	}
+	return soakSign(ctx, c, doc, k, func(id int) (apdu.Transport, error) {
+		return f.instances[slot[id]].open(id)
+	})
+}
+
+// depths describes each participant's queue: jobs waiting now, and the most
+// that ever waited.
+func (f *soakFarm) depths() string {
+	var b strings.Builder
+	for i, q := range f.queues {
+		s := q.Stats()
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		fmt.Fprintf(&b, "%d: %d/%d busy, %d waiting (max %d)", i+1, s.Busy, s.Slots, s.Waiting, s.MaxDepth)
+	}
+	return b.String()
+}
+
+// sign runs session k: t signers, rotating through the participants, sign a
+// random message through the coordinator.
+func (ds *soakDevices) sign(ctx context.Context, c coordinator.Handler, doc *groupstate.Document, k int) error {
+	return soakSign(ctx, c, doc, k, ds.open)
+}
+
+// soakSigners returns the signers of session k.
+func soakSigners(doc *groupstate.Document, k int) []int {
+	signers := make([]int, doc.Threshold)
+	for j := range signers {
+		signers[j] = (k+j)%doc.Total + 1
+	}
+	return signers
+}
+
+// soakSign runs session k with the devices open returns.
+func soakSign(ctx context.Context, c coordinator.Handler, doc *groupstate.Document, k int, open func(id int) (apdu.Transport, error)) error {
+	signers := soakSigners(doc, k)
+	msg := make([]byte, 32)
+	rand.Read(msg)
+
+	transports := make(map[int]apdu.Transport, len(signers))
+	defer func() {
+		for _, t := range transports {
+			t.Close()
+		}
+	}()
+	for _, id := range signers {
+		t, err := open(id)
+		if err != nil {
+			return fmt.Errorf("participant %d: %w", id, err)
+		}
+		transports[id] = t
+	}
+
+	s, err := soakRequest(ctx, c, coordinator.OpCreateSession, "", coordinator.CreateSessionParams{
+		GroupKey:    doc.GroupKey,
+		MessageHash: hex.EncodeToString(msg),
+		Signers:     signers,
+	})
+	if err != nil {
+		return err
+	}
+	for _, id := range signers {
+		data, err := soakExchange(transports[id], apdu.Command(apdu.InsCommit, 0, 0, nil))
+		if err != nil {
+			return fmt.Errorf("session %s: participant %d: %w", s.ID, id, err)
+		}
+		if len(data) != 2*frostcore.PointSize {
+			return fmt.Errorf("session %s: participant %d: COMMIT returned %d bytes", s.ID, id, len(data))
+		}
+		if s, err = soakRequest(ctx, c, coordinator.OpSubmitCommitment, s.ID, coordinator.CommitmentParams{
+			ID:            id,
+			HidingCommit:  hex.EncodeToString(data[:frostcore.PointSize]),
+			BindingCommit: hex.EncodeToString(data[frostcore.PointSize:]),
+		}); err != nil {
+			return err
+		}
+	}
+
+	list := frostcore.EncodeCommitments(s.CommitmentList())
+	for _, id := range signers {
+		t := transports[id]
+		z, err := soakExchange(t, apdu.Command(apdu.InsInjectMessage, 0, 0, msg))
+		if err == nil {
+			err = apdu.SendCommitments(t, list, 0)
+		}
+		if err == nil {
+			z, err = soakPartialSign(ctx, t)
+		}
+		if err != nil {
+			// A cancelled PARTIAL_SIGN has already reset the device
+			var cancelled *apdu.CancelledError
+			if !errors.As(err, &cancelled) {
+				soakExchange(t, apdu.Command(apdu.InsReset, 0, 0, nil))
+			}
+			return fmt.Errorf("session %s: participant %d: %w", s.ID, id, err)
+		}
+		if s, err = soakRequest(ctx, c, coordinator.OpSubmitPartial, s.ID, coordinator.PartialParams{
+			ID:         id,
+			PartialSig: hex.EncodeToString(z),
+		}); err != nil {
+			return err
+		}
+	}
+
+	if s.State != coordinator.StateComplete || s.Result == nil || !s.Result.Valid {
+		return fmt.Errorf("session %s: ended in state %s without a valid signature: %s", s.ID, s.State, s.Error)
+	}
+	return nil
+}
+
+// soakRequest sends one coordinator request and returns the session it
+// answers with.
+func soakRequest(ctx context.Context, c coordinator.Handler, op, sessionID string, params any) (*coordinator.Session, error) {
+	body, err := json.Marshal(params)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.Handle(ctx, &coordinator.Request{Op: op, SessionID: sessionID, Body: body})
+	if err != nil {
+		return nil, fmt.Errorf("%s %s: %w", op, sessionID, err)
+	}
+	s, ok := resp.Body.(*coordinator.Session)
+	if !ok {
+		return nil, errors.New(op + ": response is not a session")
+	}
+	return s, nil
+}
+
+// soakPartialSign sends PARTIAL_SIGN, cancelled when the soak is interrupted.
+func soakPartialSign(ctx context.Context, t apdu.Transport) ([]byte, error) {
+	c := &apdu.Cancellable{Transport: t, Grace: 5 * time.Second}
+	resp, err := c.ExchangeContext(ctx, apdu.Command(apdu.InsPartialSign, 0, 0, nil))
+	if err != nil {
+		return nil, err
+	}
+	data, sw := apdu.SplitResponse(resp)
+	if sw != apdu.SwOK {
+		return nil, fmt.Errorf("PARTIAL_SIGN: %s", apdu.ExplainStatus(sw, apdu.InsPartialSign))
+	}
+	return data, nil
+}
+
+// soakExchange sends one APDU and returns the response data, or an error for
+// any status word but 9000.
+func soakExchange(t apdu.Transport, command []byte) ([]byte, error) {
+	resp, err := t.Exchange(command)
+	if err != nil {
+		return nil, err
+	}
+	data, sw := apdu.SplitResponse(resp)
+	if sw != apdu.SwOK {
+		return nil, fmt.Errorf("%s: %s", apdu.InsName(command[1]), apdu.ExplainStatus(sw, command[1]))
+	}
+	return data, nil
+}
@@ -0,0 +1,119 @@
+// Package soak samples a process's resources (goroutines, heap, open file
+// descriptors) over a long run and decides whether they grow without bound.
+//
+// A leak shows up as a level that keeps rising long after warm-up, not as a
+// spike: Check compares the highest level seen in a baseline window with the
+// lowest level seen in the final window, so garbage that has not been
+// collected yet and sessions that happen to be in flight at sampling time do
+// not count as growth.
+package soak
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+	"time"
+)
+
+// Sample is one measurement.
+type Sample struct {
+	Time        time.Time `json:"time"`
+	Goroutines  int       `json:"goroutines"`
+	HeapInuse   uint64    `json:"heap_inuse"` // Bytes in in-use heap spans, after a GC
+	HeapObjects uint64    `json:"heap_objects"`
+	FDs         int       `json:"fds"`                // Open file descriptors; -1 where they cannot be counted
+	Sessions    int       `json:"sessions,omitempty"` // Sessions the coordinator holds, set by the caller
+}
+
+// Take measures the current process. It runs a garbage collection first so
+// the heap figures are live data.
+func Take() Sample {
+	runtime.GC()
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	return Sample{
+		Time:        time.Now().UTC(),
+		Goroutines:  runtime.NumGoroutine(),
+		HeapInuse:   m.HeapInuse,
+		HeapObjects: m.HeapObjects,
+		FDs:         openFDs(),
+	}
+}
+
+// openFDs counts the entries of /proc/self/fd (Linux) or /dev/fd (macOS,
+// BSD), less the descriptor used to read the directory.
+func openFDs() int {
+	for _, dir := range []string{"/proc/self/fd", "/dev/fd"} {
+		entries, err := os.ReadDir(dir)
+		if err == nil {
+			return len(entries) - 1
+		}
+	}
+	return -1
+}
+
+// Limits bound how much each resource may grow between the baseline and the
+// final window.
+type Limits struct {
+	Window     int     // Samples in the baseline and in the final window
+	Goroutines int     // Extra goroutines
+	HeapGrowth float64 // Growth of heap in use, as a fraction of the baseline
+	FDs        int     // Extra open file descriptors
+	Sessions   int     // Extra sessions held by the coordinator
+}
+
+// DefaultLimits tolerate a few goroutines and descriptors of jitter and a
+// quarter more heap.
+var DefaultLimits = Limits{Window: 5, Goroutines: 10, HeapGrowth: 0.25, FDs: 5, Sessions: 0}
+
+// Violation is a resource that grew past its limit.
+type Violation struct {
+	Resource string  `json:"resource"` // goroutines, heap_inuse, fds or sessions
+	Baseline float64 `json:"baseline"` // Highest level in the baseline window
+	Final    float64 `json:"final"`    // Lowest level in the final window
+	Limit    float64 `json:"limit"`    // Highest final level allowed
+}
+
+func (v Violation) String() string {
+	return fmt.Sprintf("%s grew from %.0f to %.0f (limit %.0f)", v.Resource, v.Baseline, v.Final, v.Limit)
+}
+
+// ErrTooFewSamples is returned by Check when the samples do not fill a
+// baseline and a final window.
+var ErrTooFewSamples = errors.New("too few samples for a baseline and a final window")
+
+// Check compares samples taken after warm-up against l. Resources a sample
+// could not measure (FDs of -1) are skipped.
+func Check(samples []Sample, l Limits) ([]Violation, error) {
+	if l.Window < 1 || len(samples) < 2*l.Window {
+		return nil, ErrTooFewSamples
+	}
+	base, final := samples[:l.Window], samples[len(samples)-l.Window:]
+
+	var out []Violation
+	check := func(resource string, value func(Sample) float64, limit func(baseline float64) float64) {
+		b, f := value(base[0]), value(final[0])
+		for _, s := range base[1:] {
+			b = max(b, value(s))
+		}
+		for _, s := range final[1:] {
+			f = min(f, value(s))
+		}
+		if b < 0 || f < 0 {
+			return
+		}
+		if lim := limit(b); f > lim {
+			out = append(out, Violation{Resource: resource, Baseline: b, Final: f, Limit: lim})
+		}
+	}
+	check("goroutines", func(s Sample) float64 { return float64(s.Goroutines) },
+		func(b float64) float64 { return b + float64(l.Goroutines) })
+	check("heap_inuse", func(s Sample) float64 { return float64(s.HeapInuse) },
+		func(b float64) float64 { return b * (1 + l.HeapGrowth) })
+	check("fds", func(s Sample) float64 { return float64(s.FDs) },
+		func(b float64) float64 { return b + float64(l.FDs) })
+	check("sessions", func(s Sample) float64 { return float64(s.Sessions) },
+		func(b float64) float64 { return b + float64(l.Sessions) })
+	return out, nil
+}
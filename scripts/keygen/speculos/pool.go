@@ -0,0 +1,332 @@
+// Package speculos manages a pool of Speculos emulators for parallel test
+// jobs: it spawns the instances on their own APDU ports, health-checks them
+// and leases them to workers one at a time, restarting any that fail.
+package speculos
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"keygen/apdu"
+)
+
+// DefaultImage is the Speculos container image used in Docker mode.
+const DefaultImage = "ghcr.io/ledgerhq/speculos:latest"
+
+// Config describes the instances of a pool.
+type Config struct {
+	ELF   string // App binary
+	Model string // Device model, e.g. "nanosp"
+	Size  int    // Number of instances
+
+	// BasePort is the first APDU port; instance i listens on BasePort+i
+	// and, outside Docker, serves its REST API on BasePort+Size+i. 0 picks
+	// free ports.
+	BasePort int
+
+	// Docker runs each instance in a container of Image instead of running
+	// the speculos binary directly.
+	Docker bool
+	Image  string
+
+	StartTimeout time.Duration // Time for an instance to become healthy
+	LogDir       string        // Emulator output goes to LogDir/speculos-<port>.log; empty discards it
+}
+
+// Instance is one emulator. Addr is its APDU address while leased.
+type Instance struct {
+	Addr string
+	ID   int
+
+	port    int
+	apiPort int
+	cmd     *exec.Cmd // Guarded by the pool's mu, as restarts replace it
+	log     *os.File
+}
+
+// Pool leases emulators to workers.
+type Pool struct {
+	cfg       Config
+	available chan *Instance
+
+	mu     sync.Mutex
+	all    []*Instance
+	closed bool
+}
+
+// Start launches cfg.Size instances and waits until they are all healthy.
+func Start(ctx context.Context, cfg Config) (*Pool, error) {
+	if cfg.Size < 1 {
+		return nil, fmt.Errorf("pool size must be at least 1")
+	}
+	if _, err := os.Stat(cfg.ELF); err != nil {
+		return nil, fmt.Errorf("app binary: %w", err)
+	}
+	if cfg.Model == "" {
+		cfg.Model = "nanosp"
+	}
+	if cfg.Image == "" {
+		cfg.Image = DefaultImage
+	}
+	if cfg.StartTimeout == 0 {
+		cfg.StartTimeout = 60 * time.Second
+	}
+
+	p := &Pool{cfg: cfg, available: make(chan *Instance, cfg.Size)}
+	for i := 0; i < cfg.Size; i++ {
+		inst := &Instance{ID: i}
+		if cfg.BasePort != 0 {
+			inst.port = cfg.BasePort + i
+			inst.apiPort = cfg.BasePort + cfg.Size + i
+		}
+		p.all = append(p.all, inst)
+		if err := p.launch(ctx, inst); err != nil {
+			p.Close()
+			return nil, fmt.Errorf("instance %d: %w", i, err)
+		}
+		p.available <- inst
+	}
+	return p, nil
+}
+
+// Acquire leases a healthy instance, waiting until one is free. The caller
+// must Release it.
+func (p *Pool) Acquire(ctx context.Context) (*Instance, error) {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case inst, ok := <-p.available:
+			if !ok {
+				return nil, errors.New("pool closed")
+			}
+			if err := Healthy(inst.Addr, 2*time.Second); err != nil {
+				// Replace it and hand out the next free one meanwhile
+				go p.restartAndReturn(inst)
+				continue
+			}
+			return inst, nil
+		}
+	}
+}
+
+// Release returns an instance to the pool. Its signing state is reset so the
+// next worker starts from IDLE; an instance that does not respond is
+// restarted first.
+func (p *Pool) Release(inst *Instance) {
+	go func() {
+		if err := reset(inst.Addr); err != nil {
+			p.restartAndReturn(inst)
+			return
+		}
+		p.put(inst)
+	}()
+}
+
+// Instances returns the addresses of all instances, leased or not.
+func (p *Pool) Instances() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	addrs := make([]string, len(p.all))
+	for i, inst := range p.all {
+		addrs[i] = inst.Addr
+	}
+	return addrs
+}
+
+// Close stops every instance.
+func (p *Pool) Close() error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil
+	}
+	p.closed = true
+	close(p.available)
+	all := p.all
+	p.mu.Unlock()
+
+	for _, inst := range all {
+		p.stop(inst)
+	}
+	return nil
+}
+
+// put makes inst available again, or stops it if the pool has closed
+// meanwhile.
+func (p *Pool) put(inst *Instance) {
+	p.mu.Lock()
+	closed := p.closed
+	if !closed {
+		p.available <- inst
+	}
+	p.mu.Unlock()
+	if closed {
+		p.stop(inst)
+	}
+}
+
+func (p *Pool) restartAndReturn(inst *Instance) {
+	p.stop(inst)
+	ctx, cancel := context.WithTimeout(context.Background(), p.cfg.StartTimeout)
+	defer cancel()
+	if err := p.launch(ctx, inst); err != nil {
+		// Leave it out of the pool; the remaining instances keep serving
+		fmt.Fprintf(os.Stderr, "speculos: instance %d failed to restart: %v\n", inst.ID, err)
+		return
+	}
+	p.put(inst)
+}
+
+// launch starts the emulator for inst and waits for it to answer
+// GET_VERSION.
+func (p *Pool) launch(ctx context.Context, inst *Instance) error {
+	port, apiPort := inst.port, inst.apiPort
+	if port == 0 {
+		var err error
+		if port, err = freePort(); err != nil {
+			return err
+		}
+		if apiPort, err = freePort(); err != nil {
+			return err
+		}
+	}
+	p.mu.Lock()
+	inst.Addr = net.JoinHostPort("127.0.0.1", strconv.Itoa(port))
+	p.mu.Unlock()
+
+	elf, err := filepath.Abs(p.cfg.ELF)
+	if err != nil {
+		return err
+	}
+	var cmd *exec.Cmd
+	if p.cfg.Docker {
+		cmd = exec.Command("docker", "run", "--rm",
+			"--name", containerName(inst.Addr),
+			"-v", filepath.Dir(elf)+":/app",
+			"-p", fmt.Sprintf("127.0.0.1:%d:9999", port),
+			p.cfg.Image,
+			"--model", p.cfg.Model,
+			"--display", "headless",
+			"--apdu-port", "9999",
+			"/app/"+filepath.Base(elf))
+	} else {
+		cmd = exec.Command("speculos",
+			"--model", p.cfg.Model,
+			"--display", "headless",
+			"--apdu-port", strconv.Itoa(port),
+			"--api-port", strconv.Itoa(apiPort),
+			elf)
+	}
+	var log *os.File
+	if p.cfg.LogDir != "" {
+		if log, err = os.Create(filepath.Join(p.cfg.LogDir, fmt.Sprintf("speculos-%d.log", port))); err != nil {
+			return err
+		}
+		cmd.Stdout, cmd.Stderr = log, log
+	}
+	// Started under the lock, so Close either sees the process or keeps it
+	// from starting
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		if log != nil {
+			log.Close()
+		}
+		return errors.New("pool closed")
+	}
+	inst.cmd, inst.log = cmd, log
+	err = cmd.Start()
+	p.mu.Unlock()
+	if err != nil {
+		p.stop(inst)
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, p.cfg.StartTimeout)
+	defer cancel()
+	for {
+		if err := Healthy(inst.Addr, time.Second); err == nil {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			p.stop(inst)
+			return fmt.Errorf("not healthy after %s", p.cfg.StartTimeout)
+		case <-time.After(500 * time.Millisecond):
+		}
+	}
+}
+
+// stop kills inst's emulator, if running. Close and restarts may call it
+// concurrently; only one of them gets the process.
+func (p *Pool) stop(inst *Instance) {
+	p.mu.Lock()
+	cmd, log, addr := inst.cmd, inst.log, inst.Addr
+	inst.cmd, inst.log = nil, nil
+	p.mu.Unlock()
+
+	if cmd != nil && cmd.Process != nil {
+		if p.cfg.Docker {
+			// Killing the docker client does not stop the container
+			exec.Command("docker", "rm", "-f", containerName(addr)).Run()
+		}
+		cmd.Process.Kill()
+		cmd.Wait()
+	}
+	if log != nil {
+		log.Close()
+	}
+}
+
+// Healthy checks that addr answers GET_VERSION with 9000.
+func Healthy(addr string, timeout time.Duration) error {
+	t, err := apdu.DialSpeculos(addr, timeout)
+	if err != nil {
+		return err
+	}
+	defer t.Close()
+	t.SetDeadline(time.Now().Add(timeout))
+	_, err = apdu.GetVersion(t)
+	return err
+}
+
+// reset clears the app's signing state so a lease starts clean.
+func reset(addr string) error {
+	t, err := apdu.DialSpeculos(addr, 2*time.Second)
+	if err != nil {
+		return err
+	}
+	defer t.Close()
+	t.SetDeadline(time.Now().Add(2 * time.Second))
+	resp, err := t.Exchange(apdu.Command(apdu.InsReset, 0, 0, nil))
+	if err != nil {
+		return err
+	}
+	if _, sw := apdu.SplitResponse(resp); sw != apdu.SwOK {
+		return fmt.Errorf("RESET: %s", apdu.ExplainStatus(sw, apdu.InsReset))
+	}
+	return nil
+}
+
+func freePort() (int, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, err
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port, nil
+}
+
+func containerName(addr string) string {
+	_, port, _ := net.SplitHostPort(addr)
+	return "fy-speculos-" + port
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"keygen/diag"
+	"keygen/secret"
+	"keygen/speculos"
+)
+
+// LeaseOutput is returned by POST /acquire.
+type LeaseOutput struct {
+	ID   int    `json:"id"`
+	Addr string `json:"addr"` // APDU address for apdu send -addr
+}
+
+// runSpeculosPool starts a pool of emulators and leases them to test workers
+// over HTTP until interrupted:
+//
+//	POST /acquire[?wait=30s]   lease a free instance (503 if none frees up in time)
+//	POST /release?id=N         return it; the app state is reset
+//	GET  /instances            list all instance addresses
+//
+// A lease not released within leaseTTL is reclaimed, so a crashed worker
+// cannot hold an instance forever.
+func runSpeculosPool(cfg speculos.Config, listen string, leaseTTL time.Duration, debugListen string) {
+	ctx, stop := secret.NotifyContext(context.Background())
+	defer stop()
+
+	var mu sync.Mutex
+	leases := make(map[int]*speculos.Instance)
+	timers := make(map[int]*time.Timer)
+	serveDebug(debugListen, map[string]diag.Source{
+		"pool": func() any {
+			mu.Lock()
+			defer mu.Unlock()
+			return map[string]int{"instances": cfg.Size, "leased": len(leases)}
+		},
+	})
+
+	fmt.Fprintf(os.Stderr, "Starting %d Speculos instances...\n", cfg.Size)
+	pool, err := speculos.Start(ctx, cfg)
+	if err != nil {
+		fail(KindFailure, "Error starting pool: %v", err)
+	}
+	defer pool.Close()
+
+	release := func(id int) bool {
+		mu.Lock()
+		inst, ok := leases[id]
+		if ok {
+			delete(leases, id)
+			timers[id].Stop()
+			delete(timers, id)
+		}
+		mu.Unlock()
+		if ok {
+			pool.Release(inst)
+		}
+		return ok
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /acquire", func(w http.ResponseWriter, r *http.Request) {
+		wait := 30 * time.Second
+		if s := r.URL.Query().Get("wait"); s != "" {
+			d, err := time.ParseDuration(s)
+			if err != nil {
+				http.Error(w, "invalid wait", http.StatusBadRequest)
+				return
+			}
+			wait = d
+		}
+		actx, cancel := context.WithTimeout(r.Context(), wait)
+		defer cancel()
+		inst, err := pool.Acquire(actx)
+		if err != nil {
+			http.Error(w, "no instance available: "+err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		mu.Lock()
+		leases[inst.ID] = inst
+		id := inst.ID
+		timers[id] = time.AfterFunc(leaseTTL, func() {
+			if release(id) {
+				fmt.Fprintf(os.Stderr, "Reclaimed instance %d after %s\n", id, leaseTTL)
+			}
+		})
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(LeaseOutput{ID: inst.ID, Addr: inst.Addr})
+	})
+	mux.HandleFunc("POST /release", func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.Atoi(r.URL.Query().Get("id"))
+		if err != nil {
+			http.Error(w, "invalid id", http.StatusBadRequest)
+			return
+		}
+		if !release(id) {
+			http.Error(w, "instance not leased", http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("GET /instances", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(pool.Instances())
+	})
+
+	srv := &http.Server{Addr: listen, Handler: mux}
+	go func() {
+		<-ctx.Done()
+		srv.Close()
+	}()
+	fmt.Fprintf(os.Stderr, "Pool ready: %v\nLeasing on http://%s\n", pool.Instances(), listen)
+	if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		pool.Close()
+		fail(KindFailure, "Error: %v", err)
+	}
+}
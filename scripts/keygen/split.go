@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+
+	"keygen/frostcore"
+	"keygen/secret"
+)
+
+// runSplit splits an existing Baby Jubjub private key into FROST shares with
+// a trusted dealer, so a single-key wallet keeps its public key under
+// threshold custody. The output has the same form as keygen.
+func runSplit(skHex string, threshold, total int, seedHex string, out *shareOutput) {
+	if skHex == "" {
+		// Keep the key out of the process list and shell history
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && line == "" {
+			fail(KindInput, "Error reading key from stdin: %v", err)
+		}
+		skHex = line
+	}
+	sk, err := hex.DecodeString(strings.TrimPrefix(strings.TrimSpace(skHex), "0x"))
+	if err != nil || len(sk) != frostcore.ScalarSize {
+		fail(KindInput, "Error: -sk: expected %d bytes of hex", frostcore.ScalarSize)
+	}
+	key := frostcore.ScalarFromBytes(sk)
+	secret.Wipe(sk)
+	defer secret.WipeInt(key)
+	if key.Cmp(frostcore.Order) >= 0 {
+		fail(KindInput, "Error: -sk is not reduced mod the subgroup order (is it a raw private key rather than its scalar?)")
+	}
+
+	shares, err := frostcore.Split(key, threshold, total, randomSource(seedHex, "split"))
+	if err != nil {
+		fail(KindInput, "Error: %v", err)
+	}
+
+	// Any threshold subset must give back the key
+	subset := make(map[uint16]*big.Int, threshold)
+	for i := 0; i < threshold; i++ {
+		subset[uint16(i+1)] = shares[i]
+	}
+	if got, err := frostcore.Interpolate(subset); err != nil || got.Cmp(key) != 0 {
+		fail(KindCrypto, "Error: shares do not interpolate to the key")
+	}
+
+	groupKey := hex.EncodeToString(frostcore.BasePoint(key))
+	output := KeyGenOutput{
+		Threshold: threshold,
+		Total:     total,
+		Seed:      seedHex,
+		Shares:    make([]KeyShareOutput, total),
+	}
+	for i, s := range shares {
+		output.Shares[i] = KeyShareOutput{
+			Participant: i + 1,
+			GroupKey:    groupKey,
+			ID:          hex.EncodeToString(frostcore.IDBytes(uint16(i + 1))),
+			PublicShare: hex.EncodeToString(frostcore.BasePoint(s)),
+			Threshold:   threshold,
+			Total:       total,
+		}
+		output.Shares[i].SecretShare = mustSecret(secret.FromInt(s))
+	}
+	fmt.Fprintf(os.Stderr, "Split key with public key %s into %d-of-%d shares; destroy the original key once the shares are in custody\n", groupKey, threshold, total)
+	out.write(output.Shares)
+	writeJSON(output)
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"keygen/keystore"
+	"keygen/schema"
+	"keygen/secret"
+	"keygen/workspace"
+)
+
+// StandbyCopy describes a standby copy written by standby designate.
+type StandbyCopy struct {
+	Participant int    `json:"participant"`
+	GroupKey    string `json:"group_key"`
+	Standby     string `json:"standby"` // The standby's ID, to name in the failover
+	File        string `json:"file"`
+}
+
+// runStandby implements the standby subcommands:
+//
+//	standby designate -share f [-standby id] [-out-dir d]    write an encrypted copy of a share for a standby signer
+//	standby activate -copy f [-state f] [-out-dir d]         open the copy once the group has signed a failover to it
+//
+// A participant designates a standby by giving it a copy of its share,
+// encrypted under the standby's own passphrase. The copy does not open like
+// a share file: activate opens it only when the group-state document holds
+// a failover of the participant to that standby, signed by the group
+// (group-state action -op failover). The activated share is written as an
+// ordinary share file, so the standby then signs like any participant.
+//
+// The failover gates keygen, not the copy: the standby's passphrase
+// decrypts it without one, so a standby must be trusted with the share.
+func runStandby(args []string, ws *workspace.Context) {
+	if len(args) < 1 {
+		fail(KindUsage, "Usage: keygen standby <designate|activate> [options]")
+	}
+	cmd := flag.NewFlagSet("standby "+args[0], flag.ExitOnError)
+	stdioFlags(cmd)
+	switch args[0] {
+	case "designate":
+		sharePath := cmd.String("share", "", "Share file of the participant (required)")
+		passFile := cmd.String("passphrase-file", "", "Passphrase of an encrypted -share (default: prompt)")
+		id := cmd.Int("id", 0, "Participant, for share files holding several")
+		standbyPassFile := cmd.String("standby-passphrase-file", "", "Passphrase to encrypt the copy under, the standby's (default: prompt)")
+		standby := cmd.String("standby", "", "ID of the standby (default: random)")
+		outDir := cmd.String("out-dir", ".", "Write the copy to participant-<id>.standby-<standby>.json here")
+		cmd.Parse(args[1:])
+		if *sharePath == "" || cmd.NArg() != 0 {
+			fail(KindUsage, "Usage: keygen standby designate -share f [-standby id] [-out-dir d]")
+		}
+		if *standby == "" {
+			var b [8]byte
+			rand.Read(b[:])
+			*standby = hex.EncodeToString(b[:])
+		}
+		if !validStandbyID(*standby) {
+			fail(KindUsage, "Error: -standby: use letters, digits, '-' and '_' only")
+		}
+
+		share := loadSigningShare(*sharePath, *passFile, *id)
+		defer share.SecretShare.Destroy()
+		path := filepath.Join(*outDir, fmt.Sprintf("participant-%d.standby-%s.json", share.Participant, *standby))
+		if _, err := os.Lstat(path); err == nil {
+			fail(KindInput, "Error: %s already exists", path)
+		}
+		fmt.Fprintf(os.Stderr, "Choose the passphrase of standby %s\n", *standby)
+		passphrase := loadPassphrases(*standbyPassFile, 0, true)(share.Participant)
+		plaintext, _ := json.Marshal(share)
+		f, err := keystore.SealStandby(plaintext, share.Participant, share.GroupKey, share.PublicShare, share.Purpose, *standby, passphrase)
+		secret.Wipe(plaintext)
+		if err != nil {
+			fail(KindFailure, "Error encrypting the copy: %v", err)
+		}
+		data, _ := jsonOutput(f)
+		if err := os.MkdirAll(*outDir, 0700); err != nil {
+			fail(KindFailure, "Error creating %s: %v", *outDir, err)
+		}
+		writeNewFile(path, data, 0600)
+		fmt.Fprintf(os.Stderr, "Wrote %s; give it to the standby\n", path)
+		writeJSON(StandbyCopy{Participant: share.Participant, GroupKey: share.GroupKey, Standby: *standby, File: path})
+
+	case "activate":
+		copyPath := cmd.String("copy", "", "Standby copy written by standby designate (required)")
+		copyPassFile := cmd.String("copy-passphrase-file", "", "Passphrase of the copy (default: prompt)")
+		statePath := cmd.String("state", ws.GroupState, "Group-state document holding the failover")
+		passFile := cmd.String("passphrase-file", "", "Passphrase for the activated share file (default: prompt)")
+		outDir := cmd.String("out-dir", ".", "Write the activated share to participant-<id>.share.json here")
+		cmd.Parse(args[1:])
+		if *copyPath == "" || *statePath == "" || cmd.NArg() != 0 {
+			fail(KindUsage, "Usage: keygen standby activate -copy f -state group-state.json [-out-dir d]")
+		}
+
+		data, err := os.ReadFile(*copyPath)
+		if err != nil {
+			fail(KindInput, "Error reading %s: %v", *copyPath, err)
+		}
+		var f keystore.File
+		if err := schema.Unmarshal(data, &f, *copyPath); err != nil {
+			fail(KindInput, "Error: %s: %v", *copyPath, err)
+		}
+		if f.Standby == "" {
+			fail(KindInput, "Error: %s is not a standby copy", *copyPath)
+		}
+		doc := loadGroupState(*statePath)
+		if doc.GroupKey != f.GroupKey || f.Participant < 1 || f.Participant > len(doc.PublicShares) || doc.PublicShares[f.Participant-1] != f.PublicShare {
+			fail(KindInput, "Error: %s is not a copy of a share of group %s", *copyPath, doc.GroupKey)
+		}
+		failover, err := doc.Failover(f.Participant)
+		if err != nil {
+			fail(KindCrypto, "Error: %s: %v", *statePath, err)
+		}
+		if failover == nil {
+			fail(KindInput, "Error: %s holds no failover of participant %d; the group signs one with group-state action -op failover", *statePath, f.Participant)
+		}
+		if failover.Standby != f.Standby {
+			fail(KindInput, "Error: participant %d failed over to standby %s, not %s", f.Participant, failover.Standby, f.Standby)
+		}
+
+		shareFile := shareFilePath(*outDir, f.Participant)
+		if _, err := os.Lstat(shareFile); err == nil {
+			fail(KindInput, "Error: %s already exists", shareFile)
+		}
+		plaintext, err := f.OpenStandby(loadPassphrases(*copyPassFile, 0, false)(f.Participant))
+		if err != nil {
+			fail(KindCrypto, "Error: %s: %v", *copyPath, err)
+		}
+		var share KeyShareOutput
+		err = schema.Unmarshal(plaintext, &share, *copyPath)
+		secret.Wipe(plaintext)
+		if err != nil {
+			fail(KindInput, "Error: %s: %v", *copyPath, err)
+		}
+		if share.Participant != f.Participant || share.GroupKey != f.GroupKey || share.PublicShare != f.PublicShare || share.Purpose != f.Purpose {
+			fail(KindCrypto, "Error: %s: encrypted share does not match its header", *copyPath)
+		}
+		fmt.Fprintf(os.Stderr, "Failover of participant %d to standby %s (sequence %d) verified\n", f.Participant, f.Standby, failover.Sequence)
+		writeEncryptedShares(*outDir, *passFile, []KeyShareOutput{share})
+		fmt.Fprintf(os.Stderr, "This standby now signs as participant %d; retire the primary's share\n", f.Participant)
+
+	default:
+		fail(KindUsage, "Unknown standby command: %s", args[0])
+	}
+}
+
+// validStandbyID reports whether id can name a standby, and its copy's file.
+func validStandbyID(id string) bool {
+	if len(id) > 64 {
+		return false
+	}
+	for _, c := range id {
+		if !('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || c == '-' || c == '_') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"flag"
+	"os"
+)
+
+// stdinName names stdin in input errors and warnings: "stdin", or the file
+// given with -in.
+var stdinName = "stdin"
+
+// stdioFlags adds -in and -out to a command, so scripts can name its input
+// and output files instead of redirecting. "-" means stdin or stdout. Both
+// take effect as they are parsed, replacing os.Stdin and os.Stdout, so
+// commands need no changes to honour them.
+func stdioFlags(fs *flag.FlagSet) {
+	fs.Func("in", "Read input from this file instead of stdin (- for stdin)", redirectStdin)
+	fs.Func("out", "Write output to this file instead of stdout (- for stdout; new files get mode 0600)", redirectStdout)
+}
+
+func redirectStdin(path string) error {
+	if path == "-" {
+		return nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	os.Stdin, stdinName = f, path
+	return nil
+}
+
+// redirectStdout truncates path. New files are mode 0600, since some output
+// (-insecure-stdout) holds secrets.
+func redirectStdout(path string) error {
+	if path == "-" {
+		return nil
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	os.Stdout = f
+	return nil
+}
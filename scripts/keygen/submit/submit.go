@@ -0,0 +1,213 @@
+// Package submit delivers an aggregated signature to where it is used: an
+// EVM contract, a REST webhook, a drop directory or a message queue. Each
+// delivery is retried, then tracked until its target confirms it, and its
+// progress is kept as a Delivery that the signing session records.
+package submit
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"keygen/clock"
+)
+
+// Signature is what a target delivers, as JSON for all but EVM targets.
+type Signature struct {
+	Ciphersuite string `json:"ciphersuite,omitempty"`
+	Session     string `json:"session,omitempty"` // Name of the signing session, if any
+	GroupKey    string `json:"group_key"`
+	MessageHash string `json:"message_hash"`
+	Purpose     string `json:"purpose,omitempty"`
+	R           string `json:"R"`
+	Z           string `json:"z"`
+}
+
+// Target is one place a signature is delivered to.
+type Target interface {
+	// Submit delivers sig once and returns a reference to the delivery:
+	// a transaction hash, an HTTP status, a file path or a queue length.
+	// An error wrapping ErrPermanent is not retried.
+	Submit(ctx context.Context, sig *Signature) (ref string, err error)
+
+	// Confirm reports whether the delivery with ref is final. Targets
+	// that accept a delivery for good when they acknowledge it confirm
+	// at once. An error wrapping ErrPermanent fails the delivery.
+	Confirm(ctx context.Context, ref string) (bool, error)
+}
+
+// ErrPermanent marks a failure that retrying cannot fix, such as a
+// rejected request or a reverted transaction.
+var ErrPermanent = errors.New("permanent failure")
+
+// Delivery states
+const (
+	StatePending   = "pending"   // Not submitted yet
+	StateSubmitted = "submitted" // Accepted, not yet confirmed
+	StateConfirmed = "confirmed"
+	StateFailed    = "failed"
+)
+
+// Delivery is the progress of a signature's delivery to one target.
+type Delivery struct {
+	Target    string     `json:"target"` // The target's spec (see Parse)
+	State     string     `json:"state"`
+	Attempts  int        `json:"attempts"`            // Submissions tried
+	Reference string     `json:"reference,omitempty"` // What the accepting submission returned
+	Error     string     `json:"error,omitempty"`     // Of the last attempt or confirmation check
+	Submitted *time.Time `json:"submitted,omitempty"`
+	Confirmed *time.Time `json:"confirmed,omitempty"`
+}
+
+// Policy is how hard Deliver tries.
+type Policy struct {
+	Attempts       int           // Submissions before giving up; 0 is 3
+	Backoff        time.Duration // Wait before the second attempt, doubling after; 0 is 2s
+	ConfirmTimeout time.Duration // How long to wait for confirmation; 0 is 2m
+	PollInterval   time.Duration // Between confirmation checks; 0 is 2s
+	Clock          clock.Clock   // nil is clock.Real
+}
+
+// Deliver submits sig to t, retrying as p allows, and waits for t to
+// confirm it. d is the delivery so far, e.g. as a session recorded it: a
+// confirmed delivery is left alone, and a submitted one is only tracked,
+// not submitted again, so a transaction is never sent twice. progress, if
+// not nil, is called with d after each change, so the caller can record a
+// submission before waiting for its confirmation. A delivery still
+// unconfirmed when ConfirmTimeout passes stays submitted, for a later
+// Deliver to go on tracking.
+func Deliver(ctx context.Context, t Target, sig *Signature, d *Delivery, p Policy, progress func(*Delivery)) {
+	c := clock.Or(p.Clock)
+	if progress == nil {
+		progress = func(*Delivery) {}
+	}
+	if d.State == "" {
+		d.State = StatePending
+	}
+	if d.State == StateConfirmed {
+		return
+	}
+
+	if d.State != StateSubmitted {
+		backoff := cmp.Or(p.Backoff, 2*time.Second)
+		for attempt := 0; attempt < cmp.Or(p.Attempts, 3); attempt++ {
+			if attempt > 0 && !sleep(ctx, c, backoff) {
+				break
+			}
+			backoff *= 2
+			ref, err := t.Submit(ctx, sig)
+			d.Attempts++
+			if err == nil {
+				now := c.Now().UTC()
+				d.State, d.Reference, d.Error, d.Submitted = StateSubmitted, ref, "", &now
+				break
+			}
+			d.Error = err.Error()
+			if errors.Is(err, ErrPermanent) {
+				break
+			}
+			progress(d)
+		}
+		if d.State != StateSubmitted {
+			d.State = StateFailed
+			progress(d)
+			return
+		}
+		progress(d)
+	}
+
+	deadline := c.Now().Add(cmp.Or(p.ConfirmTimeout, 2*time.Minute))
+	for {
+		ok, err := t.Confirm(ctx, d.Reference)
+		switch {
+		case errors.Is(err, ErrPermanent):
+			d.State, d.Error = StateFailed, err.Error()
+			progress(d)
+			return
+		case err != nil:
+			d.Error = err.Error()
+		case ok:
+			now := c.Now().UTC()
+			d.State, d.Error, d.Confirmed = StateConfirmed, "", &now
+			progress(d)
+			return
+		}
+		if !c.Now().Before(deadline) || !sleep(ctx, c, cmp.Or(p.PollInterval, 2*time.Second)) {
+			if d.Error == "" {
+				d.Error = "not confirmed yet"
+			}
+			progress(d)
+			return
+		}
+	}
+}
+
+// sleep waits for d, or returns false if ctx is done first.
+func sleep(ctx context.Context, c clock.Clock, d time.Duration) bool {
+	t := c.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C():
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// Options holds what Parse needs besides a spec.
+type Options struct {
+	// Calldata encodes sig as a call to function with the named encoding
+	// (as export calldata takes them), for EVM targets.
+	Calldata func(sig *Signature, function, encoding string) ([]byte, error)
+
+	// WebhookToken, if set, is sent to webhooks as a bearer token, and
+	// QueuePassword to Redis with AUTH, so that specs, which sessions
+	// record, hold no credentials.
+	WebhookToken  string
+	QueuePassword string
+}
+
+// Parse returns the target a spec names:
+//
+//	https://host/path                    POST the signature as JSON (http:// too)
+//	file:///dir                          write it to dir as <session or message hash>.json
+//	redis://host:6379/key                RPUSH it onto a Redis list
+//	evm+https://rpc?to=0x…&from=0x…      send it to a contract with eth_sendTransaction
+//
+// EVM targets take function (default verify), encoding (compressed or
+// affine; default compressed) and confirmations (default 1) in the query.
+func Parse(spec string, o Options) (Target, error) {
+	u, err := url.Parse(spec)
+	if err != nil {
+		return nil, fmt.Errorf("target %q: %w", spec, err)
+	}
+	if u.User != nil {
+		return nil, fmt.Errorf("target %s: a session records its targets, so pass credentials in the environment", u.Redacted())
+	}
+	switch u.Scheme {
+	case "http", "https":
+		return &Webhook{URL: spec, Token: o.WebhookToken}, nil
+	case "file":
+		dir := u.Path
+		if dir == "" {
+			dir = u.Opaque
+		}
+		if dir == "" {
+			return nil, fmt.Errorf("target %s: no directory", spec)
+		}
+		return &FileDrop{Dir: dir}, nil
+	case "redis":
+		key := strings.TrimPrefix(u.Path, "/")
+		if u.Host == "" || key == "" {
+			return nil, fmt.Errorf("target %s: expected redis://host:port/key", spec)
+		}
+		return &Queue{Addr: u.Host, Key: key, Password: o.QueuePassword}, nil
+	case "evm+http", "evm+https":
+		return parseEVM(u, o)
+	}
+	return nil, fmt.Errorf("target %s: unknown scheme %q (https, file, redis or evm+https)", spec, u.Scheme)
+}
@@ -0,0 +1,251 @@
+package submit
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"keygen/evm"
+)
+
+// Webhook POSTs the signature as JSON. A 2xx response accepts it for good;
+// other 4xx responses than 408 and 429 are permanent failures. The
+// Idempotency-Key header is the message hash, so a receiver can drop the
+// duplicates a retry after a lost response sends.
+type Webhook struct {
+	URL    string
+	Token  string       // Bearer token, if set
+	Client *http.Client // nil is a client with a 30s timeout
+}
+
+func (w *Webhook) Submit(ctx context.Context, sig *Signature) (string, error) {
+	body, _ := json.Marshal(sig)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrPermanent, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Idempotency-Key", sig.MessageHash)
+	if w.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+w.Token)
+	}
+	client := w.Client
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	switch code := resp.StatusCode; {
+	case code >= 200 && code < 300:
+		return "HTTP " + strconv.Itoa(code), nil
+	case code >= 400 && code < 500 && code != http.StatusRequestTimeout && code != http.StatusTooManyRequests:
+		return "", fmt.Errorf("%w: webhook returned %s: %s", ErrPermanent, resp.Status, bytes.TrimSpace(msg))
+	default:
+		return "", fmt.Errorf("webhook returned %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+}
+
+func (w *Webhook) Confirm(context.Context, string) (bool, error) { return true, nil }
+
+// FileDrop writes the signature as JSON to a directory another process
+// watches, as <session>.json, or <message hash>.json outside a session. The
+// file is renamed into place, so a watcher never reads half of it. A file
+// already there with another signature is a permanent failure.
+type FileDrop struct {
+	Dir string
+}
+
+func (f *FileDrop) Submit(_ context.Context, sig *Signature) (string, error) {
+	name := sig.Session
+	if name == "" {
+		name = sig.MessageHash
+	}
+	data, _ := json.MarshalIndent(sig, "", "  ")
+	data = append(data, '\n')
+	path := filepath.Join(f.Dir, name+".json")
+	if prev, err := os.ReadFile(path); err == nil {
+		if !bytes.Equal(prev, data) {
+			return "", fmt.Errorf("%w: %s already holds another signature", ErrPermanent, path)
+		}
+		return path, nil
+	}
+	if err := os.MkdirAll(f.Dir, 0755); err != nil {
+		return "", err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return "", err
+	}
+	return path, nil
+}
+
+func (f *FileDrop) Confirm(context.Context, string) (bool, error) { return true, nil }
+
+// Queue pushes the signature as JSON onto a Redis list with RPUSH, for a
+// consumer that pops it. The reply, the list's new length, accepts it.
+type Queue struct {
+	Addr     string // host:port
+	Key      string
+	Password string // Sent with AUTH, if set
+}
+
+func (q *Queue) Submit(ctx context.Context, sig *Signature) (string, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", q.Addr)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	} else {
+		conn.SetDeadline(time.Now().Add(30 * time.Second))
+	}
+	r := bufio.NewReader(conn)
+	if q.Password != "" {
+		if _, err := redisCommand(conn, r, "AUTH", q.Password); err != nil {
+			return "", fmt.Errorf("%w: redis AUTH: %v", ErrPermanent, err)
+		}
+	}
+	body, _ := json.Marshal(sig)
+	n, err := redisCommand(conn, r, "RPUSH", q.Key, string(body))
+	if err != nil {
+		return "", fmt.Errorf("redis RPUSH: %w", err)
+	}
+	return "length " + n, nil
+}
+
+func (q *Queue) Confirm(context.Context, string) (bool, error) { return true, nil }
+
+// redisCommand sends a command in RESP and returns its simple or integer
+// reply. An error reply is a permanent failure.
+func redisCommand(w io.Writer, r *bufio.Reader, args ...string) (string, error) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, a := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(a), a)
+	}
+	if _, err := io.WriteString(w, b.String()); err != nil {
+		return "", err
+	}
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	line = strings.TrimRight(line, "\r\n")
+	if line == "" {
+		return "", errors.New("empty reply")
+	}
+	switch line[0] {
+	case '+', ':':
+		return line[1:], nil
+	case '-':
+		return "", fmt.Errorf("%w: %s", ErrPermanent, line[1:])
+	}
+	return "", fmt.Errorf("unexpected reply %q", line)
+}
+
+var evmAddress = regexp.MustCompile(`^0x[0-9a-fA-F]{40}$`)
+
+// EVM sends the signature to a contract in a transaction from an account
+// the endpoint signs for, and confirms it once it is mined, succeeded and
+// has Confirmations blocks. A reverted transaction is a permanent failure.
+type EVM struct {
+	Client        *evm.Client
+	From, To      string
+	Function      string
+	Encoding      string
+	Confirmations uint64
+	Calldata      func(sig *Signature, function, encoding string) ([]byte, error)
+}
+
+func parseEVM(u *url.URL, o Options) (*EVM, error) {
+	q := u.Query()
+	t := &EVM{
+		From:          q.Get("from"),
+		To:            q.Get("to"),
+		Function:      cmp.Or(q.Get("function"), "verify"),
+		Encoding:      cmp.Or(q.Get("encoding"), "compressed"),
+		Confirmations: 1,
+		Calldata:      o.Calldata,
+	}
+	if !evmAddress.MatchString(t.To) || !evmAddress.MatchString(t.From) {
+		return nil, fmt.Errorf("target %s: needs to= and from= addresses", u)
+	}
+	if t.Encoding != "compressed" && t.Encoding != "affine" {
+		return nil, fmt.Errorf("target %s: unknown encoding %q (compressed or affine)", u, t.Encoding)
+	}
+	if c := q.Get("confirmations"); c != "" {
+		n, err := strconv.ParseUint(c, 10, 64)
+		if err != nil || n == 0 {
+			return nil, fmt.Errorf("target %s: confirmations: expected a positive number", u)
+		}
+		t.Confirmations = n
+	}
+	if t.Calldata == nil {
+		return nil, fmt.Errorf("target %s: no calldata encoder", u)
+	}
+	rpc := *u
+	rpc.Scheme = strings.TrimPrefix(u.Scheme, "evm+")
+	for _, k := range []string{"from", "to", "function", "encoding", "confirmations"} {
+		q.Del(k)
+	}
+	rpc.RawQuery = q.Encode()
+	t.Client = &evm.Client{URL: rpc.String()}
+	return t, nil
+}
+
+func (t *EVM) Submit(ctx context.Context, sig *Signature) (string, error) {
+	data, err := t.Calldata(sig, t.Function, t.Encoding)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrPermanent, err)
+	}
+	msg := evm.CallMsg{From: t.From, To: t.To, Data: "0x" + hex.EncodeToString(data)}
+	// A call that would revert is not worth the gas
+	if _, err := t.Client.EstimateGas(ctx, msg); err != nil {
+		var rpcErr *evm.RPCError
+		if errors.As(err, &rpcErr) {
+			return "", fmt.Errorf("%w: %v", ErrPermanent, err)
+		}
+		return "", err
+	}
+	return t.Client.SendTransaction(ctx, msg)
+}
+
+func (t *EVM) Confirm(ctx context.Context, hash string) (bool, error) {
+	r, err := t.Client.TransactionReceipt(ctx, hash)
+	if err != nil || r == nil {
+		return false, err
+	}
+	if !r.Success {
+		return false, fmt.Errorf("%w: transaction %s reverted in block %d", ErrPermanent, hash, r.BlockNumber)
+	}
+	latest, err := t.Client.BlockNumber(ctx)
+	if err != nil {
+		return false, err
+	}
+	return latest+1 >= r.BlockNumber+t.Confirmations, nil
+}
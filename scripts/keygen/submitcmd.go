@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"time"
+
+	"keygen/evm"
+	"keygen/frostcore"
+	"keygen/signsession"
+	"keygen/submit"
+)
+
+// Credentials of submission targets, read from the environment so that
+// target specs, which sessions record, hold none.
+const (
+	webhookTokenEnv  = "FY_LEDGER_WEBHOOK_TOKEN"
+	queuePasswordEnv = "FY_LEDGER_REDIS_PASSWORD"
+)
+
+// submitConfig holds the -submit flags of aggregate and session submit.
+type submitConfig struct {
+	targets []string
+	policy  submit.Policy
+}
+
+// submitFlags adds -submit, -submit-attempts and -submit-timeout to a
+// command.
+func submitFlags(fs *flag.FlagSet) *submitConfig {
+	cfg := &submitConfig{}
+	fs.Func("submit", "Deliver the signature to this target: https://…, file:///dir, redis://host:port/key or evm+https://rpc?to=…&from=… (repeatable)", func(s string) error {
+		if _, err := submit.Parse(s, submitOptions()); err != nil {
+			return err
+		}
+		cfg.targets = append(cfg.targets, s)
+		return nil
+	})
+	fs.IntVar(&cfg.policy.Attempts, "submit-attempts", 3, "Submissions to each target before giving up")
+	fs.DurationVar(&cfg.policy.ConfirmTimeout, "submit-timeout", 2*time.Minute, "How long to wait for each target to confirm the signature")
+	return cfg
+}
+
+// submitOptions are the options of every target: calldata as export
+// calldata encodes it, and credentials from the environment.
+func submitOptions() submit.Options {
+	return submit.Options{
+		Calldata: func(sig *submit.Signature, function, encoding string) ([]byte, error) {
+			input := CircomHarnessInput{GroupKey: sig.GroupKey, MessageHash: sig.MessageHash, R: sig.R, Z: sig.Z}
+			fn, args, err := calldataArgs(encoding, calldataConfig{function: function}, &input)
+			if err != nil {
+				return nil, err
+			}
+			return evm.EncodeCall(fn, args...)
+		},
+		WebhookToken:  os.Getenv(webhookTokenEnv),
+		QueuePassword: os.Getenv(queuePasswordEnv),
+	}
+}
+
+// deliverSignature delivers sig to each target, going on from the
+// deliveries recorded so far, and returns them all, updated. save, if not
+// nil, is called after each change, to record the deliveries as they
+// progress.
+func deliverSignature(cfg *submitConfig, sig *submit.Signature, recorded []submit.Delivery, save func([]submit.Delivery)) []submit.Delivery {
+	deliveries := slices.Clone(recorded)
+	for _, spec := range cfg.targets {
+		t, err := submit.Parse(spec, submitOptions())
+		if err != nil {
+			fail(KindUsage, "Error: -submit: %v", err)
+		}
+		i := slices.IndexFunc(deliveries, func(d submit.Delivery) bool { return d.Target == spec })
+		if i < 0 {
+			deliveries = append(deliveries, submit.Delivery{Target: spec})
+			i = len(deliveries) - 1
+		}
+		d := &deliveries[i]
+		if d.State == submit.StateFailed {
+			d.State = submit.StatePending // Asked to try again
+		}
+		submit.Deliver(context.Background(), t, sig, d, cfg.policy, func(*submit.Delivery) {
+			if save != nil {
+				save(deliveries)
+			}
+		})
+		switch d.State {
+		case submit.StateConfirmed:
+			fmt.Fprintf(os.Stderr, "Delivered to %s (%s)\n", spec, d.Reference)
+		case submit.StateSubmitted:
+			fmt.Fprintf(os.Stderr, "Submitted to %s (%s), not confirmed yet: %s\n", spec, d.Reference, d.Error)
+		default:
+			fmt.Fprintf(os.Stderr, "Delivery to %s failed after %d attempts: %s\n", spec, d.Attempts, d.Error)
+		}
+	}
+	return deliveries
+}
+
+// unconfirmed counts the deliveries not confirmed yet.
+func unconfirmed(deliveries []submit.Delivery) int {
+	n := 0
+	for _, d := range deliveries {
+		if d.State != submit.StateConfirmed {
+			n++
+		}
+	}
+	return n
+}
+
+// runSessionSubmit delivers a session's signature: to the -submit targets,
+// or else again to the targets it recorded that have not confirmed it. It
+// prints the session with its deliveries.
+func runSessionSubmit(dir, name string, cfg *submitConfig) {
+	s := loadSession(dir, name)
+	if s.Result == nil || !s.Result.Valid {
+		fail(KindInput, "Error: session %s has no valid signature to submit (aggregate -session %s first)", name, name)
+	}
+	if len(cfg.targets) == 0 {
+		for _, d := range s.Deliveries {
+			if d.State != submit.StateConfirmed {
+				cfg.targets = append(cfg.targets, d.Target)
+			}
+		}
+		if len(cfg.targets) == 0 {
+			fail(KindUsage, "Error: session %s has no unconfirmed deliveries; give -submit targets", name)
+		}
+	}
+	sig := &submit.Signature{
+		Ciphersuite: frostcore.Suite.ID(),
+		Session:     s.Name,
+		GroupKey:    s.GroupKey,
+		MessageHash: s.MessageHash,
+		Purpose:     s.Purpose,
+		R:           s.Result.R,
+		Z:           s.Result.Z,
+	}
+	deliveries := deliverSignature(cfg, sig, s.Deliveries, func(ds []submit.Delivery) {
+		updateSession(dir, name, func(s *signsession.Session) error {
+			s.Deliveries = ds
+			return nil
+		})
+	})
+	s = updateSession(dir, name, func(s *signsession.Session) error {
+		s.Deliveries = deliveries
+		return nil
+	})
+	writeJSON(s)
+	if n := unconfirmed(deliveries); n > 0 {
+		fail(KindTransport, "Error: %d of %d targets have not confirmed the signature", n, len(deliveries))
+	}
+}
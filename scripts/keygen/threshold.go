@@ -0,0 +1,129 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"keygen/apdu"
+	"keygen/groupstate"
+)
+
+// runChangeThreshold changes a group's threshold and roster, e.g. from 2-of-3
+// to 3-of-5, keeping its public key. It runs all resharing roles at once from
+// the old shares given (at least t of them), so it needs every share on one
+// offline machine; distributed ceremonies use reshare-init, -contribute and
+// -finalize instead.
+//
+// The output directory receives the updated group-state document, a share
+// file per software participant and, per hardware participant, an APDU
+// script for apdu send that injects the share and checks the group key.
+func runChangeThreshold(statePath string, newT, newN int, hardware, outDir, seedHex string, files []string) {
+	doc := loadGroupState(statePath)
+	var hw []int
+	if hardware != "" {
+		var err error
+		if hw, err = parseIDList(hardware); err != nil {
+			fail(KindInput, "Error: -hardware: %v", err)
+		}
+		if hw[len(hw)-1] > newN {
+			fail(KindInput, "Error: -hardware: participant %d is not in the new %d-of-%d roster", hw[len(hw)-1], newT, newN)
+		}
+	}
+	if len(files) == 0 {
+		fail(KindUsage, "Usage: keygen change-threshold -t 3 -n 5 [-state f] [-hardware ids] [-out dir] <share.json>...")
+	}
+
+	shares := make(map[int]KeyShareOutput)
+	for _, path := range files {
+		for _, s := range readShares(path) {
+			shares[s.Participant] = s
+		}
+	}
+	var signers []int
+	for id := range shares {
+		signers = append(signers, id)
+	}
+	slices.Sort(signers)
+
+	session, err := newReshareSession(doc, signers, newT, newN)
+	if err != nil {
+		fail(KindInput, "Error: %v", err)
+	}
+	var old []*KeyShareOutput
+	for _, id := range signers {
+		share := shares[id]
+		old = append(old, &share)
+	}
+	out, err := reshareAll(session, old, randomSource(seedHex, "reshare"))
+	if err != nil {
+		fail(KindCrypto, "Error: %v", err)
+	}
+
+	// The document keeps its action sequence and history, so actions signed
+	// under the old roster cannot be replayed
+	next := *doc
+	next.Threshold = newT
+	next.Total = newN
+	next.PublicShares = out.PublicShares
+	next.Failovers = nil // Standby copies are of the old shares
+	next.Retired = nil   // Every ID of the new roster gets a new share
+
+	writeRosterFiles(outDir, &next, out.Shares, out.InjectAPDUs, hw, fmt.Sprintf("%d-of-%d", newT, newN))
+
+	fmt.Fprintf(os.Stderr, "Changed group %s from %d-of-%d to %d-of-%d (dealt by participants %v) in %s\n",
+		doc.GroupKey, doc.Threshold, doc.Total, newT, newN, signers, outDir)
+	if len(hw) > 0 {
+		fmt.Fprintf(os.Stderr, "Load hardware participants with: keygen apdu send < %s\n", filepath.Join(outDir, "participant-<id>.apdu"))
+	}
+	fmt.Fprintln(os.Stderr, "Old shares still sign for this key: destroy them, and every file here once it is delivered")
+}
+
+// writeRosterFiles writes a group-state document to outDir, and per share
+// either a share-<id>.json file or, for hardware participants, a
+// participant-<id>.apdu script that injects it (apdus, in the order of
+// shares) and checks the group key. kind describes the shares in scripts.
+func writeRosterFiles(outDir string, doc *groupstate.Document, shares []KeyShareOutput, apdus []string, hw []int, kind string) {
+	if err := os.MkdirAll(outDir, 0700); err != nil {
+		fail(KindFailure, "Error creating %s: %v", outDir, err)
+	}
+	stateJSON, _ := jsonOutput(doc)
+	writeNewFile(filepath.Join(outDir, "group-state.json"), stateJSON, 0644)
+	for i, s := range shares {
+		if slices.Contains(hw, s.Participant) {
+			writeInjectScript(outDir, &s, apdus[i], kind)
+			continue
+		}
+		shareJSON, _ := jsonOutput(s)
+		writeNewFile(filepath.Join(outDir, fmt.Sprintf("share-%d.json", s.Participant)), shareJSON, 0600)
+	}
+}
+
+// writeInjectScript writes participant-<id>.apdu (mode 0600) to dir: the
+// INJECT_KEYS command for share s and a check of the group key after it.
+func writeInjectScript(dir string, s *KeyShareOutput, inject, kind string) {
+	var script strings.Builder
+	fmt.Fprintf(&script, "# Participant %d: inject the %s share of group %s\n", s.Participant, kind, s.GroupKey)
+	fmt.Fprintf(&script, "%s\n", inject)
+	fmt.Fprintf(&script, "# The device must now report the unchanged group key\n")
+	fmt.Fprintf(&script, "%s => %s9000\n", hex.EncodeToString(apdu.Command(apdu.InsGetPublicKey, 0, 0, nil)), s.GroupKey)
+	writeNewFile(filepath.Join(dir, fmt.Sprintf("participant-%d.apdu", s.Participant)), []byte(script.String()), 0600)
+}
+
+// writeNewFile writes a file that must not exist yet, so a rerun never
+// overwrites shares that may already be in use.
+func writeNewFile(path string, data []byte, perm os.FileMode) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err == nil {
+		_, err = f.Write(data)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+	}
+	if err != nil {
+		fail(KindFailure, "Error writing %s: %v", path, err)
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"keygen/frostcore"
+	"keygen/schema"
+	"keygen/tsa"
+	"keygen/workspace"
+)
+
+// signatureDomain separates timestamped signature bundles from other SHA-256
+// digests sent to a TSA.
+const signatureDomain = "fy-ledger/signature/v1"
+
+// signatureImprint is the digest a TSA timestamps for a signature:
+// SHA-256(domain || group key || message hash || R || z), all raw bytes.
+func signatureImprint(out *AggregateOutput) ([]byte, error) {
+	h := sha256.New()
+	h.Write([]byte(signatureDomain))
+	for _, f := range []struct{ name, hex string }{
+		{"group_key", out.GroupKey},
+		{"message_hash", out.MessageHash},
+		{"R", out.R},
+		{"z", out.Z},
+	} {
+		b, err := hex.DecodeString(f.hex)
+		if err != nil || len(b) != 32 {
+			return nil, fmt.Errorf("%s: expected 32 bytes of hex", f.name)
+		}
+		h.Write(b)
+	}
+	return h.Sum(nil), nil
+}
+
+// timestampSignature obtains a token over the signature bundle.
+func timestampSignature(out *AggregateOutput, url string) error {
+	defer logStep("timestamped", "tsa", url)()
+	digest, err := signatureImprint(out)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	token, err := tsa.Request(ctx, url, digest)
+	if err != nil {
+		return err
+	}
+	out.Timestamp = token
+	return nil
+}
+
+// runTimestamp implements the timestamp subcommands on aggregate output
+// (with group_key and message_hash set):
+//
+//	timestamp add [-tsa url]            < bundle.json   (re-)timestamp a signature
+//	timestamp verify [-token-out file]  < bundle.json   check the signature and token
+//
+// verify checks that the token covers this signature; -token-out writes the
+// DER token for `openssl ts -verify`, which checks the TSA's signature.
+func runTimestamp(args []string, ws *workspace.Context) {
+	if len(args) < 1 {
+		fail(KindUsage, "Usage: keygen timestamp <add|verify> [options] < bundle.json")
+	}
+	cmd := flag.NewFlagSet("timestamp "+args[0], flag.ExitOnError)
+	tsaURL := cmd.String("tsa", ws.TSA, "RFC 3161 timestamping authority URL")
+	tokenOut := cmd.String("token-out", "", "Write the DER timestamp token to this file")
+	stdioFlags(cmd)
+	cmd.Parse(args[1:])
+
+	var bundle AggregateOutput
+	if err := schema.Decode(os.Stdin, &bundle, stdinName); err != nil {
+		fail(KindInput, "Error reading input: %v", err)
+	}
+
+	// Never timestamp or vouch for a signature that does not verify
+	groupKey := decodeHex("group_key", bundle.GroupKey)
+	msg := decodeHex("message_hash", bundle.MessageHash)
+	r := decodeHex("R", bundle.R)
+	z := decodeHex("z", bundle.Z)
+	valid, err := frostcore.VerifyPurpose(bundle.Purpose, groupKey, msg, r, z)
+	if err != nil || !valid {
+		fail(KindCrypto, "Error: signature does not verify (%v)", err)
+	}
+
+	switch args[0] {
+	case "add":
+		if *tsaURL == "" {
+			fail(KindInput, "Error: no TSA given (-tsa, or set one with ctx set -tsa)")
+		}
+		if err := timestampSignature(&bundle, *tsaURL); err != nil {
+			fail(KindTransport, "Error timestamping: %v", err)
+		}
+		fmt.Fprintf(os.Stderr, "Timestamped by %s at %s\n", *tsaURL, bundle.Timestamp.GenTime.Format(time.RFC3339))
+		writeJSON(bundle)
+
+	case "verify":
+		if bundle.Timestamp == nil {
+			fail(KindInput, "Error: bundle has no timestamp")
+		}
+		digest, err := signatureImprint(&bundle)
+		if err == nil {
+			err = bundle.Timestamp.Check(digest)
+		}
+		if err != nil {
+			fail(KindCrypto, "Error: %v", err)
+		}
+		if *tokenOut != "" {
+			if err := os.WriteFile(*tokenOut, bundle.Timestamp.DER, 0644); err != nil {
+				fail(KindFailure, "Error writing %s: %v", *tokenOut, err)
+			}
+		}
+		fmt.Printf("Signature existed at %s (TSA %s, serial %s)\n",
+			bundle.Timestamp.GenTime.Format(time.RFC3339), bundle.Timestamp.TSA, bundle.Timestamp.SerialNumber)
+		fmt.Printf("Check the TSA signature with: openssl ts -verify -digest %s -token_in -in <token> -CAfile <tsa-ca.pem>\n", bundle.Timestamp.Imprint)
+
+	default:
+		fail(KindUsage, "Unknown timestamp command: %s", args[0])
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"math/big"
+	"os"
+
+	"keygen/frostcore"
+)
+
+// TraceOutput is what sign and aggregate write to stderr with -trace: the
+// FROST intermediates of the session, computed with frostcore the way the
+// app computes them rather than by the fy library, so a partial signature
+// that differs between the Ledger and the host can be narrowed down to the
+// value that differs. It holds no secrets.
+type TraceOutput struct {
+	MessageHash     string             `json:"message_hash"`
+	GroupKey        string             `json:"group_key"`
+	CommitmentList  string             `json:"commitment_list"`  // Canonical list the binding factors hash
+	GroupCommitment string             `json:"group_commitment"` // R
+	Challenge       string             `json:"challenge"`        // c
+	Participants    []TraceParticipant `json:"participants"`     // In canonical order
+}
+
+// TraceParticipant is one participant's part of a TraceOutput.
+type TraceParticipant struct {
+	ID            int    `json:"id"`
+	BindingFactor string `json:"binding_factor"`        // rho_i
+	Lambda        string `json:"lambda"`                // lambda_i
+	Commitment    string `json:"commitment"`            // D_i + rho_i*E_i
+	PartialSig    string `json:"partial_sig,omitempty"` // z_i, where known
+}
+
+// writeTrace writes the TraceOutput of signing msg with the participants'
+// commitments, and the partial signatures known by ID, to stderr, with the
+// challenge of the purpose tag if one is given. It returns R as traced.
+func writeTrace(msg, groupKey []byte, participants []ParticipantInput, partials map[int]string, purpose string) []byte {
+	list, err := commitmentList(participants)
+	if err == nil {
+		list, err = frostcore.SortCommitments(list)
+	}
+	if err != nil {
+		fail(KindInput, "Error: trace: %v", err)
+	}
+	var challenge *big.Int // nil: untagged, computed from R
+	if purpose != "" {
+		challenge, err = frostcore.ListChallenge(purpose, msg, groupKey, list)
+	}
+	if err != nil {
+		fail(KindCrypto, "Error: trace: %v", err)
+	}
+	t, err := frostcore.NewTrace(msg, groupKey, list, challenge)
+	if err != nil {
+		fail(KindCrypto, "Error: trace: %v", err)
+	}
+
+	out := TraceOutput{
+		MessageHash:     hex.EncodeToString(msg),
+		GroupKey:        hex.EncodeToString(groupKey),
+		CommitmentList:  hex.EncodeToString(t.CommitmentList),
+		GroupCommitment: hex.EncodeToString(t.GroupCommitment),
+		Challenge:       hex.EncodeToString(frostcore.ScalarBytes(t.Challenge)),
+	}
+	for _, p := range t.Participants {
+		out.Participants = append(out.Participants, TraceParticipant{
+			ID:            int(p.ID),
+			BindingFactor: hex.EncodeToString(frostcore.ScalarBytes(p.BindingFactor)),
+			Lambda:        hex.EncodeToString(frostcore.ScalarBytes(p.Lambda)),
+			Commitment:    hex.EncodeToString(p.Commitment),
+			PartialSig:    partials[int(p.ID)],
+		})
+	}
+	enc := json.NewEncoder(os.Stderr)
+	enc.SetIndent("", "  ")
+	enc.Encode(out)
+	return t.GroupCommitment
+}
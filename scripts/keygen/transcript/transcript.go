@@ -0,0 +1,267 @@
+// Package transcript keeps a ceremony transcript: an append-only file of
+// JSON lines, one entry per event of a key generation or signing ceremony
+// (commands, inputs, outputs, device exchanges, DKG messages, coordinator
+// requests), each chained to the one before it by hash.
+//
+// An entry's hash covers its sequence number, time, kind, data and the hash
+// of the previous entry, so altering, removing or reordering any entry
+// breaks every hash after it, and Verify finds the first broken entry.
+// Truncating the end is only caught against a head hash kept elsewhere,
+// e.g. read out at the end of the ceremony or logged with translog.
+//
+// Several commands may append to one transcript, one after another or at
+// once: each append takes a lock file and picks up the entries the others
+// appended since.
+package transcript
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"keygen/clock"
+)
+
+// Entry is one line of a transcript.
+type Entry struct {
+	Seq  uint64          `json:"seq"` // From 1
+	Time time.Time       `json:"time"`
+	Kind string          `json:"kind"`
+	Data json.RawMessage `json:"data"`
+	Prev string          `json:"prev"` // Hash of the previous entry; zeros for the first
+	Hash string          `json:"hash"` // SHA-256, see Entry.Sum
+}
+
+// genesis is the Prev of the first entry.
+var genesis = hex.EncodeToString(make([]byte, sha256.Size))
+
+// Sum computes the entry's hash from its other fields.
+func (e *Entry) Sum() (string, error) {
+	prev, err := hex.DecodeString(e.Prev)
+	if err != nil || len(prev) != sha256.Size {
+		return "", errors.New("malformed prev")
+	}
+	var data bytes.Buffer
+	if err := json.Compact(&data, e.Data); err != nil {
+		return "", fmt.Errorf("data: %w", err)
+	}
+	h := sha256.New()
+	for _, part := range [][]byte{
+		[]byte("fy-ledger transcript v1"),
+		prev,
+		binary.BigEndian.AppendUint64(nil, e.Seq),
+		[]byte(e.Time.UTC().Format(time.RFC3339Nano)),
+		[]byte(e.Kind),
+		data.Bytes(),
+	} {
+		h.Write(binary.BigEndian.AppendUint32(nil, uint32(len(part))))
+		h.Write(part)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Log is a transcript open for appending.
+type Log struct {
+	// Clock dates new entries; nil is clock.Real.
+	Clock clock.Clock
+
+	mu     sync.Mutex
+	path   string
+	file   *os.File
+	offset int64  // Bytes read and verified so far
+	seq    uint64 // Of the last entry
+	head   string // Hash of the last entry
+}
+
+// Open opens or creates the transcript at path, verifying the entries it
+// already holds.
+func Open(path string) (*Log, error) {
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return nil, err
+		}
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	l := &Log{path: path, file: f, head: genesis}
+	if err := l.catchUp(); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
+// Close closes the transcript file.
+func (l *Log) Close() error {
+	return l.file.Close()
+}
+
+// Head returns the sequence number and hash of the last entry.
+func (l *Log) Head() (uint64, string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.seq, l.head
+}
+
+// Append adds an entry of the given kind with data marshalled as JSON, and
+// syncs it to disk.
+func (l *Log) Append(kind string, data any) (*Entry, error) {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	unlock, err := lock(l.path)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	if err := l.catchUp(); err != nil {
+		return nil, err
+	}
+
+	e := &Entry{Seq: l.seq + 1, Time: clock.Or(l.Clock).Now().UTC(), Kind: kind, Data: raw, Prev: l.head}
+	if e.Hash, err = e.Sum(); err != nil {
+		return nil, err
+	}
+	line, err := json.Marshal(e)
+	if err != nil {
+		return nil, err
+	}
+	line = append(line, '\n')
+	if _, err := l.file.WriteAt(line, l.offset); err != nil {
+		return nil, err
+	}
+	if err := l.file.Sync(); err != nil {
+		return nil, err
+	}
+	l.offset += int64(len(line))
+	l.seq, l.head = e.Seq, e.Hash
+	return e, nil
+}
+
+// catchUp verifies the entries appended since the last read, by this Log
+// or another, and moves the head past them.
+func (l *Log) catchUp() error {
+	r := bufio.NewReader(io.NewSectionReader(l.file, l.offset, 1<<62))
+	for {
+		line, err := r.ReadBytes('\n')
+		if err == io.EOF {
+			if len(line) > 0 {
+				return fmt.Errorf("transcript: %s: entry %d is incomplete", l.path, l.seq+1)
+			}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		e, err := check(line, l.seq, l.head)
+		if err != nil {
+			return fmt.Errorf("transcript: %s: %w", l.path, err)
+		}
+		l.offset += int64(len(line))
+		l.seq, l.head = e.Seq, e.Hash
+	}
+}
+
+// check decodes a line and checks it follows the entry seq with hash head.
+func check(line []byte, seq uint64, head string) (*Entry, error) {
+	var e Entry
+	if err := json.Unmarshal(line, &e); err != nil {
+		return nil, fmt.Errorf("entry %d: %w", seq+1, err)
+	}
+	if e.Seq != seq+1 {
+		return nil, fmt.Errorf("entry %d has sequence number %d", seq+1, e.Seq)
+	}
+	if e.Prev != head {
+		return nil, fmt.Errorf("entry %d does not chain to entry %d", e.Seq, seq)
+	}
+	sum, err := e.Sum()
+	if err != nil {
+		return nil, fmt.Errorf("entry %d: %w", e.Seq, err)
+	}
+	if sum != e.Hash {
+		return nil, fmt.Errorf("entry %d does not match its hash: altered", e.Seq)
+	}
+	return &e, nil
+}
+
+// Summary describes a verified transcript.
+type Summary struct {
+	Entries uint64         `json:"entries"`
+	Head    string         `json:"head"` // Hash of the last entry
+	First   time.Time      `json:"first,omitzero"`
+	Last    time.Time      `json:"last,omitzero"`
+	Kinds   map[string]int `json:"kinds"` // Entries per kind
+}
+
+// ErrBroken wraps the first entry of a transcript that fails verification.
+var ErrBroken = errors.New("transcript broken")
+
+// Verify reads a whole transcript and checks every entry's hash and link,
+// calling each, if set, on every verified entry. A broken chain is
+// ErrBroken, naming the first entry that fails.
+func Verify(r io.Reader, each func(*Entry)) (*Summary, error) {
+	s := &Summary{Head: genesis, Kinds: map[string]int{}}
+	br := bufio.NewReader(r)
+	for {
+		line, err := br.ReadBytes('\n')
+		if err == io.EOF && len(line) == 0 {
+			return s, nil
+		}
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		e, cerr := check(line, s.Entries, s.Head)
+		if cerr != nil {
+			return s, fmt.Errorf("%w: %w", ErrBroken, cerr)
+		}
+		if e.Time.Before(s.Last) {
+			return s, fmt.Errorf("%w: entry %d is timed before entry %d", ErrBroken, e.Seq, e.Seq-1)
+		}
+		if s.Entries == 0 {
+			s.First = e.Time
+		}
+		s.Entries, s.Head, s.Last = e.Seq, e.Hash, e.Time
+		s.Kinds[e.Kind]++
+		if each != nil {
+			each(e)
+		}
+	}
+}
+
+// lockWait is how long Append waits for another command's append.
+const lockWait = 10 * time.Second
+
+// lock takes the transcript's lock file, waiting up to lockWait for it.
+func lock(path string) (func(), error) {
+	path += ".lock"
+	deadline := time.Now().Add(lockWait)
+	for {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if err == nil {
+			f.Close()
+			return func() { os.Remove(path) }, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, err
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("transcript is locked by another command; remove %s if none is running", path)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
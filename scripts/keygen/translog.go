@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"keygen/diag"
+	"keygen/schema"
+	"keygen/secret"
+	"keygen/translog"
+	"keygen/workspace"
+)
+
+// anchorSuffix names the receipt written next to each submitted artifact.
+const anchorSuffix = ".anchor.json"
+
+// runTranslog implements the transparency log subcommands:
+//
+//	translog serve [-listen addr] [-dir dir]       run the append-only log
+//	translog submit [-log url] [-key hex] <file>...  log the files' SHA-256 hashes
+//	translog head [-log url] [-key hex]            print the log's signed tree head
+//
+// submit writes <file>.anchor.json, a receipt with the inclusion proof that
+// verify -bundle checks. serve takes -debug-listen to serve its diagnostics.
+func runTranslog(args []string, ws *workspace.Context) {
+	if len(args) < 1 {
+		fail(KindUsage, "Usage: keygen translog <serve|submit|head> [options]")
+	}
+	cmd := flag.NewFlagSet("translog "+args[0], flag.ExitOnError)
+	listen := cmd.String("listen", "127.0.0.1:9980", "Address to serve the log on")
+	dir := cmd.String("dir", "translog", "Log directory (entries and signing key)")
+	logURL := cmd.String("log", ws.TransLog, "Transparency log URL")
+	keyHex := cmd.String("key", "", "Expected log public key (hex); fetched from the log if empty")
+	debugListen := debugFlag(cmd)
+	stdioFlags(cmd)
+	cmd.Parse(args[1:])
+
+	switch args[0] {
+	case "serve":
+		runTranslogServe(*listen, *dir, *debugListen)
+		return
+	case "submit", "head":
+	default:
+		fail(KindUsage, "Unknown translog command: %s", args[0])
+	}
+
+	if *logURL == "" {
+		fail(KindInput, "Error: no log given (-log, or set one with ctx set -translog)")
+	}
+	client := &translog.Client{URL: *logURL}
+	if *keyHex != "" {
+		client.Key = parseLogKey(*keyHex)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	if args[0] == "head" {
+		head, err := client.Head(ctx)
+		if err != nil {
+			fail(KindTransport, "Error: %v", err)
+		}
+		writeJSON(head)
+		return
+	}
+
+	if cmd.NArg() == 0 {
+		fail(KindUsage, "Usage: keygen translog submit [-log url] [-key hex] <file>...")
+	}
+	for _, path := range cmd.Args() {
+		digest := fileDigest(path)
+		receipt, err := client.Submit(ctx, digest)
+		if err != nil {
+			fail(KindTransport, "Error logging %s: %v", path, err)
+		}
+		data, _ := json.MarshalIndent(receipt, "", "  ")
+		if err := os.WriteFile(path+anchorSuffix, append(data, '\n'), 0644); err != nil {
+			fail(KindFailure, "Error writing %s: %v", path+anchorSuffix, err)
+		}
+		fmt.Fprintf(os.Stderr, "Logged %s as entry %d of %d (%s)\n", path, receipt.Index, receipt.Head.TreeSize, path+anchorSuffix)
+	}
+	fmt.Fprintf(os.Stderr, "Log key: %x (pin it with verify -key)\n", client.Key)
+}
+
+func runTranslogServe(listen, dir, debugListen string) {
+	log, err := translog.Open(dir)
+	if err != nil {
+		fail(KindFailure, "Error opening log: %v", err)
+	}
+	defer log.Close()
+
+	ctx, stop := secret.NotifyContext(context.Background())
+	defer stop()
+	serveDebug(debugListen, map[string]diag.Source{
+		"log": func() any { return log.Head() },
+	})
+	srv := &http.Server{Addr: listen, Handler: translog.Handler(log)}
+	go func() {
+		<-ctx.Done()
+		srv.Close()
+	}()
+	head := log.Head()
+	fmt.Fprintf(os.Stderr, "Log %s: %d entries, key %x\nServing on http://%s\n", dir, head.TreeSize, log.PublicKey(), listen)
+	if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		log.Close()
+		fail(KindFailure, "Error: %v", err)
+	}
+}
+
+// runVerify checks a ceremony artifact against its transparency log receipt:
+// that the receipt is for this file, that its inclusion proof holds under the
+// signed tree head and, with -online, that the log's current head still
+// contains that head, i.e. the log was not rewritten since.
+func runVerify(bundlePath, keyHex, logURL string, online bool, files []string) {
+	if len(files) != 1 {
+		fail(KindUsage, "Usage: keygen verify [-bundle file.anchor.json] [-key hex] [-online] <file>")
+	}
+	path := files[0]
+	if bundlePath == "" {
+		bundlePath = path + anchorSuffix
+	}
+	data, err := os.ReadFile(bundlePath)
+	if err != nil {
+		fail(KindInput, "Error reading bundle: %v", err)
+	}
+	var receipt translog.Receipt
+	if err := schema.Unmarshal(data, &receipt, bundlePath); err != nil {
+		fail(KindInput, "Error parsing bundle: %v", err)
+	}
+
+	var key ed25519.PublicKey
+	switch {
+	case keyHex != "":
+		key = parseLogKey(keyHex)
+		if receipt.LogKey != "" && receipt.LogKey != keyHex {
+			fail(KindCrypto, "Error: bundle was signed by log key %s, not the pinned key", receipt.LogKey)
+		}
+	case receipt.LogKey != "":
+		key = parseLogKey(receipt.LogKey)
+		fmt.Fprintln(os.Stderr, "Warning: trusting the log key recorded in the bundle; pin it with -key")
+	default:
+		fail(KindInput, "Error: bundle records no log key; give one with -key")
+	}
+
+	if err := receipt.Verify(key, fileDigest(path)); err != nil {
+		fail(KindCrypto, "Error: %s: %v", path, err)
+	}
+	fmt.Printf("%s is entry %d of %d in %s (head signed %s)\n",
+		path, receipt.Index, receipt.Head.TreeSize, receipt.Log, receipt.Head.Timestamp.Format(time.RFC3339))
+
+	if !online {
+		return
+	}
+	if logURL == "" {
+		logURL = receipt.Log
+	}
+	client := &translog.Client{URL: logURL, Key: key}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	latest, err := client.Head(ctx)
+	if err == nil {
+		err = client.CheckConsistency(ctx, &receipt.Head, latest)
+	}
+	if err != nil {
+		fail(KindCrypto, "Error: log %s is not consistent with the bundle: %v", logURL, err)
+	}
+	fmt.Printf("Log still contains it: current head has %d entries and extends the bundle's\n", latest.TreeSize)
+}
+
+func parseLogKey(s string) ed25519.PublicKey {
+	key, err := hex.DecodeString(s)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		fail(KindInput, "Error: log key must be %d bytes of hex", ed25519.PublicKeySize)
+	}
+	return key
+}
+
+// fileDigest is the SHA-256 of a file, the entry logged for it.
+func fileDigest(path string) []byte {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		fail(KindInput, "Error reading %s: %v", path, err)
+	}
+	digest := sha256.Sum256(data)
+	return digest[:]
+}
@@ -0,0 +1,157 @@
+package translog
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// Receipt records that an artifact hash is in a log: its index, a signed
+// tree head that includes it and the inclusion proof against that head.
+type Receipt struct {
+	Log    string   `json:"log,omitempty"`     // Log URL
+	LogKey string   `json:"log_key,omitempty"` // Hex ed25519 key the head is signed with
+	Entry  string   `json:"entry"`             // Hex artifact hash
+	Index  uint64   `json:"index"`
+	Head   Head     `json:"head"`
+	Proof  []string `json:"inclusion_proof"`
+}
+
+// Verify checks that the receipt is for entry and that the inclusion proof
+// and head signature hold under key.
+func (r *Receipt) Verify(key ed25519.PublicKey, entry []byte) error {
+	if r.Entry != hex.EncodeToString(entry) {
+		return fmt.Errorf("translog: receipt is for %s, not %x", r.Entry, entry)
+	}
+	if err := r.Head.Verify(key); err != nil {
+		return err
+	}
+	root, err := hex.DecodeString(r.Head.Root)
+	if err != nil {
+		return fmt.Errorf("translog: malformed root")
+	}
+	proof, err := decodeProof(r.Proof)
+	if err != nil {
+		return err
+	}
+	return VerifyInclusion(LeafHash(entry), r.Index, r.Head.TreeSize, proof, root)
+}
+
+// Client talks to a log server.
+type Client struct {
+	URL string
+	Key ed25519.PublicKey // Pinned log key; fetched from the server when nil
+}
+
+// Submit logs an artifact hash and returns a verified receipt.
+func (c *Client) Submit(ctx context.Context, entry []byte) (*Receipt, error) {
+	if err := c.ensureKey(ctx); err != nil {
+		return nil, err
+	}
+	body, _ := json.Marshal(map[string]string{"entry": hex.EncodeToString(entry)})
+	var r Receipt
+	if err := c.do(ctx, http.MethodPost, "/v1/entries", nil, body, &r); err != nil {
+		return nil, err
+	}
+	r.Log = c.URL
+	r.LogKey = hex.EncodeToString(c.Key)
+	if err := r.Verify(c.Key, entry); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// Head fetches and verifies the log's current tree head.
+func (c *Client) Head(ctx context.Context) (*Head, error) {
+	if err := c.ensureKey(ctx); err != nil {
+		return nil, err
+	}
+	var h Head
+	if err := c.do(ctx, http.MethodGet, "/v1/head", nil, nil, &h); err != nil {
+		return nil, err
+	}
+	if err := h.Verify(c.Key); err != nil {
+		return nil, err
+	}
+	return &h, nil
+}
+
+// CheckConsistency verifies that later extends earlier, so nothing the
+// earlier head committed to has been rewritten.
+func (c *Client) CheckConsistency(ctx context.Context, earlier, later *Head) error {
+	var resp struct {
+		Proof []string `json:"proof"`
+	}
+	q := url.Values{
+		"first":  {strconv.FormatUint(earlier.TreeSize, 10)},
+		"second": {strconv.FormatUint(later.TreeSize, 10)},
+	}
+	if err := c.do(ctx, http.MethodGet, "/v1/proof/consistency", q, nil, &resp); err != nil {
+		return err
+	}
+	proof, err := decodeProof(resp.Proof)
+	if err != nil {
+		return err
+	}
+	first, err1 := hex.DecodeString(earlier.Root)
+	second, err2 := hex.DecodeString(later.Root)
+	if err1 != nil || err2 != nil {
+		return fmt.Errorf("translog: malformed root")
+	}
+	return VerifyConsistency(earlier.TreeSize, later.TreeSize, first, second, proof)
+}
+
+func (c *Client) ensureKey(ctx context.Context) error {
+	if c.Key != nil {
+		return nil
+	}
+	var resp struct {
+		PublicKey string `json:"public_key"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/v1/key", nil, nil, &resp); err != nil {
+		return err
+	}
+	key, err := hex.DecodeString(resp.PublicKey)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return fmt.Errorf("translog: server returned a malformed key")
+	}
+	c.Key = key
+	return nil
+}
+
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, body []byte, out any) error {
+	u := c.URL + path
+	if query != nil {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("translog: %w", err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return fmt.Errorf("translog: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("translog: HTTP %s: %s", resp.Status, bytes.TrimSpace(data))
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("translog: malformed response: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,216 @@
+package translog
+
+import (
+	"bufio"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// headDomain separates signed tree heads from other ed25519 signatures.
+const headDomain = "fy-ledger/translog/head/v1"
+
+// Head is a signed tree head: the log's commitment to its first TreeSize
+// entries.
+type Head struct {
+	TreeSize  uint64    `json:"tree_size"`
+	Root      string    `json:"root"`
+	Timestamp time.Time `json:"timestamp"`
+	Signature string    `json:"signature"`
+}
+
+func (h *Head) signedMessage() []byte {
+	return fmt.Appendf(nil, "%s\n%d\n%s\n%d\n", headDomain, h.TreeSize, h.Root, h.Timestamp.UnixNano())
+}
+
+// Verify checks the head's signature.
+func (h *Head) Verify(key ed25519.PublicKey) error {
+	sig, err := hex.DecodeString(h.Signature)
+	if err != nil || len(key) != ed25519.PublicKeySize || !ed25519.Verify(key, h.signedMessage(), sig) {
+		return errors.New("translog: tree head signature does not verify")
+	}
+	return nil
+}
+
+// Log is an append-only log of 32-byte artifact hashes, persisted in a
+// directory as one hex entry per line plus the log's signing key.
+type Log struct {
+	mu      sync.Mutex
+	key     ed25519.PrivateKey
+	entries [][]byte
+	leaves  [][]byte
+	index   map[string]uint64
+	file    *os.File
+}
+
+// Open opens or creates the log in dir, generating its signing key on first
+// use.
+func Open(dir string) (*Log, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	key, err := loadKey(filepath.Join(dir, "log.key"))
+	if err != nil {
+		return nil, err
+	}
+	l := &Log{key: key, index: make(map[string]uint64)}
+
+	path := filepath.Join(dir, "entries")
+	if f, err := os.Open(path); err == nil {
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			entry, err := hex.DecodeString(strings.TrimSpace(scanner.Text()))
+			if err != nil || len(entry) != HashSize {
+				f.Close()
+				return nil, fmt.Errorf("translog: %s: corrupt entry %d", path, len(l.entries))
+			}
+			l.append(entry)
+		}
+		f.Close()
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	if l.file, err = os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func loadKey(path string) (ed25519.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		seed := make([]byte, ed25519.SeedSize)
+		if _, err := rand.Read(seed); err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(path, []byte(hex.EncodeToString(seed)+"\n"), 0600); err != nil {
+			return nil, err
+		}
+		return ed25519.NewKeyFromSeed(seed), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	seed, err := hex.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil || len(seed) != ed25519.SeedSize {
+		return nil, fmt.Errorf("translog: %s: expected a hex ed25519 seed", path)
+	}
+	return ed25519.NewKeyFromSeed(seed), nil
+}
+
+func (l *Log) append(entry []byte) {
+	l.index[hex.EncodeToString(entry)] = uint64(len(l.entries))
+	l.entries = append(l.entries, entry)
+	l.leaves = append(l.leaves, LeafHash(entry))
+}
+
+// Close closes the entry file.
+func (l *Log) Close() error {
+	return l.file.Close()
+}
+
+// PublicKey returns the key tree heads are signed with.
+func (l *Log) PublicKey() ed25519.PublicKey {
+	return l.key.Public().(ed25519.PublicKey)
+}
+
+// Add appends an artifact hash, or finds it if already logged, and returns
+// its index with a fresh tree head and inclusion proof.
+func (l *Log) Add(entry []byte) (*Receipt, error) {
+	if len(entry) != HashSize {
+		return nil, fmt.Errorf("translog: entries are %d-byte hashes, got %d bytes", HashSize, len(entry))
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	index, ok := l.index[hex.EncodeToString(entry)]
+	if !ok {
+		// Persist before acknowledging, so a receipt never names an entry
+		// the log could lose
+		if _, err := fmt.Fprintf(l.file, "%x\n", entry); err != nil {
+			return nil, err
+		}
+		if err := l.file.Sync(); err != nil {
+			return nil, err
+		}
+		index = uint64(len(l.entries))
+		l.append(entry)
+	}
+	head := l.head()
+	return &Receipt{
+		Entry: hex.EncodeToString(entry),
+		Index: index,
+		Head:  *head,
+		Proof: encodeProof(inclusionProof(index, l.leaves)),
+	}, nil
+}
+
+// Head signs the current tree head.
+func (l *Log) Head() *Head {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.head()
+}
+
+func (l *Log) head() *Head {
+	h := &Head{
+		TreeSize:  uint64(len(l.leaves)),
+		Root:      hex.EncodeToString(rootOf(l.leaves)),
+		Timestamp: time.Now().UTC(),
+	}
+	h.Signature = hex.EncodeToString(ed25519.Sign(l.key, h.signedMessage()))
+	return h
+}
+
+// InclusionProof proves entry index is in the tree of the given size.
+func (l *Log) InclusionProof(index, size uint64) ([]string, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if size > uint64(len(l.leaves)) || index >= size {
+		return nil, fmt.Errorf("translog: no entry %d in a tree of size %d (log has %d)", index, size, len(l.leaves))
+	}
+	return encodeProof(inclusionProof(index, l.leaves[:size])), nil
+}
+
+// ConsistencyProof proves the tree of size second extends that of size
+// first.
+func (l *Log) ConsistencyProof(first, second uint64) ([]string, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if second > uint64(len(l.leaves)) || first > second {
+		return nil, fmt.Errorf("translog: no consistency proof from %d to %d (log has %d)", first, second, len(l.leaves))
+	}
+	if first == 0 {
+		return nil, nil
+	}
+	return encodeProof(consistencyProof(first, l.leaves[:second])), nil
+}
+
+func encodeProof(proof [][]byte) []string {
+	out := make([]string, len(proof))
+	for i, p := range proof {
+		out[i] = hex.EncodeToString(p)
+	}
+	return out
+}
+
+func decodeProof(proof []string) ([][]byte, error) {
+	out := make([][]byte, len(proof))
+	for i, p := range proof {
+		b, err := hex.DecodeString(p)
+		if err != nil || len(b) != HashSize {
+			return nil, fmt.Errorf("translog: proof node %d is not a %d-byte hex hash", i, HashSize)
+		}
+		out[i] = b
+	}
+	return out, nil
+}
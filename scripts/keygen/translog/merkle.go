@@ -0,0 +1,168 @@
+// Package translog is a minimal append-only transparency log for ceremony
+// artifacts: a Merkle tree of artifact hashes (RFC 9162 hashing and proofs)
+// with signed tree heads, an HTTP server and a client.
+//
+// Anchoring a transcript's hash in a log that others also watch means a
+// record cannot later be rewritten without the log's history diverging.
+package translog
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"math/bits"
+)
+
+// HashSize is the size of leaf and node hashes.
+const HashSize = sha256.Size
+
+// LeafHash is SHA-256(0x00 || data).
+func LeafHash(data []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{0})
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+// NodeHash is SHA-256(0x01 || left || right).
+func NodeHash(left, right []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{1})
+	h.Write(left)
+	h.Write(right)
+	return h.Sum(nil)
+}
+
+// split returns the largest power of two smaller than n (n > 1).
+func split(n uint64) uint64 {
+	return 1 << (bits.Len64(n-1) - 1)
+}
+
+// rootOf computes the Merkle tree hash of leaf hashes.
+func rootOf(leaves [][]byte) []byte {
+	switch len(leaves) {
+	case 0:
+		h := sha256.Sum256(nil)
+		return h[:]
+	case 1:
+		return leaves[0]
+	}
+	k := split(uint64(len(leaves)))
+	return NodeHash(rootOf(leaves[:k]), rootOf(leaves[k:]))
+}
+
+// inclusionProof is PATH(m, D[n]) over leaf hashes.
+func inclusionProof(m uint64, leaves [][]byte) [][]byte {
+	n := uint64(len(leaves))
+	if n <= 1 {
+		return nil
+	}
+	k := split(n)
+	if m < k {
+		return append(inclusionProof(m, leaves[:k]), rootOf(leaves[k:]))
+	}
+	return append(inclusionProof(m-k, leaves[k:]), rootOf(leaves[:k]))
+}
+
+// consistencyProof is PROOF(m, D[n]) over leaf hashes.
+func consistencyProof(m uint64, leaves [][]byte) [][]byte {
+	return subproof(m, leaves, true)
+}
+
+func subproof(m uint64, leaves [][]byte, complete bool) [][]byte {
+	n := uint64(len(leaves))
+	if m == n {
+		if complete {
+			return nil
+		}
+		return [][]byte{rootOf(leaves)}
+	}
+	k := split(n)
+	if m <= k {
+		return append(subproof(m, leaves[:k], complete), rootOf(leaves[k:]))
+	}
+	return append(subproof(m-k, leaves[k:], false), rootOf(leaves[:k]))
+}
+
+// ErrProof is returned for proofs that do not verify.
+var ErrProof = errors.New("translog: proof does not verify")
+
+// VerifyInclusion checks that leafHash is entry index of the tree of the
+// given size and root.
+func VerifyInclusion(leafHash []byte, index, size uint64, proof [][]byte, root []byte) error {
+	if index >= size {
+		return ErrProof
+	}
+	fn, sn := index, size-1
+	r := leafHash
+	for _, p := range proof {
+		if sn == 0 {
+			return ErrProof
+		}
+		if fn&1 == 1 || fn == sn {
+			r = NodeHash(p, r)
+			for fn&1 == 0 && fn != 0 {
+				fn >>= 1
+				sn >>= 1
+			}
+		} else {
+			r = NodeHash(r, p)
+		}
+		fn >>= 1
+		sn >>= 1
+	}
+	if sn != 0 || !bytes.Equal(r, root) {
+		return ErrProof
+	}
+	return nil
+}
+
+// VerifyConsistency checks that the tree of size second and root
+// secondRoot extends the tree of size first and root firstRoot.
+func VerifyConsistency(first, second uint64, firstRoot, secondRoot []byte, proof [][]byte) error {
+	switch {
+	case first > second:
+		return ErrProof
+	case first == second:
+		if len(proof) != 0 || !bytes.Equal(firstRoot, secondRoot) {
+			return ErrProof
+		}
+		return nil
+	case first == 0:
+		return nil
+	}
+	if first&(first-1) == 0 {
+		// A complete subtree is its own first node
+		proof = append([][]byte{firstRoot}, proof...)
+	}
+	if len(proof) == 0 {
+		return ErrProof
+	}
+	fn, sn := first-1, second-1
+	for fn&1 == 1 {
+		fn >>= 1
+		sn >>= 1
+	}
+	fr, sr := proof[0], proof[0]
+	for _, c := range proof[1:] {
+		if sn == 0 {
+			return ErrProof
+		}
+		if fn&1 == 1 || fn == sn {
+			fr = NodeHash(c, fr)
+			sr = NodeHash(c, sr)
+			for fn&1 == 0 && fn != 0 {
+				fn >>= 1
+				sn >>= 1
+			}
+		} else {
+			sr = NodeHash(sr, c)
+		}
+		fn >>= 1
+		sn >>= 1
+	}
+	if sn != 0 || !bytes.Equal(fr, firstRoot) || !bytes.Equal(sr, secondRoot) {
+		return ErrProof
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package translog
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strconv"
+)
+
+// Handler serves the log over HTTP:
+//
+//	POST /v1/entries                      {"entry": hex}  -> Receipt
+//	GET  /v1/head                                         -> Head
+//	GET  /v1/key                                          -> {"public_key": hex}
+//	GET  /v1/proof/inclusion?index=i&size=n               -> {"proof": [...]}
+//	GET  /v1/proof/consistency?first=m&second=n           -> {"proof": [...]}
+func Handler(l *Log) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v1/entries", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Entry string `json:"entry"`
+		}
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		entry, err := hex.DecodeString(req.Entry)
+		if err != nil || len(entry) != HashSize {
+			http.Error(w, "entry must be a hex SHA-256 hash", http.StatusBadRequest)
+			return
+		}
+		receipt, err := l.Add(entry)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeResponse(w, receipt)
+	})
+	mux.HandleFunc("GET /v1/head", func(w http.ResponseWriter, r *http.Request) {
+		writeResponse(w, l.Head())
+	})
+	mux.HandleFunc("GET /v1/key", func(w http.ResponseWriter, r *http.Request) {
+		writeResponse(w, map[string]string{"public_key": hex.EncodeToString(l.PublicKey())})
+	})
+	mux.HandleFunc("GET /v1/proof/inclusion", func(w http.ResponseWriter, r *http.Request) {
+		index, err1 := strconv.ParseUint(r.URL.Query().Get("index"), 10, 64)
+		size, err2 := strconv.ParseUint(r.URL.Query().Get("size"), 10, 64)
+		if err1 != nil || err2 != nil {
+			http.Error(w, "index and size are required", http.StatusBadRequest)
+			return
+		}
+		proof, err := l.InclusionProof(index, size)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		writeResponse(w, map[string][]string{"proof": proof})
+	})
+	mux.HandleFunc("GET /v1/proof/consistency", func(w http.ResponseWriter, r *http.Request) {
+		first, err1 := strconv.ParseUint(r.URL.Query().Get("first"), 10, 64)
+		second, err2 := strconv.ParseUint(r.URL.Query().Get("second"), 10, 64)
+		if err1 != nil || err2 != nil {
+			http.Error(w, "first and second are required", http.StatusBadRequest)
+			return
+		}
+		proof, err := l.ConsistencyProof(first, second)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		writeResponse(w, map[string][]string{"proof": proof})
+	})
+	return mux
+}
+
+func writeResponse(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
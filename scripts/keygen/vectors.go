@@ -0,0 +1,291 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"math/big"
+	"strconv"
+
+	"keygen/ciphersuite"
+	"keygen/drbg"
+	"keygen/frostcore"
+)
+
+// vectorsSeed is the default seed of vectors generate.
+const vectorsSeed = "fy-ledger/vectors/v1"
+
+// TestVectors is a FROST signing session with every intermediate value, in
+// the JSON layout of RFC 9591 appendix E's vectors: scalars as big-endian
+// hex and points compressed, as the app's APDUs carry them.
+type TestVectors struct {
+	Config   VectorConfig   `json:"config"`
+	Inputs   VectorInputs   `json:"inputs"`
+	RoundOne VectorRoundOne `json:"round_one_outputs"`
+	RoundTwo VectorRoundTwo `json:"round_two_outputs"`
+	Final    VectorFinal    `json:"final_output"`
+}
+
+// VectorConfig is the group's size and the suite, as short name and as the
+// context string of its hashes. The counts are strings, as in the RFC.
+type VectorConfig struct {
+	MaxParticipants string `json:"MAX_PARTICIPANTS"`
+	NumParticipants string `json:"NUM_PARTICIPANTS"`
+	MinParticipants string `json:"MIN_PARTICIPANTS"`
+	Name            string `json:"name"`
+	ContextString   string `json:"context_string"`
+	Seed            string `json:"seed"` // Hex; every value below derives from it
+}
+
+// VectorInputs are the trusted dealer's key generation and the message.
+type VectorInputs struct {
+	ParticipantList []int              `json:"participant_list"` // The signers
+	GroupSecretKey  string             `json:"group_secret_key"`
+	GroupPublicKey  string             `json:"group_public_key"`
+	Message         string             `json:"message"`
+	Coefficients    []string           `json:"share_polynomial_coefficients"` // After the secret key
+	Shares          []VectorShareEntry `json:"participant_shares"`
+}
+
+// VectorShareEntry is one participant's key share.
+type VectorShareEntry struct {
+	ID    int    `json:"identifier"`
+	Share string `json:"participant_share"`
+}
+
+// VectorRoundOne holds each signer's nonces and binding factor, in
+// commitment list order.
+type VectorRoundOne struct {
+	Outputs []VectorCommitEntry `json:"outputs"`
+}
+
+// VectorCommitEntry is one signer's round one. The nonces are
+// nonce_generate(randomness, share) with no context, as COMMIT draws them;
+// binding_factor_input is what H1 hashes after the suite's context string
+// and "rho": message || commitment list || identifier.
+type VectorCommitEntry struct {
+	ID                     int    `json:"identifier"`
+	HidingNonceRandomness  string `json:"hiding_nonce_randomness"`
+	BindingNonceRandomness string `json:"binding_nonce_randomness"`
+	HidingNonce            string `json:"hiding_nonce"`
+	BindingNonce           string `json:"binding_nonce"`
+	HidingNonceCommitment  string `json:"hiding_nonce_commitment"`
+	BindingNonceCommitment string `json:"binding_nonce_commitment"`
+	BindingFactorInput     string `json:"binding_factor_input"`
+	BindingFactor          string `json:"binding_factor"`
+}
+
+// VectorRoundTwo holds each signer's signature share.
+type VectorRoundTwo struct {
+	Outputs []VectorSignEntry `json:"outputs"`
+}
+
+// VectorSignEntry is one signer's round two, with its Lagrange
+// coefficient, which the RFC's vectors leave out.
+type VectorSignEntry struct {
+	ID       int    `json:"identifier"`
+	Lambda   string `json:"lambda"`
+	SigShare string `json:"sig_share"`
+}
+
+// VectorFinal is the aggregate. The RFC's vectors have only sig; the other
+// values let the app's tests check each step on its own.
+type VectorFinal struct {
+	CommitmentList  string `json:"commitment_list"` // As INJECT_COMMITMENTS takes it
+	GroupCommitment string `json:"group_commitment"`
+	Challenge       string `json:"challenge"`
+	Signature       string `json:"sig"` // R || z
+}
+
+const vectorsUsage = "Usage: keygen vectors <generate|export|check> [options]"
+
+// runVectors implements the vectors subcommands:
+//
+//	vectors generate [-ciphersuite name] [-seed hex] [-t 2] [-n 3]
+//	                 [-signers 1,3] [-message hex] [-out f]
+//	vectors export [-lang c] [-prefix tv] [-out f] [vectors.json]
+//	vectors check [-json] [vectors.json...]
+//
+// generate derives a trusted dealer split, the message and every signer's
+// nonce randomness from the seed, and prints the signing session as
+// TestVectors. The same seed and options give the same file, so it can be
+// checked in and regenerated; -out writes it to a file. export renders
+// TestVectors for another language's tests (see runVectorsExport), and
+// check fails if keygen no longer computes the same values from the seeds
+// (see runVectorsCheck).
+func runVectors(args []string) {
+	if len(args) < 1 {
+		fail(KindUsage, vectorsUsage)
+	}
+	switch args[0] {
+	case "generate":
+		runVectorsGenerate(args[1:])
+	case "export":
+		runVectorsExport(args[1:])
+	case "check":
+		runVectorsCheck(args[1:])
+	default:
+		fail(KindUsage, vectorsUsage)
+	}
+}
+
+func runVectorsGenerate(args []string) {
+	cmd := flag.NewFlagSet("vectors generate", flag.ExitOnError)
+	suite := cmd.String("ciphersuite", frostcore.Suite.Name(), "Ciphersuite of the vectors (default: the one in use)")
+	seed := cmd.String("seed", hex.EncodeToString([]byte(vectorsSeed)), "Hex seed the key, message and nonce randomness derive from")
+	t := cmd.Int("t", 2, "Threshold (minimum signers)")
+	n := cmd.Int("n", 3, "Total participants")
+	signerList := cmd.String("signers", "", "Comma-separated signers (default: participants 1 to t)")
+	message := cmd.String("message", "", "32-byte message hash (hex; default: derived from the seed)")
+	stdioFlags(cmd)
+	cmd.Parse(args)
+	if cmd.NArg() > 0 {
+		fail(KindUsage, "Usage: keygen vectors generate [-ciphersuite name] [-seed hex] [-t 2] [-n 3] [-signers ids] [-message hex] [-out f]")
+	}
+
+	if *suite != frostcore.Suite.Name() {
+		cs, err := ciphersuite.Lookup(*suite)
+		if err != nil {
+			fail(KindUsage, "Error: -ciphersuite: %v", err)
+		}
+		if err := frostcore.Use(cs); err != nil {
+			fail(KindUsage, "Error: -ciphersuite: %v", err)
+		}
+	}
+	seedBytes, err := hex.DecodeString(*seed)
+	if err != nil || len(seedBytes) == 0 {
+		fail(KindInput, "Error: -seed: expected non-empty hex")
+	}
+	if *t < 1 || *t > *n || *n > 0xFFFF {
+		fail(KindUsage, "Error: invalid threshold %d of %d", *t, *n)
+	}
+	var signers []int
+	if *signerList == "" {
+		for id := 1; id <= *t; id++ {
+			signers = append(signers, id)
+		}
+	} else if signers, err = parseIDList(*signerList); err != nil {
+		fail(KindUsage, "Error: -signers: %v", err)
+	}
+	if len(signers) < *t {
+		fail(KindUsage, "Error: -signers: %d signers for threshold %d", len(signers), *t)
+	}
+	if last := signers[len(signers)-1]; last > *n {
+		fail(KindUsage, "Error: -signers: participant %d of %d", last, *n)
+	}
+	var msg []byte
+	if *message != "" {
+		if msg, err = frostcore.ParseBytes("message", *message, 32); err != nil {
+			fail(KindInput, "Error: -message: %v", err)
+		}
+	}
+
+	v, err := generateVectors(seedBytes, *t, *n, signers, msg)
+	if err != nil {
+		fail(KindCrypto, "Error: %v", err)
+	}
+	writeJSON(v)
+}
+
+// generateVectors computes the t-of-n vectors of seed with the suite in
+// use, signed by signers (sorted), checking that the signature verifies. A
+// nil msg is derived from the seed.
+func generateVectors(seed []byte, t, n int, signers []int, msg []byte) (*TestVectors, error) {
+	label := fmt.Sprintf("%s/%d-of-%d", frostcore.Suite.Name(), t, n)
+	secret, err := frostcore.RandomScalar(drbg.New(seed, label+"/secret"))
+	if err != nil {
+		return nil, err
+	}
+	coeffs, shares, err := frostcore.SplitPolynomial(secret, t, n, drbg.New(seed, label+"/keygen"))
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		for _, s := range append(append(coeffs, shares...), secret) {
+			s.SetInt64(0)
+		}
+	}()
+	if msg == nil {
+		msg = make([]byte, 32)
+		drbg.New(seed, label+"/message").Read(msg)
+	}
+
+	groupKey := frostcore.BasePoint(secret)
+	v := &TestVectors{
+		Config: VectorConfig{
+			MaxParticipants: strconv.Itoa(n),
+			NumParticipants: strconv.Itoa(len(signers)),
+			MinParticipants: strconv.Itoa(t),
+			Name:            frostcore.Suite.Name(),
+			ContextString:   frostcore.Suite.ID(),
+			Seed:            hex.EncodeToString(seed),
+		},
+		Inputs: VectorInputs{
+			ParticipantList: signers,
+			GroupSecretKey:  hex.EncodeToString(frostcore.ScalarBytes(secret)),
+			GroupPublicKey:  hex.EncodeToString(groupKey),
+			Message:         hex.EncodeToString(msg),
+		},
+	}
+	for _, c := range coeffs[1:] {
+		v.Inputs.Coefficients = append(v.Inputs.Coefficients, hex.EncodeToString(frostcore.ScalarBytes(c)))
+	}
+	for i, s := range shares {
+		v.Inputs.Shares = append(v.Inputs.Shares, VectorShareEntry{ID: i + 1, Share: hex.EncodeToString(frostcore.ScalarBytes(s))})
+	}
+
+	var list []frostcore.Commitment
+	randomness := make([][]byte, len(signers))
+	nonces := make([][2]*big.Int, len(signers))
+	for i, id := range signers {
+		randomness[i] = make([]byte, 2*frostcore.NonceSeedSize)
+		drbg.New(seed, fmt.Sprintf("%s/signer/%d", label, id)).Read(randomness[i])
+		d := frostcore.NonceGenerate(randomness[i][:frostcore.NonceSeedSize], shares[id-1], nil)
+		e := frostcore.NonceGenerate(randomness[i][frostcore.NonceSeedSize:], shares[id-1], nil)
+		nonces[i] = [2]*big.Int{d, e}
+		list = append(list, frostcore.Commitment{ID: frostcore.IDBytes(uint16(id)), Hiding: frostcore.BasePoint(d), Binding: frostcore.BasePoint(e)})
+	}
+	trace, err := frostcore.NewTrace(msg, groupKey, list, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	z := new(big.Int)
+	for i, p := range trace.Participants {
+		id := int(p.ID)
+		zi := frostcore.PartialSig(nonces[i][0], nonces[i][1], p.BindingFactor, shares[id-1], trace.Challenge, p.Lambda)
+		z.Add(z, zi)
+		v.RoundOne.Outputs = append(v.RoundOne.Outputs, VectorCommitEntry{
+			ID:                     id,
+			HidingNonceRandomness:  hex.EncodeToString(randomness[i][:frostcore.NonceSeedSize]),
+			BindingNonceRandomness: hex.EncodeToString(randomness[i][frostcore.NonceSeedSize:]),
+			HidingNonce:            hex.EncodeToString(frostcore.ScalarBytes(nonces[i][0])),
+			BindingNonce:           hex.EncodeToString(frostcore.ScalarBytes(nonces[i][1])),
+			HidingNonceCommitment:  hex.EncodeToString(list[i].Hiding),
+			BindingNonceCommitment: hex.EncodeToString(list[i].Binding),
+			BindingFactorInput:     hex.EncodeToString(bytes.Join([][]byte{msg, trace.CommitmentList, list[i].ID}, nil)),
+			BindingFactor:          hex.EncodeToString(frostcore.ScalarBytes(p.BindingFactor)),
+		})
+		v.RoundTwo.Outputs = append(v.RoundTwo.Outputs, VectorSignEntry{
+			ID:       id,
+			Lambda:   hex.EncodeToString(frostcore.ScalarBytes(p.Lambda)),
+			SigShare: hex.EncodeToString(frostcore.ScalarBytes(zi)),
+		})
+	}
+	zBytes := frostcore.ScalarBytes(z)
+	valid, err := frostcore.Verify(groupKey, msg, trace.GroupCommitment, zBytes)
+	if err != nil {
+		return nil, err
+	}
+	if !valid {
+		return nil, fmt.Errorf("%s: signature does not verify", label)
+	}
+	v.Final = VectorFinal{
+		CommitmentList:  hex.EncodeToString(trace.CommitmentList),
+		GroupCommitment: hex.EncodeToString(trace.GroupCommitment),
+		Challenge:       hex.EncodeToString(frostcore.ScalarBytes(trace.Challenge)),
+		Signature:       hex.EncodeToString(trace.GroupCommitment) + hex.EncodeToString(zBytes),
+	}
+	return v, nil
+}
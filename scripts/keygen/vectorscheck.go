@@ -0,0 +1,226 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"keygen/ciphersuite"
+	"keygen/frostcore"
+	"keygen/schema"
+)
+
+// VectorCheckReport is the output of vectors check.
+type VectorCheckReport struct {
+	Files []VectorCheck `json:"files"`
+	Pass  bool          `json:"pass"`
+}
+
+// VectorCheck is the check of one vectors file.
+type VectorCheck struct {
+	File  string       `json:"file"`
+	Pass  bool         `json:"pass"`
+	Error string       `json:"error,omitempty"` // Set if the file could not be regenerated
+	Diffs []VectorDiff `json:"diffs,omitempty"`
+}
+
+// VectorDiff is a value the regenerated vectors do not reproduce. Field is
+// its path in the JSON, e.g. round_two_outputs.outputs[1].sig_share.
+type VectorDiff struct {
+	Field string `json:"field"`
+	Want  string `json:"want"` // As the file has it
+	Got   string `json:"got"`  // As keygen computes it now
+}
+
+// runVectorsCheck regenerates each TestVectors file, or the vectors on
+// stdin, from its seed, with its ciphersuite, size, signers and message,
+// and compares every value: the dealer's coefficients and shares, each
+// signer's nonces, commitments, binding factor, Lagrange coefficient and
+// signature share, and the aggregate. A value that differs means the
+// frostcore primitives, the fy library under them or an encoding changed,
+// so the app's tests and every export of the file no longer agree with
+// keygen. The command prints one line per file and differing value, or the
+// report with -json, and exits 1 if any value differs.
+func runVectorsCheck(args []string) {
+	cmd := flag.NewFlagSet("vectors check", flag.ExitOnError)
+	asJSON := cmd.Bool("json", false, "Print JSON instead of text")
+	stdioFlags(cmd)
+	cmd.Parse(args)
+
+	files := cmd.Args()
+	if len(files) == 0 {
+		files = []string{stdinName}
+	}
+	report := VectorCheckReport{Pass: true}
+	for _, name := range files {
+		var v TestVectors
+		r := io.Reader(os.Stdin)
+		if name != stdinName {
+			f, err := os.Open(name)
+			if err != nil {
+				fail(KindInput, "Error: %v", err)
+			}
+			r = f
+			defer f.Close()
+		}
+		if err := schema.Decode(r, &v, name); err != nil {
+			fail(KindInput, "Error reading vectors: %v", err)
+		}
+		c := VectorCheck{File: name}
+		diffs, err := v.check()
+		if err != nil {
+			c.Error = err.Error()
+		}
+		c.Diffs = diffs
+		c.Pass = err == nil && len(diffs) == 0
+		report.Files = append(report.Files, c)
+		report.Pass = report.Pass && c.Pass
+	}
+
+	if *asJSON {
+		writeJSON(report)
+	} else {
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		for _, c := range report.Files {
+			switch {
+			case c.Error != "":
+				fmt.Fprintf(w, "%s\tFAIL: %s\n", c.File, c.Error)
+			case c.Pass:
+				fmt.Fprintf(w, "%s\tok\n", c.File)
+			default:
+				fmt.Fprintf(w, "%s\tFAIL: %d values differ\n", c.File, len(c.Diffs))
+			}
+			for _, d := range c.Diffs {
+				fmt.Fprintf(w, "  %s\twant %s\n", d.Field, d.Want)
+				fmt.Fprintf(w, "  \tgot  %s\n", d.Got)
+			}
+		}
+		w.Flush()
+	}
+	if !report.Pass {
+		fail(KindFailure, "Vector check failed")
+	}
+}
+
+// check regenerates the vectors from their seed and returns the values
+// that differ.
+func (v *TestVectors) check() ([]VectorDiff, error) {
+	cs, err := ciphersuite.Lookup(v.Config.Name)
+	if err != nil {
+		return nil, err
+	}
+	if err := frostcore.Use(cs); err != nil {
+		return nil, err
+	}
+	seed, err := hex.DecodeString(v.Config.Seed)
+	if err != nil || len(seed) == 0 {
+		return nil, fmt.Errorf("config.seed: expected non-empty hex; only vectors generate files can be checked")
+	}
+	t, err := strconv.Atoi(v.Config.MinParticipants)
+	if err != nil {
+		return nil, fmt.Errorf("config.MIN_PARTICIPANTS: %v", err)
+	}
+	n, err := strconv.Atoi(v.Config.MaxParticipants)
+	if err != nil {
+		return nil, fmt.Errorf("config.MAX_PARTICIPANTS: %v", err)
+	}
+	signers := v.Inputs.ParticipantList
+	if t < 1 || t > n || n > 0xFFFF || len(signers) < t || !slices.IsSorted(signers) || signers[0] < 1 || signers[len(signers)-1] > n {
+		return nil, fmt.Errorf("%d-of-%d group with signers %v", t, n, signers)
+	}
+	// The message may have been given to vectors generate rather than
+	// derived, so it is taken from the file
+	msg, err := frostcore.ParseBytes("inputs.message", v.Inputs.Message, 32)
+	if err != nil {
+		return nil, err
+	}
+
+	got, err := generateVectors(seed, t, n, signers, msg)
+	if err != nil {
+		return nil, err
+	}
+	want, err := jsonValue(v)
+	if err != nil {
+		return nil, err
+	}
+	have, err := jsonValue(got)
+	if err != nil {
+		return nil, err
+	}
+	var diffs []VectorDiff
+	diffJSON("", want, have, &diffs)
+	return diffs, nil
+}
+
+// jsonValue returns v as encoding/json decodes it into an any.
+func jsonValue(v any) (any, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var out any
+	err = json.Unmarshal(b, &out)
+	return out, err
+}
+
+// diffJSON appends the leaves of want and got that differ, by path. Hex
+// compares case-insensitively; a value only one side has is "(none)".
+func diffJSON(path string, want, got any, diffs *[]VectorDiff) {
+	switch w := want.(type) {
+	case map[string]any:
+		g, _ := got.(map[string]any)
+		union := maps.Clone(w)
+		for k := range g {
+			union[k] = nil
+		}
+		keys := slices.Sorted(maps.Keys(union))
+		for _, k := range keys {
+			p := k
+			if path != "" {
+				p = path + "." + k
+			}
+			diffJSON(p, w[k], g[k], diffs)
+		}
+		return
+	case []any:
+		g, _ := got.([]any)
+		for i := range max(len(w), len(g)) {
+			var wi, gi any
+			if i < len(w) {
+				wi = w[i]
+			}
+			if i < len(g) {
+				gi = g[i]
+			}
+			diffJSON(fmt.Sprintf("%s[%d]", path, i), wi, gi, diffs)
+		}
+		return
+	}
+	if ws, ok := want.(string); ok {
+		if gs, ok := got.(string); ok && strings.EqualFold(ws, gs) {
+			return
+		}
+	} else if want == got {
+		return
+	}
+	*diffs = append(*diffs, VectorDiff{Field: path, Want: jsonLeaf(want), Got: jsonLeaf(got)})
+}
+
+func jsonLeaf(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return "(none)"
+	case string:
+		return v
+	}
+	b, _ := json.Marshal(v)
+	return string(b)
+}
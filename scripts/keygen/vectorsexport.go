@@ -0,0 +1,254 @@
+package main
+
+import (
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+
+	"keygen/ciphersuite"
+	"keygen/frostcore"
+	"keygen/schema"
+)
+
+const vectorsExportUsage = "Usage: keygen vectors export [-lang c|python|rust] [-prefix tv] [-out f] [vectors.json]"
+
+// validCPrefix matches the prefixes -prefix takes: the arrays are named
+// <prefix>_name and the macros <PREFIX>_NAME.
+var validCPrefix = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+// runVectorsExport renders a TestVectors file, or the vectors on stdin:
+//
+//	vectors export [-lang c|python|rust] [-prefix tv] [-out f] [vectors.json]
+//
+// With -lang c it prints a header for the app's native unit tests, with the
+// group key, shares, commitments, expected signature shares and every other
+// value as byte arrays, so the tests take their known answers from the Go
+// reference rather than from a hand-copied list. With -lang python it prints
+// a module for the app's ragger tests, with the same values as bytes and
+// each signer's session as the APDUs to send and the responses to expect.
+// With -lang rust it prints a module of const byte arrays for the companion
+// signer library, so all three codebases test against the same data.
+func runVectorsExport(args []string) {
+	cmd := flag.NewFlagSet("vectors export", flag.ExitOnError)
+	lang := cmd.String("lang", "c", "Language to render for: c, python or rust")
+	prefix := cmd.String("prefix", "tv", "Prefix of the names the C header defines")
+	stdioFlags(cmd)
+	cmd.Parse(args)
+	if cmd.NArg() > 1 {
+		fail(KindUsage, vectorsExportUsage)
+	}
+	if *lang != "c" && *lang != "python" && *lang != "rust" {
+		fail(KindUsage, "Error: unknown -lang %q (c, python, rust)", *lang)
+	}
+	if !validCPrefix.MatchString(*prefix) {
+		fail(KindUsage, "Error: -prefix %q is not a lower-case C identifier", *prefix)
+	}
+
+	var r io.Reader = os.Stdin
+	name := stdinName
+	if cmd.NArg() == 1 {
+		f, err := os.Open(cmd.Arg(0))
+		if err != nil {
+			fail(KindInput, "Error: %v", err)
+		}
+		defer f.Close()
+		r, name = f, cmd.Arg(0)
+	}
+	var v TestVectors
+	if err := schema.Decode(r, &v, name); err != nil {
+		fail(KindInput, "Error reading vectors: %v", err)
+	}
+	var out string
+	var err error
+	key := "module"
+	switch *lang {
+	case "python":
+		useVectorsSuite(&v)
+		out, err = v.PythonModule()
+	case "rust":
+		out, err = v.RustModule()
+	default:
+		key = "header"
+		out, err = v.CHeader(*prefix)
+	}
+	if err != nil {
+		fail(KindInput, "Error: %s: %v", name, err)
+	}
+	record(entryOutput, map[string]string{key: out})
+	os.Stdout.WriteString(out)
+}
+
+// useVectorsSuite switches to the ciphersuite of v, which devices must run
+// for its APDUs to mean anything.
+func useVectorsSuite(v *TestVectors) {
+	if v.Config.Name != frostcore.Suite.Name() {
+		cs, err := ciphersuite.Lookup(v.Config.Name)
+		if err != nil {
+			fail(KindInput, "Error: vectors: %v", err)
+		}
+		if err := frostcore.Use(cs); err != nil {
+			fail(KindInput, "Error: vectors: %v", err)
+		}
+	}
+	if _, ok := deviceCurves[v.Config.Name]; !ok {
+		fail(KindInput, "Error: devices do not run ciphersuite %s; -lang python needs vectors of one they do", v.Config.Name)
+	}
+}
+
+// signerIDs checks that the signer list, round one and round two name the
+// same signers in the same order, and returns them.
+func (v *TestVectors) signerIDs() ([]int, error) {
+	n := len(v.RoundOne.Outputs)
+	if n == 0 || len(v.RoundTwo.Outputs) != n || len(v.Inputs.ParticipantList) != n {
+		return nil, fmt.Errorf("the signer list, round one and round two differ in length")
+	}
+	ids := make([]int, n)
+	for i, e := range v.RoundOne.Outputs {
+		if e.ID != v.Inputs.ParticipantList[i] || v.RoundTwo.Outputs[i].ID != e.ID {
+			return nil, fmt.Errorf("signer %d: round one is participant %d, round two %d", v.Inputs.ParticipantList[i], e.ID, v.RoundTwo.Outputs[i].ID)
+		}
+		ids[i] = e.ID
+	}
+	return ids, nil
+}
+
+// CHeader renders the vectors as a C header. Each value is a uint8_t
+// array, the per-signer ones indexed as the signer list is, in commitment
+// list order; shares are indexed by participant - 1.
+func (v *TestVectors) CHeader(prefix string) (string, error) {
+	h := &cHeader{prefix: prefix}
+	signers, err := v.signerIDs()
+	if err != nil {
+		return "", err
+	}
+	n := len(signers)
+
+	fmt.Fprintf(&h.b, "// Generated by keygen vectors export -lang c; regenerate rather than edit.\n")
+	fmt.Fprintf(&h.b, "// Ciphersuite %s (%s), %s-of-%s, seed %s.\n", v.Config.ContextString, v.Config.Name, v.Config.MinParticipants, v.Config.MaxParticipants, v.Config.Seed)
+	fmt.Fprintf(&h.b, "#pragma once\n\n#include <stdint.h>\n\n")
+	h.define("THRESHOLD", v.Config.MinParticipants)
+	h.define("TOTAL", v.Config.MaxParticipants)
+	h.define("NUM_SIGNERS", fmt.Sprint(n))
+	h.b.WriteByte('\n')
+
+	h.bytes("group_secret_key", v.Inputs.GroupSecretKey)
+	h.bytes("group_public_key", v.Inputs.GroupPublicKey)
+	h.bytes("message", v.Inputs.Message)
+	shares := make([]string, len(v.Inputs.Shares))
+	for i, s := range v.Inputs.Shares {
+		if s.ID != i+1 {
+			return "", fmt.Errorf("participant_shares: entry %d is participant %d", i, s.ID)
+		}
+		shares[i] = s.Share
+	}
+	h.table("participant_shares", shares)
+
+	ids := make([]string, n)
+	column := func(f func(i int) string) []string {
+		out := make([]string, n)
+		for i := range out {
+			out[i] = f(i)
+		}
+		return out
+	}
+	for i, id := range signers {
+		ids[i] = fmt.Sprint(id)
+	}
+	fmt.Fprintf(&h.b, "static const uint16_t %s_signer_ids[%s_NUM_SIGNERS] = {%s};\n\n", prefix, strings.ToUpper(prefix), strings.Join(ids, ", "))
+	one, two := v.RoundOne.Outputs, v.RoundTwo.Outputs
+	h.table("hiding_nonce_randomness", column(func(i int) string { return one[i].HidingNonceRandomness }))
+	h.table("binding_nonce_randomness", column(func(i int) string { return one[i].BindingNonceRandomness }))
+	h.table("hiding_nonces", column(func(i int) string { return one[i].HidingNonce }))
+	h.table("binding_nonces", column(func(i int) string { return one[i].BindingNonce }))
+	h.table("hiding_commitments", column(func(i int) string { return one[i].HidingNonceCommitment }))
+	h.table("binding_commitments", column(func(i int) string { return one[i].BindingNonceCommitment }))
+	h.table("binding_factors", column(func(i int) string { return one[i].BindingFactor }))
+	h.table("lambdas", column(func(i int) string { return two[i].Lambda }))
+	h.table("sig_shares", column(func(i int) string { return two[i].SigShare }))
+
+	h.bytes("commitment_list", v.Final.CommitmentList)
+	h.bytes("group_commitment", v.Final.GroupCommitment)
+	h.bytes("challenge", v.Final.Challenge)
+	h.bytes("signature", v.Final.Signature)
+	if h.err != nil {
+		return "", h.err
+	}
+	return h.b.String(), nil
+}
+
+// cHeader accumulates a header, keeping the first error.
+type cHeader struct {
+	hexFields
+	b      strings.Builder
+	prefix string
+}
+
+func (h *cHeader) define(name, value string) {
+	fmt.Fprintf(&h.b, "#define %s_%s %s\n", strings.ToUpper(h.prefix), name, value)
+}
+
+// hexFields decodes the hex fields of vectors, keeping the first error.
+type hexFields struct {
+	err error
+}
+
+// decode decodes a hex field, which must be non-empty.
+func (h *hexFields) decode(field, s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err == nil && len(b) == 0 {
+		err = fmt.Errorf("empty")
+	}
+	if err != nil && h.err == nil {
+		h.err = fmt.Errorf("%s: %v", field, err)
+	}
+	return b
+}
+
+// bytes renders a hex field as a uint8_t array.
+func (h *cHeader) bytes(name, s string) {
+	b := h.decode(name, s)
+	fmt.Fprintf(&h.b, "static const uint8_t %s_%s[%d] = {\n", h.prefix, name, len(b))
+	cBytes(&h.b, "    ", b)
+	h.b.WriteString("};\n\n")
+}
+
+// table renders hex fields of equal length as a two-dimensional array.
+func (h *cHeader) table(name string, rows []string) {
+	var decoded [][]byte
+	for i, s := range rows {
+		b := h.decode(fmt.Sprintf("%s[%d]", name, i), s)
+		if len(decoded) > 0 && len(b) != len(decoded[0]) && h.err == nil {
+			h.err = fmt.Errorf("%s[%d]: %d bytes, not %d", name, i, len(b), len(decoded[0]))
+		}
+		decoded = append(decoded, b)
+	}
+	size := 0
+	if len(decoded) > 0 {
+		size = len(decoded[0])
+	}
+	fmt.Fprintf(&h.b, "static const uint8_t %s_%s[%d][%d] = {\n", h.prefix, name, len(rows), size)
+	for _, b := range decoded {
+		h.b.WriteString("    {\n")
+		cBytes(&h.b, "        ", b)
+		h.b.WriteString("    },\n")
+	}
+	h.b.WriteString("};\n\n")
+}
+
+// cBytes writes b as hex literals, 8 to a line.
+func cBytes(w *strings.Builder, indent string, b []byte) {
+	for i := 0; i < len(b); i += 8 {
+		w.WriteString(indent)
+		for j := i; j < min(i+8, len(b)); j++ {
+			if j > i {
+				w.WriteByte(' ')
+			}
+			fmt.Fprintf(w, "0x%02x,", b[j])
+		}
+		w.WriteByte('\n')
+	}
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/f3rmion/fy-ledger/corpus"
+
+	"keygen/apdu"
+)
+
+// PythonModule renders the vectors as a Python module for the app's ragger
+// tests. Besides every value as bytes, it gives each signer's session as
+// the APDUs to send, in order, with the response data and status word to
+// expect. The responses are those of simdevice replaying the session with
+// the signer's nonce randomness as its RNG, checked against the vectors, so
+// only COMMIT and PARTIAL_SIGN depend on the device drawing the same bytes;
+// the module marks them.
+func (v *TestVectors) PythonModule() (string, error) {
+	signers, err := v.signerIDs()
+	if err != nil {
+		return "", err
+	}
+	m := &pyModule{}
+	fmt.Fprintf(&m.b, "# Generated by keygen vectors export -lang python; regenerate rather than edit.\n")
+	fmt.Fprintf(&m.b, "# Ciphersuite %s (%s), %s-of-%s, seed %s.\n", v.Config.ContextString, v.Config.Name, v.Config.MinParticipants, v.Config.MaxParticipants, v.Config.Seed)
+	m.b.WriteString(pyPreamble)
+
+	fmt.Fprintf(&m.b, "CIPHERSUITE = %q\n", v.Config.Name)
+	fmt.Fprintf(&m.b, "CONTEXT_STRING = %q\n", v.Config.ContextString)
+	fmt.Fprintf(&m.b, "THRESHOLD = %s\n", v.Config.MinParticipants)
+	fmt.Fprintf(&m.b, "TOTAL = %s\n", v.Config.MaxParticipants)
+	fmt.Fprintf(&m.b, "SEED = %s\n\n", m.hex("", "seed", v.Config.Seed))
+	fmt.Fprintf(&m.b, "GROUP_SECRET_KEY = %s\n", m.hex("", "group_secret_key", v.Inputs.GroupSecretKey))
+	fmt.Fprintf(&m.b, "GROUP_PUBLIC_KEY = %s\n", m.hex("", "group_public_key", v.Inputs.GroupPublicKey))
+	fmt.Fprintf(&m.b, "MESSAGE = %s\n", m.hex("", "message", v.Inputs.Message))
+	m.b.WriteString("PARTICIPANT_SHARES = {\n")
+	shares := make([]*big.Int, len(v.Inputs.Shares))
+	for i, s := range v.Inputs.Shares {
+		if s.ID != i+1 {
+			return "", fmt.Errorf("participant_shares: entry %d is participant %d", i, s.ID)
+		}
+		field := fmt.Sprintf("participant_shares[%d]", i)
+		shares[i] = new(big.Int).SetBytes(m.decode(field, s.Share))
+		fmt.Fprintf(&m.b, "    %d: %s,\n", s.ID, m.hex("    ", field, s.Share))
+	}
+	m.b.WriteString("}\n")
+	fmt.Fprintf(&m.b, "COMMITMENT_LIST = %s\n", m.hex("", "commitment_list", v.Final.CommitmentList))
+	fmt.Fprintf(&m.b, "GROUP_COMMITMENT = %s\n", m.hex("", "group_commitment", v.Final.GroupCommitment))
+	fmt.Fprintf(&m.b, "CHALLENGE = %s\n", m.hex("", "challenge", v.Final.Challenge))
+	fmt.Fprintf(&m.b, "SIGNATURE = %s\n\n", m.hex("", "sig", v.Final.Signature))
+	if m.err != nil {
+		return "", m.err
+	}
+
+	// The session as corpus scripts record it
+	sv := &corpus.SigningVector{GroupPublicKey: v.Inputs.GroupPublicKey, Message: v.Inputs.Message, CommitmentList: v.Final.CommitmentList}
+	m.b.WriteString("SIGNERS = [\n")
+	for i, id := range signers {
+		one, two := v.RoundOne.Outputs[i], v.RoundTwo.Outputs[i]
+		if id > len(shares) {
+			return "", fmt.Errorf("signer %d has no participant share", id)
+		}
+		s := corpus.SignerVector{
+			ID:                     id,
+			HidingNonceCommitment:  one.HidingNonceCommitment,
+			BindingNonceCommitment: one.BindingNonceCommitment,
+			SigShare:               two.SigShare,
+		}
+		random := append(m.decode("hiding_nonce_randomness", one.HidingNonceRandomness), m.decode("binding_nonce_randomness", one.BindingNonceRandomness)...)
+		if m.err != nil {
+			return "", m.err
+		}
+		script, err := signingScript(sv, s, shares[id-1], random)
+		if err != nil {
+			return "", err
+		}
+
+		m.b.WriteString("    Signer(\n")
+		fmt.Fprintf(&m.b, "        identifier=%d,\n", id)
+		m.field("share", "participant_shares", v.Inputs.Shares[id-1].Share)
+		m.field("hiding_nonce_randomness", "", one.HidingNonceRandomness)
+		m.field("binding_nonce_randomness", "", one.BindingNonceRandomness)
+		m.field("hiding_nonce", "", one.HidingNonce)
+		m.field("binding_nonce", "", one.BindingNonce)
+		m.field("hiding_commitment", "hiding_nonce_commitment", one.HidingNonceCommitment)
+		m.field("binding_commitment", "binding_nonce_commitment", one.BindingNonceCommitment)
+		m.field("binding_factor", "", one.BindingFactor)
+		m.field("lambda_", "lambda", two.Lambda)
+		m.field("sig_share", "", two.SigShare)
+		m.b.WriteString("        apdus=[\n")
+		for _, st := range script.Steps {
+			data, sw := apdu.SplitResponse(st.Expected)
+			ins := st.Command[1]
+			fmt.Fprintf(&m.b, "            Exchange(%q, %s, %s, 0x%04X, %s, %s),\n",
+				st.Comment, pyBytes("            ", st.Command), pyBytes("            ", data), sw,
+				pyBool(apdu.NeedsApproval(ins)), pyBool(ins == apdu.InsCommit || ins == apdu.InsPartialSign))
+		}
+		m.b.WriteString("        ],\n    ),\n")
+	}
+	m.b.WriteString("]\n")
+	if m.err != nil {
+		return "", m.err
+	}
+	return m.b.String(), nil
+}
+
+const pyPreamble = `"""FROST signing test vectors for the app's ragger tests.
+
+Every value is bytes, scalars big-endian and points compressed, as the
+APDUs carry them. SIGNERS holds each signer's values and its session as
+Exchanges, in order: INJECT_KEYS, GET_PUBLIC_KEY, COMMIT, INJECT_MESSAGE,
+the INJECT_COMMITMENTS frames and PARTIAL_SIGN. A device answers with the
+expected responses only if its RNG returns the signer's nonce randomness.
+With any other RNG, the Exchanges marked rng answer with other bytes of the
+same length, and PARTIAL_SIGN needs the commitment list rebuilt from the
+device's COMMIT.
+"""
+
+from typing import List, NamedTuple
+
+
+class Exchange(NamedTuple):
+    """One APDU of a signer's session and the device's expected answer."""
+
+    name: str
+    command: bytes
+    response: bytes  # Response data, without the status word
+    sw: int
+    approve: bool  # The device asks the operator to approve the command
+    rng: bool  # The response depends on the device's RNG
+
+
+class Signer(NamedTuple):
+    """One signer's values, in commitment list order, and its session."""
+
+    identifier: int
+    share: bytes
+    hiding_nonce_randomness: bytes
+    binding_nonce_randomness: bytes
+    hiding_nonce: bytes
+    binding_nonce: bytes
+    hiding_commitment: bytes
+    binding_commitment: bytes
+    binding_factor: bytes
+    lambda_: bytes
+    sig_share: bytes
+    apdus: List[Exchange]
+
+
+`
+
+// pyModule accumulates a module, keeping the first error.
+type pyModule struct {
+	hexFields
+	b strings.Builder
+}
+
+// hex renders a hex field as a bytes expression continuing at indent.
+func (m *pyModule) hex(indent, field, s string) string {
+	return pyBytes(indent, m.decode(field, s))
+}
+
+// field renders a hex field as a keyword argument of a Signer. vectorsName
+// is the field's name in the vectors, if not name.
+func (m *pyModule) field(name, vectorsName, s string) {
+	if vectorsName == "" {
+		vectorsName = name
+	}
+	fmt.Fprintf(&m.b, "        %s=%s,\n", name, m.hex("        ", vectorsName, s))
+}
+
+// pyBytes renders b as bytes.fromhex, split over lines of 32 bytes at
+// indent plus 4 when longer.
+func pyBytes(indent string, b []byte) string {
+	if len(b) == 0 {
+		return `b""`
+	}
+	if len(b) <= 32 {
+		return fmt.Sprintf("bytes.fromhex(%q)", hex.EncodeToString(b))
+	}
+	var w strings.Builder
+	w.WriteString("bytes.fromhex(\n")
+	for i := 0; i < len(b); i += 32 {
+		fmt.Fprintf(&w, "%s    %q\n", indent, hex.EncodeToString(b[i:min(i+32, len(b))]))
+	}
+	w.WriteString(indent + ")")
+	return w.String()
+}
+
+func pyBool(b bool) string {
+	if b {
+		return "True"
+	}
+	return "False"
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// RustModule renders the vectors as a Rust module for the companion signer
+// library's tests: the values of CHeader as const byte arrays, named in
+// upper case without a prefix, since the module path scopes them.
+func (v *TestVectors) RustModule() (string, error) {
+	r := &rustModule{}
+	signers, err := v.signerIDs()
+	if err != nil {
+		return "", err
+	}
+	n := len(signers)
+
+	fmt.Fprintf(&r.b, "//! Generated by keygen vectors export -lang rust; regenerate rather than edit.\n")
+	fmt.Fprintf(&r.b, "//! Ciphersuite %s (%s), %s-of-%s, seed %s.\n", v.Config.ContextString, v.Config.Name, v.Config.MinParticipants, v.Config.MaxParticipants, v.Config.Seed)
+	fmt.Fprintf(&r.b, "//!\n//! Scalars are big-endian and points compressed. The per-signer tables are\n")
+	fmt.Fprintf(&r.b, "//! indexed as SIGNER_IDS, in commitment list order; PARTICIPANT_SHARES[i] is\n//! participant i + 1's.\n\n")
+	fmt.Fprintf(&r.b, "#![allow(dead_code)]\n\n")
+	fmt.Fprintf(&r.b, "pub const CIPHERSUITE: &str = %q;\n", v.Config.Name)
+	fmt.Fprintf(&r.b, "pub const CONTEXT_STRING: &str = %q;\n", v.Config.ContextString)
+	fmt.Fprintf(&r.b, "pub const THRESHOLD: u16 = %s;\n", v.Config.MinParticipants)
+	fmt.Fprintf(&r.b, "pub const TOTAL: u16 = %s;\n", v.Config.MaxParticipants)
+	fmt.Fprintf(&r.b, "pub const NUM_SIGNERS: usize = %d;\n\n", n)
+
+	r.bytes("group_secret_key", v.Inputs.GroupSecretKey)
+	r.bytes("group_public_key", v.Inputs.GroupPublicKey)
+	r.bytes("message", v.Inputs.Message)
+	shares := make([]string, len(v.Inputs.Shares))
+	for i, s := range v.Inputs.Shares {
+		if s.ID != i+1 {
+			return "", fmt.Errorf("participant_shares: entry %d is participant %d", i, s.ID)
+		}
+		shares[i] = s.Share
+	}
+	r.table("participant_shares", fmt.Sprint(len(shares)), shares)
+
+	ids := make([]string, n)
+	for i, id := range signers {
+		ids[i] = fmt.Sprint(id)
+	}
+	fmt.Fprintf(&r.b, "pub const SIGNER_IDS: [u16; NUM_SIGNERS] = [%s];\n\n", strings.Join(ids, ", "))
+	one, two := v.RoundOne.Outputs, v.RoundTwo.Outputs
+	column := func(f func(i int) string) []string {
+		out := make([]string, n)
+		for i := range out {
+			out[i] = f(i)
+		}
+		return out
+	}
+	r.table("hiding_nonce_randomness", "NUM_SIGNERS", column(func(i int) string { return one[i].HidingNonceRandomness }))
+	r.table("binding_nonce_randomness", "NUM_SIGNERS", column(func(i int) string { return one[i].BindingNonceRandomness }))
+	r.table("hiding_nonces", "NUM_SIGNERS", column(func(i int) string { return one[i].HidingNonce }))
+	r.table("binding_nonces", "NUM_SIGNERS", column(func(i int) string { return one[i].BindingNonce }))
+	r.table("hiding_commitments", "NUM_SIGNERS", column(func(i int) string { return one[i].HidingNonceCommitment }))
+	r.table("binding_commitments", "NUM_SIGNERS", column(func(i int) string { return one[i].BindingNonceCommitment }))
+	r.table("binding_factors", "NUM_SIGNERS", column(func(i int) string { return one[i].BindingFactor }))
+	r.table("lambdas", "NUM_SIGNERS", column(func(i int) string { return two[i].Lambda }))
+	r.table("sig_shares", "NUM_SIGNERS", column(func(i int) string { return two[i].SigShare }))
+
+	r.bytes("commitment_list", v.Final.CommitmentList)
+	r.bytes("group_commitment", v.Final.GroupCommitment)
+	r.bytes("challenge", v.Final.Challenge)
+	r.bytes("signature", v.Final.Signature)
+	if r.err != nil {
+		return "", r.err
+	}
+	return strings.TrimSuffix(r.b.String(), "\n"), nil
+}
+
+// rustModule accumulates a module, keeping the first error.
+type rustModule struct {
+	hexFields
+	b strings.Builder
+}
+
+// bytes renders a hex field as a [u8; N] constant.
+func (r *rustModule) bytes(name, s string) {
+	b := r.decode(name, s)
+	fmt.Fprintf(&r.b, "pub const %s: [u8; %d] = [\n", strings.ToUpper(name), len(b))
+	cBytes(&r.b, "    ", b)
+	r.b.WriteString("];\n\n")
+}
+
+// table renders hex fields of equal length as a [[u8; N]; rows] constant,
+// the row count given as the constant expression rows.
+func (r *rustModule) table(name, rows string, fields []string) {
+	var decoded [][]byte
+	for i, s := range fields {
+		b := r.decode(fmt.Sprintf("%s[%d]", name, i), s)
+		if len(decoded) > 0 && len(b) != len(decoded[0]) && r.err == nil {
+			r.err = fmt.Errorf("%s[%d]: %d bytes, not %d", name, i, len(b), len(decoded[0]))
+		}
+		decoded = append(decoded, b)
+	}
+	size := 0
+	if len(decoded) > 0 {
+		size = len(decoded[0])
+	}
+	fmt.Fprintf(&r.b, "pub const %s: [[u8; %d]; %s] = [\n", strings.ToUpper(name), size, rows)
+	for _, b := range decoded {
+		r.b.WriteString("    [\n")
+		cBytes(&r.b, "        ", b)
+		r.b.WriteString("    ],\n")
+	}
+	r.b.WriteString("];\n\n")
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"os"
+
+	"keygen/frostcore"
+	"keygen/workspace"
+)
+
+// runVerifySignature verifies a signature file, an aggregate output or any
+// JSON with R and z (plus group_key and message_hash unless given), and
+// prints the reason it fails. The signature is also tried under the group
+// key in the file and the context's, to report a signature made for another
+// group as such. A signature of purpose-tagged shares verifies only under
+// its purpose: pass -purpose to require one rather than trust the file's.
+func runVerifySignature(ws *workspace.Context, path, groupKeyHex, messageHex, purpose string, poseidon bool) {
+	var sig AggregateOutput
+	readJSONFile(path, &sig)
+	if groupKeyHex == "" {
+		groupKeyHex = sig.GroupKey
+	}
+	if groupKeyHex == "" {
+		groupKeyHex = ws.GroupKey
+	}
+	if messageHex == "" {
+		messageHex = sig.MessageHash
+	}
+	if purpose == "" {
+		purpose = sig.Purpose
+	}
+	if err := frostcore.CheckPurpose(purpose); err != nil {
+		fail(KindInput, "Error: %v", err)
+	}
+	if poseidon && purpose != "" {
+		fail(KindUsage, "Error: a purpose-tagged share never signs with an injected Poseidon challenge")
+	}
+	if groupKeyHex == "" || messageHex == "" {
+		fail(KindInput, "Error: %s has no group_key or message_hash; give -group-key and -message", path)
+	}
+	msg, err := hex.DecodeString(messageHex)
+	if err != nil || len(msg) != 32 {
+		fail(KindInput, "Error: message_hash: expected 32 bytes of hex")
+	}
+
+	var others [][]byte
+	for _, k := range []string{sig.GroupKey, ws.GroupKey} {
+		if k != "" && k != groupKeyHex {
+			others = append(others, hexBytes(k))
+		}
+	}
+	explain := frostcore.Explain
+	switch {
+	case poseidon:
+		explain = frostcore.ExplainPoseidon
+	case purpose != "":
+		explain = func(groupKey, msg, r, z []byte, otherKeys ...[]byte) *frostcore.Verification {
+			return frostcore.ExplainPurpose(purpose, groupKey, msg, r, z, otherKeys...)
+		}
+	}
+	v := explain(hexBytes(groupKeyHex), msg, hexBytes(sig.R), hexBytes(sig.Z), others...)
+	writeJSON(v)
+	if !v.Valid {
+		fail(KindCrypto, "Invalid signature: %v", v.Err())
+	}
+	if sig.Provenance != nil {
+		if err := checkProvenance(&sig); err != nil {
+			fail(KindCrypto, "Invalid provenance: %v", err)
+		}
+		fmt.Fprintln(os.Stderr, "Provenance verified")
+	}
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"os"
+
+	"keygen/frostcore"
+	"keygen/schema"
+)
+
+// VerifyPartialInput is read from stdin by verify-partial.
+type VerifyPartialInput struct {
+	GroupKey    string `json:"group_key"`
+	MessageHash string `json:"message_hash"`
+
+	// The signing commitments, either as participants (commitments only),
+	// which are put in canonical order, or as the encoded INJECT_COMMITMENTS
+	// payload, which is taken in the order given since that is the order the
+	// device saw.
+	Participants   []ParticipantInput `json:"participants,omitempty"`
+	CommitmentList string             `json:"commitment_list,omitempty"`
+
+	ID          int    `json:"id"`                  // Participant whose share is checked
+	PublicShare string `json:"public_share"`        // Y_i = s_i*G
+	PartialSig  string `json:"partial_sig"`         // z_i
+	Challenge   string `json:"challenge,omitempty"` // Injected challenge, if INJECT_CHALLENGE was used
+	Purpose     string `json:"purpose,omitempty"`   // Purpose tag of the share
+}
+
+type VerifyPartialOutput struct {
+	ID              int    `json:"id"`
+	Valid           bool   `json:"valid"`
+	BindingFactor   string `json:"binding_factor"`   // rho_i
+	Lambda          string `json:"lambda"`           // lambda_i
+	Challenge       string `json:"challenge"`        // c
+	GroupCommitment string `json:"group_commitment"` // R
+	Expected        string `json:"expected"`         // D_i + rho_i*E_i + lambda_i*c*Y_i
+	Actual          string `json:"actual"`           // z_i*G
+}
+
+// runVerifyPartial checks one participant's partial signature against its
+// public share, telling which side of a device/host mismatch is wrong.
+func runVerifyPartial() {
+	var input VerifyPartialInput
+	if err := schema.DecodeAgainst(os.Stdin, &input, "verify-partial-input", stdinName); err != nil {
+		fail(KindInput, "Error reading input: %v", err)
+	}
+	record(entryInput, input)
+
+	list, err := verifyPartialCommitments(&input)
+	if err != nil {
+		fail(KindInput, "Error: %v", err)
+	}
+	groupKey, err := hex.DecodeString(input.GroupKey)
+	if err != nil {
+		fail(KindInput, "Error: group_key: %v", err)
+	}
+	msg, err := hex.DecodeString(input.MessageHash)
+	if err != nil || len(msg) != 32 {
+		fail(KindInput, "Error: message_hash: expected 32 bytes of hex")
+	}
+	share, err := hex.DecodeString(input.PublicShare)
+	if err != nil {
+		fail(KindInput, "Error: public_share: %v", err)
+	}
+	z, err := hex.DecodeString(input.PartialSig)
+	if err != nil {
+		fail(KindInput, "Error: partial_sig: %v", err)
+	}
+	var challenge *big.Int // nil: computed from R
+	if input.Challenge != "" {
+		b, err := hex.DecodeString(input.Challenge)
+		if err != nil || len(b) != frostcore.ScalarSize {
+			fail(KindInput, "Error: challenge: expected %d bytes of hex", frostcore.ScalarSize)
+		}
+		challenge = frostcore.ScalarFromBytes(b)
+	}
+	if input.Purpose != "" {
+		if challenge != nil {
+			fail(KindInput, "Error: give challenge or purpose, not both: a device refuses INJECT_CHALLENGE for a purpose-tagged share")
+		}
+		if challenge, err = frostcore.ListChallenge(input.Purpose, msg, groupKey, list); err != nil {
+			fail(KindInput, "Error: %v", err)
+		}
+	}
+
+	check, err := frostcore.VerifyShare(msg, groupKey, list, uint16(input.ID), share, z, challenge)
+	if err != nil {
+		fail(KindCrypto, "Error verifying share: %v", err)
+	}
+
+	writeJSON(VerifyPartialOutput{
+		ID:              input.ID,
+		Valid:           check.Valid,
+		BindingFactor:   hex.EncodeToString(frostcore.ScalarBytes(check.BindingFactor)),
+		Lambda:          hex.EncodeToString(frostcore.ScalarBytes(check.Lambda)),
+		Challenge:       hex.EncodeToString(frostcore.ScalarBytes(check.Challenge)),
+		GroupCommitment: hex.EncodeToString(check.GroupCommitment),
+		Expected:        hex.EncodeToString(check.Expected),
+		Actual:          hex.EncodeToString(check.Actual),
+	})
+}
+
+// verifyPartialCommitments returns the commitment list from either form of
+// the input.
+func verifyPartialCommitments(input *VerifyPartialInput) ([]frostcore.Commitment, error) {
+	if input.CommitmentList != "" {
+		if len(input.Participants) > 0 {
+			return nil, fmt.Errorf("give either participants or commitment_list, not both")
+		}
+		b, err := hex.DecodeString(input.CommitmentList)
+		if err != nil {
+			return nil, fmt.Errorf("commitment_list: %w", err)
+		}
+		list, err := frostcore.ParseCommitments(b)
+		if err == nil && !frostcore.IsCanonical(list) {
+			fmt.Fprintln(os.Stderr, "Warning: commitment_list is not in canonical order (ascending IDs, no duplicates); the host signs over the canonical order, so binding factors will differ")
+		}
+		return list, err
+	}
+
+	if len(input.Participants) == 0 {
+		return nil, fmt.Errorf("no commitments: give participants or commitment_list")
+	}
+	list, err := commitmentList(input.Participants)
+	if err != nil {
+		return nil, err
+	}
+	return frostcore.SortCommitments(list)
+}
+
+// commitmentList converts participants' commitments, in order, to the list
+// the device hashes.
+func commitmentList(participants []ParticipantInput) ([]frostcore.Commitment, error) {
+	list := make([]frostcore.Commitment, len(participants))
+	for i, p := range participants {
+		hiding, err := hex.DecodeString(p.HidingCommit)
+		if err != nil {
+			return nil, fmt.Errorf("participant %d hiding_commit: %w", p.ID, err)
+		}
+		binding, err := hex.DecodeString(p.BindingCommit)
+		if err != nil {
+			return nil, fmt.Errorf("participant %d binding_commit: %w", p.ID, err)
+		}
+		list[i] = frostcore.Commitment{ID: frostcore.IDBytes(uint16(p.ID)), Hiding: hiding, Binding: binding}
+	}
+	return list, nil
+}
+
+// findInvalidShares verifies every partial signature of an aggregation
+// against the participants' public shares and returns the IDs that fail.
+// challenge overrides the challenge, as for shares signed with
+// INJECT_CHALLENGE; nil computes it as the input's purpose says.
+func findInvalidShares(msg, groupKey []byte, input *AggregateInput, challenge *big.Int) ([]int, error) {
+	list, err := commitmentList(input.Participants)
+	if err != nil {
+		return nil, err
+	}
+	if list, err = frostcore.SortCommitments(list); err != nil {
+		return nil, err
+	}
+	shares := make(map[int][]byte, len(input.PublicShares))
+	for _, s := range input.PublicShares {
+		b, err := hex.DecodeString(s.PublicShare)
+		if err != nil {
+			return nil, fmt.Errorf("participant %d public_share: %w", s.ID, err)
+		}
+		shares[s.ID] = b
+	}
+	if challenge == nil && input.Purpose != "" {
+		if challenge, err = frostcore.ListChallenge(input.Purpose, msg, groupKey, list); err != nil {
+			return nil, err
+		}
+	}
+
+	var invalid []int
+	for _, ps := range input.PartialSigs {
+		share, ok := shares[ps.ID]
+		if !ok {
+			return nil, fmt.Errorf("no public share for participant %d", ps.ID)
+		}
+		z, err := hex.DecodeString(ps.PartialSig)
+		if err != nil {
+			return nil, fmt.Errorf("participant %d partial_sig: %w", ps.ID, err)
+		}
+		check, err := frostcore.VerifyShare(msg, groupKey, list, uint16(ps.ID), share, z, challenge)
+		if err != nil {
+			// A share that cannot even be checked is attributed to its sender
+			fmt.Fprintf(os.Stderr, "Participant %d: %v\n", ps.ID, err)
+			invalid = append(invalid, ps.ID)
+			continue
+		}
+		if !check.Valid {
+			invalid = append(invalid, ps.ID)
+		}
+	}
+	return invalid, nil
+}
@@ -0,0 +1,225 @@
+package workspace
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"keygen/apdu"
+	"keygen/schema"
+)
+
+// EnvCeremony names the ceremony file, instead of fy-ledger.yaml in the
+// working directory.
+const EnvCeremony = "FY_LEDGER_CEREMONY"
+
+// CeremonyFile is the ceremony file looked for in the working directory.
+const CeremonyFile = "fy-ledger.yaml"
+
+// Ceremony holds the parameters of a multi-step ceremony, written once in
+// fy-ledger.yaml so operators do not retype them for every command. Its
+// values become flag defaults: flags given on the command line override
+// them, and they override the current context.
+type Ceremony struct {
+	Threshold   int             `json:"threshold,omitempty"`
+	Roster      []Participant   `json:"roster,omitempty"`  // Participants, in ID order
+	Signers     []int           `json:"signers,omitempty"` // Default signing set (reshare-init)
+	Curve       string          `json:"curve,omitempty"`   // Only "bjj" is supported
+	Hasher      string          `json:"hasher,omitempty"`  // "blake2b" (default) or "poseidon"
+	Transport   string          `json:"transport,omitempty"`
+	Coordinator string          `json:"coordinator,omitempty"`
+	TSA         string          `json:"tsa,omitempty"`
+	TransLog    string          `json:"translog,omitempty"`
+	RPC         string          `json:"rpc,omitempty"`      // Ethereum JSON-RPC endpoint (export calldata)
+	Verifier    string          `json:"verifier,omitempty"` // Verifier contract address (export calldata)
+	APDU        json.RawMessage `json:"apdu,omitempty"`     // CLA/INS overrides, as in a profile file
+	Files       CeremonyFiles   `json:"files,omitempty"`
+
+	// Path is the file the ceremony was read from.
+	Path string `json:"-"`
+
+	profile *apdu.Profile
+}
+
+// Participant is one roster entry.
+type Participant struct {
+	ID       int    `json:"id"`
+	Name     string `json:"name,omitempty"`
+	Hardware bool   `json:"hardware,omitempty"` // Holds its share on a Ledger device
+}
+
+// CeremonyFiles are the ceremony's file locations.
+type CeremonyFiles struct {
+	GroupState string `json:"group_state,omitempty"`
+	Shares     string `json:"shares,omitempty"`   // Share file directory
+	Keystore   string `json:"keystore,omitempty"` // Hidden from plugins and hooks
+	Profile    string `json:"profile,omitempty"`  // APDU profile file, instead of apdu
+}
+
+// Hashers
+const (
+	HasherBlake2b  = "blake2b"
+	HasherPoseidon = "poseidon"
+)
+
+// CeremonyPath returns the ceremony file in effect: $FY_LEDGER_CEREMONY, or
+// fy-ledger.yaml if it exists. It returns "" if there is none.
+func CeremonyPath() string {
+	if p := os.Getenv(EnvCeremony); p != "" {
+		return p
+	}
+	if _, err := os.Stat(CeremonyFile); err == nil {
+		return CeremonyFile
+	}
+	return ""
+}
+
+// LoadCeremony reads and checks a ceremony file. An empty path is an empty
+// ceremony.
+func LoadCeremony(path string) (*Ceremony, error) {
+	c := &Ceremony{Path: path}
+	if path == "" {
+		return c, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("ceremony file %s does not exist", path)
+		}
+		return nil, err
+	}
+	if err := schema.UnmarshalYAML(data, c, path); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if err := c.validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if len(c.APDU) > 0 {
+		if c.Files.Profile != "" {
+			return nil, fmt.Errorf("%s: give apdu or files.profile, not both", path)
+		}
+		if c.profile, err = apdu.ParseProfile(c.APDU, path+" (apdu)"); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+func (c *Ceremony) validate() error {
+	switch strings.ToLower(c.Curve) {
+	case "", "bjj", "babyjubjub":
+	default:
+		return fmt.Errorf("curve %q is not supported (only bjj)", c.Curve)
+	}
+	switch c.Hasher {
+	case "", HasherBlake2b, HasherPoseidon:
+	default:
+		return fmt.Errorf("hasher %q is not %s or %s", c.Hasher, HasherBlake2b, HasherPoseidon)
+	}
+	seen := make(map[int]bool, len(c.Roster))
+	for i, p := range c.Roster {
+		if p.ID != i+1 {
+			return fmt.Errorf("roster[%d] has id %d; participants are numbered 1..n in order", i, p.ID)
+		}
+		seen[p.ID] = true
+	}
+	if c.Threshold < 0 || len(c.Roster) > 0 && c.Threshold > len(c.Roster) {
+		return fmt.Errorf("threshold %d does not fit a roster of %d", c.Threshold, len(c.Roster))
+	}
+	for _, id := range c.Signers {
+		if len(c.Roster) > 0 && !seen[id] {
+			return fmt.Errorf("signer %d is not on the roster", id)
+		}
+	}
+	return nil
+}
+
+// Apply overrides the context's defaults with the ceremony's.
+func (c *Ceremony) Apply(ctx *Context) {
+	for _, f := range []struct{ dst, src *string }{
+		{&ctx.Transport, &c.Transport},
+		{&ctx.Coordinator, &c.Coordinator},
+		{&ctx.TSA, &c.TSA},
+		{&ctx.TransLog, &c.TransLog},
+		{&ctx.GroupState, &c.Files.GroupState},
+		{&ctx.Keystore, &c.Files.Keystore},
+		{&ctx.Profile, &c.Files.Profile},
+	} {
+		if *f.src != "" {
+			*f.dst = *f.src
+		}
+	}
+	if c.profile != nil {
+		ctx.Profile = "" // The inline profile replaces the context's file
+	}
+}
+
+// Profile returns the ceremony's inline APDU profile, or nil.
+func (c *Ceremony) Profile() *apdu.Profile {
+	return c.profile
+}
+
+// ThresholdOr returns the ceremony's threshold, or def.
+func (c *Ceremony) ThresholdOr(def int) int {
+	if c.Threshold > 0 {
+		return c.Threshold
+	}
+	return def
+}
+
+// TotalOr returns the roster size, or def.
+func (c *Ceremony) TotalOr(def int) int {
+	if len(c.Roster) > 0 {
+		return len(c.Roster)
+	}
+	return def
+}
+
+// SharesOr returns the share directory, or def.
+func (c *Ceremony) SharesOr(def string) string {
+	if c.Files.Shares != "" {
+		return c.Files.Shares
+	}
+	return def
+}
+
+// GroupStateOr returns the group-state document path, or def.
+func (c *Ceremony) GroupStateOr(def string) string {
+	if c.Files.GroupState != "" {
+		return c.Files.GroupState
+	}
+	return def
+}
+
+// SignerList returns the signing set as a comma-separated flag value.
+func (c *Ceremony) SignerList() string {
+	return idList(c.Signers)
+}
+
+// HardwareList returns the roster's hardware participants as a
+// comma-separated flag value.
+func (c *Ceremony) HardwareList() string {
+	var ids []int
+	for _, p := range c.Roster {
+		if p.Hardware {
+			ids = append(ids, p.ID)
+		}
+	}
+	return idList(ids)
+}
+
+// Poseidon reports whether signatures use the Poseidon challenge.
+func (c *Ceremony) Poseidon() bool {
+	return c.Hasher == HasherPoseidon
+}
+
+func idList(ids []int) string {
+	s := make([]string, len(ids))
+	for i, id := range ids {
+		s[i] = strconv.Itoa(id)
+	}
+	return strings.Join(s, ",")
+}
@@ -0,0 +1,157 @@
+// Package workspace stores named contexts, like kubectl contexts, that bundle
+// the group, transport, coordinator and keystore an operator works with, plus
+// command aliases. Commands take their defaults from the current context, and
+// signing refuses input for any other group.
+package workspace
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"keygen/schema"
+)
+
+// Environment variables
+const (
+	EnvConfig  = "FY_LEDGER_CONFIG"  // Config file path
+	EnvContext = "FY_LEDGER_CONTEXT" // Overrides the current context for one command
+)
+
+// Context is one environment.
+type Context struct {
+	GroupKey    string `json:"group_key,omitempty"`   // Signing is refused for other groups
+	GroupState  string `json:"group_state,omitempty"` // Group-state document path
+	Transport   string `json:"transport,omitempty"`   // Device address (host:port) or "sim"
+	Profile     string `json:"profile,omitempty"`     // APDU CLA/INS profile path
+	Coordinator string `json:"coordinator,omitempty"` // Coordinator URL
+	Keystore    string `json:"keystore,omitempty"`    // Keystore path
+	TSA         string `json:"tsa,omitempty"`         // RFC 3161 timestamping authority URL
+	TransLog    string `json:"translog,omitempty"`    // Transparency log URL
+}
+
+// Config is the config file.
+type Config struct {
+	Current  string              `json:"current,omitempty"`
+	Contexts map[string]*Context `json:"contexts"`
+	Aliases  map[string]string   `json:"aliases,omitempty"` // name -> command line
+}
+
+// Path returns the config file path: $FY_LEDGER_CONFIG, or fy-ledger/config.json
+// in the user config directory.
+func Path() (string, error) {
+	if p := os.Getenv(EnvConfig); p != "" {
+		return p, nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "fy-ledger", "config.json"), nil
+}
+
+// Load reads the config file. A missing file is an empty config.
+func Load(path string) (*Config, error) {
+	cfg := &Config{Contexts: make(map[string]*Context), Aliases: make(map[string]string)}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return cfg, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := schema.Unmarshal(data, cfg, path); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if cfg.Contexts == nil {
+		cfg.Contexts = make(map[string]*Context)
+	}
+	if cfg.Aliases == nil {
+		cfg.Aliases = make(map[string]string)
+	}
+	return cfg, nil
+}
+
+// Save writes the config file, creating its directory. The file is private
+// to the user since it points at keystores.
+func (c *Config) Save(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Active returns the name and context in effect: $FY_LEDGER_CONTEXT if set,
+// else the current context. It returns "", nil if there is none.
+func (c *Config) Active() (string, *Context, error) {
+	name := c.Current
+	if env := os.Getenv(EnvContext); env != "" {
+		name = env
+	}
+	if name == "" {
+		return "", nil, nil
+	}
+	ctx, ok := c.Contexts[name]
+	if !ok {
+		return "", nil, fmt.Errorf("context %q does not exist", name)
+	}
+	return name, ctx, nil
+}
+
+// Use makes name the current context.
+func (c *Config) Use(name string) error {
+	if _, ok := c.Contexts[name]; !ok {
+		return fmt.Errorf("context %q does not exist", name)
+	}
+	c.Current = name
+	return nil
+}
+
+// Delete removes a context, clearing it as current.
+func (c *Config) Delete(name string) error {
+	if _, ok := c.Contexts[name]; !ok {
+		return fmt.Errorf("context %q does not exist", name)
+	}
+	delete(c.Contexts, name)
+	if c.Current == name {
+		c.Current = ""
+	}
+	return nil
+}
+
+// Names returns the context names, sorted.
+func (c *Config) Names() []string {
+	names := make([]string, 0, len(c.Contexts))
+	for name := range c.Contexts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// CheckGroup refuses a group key that differs from the context's.
+func (ctx *Context) CheckGroup(groupKey string) error {
+	if ctx == nil || ctx.GroupKey == "" || ctx.GroupKey == groupKey {
+		return nil
+	}
+	return fmt.Errorf("input is for group %s but the context is for group %s", ShortKey(groupKey), ShortKey(ctx.GroupKey))
+}
+
+// ShortKey abbreviates a hex key for messages.
+func ShortKey(key string) string {
+	if len(key) > 16 {
+		return key[:16] + "..."
+	}
+	return key
+}
@@ -62,7 +62,7 @@ def send_apdu(sock, cla, ins, p1=0, p2=0, data=b""):
 
 def run_keygen(tool_path, threshold=2, total=3):
     result = subprocess.run(
-        [str(tool_path), "keygen", "-t", str(threshold), "-n", str(total)],
+        [str(tool_path), "keygen", "-insecure-stdout", "-t", str(threshold), "-n", str(total)],
         capture_output=True, text=True, check=True
     )
     return json.loads(result.stdout)
@@ -70,7 +70,7 @@ def run_keygen(tool_path, threshold=2, total=3):
 
 def run_commit(tool_path, participant_id):
     result = subprocess.run(
-        [str(tool_path), "commit", "-id", str(participant_id)],
+        [str(tool_path), "commit", "-insecure-stdout", "-id", str(participant_id)],
         capture_output=True, text=True, check=True
     )
     return json.loads(result.stdout)
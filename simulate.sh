@@ -14,8 +14,8 @@ MODEL="${2:-nanos2}"  # nanos2 = Nano S Plus
 if [ ! -f "$APP_ELF" ]; then
     echo "Error: App binary not found: $APP_ELF"
     echo ""
-    echo "Build the app first:"
-    echo "  ./build.sh"
+    echo "Build the app for Speculos first:"
+    echo "  ./build.sh BJJ speculos"
     echo ""
     echo "Or specify the path to your .elf file:"
     echo "  ./simulate.sh path/to/app.elf"
@@ -197,8 +197,10 @@ void frost_compute_binding_factor(uint8_t result[CURVE_SCALAR_SIZE],
 void frost_compute_challenge(uint8_t result[CURVE_SCALAR_SIZE],
                              const uint8_t *group_commitment,
                              const uint8_t *group_pubkey,
-                             const uint8_t *message_hash) {
-    // H2: Blake2b(prefix || "chal" || R || Y || message)
+                             const uint8_t *message_hash,
+                             const char *purpose,
+                             uint8_t purpose_len) {
+    // H2: Blake2b(prefix || "chal" [|| "/" || purpose] || R || Y || message)
     cx_blake2b_t ctx;
     uint8_t hash[64];
     uint8_t reversed[64];
@@ -209,10 +211,18 @@ void frost_compute_challenge(uint8_t result[CURVE_SCALAR_SIZE],
     cx_hash_no_throw((cx_hash_t *)&ctx, 0,
                      (uint8_t *)FROST_DOMAIN_PREFIX, strlen(FROST_DOMAIN_PREFIX),
                      NULL, 0);
-    // tag "chal"
+    // tag "chal", or "chal/" || purpose for a purpose-tagged share
     cx_hash_no_throw((cx_hash_t *)&ctx, 0,
                      (uint8_t *)"chal", 4,
                      NULL, 0);
+    if (purpose_len > 0) {
+        cx_hash_no_throw((cx_hash_t *)&ctx, 0,
+                         (uint8_t *)"/", 1,
+                         NULL, 0);
+        cx_hash_no_throw((cx_hash_t *)&ctx, 0,
+                         (uint8_t *)purpose, purpose_len,
+                         NULL, 0);
+    }
     // R (group commitment)
     cx_hash_no_throw((cx_hash_t *)&ctx, 0,
                      group_commitment, CURVE_POINT_SIZE,
@@ -233,6 +243,19 @@ void frost_compute_challenge(uint8_t result[CURVE_SCALAR_SIZE],
     curve_scalar_reduce_64(result, reversed);
 }
 
+void frost_nonce_generate(uint8_t result[CURVE_SCALAR_SIZE],
+                          const uint8_t *secret_share) {
+    // H3: Blake2b(prefix || "nonce" || random_bytes || secret_share)
+    uint8_t random_bytes[32];
+
+    cx_rng(random_bytes, sizeof(random_bytes));
+    blake2b_hash_to_scalar(result, "nonce",
+                           random_bytes, sizeof(random_bytes),
+                           secret_share, CURVE_SCALAR_SIZE,
+                           NULL, 0);
+    explicit_bzero(random_bytes, sizeof(random_bytes));
+}
+
 bool frost_compute_group_commitment(uint8_t result[CURVE_POINT_SIZE],
                                     const uint8_t *commitment_list,
                                     const uint8_t *binding_factors,
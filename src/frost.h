@@ -52,11 +52,20 @@ void frost_compute_binding_factor(uint8_t result[CURVE_SCALAR_SIZE],
 
 // H2: Compute FROST challenge
 // challenge = Blake2b(prefix || "chal" || R || Y || message) mod order
+// A key share with a purpose tag uses the tag "chal/" || purpose instead
 // Output interpreted as little-endian before reducing
 void frost_compute_challenge(uint8_t result[CURVE_SCALAR_SIZE],
                              const uint8_t *group_commitment,
                              const uint8_t *group_pubkey,
-                             const uint8_t *message_hash);
+                             const uint8_t *message_hash,
+                             const char *purpose,
+                             uint8_t purpose_len);
+
+// H3: Generate a nonce (RFC 9591 nonce_generate)
+// nonce = Blake2b(prefix || "nonce" || random_bytes || secret_share) mod order
+// with 32 fresh random bytes, so a weak RNG alone does not reveal the nonce
+void frost_nonce_generate(uint8_t result[CURVE_SCALAR_SIZE],
+                          const uint8_t *secret_share);
 
 // ============================================================================
 // Group Commitment Computation
@@ -26,7 +26,9 @@ void frost_storage_init(void) {
 bool frost_inject_keys(uint8_t curve_id,
                        const uint8_t *group_pubkey,
                        uint16_t identifier,
-                       const uint8_t *secret_share) {
+                       const uint8_t *secret_share,
+                       const char *purpose,
+                       uint8_t purpose_len) {
 
     // Validate inputs
     if (group_pubkey == NULL || secret_share == NULL) {
@@ -37,6 +39,10 @@ bool frost_inject_keys(uint8_t curve_id,
         return false;  // FROST identifiers must be non-zero
     }
 
+    if (purpose_len > MAX_PURPOSE_LEN || (purpose_len > 0 && purpose == NULL)) {
+        return false;
+    }
+
     // Write each field to NVRAM
     // Using nvm_write() syscall for flash memory access
 
@@ -47,6 +53,15 @@ bool frost_inject_keys(uint8_t curve_id,
     nvm_write((void *)&N_frost.group_public_key, (void *)group_pubkey, CURVE_POINT_SIZE);
     nvm_write((void *)&N_frost.secret_share, (void *)secret_share, CURVE_SCALAR_SIZE);
 
+    // Zero-fill the tag so a shorter one does not inherit the old tail
+    char tag[MAX_PURPOSE_LEN];
+    memset(tag, 0, sizeof(tag));
+    if (purpose_len > 0) {
+        memcpy(tag, purpose, purpose_len);
+    }
+    nvm_write((void *)&N_frost.purpose, tag, sizeof(tag));
+    nvm_write((void *)&N_frost.purpose_len, &purpose_len, sizeof(purpose_len));
+
     return true;
 }
 
@@ -62,6 +77,11 @@ const uint8_t *frost_get_group_pubkey(void) {
     return (const uint8_t *)N_frost.group_public_key;
 }
 
+uint8_t frost_get_purpose(const char **purpose) {
+    *purpose = (const char *)N_frost.purpose;
+    return N_frost.purpose_len;
+}
+
 void frost_clear_keys(void) {
     // Zero out all storage
     frost_storage_t zeros;
@@ -13,6 +13,9 @@
 // Maximum participants in FROST signing
 #define MAX_PARTICIPANTS  15
 
+// Longest purpose tag a key share can be provisioned with
+#define MAX_PURPOSE_LEN   16
+
 // Commitment entry size: identifier (32) + hiding (32) + binding (32) = 96 bytes
 #define COMMITMENT_ENTRY_SIZE  (IDENTIFIER_SIZE + CURVE_POINT_SIZE * 2)
 
@@ -28,7 +31,9 @@ typedef struct __attribute__((aligned(64))) {
     uint16_t identifier;                          // FROST participant ID
     uint8_t  threshold;                           // Signing threshold (t)
     uint8_t  max_signers;                         // Total participants (n)
-    uint8_t  _padding[26];                        // Alignment padding to 32 bytes
+    uint8_t  purpose_len;                         // Purpose tag length, 0 if untagged
+    char     purpose[MAX_PURPOSE_LEN];            // Purpose tag bound into the challenge
+    uint8_t  _padding[9];                         // Alignment padding to 32 bytes
     uint8_t  group_public_key[CURVE_POINT_SIZE];  // 32 bytes (compressed)
     uint8_t  secret_share[CURVE_SCALAR_SIZE];     // 32 bytes - NEVER expose this!
 } frost_storage_t;                                // Total: 96 bytes
@@ -91,7 +96,9 @@ void frost_storage_init(void);
 bool frost_inject_keys(uint8_t curve_id,
                        const uint8_t *group_pubkey,
                        uint16_t identifier,
-                       const uint8_t *secret_share);
+                       const uint8_t *secret_share,
+                       const char *purpose,
+                       uint8_t purpose_len);
 
 // Check if keys are loaded
 bool frost_has_keys(void);
@@ -102,6 +109,9 @@ uint16_t frost_get_identifier(void);
 // Get group public key
 const uint8_t *frost_get_group_pubkey(void);
 
+// Get the purpose tag of the key share; returns its length, 0 if untagged
+uint8_t frost_get_purpose(const char **purpose);
+
 // Clear all FROST keys from storage
 void frost_clear_keys(void);
 
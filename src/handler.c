@@ -15,7 +15,11 @@ uint16_t handle_get_version(uint8_t *response, uint8_t *response_len) {
     response[0] = MAJOR_VERSION;
     response[1] = MINOR_VERSION;
     response[2] = PATCH_VERSION;
-    *response_len = 3;
+    response[3] = APP_FLAG_PURPOSE;
+#ifdef AUTO_APPROVE
+    response[3] |= APP_FLAG_AUTO_APPROVE;
+#endif
+    *response_len = 4;
     return SW_OK;
 }
 
@@ -49,14 +53,25 @@ uint16_t handle_inject_keys(uint8_t p1, uint8_t p2,
         return SW_WRONG_P1P2;
     }
 
-    // Validate data length: 32 (pubkey) + 32 (id) + 32 (secret) = 96
-    if (data_len != 96) {
+    // Validate data length: 32 (pubkey) + 32 (id) + 32 (secret) = 96,
+    // optionally followed by a purpose tag of up to MAX_PURPOSE_LEN bytes
+    if (data_len < 96 || data_len > 96 + MAX_PURPOSE_LEN) {
         return SW_WRONG_LENGTH;
     }
 
     uint8_t *group_pubkey = data;
     uint8_t *id_bytes = data + 32;
     uint8_t *secret_share = data + 64;
+    const char *purpose = (const char *)(data + 96);
+    uint8_t purpose_len = data_len - 96;
+
+    // Purpose tags are lowercase letters, digits and '-'
+    for (uint8_t i = 0; i < purpose_len; i++) {
+        char ch = purpose[i];
+        if (!((ch >= 'a' && ch <= 'z') || (ch >= '0' && ch <= '9') || ch == '-')) {
+            return SW_INVALID_DATA;
+        }
+    }
 
     // Extract 16-bit identifier from last 2 bytes (scalar format, big-endian)
     uint16_t identifier = ((uint16_t)id_bytes[30] << 8) | id_bytes[31];
@@ -71,12 +86,12 @@ uint16_t handle_inject_keys(uint8_t p1, uint8_t p2,
     cx_sha256_hash(group_pubkey, CURVE_POINT_SIZE, hash);
 
     // Use first 4 bytes as fingerprint
-    if (!ui_confirm_inject_keys(hash, identifier)) {
+    if (!ui_confirm_inject_keys(hash, identifier, purpose, purpose_len)) {
         return SW_USER_REJECTED;
     }
 
     // Store the keys
-    if (!frost_inject_keys(p1, group_pubkey, identifier, secret_share)) {
+    if (!frost_inject_keys(p1, group_pubkey, identifier, secret_share, purpose, purpose_len)) {
         return SW_INTERNAL_ERROR;
     }
 
@@ -98,13 +113,9 @@ uint16_t handle_commit(uint8_t *response, uint8_t *response_len) {
         return SW_CONDITIONS_NOT_SAT;
     }
 
-    // Generate random nonces using secure RNG
-    cx_rng(G_frost_ctx.hiding_nonce, CURVE_SCALAR_SIZE);
-    cx_rng(G_frost_ctx.binding_nonce, CURVE_SCALAR_SIZE);
-
-    // Reduce nonces modulo curve order
-    curve_scalar_reduce(G_frost_ctx.hiding_nonce, G_frost_ctx.hiding_nonce);
-    curve_scalar_reduce(G_frost_ctx.binding_nonce, G_frost_ctx.binding_nonce);
+    // Generate nonces from the secure RNG and the secret share (H3)
+    frost_nonce_generate(G_frost_ctx.hiding_nonce, (const uint8_t *)N_frost.secret_share);
+    frost_nonce_generate(G_frost_ctx.binding_nonce, (const uint8_t *)N_frost.secret_share);
 
     // Compute commitments: C = nonce * G
     if (!curve_base_mult(G_frost_ctx.hiding_commit, G_frost_ctx.hiding_nonce)) {
@@ -322,11 +333,16 @@ uint16_t handle_partial_sign(uint8_t *response, uint8_t *response_len) {
         // Use pre-computed Poseidon challenge (Railgun mode)
         memcpy(challenge, G_frost_ctx.external_challenge, CURVE_SCALAR_SIZE);
     } else {
-        // Compute challenge using Blake2b (legacy mode)
+        // Compute challenge using Blake2b (legacy mode), bound to the
+        // share's purpose tag
+        const char *purpose;
+        uint8_t purpose_len = frost_get_purpose(&purpose);
         frost_compute_challenge(challenge,
                                 group_commitment,
                                 frost_get_group_pubkey(),
-                                G_frost_ctx.message_hash);
+                                G_frost_ctx.message_hash,
+                                purpose,
+                                purpose_len);
     }
 
     // Compute partial signature
@@ -378,6 +394,13 @@ uint16_t handle_inject_challenge(uint8_t *data, uint8_t data_len) {
         return SW_CONDITIONS_NOT_SAT;
     }
 
+    // An injected challenge is not bound to the share's purpose tag, so a
+    // tagged share computes every challenge itself
+    const char *purpose;
+    if (frost_get_purpose(&purpose) > 0) {
+        return SW_CONDITIONS_NOT_SAT;
+    }
+
     // Challenge must be 32 bytes
     if (data_len != CURVE_SCALAR_SIZE) {
         return SW_WRONG_LENGTH;
@@ -399,3 +422,44 @@ uint16_t handle_reset(void) {
     frost_ctx_reset();
     return SW_OK;
 }
+
+// ============================================================================
+// Wipe Keys Handler
+// ============================================================================
+
+uint16_t handle_wipe_keys(uint8_t *data, uint8_t data_len,
+                          uint8_t *response, uint8_t *response_len) {
+    *response_len = 0;
+
+    if (data_len != CURVE_POINT_SIZE + IDENTIFIER_SIZE) {
+        return SW_WRONG_LENGTH;
+    }
+
+    // Nothing to wipe
+    if (!frost_has_keys()) {
+        response[0] = 0x00;
+        *response_len = 1;
+        return SW_OK;
+    }
+
+    // Only wipe the keys the host means to: a wrong device keeps its share
+    uint8_t *id_bytes = data + CURVE_POINT_SIZE;
+    uint16_t identifier = ((uint16_t)id_bytes[30] << 8) | id_bytes[31];
+    if (memcmp(data, frost_get_group_pubkey(), CURVE_POINT_SIZE) != 0 ||
+        identifier != frost_get_identifier()) {
+        return SW_INVALID_DATA;
+    }
+
+    uint8_t hash[32];
+    cx_sha256_hash(data, CURVE_POINT_SIZE, hash);
+    if (!ui_confirm_wipe_keys(hash, identifier)) {
+        return SW_USER_REJECTED;
+    }
+
+    // Zeroes the NVRAM slot and the signing context with its nonces
+    frost_clear_keys();
+
+    response[0] = 0x01;
+    *response_len = 1;
+    return SW_OK;
+}
@@ -20,6 +20,8 @@
 #define INS_FROST_PARTIAL_SIGN          0x1E
 #define INS_FROST_RESET                 0x1F
 #define INS_FROST_INJECT_CHALLENGE      0x20  // Pre-computed Poseidon challenge for Railgun
+#define INS_FROST_GET_COUNTER           0x21  // Reserved: monotonic signing counter (not implemented yet)
+#define INS_FROST_WIPE_KEYS             0x24  // Erase the key share of a decommissioned participant
 
 // Curve identifier is defined in curve.h as CURVE_ID
 
@@ -34,6 +36,12 @@
 #define SW_USER_REJECTED                0x6985
 #define SW_INTERNAL_ERROR               0x6F00
 
+// App flags (GET_VERSION byte 3)
+#define APP_FLAG_AUTO_APPROVE           0x01  // Confirmation screens are skipped
+#define APP_FLAG_COUNTER                0x02  // Reserved: GET_COUNTER is supported
+#define APP_FLAG_PURPOSE                0x10  // INJECT_KEYS takes a purpose tag
+#define APP_FLAG_CONFIRM_CODE           0x20  // Reserved: confirmation screens show a code
+
 // ============================================================================
 // Handler Functions
 // ============================================================================
@@ -41,7 +49,7 @@
 // Get app version
 // P1: 0x00
 // P2: 0x00
-// Response: major (1) || minor (1) || patch (1)
+// Response: major (1) || minor (1) || patch (1) || flags (1)
 uint16_t handle_get_version(uint8_t *response, uint8_t *response_len);
 
 // Get group public key (if keys are loaded)
@@ -101,6 +109,14 @@ uint16_t handle_partial_sign(uint8_t *response, uint8_t *response_len);
 // Response: none
 uint16_t handle_reset(void);
 
+// Wipe the key share, after the user confirms
+// P1: 0x00
+// P2: 0x00
+// Data: group_pubkey (32) || identifier (32), which must match the stored keys
+// Response: 0x01 if keys were wiped, 0x00 if there were none
+uint16_t handle_wipe_keys(uint8_t *data, uint8_t data_len,
+                          uint8_t *response, uint8_t *response_len);
+
 // Inject pre-computed challenge (for Railgun/Poseidon compatibility)
 // P1: 0x00
 // P2: 0x00
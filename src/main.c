@@ -105,6 +105,10 @@ void app_main(void) {
                         sw = handle_inject_challenge(data, lc);
                         break;
 
+                    case INS_FROST_WIPE_KEYS:
+                        sw = handle_wipe_keys(data, lc, response, &response_len);
+                        break;
+
                     default:
                         THROW(SW_INS_NOT_SUPPORTED);
                 }
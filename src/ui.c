@@ -2,6 +2,7 @@
 #include "os.h"
 #include "ux.h"
 #include "glyphs.h"
+#include "cx.h"
 #include <string.h>
 #include <stdio.h>
 
@@ -17,6 +18,10 @@ static volatile bool G_user_responded;
 static char G_line1[32];
 static char G_line2[32];
 
+// Text of the current confirmation screen and its confirmation code
+static char G_screen[96];
+static char G_code[CONFIRM_CODE_DIGITS + 1];
+
 // ============================================================================
 // Helper Functions
 // ============================================================================
@@ -31,6 +36,40 @@ static void frost_bytes_to_hex(const uint8_t *bytes, size_t len, char *out) {
     out[len * 2] = '\0';
 }
 
+// Append a string to the screen text, truncating at the buffer's end
+static size_t screen_append(size_t pos, const char *s, size_t len) {
+    if (len > sizeof(G_screen) - 1 - pos) {
+        len = sizeof(G_screen) - 1 - pos;
+    }
+    memcpy(G_screen + pos, s, len);
+    G_screen[pos + len] = '\0';
+    return pos + len;
+}
+
+// Derive the confirmation code of G_screen: the first 4 bytes of
+// SHA-256(domain || screen), big-endian, mod 10^6, as 6 digits. The
+// host will derive it the same way once APP_FLAG_CONFIRM_CODE is set
+static void set_confirm_code(size_t screen_len) {
+    cx_sha256_t ctx;
+    uint8_t hash[32];
+
+    cx_sha256_init_no_throw(&ctx);
+    cx_hash_no_throw((cx_hash_t *)&ctx, 0,
+                     (uint8_t *)CONFIRM_CODE_DOMAIN, strlen(CONFIRM_CODE_DOMAIN),
+                     NULL, 0);
+    cx_hash_no_throw((cx_hash_t *)&ctx, CX_LAST,
+                     (uint8_t *)G_screen, screen_len, hash, sizeof(hash));
+
+    uint32_t n = ((uint32_t)hash[0] << 24) | ((uint32_t)hash[1] << 16) |
+                 ((uint32_t)hash[2] << 8) | hash[3];
+    n %= 1000000;
+    for (int i = CONFIRM_CODE_DIGITS - 1; i >= 0; i--) {
+        G_code[i] = '0' + (n % 10);
+        n /= 10;
+    }
+    G_code[CONFIRM_CODE_DIGITS] = '\0';
+}
+
 // ============================================================================
 // BAGL UI Elements (for Nano S/S+/X)
 // ============================================================================
@@ -107,8 +146,16 @@ UX_STEP_NOCB(
         G_line2,
     });
 
-UX_STEP_CB(
+UX_STEP_NOCB(
     ux_inject_flow_4_step,
+    bn,
+    {
+        "Code",
+        G_code,
+    });
+
+UX_STEP_CB(
+    ux_inject_flow_5_step,
     pb,
     ui_callback_approve(),
     {
@@ -117,7 +164,7 @@ UX_STEP_CB(
     });
 
 UX_STEP_CB(
-    ux_inject_flow_5_step,
+    ux_inject_flow_6_step,
     pb,
     ui_callback_reject(),
     {
@@ -130,7 +177,8 @@ UX_FLOW(ux_inject_flow,
         &ux_inject_flow_2_step,
         &ux_inject_flow_3_step,
         &ux_inject_flow_4_step,
-        &ux_inject_flow_5_step);
+        &ux_inject_flow_5_step,
+        &ux_inject_flow_6_step);
 
 // Confirmation flow for signing
 UX_STEP_NOCB(
@@ -150,8 +198,16 @@ UX_STEP_NOCB(
         .text = G_line1,
     });
 
-UX_STEP_CB(
+UX_STEP_NOCB(
     ux_sign_flow_3_step,
+    bn,
+    {
+        "Code",
+        G_code,
+    });
+
+UX_STEP_CB(
+    ux_sign_flow_4_step,
     pb,
     ui_callback_approve(),
     {
@@ -160,7 +216,7 @@ UX_STEP_CB(
     });
 
 UX_STEP_CB(
-    ux_sign_flow_4_step,
+    ux_sign_flow_5_step,
     pb,
     ui_callback_reject(),
     {
@@ -172,7 +228,8 @@ UX_FLOW(ux_sign_flow,
         &ux_sign_flow_1_step,
         &ux_sign_flow_2_step,
         &ux_sign_flow_3_step,
-        &ux_sign_flow_4_step);
+        &ux_sign_flow_4_step,
+        &ux_sign_flow_5_step);
 
 #endif  // HAVE_BAGL
 
@@ -194,19 +251,93 @@ void ui_idle(void) {
 #endif
 }
 
-bool ui_confirm_inject_keys(const uint8_t fingerprint[4], uint16_t identifier) {
-    (void)fingerprint;
-    (void)identifier;
+bool ui_confirm_inject_keys(const uint8_t fingerprint[4], uint16_t identifier,
+                            const char *purpose, uint8_t purpose_len) {
+    // Screen text: "Group Key: <hex>\nParticipant: <n>[\nPurpose: <tag>]"
+    char digits[6];
+    int n = 0;
+    size_t pos = 0;
+
+    frost_bytes_to_hex(fingerprint, 4, G_line1);
+    do {
+        digits[n++] = '0' + (identifier % 10);
+        identifier /= 10;
+    } while (identifier > 0);
+    for (int i = 0; i < n; i++) {
+        G_line2[i] = digits[n - 1 - i];
+    }
+    G_line2[n] = '\0';
+
+    pos = screen_append(pos, "Group Key: ", 11);
+    pos = screen_append(pos, G_line1, 8);
+    pos = screen_append(pos, "\nParticipant: ", 14);
+    pos = screen_append(pos, G_line2, n);
+    if (purpose_len > 0) {
+        pos = screen_append(pos, "\nPurpose: ", 10);
+        pos = screen_append(pos, purpose, purpose_len);
+    }
+    set_confirm_code(pos);
+
+#ifdef AUTO_APPROVE
+    // Auto-approve for Speculos testing (reported via APP_FLAG_AUTO_APPROVE)
+    return true;
+#else
     // TODO: Implement proper async UI flow for production
-    // Auto-approve for Speculos testing
+    // Until then, refuse rather than act without the user
+    return false;
+#endif
+}
+
+bool ui_confirm_wipe_keys(const uint8_t fingerprint[4], uint16_t identifier) {
+    // Screen text: "Wipe Keys\nGroup Key: <hex>\nParticipant: <n>"
+    char digits[6];
+    int n = 0;
+    size_t pos = 0;
+
+    frost_bytes_to_hex(fingerprint, 4, G_line1);
+    do {
+        digits[n++] = '0' + (identifier % 10);
+        identifier /= 10;
+    } while (identifier > 0);
+    for (int i = 0; i < n; i++) {
+        G_line2[i] = digits[n - 1 - i];
+    }
+    G_line2[n] = '\0';
+
+    pos = screen_append(pos, "Wipe Keys\nGroup Key: ", 21);
+    pos = screen_append(pos, G_line1, 8);
+    pos = screen_append(pos, "\nParticipant: ", 14);
+    pos = screen_append(pos, G_line2, n);
+    set_confirm_code(pos);
+
+#ifdef AUTO_APPROVE
+    // Auto-approve for Speculos testing (reported via APP_FLAG_AUTO_APPROVE)
     return true;
+#else
+    // TODO: Implement proper async UI flow for production
+    // Until then, refuse rather than act without the user
+    return false;
+#endif
 }
 
 bool ui_confirm_sign(const uint8_t message_hash[32]) {
-    (void)message_hash;
-    // TODO: Implement proper async UI flow for production
-    // Auto-approve for Speculos testing
+    // Screen text: "Message Hash: <hex>"
+    char hash_hex[65];
+    size_t pos = 0;
+
+    frost_bytes_to_hex(message_hash, 32, hash_hex);
+    pos = screen_append(pos, "Message Hash: ", 14);
+    pos = screen_append(pos, hash_hex, 64);
+    set_confirm_code(pos);
+
+#ifdef AUTO_APPROVE
+    // Auto-approve for Speculos testing (reported via APP_FLAG_AUTO_APPROVE)
     return true;
+#else
+    // TODO: Implement proper async UI flow for production
+    // Until then, refuse rather than act without the user
+    return false;
+#endif
 }
 
 void ui_processing(void) {
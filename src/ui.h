@@ -3,6 +3,16 @@
 #include <stdint.h>
 #include <stdbool.h>
 
+// ============================================================================
+// Confirmation Codes
+// ============================================================================
+
+// The confirmation screens show a code derived from their text, which the
+// operator will type into the host to show they read the screen (README,
+// Confirmation Codes). Not reported until the flows are shown.
+#define CONFIRM_CODE_DOMAIN "fy-ledger/confirm-code/v1"
+#define CONFIRM_CODE_DIGITS 6
+
 // ============================================================================
 // UI Functions
 // ============================================================================
@@ -14,12 +24,20 @@ void ui_init(void);
 void ui_idle(void);
 
 // Confirm key injection
-// Shows group key fingerprint and participant ID
+// Shows group key fingerprint, participant ID and purpose tag, if any, and
+// the confirmation code of that text
+// Returns true if user approved, false if rejected
+bool ui_confirm_inject_keys(const uint8_t fingerprint[4], uint16_t identifier,
+                            const char *purpose, uint8_t purpose_len);
+
+// Confirm wiping the key share
+// Shows a warning, the group key fingerprint and participant ID, and the
+// confirmation code of that text
 // Returns true if user approved, false if rejected
-bool ui_confirm_inject_keys(const uint8_t fingerprint[4], uint16_t identifier);
+bool ui_confirm_wipe_keys(const uint8_t fingerprint[4], uint16_t identifier);
 
 // Confirm signing operation
-// Shows message hash preview
+// Shows message hash and the confirmation code of that text
 // Returns true if user approved, false if rejected
 bool ui_confirm_sign(const uint8_t message_hash[32]);
 